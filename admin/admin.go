@@ -0,0 +1,308 @@
+// Package admin serves a token-protected control API for a service's
+// runtime knobs: circuit breakers, rate limit overrides, feature flags, the
+// log level and health maintenance mode.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// Config holds the admin API configuration. Knobs left nil are not exposed.
+type Config struct {
+	Token  string // Bearer token required on every request
+	Prefix string // Defaults to /admin
+
+	Breakers      map[string]*middleware.CircuitBreaker
+	RateLimiter   *middleware.OverrideRateLimiter
+	Flags         *middleware.FeatureFlags
+	LogLevel      *slog.LevelVar
+	HealthChecker *middleware.HealthChecker
+
+	Logger *slog.Logger // Changes are logged here; nil uses slog.Default
+}
+
+// Admin is the admin API
+type Admin struct {
+	config *Config
+	prefix string
+	logger *slog.Logger
+	mux    *http.ServeMux
+}
+
+// New creates the admin API
+func New(config *Config) (*Admin, error) {
+	if config == nil || config.Token == "" {
+		return nil, errors.New("admin API requires a token")
+	}
+
+	prefix := strings.TrimRight(config.Prefix, "/")
+	if prefix == "" {
+		prefix = "/admin"
+	}
+
+	admin := &Admin{config: config, prefix: prefix, logger: config.Logger, mux: http.NewServeMux()}
+	if admin.logger == nil {
+		admin.logger = slog.Default()
+	}
+
+	admin.mux.HandleFunc("GET "+prefix+"/breakers", admin.listBreakers)
+	admin.mux.HandleFunc("POST "+prefix+"/breakers/{name}/{action}", admin.updateBreaker)
+	admin.mux.HandleFunc("GET "+prefix+"/ratelimits", admin.listRateLimits)
+	admin.mux.HandleFunc("PUT "+prefix+"/ratelimits/{key}", admin.setRateLimit)
+	admin.mux.HandleFunc("DELETE "+prefix+"/ratelimits/{key}", admin.removeRateLimit)
+	admin.mux.HandleFunc("GET "+prefix+"/flags", admin.listFlags)
+	admin.mux.HandleFunc("PUT "+prefix+"/flags/{name}", admin.setFlag)
+	admin.mux.HandleFunc("GET "+prefix+"/log-level", admin.getLogLevel)
+	admin.mux.HandleFunc("PUT "+prefix+"/log-level", admin.setLogLevel)
+	admin.mux.HandleFunc("GET "+prefix+"/maintenance", admin.getMaintenance)
+	admin.mux.HandleFunc("PUT "+prefix+"/maintenance", admin.setMaintenance)
+	return admin, nil
+}
+
+// Handler returns the admin API as an http.Handler serving paths under the prefix
+func (a *Admin) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.authorized(r) {
+			middleware.RenderError(w, r, types.NewUnauthorizedError("Invalid admin token"))
+			return
+		}
+		a.mux.ServeHTTP(w, r)
+	})
+}
+
+// Mount registers the admin API on a Gin router under the prefix
+func (a *Admin) Mount(router gin.IRouter) {
+	router.Any(a.prefix+"/*path", gin.WrapH(a.Handler()))
+}
+
+// authorized compares the bearer token in constant time
+func (a *Admin) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(a.config.Token)) == 1
+}
+
+// respond writes a successful response
+func respond[T any](w http.ResponseWriter, data T) {
+	status, body := types.OK(data)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// decode reads a JSON request body
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(v); err != nil {
+		middleware.RenderError(w, r, types.NewBadRequestError("Invalid JSON body"))
+		return false
+	}
+	return true
+}
+
+// notConfigured answers requests for knobs the service didn't expose
+func notConfigured(w http.ResponseWriter, r *http.Request, knob string) {
+	middleware.RenderError(w, r, types.NewNotFoundError(knob))
+}
+
+// audit logs a change made through the admin API
+func (a *Admin) audit(r *http.Request, action string, attrs ...interface{}) {
+	a.logger.InfoContext(r.Context(), "admin change",
+		append([]interface{}{"action", action, "correlation_id", middleware.GetCorrelationID(r.Context())}, attrs...)...)
+}
+
+func (a *Admin) listBreakers(w http.ResponseWriter, r *http.Request) {
+	breakers := make(map[string]map[string]interface{}, len(a.config.Breakers))
+	for name, breaker := range a.config.Breakers {
+		breakers[name] = breaker.GetStats()
+	}
+	respond(w, breakers)
+}
+
+func (a *Admin) updateBreaker(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	breaker, ok := a.config.Breakers[name]
+	if !ok {
+		middleware.RenderError(w, r, types.NewNotFoundError("Circuit breaker"))
+		return
+	}
+
+	action := r.PathValue("action")
+	switch action {
+	case "open":
+		breaker.ForceOpen()
+	case "close":
+		breaker.ForceClose()
+	case "reset":
+		breaker.Reset()
+	default:
+		middleware.RenderError(w, r, types.NewBadRequestError("Action must be open, close or reset"))
+		return
+	}
+
+	a.audit(r, "breaker."+action, "breaker", name)
+	respond(w, breaker.GetStats())
+}
+
+// rateLimitRequest is the body of a rate limit override; Window is a Go duration such as "1m"
+type rateLimitRequest struct {
+	Limit  int    `json:"limit"`
+	Window string `json:"window"`
+}
+
+func (a *Admin) listRateLimits(w http.ResponseWriter, r *http.Request) {
+	if a.config.RateLimiter == nil {
+		notConfigured(w, r, "Rate limiter")
+		return
+	}
+	respond(w, a.config.RateLimiter.Overrides())
+}
+
+func (a *Admin) setRateLimit(w http.ResponseWriter, r *http.Request) {
+	if a.config.RateLimiter == nil {
+		notConfigured(w, r, "Rate limiter")
+		return
+	}
+
+	var req rateLimitRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	override := middleware.RateLimitOverride{Limit: req.Limit}
+	if req.Window != "" {
+		window, err := time.ParseDuration(req.Window)
+		if err != nil {
+			middleware.RenderError(w, r, types.NewValidationError(types.FieldError{Field: "window", Code: "invalid", Message: "Window must be a duration such as 1m"}))
+			return
+		}
+		override.Window = window
+	}
+
+	key := r.PathValue("key")
+	if err := a.config.RateLimiter.SetOverride(key, override); err != nil {
+		middleware.RenderError(w, r, types.NewValidationError(types.FieldError{Field: "limit", Code: "invalid", Message: err.Error()}))
+		return
+	}
+
+	a.audit(r, "ratelimit.set", "key", key, "limit", override.Limit, "window", override.Window.String())
+	respond(w, override)
+}
+
+func (a *Admin) removeRateLimit(w http.ResponseWriter, r *http.Request) {
+	if a.config.RateLimiter == nil {
+		notConfigured(w, r, "Rate limiter")
+		return
+	}
+
+	key := r.PathValue("key")
+	a.config.RateLimiter.RemoveOverride(key)
+	a.audit(r, "ratelimit.remove", "key", key)
+	respond(w, a.config.RateLimiter.Overrides())
+}
+
+func (a *Admin) listFlags(w http.ResponseWriter, r *http.Request) {
+	if a.config.Flags == nil {
+		notConfigured(w, r, "Feature flags")
+		return
+	}
+	respond(w, a.config.Flags.All())
+}
+
+func (a *Admin) setFlag(w http.ResponseWriter, r *http.Request) {
+	if a.config.Flags == nil {
+		notConfigured(w, r, "Feature flags")
+		return
+	}
+
+	name := r.PathValue("name")
+	if !a.config.Flags.Has(name) {
+		middleware.RenderError(w, r, types.NewNotFoundError("Feature flag"))
+		return
+	}
+
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+
+	a.config.Flags.Set(name, req.Enabled)
+	a.audit(r, "flag.set", "flag", name, "enabled", req.Enabled)
+	respond(w, a.config.Flags.All())
+}
+
+// logLevel is the body of the log level endpoints
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+func (a *Admin) getLogLevel(w http.ResponseWriter, r *http.Request) {
+	if a.config.LogLevel == nil {
+		notConfigured(w, r, "Log level")
+		return
+	}
+	respond(w, logLevel{Level: strings.ToLower(a.config.LogLevel.Level().String())})
+}
+
+func (a *Admin) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	if a.config.LogLevel == nil {
+		notConfigured(w, r, "Log level")
+		return
+	}
+
+	var req logLevel
+	if !decode(w, r, &req) {
+		return
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+		middleware.RenderError(w, r, types.NewValidationError(types.FieldError{Field: "level", Code: "invalid", Message: "Level must be debug, info, warn or error"}))
+		return
+	}
+
+	previous := a.config.LogLevel.Level()
+	a.config.LogLevel.Set(level)
+	a.audit(r, "log_level.set", "from", previous.String(), "to", level.String())
+	respond(w, logLevel{Level: strings.ToLower(level.String())})
+}
+
+// maintenance is the body of the maintenance endpoints
+type maintenance struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+}
+
+func (a *Admin) getMaintenance(w http.ResponseWriter, r *http.Request) {
+	if a.config.HealthChecker == nil {
+		notConfigured(w, r, "Health checker")
+		return
+	}
+	enabled, message := a.config.HealthChecker.Maintenance()
+	respond(w, maintenance{Enabled: enabled, Message: message})
+}
+
+func (a *Admin) setMaintenance(w http.ResponseWriter, r *http.Request) {
+	if a.config.HealthChecker == nil {
+		notConfigured(w, r, "Health checker")
+		return
+	}
+
+	var req maintenance
+	if !decode(w, r, &req) {
+		return
+	}
+
+	a.config.HealthChecker.SetMaintenance(req.Enabled, req.Message)
+	a.audit(r, "maintenance.set", "enabled", req.Enabled, "message", req.Message)
+	enabled, message := a.config.HealthChecker.Maintenance()
+	respond(w, maintenance{Enabled: enabled, Message: message})
+}
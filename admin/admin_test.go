@@ -0,0 +1,185 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testAdmin struct {
+	handler  http.Handler
+	breaker  *middleware.CircuitBreaker
+	limiter  *middleware.OverrideRateLimiter
+	flags    *middleware.FeatureFlags
+	level    *slog.LevelVar
+	checker  *middleware.HealthChecker
+	auditLog *bytes.Buffer
+}
+
+func newTestAdmin(t *testing.T) *testAdmin {
+	ta := &testAdmin{
+		breaker:  middleware.NewCircuitBreaker(nil),
+		limiter:  middleware.NewOverrideRateLimiter(middleware.NewMemoryRateLimiter(nil)),
+		flags:    middleware.NewFeatureFlags(map[string]bool{"offline_validation": false}),
+		level:    &slog.LevelVar{},
+		checker:  middleware.NewHealthChecker("codes-service"),
+		auditLog: &bytes.Buffer{},
+	}
+
+	admin, err := New(&Config{
+		Token:         "admin-token",
+		Breakers:      map[string]*middleware.CircuitBreaker{"users-service": ta.breaker},
+		RateLimiter:   ta.limiter,
+		Flags:         ta.flags,
+		LogLevel:      ta.level,
+		HealthChecker: ta.checker,
+		Logger:        slog.New(slog.NewJSONHandler(ta.auditLog, nil)),
+	})
+	require.NoError(t, err)
+	ta.handler = admin.Handler()
+	return ta
+}
+
+func (ta *testAdmin) do(method, path, body string) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != "" {
+		reader = bytes.NewReader([]byte(body))
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	w := httptest.NewRecorder()
+	ta.handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestNewRequiresToken(t *testing.T) {
+	_, err := New(&Config{})
+	assert.Error(t, err)
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	ta := newTestAdmin(t)
+
+	for _, header := range []string{"", "Bearer wrong-token", "admin-token"} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/flags", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		ta.handler.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, header)
+	}
+}
+
+func TestAdminBreakers(t *testing.T) {
+	ta := newTestAdmin(t)
+
+	w := ta.do(http.MethodPost, "/admin/breakers/users-service/open", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, middleware.StateOpen, ta.breaker.GetState())
+
+	w = ta.do(http.MethodPost, "/admin/breakers/users-service/close", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, middleware.StateClosed, ta.breaker.GetState())
+
+	assert.Equal(t, http.StatusBadRequest, ta.do(http.MethodPost, "/admin/breakers/users-service/explode", "").Code)
+	assert.Equal(t, http.StatusNotFound, ta.do(http.MethodPost, "/admin/breakers/billing/open", "").Code)
+
+	w = ta.do(http.MethodGet, "/admin/breakers", "")
+	assert.Contains(t, w.Body.String(), "users-service")
+	assert.Contains(t, ta.auditLog.String(), `"action":"breaker.open"`)
+}
+
+func TestAdminRateLimits(t *testing.T) {
+	ta := newTestAdmin(t)
+
+	w := ta.do(http.MethodPut, "/admin/ratelimits/user:partner-1", `{"limit": 5000, "window": "1m"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, middleware.RateLimitOverride{Limit: 5000, Window: time.Minute}, ta.limiter.Overrides()["user:partner-1"])
+
+	assert.Equal(t, http.StatusUnprocessableEntity, ta.do(http.MethodPut, "/admin/ratelimits/ip:1.2.3.4", `{"limit": 10, "window": "soon"}`).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, ta.do(http.MethodPut, "/admin/ratelimits/ip:1.2.3.4", `{"limit": 10}`).Code)
+
+	w = ta.do(http.MethodDelete, "/admin/ratelimits/user:partner-1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, ta.limiter.Overrides())
+}
+
+func TestAdminFlags(t *testing.T) {
+	ta := newTestAdmin(t)
+
+	w := ta.do(http.MethodPut, "/admin/flags/offline_validation", `{"enabled": true}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.True(t, ta.flags.Enabled("offline_validation"))
+
+	assert.Equal(t, http.StatusNotFound, ta.do(http.MethodPut, "/admin/flags/unknown", `{"enabled": true}`).Code)
+	assert.Equal(t, http.StatusBadRequest, ta.do(http.MethodPut, "/admin/flags/offline_validation", `not json`).Code)
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	ta := newTestAdmin(t)
+
+	w := ta.do(http.MethodPut, "/admin/log-level", `{"level": "debug"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, slog.LevelDebug, ta.level.Level())
+
+	var body struct {
+		Data logLevel `json:"data"`
+	}
+	json.Unmarshal(ta.do(http.MethodGet, "/admin/log-level", "").Body.Bytes(), &body)
+	assert.Equal(t, "debug", body.Data.Level)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, ta.do(http.MethodPut, "/admin/log-level", `{"level": "loud"}`).Code)
+}
+
+func TestAdminMaintenance(t *testing.T) {
+	ta := newTestAdmin(t)
+
+	w := ta.do(http.MethodPut, "/admin/maintenance", `{"enabled": true, "message": "database migration"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	health := ta.checker.CheckHealth(context.Background())
+	assert.Equal(t, "maintenance", health["status"])
+	assert.Equal(t, "database migration", health["maintenance_message"])
+}
+
+func TestAdminNotConfigured(t *testing.T) {
+	admin, err := New(&Config{Token: "admin-token"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/flags", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	w := httptest.NewRecorder()
+	admin.Handler().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAdminMount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	flags := middleware.NewFeatureFlags(map[string]bool{"offline_validation": true})
+	admin, err := New(&Config{Token: "admin-token", Prefix: "/internal/admin/", Flags: flags})
+	require.NoError(t, err)
+
+	router := gin.New()
+	admin.Mount(router)
+
+	req := httptest.NewRequest(http.MethodGet, "/internal/admin/flags", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"offline_validation":true`)
+}
@@ -0,0 +1,378 @@
+// Package clients builds outbound HTTP clients from per-target profiles.
+// Each target gets its own tuned connection pool, timeout, retry policy,
+// circuit breaker and auth, and every request carries the caller's
+// correlation headers and is recorded in the service call metrics.
+package clients
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// ErrUnknownTarget is returned when asking for a target that isn't configured
+var ErrUnknownTarget = errors.New("unknown client target")
+
+// TargetConfig is the profile of one downstream service
+type TargetConfig struct {
+	BaseURL string            `json:"base_url"`
+	Timeout time.Duration     `json:"timeout"` // Per attempt
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Retry and CircuitBreaker are disabled when nil
+	Retry          *middleware.RetryConfig          `json:"retry,omitempty"`
+	CircuitBreaker *middleware.CircuitBreakerConfig `json:"circuit_breaker,omitempty"`
+
+	MaxIdleConns        int           `json:"max_idle_conns"`
+	MaxIdleConnsPerHost int           `json:"max_idle_conns_per_host"`
+	MaxConnsPerHost     int           `json:"max_conns_per_host"` // 0 means no limit
+	IdleConnTimeout     time.Duration `json:"idle_conn_timeout"`
+
+	// ConnMaxLifetime closes pooled connections periodically so a target
+	// whose DNS records change (blue/green deploys, failover) is re-resolved.
+	// 0 keeps connections until they go idle.
+	ConnMaxLifetime time.Duration `json:"conn_max_lifetime"`
+
+	// TokenSource supplies the bearer token for each request; nil sends none
+	TokenSource TokenSource `json:"-"`
+
+	// TLSConfig is used for HTTPS targets, e.g. tlsx.Certificates.ClientConfig
+	// for mutual TLS; nil uses the system roots
+	TLSConfig *tls.Config `json:"-"`
+}
+
+// DefaultTargetConfig returns a profile with a 10 second timeout, the default
+// retry policy and circuit breaker, and connection re-resolution every 5 minutes
+func DefaultTargetConfig() *TargetConfig {
+	return &TargetConfig{
+		Timeout:             10 * time.Second,
+		Retry:               middleware.DefaultRetryConfig(),
+		CircuitBreaker:      middleware.DefaultCircuitBreakerConfig(),
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+		ConnMaxLifetime:     5 * time.Minute,
+	}
+}
+
+// Factory builds and caches one client per configured target
+type Factory struct {
+	targets  map[string]*TargetConfig
+	metrics  *middleware.MetricsRegistry
+	breakers *middleware.CircuitBreakerRegistry
+	clients  map[string]*Client
+	stop     chan struct{}
+	closed   bool
+	mutex    sync.Mutex
+}
+
+// NewFactory creates a client factory for the given targets. Metrics may be nil.
+func NewFactory(targets map[string]*TargetConfig, metrics *middleware.MetricsRegistry) (*Factory, error) {
+	for name, target := range targets {
+		if err := validateTarget(name, target); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Factory{
+		targets:  targets,
+		metrics:  metrics,
+		breakers: middleware.NewCircuitBreakerRegistry(nil, metrics),
+		clients:  make(map[string]*Client),
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+// validateTarget checks a target's base URL
+func validateTarget(name string, target *TargetConfig) error {
+	u, err := url.Parse(target.BaseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("client target %q: invalid base URL %q", name, target.BaseURL)
+	}
+	return nil
+}
+
+// Client returns the client for a target, creating it on first use
+func (f *Factory) Client(name string) (*Client, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if client, ok := f.clients[name]; ok {
+		return client, nil
+	}
+	if f.closed {
+		return nil, errors.New("client factory is closed")
+	}
+
+	target, ok := f.targets[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTarget, name)
+	}
+
+	client := newClient(name, target, f.metrics, f.breakers)
+	if target.ConnMaxLifetime > 0 {
+		go client.recycleConnections(target.ConnMaxLifetime, f.stop)
+	}
+	f.clients[name] = client
+	return client, nil
+}
+
+// MustClient returns the client for a target and panics if it isn't configured.
+// It is meant for wiring services at startup.
+func (f *Factory) MustClient(name string) *Client {
+	client, err := f.Client(name)
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
+
+// CircuitBreakers returns the registry holding the targets' circuit breakers
+func (f *Factory) CircuitBreakers() *middleware.CircuitBreakerRegistry {
+	return f.breakers
+}
+
+// Close stops connection recycling and closes idle connections of every client
+func (f *Factory) Close() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return
+	}
+	f.closed = true
+	close(f.stop)
+	for _, client := range f.clients {
+		client.transport.CloseIdleConnections()
+	}
+}
+
+// NewServiceClient creates a client for a single target without a Factory,
+// for services with one downstream. A nil target uses DefaultTargetConfig
+// with baseURL; otherwise baseURL replaces the target's when set. Metrics
+// may be nil. Close the client to stop its connection recycling.
+func NewServiceClient(name, baseURL string, target *TargetConfig, metrics *middleware.MetricsRegistry) (*Client, error) {
+	if target == nil {
+		target = DefaultTargetConfig()
+	}
+	if baseURL != "" {
+		copied := *target
+		copied.BaseURL = baseURL
+		target = &copied
+	}
+	if err := validateTarget(name, target); err != nil {
+		return nil, err
+	}
+
+	client := newClient(name, target, metrics, middleware.NewCircuitBreakerRegistry(nil, metrics))
+	client.stop = make(chan struct{})
+	if target.ConnMaxLifetime > 0 {
+		go client.recycleConnections(target.ConnMaxLifetime, client.stop)
+	}
+	return client, nil
+}
+
+// Client is an instrumented HTTP client for one target
+type Client struct {
+	name       string
+	baseURL    string
+	transport  *http.Transport
+	httpClient *http.Client
+	breaker    *middleware.CircuitBreaker
+	stop       chan struct{} // Set for clients created by NewServiceClient
+	closeOnce  sync.Once
+}
+
+// newClient builds the transport chain for a target, taking its circuit
+// breaker from breakers so state changes are recorded in metrics
+func newClient(name string, target *TargetConfig, metrics *middleware.MetricsRegistry, breakers *middleware.CircuitBreakerRegistry) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = target.MaxIdleConns
+	transport.MaxIdleConnsPerHost = target.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = target.MaxConnsPerHost
+	transport.IdleConnTimeout = target.IdleConnTimeout
+	if target.TLSConfig != nil {
+		transport.TLSClientConfig = target.TLSConfig
+	}
+
+	client := &Client{
+		name:      name,
+		baseURL:   strings.TrimRight(target.BaseURL, "/"),
+		transport: transport,
+	}
+	if target.CircuitBreaker != nil {
+		client.breaker = breakers.Configure(name, target.CircuitBreaker)
+	}
+
+	client.httpClient = &http.Client{
+		Transport: &roundTripper{
+			name:    name,
+			next:    transport,
+			target:  target,
+			breaker: client.breaker,
+			metrics: metrics,
+		},
+	}
+	return client
+}
+
+// recycleConnections closes idle connections every interval so new ones
+// resolve the target's address again
+func (c *Client) recycleConnections(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.transport.CloseIdleConnections()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Close stops connection recycling of a client from NewServiceClient and
+// closes its idle connections. Clients from a Factory are closed by
+// Factory.Close.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		if c.stop != nil {
+			close(c.stop)
+		}
+		c.transport.CloseIdleConnections()
+	})
+}
+
+// Name returns the target name
+func (c *Client) Name() string {
+	return c.name
+}
+
+// HTTPClient returns the instrumented *http.Client, for use with generated
+// clients and SDKs. Relative URLs are not resolved; use URL to build them.
+func (c *Client) HTTPClient() *http.Client {
+	return c.httpClient
+}
+
+// CircuitBreaker returns the target's circuit breaker, or nil when disabled
+func (c *Client) CircuitBreaker() *middleware.CircuitBreaker {
+	return c.breaker
+}
+
+// BaseURL returns the target's base URL without a trailing slash
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// URL joins a path onto the target's base URL
+func (c *Client) URL(path string) string {
+	return c.baseURL + "/" + strings.TrimLeft(path, "/")
+}
+
+// ResponseError is returned by the typed helpers for non-2xx responses. The
+// body is decoded into APIError when the target uses the shared error format.
+type ResponseError struct {
+	Target     string
+	StatusCode int
+	APIError   *types.APIError
+	Body       []byte
+}
+
+func (e *ResponseError) Error() string {
+	if e.APIError != nil {
+		return fmt.Sprintf("%s responded %d: %s", e.Target, e.StatusCode, e.APIError.Error())
+	}
+	return fmt.Sprintf("%s responded %d", e.Target, e.StatusCode)
+}
+
+// Unwrap returns the decoded APIError so errors.As finds it
+func (e *ResponseError) Unwrap() error {
+	if e.APIError == nil {
+		return nil
+	}
+	return e.APIError
+}
+
+// maxErrorBody is how much of an error response is kept
+const maxErrorBody = 64 << 10
+
+// Do sends a JSON request to a path on the target and decodes a JSON response
+// into out. in and out may be nil.
+func (c *Client) Do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.URL(path), body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		respErr := &ResponseError{Target: c.name, StatusCode: resp.StatusCode, Body: data}
+
+		var apiErr types.APIError
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Code != "" {
+			apiErr.Status = resp.StatusCode
+			respErr.APIError = &apiErr
+		}
+		return respErr
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", c.name, err)
+	}
+	return nil
+}
+
+// Get sends a GET request and decodes the JSON response into out
+func (c *Client) Get(ctx context.Context, path string, out interface{}) error {
+	return c.Do(ctx, http.MethodGet, path, nil, out)
+}
+
+// Post sends in as JSON and decodes the JSON response into out
+func (c *Client) Post(ctx context.Context, path string, in, out interface{}) error {
+	return c.Do(ctx, http.MethodPost, path, in, out)
+}
+
+// Put sends in as JSON and decodes the JSON response into out
+func (c *Client) Put(ctx context.Context, path string, in, out interface{}) error {
+	return c.Do(ctx, http.MethodPut, path, in, out)
+}
+
+// Delete sends a DELETE request
+func (c *Client) Delete(ctx context.Context, path string) error {
+	return c.Do(ctx, http.MethodDelete, path, nil, nil)
+}
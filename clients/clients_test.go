@@ -0,0 +1,242 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTarget(url string) *TargetConfig {
+	target := DefaultTargetConfig()
+	target.BaseURL = url
+	target.Retry = &middleware.RetryConfig{
+		MaxAttempts:     3,
+		InitialDelay:    time.Millisecond,
+		MaxDelay:        5 * time.Millisecond,
+		BackoffFactor:   2,
+		RetryableErrors: []int{502, 503},
+	}
+	target.CircuitBreaker = nil
+	return target
+}
+
+func TestNewFactoryValidatesTargets(t *testing.T) {
+	_, err := NewFactory(map[string]*TargetConfig{"users": {BaseURL: "users-service"}}, nil)
+	assert.Error(t, err)
+
+	factory, err := NewFactory(map[string]*TargetConfig{"users": newTestTarget("http://users.internal")}, nil)
+	require.NoError(t, err)
+	defer factory.Close()
+
+	_, err = factory.Client("codes")
+	assert.ErrorIs(t, err, ErrUnknownTarget)
+
+	client := factory.MustClient("users")
+	assert.Same(t, client, factory.MustClient("users"))
+	assert.Equal(t, "http://users.internal/v1/users", client.URL("/v1/users"))
+}
+
+func TestNewServiceClient(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "corr-123", r.Header.Get(middleware.CorrelationIDHeader))
+		if atomic.AddInt32(&calls, 1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	_, err := NewServiceClient("codes", "codes-service", nil, nil)
+	assert.Error(t, err)
+
+	target := newTestTarget("http://ignored.internal")
+	client, err := NewServiceClient("codes", server.URL, target, middleware.NewMetricsRegistry("clients-test"))
+	require.NoError(t, err)
+	defer client.Close()
+	assert.Equal(t, "http://ignored.internal", target.BaseURL, "the caller's target is left alone")
+	assert.Equal(t, server.URL, client.BaseURL())
+
+	ctx := middleware.WithCorrelationContext(context.Background(), "corr-123", "req-1", "", "")
+	require.NoError(t, client.Get(ctx, "/codes", nil))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	client.Close()
+	client.Close()
+}
+
+func TestClientUsesTargetTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	target := newTestTarget(server.URL)
+	factory, err := NewFactory(map[string]*TargetConfig{"users": target}, nil)
+	require.NoError(t, err)
+	defer factory.Close()
+	assert.Error(t, factory.MustClient("users").Delete(context.Background(), "/users/1"), "the test server isn't trusted by default")
+
+	target.TLSConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+	factory, err = NewFactory(map[string]*TargetConfig{"users": target}, nil)
+	require.NoError(t, err)
+	defer factory.Close()
+	assert.NoError(t, factory.MustClient("users").Delete(context.Background(), "/users/1"))
+}
+
+func TestClientTypedHelpers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/1":
+			assert.Equal(t, "Bearer service-token", r.Header.Get("Authorization"))
+			assert.Equal(t, "corr-123", r.Header.Get(middleware.CorrelationIDHeader))
+			assert.Equal(t, "codes-service", r.Header.Get("X-Caller"))
+			json.NewEncoder(w).Encode(types.User{ID: "1", Name: "Ada"})
+		case "/users":
+			var user types.User
+			json.NewDecoder(r.Body).Decode(&user)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(user)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(types.NewNotFoundError("User"))
+		}
+	}))
+	defer server.Close()
+
+	target := newTestTarget(server.URL)
+	target.Headers = map[string]string{"X-Caller": "codes-service"}
+	target.TokenSource = StaticToken("service-token")
+
+	factory, err := NewFactory(map[string]*TargetConfig{"users": target}, nil)
+	require.NoError(t, err)
+	defer factory.Close()
+	client := factory.MustClient("users")
+
+	ctx := middleware.WithCorrelationContext(context.Background(), "corr-123", "req-1", "", "")
+
+	var user types.User
+	require.NoError(t, client.Get(ctx, "/users/1", &user))
+	assert.Equal(t, "Ada", user.Name)
+
+	var created types.User
+	require.NoError(t, client.Post(context.Background(), "users", types.User{Name: "Grace"}, &created))
+	assert.Equal(t, "Grace", created.Name)
+
+	err = client.Get(context.Background(), "/users/2", &user)
+	var respErr *ResponseError
+	require.ErrorAs(t, err, &respErr)
+	assert.Equal(t, http.StatusNotFound, respErr.StatusCode)
+
+	var apiErr *types.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, types.ErrCodeNotFound, apiErr.Code)
+}
+
+func TestClientRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	factory, err := NewFactory(map[string]*TargetConfig{"codes": newTestTarget(server.URL)}, nil)
+	require.NoError(t, err)
+	defer factory.Close()
+	client := factory.MustClient("codes")
+
+	require.NoError(t, client.Get(context.Background(), "/codes", nil))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// POST without an idempotency key is sent once
+	atomic.StoreInt32(&calls, 0)
+	err = client.Post(context.Background(), "/codes", map[string]string{"purpose": "x"}, nil)
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestClientReturnsLastResponseAfterRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("upstream down"))
+	}))
+	defer server.Close()
+
+	factory, err := NewFactory(map[string]*TargetConfig{"codes": newTestTarget(server.URL)}, nil)
+	require.NoError(t, err)
+	defer factory.Close()
+
+	resp, err := factory.MustClient("codes").HTTPClient().Get(server.URL + "/codes")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	target := newTestTarget(server.URL)
+	target.Retry = nil
+	target.CircuitBreaker = &middleware.CircuitBreakerConfig{MaxFailures: 2, ResetTimeout: time.Hour}
+
+	factory, err := NewFactory(map[string]*TargetConfig{"codes": target}, middleware.NewMetricsRegistry("clients-test"))
+	require.NoError(t, err)
+	defer factory.Close()
+	client := factory.MustClient("codes")
+
+	for i := 0; i < 2; i++ {
+		assert.Error(t, client.Get(context.Background(), "/codes", nil))
+	}
+	err = client.Get(context.Background(), "/codes", nil)
+	assert.True(t, errors.Is(err, ErrCircuitOpen), "expected ErrCircuitOpen, got %v", err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, middleware.StateOpen, client.CircuitBreaker().GetState())
+	assert.Same(t, client.CircuitBreaker(), factory.CircuitBreakers().Get("codes"))
+	assert.Equal(t, 1, factory.CircuitBreakers().Stats().Open)
+}
+
+func TestClientTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	target := newTestTarget(server.URL)
+	target.Retry = nil
+	target.Timeout = 20 * time.Millisecond
+
+	factory, err := NewFactory(map[string]*TargetConfig{"slow": target}, nil)
+	require.NoError(t, err)
+	defer factory.Close()
+
+	err = factory.MustClient("slow").Get(context.Background(), "/", nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
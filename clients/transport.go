@@ -0,0 +1,229 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/jarakey/jarakey-shared-middleware/utils"
+)
+
+// ErrCircuitOpen is returned without contacting the target while its circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// TokenSource returns the bearer token to send with a request
+type TokenSource func(ctx context.Context) (string, error)
+
+// StaticToken returns a TokenSource that always sends token
+func StaticToken(token string) TokenSource {
+	return func(ctx context.Context) (string, error) {
+		return token, nil
+	}
+}
+
+// ServiceTokenSource returns a TokenSource that issues service tokens for
+// serviceName and reuses each one until a minute before it expires
+func ServiceTokenSource(manager *utils.JWTManager, serviceName string, scopes []string) TokenSource {
+	var (
+		token   string
+		expires time.Time
+		mutex   sync.Mutex
+	)
+
+	return func(ctx context.Context) (string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if token != "" && time.Now().Before(expires) {
+			return token, nil
+		}
+
+		issued, err := manager.GenerateServiceToken(serviceName, scopes, utils.DefaultServiceTokenTTL)
+		if err != nil {
+			return "", fmt.Errorf("failed to issue service token: %w", err)
+		}
+		token = issued
+		expires = time.Now().Add(utils.DefaultServiceTokenTTL - time.Minute)
+		return token, nil
+	}
+}
+
+// roundTripper adds headers, auth, retries, the circuit breaker, per-attempt
+// timeouts and metrics around the target's transport
+type roundTripper struct {
+	name    string
+	next    http.RoundTripper
+	target  *TargetConfig
+	breaker *middleware.CircuitBreaker
+	metrics *middleware.MetricsRegistry
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	// A RoundTripper must not modify the caller's request
+	req = req.Clone(ctx)
+	middleware.PropagateCorrelationHeaders(req, ctx)
+	for name, value := range t.target.Headers {
+		if req.Header.Get(name) == "" {
+			req.Header.Set(name, value)
+		}
+	}
+	if t.target.TokenSource != nil {
+		token, err := t.target.TokenSource(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	if t.target.Retry == nil || !canRetry(req) {
+		return t.attempt(req)
+	}
+	return t.retry(req)
+}
+
+// canRetry reports whether a request may be sent more than once: idempotent
+// methods and requests carrying an Idempotency-Key, with a replayable body
+func canRetry(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// retry sends the request under the target's retry policy. Connection errors
+// are retried like 503 responses. When every attempt gets a retryable status
+// the last response is returned, as a plain http.Client would.
+func (t *roundTripper) retry(req *http.Request) (*http.Response, error) {
+	var (
+		resp     *http.Response
+		lastErr  error
+		attempts int
+	)
+
+	err := t.target.Retry.Retry(req.Context(), func() error {
+		resp, lastErr = nil, nil
+
+		attemptReq := req
+		if attempts > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+		attempts++
+
+		r, err := t.attempt(attemptReq)
+		if err != nil {
+			lastErr = err
+			if errors.Is(err, ErrCircuitOpen) || req.Context().Err() != nil {
+				return err
+			}
+			return &middleware.RetryableError{StatusCode: http.StatusServiceUnavailable, Message: err.Error()}
+		}
+
+		resp = r
+		if !t.target.Retry.IsRetryableError(&middleware.RetryableError{StatusCode: r.StatusCode}) {
+			return nil
+		}
+
+		// Keep the body so the response can still be returned after the last attempt
+		data, _ := io.ReadAll(io.LimitReader(r.Body, maxErrorBody))
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(data))
+		return &middleware.RetryableError{StatusCode: r.StatusCode, Message: http.StatusText(r.StatusCode)}
+	})
+
+	switch {
+	case resp != nil:
+		return resp, nil
+	case lastErr != nil:
+		return nil, lastErr
+	default:
+		return nil, err
+	}
+}
+
+// attempt sends the request once through the circuit breaker with the
+// per-attempt timeout and records it in the service call metrics
+func (t *roundTripper) attempt(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+
+	if t.breaker != nil && !t.breaker.Ready() {
+		t.record(req, "circuit_open", start)
+		return nil, fmt.Errorf("%s: %w", t.name, ErrCircuitOpen)
+	}
+
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if t.target.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.target.Timeout)
+	}
+
+	var resp *http.Response
+	call := func() error {
+		r, err := t.next.RoundTrip(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		resp = r
+		if r.StatusCode >= 500 {
+			return fmt.Errorf("%s responded %d", t.name, r.StatusCode)
+		}
+		return nil
+	}
+
+	var err error
+	if t.breaker != nil {
+		err = t.breaker.Execute(ctx, call)
+	} else {
+		err = call()
+	}
+
+	if resp == nil {
+		cancel()
+		t.record(req, "error", start)
+		if err == nil {
+			err = errors.New("no response")
+		}
+		return nil, err
+	}
+
+	t.record(req, strconv.Itoa(resp.StatusCode), start)
+	// The timeout also covers reading the body, so cancel only once it is closed
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// record adds the attempt to the service call metrics
+func (t *roundTripper) record(req *http.Request, status string, start time.Time) {
+	if t.metrics != nil {
+		t.metrics.RecordServiceCall(t.name, req.Method, status, time.Since(start))
+	}
+}
+
+// cancelOnClose releases a request's timeout when its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
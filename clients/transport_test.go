@@ -0,0 +1,43 @@
+package clients
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jarakey/jarakey-shared-middleware/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanRetry(t *testing.T) {
+	get, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	assert.True(t, canRetry(get))
+
+	post, _ := http.NewRequest(http.MethodPost, "http://example.com", strings.NewReader("{}"))
+	assert.False(t, canRetry(post))
+
+	post.Header.Set("Idempotency-Key", "key-1")
+	assert.True(t, canRetry(post))
+
+	// Bodies that can't be replayed are never retried
+	post.GetBody = nil
+	assert.False(t, canRetry(post))
+}
+
+func TestServiceTokenSource(t *testing.T) {
+	manager := utils.NewJWTManager("test-secret-key-32-chars-long!!")
+	source := ServiceTokenSource(manager, "codes-service", []string{"users:read"})
+
+	first, err := source(context.Background())
+	require.NoError(t, err)
+	second, err := source(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, first, second, "expected the token to be reused")
+
+	claims, err := manager.ValidateToken(first)
+	require.NoError(t, err)
+	assert.Equal(t, "codes-service", claims.PrincipalID())
+	assert.True(t, claims.HasScope("users:read"))
+}
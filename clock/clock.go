@@ -0,0 +1,43 @@
+// Package clock abstracts the passage of time so time-dependent behavior, such
+// as circuit breaker reset timeouts, retry backoff and token expiry, can be
+// tested by moving a fake clock forward instead of sleeping.
+package clock
+
+import "time"
+
+// Clock tells the time and waits for it to pass
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	// After sends the current time on the returned channel once d has passed
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the system clock
+type realClock struct{}
+
+// Real returns the system clock
+func Real() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// OrReal returns c, or the system clock when c is nil, for structs whose zero
+// value has no clock
+func OrReal(c Clock) Clock {
+	if c == nil {
+		return Real()
+	}
+	return c
+}
@@ -0,0 +1,76 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReal(t *testing.T) {
+	before := time.Now()
+	now := Real().Now()
+	assert.False(t, now.Before(before))
+	assert.GreaterOrEqual(t, Real().Since(before), time.Duration(0))
+
+	select {
+	case <-Real().After(time.Millisecond):
+	case <-time.After(time.Second):
+		t.Fatal("After didn't fire")
+	}
+}
+
+func TestOrReal(t *testing.T) {
+	assert.Equal(t, Real(), OrReal(nil))
+
+	fake := NewFake(time.Unix(0, 0))
+	assert.Same(t, fake, OrReal(fake))
+}
+
+func TestFake(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	fake := NewFake(start)
+	assert.Equal(t, start, fake.Now())
+
+	fake.Advance(time.Minute)
+	assert.Equal(t, start.Add(time.Minute), fake.Now())
+	assert.Equal(t, time.Minute, fake.Since(start))
+
+	fake.Set(start)
+	assert.Equal(t, start, fake.Now())
+}
+
+func TestFakeAfter(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	fake := NewFake(start)
+
+	short := fake.After(time.Second)
+	long := fake.After(time.Minute)
+	assert.Equal(t, 2, fake.Waiters())
+
+	fake.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), <-short)
+	assert.Len(t, long, 0)
+	assert.Equal(t, 1, fake.Waiters())
+
+	fake.Set(start.Add(time.Hour))
+	assert.Equal(t, start.Add(time.Hour), <-long)
+	assert.Equal(t, 0, fake.Waiters())
+
+	// Non-positive durations fire at once
+	assert.Equal(t, start.Add(time.Hour), <-fake.After(0))
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	fake := NewFake(time.Unix(1700000000, 0))
+
+	fired := make(chan struct{})
+	go func() {
+		<-fake.After(time.Second)
+		close(fired)
+	}()
+
+	fake.BlockUntil(1)
+	fake.Advance(time.Second)
+	<-fired
+}
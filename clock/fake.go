@@ -0,0 +1,103 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// waiter is a pending After call on a fake clock
+type waiter struct {
+	until time.Time
+	ch    chan time.Time
+}
+
+// Fake is a clock that only moves when told to. Channels returned by After
+// fire when Advance or Set moves the clock past their deadline.
+type Fake struct {
+	now     time.Time
+	waiters []*waiter
+	mutex   sync.Mutex
+	cond    *sync.Cond
+}
+
+// NewFake creates a fake clock set to now
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond = sync.NewCond(&f.mutex)
+	return f
+}
+
+// Now returns the fake time
+func (f *Fake) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+// Since returns the fake time elapsed since t
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// After returns a channel that fires once the clock has moved d forward. A
+// zero or negative d fires at once.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+	f.waiters = append(f.waiters, &waiter{until: f.now.Add(d), ch: ch})
+	f.cond.Broadcast()
+	return ch
+}
+
+// Advance moves the clock forward by d
+func (f *Fake) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.set(f.now.Add(d))
+}
+
+// Set moves the clock to t
+func (f *Fake) Set(t time.Time) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.set(t)
+}
+
+// set moves the clock and fires the waiters that are due
+func (f *Fake) set(t time.Time) {
+	f.now = t
+
+	pending := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.until.After(t) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- t
+	}
+	f.waiters = pending
+	f.cond.Broadcast()
+}
+
+// Waiters returns the number of After channels that haven't fired
+func (f *Fake) Waiters() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil waits until n After channels are pending, so a test can advance
+// the clock once the code under test is waiting on it
+func (f *Fake) BlockUntil(n int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
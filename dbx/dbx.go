@@ -0,0 +1,167 @@
+// Package dbx builds pgx connection pools with the shared observability
+// wiring: query metrics, slow and failed query logging with correlation
+// IDs, a health check, and a transaction helper that retries serialization
+// failures. The query logger can also be installed on database/sql.
+package dbx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+)
+
+// Config holds the configuration for a Postgres pool
+type Config struct {
+	// DSN is a postgres:// URL or key=value connection string
+	DSN string `json:"-"`
+
+	MaxConns        int32         `json:"max_conns"`
+	MinConns        int32         `json:"min_conns"`
+	MaxConnLifetime time.Duration `json:"max_conn_lifetime"`
+	MaxConnIdleTime time.Duration `json:"max_conn_idle_time"`
+	ConnectTimeout  time.Duration `json:"connect_timeout"`
+
+	// SlowQueryThreshold logs queries that take longer; 0 disables slow logging
+	SlowQueryThreshold time.Duration `json:"slow_query_threshold"`
+
+	// LogQueryArgs logs the arguments of slow and failed queries, redacted
+	LogQueryArgs bool `json:"log_query_args"`
+
+	// Retry is the policy WithTx uses for serialization failures and deadlocks
+	Retry *middleware.RetryConfig `json:"retry,omitempty"`
+
+	// Name labels the database in metrics, logs and its health check
+	Name string `json:"name"`
+
+	Logger        *slog.Logger                `json:"-"` // nil uses slog.Default
+	Metrics       *middleware.MetricsRegistry `json:"-"` // nil disables metrics
+	HealthChecker *middleware.HealthChecker   `json:"-"` // Registers a check under Name when set
+}
+
+// DefaultConfig returns a pool configuration suitable for most services
+func DefaultConfig() *Config {
+	return &Config{
+		MaxConns:           10,
+		MaxConnLifetime:    time.Hour,
+		MaxConnIdleTime:    30 * time.Minute,
+		ConnectTimeout:     5 * time.Second,
+		SlowQueryThreshold: 200 * time.Millisecond,
+		Retry: &middleware.RetryConfig{
+			MaxAttempts:   3,
+			InitialDelay:  20 * time.Millisecond,
+			MaxDelay:      500 * time.Millisecond,
+			BackoffFactor: 2.0,
+			Jitter:        true,
+		},
+		Name: "postgres",
+	}
+}
+
+// DB is a pgx pool with the shared tracer installed. It embeds
+// *pgxpool.Pool, so it is used exactly like one.
+type DB struct {
+	*pgxpool.Pool
+	name  string
+	retry *middleware.RetryConfig
+}
+
+// New creates a Postgres pool from the configuration. Connections are opened
+// on first use unless MinConns is set.
+func New(ctx context.Context, config *Config) (*DB, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if config.DSN == "" {
+		return nil, errors.New("database DSN is required")
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(config.DSN)
+	if err != nil {
+		// The error may echo the DSN, password included
+		return nil, errors.New("invalid database DSN")
+	}
+	if config.MaxConns > 0 {
+		poolConfig.MaxConns = config.MaxConns
+	}
+	poolConfig.MinConns = config.MinConns
+	if config.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = config.MaxConnLifetime
+	}
+	if config.MaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = config.MaxConnIdleTime
+	}
+	if config.ConnectTimeout > 0 {
+		poolConfig.ConnConfig.ConnectTimeout = config.ConnectTimeout
+	}
+
+	name := config.Name
+	if name == "" {
+		name = "postgres"
+	}
+	poolConfig.ConnConfig.Tracer = NewQueryLogger(&QueryLogConfig{
+		Name:          name,
+		SlowThreshold: config.SlowQueryThreshold,
+		LogArgs:       config.LogQueryArgs,
+		Logger:        config.Logger,
+		Metrics:       config.Metrics,
+	})
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database pool: %w", err)
+	}
+
+	db := &DB{Pool: pool, name: name, retry: config.Retry}
+	if config.HealthChecker != nil {
+		config.HealthChecker.AddCheck(name, db.HealthCheck(config.Metrics))
+	}
+	return db, nil
+}
+
+// Name returns the database name used in metrics and logs
+func (db *DB) Name() string {
+	return db.name
+}
+
+// HealthCheck returns a check that pings the database and reports pool
+// statistics. Metrics may be nil.
+func (db *DB) HealthCheck(metrics *middleware.MetricsRegistry) middleware.HealthCheck {
+	return func(ctx context.Context) *middleware.DependencyHealth {
+		start := time.Now()
+		err := db.Ping(ctx)
+		latency := time.Since(start)
+
+		stats := db.Stat()
+		if metrics != nil {
+			metrics.RecordDatabaseConnection(db.name, int(stats.TotalConns()))
+		}
+
+		health := &middleware.DependencyHealth{
+			Status:    middleware.StatusHealthy,
+			Message:   "Database is reachable",
+			Timestamp: time.Now(),
+			Details: map[string]interface{}{
+				"latency_ms":     latency.Milliseconds(),
+				"total_conns":    stats.TotalConns(),
+				"idle_conns":     stats.IdleConns(),
+				"acquired_conns": stats.AcquiredConns(),
+				"max_conns":      stats.MaxConns(),
+			},
+		}
+
+		switch {
+		case err != nil:
+			health.Status = middleware.StatusUnhealthy
+			health.Message = fmt.Sprintf("Ping failed: %v", err)
+		case stats.MaxConns() > 0 && stats.AcquiredConns() >= stats.MaxConns():
+			health.Status = middleware.StatusDegraded
+			health.Message = "Connection pool is exhausted"
+		}
+		return health
+	}
+}
@@ -0,0 +1,168 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/jarakey/jarakey-shared-middleware/secrets"
+)
+
+// maxLoggedArg is how much of a string argument is logged
+const maxLoggedArg = 64
+
+// QueryLogConfig holds the configuration for a QueryLogger
+type QueryLogConfig struct {
+	// Name labels the database in metrics and logs
+	Name string `json:"name"`
+
+	// SlowThreshold logs and counts queries that take longer; 0 disables
+	// slow query logging
+	SlowThreshold time.Duration `json:"slow_threshold"`
+
+	// MaxSQLLength truncates logged statements; 0 uses 1000
+	MaxSQLLength int `json:"max_sql_length"`
+
+	// LogArgs logs query arguments with secrets redacted and long strings
+	// truncated. Otherwise only their count is logged.
+	LogArgs bool `json:"log_args"`
+
+	Logger  *slog.Logger                `json:"-"` // nil uses slog.Default
+	Metrics *middleware.MetricsRegistry `json:"-"` // nil disables metrics
+	Clock   clock.Clock                 `json:"-"` // nil uses the system clock
+}
+
+// DefaultQueryLogConfig returns a configuration logging queries slower than
+// 200ms without their arguments
+func DefaultQueryLogConfig() *QueryLogConfig {
+	return &QueryLogConfig{
+		Name:          "postgres",
+		SlowThreshold: 200 * time.Millisecond,
+		MaxSQLLength:  1000,
+	}
+}
+
+// QueryEvent is a finished query
+type QueryEvent struct {
+	SQL      string
+	Args     []any
+	Rows     int64 // Rows returned or affected
+	Duration time.Duration
+	Err      error
+}
+
+// QueryLogger records query metrics and logs slow and failed queries with
+// the caller's correlation ID. It is a pgx.QueryTracer, and WrapConnector
+// installs it on database/sql.
+type QueryLogger struct {
+	config *QueryLogConfig
+	logger *slog.Logger
+	clock  clock.Clock
+}
+
+// NewQueryLogger creates a query logger
+func NewQueryLogger(config *QueryLogConfig) *QueryLogger {
+	if config == nil {
+		config = DefaultQueryLogConfig()
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &QueryLogger{
+		config: config,
+		logger: logger,
+		clock:  clock.OrReal(config.Clock),
+	}
+}
+
+// Observe records a finished query
+func (l *QueryLogger) Observe(ctx context.Context, event QueryEvent) {
+	queryType := QueryType(event.SQL)
+	slow := l.config.SlowThreshold > 0 && event.Duration >= l.config.SlowThreshold
+
+	if metrics := l.config.Metrics; metrics != nil {
+		metrics.RecordDatabaseQuery(l.config.Name, queryType, event.Duration)
+		if event.Err != nil {
+			metrics.RecordDatabaseError(l.config.Name, ErrorType(event.Err))
+		}
+		if slow {
+			metrics.RecordSlowDatabaseQuery(l.config.Name, queryType)
+		}
+	}
+
+	switch {
+	case event.Err != nil && !errors.Is(event.Err, context.Canceled):
+		l.logger.WarnContext(ctx, "database query failed", l.attrs(ctx, event, "error", event.Err.Error())...)
+	case slow:
+		l.logger.WarnContext(ctx, "slow database query", l.attrs(ctx, event, "rows", event.Rows)...)
+	}
+}
+
+// attrs returns the log attributes of a query
+func (l *QueryLogger) attrs(ctx context.Context, event QueryEvent, extra ...interface{}) []interface{} {
+	sql := event.SQL
+	maxLength := l.config.MaxSQLLength
+	if maxLength <= 0 {
+		maxLength = 1000
+	}
+	sql = truncate(sql, maxLength)
+
+	attrs := []interface{}{
+		"database", l.config.Name,
+		"sql", sql,
+		"duration_ms", event.Duration.Milliseconds(),
+		"correlation_id", middleware.GetCorrelationID(ctx),
+		"request_id", middleware.GetRequestID(ctx),
+		"arg_count", len(event.Args),
+	}
+	if l.config.LogArgs {
+		attrs = append(attrs, "args", redactArgs(event.Args))
+	}
+	return append(attrs, extra...)
+}
+
+// redactArgs formats query arguments for logging. Numbers, booleans and
+// times are kept; strings have secrets redacted and are truncated, and
+// binary values are replaced by their length.
+func redactArgs(args []any) []any {
+	redacted := make([]any, len(args))
+	for i, arg := range args {
+		switch value := arg.(type) {
+		case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, time.Time:
+			redacted[i] = value
+		case secrets.Secret:
+			redacted[i] = secrets.Placeholder
+		case []byte:
+			redacted[i] = fmt.Sprintf("[%d bytes]", len(value))
+		case string:
+			redacted[i] = truncateArg(secrets.Redact(value))
+		default:
+			redacted[i] = truncateArg(secrets.Redact(fmt.Sprint(value)))
+		}
+	}
+	return redacted
+}
+
+// truncateArg shortens a logged string argument
+func truncateArg(s string) string {
+	return truncate(s, maxLoggedArg)
+}
+
+// truncate shortens s to at most maxLength bytes, without splitting a
+// UTF-8 sequence, and marks the cut with an ellipsis
+func truncate(s string, maxLength int) string {
+	if len(s) <= maxLength {
+		return s
+	}
+	cut := maxLength
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
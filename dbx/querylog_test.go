@@ -0,0 +1,123 @@
+package dbx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/jarakey/jarakey-shared-middleware/secrets"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowQueries returns the slow query counter of a database and query type
+func slowQueries(t *testing.T, service, database, queryType string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "database_slow_queries_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["service"] == service && labels["database"] == database && labels["query_type"] == queryType {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestQueryLoggerSlowQueries(t *testing.T) {
+	var logs bytes.Buffer
+	logger := NewQueryLogger(&QueryLogConfig{
+		Name:          "codes-db",
+		SlowThreshold: 100 * time.Millisecond,
+		MaxSQLLength:  20,
+		Logger:        slog.New(slog.NewJSONHandler(&logs, nil)),
+		Metrics:       middleware.NewMetricsRegistry("querylog-test"),
+	})
+	ctx := middleware.WithCorrelationContext(context.Background(), "corr-123", "req-1", "", "")
+
+	logger.Observe(ctx, QueryEvent{SQL: "SELECT 1", Duration: 10 * time.Millisecond})
+	assert.Empty(t, logs.String())
+	assert.Zero(t, slowQueries(t, "querylog-test", "codes-db", "select"))
+
+	logger.Observe(ctx, QueryEvent{
+		SQL:      "SELECT * FROM access_codes WHERE code = $1",
+		Args:     []any{"ABC-123"},
+		Rows:     3,
+		Duration: 250 * time.Millisecond,
+	})
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Equal(t, "slow database query", entry["msg"])
+	assert.Equal(t, "SELECT * FROM access...", entry["sql"])
+	assert.Equal(t, "corr-123", entry["correlation_id"])
+	assert.EqualValues(t, 250, entry["duration_ms"])
+	assert.EqualValues(t, 3, entry["rows"])
+	assert.EqualValues(t, 1, entry["arg_count"])
+	assert.NotContains(t, entry, "args")
+	assert.Equal(t, 1.0, slowQueries(t, "querylog-test", "codes-db", "select"))
+}
+
+func TestQueryLoggerRedactsArgs(t *testing.T) {
+	var logs bytes.Buffer
+	logger := NewQueryLogger(&QueryLogConfig{
+		SlowThreshold: time.Millisecond,
+		LogArgs:       true,
+		Logger:        slog.New(slog.NewJSONHandler(&logs, nil)),
+	})
+
+	logger.Observe(context.Background(), QueryEvent{
+		SQL: "UPDATE users SET token = $1, avatar = $2, bio = $3, password = $4 WHERE id = $5",
+		Args: []any{
+			"Bearer abcdef123456",
+			[]byte{1, 2, 3},
+			strings.Repeat("x", 100),
+			secrets.NewSecret("hunter22"),
+			42,
+		},
+		Duration: time.Second,
+	})
+	assert.NotContains(t, logs.String(), "abcdef123456")
+	assert.NotContains(t, logs.String(), "hunter22")
+
+	var entry struct {
+		Args []interface{} `json:"args"`
+	}
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	require.Len(t, entry.Args, 5)
+	assert.Equal(t, "Bearer "+secrets.Placeholder, entry.Args[0])
+	assert.Equal(t, "[3 bytes]", entry.Args[1])
+	assert.Equal(t, strings.Repeat("x", maxLoggedArg)+"...", entry.Args[2])
+	assert.Equal(t, secrets.Placeholder, entry.Args[3])
+	assert.EqualValues(t, 42, entry.Args[4])
+}
+
+func TestQueryLoggerSkipsCanceledQueries(t *testing.T) {
+	var logs bytes.Buffer
+	logger := NewQueryLogger(&QueryLogConfig{Logger: slog.New(slog.NewJSONHandler(&logs, nil))})
+
+	logger.Observe(context.Background(), QueryEvent{SQL: "SELECT 1", Err: context.Canceled})
+	assert.Empty(t, logs.String())
+}
+
+func TestTruncateKeepsRunes(t *testing.T) {
+	assert.Equal(t, "SELECT", truncate("SELECT", 6))
+	assert.Equal(t, "SELECT 'caf...", truncate("SELECT 'café'", 12))
+	assert.Equal(t, "SELECT 'café...", truncate("SELECT 'café'", 13))
+	assert.True(t, utf8.ValidString(truncate(strings.Repeat("日本", 10), 7)))
+	assert.Equal(t, "日本...", truncate(strings.Repeat("日本", 10), 7))
+}
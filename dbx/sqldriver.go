@@ -0,0 +1,274 @@
+package dbx
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"time"
+)
+
+// WrapConnector returns a connector whose connections report every query
+// to the logger. Use it with sql.OpenDB, e.g. for pgx's stdlib driver:
+//
+//	db := sql.OpenDB(dbx.WrapConnector(stdlib.GetConnector(*connConfig), logger))
+//
+// Queries are timed until their rows are closed, so slow reads by the
+// caller count towards the duration, as they do with the pgx tracer.
+func WrapConnector(connector driver.Connector, logger *QueryLogger) driver.Connector {
+	return &loggedConnector{Connector: connector, logger: logger}
+}
+
+// loggedConnector opens logged connections
+type loggedConnector struct {
+	driver.Connector
+	logger *QueryLogger
+}
+
+func (c *loggedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &loggedConn{Conn: conn, logger: c.logger}, nil
+}
+
+// loggedConn logs queries run directly on the connection and through its
+// prepared statements. Optional interfaces the driver doesn't implement
+// fall back the way database/sql itself does.
+type loggedConn struct {
+	driver.Conn
+	logger *QueryLogger
+}
+
+func (c *loggedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *loggedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &loggedStmt{Stmt: stmt, query: query, logger: c.logger}, nil
+}
+
+func (c *loggedConn) BeginTx(ctx context.Context, options driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, options)
+	}
+	if options.Isolation != 0 || options.ReadOnly {
+		return nil, errors.New("driver does not support transaction options")
+	}
+	return c.Conn.Begin()
+}
+
+func (c *loggedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		// database/sql prepares the statement instead, which is logged
+		return nil, driver.ErrSkip
+	}
+	start := c.logger.clock.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	if errors.Is(err, driver.ErrSkip) {
+		return nil, err
+	}
+	c.logger.observeExec(ctx, query, args, start, result, err)
+	return result, err
+}
+
+func (c *loggedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := c.logger.clock.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if errors.Is(err, driver.ErrSkip) {
+		return nil, err
+	}
+	return c.logger.observeQuery(ctx, query, args, start, rows, err)
+}
+
+func (c *loggedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *loggedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *loggedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *loggedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+// loggedStmt logs executions of a prepared statement
+type loggedStmt struct {
+	driver.Stmt
+	query  string
+	logger *QueryLogger
+}
+
+func (s *loggedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *loggedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *loggedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := s.logger.clock.Now()
+	var result driver.Result
+	var err error
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else {
+		result, err = s.Stmt.Exec(driverValues(args))
+	}
+	s.logger.observeExec(ctx, s.query, args, start, result, err)
+	return result, err
+}
+
+func (s *loggedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := s.logger.clock.Now()
+	var rows driver.Rows
+	var err error
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(driverValues(args))
+	}
+	return s.logger.observeQuery(ctx, s.query, args, start, rows, err)
+}
+
+func (s *loggedStmt) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+// loggedRows counts rows and reports the query when closed
+type loggedRows struct {
+	driver.Rows
+	ctx    context.Context
+	event  QueryEvent
+	start  time.Time
+	logger *QueryLogger
+	closed bool
+}
+
+func (r *loggedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	switch {
+	case err == nil:
+		r.event.Rows++
+	case !errors.Is(err, io.EOF):
+		r.event.Err = err
+	}
+	return err
+}
+
+func (r *loggedRows) Close() error {
+	err := r.Rows.Close()
+	if !r.closed {
+		r.closed = true
+		r.event.Duration = r.logger.clock.Since(r.start)
+		r.logger.Observe(r.ctx, r.event)
+	}
+	return err
+}
+
+func (r *loggedRows) HasNextResultSet() bool {
+	if sets, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return sets.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *loggedRows) NextResultSet() error {
+	if sets, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return sets.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (r *loggedRows) ColumnTypeDatabaseTypeName(index int) string {
+	if types, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return types.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+// observeExec reports a finished statement with the rows it affected
+func (l *QueryLogger) observeExec(ctx context.Context, query string, args []driver.NamedValue, start time.Time, result driver.Result, err error) {
+	event := QueryEvent{SQL: query, Args: argValues(args), Duration: l.clock.Since(start), Err: err}
+	if result != nil {
+		event.Rows, _ = result.RowsAffected()
+	}
+	l.Observe(ctx, event)
+}
+
+// observeQuery reports a failed query now, or a successful one once its
+// rows are closed
+func (l *QueryLogger) observeQuery(ctx context.Context, query string, args []driver.NamedValue, start time.Time, rows driver.Rows, err error) (driver.Rows, error) {
+	event := QueryEvent{SQL: query, Args: argValues(args)}
+	if err != nil {
+		event.Duration = l.clock.Since(start)
+		event.Err = err
+		l.Observe(ctx, event)
+		return nil, err
+	}
+	return &loggedRows{Rows: rows, ctx: ctx, event: event, start: start, logger: l}, nil
+}
+
+// argValues returns the values of named arguments
+func argValues(args []driver.NamedValue) []any {
+	values := make([]any, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+// namedValues converts positional arguments to named ones
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+// driverValues converts named arguments to positional ones
+func driverValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
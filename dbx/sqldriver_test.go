@@ -0,0 +1,151 @@
+package dbx
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConnector opens fakeConns that take delay per query on the fake clock
+type fakeConnector struct {
+	clock *clock.Fake
+	delay time.Duration
+	err   error
+}
+
+func (c *fakeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &fakeConn{connector: c}, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver {
+	return nil
+}
+
+// fakeConn supports direct queries and execs but no prepared statements
+type fakeConn struct {
+	connector *fakeConnector
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.connector.clock.Advance(c.connector.delay)
+	if c.connector.err != nil {
+		return nil, c.connector.err
+	}
+	return &fakeRows{remaining: 3}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.connector.clock.Advance(c.connector.delay)
+	if c.connector.err != nil {
+		return nil, c.connector.err
+	}
+	return driver.RowsAffected(7), nil
+}
+
+// fakeRows returns remaining single-column rows
+type fakeRows struct {
+	remaining int
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"id"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.remaining == 0 {
+		return io.EOF
+	}
+	dest[0] = int64(r.remaining)
+	r.remaining--
+	return nil
+}
+
+// openLoggedDB opens a database/sql handle on a fake driver, logging to logs
+func openLoggedDB(t *testing.T, connector *fakeConnector, logs *bytes.Buffer) *sql.DB {
+	t.Helper()
+	logger := NewQueryLogger(&QueryLogConfig{
+		Name:          "codes-db",
+		SlowThreshold: 100 * time.Millisecond,
+		Logger:        slog.New(slog.NewJSONHandler(logs, nil)),
+		Metrics:       middleware.NewMetricsRegistry("sqldriver-test"),
+		Clock:         connector.clock,
+	})
+	db := sql.OpenDB(WrapConnector(connector, logger))
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestWrapConnectorLogsSlowQueries(t *testing.T) {
+	var logs bytes.Buffer
+	connector := &fakeConnector{clock: clock.NewFake(time.Unix(1700000000, 0)), delay: 150 * time.Millisecond}
+	db := openLoggedDB(t, connector, &logs)
+	ctx := middleware.WithCorrelationContext(context.Background(), "corr-123", "req-1", "", "")
+
+	rows, err := db.QueryContext(ctx, "SELECT id FROM access_codes WHERE org_id = $1", 42)
+	require.NoError(t, err)
+	var count int
+	for rows.Next() {
+		count++
+	}
+	require.NoError(t, rows.Close())
+	assert.Equal(t, 3, count)
+	assert.Contains(t, logs.String(), "slow database query")
+	assert.Contains(t, logs.String(), `"correlation_id":"corr-123"`)
+	assert.Contains(t, logs.String(), `"rows":3`)
+	assert.Contains(t, logs.String(), `"duration_ms":150`)
+
+	logs.Reset()
+	_, err = db.ExecContext(ctx, "UPDATE access_codes SET used_at = now() WHERE org_id = $1", 42)
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), `"rows":7`)
+	assert.Equal(t, 2.0, slowQueries(t, "sqldriver-test", "codes-db", "select")+slowQueries(t, "sqldriver-test", "codes-db", "update"))
+}
+
+func TestWrapConnectorSkipsFastQueries(t *testing.T) {
+	var logs bytes.Buffer
+	connector := &fakeConnector{clock: clock.NewFake(time.Unix(1700000000, 0)), delay: time.Millisecond}
+	db := openLoggedDB(t, connector, &logs)
+
+	var id int64
+	require.NoError(t, db.QueryRowContext(context.Background(), "SELECT id FROM access_codes LIMIT 1").Scan(&id))
+	assert.Equal(t, int64(3), id)
+	assert.Empty(t, logs.String())
+}
+
+func TestWrapConnectorLogsFailedQueries(t *testing.T) {
+	var logs bytes.Buffer
+	connector := &fakeConnector{clock: clock.NewFake(time.Unix(1700000000, 0)), err: errors.New("relation does not exist")}
+	db := openLoggedDB(t, connector, &logs)
+
+	_, err := db.QueryContext(context.Background(), "SELECT id FROM missing")
+	require.Error(t, err)
+	assert.Contains(t, logs.String(), "database query failed")
+	assert.Contains(t, logs.String(), "relation does not exist")
+}
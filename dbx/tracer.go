@@ -0,0 +1,81 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// queryStartKey is the context key for the start of a traced query
+type queryStartKey struct{}
+
+// queryStart is what TraceQueryStart hands to TraceQueryEnd
+type queryStart struct {
+	sql   string
+	args  []any
+	start time.Time
+}
+
+// TraceQueryStart implements pgx.QueryTracer
+func (l *QueryLogger) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, &queryStart{sql: data.SQL, args: data.Args, start: l.clock.Now()})
+}
+
+// TraceQueryEnd implements pgx.QueryTracer
+func (l *QueryLogger) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	query, ok := ctx.Value(queryStartKey{}).(*queryStart)
+	if !ok {
+		return
+	}
+	l.Observe(ctx, QueryEvent{
+		SQL:      query.sql,
+		Args:     query.args,
+		Rows:     data.CommandTag.RowsAffected(),
+		Duration: l.clock.Since(query.start),
+		Err:      data.Err,
+	})
+}
+
+// QueryType returns the lower-cased leading keyword of a statement (select,
+// insert, ...), used to label query metrics without high cardinality
+func QueryType(sql string) string {
+	sql = strings.TrimSpace(sql)
+	for strings.HasPrefix(sql, "--") {
+		if i := strings.IndexByte(sql, '\n'); i >= 0 {
+			sql = strings.TrimSpace(sql[i+1:])
+		} else {
+			return "other"
+		}
+	}
+
+	keyword := sql
+	if i := strings.IndexAny(sql, " \t\n\r("); i >= 0 {
+		keyword = sql[:i]
+	}
+	switch keyword = strings.ToLower(keyword); keyword {
+	case "select", "insert", "update", "delete", "with", "begin", "commit", "rollback", "copy":
+		return keyword
+	default:
+		return "other"
+	}
+}
+
+// ErrorType labels a query error in metrics: the SQLSTATE code for server
+// errors, otherwise timeout, canceled or connection
+func ErrorType(err error) string {
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &pgErr):
+		return pgErr.Code
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "connection"
+	}
+}
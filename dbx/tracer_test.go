@@ -0,0 +1,72 @@
+package dbx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryType(t *testing.T) {
+	tests := map[string]string{
+		"SELECT * FROM codes":                            "select",
+		"  insert into codes (id) values ($1)":           "insert",
+		"-- fetch user\nUPDATE users SET name = $1":      "update",
+		"WITH recent AS (SELECT 1) SELECT * FROM recent": "with",
+		"select(1)":         "select",
+		"VACUUM codes":      "other",
+		"-- only a comment": "other",
+	}
+	for sql, expected := range tests {
+		assert.Equal(t, expected, QueryType(sql), sql)
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	assert.Equal(t, "23505", ErrorType(&pgconn.PgError{Code: "23505"}))
+	assert.Equal(t, "timeout", ErrorType(context.DeadlineExceeded))
+	assert.Equal(t, "canceled", ErrorType(context.Canceled))
+	assert.Equal(t, "connection", ErrorType(errors.New("connection reset")))
+}
+
+func TestTracerLogsSlowAndFailedQueries(t *testing.T) {
+	var logs bytes.Buffer
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	trace := NewQueryLogger(&QueryLogConfig{
+		Name:          "postgres",
+		SlowThreshold: 100 * time.Millisecond,
+		Logger:        slog.New(slog.NewJSONHandler(&logs, nil)),
+		Metrics:       middleware.NewMetricsRegistry("dbx-test"),
+		Clock:         fake,
+	})
+	ctx := middleware.WithCorrelationContext(context.Background(), "corr-123", "req-1", "", "")
+
+	// Fast queries aren't logged
+	queryCtx := trace.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	fake.Advance(10 * time.Millisecond)
+	trace.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{})
+	assert.Empty(t, logs.String())
+
+	queryCtx = trace.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT * FROM codes", Args: []any{"secret"}})
+	fake.Advance(150 * time.Millisecond)
+	trace.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 42")})
+	assert.Contains(t, logs.String(), "slow database query")
+	assert.Contains(t, logs.String(), `"correlation_id":"corr-123"`)
+	assert.Contains(t, logs.String(), `"duration_ms":150`)
+	assert.Contains(t, logs.String(), `"rows":42`)
+	assert.NotContains(t, logs.String(), "secret", "expected arguments not to be logged")
+
+	logs.Reset()
+	queryCtx = trace.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "INSERT INTO codes VALUES ($1)"})
+	trace.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{Err: &pgconn.PgError{Code: "23505", Message: "duplicate key"}})
+	assert.Contains(t, logs.String(), "database query failed")
+	assert.Contains(t, logs.String(), "duplicate key")
+}
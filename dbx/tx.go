@@ -0,0 +1,79 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+)
+
+// SQLSTATE codes for conflicts that succeed when the transaction is retried
+const (
+	SerializationFailure = "40001"
+	DeadlockDetected     = "40P01"
+)
+
+// IsRetryable reports whether err is a serialization failure or deadlock,
+// after which the whole transaction should be run again
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == SerializationFailure || pgErr.Code == DeadlockDetected
+}
+
+// TxBeginner starts transactions; *DB, *pgxpool.Pool and *pgx.Conn satisfy it
+type TxBeginner interface {
+	BeginTx(ctx context.Context, options pgx.TxOptions) (pgx.Tx, error)
+}
+
+// RunTx runs fn in a transaction and commits it, rolling back when fn fails.
+// Serialization failures and deadlocks run the whole transaction again under
+// the retry policy, so fn must not have side effects outside the database.
+// A nil policy runs it once.
+func RunTx(ctx context.Context, db TxBeginner, options pgx.TxOptions, retry *middleware.RetryConfig, fn func(tx pgx.Tx) error) error {
+	if retry == nil {
+		return runTx(ctx, db, options, fn)
+	}
+
+	// Only conflicts are retried, whatever statuses the policy lists
+	policy := *retry
+	policy.RetryableErrors = []int{http.StatusConflict}
+
+	var lastErr error
+	err := policy.Retry(ctx, func() error {
+		lastErr = runTx(ctx, db, options, fn)
+		if IsRetryable(lastErr) {
+			return &middleware.RetryableError{StatusCode: http.StatusConflict, Message: lastErr.Error()}
+		}
+		return nil
+	})
+	if lastErr == nil {
+		return err
+	}
+	return lastErr
+}
+
+// runTx runs fn in one transaction
+func runTx(ctx context.Context, db TxBeginner, options pgx.TxOptions, fn func(tx pgx.Tx) error) error {
+	tx, err := db.BeginTx(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// WithTx runs fn in a transaction, retrying serialization failures and
+// deadlocks under the pool's retry policy
+func (db *DB) WithTx(ctx context.Context, options pgx.TxOptions, fn func(tx pgx.Tx) error) error {
+	return RunTx(ctx, db.Pool, options, db.retry, fn)
+}
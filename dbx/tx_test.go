@@ -0,0 +1,104 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTx records how a transaction ended
+type fakeTx struct {
+	pgx.Tx
+	commitErr  error
+	committed  bool
+	rolledBack bool
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	tx.committed = true
+	return tx.commitErr
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error {
+	if !tx.committed {
+		tx.rolledBack = true
+	}
+	return nil
+}
+
+// fakeBeginner hands out fake transactions
+type fakeBeginner struct {
+	txs        []*fakeTx
+	commitErrs []error
+}
+
+func (b *fakeBeginner) BeginTx(ctx context.Context, options pgx.TxOptions) (pgx.Tx, error) {
+	tx := &fakeTx{}
+	if len(b.commitErrs) > 0 {
+		tx.commitErr, b.commitErrs = b.commitErrs[0], b.commitErrs[1:]
+	}
+	b.txs = append(b.txs, tx)
+	return tx, nil
+}
+
+var testRetry = &middleware.RetryConfig{
+	MaxAttempts:   3,
+	InitialDelay:  time.Millisecond,
+	MaxDelay:      5 * time.Millisecond,
+	BackoffFactor: 2,
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, IsRetryable(&pgconn.PgError{Code: SerializationFailure}))
+	assert.True(t, IsRetryable(&pgconn.PgError{Code: DeadlockDetected}))
+	assert.False(t, IsRetryable(&pgconn.PgError{Code: "23505"}))
+	assert.False(t, IsRetryable(errors.New("connection reset")))
+}
+
+func TestRunTxCommits(t *testing.T) {
+	db := &fakeBeginner{}
+	err := RunTx(context.Background(), db, pgx.TxOptions{}, testRetry, func(tx pgx.Tx) error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, db.txs, 1)
+	assert.True(t, db.txs[0].committed)
+}
+
+func TestRunTxRollsBackOnError(t *testing.T) {
+	db := &fakeBeginner{}
+	failure := errors.New("code already used")
+	err := RunTx(context.Background(), db, pgx.TxOptions{}, testRetry, func(tx pgx.Tx) error {
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+	assert.Len(t, db.txs, 1, "expected other errors not to be retried")
+	assert.True(t, db.txs[0].rolledBack)
+}
+
+func TestRunTxRetriesSerializationFailures(t *testing.T) {
+	conflict := &pgconn.PgError{Code: SerializationFailure}
+	db := &fakeBeginner{commitErrs: []error{conflict, conflict}}
+
+	runs := 0
+	err := RunTx(context.Background(), db, pgx.TxOptions{IsoLevel: pgx.Serializable}, testRetry, func(tx pgx.Tx) error {
+		runs++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, runs)
+
+	// The conflict is returned once the attempts run out
+	db = &fakeBeginner{commitErrs: []error{conflict, conflict, conflict}}
+	err = RunTx(context.Background(), db, pgx.TxOptions{}, testRetry, func(tx pgx.Tx) error {
+		return nil
+	})
+	assert.True(t, IsRetryable(err))
+	assert.Len(t, db.txs, 3)
+}
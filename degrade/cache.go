@@ -0,0 +1,96 @@
+package degrade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Entry is a last known good value
+type Entry struct {
+	Value    json.RawMessage `json:"value"`
+	StoredAt time.Time       `json:"stored_at"`
+}
+
+// Cache keeps last known good values
+type Cache interface {
+	// Get returns the entry for key, or nil when there is none
+	Get(ctx context.Context, key string) (*Entry, error)
+
+	// Set replaces the entry for key
+	Set(ctx context.Context, key string, entry *Entry) error
+}
+
+// RedisCache keeps last known good values in Redis, so every instance can
+// serve them, including ones started while the source is down
+type RedisCache struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisCache creates a cache storing entries under prefix, e.g.
+// "fallback:org-settings:", expiring ttl after they were last refreshed.
+// ttl should be at least the fallback's MaxStale; 0 keeps entries forever.
+func NewRedisCache(client *redis.Client, prefix string, ttl time.Duration) *RedisCache {
+	return &RedisCache{client: client, prefix: prefix, ttl: ttl}
+}
+
+// Get returns the entry for key, or nil when there is none
+func (c *RedisCache) Get(ctx context.Context, key string) (*Entry, error) {
+	data, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fallback value %s: %w", key, err)
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to decode fallback value %s: %w", key, err)
+	}
+	return &entry, nil
+}
+
+// Set replaces the entry for key
+func (c *RedisCache) Set(ctx context.Context, key string, entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode fallback value %s: %w", key, err)
+	}
+	if err := c.client.Set(ctx, c.prefix+key, data, c.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set fallback value %s: %w", key, err)
+	}
+	return nil
+}
+
+// MemoryCache keeps last known good values in process memory
+type MemoryCache struct {
+	entries map[string]*Entry
+	mutex   sync.RWMutex
+}
+
+// NewMemoryCache creates an in-memory cache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]*Entry)}
+}
+
+// Get returns the entry for key, or nil when there is none
+func (c *MemoryCache) Get(ctx context.Context, key string) (*Entry, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.entries[key], nil
+}
+
+// Set replaces the entry for key
+func (c *MemoryCache) Set(ctx context.Context, key string, entry *Entry) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[key] = entry
+	return nil
+}
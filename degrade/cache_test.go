@@ -0,0 +1,53 @@
+package degrade
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisCache(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	cache := NewRedisCache(client, "fallback:org-settings:", time.Hour)
+	ctx := context.Background()
+
+	entry, err := cache.Get(ctx, "org-1")
+	require.NoError(t, err)
+	assert.Nil(t, entry)
+
+	storedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, cache.Set(ctx, "org-1", &Entry{Value: json.RawMessage(`{"max_active_codes":50}`), StoredAt: storedAt}))
+	assert.True(t, server.Exists("fallback:org-settings:org-1"))
+
+	entry, err = cache.Get(ctx, "org-1")
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	assert.JSONEq(t, `{"max_active_codes":50}`, string(entry.Value))
+	assert.True(t, storedAt.Equal(entry.StoredAt))
+
+	server.FastForward(time.Hour)
+	entry, err = cache.Get(ctx, "org-1")
+	require.NoError(t, err)
+	assert.Nil(t, entry)
+}
+
+func TestMemoryCache(t *testing.T) {
+	cache := NewMemoryCache()
+	ctx := context.Background()
+
+	entry, err := cache.Get(ctx, "org-1")
+	require.NoError(t, err)
+	assert.Nil(t, entry)
+
+	require.NoError(t, cache.Set(ctx, "org-1", &Entry{Value: json.RawMessage(`1`)}))
+	entry, err = cache.Get(ctx, "org-1")
+	require.NoError(t, err)
+	assert.Equal(t, `1`, string(entry.Value))
+}
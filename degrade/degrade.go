@@ -0,0 +1,208 @@
+// Package degrade keeps services answering when a soft dependency fails.
+// Reads through a Fallback store every successful result as the last known
+// good value and serve it, marked stale, when the source errors or its
+// circuit breaker is open. Org settings are the typical case: settings a
+// few minutes old are better than failing every request while the
+// settings service is down.
+package degrade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// Metrics results recorded by RecordFallbackRead
+const (
+	resultFresh       = "fresh"
+	resultStale       = "stale"
+	resultUnavailable = "unavailable"
+)
+
+// Config holds the configuration for a Fallback
+type Config struct {
+	// Name labels the fallback in logs and metrics, e.g. "org-settings"
+	Name string `json:"name"`
+
+	// MaxStale is the oldest value served when the source fails; 0 serves
+	// values of any age
+	MaxStale time.Duration `json:"max_stale"`
+
+	// Breaker protects the source; while it is open the source isn't
+	// called and cached values are served. nil calls the source every time.
+	Breaker *middleware.CircuitBreaker `json:"-"`
+
+	// IsFailure reports whether a loader error counts as a failure of the
+	// source, tripping the breaker. nil counts everything except client
+	// errors, such as a 404 APIError, and cancelled contexts, so a run of
+	// bad requests can't open the circuit for everyone.
+	IsFailure func(err error) bool `json:"-"`
+
+	Logger  *slog.Logger                `json:"-"` // nil uses slog.Default
+	Metrics *middleware.MetricsRegistry `json:"-"` // nil disables metrics
+	Clock   clock.Clock                 `json:"-"` // nil uses the system clock
+}
+
+// DefaultConfig returns a configuration that serves values up to a day old
+func DefaultConfig() *Config {
+	return &Config{
+		Name:     "default",
+		MaxStale: 24 * time.Hour,
+	}
+}
+
+// Fallback serves last known good values from a cache when their source
+// fails
+type Fallback struct {
+	cache  Cache
+	config *Config
+	clock  clock.Clock
+	logger *slog.Logger
+}
+
+// New creates a fallback that keeps last known good values in cache
+func New(cache Cache, config *Config) *Fallback {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Fallback{
+		cache:  cache,
+		config: config,
+		clock:  clock.OrReal(config.Clock),
+		logger: logger,
+	}
+}
+
+// WithFallbackCache returns the value loader produces for key and stores
+// it as the last known good value. When loader fails, or fb's circuit
+// breaker is open, the cached value is returned instead and the request is
+// marked stale (see Middleware). Client errors, such as a 404 APIError, and
+// cancelled contexts are returned as they are, since a stale value isn't a
+// better answer to them. The loader's error is returned when there is no
+// usable cached value.
+func WithFallbackCache[T any](ctx context.Context, fb *Fallback, key string, loader func(ctx context.Context) (T, error)) (T, error) {
+	var value T
+	err := fb.load(ctx, func() error {
+		var err error
+		value, err = loader(ctx)
+		return err
+	})
+	if err == nil {
+		fb.store(ctx, key, value)
+		fb.record(resultFresh)
+		return value, nil
+	}
+	if !shouldFallBack(ctx, err) {
+		return value, err
+	}
+
+	entry, age, ok := fb.lookup(ctx, key)
+	if !ok {
+		fb.record(resultUnavailable)
+		return value, err
+	}
+	var cached T
+	if decodeErr := json.Unmarshal(entry.Value, &cached); decodeErr != nil {
+		fb.logger.WarnContext(ctx, "failed to decode fallback value", "fallback", fb.config.Name, "key", key, "error", decodeErr.Error())
+		fb.record(resultUnavailable)
+		return value, err
+	}
+
+	fb.logger.WarnContext(ctx, "serving stale value", "fallback", fb.config.Name, "key", key, "age", age.String(), "error", err.Error())
+	fb.record(resultStale)
+	markStale(ctx, age)
+	return cached, nil
+}
+
+// load calls the source through the circuit breaker, if any. Only errors
+// that are failures of the source are recorded by the breaker.
+func (fb *Fallback) load(ctx context.Context, call func() error) error {
+	if fb.config.Breaker == nil {
+		return call()
+	}
+	var callErr error
+	err := fb.config.Breaker.Execute(ctx, func() error {
+		callErr = call()
+		if callErr != nil && fb.isFailure(ctx, callErr) {
+			return callErr
+		}
+		return nil
+	})
+	if callErr != nil {
+		return callErr
+	}
+	return err
+}
+
+// isFailure reports whether err counts against the source
+func (fb *Fallback) isFailure(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if fb.config.IsFailure != nil {
+		return fb.config.IsFailure(err)
+	}
+	return !isClientError(err)
+}
+
+// store saves a value as the last known good one. Failures are only
+// logged: the caller already has a fresh value.
+func (fb *Fallback) store(ctx context.Context, key string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err == nil {
+		err = fb.cache.Set(ctx, key, &Entry{Value: data, StoredAt: fb.clock.Now().UTC()})
+	}
+	if err != nil {
+		fb.logger.WarnContext(ctx, "failed to store fallback value", "fallback", fb.config.Name, "key", key, "error", err.Error())
+	}
+}
+
+// lookup returns the cached value for key and its age, if there is one
+// young enough to serve
+func (fb *Fallback) lookup(ctx context.Context, key string) (*Entry, time.Duration, bool) {
+	entry, err := fb.cache.Get(ctx, key)
+	if err != nil {
+		fb.logger.WarnContext(ctx, "failed to read fallback value", "fallback", fb.config.Name, "key", key, "error", err.Error())
+		return nil, 0, false
+	}
+	if entry == nil {
+		return nil, 0, false
+	}
+	age := fb.clock.Since(entry.StoredAt)
+	if fb.config.MaxStale > 0 && age > fb.config.MaxStale {
+		return nil, 0, false
+	}
+	return entry, age, true
+}
+
+// record counts a read in the fallback cache metrics
+func (fb *Fallback) record(result string) {
+	if fb.config.Metrics != nil {
+		fb.config.Metrics.RecordFallbackRead(fb.config.Name, result)
+	}
+}
+
+// shouldFallBack reports whether a stale value may replace err
+func shouldFallBack(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && !isClientError(err)
+}
+
+// isClientError reports whether err is caused by the request rather than
+// the source, i.e. an APIError below 500 or a cancelled context
+func isClientError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return true
+	}
+	var apiErr *types.APIError
+	return errors.As(err, &apiErr) && apiErr.HTTPStatus() < 500
+}
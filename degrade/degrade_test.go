@@ -0,0 +1,142 @@
+package degrade
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errUnavailable = errors.New("settings service unavailable")
+
+// newTestFallback returns a fallback over a memory cache with a fake clock
+func newTestFallback(config *Config) (*Fallback, *clock.Fake) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	config.Clock = fake
+	return New(NewMemoryCache(), config), fake
+}
+
+// settingsLoader returns a loader that counts calls and fails with err
+func settingsLoader(calls *int, settings types.OrgSettings, err *error) func(context.Context) (types.OrgSettings, error) {
+	return func(ctx context.Context) (types.OrgSettings, error) {
+		*calls++
+		if *err != nil {
+			return types.OrgSettings{}, *err
+		}
+		return settings, nil
+	}
+}
+
+func TestWithFallbackCacheServesStaleValue(t *testing.T) {
+	fb, fake := newTestFallback(&Config{Name: "org-settings", MaxStale: time.Hour})
+	ctx := withStaleness(context.Background(), make(map[string][]string))
+
+	var calls int
+	var loadErr error
+	load := settingsLoader(&calls, types.OrgSettings{MaxActiveCodes: 50}, &loadErr)
+
+	settings, err := WithFallbackCache(ctx, fb, "org-1", load)
+	require.NoError(t, err)
+	assert.Equal(t, 50, settings.MaxActiveCodes)
+	_, stale := StaleAge(ctx)
+	assert.False(t, stale)
+
+	fake.Advance(10 * time.Minute)
+	loadErr = errUnavailable
+	settings, err = WithFallbackCache(ctx, fb, "org-1", load)
+	require.NoError(t, err)
+	assert.Equal(t, 50, settings.MaxActiveCodes)
+	age, stale := StaleAge(ctx)
+	assert.True(t, stale)
+	assert.Equal(t, 10*time.Minute, age)
+
+	// Other keys have nothing to fall back on
+	_, err = WithFallbackCache(ctx, fb, "org-2", load)
+	assert.ErrorIs(t, err, errUnavailable)
+
+	// Values older than MaxStale aren't served
+	fake.Advance(time.Hour)
+	_, err = WithFallbackCache(ctx, fb, "org-1", load)
+	assert.ErrorIs(t, err, errUnavailable)
+}
+
+func TestWithFallbackCacheReturnsClientErrors(t *testing.T) {
+	fb, _ := newTestFallback(DefaultConfig())
+	var calls int
+	var loadErr error
+	load := settingsLoader(&calls, types.OrgSettings{MaxActiveCodes: 50}, &loadErr)
+	_, err := WithFallbackCache(context.Background(), fb, "org-1", load)
+	require.NoError(t, err)
+
+	loadErr = types.NewNotFoundError("Organization")
+	_, err = WithFallbackCache(context.Background(), fb, "org-1", load)
+	var apiErr *types.APIError
+	assert.ErrorAs(t, err, &apiErr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	loadErr = context.Canceled
+	_, err = WithFallbackCache(ctx, fb, "org-1", load)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestWithFallbackCacheSkipsOpenCircuit(t *testing.T) {
+	breaker := middleware.NewCircuitBreaker(&middleware.CircuitBreakerConfig{MaxFailures: 1, ResetTimeout: time.Minute})
+	fb, _ := newTestFallback(&Config{Name: "org-settings", Breaker: breaker, Metrics: middleware.NewMetricsRegistry("degrade-test")})
+
+	var calls int
+	var loadErr error
+	load := settingsLoader(&calls, types.OrgSettings{MaxActiveCodes: 50}, &loadErr)
+	_, err := WithFallbackCache(context.Background(), fb, "org-1", load)
+	require.NoError(t, err)
+
+	loadErr = errUnavailable
+	_, err = WithFallbackCache(context.Background(), fb, "org-1", load)
+	require.NoError(t, err)
+	require.Equal(t, middleware.StateOpen, breaker.GetState())
+
+	// While the circuit is open the source isn't called
+	settings, err := WithFallbackCache(context.Background(), fb, "org-1", load)
+	require.NoError(t, err)
+	assert.Equal(t, 50, settings.MaxActiveCodes)
+	assert.Equal(t, 2, calls)
+}
+
+func TestWithFallbackCacheClientErrorsDontTripBreaker(t *testing.T) {
+	breaker := middleware.NewCircuitBreaker(&middleware.CircuitBreakerConfig{MaxFailures: 2, ResetTimeout: time.Minute})
+	fb, _ := newTestFallback(&Config{Name: "org-settings", Breaker: breaker})
+
+	var calls int
+	loadErr := error(types.NewNotFoundError("Organization"))
+	load := settingsLoader(&calls, types.OrgSettings{MaxActiveCodes: 50}, &loadErr)
+	for i := 0; i < 5; i++ {
+		_, err := WithFallbackCache(context.Background(), fb, "org-1", load)
+		var apiErr *types.APIError
+		require.ErrorAs(t, err, &apiErr)
+	}
+	assert.Equal(t, middleware.StateClosed, breaker.GetState())
+	assert.Equal(t, 0, breaker.GetFailures())
+	assert.Equal(t, 5, calls)
+
+	// A custom classifier decides what counts
+	fb.config.IsFailure = func(err error) bool { return true }
+	for i := 0; i < 2; i++ {
+		WithFallbackCache(context.Background(), fb, "org-1", load)
+	}
+	assert.Equal(t, middleware.StateOpen, breaker.GetState())
+
+	// Server errors still trip the breaker with the default classifier
+	breaker = middleware.NewCircuitBreaker(&middleware.CircuitBreakerConfig{MaxFailures: 2, ResetTimeout: time.Minute})
+	fb, _ = newTestFallback(&Config{Name: "org-settings", Breaker: breaker})
+	loadErr = errUnavailable
+	for i := 0; i < 2; i++ {
+		WithFallbackCache(context.Background(), fb, "org-1", load)
+	}
+	assert.Equal(t, middleware.StateOpen, breaker.GetState())
+}
@@ -0,0 +1,84 @@
+package degrade
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers set on responses built from stale values
+const (
+	// StaleHeader is "true" when any value in the response is stale
+	StaleHeader = "X-Stale-Data"
+
+	// StaleAgeHeader is the age in seconds of the oldest stale value
+	StaleAgeHeader = "X-Stale-Age"
+)
+
+// staleContextKey holds the request's staleness
+const staleContextKey = "degrade_staleness"
+
+// staleness tracks the stale values a request served
+type staleness struct {
+	header http.Header
+	age    time.Duration
+	stale  bool
+	mutex  sync.Mutex
+}
+
+// withStaleness returns a context recording stale values into header
+func withStaleness(ctx context.Context, header http.Header) context.Context {
+	return context.WithValue(ctx, staleContextKey, &staleness{header: header})
+}
+
+// markStale records a stale value of the given age and sets the response
+// headers. Handlers load data before writing, so the headers go out with
+// the response.
+func markStale(ctx context.Context, age time.Duration) {
+	s, ok := ctx.Value(staleContextKey).(*staleness)
+	if !ok {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.stale = true
+	if age > s.age {
+		s.age = age
+	}
+	s.header.Set(StaleHeader, "true")
+	s.header.Set(StaleAgeHeader, strconv.Itoa(int(s.age.Seconds())))
+}
+
+// StaleAge returns the age of the oldest stale value served so far in the
+// request, and false when every value was fresh
+func StaleAge(ctx context.Context) (time.Duration, bool) {
+	s, ok := ctx.Value(staleContextKey).(*staleness)
+	if !ok {
+		return 0, false
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.age, s.stale
+}
+
+// Middleware marks responses built from stale values with StaleHeader and
+// StaleAgeHeader, so clients can show a "data may be out of date" notice
+func Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(withStaleness(r.Context(), w.Header())))
+		})
+	}
+}
+
+// GinMiddleware creates stale response middleware for Gin framework
+func GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(withStaleness(c.Request.Context(), c.Writer.Header()))
+		c.Next()
+	}
+}
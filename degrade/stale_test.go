@@ -0,0 +1,52 @@
+package degrade
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareMarksStaleResponses(t *testing.T) {
+	handler := Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("stale") != "" {
+			markStale(r.Context(), 90*time.Second)
+			markStale(r.Context(), 30*time.Second)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/settings", nil))
+	assert.Empty(t, w.Header().Get(StaleHeader))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/settings?stale=1", nil))
+	assert.Equal(t, "true", w.Header().Get(StaleHeader))
+	assert.Equal(t, "90", w.Header().Get(StaleAgeHeader), "the oldest value's age is reported")
+}
+
+func TestGinMiddlewareMarksStaleResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(GinMiddleware())
+	router.GET("/settings", func(c *gin.Context) {
+		markStale(c.Request.Context(), 2*time.Minute)
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/settings", nil))
+	assert.Equal(t, "true", w.Header().Get(StaleHeader))
+	assert.Equal(t, "120", w.Header().Get(StaleAgeHeader))
+}
+
+func TestStaleAgeWithoutMiddleware(t *testing.T) {
+	markStale(context.Background(), time.Minute)
+	_, stale := StaleAge(context.Background())
+	assert.False(t, stale)
+}
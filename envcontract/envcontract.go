@@ -0,0 +1,278 @@
+// Package envcontract lets a service declare the environment variables it
+// needs, with their types and which are secret, and check them all at
+// startup. Every missing or malformed variable is reported in one error
+// instead of the service failing on the first, and the contract with secret
+// values masked can be published on the info endpoint.
+package envcontract
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/secrets"
+)
+
+// Variable types
+const (
+	TypeString   = "string"
+	TypeInt      = "int"
+	TypeFloat    = "float"
+	TypeBool     = "bool"
+	TypeDuration = "duration"
+	TypeURL      = "url"
+)
+
+// Var declares an environment variable
+type Var struct {
+	Name string `json:"name"`
+
+	// Type is one of the Type constants; empty means TypeString
+	Type string `json:"type"`
+
+	// Required variables must be set and not empty
+	Required bool `json:"required"`
+
+	// Default is used for optional variables that aren't set
+	Default string `json:"default,omitempty"`
+
+	// Secret values are never reported and are registered for redaction
+	// from logs, see secrets.Register
+	Secret bool `json:"secret"`
+
+	Description string `json:"description,omitempty"`
+}
+
+// Contract is the set of environment variables a service needs
+type Contract struct {
+	service string
+	vars    []Var
+}
+
+// New creates a contract for a service
+func New(service string, vars ...Var) *Contract {
+	return &Contract{service: service, vars: vars}
+}
+
+// Problem is a variable that failed validation
+type Problem struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// Error lists every variable that failed validation. Values are never
+// included, so it is safe to log.
+type Error struct {
+	Service string
+	Missing []string
+	Invalid []Problem
+}
+
+// Error describes every problem found
+func (e *Error) Error() string {
+	var problems []string
+	if len(e.Missing) > 0 {
+		problems = append(problems, "missing "+strings.Join(e.Missing, ", "))
+	}
+	for _, problem := range e.Invalid {
+		problems = append(problems, fmt.Sprintf("invalid %s: %s", problem.Name, problem.Reason))
+	}
+	return fmt.Sprintf("%s environment: %s", e.Service, strings.Join(problems, "; "))
+}
+
+// Load validates the contract against the process environment
+func (c *Contract) Load() (*Values, error) {
+	return c.LoadFrom(os.LookupEnv)
+}
+
+// LoadFrom validates the contract against lookup, e.g. a map in tests. It
+// returns an *Error listing every missing and malformed variable.
+func (c *Contract) LoadFrom(lookup func(name string) (string, bool)) (*Values, error) {
+	values := &Values{contract: c, values: make(map[string]value, len(c.vars))}
+	problems := &Error{Service: c.service}
+
+	for _, v := range c.vars {
+		raw, found := lookup(v.Name)
+		source := SourceEnv
+		if !found || raw == "" {
+			if v.Required {
+				problems.Missing = append(problems.Missing, v.Name)
+				continue
+			}
+			raw, source = v.Default, SourceDefault
+			if raw == "" {
+				values.values[v.Name] = value{source: SourceUnset}
+				continue
+			}
+		}
+
+		parsed, err := parse(v.Type, raw)
+		if err != nil {
+			problems.Invalid = append(problems.Invalid, Problem{Name: v.Name, Reason: err.Error()})
+			continue
+		}
+		if v.Secret {
+			secrets.Register(raw)
+		}
+		values.values[v.Name] = value{raw: raw, parsed: parsed, source: source}
+	}
+
+	if len(problems.Missing) > 0 || len(problems.Invalid) > 0 {
+		return nil, problems
+	}
+	return values, nil
+}
+
+// parse converts a raw value to its type. Errors don't echo the value,
+// which may be a secret.
+func parse(kind, raw string) (interface{}, error) {
+	switch kind {
+	case "", TypeString:
+		return raw, nil
+	case TypeInt:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, errors.New("not an integer")
+		}
+		return n, nil
+	case TypeFloat:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, errors.New("not a number")
+		}
+		return f, nil
+	case TypeBool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errors.New("not a boolean")
+		}
+		return b, nil
+	case TypeDuration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, errors.New("not a duration such as 30s")
+		}
+		return d, nil
+	case TypeURL:
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, errors.New("not an absolute URL")
+		}
+		return u, nil
+	default:
+		return nil, fmt.Errorf("unknown type %q", kind)
+	}
+}
+
+// Where a value came from
+const (
+	SourceEnv     = "env"
+	SourceDefault = "default"
+	SourceUnset   = "unset"
+)
+
+// value is a validated variable
+type value struct {
+	raw    string
+	parsed interface{}
+	source string
+}
+
+// Values are the validated variables of a contract. Getters panic for
+// names the contract doesn't declare or declares with another type, as
+// that is a programming error; optional variables that aren't set return
+// the zero value.
+type Values struct {
+	contract *Contract
+	values   map[string]value
+}
+
+// get returns a variable's parsed value after checking its declaration
+func (v *Values) get(name, kind string) interface{} {
+	for _, declared := range v.contract.vars {
+		if declared.Name != name {
+			continue
+		}
+		if declared.Type != kind && !(kind == TypeString && declared.Type == "") {
+			panic(fmt.Sprintf("envcontract: %s is declared as %s, not %s", name, declared.Type, kind))
+		}
+		return v.values[name].parsed
+	}
+	panic(fmt.Sprintf("envcontract: %s is not declared", name))
+}
+
+// String returns a string variable
+func (v *Values) String(name string) string {
+	s, _ := v.get(name, TypeString).(string)
+	return s
+}
+
+// Int returns an int variable
+func (v *Values) Int(name string) int {
+	n, _ := v.get(name, TypeInt).(int)
+	return n
+}
+
+// Float returns a float variable
+func (v *Values) Float(name string) float64 {
+	f, _ := v.get(name, TypeFloat).(float64)
+	return f
+}
+
+// Bool returns a bool variable
+func (v *Values) Bool(name string) bool {
+	b, _ := v.get(name, TypeBool).(bool)
+	return b
+}
+
+// Duration returns a duration variable
+func (v *Values) Duration(name string) time.Duration {
+	d, _ := v.get(name, TypeDuration).(time.Duration)
+	return d
+}
+
+// URL returns a URL variable, nil when unset
+func (v *Values) URL(name string) *url.URL {
+	u, _ := v.get(name, TypeURL).(*url.URL)
+	return u
+}
+
+// Secret returns a string variable wrapped so it can't leak through logs
+// or JSON
+func (v *Values) Secret(name string) secrets.Secret {
+	return secrets.NewSecret(v.String(name))
+}
+
+// VarReport describes a variable and its value with secrets masked
+type VarReport struct {
+	Var
+	Value  string `json:"value,omitempty"`
+	Source string `json:"source"`
+}
+
+// Report returns the contract with the value of each variable, sorted by
+// name. Secret values and defaults are replaced by the placeholder, and
+// other values have credentials redacted.
+func (v *Values) Report() []VarReport {
+	reports := make([]VarReport, 0, len(v.contract.vars))
+	for _, declared := range v.contract.vars {
+		value := v.values[declared.Name]
+		report := VarReport{Var: declared, Value: secrets.Redact(value.raw), Source: value.source}
+		if declared.Secret {
+			if report.Default != "" {
+				report.Default = secrets.Placeholder
+			}
+			if value.raw != "" {
+				report.Value = secrets.Placeholder
+			}
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Name < reports[j].Name })
+	return reports
+}
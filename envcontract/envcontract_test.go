@@ -0,0 +1,108 @@
+package envcontract
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lookupMap returns a lookup over a map
+func lookupMap(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, found := env[name]
+		return value, found
+	}
+}
+
+// newTestContract declares one variable of every type
+func newTestContract() *Contract {
+	return New("validation-service",
+		Var{Name: "DATABASE_URL", Type: TypeURL, Required: true, Secret: true},
+		Var{Name: "PORT", Type: TypeInt, Default: "8080"},
+		Var{Name: "SAMPLE_RATE", Type: TypeFloat, Default: "0.5"},
+		Var{Name: "OFFLINE_VALIDATION", Type: TypeBool},
+		Var{Name: "REQUEST_TIMEOUT", Type: TypeDuration, Required: true},
+		Var{Name: "REGION", Description: "Deployment region"},
+		Var{Name: "JWT_SECRET", Required: true, Secret: true},
+	)
+}
+
+func TestLoadFrom(t *testing.T) {
+	values, err := newTestContract().LoadFrom(lookupMap(map[string]string{
+		"DATABASE_URL":       "postgres://codes:pw-4f9a2c@db:5432/codes",
+		"OFFLINE_VALIDATION": "true",
+		"REQUEST_TIMEOUT":    "15s",
+		"REGION":             "eu-west-1",
+		"JWT_SECRET":         "jwt-secret-7d1e",
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, "db:5432", values.URL("DATABASE_URL").Host)
+	assert.Equal(t, 8080, values.Int("PORT"))
+	assert.Equal(t, 0.5, values.Float("SAMPLE_RATE"))
+	assert.True(t, values.Bool("OFFLINE_VALIDATION"))
+	assert.Equal(t, 15*time.Second, values.Duration("REQUEST_TIMEOUT"))
+	assert.Equal(t, "eu-west-1", values.String("REGION"))
+	assert.Equal(t, "jwt-secret-7d1e", values.Secret("JWT_SECRET").Value())
+
+	// Secrets are redacted from logs once loaded
+	assert.Equal(t, "token "+secrets.Placeholder, secrets.Redact("token jwt-secret-7d1e"))
+
+	assert.Panics(t, func() { values.String("UNDECLARED") })
+	assert.Panics(t, func() { values.Int("REGION") })
+}
+
+func TestLoadFromAggregatesProblems(t *testing.T) {
+	_, err := newTestContract().LoadFrom(lookupMap(map[string]string{
+		"DATABASE_URL":    "not a url",
+		"PORT":            "eighty",
+		"REQUEST_TIMEOUT": "",
+	}))
+
+	var envErr *Error
+	require.True(t, errors.As(err, &envErr))
+	assert.Equal(t, []string{"REQUEST_TIMEOUT", "JWT_SECRET"}, envErr.Missing)
+	assert.Equal(t, []Problem{
+		{Name: "DATABASE_URL", Reason: "not an absolute URL"},
+		{Name: "PORT", Reason: "not an integer"},
+	}, envErr.Invalid)
+	assert.Equal(t, "validation-service environment: missing REQUEST_TIMEOUT, JWT_SECRET; "+
+		"invalid DATABASE_URL: not an absolute URL; invalid PORT: not an integer", err.Error())
+	assert.NotContains(t, err.Error(), "not a url", "expected values not to be echoed")
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("ENVCONTRACT_TEST_PORT", "9090")
+	values, err := New("test", Var{Name: "ENVCONTRACT_TEST_PORT", Type: TypeInt, Required: true}).Load()
+	require.NoError(t, err)
+	assert.Equal(t, 9090, values.Int("ENVCONTRACT_TEST_PORT"))
+}
+
+func TestReport(t *testing.T) {
+	values, err := newTestContract().LoadFrom(lookupMap(map[string]string{
+		"DATABASE_URL":    "postgres://codes:pw-4f9a2c@db:5432/codes",
+		"REQUEST_TIMEOUT": "15s",
+		"JWT_SECRET":      "jwt-secret-7d1e",
+	}))
+	require.NoError(t, err)
+
+	reports := map[string]VarReport{}
+	for _, report := range values.Report() {
+		reports[report.Name] = report
+	}
+	require.Len(t, reports, 7)
+	assert.Equal(t, "DATABASE_URL", values.Report()[0].Name, "expected reports sorted by name")
+
+	assert.Equal(t, secrets.Placeholder, reports["DATABASE_URL"].Value)
+	assert.Equal(t, secrets.Placeholder, reports["JWT_SECRET"].Value)
+	assert.Equal(t, SourceEnv, reports["JWT_SECRET"].Source)
+	assert.Equal(t, "8080", reports["PORT"].Value)
+	assert.Equal(t, SourceDefault, reports["PORT"].Source)
+	assert.Equal(t, "", reports["REGION"].Value)
+	assert.Equal(t, SourceUnset, reports["REGION"].Source)
+	assert.Equal(t, "Deployment region", reports["REGION"].Description)
+}
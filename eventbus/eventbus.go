@@ -0,0 +1,141 @@
+// Package eventbus publishes domain events and delivers them to subscribers
+// by event type, with an in-memory bus for tests and a Kafka bus for
+// production.
+//
+// Delivery is at least once. An event is acknowledged only after its handler
+// returns nil, so a crash or a failed handler means the event is delivered
+// again, possibly after later events with other keys. Handlers must therefore
+// be idempotent, e.g. by recording the event ID in the same transaction as
+// their side effects. Events with the same Key are delivered in order.
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Metadata keys set on every published event
+const (
+	MetadataCorrelationID = "correlation_id"
+	MetadataRequestID     = "request_id"
+)
+
+// ErrAlreadySubscribed is returned when an event type already has a handler
+// on a bus. Combine the handlers, or use a separate bus (consumer group) for
+// independent consumers.
+var ErrAlreadySubscribed = errors.New("event type already has a handler")
+
+// ErrClosed is returned when publishing to or subscribing on a closed bus
+var ErrClosed = errors.New("event bus is closed")
+
+// Event is a domain event
+type Event struct {
+	ID   string    `json:"id"`
+	Type string    `json:"type"` // e.g. "code.redeemed"
+	Time time.Time `json:"time"`
+
+	// Key orders events: events with the same key, e.g. an org ID, are
+	// delivered in the order they were published
+	Key string `json:"key,omitempty"`
+
+	Data     json.RawMessage   `json:"data"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// NewEvent creates an event of the given type with data encoded as JSON
+func NewEvent(eventType, key string, data interface{}) (*Event, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+	return &Event{
+		ID:       uuid.New().String(),
+		Type:     eventType,
+		Time:     time.Now().UTC(),
+		Key:      key,
+		Data:     encoded,
+		Metadata: make(map[string]string),
+	}, nil
+}
+
+// Decode decodes the event data into v. Decoding errors are permanent.
+func (e *Event) Decode(v interface{}) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return Permanent(fmt.Errorf("failed to decode %s event %s: %w", e.Type, e.ID, err))
+	}
+	return nil
+}
+
+// Handler handles one event. Returning an error has the event delivered again.
+type Handler func(ctx context.Context, event *Event) error
+
+// Bus publishes events and delivers them to one handler per event type
+type Bus interface {
+	// Publish sends events; it returns once the bus has accepted them
+	Publish(ctx context.Context, events ...*Event) error
+
+	// Subscribe delivers events of a type to handler
+	Subscribe(eventType string, handler Handler) error
+
+	// Shutdown stops delivery and releases the bus's connections
+	Shutdown(ctx context.Context) error
+}
+
+// permanentError marks a failure that redelivery can't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks a handler error that redelivery can't fix, such as an
+// undecodable payload. The Kafka bus dead-letters such events at once
+// instead of retrying them.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// stamp sets an event's defaults and the publisher's correlation IDs and
+// trace context in its metadata
+func stamp(ctx context.Context, event *Event) {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.Metadata == nil {
+		event.Metadata = make(map[string]string)
+	}
+
+	if correlationID := middleware.GetCorrelationID(ctx); correlationID != "" {
+		event.Metadata[MetadataCorrelationID] = correlationID
+	}
+	if requestID := middleware.GetRequestID(ctx); requestID != "" {
+		event.Metadata[MetadataRequestID] = requestID
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(event.Metadata))
+}
@@ -0,0 +1,107 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type codeRedeemed struct {
+	Code  string `json:"code"`
+	OrgID string `json:"org_id"`
+}
+
+func TestNewEventAndDecode(t *testing.T) {
+	event, err := NewEvent("code.redeemed", "org-1", codeRedeemed{Code: "ABC123", OrgID: "org-1"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, event.ID)
+	assert.False(t, event.Time.IsZero())
+	assert.Equal(t, "org-1", event.Key)
+
+	var data codeRedeemed
+	require.NoError(t, event.Decode(&data))
+	assert.Equal(t, "ABC123", data.Code)
+
+	event.Data = []byte("not json")
+	err = event.Decode(&data)
+	assert.Error(t, err)
+	assert.True(t, IsPermanent(err), "decode errors can't be fixed by redelivery")
+}
+
+func TestPermanent(t *testing.T) {
+	cause := errors.New("unknown org")
+	err := Permanent(cause)
+
+	assert.True(t, IsPermanent(err))
+	assert.ErrorIs(t, err, cause)
+	assert.False(t, IsPermanent(cause))
+	assert.Nil(t, Permanent(nil))
+}
+
+func TestStampAndCorrelation(t *testing.T) {
+	ctx := middleware.WithCorrelationContext(context.Background(), "corr-1", "req-1", "", "")
+	event := &Event{Type: "code.redeemed"}
+	stamp(ctx, event)
+
+	assert.NotEmpty(t, event.ID)
+	assert.False(t, event.Time.IsZero())
+	assert.Equal(t, "corr-1", event.Metadata[MetadataCorrelationID])
+	assert.Equal(t, "req-1", event.Metadata[MetadataRequestID])
+
+	var seen *middleware.CorrelationContext
+	handler := Correlation()(func(ctx context.Context, event *Event) error {
+		seen = middleware.GetCorrelationContext(ctx)
+		return nil
+	})
+
+	require.NoError(t, handler(context.Background(), event))
+	require.NotNil(t, seen)
+	assert.Equal(t, "corr-1", seen.CorrelationID)
+	assert.Equal(t, "req-1", seen.RequestID)
+
+	// Events published outside a request correlate on their own ID
+	require.NoError(t, handler(context.Background(), &Event{ID: "event-1"}))
+	assert.Equal(t, "event-1", seen.CorrelationID)
+}
+
+func TestRecover(t *testing.T) {
+	handler := Recover()(func(ctx context.Context, event *Event) error {
+		panic("boom")
+	})
+
+	err := handler(context.Background(), &Event{ID: "event-1", Type: "code.redeemed"})
+	assert.ErrorContains(t, err, "panicked: boom")
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, event *Event) error {
+				order = append(order, name)
+				return next(ctx, event)
+			}
+		}
+	}
+
+	handler := Chain(func(ctx context.Context, event *Event) error {
+		order = append(order, "handler")
+		return nil
+	}, mark("first"), mark("second"))
+
+	require.NoError(t, handler(context.Background(), &Event{}))
+	assert.Equal(t, []string{"first", "second", "handler"}, order)
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	metrics := middleware.NewMetricsRegistry("eventbus-test")
+	handler := Metrics(metrics)(func(ctx context.Context, event *Event) error {
+		return errors.New("failed")
+	})
+
+	assert.Error(t, handler(context.Background(), &Event{Type: "code.redeemed"}))
+}
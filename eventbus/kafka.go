@@ -0,0 +1,369 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/segmentio/kafka-go"
+)
+
+// Kafka headers carrying the event envelope; other headers are metadata
+const (
+	headerEventID   = "event_id"
+	headerEventType = "event_type"
+	headerEventTime = "event_time"
+
+	headerDeadLetterError = "dead_letter_error"
+	headerDeadLetterTopic = "dead_letter_topic"
+)
+
+// KafkaConfig holds the configuration for a Kafka bus
+type KafkaConfig struct {
+	Brokers []string `json:"brokers"`
+
+	// TopicPrefix is prepended to the event type to name its topic
+	TopicPrefix string `json:"topic_prefix"`
+
+	// GroupID is the consumer group, normally the service name. It is
+	// required to subscribe.
+	GroupID string `json:"group_id"`
+
+	// Retry is the policy for redelivering a failed event in place; nil
+	// tries it once. When it is exhausted the event goes to DeadLetterTopic,
+	// or without one it is redelivered until it succeeds, holding up its
+	// partition.
+	Retry           *middleware.RetryConfig `json:"retry,omitempty"`
+	DeadLetterTopic string                  `json:"dead_letter_topic"`
+
+	// BatchTimeout is how long the producer waits to fill a batch
+	BatchTimeout time.Duration `json:"batch_timeout"`
+
+	Middleware []Middleware                `json:"-"` // nil uses DefaultMiddleware(Metrics)
+	Logger     *slog.Logger                `json:"-"` // nil uses slog.Default
+	Metrics    *middleware.MetricsRegistry `json:"-"` // nil disables metrics
+}
+
+// DefaultKafkaConfig returns a configuration for a local broker with the
+// default retry policy
+func DefaultKafkaConfig() *KafkaConfig {
+	return &KafkaConfig{
+		Brokers:      []string{"localhost:9092"},
+		TopicPrefix:  "events.",
+		Retry:        middleware.DefaultRetryConfig(),
+		BatchTimeout: 10 * time.Millisecond,
+	}
+}
+
+// messageWriter is the part of *kafka.Writer the bus uses
+type messageWriter interface {
+	WriteMessages(ctx context.Context, messages ...kafka.Message) error
+	Close() error
+}
+
+// KafkaBus publishes events to one topic per event type and consumes them
+// in a consumer group, committing each message once its handler succeeds
+type KafkaBus struct {
+	config     *KafkaConfig
+	logger     *slog.Logger
+	middleware []Middleware
+	writer     messageWriter
+	workers    *middleware.WorkerGroup
+	readers    map[string]*kafka.Reader
+	closed     bool
+	mutex      sync.Mutex
+}
+
+// NewKafkaBus creates a Kafka bus. Consumers run until ctx is cancelled or
+// the bus is shut down.
+func NewKafkaBus(ctx context.Context, config *KafkaConfig) (*KafkaBus, error) {
+	if config == nil {
+		config = DefaultKafkaConfig()
+	}
+	if len(config.Brokers) == 0 {
+		return nil, errors.New("kafka bus: at least one broker is required")
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	chain := config.Middleware
+	if chain == nil {
+		chain = DefaultMiddleware(config.Metrics)
+	}
+
+	return &KafkaBus{
+		config:     config,
+		logger:     logger,
+		middleware: chain,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(config.Brokers...),
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: config.BatchTimeout,
+		},
+		workers: middleware.NewWorkerGroup(ctx, "eventbus", &middleware.GoroutineConfig{Logger: logger, Metrics: config.Metrics}),
+		readers: make(map[string]*kafka.Reader),
+	}, nil
+}
+
+// Topic returns the topic events of a type are published to
+func (b *KafkaBus) Topic(eventType string) string {
+	return b.config.TopicPrefix + eventType
+}
+
+// Publish writes the events and returns once every in-sync replica has them
+func (b *KafkaBus) Publish(ctx context.Context, events ...*Event) error {
+	b.mutex.Lock()
+	closed := b.closed
+	b.mutex.Unlock()
+	if closed {
+		return ErrClosed
+	}
+
+	messages := make([]kafka.Message, len(events))
+	for i, event := range events {
+		stamp(ctx, event)
+		messages[i] = toMessage(b.Topic(event.Type), event)
+	}
+
+	err := b.writer.WriteMessages(ctx, messages...)
+	if b.config.Metrics != nil {
+		status := "success"
+		if err != nil {
+			status = "error"
+		}
+		for _, event := range events {
+			b.config.Metrics.RecordEventPublished(event.Type, status)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to publish events: %w", err)
+	}
+	return nil
+}
+
+// Subscribe starts consuming the event type's topic in the consumer group
+func (b *KafkaBus) Subscribe(eventType string, handler Handler) error {
+	if b.config.GroupID == "" {
+		return errors.New("kafka bus: a group ID is required to subscribe")
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	if _, ok := b.readers[eventType]; ok {
+		return ErrAlreadySubscribed
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: b.config.Brokers,
+		GroupID: b.config.GroupID,
+		Topic:   b.Topic(eventType),
+	})
+	handler = Chain(handler, b.middleware...)
+	if !b.workers.Go("consume:"+eventType, func(ctx context.Context) error {
+		return b.consume(ctx, reader, handler)
+	}) {
+		reader.Close()
+		return ErrClosed
+	}
+	b.readers[eventType] = reader
+	return nil
+}
+
+// consume handles the reader's messages one at a time, committing each once
+// it has been handled or dead-lettered
+func (b *KafkaBus) consume(ctx context.Context, reader *kafka.Reader, handler Handler) error {
+	for {
+		message, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to fetch from %s: %w", reader.Config().Topic, err)
+		}
+
+		// An unprocessed message isn't committed, so it is redelivered after a restart
+		if err := b.process(ctx, message, handler); err != nil {
+			return nil
+		}
+		if err := reader.CommitMessages(ctx, message); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to commit to %s: %w", reader.Config().Topic, err)
+		}
+	}
+}
+
+// process delivers a message until it is handled or dead-lettered. It only
+// fails when ctx ends first.
+func (b *KafkaBus) process(ctx context.Context, message kafka.Message, handler Handler) error {
+	event := fromMessage(message)
+
+	for {
+		err := b.handle(ctx, event, handler)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		attrs := []interface{}{
+			"event_id", event.ID,
+			"event_type", event.Type,
+			"topic", message.Topic,
+			"partition", message.Partition,
+			"offset", message.Offset,
+			"correlation_id", event.Metadata[MetadataCorrelationID],
+			"error", err.Error(),
+		}
+
+		if b.config.DeadLetterTopic != "" {
+			dlErr := b.deadLetter(ctx, message, err)
+			if dlErr == nil {
+				b.logger.ErrorContext(ctx, "event dead-lettered", attrs...)
+				return nil
+			}
+			attrs = append(attrs, "dead_letter_error", dlErr.Error())
+		} else if IsPermanent(err) {
+			b.logger.ErrorContext(ctx, "event dropped after permanent failure", attrs...)
+			return nil
+		}
+
+		b.logger.WarnContext(ctx, "event handling failed, redelivering", attrs...)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(b.redeliveryDelay()):
+		}
+	}
+}
+
+// handle runs the handler under the retry policy. Permanent errors aren't retried.
+func (b *KafkaBus) handle(ctx context.Context, event *Event, handler Handler) error {
+	if b.config.Retry == nil {
+		return handler(ctx, event)
+	}
+
+	// Every failure is retried, whatever statuses the policy lists
+	policy := *b.config.Retry
+	policy.RetryableErrors = []int{http.StatusServiceUnavailable}
+
+	var lastErr error
+	err := policy.Retry(ctx, func() error {
+		lastErr = handler(ctx, event)
+		if lastErr != nil && !IsPermanent(lastErr) {
+			return &middleware.RetryableError{StatusCode: http.StatusServiceUnavailable, Message: lastErr.Error()}
+		}
+		return nil
+	})
+	if lastErr == nil {
+		return err
+	}
+	return lastErr
+}
+
+// redeliveryDelay is the pause before a failed event is delivered again
+func (b *KafkaBus) redeliveryDelay() time.Duration {
+	if b.config.Retry != nil && b.config.Retry.MaxDelay > 0 {
+		return b.config.Retry.MaxDelay
+	}
+	return 5 * time.Second
+}
+
+// deadLetter copies a message to the dead letter topic with the failure
+func (b *KafkaBus) deadLetter(ctx context.Context, message kafka.Message, cause error) error {
+	headers := append([]kafka.Header{}, message.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: headerDeadLetterError, Value: []byte(cause.Error())},
+		kafka.Header{Key: headerDeadLetterTopic, Value: []byte(message.Topic)},
+	)
+	return b.writer.WriteMessages(ctx, kafka.Message{
+		Topic:   b.config.DeadLetterTopic,
+		Key:     message.Key,
+		Value:   message.Value,
+		Headers: headers,
+	})
+}
+
+// Shutdown stops the consumers, waiting for events being handled, then
+// flushes the producer
+func (b *KafkaBus) Shutdown(ctx context.Context) error {
+	b.mutex.Lock()
+	if b.closed {
+		b.mutex.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mutex.Unlock()
+
+	errs := []error{b.workers.Shutdown(ctx)}
+	for eventType, reader := range b.readers {
+		if err := reader.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close %s consumer: %w", eventType, err))
+		}
+	}
+	if err := b.writer.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close producer: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// toMessage encodes an event as a Kafka message: the data as the value, the
+// key as the message key and the envelope and metadata as headers
+func toMessage(topic string, event *Event) kafka.Message {
+	headers := []kafka.Header{
+		{Key: headerEventID, Value: []byte(event.ID)},
+		{Key: headerEventType, Value: []byte(event.Type)},
+		{Key: headerEventTime, Value: []byte(event.Time.Format(time.RFC3339Nano))},
+	}
+	for key, value := range event.Metadata {
+		headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+
+	return kafka.Message{
+		Topic:   topic,
+		Key:     []byte(event.Key),
+		Value:   event.Data,
+		Headers: headers,
+		Time:    event.Time,
+	}
+}
+
+// fromMessage decodes an event from a Kafka message
+func fromMessage(message kafka.Message) *Event {
+	event := &Event{
+		Key:      string(message.Key),
+		Data:     message.Value,
+		Time:     message.Time,
+		Metadata: make(map[string]string),
+	}
+
+	for _, header := range message.Headers {
+		switch header.Key {
+		case headerEventID:
+			event.ID = string(header.Value)
+		case headerEventType:
+			event.Type = string(header.Value)
+		case headerEventTime:
+			if t, err := time.Parse(time.RFC3339Nano, string(header.Value)); err == nil {
+				event.Time = t
+			}
+		default:
+			event.Metadata[header.Key] = string(header.Value)
+		}
+	}
+	return event
+}
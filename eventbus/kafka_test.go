@@ -0,0 +1,163 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWriter records the messages written to it
+type fakeWriter struct {
+	messages []kafka.Message
+	err      error
+	mutex    sync.Mutex
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	w.messages = append(w.messages, messages...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	return nil
+}
+
+// newTestKafkaBus creates a Kafka bus that writes to a fake producer
+func newTestKafkaBus(t *testing.T, config *KafkaConfig) (*KafkaBus, *fakeWriter) {
+	bus, err := NewKafkaBus(context.Background(), config)
+	require.NoError(t, err)
+
+	writer := &fakeWriter{}
+	bus.writer = writer
+	t.Cleanup(func() { bus.Shutdown(context.Background()) })
+	return bus, writer
+}
+
+// testRetry retries quickly
+func testRetry() *middleware.RetryConfig {
+	return &middleware.RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffFactor: 1}
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	event, err := NewEvent("code.redeemed", "org-1", codeRedeemed{Code: "ABC123"})
+	require.NoError(t, err)
+	event.Metadata[MetadataCorrelationID] = "corr-1"
+
+	message := toMessage("events.code.redeemed", event)
+	assert.Equal(t, "events.code.redeemed", message.Topic)
+	assert.Equal(t, []byte("org-1"), message.Key)
+
+	decoded := fromMessage(message)
+	assert.Equal(t, event.ID, decoded.ID)
+	assert.Equal(t, event.Type, decoded.Type)
+	assert.Equal(t, event.Key, decoded.Key)
+	assert.True(t, event.Time.Equal(decoded.Time))
+	assert.JSONEq(t, string(event.Data), string(decoded.Data))
+	assert.Equal(t, "corr-1", decoded.Metadata[MetadataCorrelationID])
+}
+
+func TestKafkaBusPublish(t *testing.T) {
+	bus, writer := newTestKafkaBus(t, &KafkaConfig{Brokers: []string{"localhost:9092"}, TopicPrefix: "jarakey."})
+
+	ctx := middleware.WithCorrelationContext(context.Background(), "corr-1", "req-1", "", "")
+	event, err := NewEvent("code.redeemed", "org-1", codeRedeemed{Code: "ABC123"})
+	require.NoError(t, err)
+	require.NoError(t, bus.Publish(ctx, event))
+
+	require.Len(t, writer.messages, 1)
+	assert.Equal(t, "jarakey.code.redeemed", writer.messages[0].Topic)
+	assert.Equal(t, "corr-1", fromMessage(writer.messages[0]).Metadata[MetadataCorrelationID])
+
+	writer.err = errors.New("broker unavailable")
+	assert.ErrorContains(t, bus.Publish(ctx, event), "broker unavailable")
+}
+
+func TestKafkaBusRetriesThenDeadLetters(t *testing.T) {
+	bus, writer := newTestKafkaBus(t, &KafkaConfig{
+		Brokers:         []string{"localhost:9092"},
+		Retry:           testRetry(),
+		DeadLetterTopic: "events.dead_letter",
+	})
+
+	attempts := 0
+	handler := func(ctx context.Context, event *Event) error {
+		attempts++
+		return errors.New("downstream unavailable")
+	}
+
+	event, err := NewEvent("code.redeemed", "org-1", codeRedeemed{Code: "ABC123"})
+	require.NoError(t, err)
+	message := toMessage("events.code.redeemed", event)
+
+	require.NoError(t, bus.process(context.Background(), message, handler))
+	assert.Equal(t, 3, attempts)
+
+	require.Len(t, writer.messages, 1)
+	deadLetter := writer.messages[0]
+	assert.Equal(t, "events.dead_letter", deadLetter.Topic)
+	dead := fromMessage(deadLetter)
+	assert.Equal(t, event.ID, dead.ID)
+	assert.Equal(t, "downstream unavailable", dead.Metadata[headerDeadLetterError])
+	assert.Equal(t, "events.code.redeemed", dead.Metadata[headerDeadLetterTopic])
+}
+
+func TestKafkaBusPermanentFailures(t *testing.T) {
+	bus, writer := newTestKafkaBus(t, &KafkaConfig{Brokers: []string{"localhost:9092"}, Retry: testRetry()})
+
+	attempts := 0
+	handler := func(ctx context.Context, event *Event) error {
+		attempts++
+		var data codeRedeemed
+		return event.Decode(&data)
+	}
+
+	message := toMessage("events.code.redeemed", &Event{ID: "event-1", Type: "code.redeemed", Data: []byte("not json")})
+	require.NoError(t, bus.process(context.Background(), message, handler))
+
+	assert.Equal(t, 1, attempts, "permanent failures aren't retried")
+	assert.Empty(t, writer.messages, "without a dead letter topic the event is dropped")
+}
+
+func TestKafkaBusRedeliversUntilCancelled(t *testing.T) {
+	bus, _ := newTestKafkaBus(t, &KafkaConfig{Brokers: []string{"localhost:9092"}, Retry: testRetry()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	handler := func(ctx context.Context, event *Event) error {
+		attempts++
+		if attempts == 7 {
+			cancel()
+		}
+		return errors.New("downstream unavailable")
+	}
+
+	message := toMessage("events.code.redeemed", &Event{ID: "event-1", Type: "code.redeemed"})
+	err := bus.process(ctx, message, handler)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 7, attempts)
+}
+
+func TestKafkaBusConfiguration(t *testing.T) {
+	_, err := NewKafkaBus(context.Background(), &KafkaConfig{})
+	assert.Error(t, err)
+
+	bus, _ := newTestKafkaBus(t, DefaultKafkaConfig())
+	assert.Equal(t, "events.code.redeemed", bus.Topic("code.redeemed"))
+	assert.ErrorContains(t, bus.Subscribe("code.redeemed", func(ctx context.Context, event *Event) error { return nil }), "group ID")
+
+	require.NoError(t, bus.Shutdown(context.Background()))
+	assert.ErrorIs(t, bus.Publish(context.Background(), &Event{Type: "code.redeemed"}), ErrClosed)
+}
@@ -0,0 +1,109 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// MemoryBus delivers events synchronously within the process. It is meant
+// for tests: Publish returns the handlers' errors, and Published lists
+// everything that was published.
+type MemoryBus struct {
+	handlers   map[string]Handler
+	middleware []Middleware
+	published  []*Event
+	closed     bool
+	mutex      sync.Mutex
+}
+
+// NewMemoryBus creates an in-memory bus whose handlers are wrapped in middleware
+func NewMemoryBus(middleware ...Middleware) *MemoryBus {
+	return &MemoryBus{
+		handlers:   make(map[string]Handler),
+		middleware: middleware,
+	}
+}
+
+// Publish records the events and delivers each to its type's handler, if
+// any, before returning
+func (b *MemoryBus) Publish(ctx context.Context, events ...*Event) error {
+	b.mutex.Lock()
+	if b.closed {
+		b.mutex.Unlock()
+		return ErrClosed
+	}
+	for _, event := range events {
+		stamp(ctx, event)
+		b.published = append(b.published, event)
+	}
+	b.mutex.Unlock()
+
+	// Handlers may publish in turn, so deliver without holding the lock
+	var errs []error
+	for _, event := range events {
+		b.mutex.Lock()
+		handler := b.handlers[event.Type]
+		b.mutex.Unlock()
+
+		if handler != nil {
+			errs = append(errs, handler(context.WithoutCancel(ctx), event))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Subscribe delivers events of a type to handler
+func (b *MemoryBus) Subscribe(eventType string, handler Handler) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	if _, ok := b.handlers[eventType]; ok {
+		return ErrAlreadySubscribed
+	}
+	b.handlers[eventType] = Chain(handler, b.middleware...)
+	return nil
+}
+
+// Published returns the events published so far, optionally only those of
+// the given types
+func (b *MemoryBus) Published(eventTypes ...string) []*Event {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var events []*Event
+	for _, event := range b.published {
+		if len(eventTypes) == 0 || containsType(eventTypes, event.Type) {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// Reset forgets the published events
+func (b *MemoryBus) Reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.published = nil
+}
+
+// Shutdown closes the bus
+func (b *MemoryBus) Shutdown(ctx context.Context) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.closed = true
+	return nil
+}
+
+// containsType reports whether eventType is in eventTypes
+func containsType(eventTypes []string, eventType string) bool {
+	for _, t := range eventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
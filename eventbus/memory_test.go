@@ -0,0 +1,76 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryBusDelivers(t *testing.T) {
+	bus := NewMemoryBus(DefaultMiddleware(nil)...)
+
+	var received []string
+	var correlationID string
+	require.NoError(t, bus.Subscribe("code.redeemed", func(ctx context.Context, event *Event) error {
+		var data codeRedeemed
+		if err := event.Decode(&data); err != nil {
+			return err
+		}
+		received = append(received, data.Code)
+		correlationID = middleware.GetCorrelationID(ctx)
+		return nil
+	}))
+
+	ctx := middleware.WithCorrelationContext(context.Background(), "corr-1", "req-1", "", "")
+	redeemed, err := NewEvent("code.redeemed", "org-1", codeRedeemed{Code: "ABC123"})
+	require.NoError(t, err)
+	created, err := NewEvent("code.created", "org-1", codeRedeemed{Code: "XYZ789"})
+	require.NoError(t, err)
+
+	require.NoError(t, bus.Publish(ctx, redeemed, created))
+
+	assert.Equal(t, []string{"ABC123"}, received)
+	assert.Equal(t, "corr-1", correlationID)
+	assert.Len(t, bus.Published(), 2)
+	assert.Equal(t, []*Event{created}, bus.Published("code.created"))
+
+	bus.Reset()
+	assert.Empty(t, bus.Published())
+}
+
+func TestMemoryBusReturnsHandlerErrors(t *testing.T) {
+	bus := NewMemoryBus()
+	failure := errors.New("handler failed")
+	require.NoError(t, bus.Subscribe("code.redeemed", func(ctx context.Context, event *Event) error {
+		return failure
+	}))
+
+	err := bus.Publish(context.Background(), &Event{Type: "code.redeemed"})
+	assert.ErrorIs(t, err, failure)
+}
+
+func TestMemoryBusHandlersMayPublish(t *testing.T) {
+	bus := NewMemoryBus()
+	require.NoError(t, bus.Subscribe("code.redeemed", func(ctx context.Context, event *Event) error {
+		return bus.Publish(ctx, &Event{Type: "audit.recorded"})
+	}))
+
+	require.NoError(t, bus.Publish(context.Background(), &Event{Type: "code.redeemed"}))
+	assert.Len(t, bus.Published("audit.recorded"), 1)
+}
+
+func TestMemoryBusSubscribeAndShutdown(t *testing.T) {
+	bus := NewMemoryBus()
+	handler := func(ctx context.Context, event *Event) error { return nil }
+
+	require.NoError(t, bus.Subscribe("code.redeemed", handler))
+	assert.ErrorIs(t, bus.Subscribe("code.redeemed", handler), ErrAlreadySubscribed)
+
+	require.NoError(t, bus.Shutdown(context.Background()))
+	assert.ErrorIs(t, bus.Publish(context.Background(), &Event{Type: "code.redeemed"}), ErrClosed)
+	assert.ErrorIs(t, bus.Subscribe("code.created", handler), ErrClosed)
+}
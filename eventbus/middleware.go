@@ -0,0 +1,88 @@
+package eventbus
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware wraps a handler
+type Middleware func(Handler) Handler
+
+// Chain wraps handler in middleware, the first being outermost
+func Chain(handler Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// Recover turns a panicking handler into a failed delivery, so one bad
+// event can't stop a consumer
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, event *Event) (err error) {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					err = fmt.Errorf("handler for %s event %s panicked: %v", event.Type, event.ID, recovered)
+				}
+			}()
+			return next(ctx, event)
+		}
+	}
+}
+
+// Correlation gives the handler the publisher's correlation IDs and trace
+// context, so its logs and outbound calls carry the IDs of the request that
+// published the event. Events without a correlation ID use the event ID.
+func Correlation() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, event *Event) error {
+			ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(event.Metadata))
+
+			correlationID := event.Metadata[MetadataCorrelationID]
+			if correlationID == "" {
+				correlationID = event.ID
+			}
+			var traceID, spanID string
+			if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+				traceID, spanID = spanContext.TraceID().String(), spanContext.SpanID().String()
+			}
+
+			ctx = middleware.WithCorrelationContext(ctx, correlationID, event.Metadata[MetadataRequestID], traceID, spanID)
+			return next(ctx, event)
+		}
+	}
+}
+
+// Metrics records each delivery's outcome and duration in the event metrics
+func Metrics(metrics *middleware.MetricsRegistry) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, event *Event) error {
+			start := time.Now()
+			err := next(ctx, event)
+
+			status := "success"
+			if err != nil {
+				status = "error"
+			}
+			metrics.RecordEventHandled(event.Type, status, time.Since(start))
+			return err
+		}
+	}
+}
+
+// DefaultMiddleware returns Recover, Correlation and, when metrics is not
+// nil, Metrics
+func DefaultMiddleware(metrics *middleware.MetricsRegistry) []Middleware {
+	chain := []Middleware{Recover(), Correlation()}
+	if metrics != nil {
+		chain = append(chain, Metrics(metrics))
+	}
+	return chain
+}
@@ -0,0 +1,157 @@
+// Package geo resolves client IP addresses to a coarse location (country,
+// region and city) for validation logs and audit trails. Resolvers look
+// addresses up in a MaxMind database or an HTTP service; the middleware
+// resolves each request's client IP once and keeps the result in the
+// request context.
+package geo
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+)
+
+// Location is where an IP address is, to city precision at best
+type Location struct {
+	CountryCode string `json:"country_code"` // ISO 3166-1 alpha-2, e.g. "NG"
+	Country     string `json:"country,omitempty"`
+	Region      string `json:"region,omitempty"`
+	City        string `json:"city,omitempty"`
+}
+
+// String formats the location as "City, Region, CC", leaving out the parts
+// that are unknown. This is the format of ValidationLog.Location.
+func (l *Location) String() string {
+	if l == nil {
+		return ""
+	}
+	var parts []string
+	for _, part := range []string{l.City, l.Region, l.CountryCode} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Resolver looks up the location of an IP address. Resolve returns nil
+// without an error when the address isn't in its data.
+type Resolver interface {
+	Name() string
+	Resolve(ctx context.Context, ip netip.Addr) (*Location, error)
+}
+
+// Routable reports whether ip is a public address a resolver can locate,
+// rather than a private, loopback, link-local or unspecified one
+func Routable(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsValid() &&
+		!ip.IsPrivate() &&
+		!ip.IsLoopback() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified()
+}
+
+// CacheConfig holds the configuration for a caching resolver
+type CacheConfig struct {
+	TTL        time.Duration `json:"ttl"`
+	MaxEntries int           `json:"max_entries"`
+
+	Clock clock.Clock `json:"-"` // nil uses the system clock
+}
+
+// DefaultCacheConfig returns a cache configuration that keeps up to 10,000
+// addresses for an hour
+func DefaultCacheConfig() *CacheConfig {
+	return &CacheConfig{
+		TTL:        time.Hour,
+		MaxEntries: 10000,
+	}
+}
+
+// cacheEntry is a cached lookup; location is nil for unknown addresses
+type cacheEntry struct {
+	location  *Location
+	expiresAt time.Time
+}
+
+// CachingResolver caches another resolver's results, including addresses
+// it doesn't know. Errors aren't cached.
+type CachingResolver struct {
+	resolver Resolver
+	config   *CacheConfig
+	clock    clock.Clock
+	entries  map[netip.Addr]cacheEntry
+	mutex    sync.Mutex
+}
+
+// NewCachingResolver wraps resolver with a cache
+func NewCachingResolver(resolver Resolver, config *CacheConfig) *CachingResolver {
+	if config == nil {
+		config = DefaultCacheConfig()
+	}
+	return &CachingResolver{
+		resolver: resolver,
+		config:   config,
+		clock:    clock.OrReal(config.Clock),
+		entries:  make(map[netip.Addr]cacheEntry),
+	}
+}
+
+// Name returns the wrapped resolver's name
+func (c *CachingResolver) Name() string {
+	return c.resolver.Name()
+}
+
+// Resolve returns the cached location of ip, looking it up on a miss
+func (c *CachingResolver) Resolve(ctx context.Context, ip netip.Addr) (*Location, error) {
+	now := c.clock.Now()
+
+	c.mutex.Lock()
+	entry, ok := c.entries[ip]
+	c.mutex.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.location, nil
+	}
+
+	location, err := c.resolver.Resolve(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.entries) >= c.config.MaxEntries {
+		c.evict(now)
+	}
+	c.entries[ip] = cacheEntry{location: location, expiresAt: now.Add(c.config.TTL)}
+	return location, nil
+}
+
+// evict removes expired entries, then arbitrary ones until there is room
+func (c *CachingResolver) evict(now time.Time) {
+	for ip, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, ip)
+		}
+	}
+	for ip := range c.entries {
+		if len(c.entries) < c.config.MaxEntries {
+			break
+		}
+		delete(c.entries, ip)
+	}
+}
+
+// Len returns the number of cached addresses
+func (c *CachingResolver) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.entries)
+}
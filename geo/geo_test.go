@@ -0,0 +1,82 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticResolver returns fixed locations and counts lookups
+type staticResolver struct {
+	locations map[string]*Location
+	err       error
+	lookups   int
+}
+
+func (s *staticResolver) Name() string { return "static" }
+
+func (s *staticResolver) Resolve(ctx context.Context, ip netip.Addr) (*Location, error) {
+	s.lookups++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.locations[ip.String()], nil
+}
+
+func TestLocationString(t *testing.T) {
+	assert.Equal(t, "Ikeja, Lagos, NG", (&Location{CountryCode: "NG", Region: "Lagos", City: "Ikeja"}).String())
+	assert.Equal(t, "Lagos, NG", (&Location{CountryCode: "NG", Region: "Lagos"}).String())
+	assert.Equal(t, "NG", (&Location{CountryCode: "NG", Country: "Nigeria"}).String())
+	assert.Equal(t, "", (*Location)(nil).String())
+}
+
+func TestRoutable(t *testing.T) {
+	for _, ip := range []string{"102.89.34.5", "2a02:c7c::1", "::ffff:102.89.34.5"} {
+		assert.True(t, Routable(netip.MustParseAddr(ip)), ip)
+	}
+	for _, ip := range []string{"10.0.0.1", "192.168.1.1", "127.0.0.1", "::1", "fe80::1", "0.0.0.0", "fd00::1"} {
+		assert.False(t, Routable(netip.MustParseAddr(ip)), ip)
+	}
+	assert.False(t, Routable(netip.Addr{}))
+}
+
+func TestCachingResolver(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	inner := &staticResolver{locations: map[string]*Location{"102.89.34.5": {CountryCode: "NG"}}}
+	resolver := NewCachingResolver(inner, &CacheConfig{TTL: time.Hour, MaxEntries: 2, Clock: fake})
+
+	for i := 0; i < 3; i++ {
+		location, err := resolver.Resolve(ctx, netip.MustParseAddr("102.89.34.5"))
+		require.NoError(t, err)
+		assert.Equal(t, "NG", location.CountryCode)
+	}
+	assert.Equal(t, 1, inner.lookups)
+
+	location, err := resolver.Resolve(ctx, netip.MustParseAddr("8.8.8.8"))
+	require.NoError(t, err)
+	assert.Nil(t, location)
+	_, err = resolver.Resolve(ctx, netip.MustParseAddr("8.8.8.8"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, inner.lookups, "unknown addresses are cached too")
+
+	fake.Advance(time.Hour)
+	_, err = resolver.Resolve(ctx, netip.MustParseAddr("102.89.34.5"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, inner.lookups, "entries expire")
+
+	_, err = resolver.Resolve(ctx, netip.MustParseAddr("1.1.1.1"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, resolver.Len(), "the cache stays within MaxEntries")
+
+	inner.err = errors.New("lookup service down")
+	_, err = resolver.Resolve(ctx, netip.MustParseAddr("9.9.9.9"))
+	assert.Error(t, err)
+	assert.Equal(t, 2, resolver.Len(), "errors aren't cached")
+}
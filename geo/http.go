@@ -0,0 +1,118 @@
+package geo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// HTTPConfig holds the configuration for an HTTP lookup service
+type HTTPConfig struct {
+	// URL is the lookup URL with {ip} in place of the address
+	URL     string        `json:"url"`
+	Token   string        `json:"-"` // Sent as a bearer token when set
+	Timeout time.Duration `json:"timeout"`
+
+	// Decode reads the service's response. nil reads the "country" (ISO
+	// code), "region" and "city" fields returned by ipinfo.io.
+	Decode func(data []byte) (*Location, error) `json:"-"`
+}
+
+// DefaultHTTPConfig returns an ipinfo.io configuration
+func DefaultHTTPConfig() *HTTPConfig {
+	return &HTTPConfig{
+		URL:     "https://ipinfo.io/{ip}/json",
+		Timeout: 2 * time.Second,
+	}
+}
+
+// HTTPResolver looks addresses up with an HTTP service
+type HTTPResolver struct {
+	config     *HTTPConfig
+	decode     func(data []byte) (*Location, error)
+	httpClient *http.Client
+}
+
+// NewHTTPResolver creates an HTTP resolver
+func NewHTTPResolver(config *HTTPConfig) (*HTTPResolver, error) {
+	if config == nil {
+		config = DefaultHTTPConfig()
+	}
+	if !strings.Contains(config.URL, "{ip}") {
+		return nil, errors.New("geo lookup URL must contain {ip}")
+	}
+	decode := config.Decode
+	if decode == nil {
+		decode = decodeIPInfo
+	}
+	return &HTTPResolver{
+		config:     config,
+		decode:     decode,
+		httpClient: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Name returns "http"
+func (h *HTTPResolver) Name() string {
+	return "http"
+}
+
+// Resolve asks the service for the location of ip. A 404 means the address
+// is unknown.
+func (h *HTTPResolver) Resolve(ctx context.Context, ip netip.Addr) (*Location, error) {
+	endpoint := strings.ReplaceAll(h.config.URL, "{ip}", ip.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if h.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.config.Token)
+	}
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("geo lookup of %s failed: %w", ip, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, fmt.Errorf("geo lookup of %s failed: %w", ip, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("geo lookup responded %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	location, err := h.decode(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid geo lookup response: %w", err)
+	}
+	return location, nil
+}
+
+// decodeIPInfo reads an ipinfo.io response
+func decodeIPInfo(data []byte) (*Location, error) {
+	var resp struct {
+		Country string `json:"country"`
+		Region  string `json:"region"`
+		City    string `json:"city"`
+		Bogon   bool   `json:"bogon"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Bogon || resp.Country == "" {
+		return nil, nil
+	}
+	return &Location{CountryCode: resp.Country, Region: resp.Region, City: resp.City}, nil
+}
@@ -0,0 +1,72 @@
+package geo
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPResolver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/102.89.34.5/json":
+			io.WriteString(w, `{"ip":"102.89.34.5","city":"Ikeja","region":"Lagos","country":"NG","loc":"6.6,3.3"}`)
+		case "/203.0.113.9/json":
+			io.WriteString(w, `{"ip":"203.0.113.9","bogon":true}`)
+		case "/8.8.8.8/json":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, "rate limit exceeded")
+		}
+	}))
+	defer server.Close()
+
+	resolver, err := NewHTTPResolver(&HTTPConfig{URL: server.URL + "/{ip}/json", Token: "token"})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	location, err := resolver.Resolve(ctx, netip.MustParseAddr("102.89.34.5"))
+	require.NoError(t, err)
+	assert.Equal(t, &Location{CountryCode: "NG", Region: "Lagos", City: "Ikeja"}, location)
+
+	location, err = resolver.Resolve(ctx, netip.MustParseAddr("203.0.113.9"))
+	require.NoError(t, err)
+	assert.Nil(t, location)
+
+	location, err = resolver.Resolve(ctx, netip.MustParseAddr("8.8.8.8"))
+	require.NoError(t, err)
+	assert.Nil(t, location)
+
+	_, err = resolver.Resolve(ctx, netip.MustParseAddr("1.1.1.1"))
+	assert.EqualError(t, err, "geo lookup responded 429: rate limit exceeded")
+
+	_, err = NewHTTPResolver(&HTTPConfig{URL: server.URL})
+	assert.Error(t, err, "the URL needs an {ip} placeholder")
+}
+
+func TestHTTPResolverCustomDecode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"country_code":"GH"}`)
+	}))
+	defer server.Close()
+
+	resolver, err := NewHTTPResolver(&HTTPConfig{
+		URL: server.URL + "/lookup?ip={ip}",
+		Decode: func(data []byte) (*Location, error) {
+			return &Location{CountryCode: string(data[17:19])}, nil
+		},
+	})
+	require.NoError(t, err)
+
+	location, err := resolver.Resolve(context.Background(), netip.MustParseAddr("41.66.0.1"))
+	require.NoError(t, err)
+	assert.Equal(t, "GH", location.CountryCode)
+}
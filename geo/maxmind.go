@@ -0,0 +1,141 @@
+package geo
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// maxMindRecord is the part of a GeoIP2 or GeoLite2 City record we read
+type maxMindRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// MaxMindResolver looks addresses up in a GeoIP2 or GeoLite2 City or Country
+// database file, kept up to date by geoipupdate
+type MaxMindResolver struct {
+	path   string
+	reader *maxminddb.Reader
+	clock  clock.Clock
+	mutex  sync.RWMutex
+}
+
+// OpenMaxMind opens the database at path
+func OpenMaxMind(path string) (*MaxMindResolver, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database %s: %w", path, err)
+	}
+	return &MaxMindResolver{path: path, reader: reader, clock: clock.Real()}, nil
+}
+
+// Name returns "maxmind"
+func (m *MaxMindResolver) Name() string {
+	return "maxmind"
+}
+
+// SetClock sets the clock the health check measures the database age with
+func (m *MaxMindResolver) SetClock(clk clock.Clock) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.clock = clock.OrReal(clk)
+}
+
+// Resolve looks ip up, with English place names
+func (m *MaxMindResolver) Resolve(ctx context.Context, ip netip.Addr) (*Location, error) {
+	var record maxMindRecord
+
+	m.mutex.RLock()
+	err := m.reader.Lookup(ip.AsSlice(), &record)
+	m.mutex.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("GeoIP lookup of %s failed: %w", ip, err)
+	}
+	if record.Country.ISOCode == "" {
+		return nil, nil
+	}
+
+	location := &Location{
+		CountryCode: record.Country.ISOCode,
+		Country:     record.Country.Names["en"],
+		City:        record.City.Names["en"],
+	}
+	if len(record.Subdivisions) > 0 {
+		location.Region = record.Subdivisions[0].Names["en"]
+	}
+	return location, nil
+}
+
+// Reload reopens the database file, e.g. after geoipupdate replaced it.
+// Lookups keep using the old database if the new one can't be opened.
+func (m *MaxMindResolver) Reload() error {
+	reader, err := maxminddb.Open(m.path)
+	if err != nil {
+		return fmt.Errorf("failed to open GeoIP database %s: %w", m.path, err)
+	}
+
+	m.mutex.Lock()
+	previous := m.reader
+	m.reader = reader
+	m.mutex.Unlock()
+	return previous.Close()
+}
+
+// BuildTime returns when the database was built
+func (m *MaxMindResolver) BuildTime() time.Time {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return time.Unix(int64(m.reader.Metadata.BuildEpoch), 0).UTC()
+}
+
+// HealthCheck reports the database as degraded once it is older than
+// maxAge. MaxMind updates its databases weekly.
+func (m *MaxMindResolver) HealthCheck(maxAge time.Duration) middleware.HealthCheck {
+	return func(ctx context.Context) *middleware.DependencyHealth {
+		m.mutex.RLock()
+		now := m.clock.Now()
+		databaseType := m.reader.Metadata.DatabaseType
+		m.mutex.RUnlock()
+
+		built := m.BuildTime()
+		age := now.Sub(built)
+		health := &middleware.DependencyHealth{
+			Status:    middleware.StatusHealthy,
+			Message:   "GeoIP database is current",
+			Timestamp: now,
+			Details: map[string]interface{}{
+				"path":          m.path,
+				"database_type": databaseType,
+				"build_time":    built,
+				"age":           age.Round(time.Hour).String(),
+			},
+		}
+		if age > maxAge {
+			health.Status = middleware.StatusDegraded
+			health.Message = fmt.Sprintf("GeoIP database is %d days old", int(age.Hours()/24))
+		}
+		return health
+	}
+}
+
+// Close closes the database
+func (m *MaxMindResolver) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.reader.Close()
+}
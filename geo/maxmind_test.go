@@ -0,0 +1,98 @@
+package geo
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestDatabase writes a City database locating 102.89.0.0/16 in Lagos,
+// built at the given time
+func writeTestDatabase(t *testing.T, path string, built time.Time, city string) {
+	tree, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: "GeoLite2-City", BuildEpoch: built.Unix()})
+	require.NoError(t, err)
+
+	_, network, err := net.ParseCIDR("102.89.0.0/16")
+	require.NoError(t, err)
+	require.NoError(t, tree.Insert(network, mmdbtype.Map{
+		"country": mmdbtype.Map{
+			"iso_code": mmdbtype.String("NG"),
+			"names":    mmdbtype.Map{"en": mmdbtype.String("Nigeria")},
+		},
+		"subdivisions": mmdbtype.Slice{
+			mmdbtype.Map{"names": mmdbtype.Map{"en": mmdbtype.String("Lagos")}},
+		},
+		"city": mmdbtype.Map{"names": mmdbtype.Map{"en": mmdbtype.String(city)}},
+	}))
+
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+	_, err = tree.WriteTo(file)
+	require.NoError(t, err)
+}
+
+func TestMaxMindResolver(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+	built := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	writeTestDatabase(t, path, built, "Ikeja")
+
+	resolver, err := OpenMaxMind(path)
+	require.NoError(t, err)
+	defer resolver.Close()
+
+	location, err := resolver.Resolve(ctx, netip.MustParseAddr("102.89.34.5"))
+	require.NoError(t, err)
+	assert.Equal(t, &Location{CountryCode: "NG", Country: "Nigeria", Region: "Lagos", City: "Ikeja"}, location)
+	assert.Equal(t, "Ikeja, Lagos, NG", location.String())
+
+	location, err = resolver.Resolve(ctx, netip.MustParseAddr("8.8.8.8"))
+	require.NoError(t, err)
+	assert.Nil(t, location, "unknown addresses have no location")
+
+	// geoipupdate replaces the file
+	writeTestDatabase(t, path, built.Add(7*24*time.Hour), "Lekki")
+	require.NoError(t, resolver.Reload())
+	location, err = resolver.Resolve(ctx, netip.MustParseAddr("102.89.34.5"))
+	require.NoError(t, err)
+	assert.Equal(t, "Lekki", location.City)
+	assert.Equal(t, built.Add(7*24*time.Hour), resolver.BuildTime())
+
+	_, err = OpenMaxMind(filepath.Join(t.TempDir(), "missing.mmdb"))
+	assert.Error(t, err)
+}
+
+func TestMaxMindResolverHealthCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+	built := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	writeTestDatabase(t, path, built, "Ikeja")
+
+	resolver, err := OpenMaxMind(path)
+	require.NoError(t, err)
+	defer resolver.Close()
+
+	fake := clock.NewFake(built.Add(3 * 24 * time.Hour))
+	resolver.SetClock(fake)
+	check := resolver.HealthCheck(14 * 24 * time.Hour)
+
+	health := check(context.Background())
+	assert.Equal(t, middleware.StatusHealthy, health.Status)
+	assert.Equal(t, "GeoLite2-City", health.Details["database_type"])
+
+	fake.Advance(30 * 24 * time.Hour)
+	health = check(context.Background())
+	assert.Equal(t, middleware.StatusDegraded, health.Status)
+	assert.Equal(t, "GeoIP database is 33 days old", health.Message)
+}
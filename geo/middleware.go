@@ -0,0 +1,177 @@
+package geo
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// MiddlewareConfig holds the configuration for the geo middleware
+type MiddlewareConfig struct {
+	// Resolver locates client IPs; nil only records them
+	Resolver Resolver `json:"-"`
+
+	// TrustedProxies are the load balancers whose X-Forwarded-For header is
+	// believed. Requests from anywhere else use their remote address.
+	TrustedProxies []netip.Prefix `json:"trusted_proxies"`
+
+	// Timeout bounds a lookup, so a slow resolver can't slow requests down
+	Timeout time.Duration `json:"timeout"`
+
+	Logger *slog.Logger `json:"-"` // nil uses slog.Default
+}
+
+// DefaultMiddlewareConfig returns a configuration that trusts no proxies
+// and waits up to 250ms for a lookup
+func DefaultMiddlewareConfig() *MiddlewareConfig {
+	return &MiddlewareConfig{
+		Timeout: 250 * time.Millisecond,
+	}
+}
+
+// Middleware resolves the client IP of each request and stores it and its
+// location in the request context. Lookup failures are logged and the
+// request continues without a location.
+func Middleware(config *MiddlewareConfig) func(http.Handler) http.Handler {
+	locator := newLocator(config)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(locator.locate(r)))
+		})
+	}
+}
+
+// GinMiddleware is the Gin version of Middleware
+func GinMiddleware(config *MiddlewareConfig) gin.HandlerFunc {
+	locator := newLocator(config)
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(locator.locate(c.Request))
+		c.Next()
+	}
+}
+
+// locator resolves requests for the middleware
+type locator struct {
+	config *MiddlewareConfig
+	logger *slog.Logger
+}
+
+func newLocator(config *MiddlewareConfig) *locator {
+	if config == nil {
+		config = DefaultMiddlewareConfig()
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &locator{config: config, logger: logger}
+}
+
+// locate returns the request context with the client IP and location
+func (l *locator) locate(r *http.Request) context.Context {
+	ctx := r.Context()
+	ip := ClientIP(r, l.config.TrustedProxies)
+	if !ip.IsValid() {
+		return ctx
+	}
+	ctx = context.WithValue(ctx, "geo_client_ip", ip)
+	if l.config.Resolver == nil || !Routable(ip) {
+		return ctx
+	}
+
+	lookupCtx := ctx
+	if l.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		lookupCtx, cancel = context.WithTimeout(ctx, l.config.Timeout)
+		defer cancel()
+	}
+	location, err := l.config.Resolver.Resolve(lookupCtx, ip)
+	if err != nil {
+		l.logger.WarnContext(ctx, "failed to resolve client location",
+			"resolver", l.config.Resolver.Name(),
+			"ip", ip.String(),
+			"correlation_id", middleware.GetCorrelationID(ctx),
+			"error", err.Error(),
+		)
+		return ctx
+	}
+	if location == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, "geo_location", location)
+}
+
+// ClientIP returns the address of the client that made r. When the request
+// comes from a trusted proxy, X-Forwarded-For is read from the right,
+// skipping trusted proxies, so clients can't spoof their address by sending
+// the header themselves.
+func ClientIP(r *http.Request, trustedProxies []netip.Prefix) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	ip = ip.Unmap()
+	if !trusted(ip, trustedProxies) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = hop.Unmap()
+		if !trusted(ip, trustedProxies) {
+			break
+		}
+	}
+	return ip
+}
+
+// trusted reports whether ip is one of the trusted proxies
+func trusted(ip netip.Addr, proxies []netip.Prefix) bool {
+	for _, prefix := range proxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromContext returns the location the middleware resolved, or nil
+func FromContext(ctx context.Context) *Location {
+	location, _ := ctx.Value("geo_location").(*Location)
+	return location
+}
+
+// ClientIPFromContext returns the client IP the middleware found, or the
+// zero address
+func ClientIPFromContext(ctx context.Context) netip.Addr {
+	ip, _ := ctx.Value("geo_client_ip").(netip.Addr)
+	return ip
+}
+
+// EnrichValidationLog fills in the log's IP address and location from the
+// request context, leaving fields that are already set alone, so every
+// service records them the same way
+func EnrichValidationLog(ctx context.Context, log *types.ValidationLog) {
+	if ip := ClientIPFromContext(ctx); log.IPAddress == "" && ip.IsValid() {
+		log.IPAddress = ip.String()
+	}
+	if location := FromContext(ctx); log.Location == "" && location != nil {
+		log.Location = location.String()
+	}
+}
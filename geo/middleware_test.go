@@ -0,0 +1,107 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "102.89.34.5:5123", nil, "102.89.34.5"},
+		{"untrusted sender can't spoof", "102.89.34.5:5123", []string{"1.1.1.1"}, "102.89.34.5"},
+		{"trusted proxy", "10.0.0.7:80", []string{"102.89.34.5"}, "102.89.34.5"},
+		{"spoofed entries are skipped", "10.0.0.7:80", []string{"1.1.1.1, 102.89.34.5, 10.0.0.3"}, "102.89.34.5"},
+		{"multiple headers", "10.0.0.7:80", []string{"1.1.1.1", "102.89.34.5"}, "102.89.34.5"},
+		{"garbage stops the walk", "10.0.0.7:80", []string{"102.89.34.5, nonsense"}, "10.0.0.7"},
+		{"mapped IPv4", "[::ffff:102.89.34.5]:5123", nil, "102.89.34.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			assert.Equal(t, tt.want, ClientIP(r, proxies).String())
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	resolver := &staticResolver{locations: map[string]*Location{
+		"102.89.34.5": {CountryCode: "NG", Region: "Lagos", City: "Ikeja"},
+	}}
+	var log types.ValidationLog
+	handler := Middleware(&MiddlewareConfig{Resolver: resolver})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log = types.ValidationLog{ID: "log-1"}
+		EnrichValidationLog(r.Context(), &log)
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/validate", nil)
+	r.RemoteAddr = "102.89.34.5:5123"
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "102.89.34.5", log.IPAddress)
+	assert.Equal(t, "Ikeja, Lagos, NG", log.Location)
+
+	// Private addresses aren't looked up
+	r.RemoteAddr = "192.168.1.20:5123"
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "192.168.1.20", log.IPAddress)
+	assert.Empty(t, log.Location)
+	assert.Equal(t, 1, resolver.lookups)
+
+	// Lookup failures don't fail the request
+	resolver.err = errors.New("lookup service down")
+	config := &MiddlewareConfig{Resolver: resolver, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	recorder := httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "102.89.34.6:5123"
+	Middleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, FromContext(r.Context()))
+		assert.Equal(t, "102.89.34.6", ClientIPFromContext(r.Context()).String())
+		w.WriteHeader(http.StatusNoContent)
+	})).ServeHTTP(recorder, r)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+}
+
+func TestGinMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	resolver := &staticResolver{locations: map[string]*Location{"102.89.34.5": {CountryCode: "NG"}}}
+
+	router := gin.New()
+	router.Use(GinMiddleware(&MiddlewareConfig{Resolver: resolver, TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}))
+	var location *Location
+	router.GET("/", func(c *gin.Context) {
+		location = FromContext(c.Request.Context())
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.7:80"
+	r.Header.Set("X-Forwarded-For", "102.89.34.5")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, &Location{CountryCode: "NG"}, location)
+}
+
+func TestEnrichValidationLogKeepsSetFields(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "geo_location", &Location{CountryCode: "NG"})
+	log := types.ValidationLog{IPAddress: "41.66.0.1", Location: "Accra, GH"}
+	EnrichValidationLog(ctx, &log)
+	assert.Equal(t, "41.66.0.1", log.IPAddress)
+	assert.Equal(t, "Accra, GH", log.Location)
+}
@@ -0,0 +1,224 @@
+// Package grpcx maps the shared error contract onto gRPC: APIErrors become
+// status errors carrying the same code, message, fields and correlation ID,
+// and the grpc-gateway options render them back as the JSON our REST
+// handlers return, so clients see one contract whichever way they call us.
+package grpcx
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain identifies ErrorInfo details written by this package, so the
+// original APIError can be rebuilt from a status without guessing
+const ErrorDomain = "jarakey.com"
+
+// fieldCodePrefix prefixes the ErrorInfo metadata keys holding field error
+// codes, which BadRequest field violations have no room for
+const fieldCodePrefix = "field_code."
+
+// errorCodeGRPC maps error codes to gRPC codes
+var errorCodeGRPC = map[types.ErrorCode]codes.Code{
+	types.ErrCodeBadRequest:         codes.InvalidArgument,
+	types.ErrCodeValidationFailed:   codes.InvalidArgument,
+	types.ErrCodeUnauthorized:       codes.Unauthenticated,
+	types.ErrCodeInvalidToken:       codes.Unauthenticated,
+	types.ErrCodeForbidden:          codes.PermissionDenied,
+	types.ErrCodeInsufficientScope:  codes.PermissionDenied,
+	types.ErrCodeNotFound:           codes.NotFound,
+	types.ErrCodeConflict:           codes.AlreadyExists,
+	types.ErrCodeCodeExpired:        codes.FailedPrecondition,
+	types.ErrCodeCodeUsed:           codes.FailedPrecondition,
+	types.ErrCodeRateLimited:        codes.ResourceExhausted,
+	types.ErrCodeQuotaExceeded:      codes.ResourceExhausted,
+	types.ErrCodeChallengeRequired:  codes.FailedPrecondition,
+	types.ErrCodeInternal:           codes.Internal,
+	types.ErrCodeBadGateway:         codes.Unavailable,
+	types.ErrCodeServiceUnavailable: codes.Unavailable,
+	types.ErrCodeTimeout:            codes.DeadlineExceeded,
+}
+
+// grpcErrorCode maps gRPC codes from other services, which carry no
+// ErrorInfo, to error codes
+var grpcErrorCode = map[codes.Code]types.ErrorCode{
+	codes.InvalidArgument:    types.ErrCodeBadRequest,
+	codes.DeadlineExceeded:   types.ErrCodeTimeout,
+	codes.NotFound:           types.ErrCodeNotFound,
+	codes.AlreadyExists:      types.ErrCodeConflict,
+	codes.PermissionDenied:   types.ErrCodeForbidden,
+	codes.ResourceExhausted:  types.ErrCodeRateLimited,
+	codes.FailedPrecondition: types.ErrCodeConflict,
+	codes.Aborted:            types.ErrCodeConflict,
+	codes.OutOfRange:         types.ErrCodeBadRequest,
+	codes.Unimplemented:      types.ErrCodeNotFound,
+	codes.Unavailable:        types.ErrCodeServiceUnavailable,
+	codes.Unauthenticated:    types.ErrCodeUnauthorized,
+}
+
+// Code returns the gRPC code for an error code, Internal for unknown codes
+func Code(code types.ErrorCode) codes.Code {
+	if grpcCode, ok := errorCodeGRPC[code]; ok {
+		return grpcCode
+	}
+	return codes.Internal
+}
+
+// ToStatus converts err into a gRPC status. Errors that already carry a
+// status keep it, context errors become Canceled or DeadlineExceeded, and
+// everything else goes through types.AsAPIError, so internal details never
+// reach clients. The status carries an ErrorInfo with the error code, HTTP
+// status and correlation ID, and a BadRequest listing any field errors.
+func ToStatus(err error) *status.Status {
+	if err == nil {
+		return status.New(codes.OK, "")
+	}
+	var apiErr *types.APIError
+	if !errors.As(err, &apiErr) {
+		var grpcErr interface{ GRPCStatus() *status.Status }
+		if errors.As(err, &grpcErr) {
+			return grpcErr.GRPCStatus()
+		}
+		switch {
+		case errors.Is(err, context.Canceled):
+			return status.New(codes.Canceled, context.Canceled.Error())
+		case errors.Is(err, context.DeadlineExceeded):
+			return status.New(codes.DeadlineExceeded, context.DeadlineExceeded.Error())
+		}
+		apiErr = types.AsAPIError(err)
+	}
+
+	info := &errdetails.ErrorInfo{
+		Reason:   string(apiErr.Code),
+		Domain:   ErrorDomain,
+		Metadata: map[string]string{"http_status": strconv.Itoa(apiErr.HTTPStatus())},
+	}
+	if apiErr.CorrelationID != "" {
+		info.Metadata["correlation_id"] = apiErr.CorrelationID
+	}
+	details := []*errdetails.BadRequest_FieldViolation{}
+	for _, field := range apiErr.Fields {
+		details = append(details, &errdetails.BadRequest_FieldViolation{Field: field.Field, Description: field.Message})
+		if field.Code != "" {
+			info.Metadata[fieldCodePrefix+field.Field] = field.Code
+		}
+	}
+
+	st := status.New(Code(apiErr.Code), apiErr.Message)
+	withDetails, detailErr := st.WithDetails(info)
+	if detailErr != nil {
+		return st
+	}
+	if len(details) > 0 {
+		if withFields, detailErr := withDetails.WithDetails(&errdetails.BadRequest{FieldViolations: details}); detailErr == nil {
+			withDetails = withFields
+		}
+	}
+	return withDetails
+}
+
+// ToError is ToStatus returning an error, nil when err is nil
+func ToError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return ToStatus(err).Err()
+}
+
+// FromStatus converts a gRPC status back into an APIError. Statuses written
+// by ToStatus round-trip exactly; others are mapped by their gRPC code.
+// A nil or OK status returns nil.
+func FromStatus(st *status.Status) *types.APIError {
+	if st == nil || st.Code() == codes.OK {
+		return nil
+	}
+
+	var apiErr *types.APIError
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			if detail.GetDomain() != ErrorDomain {
+				continue
+			}
+			apiErr = types.NewAPIError(types.ErrorCode(detail.GetReason()), st.Message())
+			metadata := detail.GetMetadata()
+			if httpStatus, err := strconv.Atoi(metadata["http_status"]); err == nil {
+				apiErr.Status = httpStatus
+			}
+			apiErr.CorrelationID = metadata["correlation_id"]
+		case *errdetails.BadRequest:
+			violations = detail.GetFieldViolations()
+		}
+	}
+	if apiErr == nil {
+		code, ok := grpcErrorCode[st.Code()]
+		switch {
+		case !ok:
+			apiErr = types.NewInternalError(st.Err())
+		case code == types.ErrCodeBadRequest && len(violations) > 0:
+			apiErr = types.NewAPIError(types.ErrCodeValidationFailed, st.Message())
+		default:
+			apiErr = types.NewAPIError(code, st.Message())
+		}
+	}
+
+	fieldCodes := fieldCodes(st)
+	for _, violation := range violations {
+		apiErr.WithField(violation.GetField(), fieldCodes[violation.GetField()], violation.GetDescription())
+	}
+	return apiErr
+}
+
+// fieldCodes returns the field error codes ToStatus recorded in st
+func fieldCodes(st *status.Status) map[string]string {
+	fieldCodes := map[string]string{}
+	for _, detail := range st.Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if !ok || info.GetDomain() != ErrorDomain {
+			continue
+		}
+		for key, value := range info.GetMetadata() {
+			if field, ok := strings.CutPrefix(key, fieldCodePrefix); ok {
+				fieldCodes[field] = value
+			}
+		}
+	}
+	return fieldCodes
+}
+
+// FromError converts an error returned by a gRPC call into an APIError.
+// Errors without a status are treated like types.AsAPIError treats them.
+func FromError(err error) *types.APIError {
+	if err == nil {
+		return nil
+	}
+	var apiErr *types.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return types.AsAPIError(err)
+	}
+	return FromStatus(st).WithCause(err)
+}
+
+// HTTPStatus returns the HTTP status REST handlers would respond with for
+// a gRPC code, using the same table as the error codes
+func HTTPStatus(code codes.Code) int {
+	if code == codes.OK {
+		return http.StatusOK
+	}
+	if errCode, ok := grpcErrorCode[code]; ok {
+		return errCode.Status()
+	}
+	return http.StatusInternalServerError
+}
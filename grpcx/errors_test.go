@@ -0,0 +1,116 @@
+package grpcx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestToStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		code    codes.Code
+		message string
+	}{
+		{"nil", nil, codes.OK, ""},
+		{"not found", types.NewNotFoundError("Device"), codes.NotFound, "Device not found"},
+		{"wrapped", fmt.Errorf("loading device: %w", types.NewAPIError(types.ErrCodeCodeExpired, "Code has expired")), codes.FailedPrecondition, "Code has expired"},
+		{"quota", types.NewAPIError(types.ErrCodeQuotaExceeded, "Monthly quota reached"), codes.ResourceExhausted, "Monthly quota reached"},
+		{"challenge", types.NewAPIError(types.ErrCodeChallengeRequired, "Complete the challenge"), codes.FailedPrecondition, "Complete the challenge"},
+		{"plain errors are hidden", errors.New("pq: connection refused"), codes.Internal, "An internal error occurred"},
+		{"existing status", status.Error(codes.Aborted, "try again"), codes.Aborted, "try again"},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), codes.DeadlineExceeded, "context deadline exceeded"},
+		{"canceled", context.Canceled, codes.Canceled, "context canceled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := ToStatus(tt.err)
+			assert.Equal(t, tt.code, st.Code())
+			assert.Equal(t, tt.message, st.Message())
+		})
+	}
+	assert.NoError(t, ToError(nil))
+}
+
+func TestToStatusDetails(t *testing.T) {
+	apiErr := types.NewValidationError(types.FieldError{Field: "email", Code: "invalid_format", Message: "Email is invalid"}).
+		WithCorrelationID("corr-1")
+
+	st := ToStatus(apiErr)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 2)
+
+	info := st.Details()[0].(*errdetails.ErrorInfo)
+	assert.Equal(t, "validation_failed", info.GetReason())
+	assert.Equal(t, ErrorDomain, info.GetDomain())
+	assert.Equal(t, "422", info.GetMetadata()["http_status"])
+	assert.Equal(t, "corr-1", info.GetMetadata()["correlation_id"])
+
+	badRequest := st.Details()[1].(*errdetails.BadRequest)
+	require.Len(t, badRequest.GetFieldViolations(), 1)
+	assert.Equal(t, "email", badRequest.GetFieldViolations()[0].GetField())
+	assert.Equal(t, "Email is invalid", badRequest.GetFieldViolations()[0].GetDescription())
+}
+
+func TestStatusRoundTrip(t *testing.T) {
+	for _, apiErr := range []*types.APIError{
+		types.NewNotFoundError("Device").WithCorrelationID("corr-1"),
+		types.NewAPIError(types.ErrCodeInvalidToken, "Token has expired"),
+		types.NewAPIError(types.ErrCodeCodeUsed, "Code already used"),
+		types.NewValidationError(
+			types.FieldError{Field: "email", Code: "required", Message: "Email is required"},
+			types.FieldError{Field: "phone", Code: "invalid_format", Message: "Phone is invalid"},
+		),
+		{Code: types.ErrCodeBadRequest, Status: http.StatusMethodNotAllowed, Message: "Method not allowed"},
+	} {
+		t.Run(string(apiErr.Code), func(t *testing.T) {
+			got := FromError(ToError(apiErr))
+			assert.Equal(t, apiErr.Code, got.Code)
+			assert.Equal(t, apiErr.HTTPStatus(), got.HTTPStatus())
+			assert.Equal(t, apiErr.Message, got.Message)
+			assert.Equal(t, apiErr.Fields, got.Fields)
+			assert.Equal(t, apiErr.CorrelationID, got.CorrelationID)
+			assert.Error(t, got.Cause, "the status error is kept for logging")
+		})
+	}
+}
+
+func TestFromStatusForeignServices(t *testing.T) {
+	apiErr := FromError(status.Error(codes.Unavailable, "connection refused"))
+	assert.Equal(t, types.ErrCodeServiceUnavailable, apiErr.Code)
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.HTTPStatus())
+
+	apiErr = FromError(status.Error(codes.DataLoss, "disk corrupted"))
+	assert.Equal(t, types.ErrCodeInternal, apiErr.Code)
+	assert.Equal(t, "An internal error occurred", apiErr.Message, "unknown failures aren't exposed")
+
+	st, err := status.New(codes.InvalidArgument, "bad request").WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "name", Description: "too long"}},
+	})
+	require.NoError(t, err)
+	apiErr = FromStatus(st)
+	assert.Equal(t, types.ErrCodeValidationFailed, apiErr.Code)
+	assert.Equal(t, []types.FieldError{{Field: "name", Message: "too long"}}, apiErr.Fields)
+
+	assert.Nil(t, FromStatus(status.New(codes.OK, "")))
+	assert.Nil(t, FromError(nil))
+	assert.Equal(t, types.ErrCodeInternal, FromError(errors.New("boom")).Code)
+}
+
+func TestHTTPStatus(t *testing.T) {
+	assert.Equal(t, http.StatusOK, HTTPStatus(codes.OK))
+	assert.Equal(t, http.StatusNotFound, HTTPStatus(codes.NotFound))
+	assert.Equal(t, http.StatusTooManyRequests, HTTPStatus(codes.ResourceExhausted))
+	assert.Equal(t, http.StatusGatewayTimeout, HTTPStatus(codes.DeadlineExceeded))
+	assert.Equal(t, http.StatusInternalServerError, HTTPStatus(codes.DataLoss))
+}
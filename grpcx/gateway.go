@@ -0,0 +1,144 @@
+package grpcx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// correlationHeaders are forwarded between HTTP and gRPC under their own names
+var correlationHeaders = []string{
+	middleware.CorrelationIDHeader,
+	middleware.RequestIDHeader,
+	middleware.TraceIDHeader,
+	middleware.SpanIDHeader,
+}
+
+// ServeMuxOptions returns grpc-gateway options that make a gateway behave
+// like our REST handlers: responses are wrapped as types.APIResponse, errors
+// are rendered as types.APIError with the same status codes, and correlation
+// IDs are passed to the gRPC server and back.
+//
+//	mux := runtime.NewServeMux(grpcx.ServeMuxOptions()...)
+func ServeMuxOptions() []runtime.ServeMuxOption {
+	return []runtime.ServeMuxOption{
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, NewMarshaler()),
+		runtime.WithErrorHandler(ErrorHandler),
+		runtime.WithRoutingErrorHandler(RoutingErrorHandler),
+		runtime.WithMetadata(forwardCorrelation),
+		runtime.WithOutgoingHeaderMatcher(outgoingHeader),
+	}
+}
+
+// Marshaler wraps successful gateway responses in types.APIResponse
+type Marshaler struct {
+	runtime.Marshaler
+}
+
+// NewMarshaler returns a Marshaler that writes snake_case field names and
+// includes zero values, so responses match the JSON our REST handlers write
+func NewMarshaler() *Marshaler {
+	return &Marshaler{Marshaler: &runtime.JSONPb{
+		MarshalOptions: protojson.MarshalOptions{
+			UseProtoNames:   true,
+			EmitUnpopulated: true,
+		},
+		UnmarshalOptions: protojson.UnmarshalOptions{
+			DiscardUnknown: true,
+		},
+	}}
+}
+
+// Marshal encodes v and wraps it as the data of a successful APIResponse
+func (m *Marshaler) Marshal(v interface{}) ([]byte, error) {
+	data, err := m.Marshaler.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(types.APIResponseT[json.RawMessage]{Success: true, Data: data})
+}
+
+// ErrorHandler renders gateway errors with middleware.RenderError. Statuses
+// from our own services carry the original APIError; others are mapped by
+// their gRPC code.
+func ErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	httpStatus := 0
+	var customStatus *runtime.HTTPStatusError
+	if errors.As(err, &customStatus) {
+		err = customStatus.Err
+		httpStatus = customStatus.HTTPStatus
+	}
+
+	apiErr := *FromError(err)
+	if httpStatus != 0 {
+		apiErr.Status = httpStatus
+	}
+	if apiErr.CorrelationID == "" {
+		if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+			if values := md.HeaderMD.Get(middleware.CorrelationIDHeader); len(values) > 0 {
+				apiErr.CorrelationID = values[0]
+			}
+		}
+	}
+	middleware.RenderError(w, r, &apiErr)
+}
+
+// RoutingErrorHandler renders requests the gateway has no route for as
+// APIErrors, keeping 405 Method Not Allowed rather than the gateway's
+// Unimplemented status
+func RoutingErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, httpStatus int) {
+	switch httpStatus {
+	case http.StatusNotFound:
+		middleware.RenderError(w, r, types.NewAPIError(types.ErrCodeNotFound, "Route not found"))
+	case http.StatusMethodNotAllowed:
+		apiErr := types.NewAPIError(types.ErrCodeBadRequest, "Method not allowed")
+		apiErr.Status = http.StatusMethodNotAllowed
+		middleware.RenderError(w, r, apiErr)
+	default:
+		apiErr := types.NewBadRequestError(http.StatusText(httpStatus))
+		apiErr.Status = httpStatus
+		middleware.RenderError(w, r, apiErr)
+	}
+}
+
+// forwardCorrelation sends the request's correlation IDs to the gRPC
+// server, preferring those set by middleware.CorrelationMiddleware
+func forwardCorrelation(ctx context.Context, r *http.Request) metadata.MD {
+	md := metadata.MD{}
+	values := map[string]string{}
+	if corrCtx := middleware.GetCorrelationContext(r.Context()); corrCtx != nil {
+		values[middleware.CorrelationIDHeader] = corrCtx.CorrelationID
+		values[middleware.RequestIDHeader] = corrCtx.RequestID
+		values[middleware.TraceIDHeader] = corrCtx.TraceID
+		values[middleware.SpanIDHeader] = corrCtx.SpanID
+	}
+	for _, header := range correlationHeaders {
+		value := values[header]
+		if value == "" {
+			value = r.Header.Get(header)
+		}
+		if value != "" {
+			md.Set(header, value)
+		}
+	}
+	return md
+}
+
+// outgoingHeader returns the correlation headers the gRPC server sent under
+// their own names and everything else the default way
+func outgoingHeader(key string) (string, bool) {
+	for _, header := range correlationHeaders {
+		if strings.EqualFold(key, header) {
+			return header, true
+		}
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
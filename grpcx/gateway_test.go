@@ -0,0 +1,116 @@
+package grpcx
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestMarshalerWrapsResponses(t *testing.T) {
+	mux := runtime.NewServeMux(ServeMuxOptions()...)
+	r := httptest.NewRequest(http.MethodGet, "/v1/devices/1", nil)
+	_, marshaler := runtime.MarshalerForRequest(mux, r)
+
+	message, err := structpb.NewStruct(map[string]interface{}{"device_id": "1", "trusted": false})
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	runtime.ForwardResponseMessage(context.Background(), mux, marshaler, recorder, r, message)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"success":true,"message":"","data":{"device_id":"1","trusted":false}}`, recorder.Body.String())
+
+	var decoded structpb.Struct
+	require.NoError(t, marshaler.Unmarshal([]byte(`{"name":"Pixel","unknown":1}`), &decoded))
+	assert.Equal(t, "Pixel", decoded.Fields["name"].GetStringValue())
+}
+
+func TestErrorHandlerMatchesRenderError(t *testing.T) {
+	mux := runtime.NewServeMux(ServeMuxOptions()...)
+	apiErr := types.NewValidationError(types.FieldError{Field: "email", Code: "required", Message: "Email is required"}).
+		WithCorrelationID("corr-1")
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/devices", nil)
+	_, marshaler := runtime.MarshalerForRequest(mux, r)
+	gateway := httptest.NewRecorder()
+	runtime.HTTPError(context.Background(), mux, marshaler, gateway, r, ToError(apiErr))
+
+	rest := httptest.NewRecorder()
+	middleware.RenderError(rest, r, apiErr)
+
+	assert.Equal(t, rest.Code, gateway.Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, gateway.Code)
+	assert.JSONEq(t, rest.Body.String(), gateway.Body.String())
+}
+
+func TestErrorHandlerCorrelationID(t *testing.T) {
+	mux := runtime.NewServeMux(ServeMuxOptions()...)
+	r := httptest.NewRequest(http.MethodGet, "/v1/devices/1", nil)
+	_, marshaler := runtime.MarshalerForRequest(mux, r)
+
+	// The server's correlation ID header is used when the status has none
+	ctx := runtime.NewServerMetadataContext(context.Background(), runtime.ServerMetadata{
+		HeaderMD: metadata.Pairs("x-correlation-id", "corr-2"),
+	})
+	recorder := httptest.NewRecorder()
+	runtime.HTTPError(ctx, mux, marshaler, recorder, r, status.Error(codes.Unavailable, "connection refused"))
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, false, body["success"])
+	assert.Equal(t, "service_unavailable", body["error"])
+	assert.Equal(t, "corr-2", body["correlation_id"])
+
+	// Custom HTTP statuses are kept
+	recorder = httptest.NewRecorder()
+	runtime.HTTPError(ctx, mux, marshaler, recorder, r, &runtime.HTTPStatusError{
+		HTTPStatus: http.StatusPaymentRequired,
+		Err:        ToError(types.NewAPIError(types.ErrCodeQuotaExceeded, "Upgrade your plan")),
+	})
+	assert.Equal(t, http.StatusPaymentRequired, recorder.Code)
+}
+
+func TestRoutingErrorHandler(t *testing.T) {
+	mux := runtime.NewServeMux(ServeMuxOptions()...)
+	require.NoError(t, mux.HandlePath(http.MethodGet, "/v1/devices/{id}", func(w http.ResponseWriter, r *http.Request, params map[string]string) {}))
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"error":"not_found"`)
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/v1/devices/1", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestForwardCorrelation(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(middleware.TraceIDHeader, "trace-1")
+	r = r.WithContext(middleware.WithCorrelationContext(r.Context(), "corr-1", "req-1", "", ""))
+
+	md := forwardCorrelation(r.Context(), r)
+	assert.Equal(t, []string{"corr-1"}, md.Get("x-correlation-id"))
+	assert.Equal(t, []string{"req-1"}, md.Get("x-request-id"))
+	assert.Equal(t, []string{"trace-1"}, md.Get("x-trace-id"))
+	assert.Empty(t, md.Get("x-span-id"))
+
+	header, ok := outgoingHeader("x-correlation-id")
+	assert.True(t, ok)
+	assert.Equal(t, middleware.CorrelationIDHeader, header)
+	header, _ = outgoingHeader("x-tenant")
+	assert.Equal(t, "Grpc-Metadata-x-tenant", header)
+}
@@ -0,0 +1,141 @@
+package grpcx
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor gives each call a correlation context, like
+// middleware.CorrelationMiddleware does for HTTP, and converts returned
+// errors with ToStatus so handlers can return APIErrors
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = incomingCorrelation(ctx)
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return nil, ToError(withCorrelationID(ctx, err))
+		}
+		return resp, nil
+	}
+}
+
+// StreamServerInterceptor is the streaming version of UnaryServerInterceptor
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := incomingCorrelation(stream.Context())
+		err := handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+		if err != nil {
+			return ToError(withCorrelationID(ctx, err))
+		}
+		return nil
+	}
+}
+
+// UnaryClientInterceptor sends the caller's correlation headers as outgoing
+// metadata and converts failed calls into APIErrors with FromError, so the
+// error can be passed straight to middleware.RenderError
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := invoker(outgoingCorrelation(ctx), method, req, reply, cc, opts...); err != nil {
+			return FromError(err)
+		}
+		return nil
+	}
+}
+
+// contextStream overrides the context of a server stream
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// incomingCorrelation returns ctx with a correlation context built from the
+// incoming metadata, generating IDs that are missing, and sends the IDs back
+// as response headers
+func incomingCorrelation(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(header string) string {
+		if values := md.Get(header); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	correlationID := get(middleware.CorrelationIDHeader)
+	requestID := get(middleware.RequestIDHeader)
+	traceID := get(middleware.TraceIDHeader)
+	if correlationID == "" {
+		correlationID = requestID
+	}
+	if correlationID == "" {
+		correlationID = traceID
+	}
+	if correlationID == "" {
+		correlationID = uuid.New().String()
+	}
+	if requestID == "" {
+		requestID = uuid.New().String()
+	}
+
+	// SetHeader fails outside a real server call, which only matters in tests
+	grpc.SetHeader(ctx, metadata.Pairs(
+		strings.ToLower(middleware.CorrelationIDHeader), correlationID,
+		strings.ToLower(middleware.RequestIDHeader), requestID,
+	))
+	return middleware.WithCorrelationContext(ctx, correlationID, requestID, traceID, get(middleware.SpanIDHeader))
+}
+
+// outgoingCorrelation returns ctx with the correlation IDs appended to the
+// outgoing metadata
+func outgoingCorrelation(ctx context.Context) context.Context {
+	corrCtx := middleware.GetCorrelationContext(ctx)
+	if corrCtx == nil {
+		return ctx
+	}
+	pairs := []string{}
+	for header, value := range map[string]string{
+		middleware.CorrelationIDHeader: corrCtx.CorrelationID,
+		middleware.RequestIDHeader:     corrCtx.RequestID,
+		middleware.TraceIDHeader:       corrCtx.TraceID,
+		middleware.SpanIDHeader:        corrCtx.SpanID,
+	} {
+		if value != "" {
+			pairs = append(pairs, strings.ToLower(header), value)
+		}
+	}
+	if len(pairs) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, pairs...)
+}
+
+// withCorrelationID converts err the way ToStatus would and fills in the
+// correlation ID, without modifying an APIError the handler may reuse
+func withCorrelationID(ctx context.Context, err error) error {
+	var apiErr *types.APIError
+	if !errors.As(err, &apiErr) {
+		var grpcErr interface{ GRPCStatus() *status.Status }
+		if errors.As(err, &grpcErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+		apiErr = types.AsAPIError(err)
+	}
+	if apiErr.CorrelationID != "" {
+		return apiErr
+	}
+	copied := *apiErr
+	copied.CorrelationID = middleware.GetCorrelationID(ctx)
+	return &copied
+}
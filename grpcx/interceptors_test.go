@@ -0,0 +1,91 @@
+package grpcx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/devices.v1.Devices/Get"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-correlation-id", "corr-1"))
+
+	notFound := types.NewNotFoundError("Device")
+	_, err := interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		assert.Equal(t, "corr-1", middleware.GetCorrelationID(ctx))
+		assert.NotEmpty(t, middleware.GetRequestID(ctx))
+		return nil, notFound
+	})
+	st := status.Convert(err)
+	assert.Equal(t, codes.NotFound, st.Code())
+	assert.Equal(t, "corr-1", FromStatus(st).CorrelationID)
+	assert.Empty(t, notFound.CorrelationID, "the handler's error isn't modified")
+
+	_, err = interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errors.New("pq: connection refused")
+	})
+	apiErr := FromError(err)
+	assert.Equal(t, types.ErrCodeInternal, apiErr.Code)
+	assert.Equal(t, "corr-1", apiErr.CorrelationID)
+
+	resp, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		assert.NotEmpty(t, middleware.GetCorrelationID(ctx), "missing IDs are generated")
+		return "ok", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+}
+
+// testServerStream is a server stream with a fixed context
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "req-1"))
+	err := StreamServerInterceptor()(nil, &testServerStream{ctx: ctx}, &grpc.StreamServerInfo{}, func(srv interface{}, stream grpc.ServerStream) error {
+		assert.Equal(t, "req-1", middleware.GetCorrelationID(stream.Context()), "the request ID is the fallback")
+		return types.NewForbiddenError("Not your device")
+	})
+	apiErr := FromError(err)
+	assert.Equal(t, types.ErrCodeForbidden, apiErr.Code)
+	assert.Equal(t, "req-1", apiErr.CorrelationID)
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	ctx := middleware.WithCorrelationContext(context.Background(), "corr-1", "req-1", "", "")
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		assert.Equal(t, []string{"corr-1"}, md.Get("x-correlation-id"))
+		assert.Equal(t, []string{"req-1"}, md.Get("x-request-id"))
+		assert.Empty(t, md.Get("x-trace-id"))
+		return ToError(types.NewAPIError(types.ErrCodeRateLimited, "Slow down"))
+	}
+
+	err := UnaryClientInterceptor()(ctx, "/devices.v1.Devices/Get", nil, nil, nil, invoker)
+	var apiErr *types.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, types.ErrCodeRateLimited, apiErr.Code)
+	assert.Equal(t, "Slow down", apiErr.Message)
+
+	err = UnaryClientInterceptor()(context.Background(), "/devices.v1.Devices/Get", nil, nil, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return nil
+		})
+	assert.NoError(t, err)
+}
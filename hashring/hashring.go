@@ -0,0 +1,209 @@
+// Package hashring assigns keys to nodes or shards so services spreading
+// work or cache keys across replicas, such as per-organization background
+// processors, agree on the owner of every key without ad-hoc modulo logic.
+// A Ring maps keys to named nodes and moves few keys when nodes join or
+// leave; JumpHash maps keys to numbered shards with no state at all.
+package hashring
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Hash hashes a key to a point on the ring
+type Hash func(key []byte) uint64
+
+// DefaultHash is FNV-1a followed by a mixing step, so similar keys such as
+// "node-1#1" and "node-1#2" land far apart
+func DefaultHash(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return mix(h.Sum64())
+}
+
+// mix is the splitmix64 finalizer
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Config holds the configuration for a Ring
+type Config struct {
+	// VirtualNodes is the number of points each node of weight 1 gets on
+	// the ring. More points spread keys more evenly.
+	VirtualNodes int `json:"virtual_nodes"`
+
+	Hash Hash `json:"-"` // nil uses DefaultHash
+}
+
+// DefaultConfig returns a configuration with 160 virtual nodes per node
+func DefaultConfig() *Config {
+	return &Config{
+		VirtualNodes: 160,
+	}
+}
+
+// point is one virtual node
+type point struct {
+	hash uint64
+	node string
+}
+
+// Ring is a consistent hash ring with virtual nodes. Adding or removing a
+// node only moves the keys that node gains or loses. It is safe for
+// concurrent use.
+type Ring struct {
+	config  *Config
+	hash    Hash
+	weights map[string]int
+	points  []point
+	mutex   sync.RWMutex
+}
+
+// New creates a ring with the given nodes, each of weight 1
+func New(config *Config, nodes ...string) *Ring {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	hash := config.Hash
+	if hash == nil {
+		hash = DefaultHash
+	}
+	r := &Ring{config: config, hash: hash, weights: make(map[string]int)}
+	r.Add(nodes...)
+	return r
+}
+
+// Add adds nodes of weight 1. Nodes already on the ring keep their weight.
+func (r *Ring) Add(nodes ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, node := range nodes {
+		if _, ok := r.weights[node]; !ok {
+			r.weights[node] = 1
+		}
+	}
+	r.rebuild()
+}
+
+// AddWeighted adds a node, or changes its weight, so it owns a share of the
+// keys proportional to weight
+func (r *Ring) AddWeighted(node string, weight int) error {
+	if weight <= 0 {
+		return fmt.Errorf("weight of node %q must be positive, got %d", node, weight)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.weights[node] = weight
+	r.rebuild()
+	return nil
+}
+
+// Remove removes nodes; their keys move to the nodes that follow them
+func (r *Ring) Remove(nodes ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, node := range nodes {
+		delete(r.weights, node)
+	}
+	r.rebuild()
+}
+
+// Set replaces the nodes with the given ones, e.g. from service discovery,
+// keeping the weights of nodes that stay
+func (r *Ring) Set(nodes ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	weights := make(map[string]int, len(nodes))
+	for _, node := range nodes {
+		if weight, ok := r.weights[node]; ok {
+			weights[node] = weight
+		} else {
+			weights[node] = 1
+		}
+	}
+	r.weights = weights
+	r.rebuild()
+}
+
+// rebuild recomputes the points from the weights. Callers hold the write lock.
+func (r *Ring) rebuild() {
+	virtualNodes := r.config.VirtualNodes
+	if virtualNodes <= 0 {
+		virtualNodes = DefaultConfig().VirtualNodes
+	}
+
+	points := make([]point, 0, len(r.weights)*virtualNodes)
+	for node, weight := range r.weights {
+		for i := 0; i < virtualNodes*weight; i++ {
+			points = append(points, point{hash: r.hash([]byte(node + "#" + strconv.Itoa(i))), node: node})
+		}
+	}
+	// Ties are broken by node name so every instance builds the same ring
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].hash != points[j].hash {
+			return points[i].hash < points[j].hash
+		}
+		return points[i].node < points[j].node
+	})
+	r.points = points
+}
+
+// Nodes returns the nodes on the ring, sorted
+func (r *Ring) Nodes() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	nodes := make([]string, 0, len(r.weights))
+	for node := range r.weights {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// Get returns the node that owns key, or "" when the ring is empty
+func (r *Ring) Get(key string) string {
+	nodes := r.GetN(key, 1)
+	if len(nodes) == 0 {
+		return ""
+	}
+	return nodes[0]
+}
+
+// GetN returns up to n distinct nodes for key, owner first, for keys kept
+// on more than one node
+func (r *Ring) GetN(key string, n int) []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if len(r.points) == 0 || n <= 0 {
+		return nil
+	}
+	n = min(n, len(r.weights))
+
+	hash := r.hash([]byte(key))
+	start := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= hash })
+
+	nodes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; len(nodes) < n && i < len(r.points); i++ {
+		node := r.points[(start+i)%len(r.points)].node
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// Owns reports whether node owns key
+func (r *Ring) Owns(node, key string) bool {
+	return r.Get(key) == node
+}
@@ -0,0 +1,122 @@
+package hashring
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// orgIDs returns n test keys
+func orgIDs(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("org-%d", i)
+	}
+	return keys
+}
+
+func TestRingDistribution(t *testing.T) {
+	ring := New(nil, "worker-0", "worker-1", "worker-2", "worker-3")
+	counts := make(map[string]int)
+	for _, key := range orgIDs(40000) {
+		counts[ring.Get(key)]++
+	}
+
+	require.Len(t, counts, 4)
+	for node, count := range counts {
+		assert.InDelta(t, 10000, count, 1500, "node %s owns %d keys", node, count)
+	}
+}
+
+func TestRingMovesFewKeys(t *testing.T) {
+	ring := New(nil, "worker-0", "worker-1", "worker-2", "worker-3")
+	keys := orgIDs(10000)
+	before := make(map[string]string, len(keys))
+	for _, key := range keys {
+		before[key] = ring.Get(key)
+	}
+
+	// A new node only takes keys; nothing moves between existing nodes
+	ring.Add("worker-4")
+	moved := 0
+	for _, key := range keys {
+		if owner := ring.Get(key); owner != before[key] {
+			assert.Equal(t, "worker-4", owner)
+			moved++
+		}
+	}
+	assert.InDelta(t, 2000, moved, 500)
+
+	// Removing it gives those keys back
+	ring.Remove("worker-4")
+	for _, key := range keys {
+		assert.Equal(t, before[key], ring.Get(key))
+	}
+}
+
+func TestRingIsDeterministic(t *testing.T) {
+	a := New(nil, "b", "a", "c")
+	b := New(nil)
+	b.Set("c", "a", "b")
+	for _, key := range orgIDs(1000) {
+		assert.Equal(t, a.Get(key), b.Get(key))
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, b.Nodes())
+}
+
+func TestRingGetN(t *testing.T) {
+	ring := New(&Config{VirtualNodes: 50}, "cache-0", "cache-1", "cache-2")
+
+	nodes := ring.GetN("org-1", 2)
+	require.Len(t, nodes, 2)
+	assert.NotEqual(t, nodes[0], nodes[1])
+	assert.Equal(t, ring.Get("org-1"), nodes[0])
+	assert.True(t, ring.Owns(nodes[0], "org-1"))
+
+	assert.Len(t, ring.GetN("org-1", 10), 3, "never more nodes than the ring has")
+	assert.Nil(t, ring.GetN("org-1", 0))
+	assert.Empty(t, New(nil).Get("org-1"))
+}
+
+func TestRingWeights(t *testing.T) {
+	ring := New(nil, "small")
+	require.NoError(t, ring.AddWeighted("large", 3))
+	assert.Error(t, ring.AddWeighted("broken", 0))
+
+	counts := make(map[string]int)
+	for _, key := range orgIDs(20000) {
+		counts[ring.Get(key)]++
+	}
+	assert.InDelta(t, 15000, counts["large"], 1500)
+
+	// Set keeps the weight of nodes that stay
+	ring.Set("large", "small", "new")
+	counts = make(map[string]int)
+	for _, key := range orgIDs(20000) {
+		counts[ring.Get(key)]++
+	}
+	assert.InDelta(t, 12000, counts["large"], 1500)
+}
+
+func TestRingConcurrentUse(t *testing.T) {
+	ring := New(nil, "worker-0", "worker-1")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			ring.Add(fmt.Sprintf("worker-%d", i+2))
+		}(i)
+		go func() {
+			defer wg.Done()
+			for _, key := range orgIDs(100) {
+				assert.NotEmpty(t, ring.Get(key))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, ring.Nodes(), 6)
+}
@@ -0,0 +1,32 @@
+package hashring
+
+// JumpHash maps key to a shard in [0, shards) with Lamping and Veach's jump
+// consistent hash. Growing from n to n+1 shards only moves keys to the new
+// shard, and only 1/(n+1) of them. Shards are numbered, so it suits a fixed
+// set of replicas such as a StatefulSet's ordinals; use a Ring for named
+// nodes that come and go in any order. It returns -1 when shards < 1.
+func JumpHash(key uint64, shards int) int {
+	if shards < 1 {
+		return -1
+	}
+	var b, j int64 = -1, 0
+	for j < int64(shards) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// Shard maps a string key, such as an organization ID, to a shard in
+// [0, shards) using DefaultHash and JumpHash
+func Shard(key string, shards int) int {
+	return JumpHash(DefaultHash([]byte(key)), shards)
+}
+
+// OwnsShard reports whether the replica with the given index, of count
+// replicas, owns key. A per-organization processor running as replica 2 of
+// 5 handles the organizations for which OwnsShard(orgID, 2, 5) is true.
+func OwnsShard(key string, index, count int) bool {
+	return Shard(key, count) == index
+}
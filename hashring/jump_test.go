@@ -0,0 +1,47 @@
+package hashring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJumpHashRange(t *testing.T) {
+	assert.Equal(t, -1, JumpHash(42, 0))
+	assert.Equal(t, 0, JumpHash(42, 1))
+
+	counts := make([]int, 8)
+	for _, key := range orgIDs(40000) {
+		shard := Shard(key, 8)
+		assert.True(t, shard >= 0 && shard < 8)
+		counts[shard]++
+	}
+	for shard, count := range counts {
+		assert.InDelta(t, 5000, count, 500, "shard %d has %d keys", shard, count)
+	}
+}
+
+func TestJumpHashGrowth(t *testing.T) {
+	// Growing the shard count only moves keys to the new shard
+	moved := 0
+	for _, key := range orgIDs(10000) {
+		before, after := Shard(key, 9), Shard(key, 10)
+		if before != after {
+			assert.Equal(t, 9, after)
+			moved++
+		}
+	}
+	assert.InDelta(t, 1000, moved, 200)
+}
+
+func TestOwnsShard(t *testing.T) {
+	for _, key := range orgIDs(100) {
+		owners := 0
+		for index := 0; index < 5; index++ {
+			if OwnsShard(key, index, 5) {
+				owners++
+			}
+		}
+		assert.Equal(t, 1, owners, "key %s should have exactly one owner", key)
+	}
+}
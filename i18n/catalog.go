@@ -0,0 +1,158 @@
+// Package i18n negotiates the locale of a request and localizes the
+// messages services send to clients. Catalogs are keyed by the English
+// source message, so existing messages are translated without changing
+// call sites, with "error.<code>" and "field.<code>" keys as fallbacks for
+// messages that include values.
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
+)
+
+// Catalog holds the translated messages of every supported locale
+type Catalog struct {
+	fallback language.Tag
+	messages map[language.Tag]map[string]string
+	tags     []language.Tag
+	matcher  language.Matcher
+	mutex    sync.RWMutex
+}
+
+// NewCatalog creates a catalog whose source messages are in the fallback
+// locale, typically language.English
+func NewCatalog(fallback language.Tag) *Catalog {
+	c := &Catalog{
+		fallback: fallback,
+		messages: map[language.Tag]map[string]string{fallback: {}},
+	}
+	c.rebuild()
+	return c
+}
+
+// rebuild refreshes the supported tags and matcher, fallback first so it
+// wins when nothing matches. Callers hold the write lock.
+func (c *Catalog) rebuild() {
+	c.tags = []language.Tag{c.fallback}
+	for tag := range c.messages {
+		if tag != c.fallback {
+			c.tags = append(c.tags, tag)
+		}
+	}
+	c.matcher = language.NewMatcher(c.tags)
+}
+
+// Add adds messages for a locale, replacing existing translations of the
+// same keys
+func (c *Catalog) Add(tag language.Tag, messages map[string]string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	existing, ok := c.messages[tag]
+	if !ok {
+		existing = make(map[string]string, len(messages))
+		c.messages[tag] = existing
+	}
+	for key, message := range messages {
+		existing[key] = message
+	}
+	if !ok {
+		c.rebuild()
+	}
+}
+
+// LoadFS adds every <locale>.json file in dir, e.g. "locales/es.json" or
+// "locales/pt-BR.json", each a JSON object of key to message. It works with
+// embed.FS for catalogs compiled into the service.
+func (c *Catalog) LoadFS(fsys fs.FS, dir string) error {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("failed to list message catalogs: %w", err)
+	}
+	for _, file := range files {
+		tag, err := language.Parse(strings.TrimSuffix(path.Base(file), ".json"))
+		if err != nil {
+			return fmt.Errorf("message catalog %s: invalid locale: %w", file, err)
+		}
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("failed to read message catalog %s: %w", file, err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("message catalog %s: %w", file, err)
+		}
+		c.Add(tag, messages)
+	}
+	return nil
+}
+
+// Fallback returns the locale of the source messages
+func (c *Catalog) Fallback() language.Tag {
+	return c.fallback
+}
+
+// Supported returns the locales with messages, fallback first
+func (c *Catalog) Supported() []language.Tag {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return append([]language.Tag(nil), c.tags...)
+}
+
+// Match returns the supported locale that best matches the preferred
+// locales, or the fallback when none does
+func (c *Catalog) Match(preferred ...language.Tag) language.Tag {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	_, index, confidence := c.matcher.Match(preferred...)
+	if confidence == language.No {
+		return c.fallback
+	}
+	return c.tags[index]
+}
+
+// MatchAcceptLanguage returns the supported locale that best matches an
+// Accept-Language header
+func (c *Catalog) MatchAcceptLanguage(header string) language.Tag {
+	preferred, _, err := language.ParseAcceptLanguage(header)
+	if err != nil || len(preferred) == 0 {
+		return c.fallback
+	}
+	return c.Match(preferred...)
+}
+
+// Lookup returns the message for key in a locale, falling back to its
+// parent locales, e.g. pt-BR to pt
+func (c *Catalog) Lookup(tag language.Tag, key string) (string, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for {
+		if message, ok := c.messages[tag][key]; ok {
+			return message, true
+		}
+		if tag == language.Und {
+			return "", false
+		}
+		tag = tag.Parent()
+	}
+}
+
+// Format replaces {name} placeholders in message with args
+func Format(message string, args map[string]string) string {
+	if len(args) == 0 {
+		return message
+	}
+	replacements := make([]string, 0, len(args)*2)
+	for name, value := range args {
+		replacements = append(replacements, "{"+name+"}", value)
+	}
+	return strings.NewReplacer(replacements...).Replace(message)
+}
@@ -0,0 +1,69 @@
+package i18n
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+)
+
+func testCatalog(t *testing.T) *Catalog {
+	catalog := NewCatalog(language.English)
+	require.NoError(t, catalog.LoadFS(fstest.MapFS{
+		"locales/es.json":    {Data: []byte(`{"Code created": "Código creado", "error.not_found": "No encontrado", "field.required": "{field} es obligatorio"}`)},
+		"locales/pt.json":    {Data: []byte(`{"Code created": "Código criado"}`)},
+		"locales/pt-BR.json": {Data: []byte(`{"error.not_found": "Não encontrado"}`)},
+		"locales/README.md":  {Data: []byte("not a catalog")},
+	}, "locales"))
+	return catalog
+}
+
+func TestCatalogMatch(t *testing.T) {
+	catalog := testCatalog(t)
+	assert.Len(t, catalog.Supported(), 4)
+	assert.Equal(t, language.English, catalog.Supported()[0])
+
+	tests := map[string]language.Tag{
+		"es-MX,es;q=0.9,en;q=0.8": language.Spanish,
+		"pt-BR":                   language.BrazilianPortuguese,
+		"fr-FR,de;q=0.5":          language.English,
+		"":                        language.English,
+		"not a header!!":          language.English,
+	}
+	for header, expected := range tests {
+		assert.Equal(t, expected, catalog.MatchAcceptLanguage(header), header)
+	}
+}
+
+func TestCatalogLookup(t *testing.T) {
+	catalog := testCatalog(t)
+
+	message, ok := catalog.Lookup(language.Spanish, "Code created")
+	assert.True(t, ok)
+	assert.Equal(t, "Código creado", message)
+
+	// Regional locales fall back to their language
+	message, ok = catalog.Lookup(language.BrazilianPortuguese, "Code created")
+	assert.True(t, ok)
+	assert.Equal(t, "Código criado", message)
+
+	_, ok = catalog.Lookup(language.French, "Code created")
+	assert.False(t, ok)
+
+	catalog.Add(language.Spanish, map[string]string{"Code created": "Código generado"})
+	message, _ = catalog.Lookup(language.Spanish, "Code created")
+	assert.Equal(t, "Código generado", message)
+}
+
+func TestCatalogLoadErrors(t *testing.T) {
+	catalog := NewCatalog(language.English)
+	assert.Error(t, catalog.LoadFS(fstest.MapFS{"locales/xx-invalid-tag.json": {Data: []byte(`{}`)}}, "locales"))
+	assert.Error(t, catalog.LoadFS(fstest.MapFS{"locales/es.json": {Data: []byte(`["not", "an", "object"]`)}}, "locales"))
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "email es obligatorio", Format("{field} es obligatorio", map[string]string{"field": "email"}))
+	assert.Equal(t, "{field} stays", Format("{field} stays", nil))
+}
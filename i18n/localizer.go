@@ -0,0 +1,106 @@
+package i18n
+
+import (
+	"context"
+
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"golang.org/x/text/language"
+)
+
+// Localizer translates messages into one locale
+type Localizer struct {
+	catalog *Catalog
+	tag     language.Tag
+}
+
+// NewLocalizer creates a localizer for a locale of the catalog
+func NewLocalizer(catalog *Catalog, tag language.Tag) *Localizer {
+	return &Localizer{catalog: catalog, tag: tag}
+}
+
+// Tag returns the locale
+func (l *Localizer) Tag() language.Tag {
+	return l.tag
+}
+
+// T returns the message for key with {name} placeholders replaced by args.
+// Keys without a translation are formatted as they are, so a key can be the
+// English message itself.
+func (l *Localizer) T(key string, args map[string]string) string {
+	if message, ok := l.catalog.Lookup(l.tag, key); ok {
+		return Format(message, args)
+	}
+	return Format(key, args)
+}
+
+// translate returns the translation of message, or of the fallback key
+// when message has none. ok is false when neither has one.
+func (l *Localizer) translate(message, fallbackKey string, args map[string]string) (string, bool) {
+	if translated, ok := l.catalog.Lookup(l.tag, message); ok {
+		return Format(translated, args), true
+	}
+	if translated, ok := l.catalog.Lookup(l.tag, fallbackKey); ok {
+		return Format(translated, args), true
+	}
+	return "", false
+}
+
+// Error returns a copy of err with its message and field messages
+// translated. Each message is looked up as it is, then by "error.<code>"
+// or "field.<code>" with {field} and {message} placeholders; messages with
+// no translation are left in English.
+func (l *Localizer) Error(err *types.APIError) *types.APIError {
+	localized := *err
+	if message, ok := l.translate(err.Message, "error."+string(err.Code), map[string]string{"message": err.Message}); ok {
+		localized.Message = message
+	}
+	if len(err.Fields) > 0 {
+		localized.Fields = make([]types.FieldError, len(err.Fields))
+		for i, field := range err.Fields {
+			args := map[string]string{"field": field.Field, "message": field.Message}
+			if message, ok := l.translate(field.Message, "field."+field.Code, args); ok {
+				field.Message = message
+			}
+			localized.Fields[i] = field
+		}
+	}
+	return &localized
+}
+
+// NewContext returns a context carrying the localizer
+func NewContext(ctx context.Context, localizer *Localizer) context.Context {
+	return context.WithValue(ctx, "localizer", localizer)
+}
+
+// FromContext returns the request's localizer, or nil
+func FromContext(ctx context.Context) *Localizer {
+	localizer, _ := ctx.Value("localizer").(*Localizer)
+	return localizer
+}
+
+// Locale returns the request's negotiated locale, language.Und when none
+// was negotiated
+func Locale(ctx context.Context) language.Tag {
+	if localizer := FromContext(ctx); localizer != nil {
+		return localizer.tag
+	}
+	return language.Und
+}
+
+// T translates key into the request's locale, e.g. for APIResponse.Message.
+// Without a localizer the key is formatted as it is.
+func T(ctx context.Context, key string, args map[string]string) string {
+	if localizer := FromContext(ctx); localizer != nil {
+		return localizer.T(key, args)
+	}
+	return Format(key, args)
+}
+
+// LocalizeError translates err into the request's locale. Without a
+// localizer err is returned unchanged.
+func LocalizeError(ctx context.Context, err *types.APIError) *types.APIError {
+	if localizer := FromContext(ctx); localizer != nil {
+		return localizer.Error(err)
+	}
+	return err
+}
@@ -0,0 +1,42 @@
+package i18n
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+func TestLocalizerError(t *testing.T) {
+	localizer := NewLocalizer(testCatalog(t), language.Spanish)
+	apiErr := types.NewValidationError(
+		types.FieldError{Field: "email", Code: "required", Message: "Email is required"},
+		types.FieldError{Field: "phone", Code: "invalid_format", Message: "Phone is invalid"},
+	)
+
+	localized := localizer.Error(apiErr)
+	assert.Equal(t, "Request validation failed", localized.Message, "messages without a translation stay in English")
+	assert.Equal(t, "email es obligatorio", localized.Fields[0].Message)
+	assert.Equal(t, "Phone is invalid", localized.Fields[1].Message)
+	assert.Equal(t, "Email is required", apiErr.Fields[0].Message, "the original error is left alone")
+
+	localized = localizer.Error(types.NewNotFoundError("Device"))
+	assert.Equal(t, "No encontrado", localized.Message)
+	assert.Equal(t, types.ErrCodeNotFound, localized.Code)
+}
+
+func TestContextHelpers(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, language.Und, Locale(ctx))
+	assert.Equal(t, "Code created", T(ctx, "Code created", nil))
+	apiErr := types.NewNotFoundError("Device")
+	assert.Same(t, apiErr, LocalizeError(ctx, apiErr))
+
+	ctx = NewContext(ctx, NewLocalizer(testCatalog(t), language.BrazilianPortuguese))
+	assert.Equal(t, language.BrazilianPortuguese, Locale(ctx))
+	assert.Equal(t, "Código criado", T(ctx, "Code created", nil))
+	assert.Equal(t, "Hello Ada", T(ctx, "Hello {name}", map[string]string{"name": "Ada"}))
+	assert.Equal(t, "Não encontrado", LocalizeError(ctx, apiErr).Message)
+}
@@ -0,0 +1,221 @@
+// Package leaderelection picks one instance of a service to run singleton
+// background work, such as an outbox relay, a job runner or migrations run
+// at startup. Instances campaign for a named lock, a Redis lease or a
+// Postgres advisory lock; the one holding it is the leader until it stops
+// renewing it, when another instance takes over.
+//
+// A leader that is paused for longer than the lock lasts (a Redis lease
+// expiring, a database session dropping) may briefly overlap with the next
+// one, so leader-only work should still be safe to run twice.
+package leaderelection
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+)
+
+// Lock is a lock that at most one instance holds at a time
+type Lock interface {
+	// Acquire tries once to take the lock and reports whether it's held
+	Acquire(ctx context.Context) (bool, error)
+
+	// Renew keeps a held lock and reports whether it's still held
+	Renew(ctx context.Context) (bool, error)
+
+	// Release gives up the lock if it's held
+	Release(ctx context.Context) error
+}
+
+// Config holds the configuration for an election
+type Config struct {
+	// Name names the election in logs and metrics, e.g. "outbox-relay"
+	Name string `json:"name"`
+
+	// RetryInterval is how often an instance that isn't the leader tries to
+	// take the lock
+	RetryInterval time.Duration `json:"retry_interval"`
+
+	// RenewInterval is how often the leader renews the lock. Keep it well
+	// under a Redis lease's TTL.
+	RenewInterval time.Duration `json:"renew_interval"`
+
+	// OnStartedLeading runs the leader-only work when this instance becomes
+	// the leader. ctx is cancelled when leadership is lost or the elector
+	// shuts down, and leadership isn't given up until it returns.
+	OnStartedLeading func(ctx context.Context) `json:"-"`
+
+	// OnStoppedLeading runs after OnStartedLeading has returned because
+	// leadership was lost or the elector shut down; nil does nothing
+	OnStoppedLeading func() `json:"-"`
+
+	Clock   clock.Clock                 `json:"-"` // nil uses the system clock
+	Logger  *slog.Logger                `json:"-"` // nil uses slog.Default
+	Metrics *middleware.MetricsRegistry `json:"-"` // nil disables metrics
+}
+
+// DefaultConfig returns a configuration that renews and retries every 5
+// seconds, for a Redis lease of about 15 seconds
+func DefaultConfig() *Config {
+	return &Config{
+		RetryInterval: 5 * time.Second,
+		RenewInterval: 5 * time.Second,
+	}
+}
+
+// Elector campaigns for leadership of one election and runs the leader-only
+// work while this instance holds it
+type Elector struct {
+	lock    Lock
+	config  *Config
+	clock   clock.Clock
+	logger  *slog.Logger
+	workers *middleware.WorkerGroup
+	leading bool
+	mutex   sync.RWMutex
+}
+
+// New creates an elector and starts campaigning. It campaigns until ctx is
+// cancelled or the elector is shut down.
+func New(ctx context.Context, lock Lock, config *Config) (*Elector, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if config.Name == "" {
+		return nil, errors.New("election name is required")
+	}
+	if config.OnStartedLeading == nil {
+		return nil, errors.New("OnStartedLeading is required")
+	}
+	if config.RetryInterval <= 0 || config.RenewInterval <= 0 {
+		return nil, errors.New("retry and renew intervals must be positive")
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	e := &Elector{
+		lock:    lock,
+		config:  config,
+		clock:   clock.OrReal(config.Clock),
+		logger:  logger.With("election", config.Name),
+		workers: middleware.NewWorkerGroup(ctx, "leaderelection:"+config.Name, &middleware.GoroutineConfig{Logger: logger, Metrics: config.Metrics}),
+	}
+	e.workers.Go("campaign", func(ctx context.Context) error {
+		e.campaign(ctx)
+		return nil
+	})
+	return e, nil
+}
+
+// IsLeader reports whether this instance is the leader
+func (e *Elector) IsLeader() bool {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.leading
+}
+
+// campaign tries to take the lock until ctx ends, leading whenever it holds it
+func (e *Elector) campaign(ctx context.Context) {
+	for {
+		acquired, err := e.lock.Acquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			e.logger.WarnContext(ctx, "failed to acquire leader lock", "error", err.Error())
+		}
+		if acquired {
+			e.lead(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.clock.After(e.config.RetryInterval):
+		}
+	}
+}
+
+// lead runs OnStartedLeading and renews the lock until it's lost or ctx
+// ends, then releases the lock and runs OnStoppedLeading
+func (e *Elector) lead(ctx context.Context) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	started := e.workers.Go("leader", func(context.Context) error {
+		defer close(done)
+		e.config.OnStartedLeading(leaderCtx)
+		return nil
+	})
+	if !started {
+		// Shutting down
+		cancel()
+		e.release(ctx)
+		return
+	}
+
+	e.setLeading(true)
+	e.logger.InfoContext(ctx, "started leading")
+
+	for held := true; held; {
+		select {
+		case <-ctx.Done():
+			held = false
+		case <-e.clock.After(e.config.RenewInterval):
+			renewed, err := e.lock.Renew(ctx)
+			switch {
+			case ctx.Err() != nil:
+				held = false
+			case err != nil:
+				e.logger.WarnContext(ctx, "failed to renew leader lock", "error", err.Error())
+				held = false
+			case !renewed:
+				e.logger.WarnContext(ctx, "leader lock was lost")
+				held = false
+			}
+		}
+	}
+
+	cancel()
+	<-done
+	e.release(ctx)
+	e.setLeading(false)
+	e.logger.InfoContext(ctx, "stopped leading")
+	if e.config.OnStoppedLeading != nil {
+		e.config.OnStoppedLeading()
+	}
+}
+
+// release gives up the lock, even when ctx has been cancelled by shutdown
+func (e *Elector) release(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), e.config.RenewInterval)
+	defer cancel()
+	if err := e.lock.Release(ctx); err != nil {
+		e.logger.WarnContext(ctx, "failed to release leader lock", "error", err.Error())
+	}
+}
+
+// setLeading records a leadership change
+func (e *Elector) setLeading(leading bool) {
+	e.mutex.Lock()
+	e.leading = leading
+	e.mutex.Unlock()
+	if e.config.Metrics != nil {
+		e.config.Metrics.RecordLeadership(e.config.Name, leading)
+	}
+}
+
+// Shutdown stops campaigning. A leader cancels OnStartedLeading's context,
+// waits for it to return and releases the lock so another instance takes
+// over at once.
+func (e *Elector) Shutdown(ctx context.Context) error {
+	return e.workers.Shutdown(ctx)
+}
+
+// Register shuts the elector down with the lifecycle
+func (e *Elector) Register(lifecycle *middleware.Lifecycle) {
+	lifecycle.OnShutdown("leaderelection:"+e.config.Name, e.Shutdown)
+}
@@ -0,0 +1,142 @@
+package leaderelection
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testElector is an elector that counts its leadership changes
+type testElector struct {
+	*Elector
+	lock    *RedisLock
+	started atomic.Int32
+	stopped atomic.Int32
+	leading chan context.Context
+}
+
+// newTestElector starts an elector for the "relay" election on server with
+// 10ms intervals
+func newTestElector(t *testing.T, server *miniredis.Miniredis) *testElector {
+	te := &testElector{
+		lock:    NewRedisLock(redis.NewClient(&redis.Options{Addr: server.Addr()}), "relay", time.Second),
+		leading: make(chan context.Context, 1),
+	}
+	config := &Config{
+		Name:          "relay",
+		RetryInterval: 10 * time.Millisecond,
+		RenewInterval: 10 * time.Millisecond,
+		OnStartedLeading: func(ctx context.Context) {
+			te.started.Add(1)
+			te.leading <- ctx
+			<-ctx.Done()
+		},
+		OnStoppedLeading: func() {
+			te.stopped.Add(1)
+		},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	elector, err := New(ctx, te.lock, config)
+	require.NoError(t, err)
+	te.Elector = elector
+	return te
+}
+
+// waitForLeading returns the context OnStartedLeading got
+func (te *testElector) waitForLeading(t *testing.T) context.Context {
+	t.Helper()
+	select {
+	case ctx := <-te.leading:
+		return ctx
+	case <-time.After(time.Second):
+		t.Fatal("elector didn't start leading")
+		return nil
+	}
+}
+
+func TestElectorLeadsUntilShutdown(t *testing.T) {
+	server := miniredis.RunT(t)
+	elector := newTestElector(t, server)
+
+	leaderCtx := elector.waitForLeading(t)
+	assert.Eventually(t, elector.IsLeader, time.Second, time.Millisecond)
+	holder, err := server.Get("leaderelection:relay")
+	require.NoError(t, err)
+	assert.Equal(t, elector.lock.Holder(), holder)
+
+	require.NoError(t, elector.Shutdown(context.Background()))
+	assert.Error(t, leaderCtx.Err(), "the leader's work is cancelled")
+	assert.False(t, elector.IsLeader())
+	assert.EqualValues(t, 1, elector.started.Load())
+	assert.EqualValues(t, 1, elector.stopped.Load())
+	assert.False(t, server.Exists("leaderelection:relay"), "the lease is released on shutdown")
+}
+
+func TestElectorHasOneLeaderAndFailsOver(t *testing.T) {
+	server := miniredis.RunT(t)
+	first := newTestElector(t, server)
+	first.waitForLeading(t)
+	second := newTestElector(t, server)
+
+	// The second elector retries several times without taking over
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, first.IsLeader())
+	assert.False(t, second.IsLeader())
+	assert.Zero(t, second.started.Load())
+
+	require.NoError(t, first.Shutdown(context.Background()))
+	second.waitForLeading(t)
+	assert.Eventually(t, second.IsLeader, time.Second, time.Millisecond)
+	require.NoError(t, second.Shutdown(context.Background()))
+}
+
+func TestElectorStopsLeadingWhenLeaseIsLost(t *testing.T) {
+	server := miniredis.RunT(t)
+	elector := newTestElector(t, server)
+	leaderCtx := elector.waitForLeading(t)
+
+	// The lease expired and another instance took it
+	require.NoError(t, server.Set("leaderelection:relay", "other"))
+
+	select {
+	case <-leaderCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("leader's work wasn't cancelled")
+	}
+	assert.Eventually(t, func() bool { return elector.stopped.Load() == 1 }, time.Second, time.Millisecond)
+	assert.False(t, elector.IsLeader())
+	holder, err := server.Get("leaderelection:relay")
+	require.NoError(t, err)
+	assert.Equal(t, "other", holder, "another holder's lease isn't released")
+
+	// It leads again once the lease is free
+	server.Del("leaderelection:relay")
+	elector.waitForLeading(t)
+	assert.EqualValues(t, 2, elector.started.Load())
+	require.NoError(t, elector.Shutdown(context.Background()))
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	lock := NewRedisLock(nil, "relay", time.Second)
+	work := func(ctx context.Context) {}
+
+	_, err := New(context.Background(), lock, nil)
+	assert.Error(t, err, "name is required")
+
+	_, err = New(context.Background(), lock, &Config{Name: "relay", RetryInterval: time.Second, RenewInterval: time.Second})
+	assert.Error(t, err, "OnStartedLeading is required")
+
+	_, err = New(context.Background(), lock, &Config{Name: "relay", OnStartedLeading: work})
+	assert.Error(t, err, "intervals must be positive")
+}
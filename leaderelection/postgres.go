@@ -0,0 +1,142 @@
+package leaderelection
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// sessionConn is a database connection held for the lock's session
+type sessionConn interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+
+	// Release returns the connection to the pool
+	Release()
+
+	// Discard closes the connection so a session that may still hold the
+	// lock doesn't go back to the pool
+	Discard()
+}
+
+// poolConn is a sessionConn from a pgx pool
+type poolConn struct {
+	*pgxpool.Conn
+}
+
+// Discard closes the connection; the pool drops closed connections on release
+func (c poolConn) Discard() {
+	c.Conn.Conn().Close(context.Background())
+	c.Conn.Release()
+}
+
+// PostgresLock is a session-level Postgres advisory lock. It's held on one
+// pooled connection for as long as this instance leads, and Postgres frees
+// it when that connection's session ends, so a crashed leader is replaced
+// as soon as the database notices.
+type PostgresLock struct {
+	connect func(ctx context.Context) (sessionConn, error)
+	name    string
+	key     int64
+	conn    sessionConn
+	mutex   sync.Mutex
+}
+
+// NewPostgresLock creates an advisory lock for the named election. The
+// lock's key is a hash of the name, so every service using the same name
+// competes for it. Pass a dbx.DB's Pool.
+func NewPostgresLock(pool *pgxpool.Pool, name string) *PostgresLock {
+	return newPostgresLock(func(ctx context.Context) (sessionConn, error) {
+		conn, err := pool.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return poolConn{conn}, nil
+	}, name)
+}
+
+// newPostgresLock creates an advisory lock on connections from connect
+func newPostgresLock(connect func(ctx context.Context) (sessionConn, error), name string) *PostgresLock {
+	return &PostgresLock{connect: connect, name: name, key: advisoryKey(name)}
+}
+
+// advisoryKey returns the advisory lock key of an election
+func advisoryKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("leaderelection:" + name))
+	return int64(h.Sum64())
+}
+
+// Acquire takes the advisory lock if no other session holds it. The
+// connection is only kept while the lock is held.
+func (l *PostgresLock) Acquire(ctx context.Context) (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.conn != nil {
+		return l.ping(ctx)
+	}
+
+	conn, err := l.connect(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire connection for advisory lock %s: %w", l.name, err)
+	}
+	var acquired bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&acquired); err != nil {
+		conn.Discard()
+		return false, fmt.Errorf("failed to acquire advisory lock %s: %w", l.name, err)
+	}
+	if !acquired {
+		conn.Release()
+		return false, nil
+	}
+	l.conn = conn
+	return true, nil
+}
+
+// Renew checks that the lock's session is still alive; the lock lasts as
+// long as the session does
+func (l *PostgresLock) Renew(ctx context.Context) (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.conn == nil {
+		return false, nil
+	}
+	return l.ping(ctx)
+}
+
+// ping checks the held connection, discarding it when it fails so the
+// session ends and the lock is freed if it wasn't already. Callers hold the
+// mutex.
+func (l *PostgresLock) ping(ctx context.Context) (bool, error) {
+	var one int
+	if err := l.conn.QueryRow(ctx, "SELECT 1").Scan(&one); err != nil {
+		l.conn.Discard()
+		l.conn = nil
+		return false, fmt.Errorf("failed to check advisory lock %s: %w", l.name, err)
+	}
+	return true, nil
+}
+
+// Release unlocks the advisory lock and returns its connection to the
+// pool. When unlocking fails the connection is closed instead, which ends
+// the session and frees the lock.
+func (l *PostgresLock) Release(ctx context.Context) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.conn == nil {
+		return nil
+	}
+	conn := l.conn
+	l.conn = nil
+
+	var released bool
+	if err := conn.QueryRow(ctx, "SELECT pg_advisory_unlock($1)", l.key).Scan(&released); err != nil {
+		conn.Discard()
+		return fmt.Errorf("failed to release advisory lock %s: %w", l.name, err)
+	}
+	conn.Release()
+	return nil
+}
@@ -0,0 +1,140 @@
+package leaderelection
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRow scans a canned value
+type fakeRow struct {
+	value any
+	err   error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	switch d := dest[0].(type) {
+	case *bool:
+		*d = r.value.(bool)
+	case *int:
+		*d = r.value.(int)
+	}
+	return nil
+}
+
+// fakeDatabase stands in for advisory locks held by sessions
+type fakeDatabase struct {
+	holder    *fakeConn
+	broken    bool
+	released  int
+	discarded int
+}
+
+// fakeConn is a session of a fakeDatabase
+type fakeConn struct {
+	db *fakeDatabase
+}
+
+func (c *fakeConn) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if c.db.broken {
+		return fakeRow{err: errors.New("connection reset")}
+	}
+	switch sql {
+	case "SELECT pg_try_advisory_lock($1)":
+		if c.db.holder == nil || c.db.holder == c {
+			c.db.holder = c
+			return fakeRow{value: true}
+		}
+		return fakeRow{value: false}
+	case "SELECT pg_advisory_unlock($1)":
+		held := c.db.holder == c
+		if held {
+			c.db.holder = nil
+		}
+		return fakeRow{value: held}
+	default:
+		return fakeRow{value: 1}
+	}
+}
+
+func (c *fakeConn) Release() {
+	c.db.released++
+}
+
+func (c *fakeConn) Discard() {
+	c.db.discarded++
+	if c.db.holder == c {
+		c.db.holder = nil
+	}
+}
+
+func (db *fakeDatabase) lock(name string) *PostgresLock {
+	return newPostgresLock(func(ctx context.Context) (sessionConn, error) {
+		return &fakeConn{db: db}, nil
+	}, name)
+}
+
+func TestPostgresLock(t *testing.T) {
+	db := &fakeDatabase{}
+	first := db.lock("relay")
+	second := db.lock("relay")
+	ctx := context.Background()
+
+	acquired, err := first.Acquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = second.Acquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+	assert.Equal(t, 1, db.released, "a connection without the lock goes back to the pool")
+
+	renewed, err := first.Renew(ctx)
+	require.NoError(t, err)
+	assert.True(t, renewed)
+	renewed, err = second.Renew(ctx)
+	require.NoError(t, err)
+	assert.False(t, renewed)
+
+	require.NoError(t, first.Release(ctx))
+	assert.Nil(t, db.holder)
+	assert.Equal(t, 2, db.released)
+
+	acquired, err = second.Acquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
+
+func TestPostgresLockDiscardsBrokenSessions(t *testing.T) {
+	db := &fakeDatabase{}
+	lock := db.lock("relay")
+	ctx := context.Background()
+
+	acquired, err := lock.Acquire(ctx)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	db.broken = true
+	renewed, err := lock.Renew(ctx)
+	assert.Error(t, err)
+	assert.False(t, renewed)
+	assert.Equal(t, 1, db.discarded, "a broken session isn't returned to the pool")
+	assert.Zero(t, db.released)
+
+	renewed, err = lock.Renew(ctx)
+	require.NoError(t, err)
+	assert.False(t, renewed, "the lock stays lost")
+	require.NoError(t, lock.Release(ctx))
+}
+
+func TestAdvisoryKey(t *testing.T) {
+	assert.Equal(t, advisoryKey("relay"), advisoryKey("relay"))
+	assert.NotEqual(t, advisoryKey("relay"), advisoryKey("jobs"))
+}
@@ -0,0 +1,93 @@
+package leaderelection
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireScript takes the lease if it's free and extends it if this holder
+// already has it. KEYS: lease. ARGV: holder, TTL in ms.
+var acquireScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// renewScript extends the lease if this holder has it. KEYS: lease. ARGV:
+// holder, TTL in ms.
+var renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript deletes the lease if this holder has it. KEYS: lease. ARGV:
+// holder.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisLock is a lease in Redis that expires unless its holder renews it,
+// so a crashed leader is replaced within the TTL
+type RedisLock struct {
+	client *redis.Client
+	key    string
+	holder string
+	ttl    time.Duration
+}
+
+// NewRedisLock creates a lease for the named election that lasts ttl after
+// each renewal. Every lock gets its own holder ID, so two electors in one
+// process compete like two instances.
+func NewRedisLock(client *redis.Client, name string, ttl time.Duration) *RedisLock {
+	return &RedisLock{
+		client: client,
+		key:    "leaderelection:" + name,
+		holder: uuid.New().String(),
+		ttl:    ttl,
+	}
+}
+
+// Holder returns the ID stored in the lease while this lock holds it
+func (l *RedisLock) Holder() string {
+	return l.holder
+}
+
+// Acquire takes the lease if no other holder has it
+func (l *RedisLock) Acquire(ctx context.Context) (bool, error) {
+	acquired, err := acquireScript.Run(ctx, l.client, []string{l.key}, l.holder, l.ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease %s: %w", l.key, err)
+	}
+	return acquired == 1, nil
+}
+
+// Renew extends the lease, reporting false if it expired and another
+// holder took it
+func (l *RedisLock) Renew(ctx context.Context) (bool, error) {
+	renewed, err := renewScript.Run(ctx, l.client, []string{l.key}, l.holder, l.ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to renew lease %s: %w", l.key, err)
+	}
+	return renewed == 1, nil
+}
+
+// Release deletes the lease if this lock still holds it
+func (l *RedisLock) Release(ctx context.Context) error {
+	if err := releaseScript.Run(ctx, l.client, []string{l.key}, l.holder).Err(); err != nil {
+		return fmt.Errorf("failed to release lease %s: %w", l.key, err)
+	}
+	return nil
+}
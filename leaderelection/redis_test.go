@@ -0,0 +1,85 @@
+package leaderelection
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisLock(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	ctx := context.Background()
+
+	first := NewRedisLock(client, "relay", 10*time.Second)
+	second := NewRedisLock(client, "relay", 10*time.Second)
+	require.NotEqual(t, first.Holder(), second.Holder())
+
+	acquired, err := first.Acquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	assert.Equal(t, 10*time.Second, server.TTL("leaderelection:relay"))
+
+	acquired, err = second.Acquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, acquired, "the lease is taken")
+	renewed, err := second.Renew(ctx)
+	require.NoError(t, err)
+	assert.False(t, renewed)
+	require.NoError(t, second.Release(ctx))
+	assert.True(t, server.Exists("leaderelection:relay"), "a non-holder can't release the lease")
+
+	server.FastForward(8 * time.Second)
+	renewed, err = first.Renew(ctx)
+	require.NoError(t, err)
+	assert.True(t, renewed)
+	assert.Equal(t, 10*time.Second, server.TTL("leaderelection:relay"), "renewing extends the lease")
+
+	acquired, err = first.Acquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired, "acquiring a held lease keeps it")
+
+	require.NoError(t, first.Release(ctx))
+	acquired, err = second.Acquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired, "a released lease is free")
+}
+
+func TestRedisLockExpires(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	ctx := context.Background()
+
+	first := NewRedisLock(client, "relay", 10*time.Second)
+	second := NewRedisLock(client, "relay", 10*time.Second)
+	acquired, err := first.Acquire(ctx)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	// The holder stopped renewing
+	server.FastForward(11 * time.Second)
+	acquired, err = second.Acquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	renewed, err := first.Renew(ctx)
+	require.NoError(t, err)
+	assert.False(t, renewed, "the old holder learns it lost the lease")
+}
+
+func TestRedisLockReportsErrors(t *testing.T) {
+	server := miniredis.RunT(t)
+	lock := NewRedisLock(redis.NewClient(&redis.Options{Addr: server.Addr()}), "relay", time.Second)
+	server.Close()
+
+	_, err := lock.Acquire(context.Background())
+	assert.ErrorContains(t, err, "leaderelection:relay")
+	_, err = lock.Renew(context.Background())
+	assert.Error(t, err)
+	assert.Error(t, lock.Release(context.Background()))
+}
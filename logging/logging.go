@@ -0,0 +1,131 @@
+// Package logging builds the slog loggers services use, so every log line
+// carries the service name, environment and the request's correlation
+// fields without each service wiring that up by hand, and provides request
+// logging middleware.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/jarakey/jarakey-shared-middleware/secrets"
+)
+
+// Output formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Config holds the configuration for a logger
+type Config struct {
+	ServiceName string `json:"service_name"`
+	Environment string `json:"environment"`
+
+	// Format is FormatJSON or FormatText
+	Format string `json:"format"`
+
+	// AddSource adds the file and line of the log call
+	AddSource bool `json:"add_source"`
+
+	// Redact masks secrets in messages and attributes, see secrets.Redact
+	Redact bool `json:"redact"`
+
+	// Level is shared with whatever changes it at runtime, e.g.
+	// reload.LogLevel or the admin endpoints; nil logs at info
+	Level *slog.LevelVar `json:"-"`
+
+	Output io.Writer `json:"-"` // nil uses os.Stdout
+}
+
+// DefaultConfig returns a configuration for JSON logs with secrets redacted
+func DefaultConfig() *Config {
+	return &Config{
+		Format: FormatJSON,
+		Redact: true,
+	}
+}
+
+// New creates a logger that adds the service name, environment and the
+// correlation fields of the context passed to each *Context call
+func New(config *Config) *slog.Logger {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	output := config.Output
+	if output == nil {
+		output = os.Stdout
+	}
+	options := &slog.HandlerOptions{AddSource: config.AddSource}
+	if config.Level != nil {
+		options.Level = config.Level
+	}
+
+	var handler slog.Handler
+	if config.Format == FormatText {
+		handler = slog.NewTextHandler(output, options)
+	} else {
+		handler = slog.NewJSONHandler(output, options)
+	}
+	handler = NewContextHandler(handler)
+	if config.Redact {
+		handler = secrets.NewRedactingHandler(handler)
+	}
+
+	logger := slog.New(handler)
+	if config.ServiceName != "" {
+		logger = logger.With("service", config.ServiceName)
+	}
+	if config.Environment != "" {
+		logger = logger.With("environment", config.Environment)
+	}
+	return logger
+}
+
+// ContextHandler is a slog.Handler that adds the correlation fields of the
+// record's context, see middleware.LogCorrelationContext
+type ContextHandler struct {
+	next slog.Handler
+}
+
+// NewContextHandler wraps next so records carry their correlation fields
+func NewContextHandler(next slog.Handler) *ContextHandler {
+	return &ContextHandler{next: next}
+}
+
+// Enabled reports whether the wrapped handler handles the level
+func (h *ContextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle adds the correlation fields and passes the record on
+func (h *ContextHandler) Handle(ctx context.Context, record slog.Record) error {
+	fields := middleware.LogCorrelationContext(ctx)
+	if len(fields) > 0 {
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		record = record.Clone()
+		for _, name := range names {
+			record.AddAttrs(slog.Any(name, fields[name]))
+		}
+	}
+	return h.next.Handle(ctx, record)
+}
+
+// WithAttrs returns a handler with the attributes added
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ContextHandler{next: h.next.WithAttrs(attrs)}
+}
+
+// WithGroup returns a handler that nests attributes in the group
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return &ContextHandler{next: h.next.WithGroup(name)}
+}
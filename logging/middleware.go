@@ -0,0 +1,152 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+)
+
+// RequestLogConfig holds the configuration for request logging
+type RequestLogConfig struct {
+	// SampleRate is the fraction of successful requests logged, from 0 to
+	// 1. Client and server errors and slow requests are always logged.
+	SampleRate float64 `json:"sample_rate"`
+
+	// SlowThreshold logs requests taking longer whatever the sample rate;
+	// 0 disables it
+	SlowThreshold time.Duration `json:"slow_threshold"`
+
+	// SkipPaths are path prefixes never logged, e.g. health checks
+	SkipPaths []string `json:"skip_paths"`
+
+	Logger *slog.Logger `json:"-"` // nil uses slog.Default
+	Clock  clock.Clock  `json:"-"` // nil uses the system clock
+}
+
+// DefaultRequestLogConfig returns a configuration logging every request
+// except health checks and metrics scrapes
+func DefaultRequestLogConfig() *RequestLogConfig {
+	return &RequestLogConfig{
+		SampleRate:    1,
+		SlowThreshold: time.Second,
+		SkipPaths:     []string{"/health", "/metrics"},
+	}
+}
+
+// requestLogger logs finished requests
+type requestLogger struct {
+	config *RequestLogConfig
+	logger *slog.Logger
+	clock  clock.Clock
+	sample func() bool
+}
+
+// newRequestLogger applies the config defaults
+func newRequestLogger(config *RequestLogConfig) *requestLogger {
+	if config == nil {
+		config = DefaultRequestLogConfig()
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &requestLogger{
+		config: config,
+		logger: logger,
+		clock:  clock.OrReal(config.Clock),
+		sample: func() bool { return rand.Float64() < config.SampleRate },
+	}
+}
+
+// skip reports whether a path is never logged
+func (l *requestLogger) skip(path string) bool {
+	for _, prefix := range l.config.SkipPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// log logs a finished request at a level matching its status: errors for
+// 5xx, warnings for 4xx and info otherwise
+func (l *requestLogger) log(ctx context.Context, r *http.Request, status, size int, duration time.Duration) {
+	level := slog.LevelInfo
+	switch {
+	case status >= 500:
+		level = slog.LevelError
+	case status >= 400:
+		level = slog.LevelWarn
+	}
+	slow := l.config.SlowThreshold > 0 && duration >= l.config.SlowThreshold
+	if level == slog.LevelInfo && !slow && !l.sample() {
+		return
+	}
+
+	l.logger.LogAttrs(ctx, level, "request",
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.Int("status", status),
+		slog.Int("bytes", size),
+		slog.Duration("duration", duration),
+		slog.Bool("slow", slow),
+		slog.String("user_agent", r.UserAgent()),
+	)
+}
+
+// responseRecorder records the status and size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.size += n
+	return n, err
+}
+
+// Middleware logs every finished request, sampled as configured. Mount it
+// inside the correlation middleware so lines carry the correlation fields.
+func Middleware(config *RequestLogConfig) func(http.Handler) http.Handler {
+	l := newRequestLogger(config)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if l.skip(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			start := l.clock.Now()
+			recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+			l.log(r.Context(), r, recorder.status, recorder.size, l.clock.Since(start))
+		})
+	}
+}
+
+// GinMiddleware creates request logging middleware for Gin framework
+func GinMiddleware(config *RequestLogConfig) gin.HandlerFunc {
+	l := newRequestLogger(config)
+	return func(c *gin.Context) {
+		if l.skip(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		start := l.clock.Now()
+		c.Next()
+		// Middleware later in the chain may have set the correlation context
+		l.log(c.Request.Context(), c.Request, c.Writer.Status(), max(c.Writer.Size(), 0), l.clock.Since(start))
+	}
+}
@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareLogsRequests(t *testing.T) {
+	var output bytes.Buffer
+	config := DefaultRequestLogConfig()
+	config.Logger = New(&Config{Output: &output})
+	handler := middleware.CorrelationMiddleware()(Middleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte("hello"))
+	})))
+
+	for _, path := range []string{"/codes", "/missing", "/health"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(middleware.CorrelationIDHeader, "corr-123")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	records := decodeLines(t, &output)
+	require.Len(t, records, 2, "health checks aren't logged")
+	assert.Equal(t, "INFO", records[0]["level"])
+	assert.Equal(t, "/codes", records[0]["path"])
+	assert.Equal(t, float64(200), records[0]["status"])
+	assert.Equal(t, float64(5), records[0]["bytes"])
+	assert.Equal(t, "corr-123", records[0]["correlation_id"])
+	assert.Equal(t, "WARN", records[1]["level"])
+	assert.Equal(t, float64(404), records[1]["status"])
+}
+
+func TestGinMiddlewareSamplesSuccesses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var output bytes.Buffer
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	router := gin.New()
+	router.Use(GinMiddleware(&RequestLogConfig{
+		SampleRate:    0,
+		SlowThreshold: time.Second,
+		Logger:        New(&Config{Output: &output}),
+		Clock:         fake,
+	}), middleware.GinCorrelationMiddleware())
+	router.GET("/codes", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	router.GET("/slow", func(c *gin.Context) {
+		fake.Advance(2 * time.Second)
+		c.String(http.StatusOK, "ok")
+	})
+	router.GET("/broken", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+
+	for _, path := range []string{"/codes", "/slow", "/broken"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	records := decodeLines(t, &output)
+	require.Len(t, records, 2, "successes aren't sampled at rate 0")
+	assert.Equal(t, "/slow", records[0]["path"])
+	assert.Equal(t, true, records[0]["slow"])
+	assert.Equal(t, "ERROR", records[1]["level"])
+	assert.Contains(t, records[1], "correlation_id", "the correlation set by later middleware is logged")
+}
@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// TokenValidator validates access tokens; *utils.JWTManager implements it
+type TokenValidator interface {
+	ValidateTokenWithContext(ctx context.Context, tokenString string) (*types.JWTClaims, error)
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authenticate validates the request's token and returns a context carrying
+// its claims, or the status and API response to reject the request with.
+// When cookies is non-nil the access token may also come from a cookie.
+func authenticate(r *http.Request, validator TokenValidator, cookies *CookieConfig) (context.Context, int, *types.APIResponse) {
+	token := bearerToken(r)
+	if token == "" && cookies != nil {
+		var err error
+		if token, err = cookieToken(r, cookies); err != nil {
+			return nil, http.StatusForbidden, &types.APIResponse{
+				Success: false,
+				Message: err.Error(),
+				Error:   "csrf_failed",
+			}
+		}
+	}
+
+	if token == "" {
+		return nil, http.StatusUnauthorized, &types.APIResponse{
+			Success: false,
+			Message: "Authentication required",
+			Error:   "unauthorized",
+		}
+	}
+
+	claims, err := validator.ValidateTokenWithContext(r.Context(), token)
+	if err != nil {
+		return nil, http.StatusUnauthorized, &types.APIResponse{
+			Success: false,
+			Message: "Invalid or expired token",
+			Error:   "invalid_token",
+		}
+	}
+
+	ctx := WithJWTClaims(r.Context(), claims)
+	if claims.Principal() == types.PrincipalUser {
+		ctx = SetUserID(ctx, claims.UserID)
+	}
+	return ctx, http.StatusOK, nil
+}
+
+// authMiddleware builds net/http authentication middleware
+func authMiddleware(validator TokenValidator, cookies *CookieConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, status, rejection := authenticate(r, validator, cookies)
+			if rejection != nil {
+				if status == http.StatusUnauthorized {
+					w.Header().Set("WWW-Authenticate", "Bearer")
+				}
+				writeAPIResponse(w, status, *rejection)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ginAuthMiddleware builds Gin authentication middleware
+func ginAuthMiddleware(validator TokenValidator, cookies *CookieConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, status, rejection := authenticate(c.Request, validator, cookies)
+		if rejection != nil {
+			if status == http.StatusUnauthorized {
+				c.Header("WWW-Authenticate", "Bearer")
+			}
+			c.AbortWithStatusJSON(status, *rejection)
+			return
+		}
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// AuthMiddleware creates middleware that requires a valid bearer token and
+// stores its claims in the request context
+func AuthMiddleware(validator TokenValidator) func(http.Handler) http.Handler {
+	return authMiddleware(validator, nil)
+}
+
+// GinAuthMiddleware creates bearer token authentication middleware for Gin framework
+func GinAuthMiddleware(validator TokenValidator) gin.HandlerFunc {
+	return ginAuthMiddleware(validator, nil)
+}
+
+// GetPrincipalType returns the kind of authenticated principal, or "" when
+// the request is unauthenticated
+func GetPrincipalType(ctx context.Context) types.PrincipalType {
+	if claims := GetJWTClaims(ctx); claims != nil {
+		return claims.Principal()
+	}
+	return ""
+}
+
+// IsServicePrincipal reports whether the request was authenticated with a service token
+func IsServicePrincipal(ctx context.Context) bool {
+	return GetPrincipalType(ctx) == types.PrincipalService
+}
+
+// principalAllowed reports whether the claims belong to one of the allowed principal types
+func principalAllowed(claims *types.JWTClaims, principals []types.PrincipalType) bool {
+	for _, principal := range principals {
+		if claims.Principal() == principal {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePrincipal creates middleware that only lets requests through when
+// they were authenticated as one of the given principal types
+func RequirePrincipal(principals ...types.PrincipalType) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := GetJWTClaims(r.Context())
+			if claims == nil {
+				writeAPIResponse(w, http.StatusUnauthorized, types.APIResponse{
+					Success: false,
+					Message: "Authentication required",
+					Error:   "unauthorized",
+				})
+				return
+			}
+
+			if !principalAllowed(claims, principals) {
+				writeAPIResponse(w, http.StatusForbidden, types.APIResponse{
+					Success: false,
+					Message: "Principal type not allowed: " + string(claims.Principal()),
+					Error:   "forbidden_principal",
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GinRequirePrincipal creates principal-checking middleware for Gin framework
+func GinRequirePrincipal(principals ...types.PrincipalType) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := GetJWTClaims(c.Request.Context())
+		if claims == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, types.APIResponse{
+				Success: false,
+				Message: "Authentication required",
+				Error:   "unauthorized",
+			})
+			return
+		}
+
+		if !principalAllowed(claims, principals) {
+			c.AbortWithStatusJSON(http.StatusForbidden, types.APIResponse{
+				Success: false,
+				Message: "Principal type not allowed: " + string(claims.Principal()),
+				Error:   "forbidden_principal",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
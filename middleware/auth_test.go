@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// stubValidator accepts a fixed set of tokens
+type stubValidator map[string]*types.JWTClaims
+
+func (v stubValidator) ValidateTokenWithContext(ctx context.Context, tokenString string) (*types.JWTClaims, error) {
+	if claims, ok := v[tokenString]; ok {
+		return claims, nil
+	}
+	return nil, errors.New("invalid token")
+}
+
+func newStubValidator() stubValidator {
+	return stubValidator{
+		"user-token":    {UserID: "user-123", TokenType: types.TokenTypeAccess},
+		"service-token": {TokenType: types.TokenTypeService, RegisteredClaims: jwt.RegisteredClaims{Subject: "codes-service"}},
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{"Bearer abc", "abc"},
+		{"bearer abc", "abc"},
+		{"Basic abc", ""},
+		{"Bearer", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", tt.header)
+		if got := bearerToken(req); got != tt.expected {
+			t.Errorf("Header %q: expected token %q, got %q", tt.header, tt.expected, got)
+		}
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	var principal types.PrincipalType
+	var userID string
+	handler := CorrelationMiddleware()(AuthMiddleware(newStubValidator())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal = GetPrincipalType(r.Context())
+		userID = GetUserID(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name      string
+		header    string
+		status    int
+		principal types.PrincipalType
+		userID    string
+	}{
+		{"missing token", "", http.StatusUnauthorized, "", ""},
+		{"invalid token", "Bearer bogus", http.StatusUnauthorized, "", ""},
+		{"user token", "Bearer user-token", http.StatusOK, types.PrincipalUser, "user-123"},
+		{"service token", "Bearer service-token", http.StatusOK, types.PrincipalService, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, userID = "", ""
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, w.Code)
+			}
+			if tt.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Error("Expected WWW-Authenticate header on 401")
+			}
+			if principal != tt.principal {
+				t.Errorf("Expected principal %q, got %q", tt.principal, principal)
+			}
+			if userID != tt.userID {
+				t.Errorf("Expected user ID %q, got %q", tt.userID, userID)
+			}
+		})
+	}
+}
+
+func TestRequirePrincipal(t *testing.T) {
+	validator := newStubValidator()
+	handler := AuthMiddleware(validator)(RequirePrincipal(types.PrincipalService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !IsServicePrincipal(r.Context()) {
+			t.Error("Expected service principal")
+		}
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		token  string
+		status int
+	}{
+		{"user-token", http.StatusForbidden},
+		{"service-token", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/internal", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("Token %q: expected status %d, got %d", tt.token, tt.status, w.Code)
+		}
+	}
+
+	// Without authentication the check itself rejects the request
+	w := httptest.NewRecorder()
+	RequirePrincipal(types.PrincipalUser)(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestGinAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(GinAuthMiddleware(newStubValidator()))
+	r.GET("/me", GinRequirePrincipal(types.PrincipalUser), func(c *gin.Context) {
+		c.String(http.StatusOK, GetJWTClaims(c.Request.Context()).PrincipalID())
+	})
+
+	tests := []struct {
+		header string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer bogus", http.StatusUnauthorized},
+		{"Bearer service-token", http.StatusForbidden},
+		{"Bearer user-token", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/me", nil)
+		req.Header.Set("Authorization", tt.header)
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("Header %q: expected status %d, got %d", tt.header, tt.status, w.Code)
+		}
+		if tt.status == http.StatusOK && w.Body.String() != "user-123" {
+			t.Errorf("Expected principal ID user-123, got %s", w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,721 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/redis/go-redis/v9"
+)
+
+// ChallengeTokenHeader carries the CAPTCHA token of a client that has been
+// asked to complete a challenge
+const ChallengeTokenHeader = "X-Challenge-Token"
+
+// maxCodeBodySize is how much of a request body CodeFromJSONBody reads
+const maxCodeBodySize = 64 << 10
+
+// AttemptPolicy limits failed attempts counted under one key
+type AttemptPolicy struct {
+	// MaxFailures within Window lock the key out; 0 disables the policy
+	MaxFailures int64         `json:"max_failures"`
+	Window      time.Duration `json:"window"`
+	// Lockout is the first lockout's length. Each lockout within Decay of
+	// the last one doubles it, up to MaxLockout.
+	Lockout    time.Duration `json:"lockout"`
+	MaxLockout time.Duration `json:"max_lockout"`
+	Decay      time.Duration `json:"decay"`
+}
+
+// enabled reports whether the policy counts anything
+func (p AttemptPolicy) enabled() bool {
+	return p.MaxFailures > 0 && p.Window > 0 && p.Lockout > 0
+}
+
+// lockoutFor returns the length of the given lockout, counting from 1
+func (p AttemptPolicy) lockoutFor(lockouts int64) time.Duration {
+	lockout := p.Lockout
+	for i := int64(1); i < lockouts && (p.MaxLockout <= 0 || lockout < p.MaxLockout); i++ {
+		lockout *= 2
+	}
+	if p.MaxLockout > 0 && lockout > p.MaxLockout {
+		lockout = p.MaxLockout
+	}
+	return lockout
+}
+
+// AttemptStore counts failed attempts and lockouts. Attempts are reserved
+// before they run and settled once their outcome is known, so concurrent
+// attempts can't all pass a check made before any of them failed.
+type AttemptStore interface {
+	// Reserve counts an attempt as a failure in advance and returns key's
+	// failures in the current window including it. When key is locked out,
+	// or the window's remaining attempts are all reserved, the attempt
+	// isn't counted and lockedUntil says when to try again.
+	Reserve(ctx context.Context, key string, policy AttemptPolicy, now time.Time) (failures int64, lockedUntil time.Time, err error)
+	// RecordFailure settles a reserved attempt that failed. Once the
+	// window's failures reach the policy's MaxFailures, key is locked out
+	// and a new window starts; lockedUntil is zero otherwise.
+	RecordFailure(ctx context.Context, key string, policy AttemptPolicy, now time.Time) (failures int64, lockedUntil time.Time, err error)
+	// Refund takes back a reserved attempt that didn't fail
+	Refund(ctx context.Context, key string) error
+	// Reset clears key's failures, e.g. to unlock a client by hand. Past
+	// lockouts still count towards the next lockout's length until they
+	// decay.
+	Reset(ctx context.Context, key string) error
+}
+
+// reserveScript counts an attempt unless the key is locked out or its
+// window is used up. It returns {failures, locked until in ms or 0}.
+var reserveScript = redis.NewScript(`
+local now = tonumber(ARGV[3])
+local lockedUntil = tonumber(redis.call('GET', KEYS[2]) or '0')
+if lockedUntil > now then
+	return {0, lockedUntil}
+end
+local failures = tonumber(redis.call('GET', KEYS[1]) or '0')
+if failures >= tonumber(ARGV[2]) then
+	return {failures, now + tonumber(ARGV[4])}
+end
+failures = redis.call('INCR', KEYS[1])
+if failures == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return {failures, 0}
+`)
+
+// recordFailureScript applies the lockout once a window's reserved
+// failures reach the limit. It returns {failures, locked until in ms or 0}.
+var recordFailureScript = redis.NewScript(`
+local failures = tonumber(redis.call('GET', KEYS[1]) or '0')
+if failures < tonumber(ARGV[1]) then
+	return {failures, 0}
+end
+redis.call('DEL', KEYS[1])
+local lockouts = redis.call('INCR', KEYS[2])
+redis.call('PEXPIRE', KEYS[2], ARGV[2])
+local lockout = tonumber(ARGV[3])
+local maxLockout = tonumber(ARGV[4])
+for i = 2, lockouts do
+	if maxLockout > 0 and lockout >= maxLockout then
+		break
+	end
+	lockout = lockout * 2
+end
+if maxLockout > 0 and lockout > maxLockout then
+	lockout = maxLockout
+end
+local lockedUntil = tonumber(ARGV[5]) + lockout
+redis.call('SET', KEYS[3], lockedUntil, 'PX', lockout)
+return {failures, lockedUntil}
+`)
+
+// refundScript takes back a reserved attempt, never going below zero
+var refundScript = redis.NewScript(`
+local failures = tonumber(redis.call('GET', KEYS[1]) or '0')
+if failures > 0 then
+	return redis.call('DECR', KEYS[1])
+end
+return 0
+`)
+
+// RedisAttemptStore counts attempts in Redis, shared by every instance
+type RedisAttemptStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisAttemptStore creates a Redis-backed attempt store
+func NewRedisAttemptStore(client *redis.Client) *RedisAttemptStore {
+	return &RedisAttemptStore{client: client, prefix: "bruteforce"}
+}
+
+// keys returns the failure, lockout history and lockout keys for key
+func (s *RedisAttemptStore) keys(key string) []string {
+	base := s.prefix + ":" + key
+	return []string{base + ":failures", base + ":lockouts", base + ":locked"}
+}
+
+// Reserve atomically counts an attempt
+func (s *RedisAttemptStore) Reserve(ctx context.Context, key string, policy AttemptPolicy, now time.Time) (int64, time.Time, error) {
+	keys := s.keys(key)
+	result, err := reserveScript.Run(ctx, s.client, []string{keys[0], keys[2]},
+		policy.Window.Milliseconds(),
+		policy.MaxFailures,
+		now.UnixMilli(),
+		policy.Lockout.Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to reserve attempt: %w", err)
+	}
+	if result[1] == 0 {
+		return result[0], time.Time{}, nil
+	}
+	return result[0], time.UnixMilli(result[1]), nil
+}
+
+// RecordFailure atomically settles a failed attempt
+func (s *RedisAttemptStore) RecordFailure(ctx context.Context, key string, policy AttemptPolicy, now time.Time) (int64, time.Time, error) {
+	result, err := recordFailureScript.Run(ctx, s.client, s.keys(key),
+		policy.MaxFailures,
+		policy.Decay.Milliseconds(),
+		policy.Lockout.Milliseconds(),
+		policy.MaxLockout.Milliseconds(),
+		now.UnixMilli(),
+	).Int64Slice()
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to record failed attempt: %w", err)
+	}
+	if result[1] == 0 {
+		return result[0], time.Time{}, nil
+	}
+	return result[0], time.UnixMilli(result[1]), nil
+}
+
+// Refund atomically takes back a reserved attempt
+func (s *RedisAttemptStore) Refund(ctx context.Context, key string) error {
+	if err := refundScript.Run(ctx, s.client, s.keys(key)[:1]).Err(); err != nil {
+		return fmt.Errorf("failed to refund attempt: %w", err)
+	}
+	return nil
+}
+
+// Reset clears key's failures
+func (s *RedisAttemptStore) Reset(ctx context.Context, key string) error {
+	if err := s.client.Del(ctx, s.keys(key)[0]).Err(); err != nil {
+		return fmt.Errorf("failed to reset attempts: %w", err)
+	}
+	return nil
+}
+
+// attemptRecord is one key's state in a MemoryAttemptStore
+type attemptRecord struct {
+	failures    int64
+	windowEnd   time.Time
+	lockouts    int64
+	decayEnd    time.Time
+	lockedUntil time.Time
+}
+
+// expire clears what has ended, reporting whether anything is left
+func (r *attemptRecord) expire(now time.Time) bool {
+	if !now.Before(r.windowEnd) {
+		r.failures = 0
+	}
+	if !now.Before(r.decayEnd) {
+		r.lockouts = 0
+	}
+	return r.failures > 0 || r.lockouts > 0 || now.Before(r.lockedUntil)
+}
+
+// MemoryAttemptStore counts attempts in process memory, for tests and
+// single instance deployments
+type MemoryAttemptStore struct {
+	records   map[string]*attemptRecord
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+// NewMemoryAttemptStore creates an in-memory attempt store
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{records: make(map[string]*attemptRecord)}
+}
+
+// record returns key's record with what has ended expired
+func (s *MemoryAttemptStore) record(key string, now time.Time) *attemptRecord {
+	s.sweep(now)
+	record, ok := s.records[key]
+	if !ok {
+		record = &attemptRecord{}
+		s.records[key] = record
+	}
+	record.expire(now)
+	return record
+}
+
+// sweep drops records with nothing left, at most once a minute
+func (s *MemoryAttemptStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, record := range s.records {
+		if !record.expire(now) {
+			delete(s.records, key)
+		}
+	}
+}
+
+// Reserve counts an attempt
+func (s *MemoryAttemptStore) Reserve(ctx context.Context, key string, policy AttemptPolicy, now time.Time) (int64, time.Time, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record := s.record(key, now)
+	if now.Before(record.lockedUntil) {
+		return 0, record.lockedUntil, nil
+	}
+	if record.failures >= policy.MaxFailures {
+		return record.failures, now.Add(policy.Lockout), nil
+	}
+	record.failures++
+	if record.failures == 1 {
+		record.windowEnd = now.Add(policy.Window)
+	}
+	return record.failures, time.Time{}, nil
+}
+
+// RecordFailure settles a failed attempt
+func (s *MemoryAttemptStore) RecordFailure(ctx context.Context, key string, policy AttemptPolicy, now time.Time) (int64, time.Time, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record := s.record(key, now)
+	failures := record.failures
+	if failures < policy.MaxFailures {
+		return failures, time.Time{}, nil
+	}
+
+	record.failures = 0
+	record.lockouts++
+	record.decayEnd = now.Add(policy.Decay)
+	record.lockedUntil = now.Add(policy.lockoutFor(record.lockouts))
+	return failures, record.lockedUntil, nil
+}
+
+// Refund takes back a reserved attempt
+func (s *MemoryAttemptStore) Refund(ctx context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if record, ok := s.records[key]; ok && record.failures > 0 {
+		record.failures--
+	}
+	return nil
+}
+
+// Reset clears key's failures
+func (s *MemoryAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if record, ok := s.records[key]; ok {
+		record.failures = 0
+	}
+	return nil
+}
+
+// ChallengeVerifier checks a CAPTCHA token, e.g. with reCAPTCHA, hCaptcha
+// or Turnstile
+type ChallengeVerifier interface {
+	Verify(ctx context.Context, token, remoteIP string) (bool, error)
+}
+
+// ChallengeVerifierFunc adapts a function to ChallengeVerifier
+type ChallengeVerifierFunc func(ctx context.Context, token, remoteIP string) (bool, error)
+
+// Verify calls f
+func (f ChallengeVerifierFunc) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	return f(ctx, token, remoteIP)
+}
+
+// BruteForceConfig holds the configuration for brute-force protection
+type BruteForceConfig struct {
+	// IP limits failed attempts per client IP
+	IP AttemptPolicy `json:"ip"`
+
+	// Subject limits failed attempts per authenticated caller across all of
+	// its IPs, catching guessing spread over many IPs without affecting
+	// other callers
+	Subject AttemptPolicy `json:"subject"`
+
+	// SubjectKey returns the caller a request is counted against, or "" to
+	// skip the subject policy; nil uses the authenticated principal
+	SubjectKey func(r *http.Request) string `json:"-"`
+
+	// Prefix limits failed attempts per code prefix across all clients.
+	// Disabled by default: a prefix lockout denies every code sharing the
+	// prefix, so anyone can lock legitimate holders out by guessing badly.
+	// Enable it only where anonymous guessing over many IPs is the bigger
+	// risk.
+	Prefix AttemptPolicy `json:"prefix"`
+
+	// PrefixLength is how many leading characters of the code make its prefix
+	PrefixLength int `json:"prefix_length"`
+
+	// ChallengeAfter is the number of failures from an IP after which its
+	// requests must carry a challenge token; 0 disables challenges
+	ChallengeAfter int64             `json:"challenge_after"`
+	Challenge      ChallengeVerifier `json:"-"` // nil disables challenges
+
+	// ClientIP returns the client a request is counted against; nil uses
+	// the remote address
+	ClientIP func(r *http.Request) string `json:"-"`
+
+	// Code returns the normalized code a request validates, or "" when it
+	// has none; nil uses CodeFromJSONBody
+	Code func(r *http.Request) string `json:"-"`
+
+	// Audit receives an event for every lockout and failed challenge,
+	// typically to publish it
+	Audit func(ctx context.Context, event *types.CodeValidationBlocked) `json:"-"`
+
+	Logger  *slog.Logger     `json:"-"` // nil uses slog.Default
+	Metrics *MetricsRegistry `json:"-"` // nil disables metrics
+	Clock   clock.Clock      `json:"-"` // nil uses the system clock
+}
+
+// DefaultBruteForceConfig returns a configuration that locks an IP out
+// after 5 failures in 15 minutes and an authenticated caller after 20, and
+// asks for a challenge after 3 failures once a verifier is set. The prefix
+// policy is off; set Prefix.MaxFailures to enable it.
+func DefaultBruteForceConfig() *BruteForceConfig {
+	return &BruteForceConfig{
+		IP: AttemptPolicy{
+			MaxFailures: 5,
+			Window:      15 * time.Minute,
+			Lockout:     time.Minute,
+			MaxLockout:  time.Hour,
+			Decay:       24 * time.Hour,
+		},
+		Subject: AttemptPolicy{
+			MaxFailures: 20,
+			Window:      15 * time.Minute,
+			Lockout:     time.Minute,
+			MaxLockout:  time.Hour,
+			Decay:       24 * time.Hour,
+		},
+		Prefix: AttemptPolicy{
+			Window:     15 * time.Minute,
+			Lockout:    time.Minute,
+			MaxLockout: 15 * time.Minute,
+			Decay:      time.Hour,
+		},
+		PrefixLength:   3,
+		ChallengeAfter: 3,
+	}
+}
+
+// CodeFromJSONBody returns the normalized code of a CodeValidationRequest
+// body, leaving the body for the handler to read
+func CodeFromJSONBody(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCodeBodySize))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+
+	var request types.CodeValidationRequest
+	if json.Unmarshal(body, &request) != nil || request.Validate() != nil {
+		return ""
+	}
+	return request.Code
+}
+
+// codeAttempt is one validation request being guarded
+type codeAttempt struct {
+	ip      string
+	subject string
+	prefix  string
+	// reserved are the scopes the attempt has been counted under
+	reserved []attemptScope
+	// valid is the outcome reported by the handler, nil when it reported none
+	valid *bool
+}
+
+// ReportCodeAttempt tells brute-force protection whether the code a request
+// validated was valid. Handlers that answer invalid codes with 200 OK must
+// call it; otherwise 2xx responses count as valid and most 4xx as failures.
+func ReportCodeAttempt(ctx context.Context, valid bool) {
+	if attempt, ok := ctx.Value("code_attempt").(*codeAttempt); ok {
+		attempt.valid = &valid
+	}
+}
+
+// failed reports whether the attempt failed and whether it counts at all
+func (a *codeAttempt) failed(status int) (failed, counted bool) {
+	if a.valid != nil {
+		return !*a.valid, true
+	}
+	switch {
+	case status < http.StatusBadRequest:
+		return false, true
+	case status >= http.StatusInternalServerError,
+		status == http.StatusUnauthorized,
+		status == http.StatusForbidden,
+		status == http.StatusPreconditionRequired,
+		status == http.StatusTooManyRequests:
+		return false, false
+	}
+	return true, true
+}
+
+// attemptScope is one key an attempt is counted under
+type attemptScope struct {
+	name   string
+	key    string
+	policy AttemptPolicy
+}
+
+// BruteForceGuard protects code validation endpoints. The code space is
+// small enough to enumerate, so failures are counted per client IP, per
+// authenticated caller and optionally per code prefix; reaching a limit
+// locks the IP, caller or prefix out for a period that doubles with every
+// repeat. Clients with a few failures can be asked to
+// complete a CAPTCHA first. Store failures let requests through, like the
+// rate limiter.
+type BruteForceGuard struct {
+	store  AttemptStore
+	config *BruteForceConfig
+	logger *slog.Logger
+	clock  clock.Clock
+}
+
+// NewBruteForceGuard creates a brute-force guard
+func NewBruteForceGuard(store AttemptStore, config *BruteForceConfig) *BruteForceGuard {
+	if config == nil {
+		config = DefaultBruteForceConfig()
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &BruteForceGuard{store: store, config: config, logger: logger, clock: clock.OrReal(config.Clock)}
+}
+
+// attempt returns the attempt a request makes
+func (g *BruteForceGuard) attempt(r *http.Request) *codeAttempt {
+	attempt := &codeAttempt{}
+	if g.config.ClientIP != nil {
+		attempt.ip = g.config.ClientIP(r)
+	} else {
+		attempt.ip = clientIP(r)
+	}
+	if g.config.SubjectKey != nil {
+		attempt.subject = g.config.SubjectKey(r)
+	} else if claims := GetJWTClaims(r.Context()); claims != nil {
+		attempt.subject = string(claims.Principal()) + ":" + claims.PrincipalID()
+	}
+
+	code := ""
+	if g.config.Code != nil {
+		code = g.config.Code(r)
+	} else {
+		code = CodeFromJSONBody(r)
+	}
+	if g.config.PrefixLength > 0 && len(code) >= g.config.PrefixLength {
+		attempt.prefix = code[:g.config.PrefixLength]
+	}
+	return attempt
+}
+
+// scopes returns the keys an attempt is counted under
+func (g *BruteForceGuard) scopes(attempt *codeAttempt) []attemptScope {
+	var scopes []attemptScope
+	if attempt.ip != "" && g.config.IP.enabled() {
+		scopes = append(scopes, attemptScope{name: "ip", key: "ip:" + attempt.ip, policy: g.config.IP})
+	}
+	if attempt.subject != "" && g.config.Subject.enabled() {
+		scopes = append(scopes, attemptScope{name: "subject", key: "subject:" + attempt.subject, policy: g.config.Subject})
+	}
+	if attempt.prefix != "" && g.config.Prefix.enabled() {
+		scopes = append(scopes, attemptScope{name: "prefix", key: "prefix:" + attempt.prefix, policy: g.config.Prefix})
+	}
+	return scopes
+}
+
+// check reserves the attempt a request makes under each of its scopes, or
+// returns an error to respond with when its IP, caller or code prefix is
+// locked out or it needs a challenge
+func (g *BruteForceGuard) check(r *http.Request, header http.Header) (*codeAttempt, *types.APIError) {
+	ctx := r.Context()
+	attempt := g.attempt(r)
+	now := g.clock.Now()
+
+	// Failures before this attempt
+	var ipFailures int64
+	for _, scope := range g.scopes(attempt) {
+		failures, lockedUntil, err := g.store.Reserve(ctx, scope.key, scope.policy, now)
+		if err != nil {
+			g.failOpen(ctx, attempt, err)
+			return attempt, nil
+		}
+		if !lockedUntil.IsZero() {
+			g.refund(ctx, attempt)
+			g.record("locked_out")
+			header.Set("Retry-After", strconv.Itoa(int(math.Ceil(lockedUntil.Sub(now).Seconds()))))
+			return nil, types.NewAPIError(types.ErrCodeRateLimited, "Too many failed attempts, try again later")
+		}
+		attempt.reserved = append(attempt.reserved, scope)
+		if scope.name == "ip" {
+			ipFailures = failures - 1
+		}
+	}
+
+	if g.config.Challenge == nil || g.config.ChallengeAfter <= 0 || ipFailures < g.config.ChallengeAfter {
+		return attempt, nil
+	}
+	token := r.Header.Get(ChallengeTokenHeader)
+	if token == "" {
+		g.refund(ctx, attempt)
+		g.record("challenge_required")
+		return nil, types.NewAPIError(types.ErrCodeChallengeRequired, "Complete the challenge to continue")
+	}
+	ok, err := g.config.Challenge.Verify(ctx, token, attempt.ip)
+	if err != nil {
+		g.failOpen(ctx, attempt, fmt.Errorf("failed to verify challenge: %w", err))
+		return attempt, nil
+	}
+	if !ok {
+		g.refund(ctx, attempt)
+		g.record("challenge_failed")
+		g.audit(ctx, &types.CodeValidationBlocked{
+			Reason:    "challenge_failed",
+			Scope:     "ip",
+			IPAddress: attempt.ip,
+			Failures:  ipFailures,
+		})
+		return nil, types.NewAPIError(types.ErrCodeChallengeRequired, "Challenge failed, try again")
+	}
+	return attempt, nil
+}
+
+// finish settles the attempt once the handler has responded with status.
+// Attempts that didn't fail are refunded; a valid code doesn't clear
+// earlier failures, or one known code would let a client guess freely.
+func (g *BruteForceGuard) finish(ctx context.Context, attempt *codeAttempt, status int) {
+	ctx = context.WithoutCancel(ctx)
+	if failed, counted := attempt.failed(status); !failed || !counted {
+		g.refund(ctx, attempt)
+		return
+	}
+
+	g.record("failure")
+	now := g.clock.Now()
+	for _, scope := range attempt.reserved {
+		failures, lockedUntil, err := g.store.RecordFailure(ctx, scope.key, scope.policy, now)
+		if err != nil {
+			g.failOpen(ctx, attempt, err)
+			return
+		}
+		if lockedUntil.IsZero() {
+			continue
+		}
+
+		g.record("lockout")
+		g.logger.WarnContext(ctx, "code validation locked out",
+			"scope", scope.name,
+			"ip", attempt.ip,
+			"subject", attempt.subject,
+			"code_prefix", attempt.prefix,
+			"failures", failures,
+			"locked_until", lockedUntil,
+			"correlation_id", GetCorrelationID(ctx),
+		)
+		event := &types.CodeValidationBlocked{
+			Reason:      "locked_out",
+			Scope:       scope.name,
+			IPAddress:   attempt.ip,
+			Failures:    failures,
+			LockedUntil: &lockedUntil,
+		}
+		switch scope.name {
+		case "subject":
+			event.Subject = attempt.subject
+		case "prefix":
+			event.CodePrefix = attempt.prefix
+		}
+		g.audit(ctx, event)
+	}
+}
+
+// refund takes back the attempt's reservations
+func (g *BruteForceGuard) refund(ctx context.Context, attempt *codeAttempt) {
+	for _, scope := range attempt.reserved {
+		if err := g.store.Refund(ctx, scope.key); err != nil {
+			g.failOpen(ctx, attempt, err)
+			return
+		}
+	}
+	attempt.reserved = nil
+}
+
+// audit hands an event to the audit function, with the request
+// fingerprint when there is one
+func (g *BruteForceGuard) audit(ctx context.Context, event *types.CodeValidationBlocked) {
+	if g.config.Audit == nil {
+		return
+	}
+	if fingerprint := GetFingerprint(ctx); fingerprint != nil {
+		event.Fingerprint = fingerprint.ID
+	}
+	g.config.Audit(ctx, event)
+}
+
+// failOpen logs a store or verifier failure that let the request through
+func (g *BruteForceGuard) failOpen(ctx context.Context, attempt *codeAttempt, err error) {
+	g.record("error")
+	g.logger.WarnContext(ctx, "brute-force protection unavailable, allowing request",
+		"ip", attempt.ip,
+		"correlation_id", GetCorrelationID(ctx),
+		"error", err.Error(),
+	)
+}
+
+// record records an attempt outcome
+func (g *BruteForceGuard) record(outcome string) {
+	if g.config.Metrics != nil {
+		g.config.Metrics.RecordBruteForce(outcome)
+	}
+}
+
+// Middleware guards a code validation handler. Locked out clients get 429
+// Too Many Requests with Retry-After, and clients that need a challenge get
+// 428 challenge_required until they send a valid ChallengeTokenHeader.
+func (g *BruteForceGuard) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempt, apiErr := g.check(r, w.Header())
+			if apiErr != nil {
+				RenderError(w, r, apiErr)
+				return
+			}
+
+			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			r = r.WithContext(context.WithValue(r.Context(), "code_attempt", attempt))
+			next.ServeHTTP(wrapped, r)
+			g.finish(r.Context(), attempt, wrapped.statusCode)
+		})
+	}
+}
+
+// GinMiddleware is the Gin version of Middleware
+func (g *BruteForceGuard) GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		attempt, apiErr := g.check(c.Request, c.Writer.Header())
+		if apiErr != nil {
+			GinRenderError(c, apiErr)
+			return
+		}
+
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), "code_attempt", attempt))
+		c.Next()
+		g.finish(c.Request.Context(), attempt, c.Writer.Status())
+	}
+}
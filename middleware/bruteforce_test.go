@@ -0,0 +1,516 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestAttemptPolicyLockoutFor(t *testing.T) {
+	policy := AttemptPolicy{Lockout: time.Minute, MaxLockout: 5 * time.Minute}
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, lockout := range expected {
+		if got := policy.lockoutFor(int64(i + 1)); got != lockout {
+			t.Errorf("Expected lockout %d to last %v, got %v", i+1, lockout, got)
+		}
+	}
+}
+
+func TestAttemptStores(t *testing.T) {
+	server := miniredis.RunT(t)
+	stores := map[string]AttemptStore{
+		"memory": NewMemoryAttemptStore(),
+		"redis":  NewRedisAttemptStore(redis.NewClient(&redis.Options{Addr: server.Addr()})),
+	}
+	policy := AttemptPolicy{MaxFailures: 2, Window: time.Minute, Lockout: time.Minute, MaxLockout: time.Hour, Decay: time.Hour}
+	now := time.Date(2026, 3, 15, 13, 45, 0, 0, time.UTC)
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if failures, lockedUntil, err := store.Reserve(ctx, "ip:1", policy, now); err != nil || failures != 1 || !lockedUntil.IsZero() {
+				t.Fatalf("Expected a first attempt, got %d, %v, %v", failures, lockedUntil, err)
+			}
+			if failures, lockedUntil, _ := store.RecordFailure(ctx, "ip:1", policy, now); failures != 1 || !lockedUntil.IsZero() {
+				t.Errorf("Expected a first failure without a lockout, got %d, %v", failures, lockedUntil)
+			}
+			store.Reserve(ctx, "ip:1", policy, now)
+
+			// Attempts still running use up the window
+			if _, lockedUntil, _ := store.Reserve(ctx, "ip:1", policy, now); !lockedUntil.Equal(now.Add(time.Minute)) {
+				t.Errorf("Expected a fully reserved window to refuse attempts, got %v", lockedUntil)
+			}
+			failures, lockedUntil, _ := store.RecordFailure(ctx, "ip:1", policy, now)
+			if failures != 2 || !lockedUntil.Equal(now.Add(time.Minute)) {
+				t.Errorf("Expected the second failure to lock out for a minute, got %d, %v", failures, lockedUntil)
+			}
+			if _, lockedUntil, _ := store.Reserve(ctx, "ip:1", policy, now.Add(30*time.Second)); !lockedUntil.Equal(now.Add(time.Minute)) {
+				t.Errorf("Expected a locked out key, got %v", lockedUntil)
+			}
+			if _, lockedUntil, _ := store.Reserve(ctx, "ip:2", policy, now); !lockedUntil.IsZero() {
+				t.Errorf("Expected keys to be counted separately")
+			}
+
+			// The second lockout within the decay period doubles
+			later := now.Add(2 * time.Minute)
+			for i := 0; i < 2; i++ {
+				if _, lockedUntil, _ := store.Reserve(ctx, "ip:1", policy, later); !lockedUntil.IsZero() {
+					t.Fatalf("Expected a new window after the lockout, got %v", lockedUntil)
+				}
+			}
+			if _, lockedUntil, _ := store.RecordFailure(ctx, "ip:1", policy, later); !lockedUntil.Equal(later.Add(2 * time.Minute)) {
+				t.Errorf("Expected a 2 minute lockout, got %v", lockedUntil)
+			}
+			if _, lockedUntil, _ := store.RecordFailure(ctx, "ip:1", policy, later); !lockedUntil.IsZero() {
+				t.Errorf("Expected one lockout for the window, got %v", lockedUntil)
+			}
+
+			// Refunded attempts don't count
+			store.Reserve(ctx, "ip:3", policy, now)
+			if err := store.Refund(ctx, "ip:3"); err != nil {
+				t.Fatalf("Unexpected refund error: %v", err)
+			}
+			store.Refund(ctx, "ip:3")
+			if failures, _, _ := store.Reserve(ctx, "ip:3", policy, now); failures != 1 {
+				t.Errorf("Expected the refund to take back the attempt without going below zero, got %d", failures)
+			}
+			if err := store.Reset(ctx, "ip:3"); err != nil {
+				t.Fatalf("Unexpected reset error: %v", err)
+			}
+			if failures, _, _ := store.Reserve(ctx, "ip:3", policy, now); failures != 1 {
+				t.Errorf("Expected reset to clear failures, got %d", failures)
+			}
+		})
+	}
+}
+
+func TestAttemptStoresExpire(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := NewRedisAttemptStore(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	policy := AttemptPolicy{MaxFailures: 1, Window: time.Minute, Lockout: time.Minute, Decay: time.Hour}
+	store.Reserve(context.Background(), "ip:1", policy, time.Now())
+	store.RecordFailure(context.Background(), "ip:1", policy, time.Now())
+
+	server.FastForward(time.Hour)
+	if keys := server.Keys(); len(keys) != 0 {
+		t.Errorf("Expected attempts to expire, have %v", keys)
+	}
+}
+
+func TestMemoryAttemptStoreSweeps(t *testing.T) {
+	store := NewMemoryAttemptStore()
+	policy := AttemptPolicy{MaxFailures: 5, Window: time.Minute, Lockout: time.Minute}
+	now := time.Date(2026, 3, 15, 13, 45, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	for _, key := range []string{"ip:1", "ip:2", "ip:3"} {
+		store.Reserve(ctx, key, policy, now)
+	}
+
+	// Expired records are only swept once a minute, not on every attempt
+	store.Reserve(ctx, "ip:4", policy, now.Add(59*time.Second))
+	if len(store.records) != 4 {
+		t.Errorf("Expected no sweep within a minute, have %d records", len(store.records))
+	}
+	store.Reserve(ctx, "ip:5", policy, now.Add(time.Minute))
+	if len(store.records) != 2 {
+		t.Errorf("Expected expired records to be swept, have %d", len(store.records))
+	}
+}
+
+func TestCodeFromJSONBody(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(`{"code":"abc-123","validator":"gate-1"}`))
+	if code := CodeFromJSONBody(r); code != "ABC123" {
+		t.Errorf("Expected the normalized code, got %q", code)
+	}
+	body, _ := io.ReadAll(r.Body)
+	if string(body) != `{"code":"abc-123","validator":"gate-1"}` {
+		t.Errorf("Expected the body to be left for the handler, got %s", body)
+	}
+
+	for _, body := range []string{"", "not json", `{"code":"12"}`} {
+		r := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(body))
+		if code := CodeFromJSONBody(r); code != "" {
+			t.Errorf("Expected no code from %q, got %q", body, code)
+		}
+	}
+}
+
+// validateCode is a validation handler that answers invalid codes with 200 OK
+func validateCode(w http.ResponseWriter, r *http.Request) {
+	var request types.CodeValidationRequest
+	json.NewDecoder(r.Body).Decode(&request)
+	valid := request.Code == "123456"
+	ReportCodeAttempt(r.Context(), valid)
+	json.NewEncoder(w).Encode(types.CodeValidationResponse{Valid: valid})
+}
+
+func TestBruteForceGuardLocksOutIP(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 3, 15, 13, 45, 0, 0, time.UTC))
+	var events []*types.CodeValidationBlocked
+	config := DefaultBruteForceConfig()
+	config.IP.MaxFailures = 3
+	config.Clock = fake
+	config.Audit = func(ctx context.Context, event *types.CodeValidationBlocked) {
+		events = append(events, event)
+	}
+	guard := NewBruteForceGuard(NewMemoryAttemptStore(), config)
+	handler := guard.Middleware()(http.HandlerFunc(validateCode))
+
+	serve := func(code, ip string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(`{"code":"`+code+`"}`))
+		r.RemoteAddr = ip + ":1234"
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	for _, code := range []string{"000001", "000002", "000003"} {
+		if recorder := serve(code, "10.0.0.1"); recorder.Code != http.StatusOK {
+			t.Fatalf("Expected guesses to reach the handler, got %d", recorder.Code)
+		}
+	}
+	recorder := serve("123456", "10.0.0.1")
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected the IP to be locked out for a minute, got %d %v", recorder.Code, recorder.Header())
+	}
+	if len(events) != 1 || events[0].Reason != "locked_out" || events[0].Scope != "ip" || events[0].IPAddress != "10.0.0.1" {
+		t.Errorf("Expected a lockout audit event, got %+v", events)
+	}
+	if recorder := serve("123456", "10.0.0.2"); recorder.Code != http.StatusOK {
+		t.Errorf("Expected other IPs not to be locked out, got %d", recorder.Code)
+	}
+
+	// The next lockout is twice as long
+	fake.Advance(time.Minute)
+	for _, code := range []string{"000004", "000005", "000006"} {
+		serve(code, "10.0.0.1")
+	}
+	if recorder := serve("123456", "10.0.0.1"); recorder.Header().Get("Retry-After") != "120" {
+		t.Errorf("Expected a 2 minute lockout, got %v", recorder.Header())
+	}
+
+}
+
+func TestBruteForceGuardValidCodeKeepsFailures(t *testing.T) {
+	config := DefaultBruteForceConfig()
+	config.IP.MaxFailures = 3
+	guard := NewBruteForceGuard(NewMemoryAttemptStore(), config)
+	handler := guard.Middleware()(http.HandlerFunc(validateCode))
+
+	serve := func(code string) int {
+		r := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(`{"code":"`+code+`"}`))
+		r.RemoteAddr = "10.0.0.1:1234"
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		return recorder.Code
+	}
+
+	// A known valid code interleaved with guesses doesn't reset the count
+	for _, code := range []string{"000001", "123456", "000002", "123456", "000003"} {
+		if status := serve(code); status != http.StatusOK {
+			t.Fatalf("Expected %s to reach the handler, got %d", code, status)
+		}
+	}
+	if status := serve("123456"); status != http.StatusTooManyRequests {
+		t.Errorf("Expected the IP to be locked out after 3 guesses, got %d", status)
+	}
+}
+
+func TestBruteForceGuardConcurrentGuesses(t *testing.T) {
+	config := DefaultBruteForceConfig()
+	config.IP.MaxFailures = 3
+	guard := NewBruteForceGuard(NewMemoryAttemptStore(), config)
+
+	entered := make(chan struct{}, 20)
+	release := make(chan struct{})
+	handler := guard.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		validateCode(w, r)
+	}))
+	serve := func(code string) int {
+		r := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(`{"code":"`+code+`"}`))
+		r.RemoteAddr = "10.0.0.1:1234"
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		return recorder.Code
+	}
+
+	// Fire a burst of wrong codes, all in flight before any has failed
+	results := make(chan int, 20)
+	for i := 0; i < 20; i++ {
+		go func(i int) { results <- serve(fmt.Sprintf("%06d", i)) }(i)
+	}
+	handled, denied := 0, 0
+	for handled+denied < 20 {
+		select {
+		case <-entered:
+			handled++
+		case status := <-results:
+			if status != http.StatusTooManyRequests {
+				t.Fatalf("Expected requests over the limit to be refused, got %d", status)
+			}
+			denied++
+		}
+	}
+	close(release)
+	for i := 0; i < handled; i++ {
+		<-results
+	}
+
+	if handled != 3 {
+		t.Errorf("Expected only 3 guesses to reach the handler, got %d", handled)
+	}
+	if status := serve("123456"); status != http.StatusTooManyRequests {
+		t.Errorf("Expected the IP to be locked out, got %d", status)
+	}
+}
+
+func TestBruteForceGuardLocksOutPrefix(t *testing.T) {
+	var events []*types.CodeValidationBlocked
+	guard := NewBruteForceGuard(NewMemoryAttemptStore(), &BruteForceConfig{
+		Prefix:       AttemptPolicy{MaxFailures: 3, Window: time.Minute, Lockout: time.Minute},
+		PrefixLength: 3,
+		Audit: func(ctx context.Context, event *types.CodeValidationBlocked) {
+			events = append(events, event)
+		},
+	})
+	handler := guard.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RenderError(w, r, types.NewNotFoundError("Code"))
+	}))
+
+	serve := func(code, ip string) int {
+		r := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(`{"code":"`+code+`"}`))
+		r.RemoteAddr = ip + ":1234"
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		return recorder.Code
+	}
+
+	// Guesses spread over several IPs still count against the prefix
+	serve("123001", "10.0.0.1")
+	serve("123002", "10.0.0.2")
+	serve("123003", "10.0.0.3")
+	if status := serve("123004", "10.0.0.4"); status != http.StatusTooManyRequests {
+		t.Errorf("Expected the prefix to be locked out, got %d", status)
+	}
+	if status := serve("124004", "10.0.0.4"); status != http.StatusNotFound {
+		t.Errorf("Expected other prefixes to reach the handler, got %d", status)
+	}
+	if len(events) != 1 || events[0].Scope != "prefix" || events[0].CodePrefix != "123" {
+		t.Errorf("Expected a prefix lockout audit event, got %+v", events)
+	}
+}
+
+func TestBruteForceGuardLocksOutSubject(t *testing.T) {
+	var events []*types.CodeValidationBlocked
+	config := DefaultBruteForceConfig()
+	config.Subject.MaxFailures = 3
+	config.Audit = func(ctx context.Context, event *types.CodeValidationBlocked) {
+		events = append(events, event)
+	}
+	guard := NewBruteForceGuard(NewMemoryAttemptStore(), config)
+	handler := guard.Middleware()(http.HandlerFunc(validateCode))
+
+	serve := func(userID, code, ip string) int {
+		r := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(`{"code":"`+code+`"}`))
+		r = r.WithContext(WithJWTClaims(r.Context(), &types.JWTClaims{UserID: userID, TokenType: types.TokenTypeAccess}))
+		r.RemoteAddr = ip + ":1234"
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		return recorder.Code
+	}
+
+	// Guesses spread over several IPs count against the caller
+	serve("user-1", "123001", "10.0.0.1")
+	serve("user-1", "123002", "10.0.0.2")
+	serve("user-1", "123003", "10.0.0.3")
+	if status := serve("user-1", "123456", "10.0.0.4"); status != http.StatusTooManyRequests {
+		t.Errorf("Expected the caller to be locked out, got %d", status)
+	}
+	// Other callers, even with codes sharing the prefix, are unaffected
+	if status := serve("user-2", "123456", "10.0.0.4"); status != http.StatusOK {
+		t.Errorf("Expected other callers to reach the handler, got %d", status)
+	}
+	if len(events) != 1 || events[0].Scope != "subject" || events[0].Subject != "user:user-1" {
+		t.Errorf("Expected a subject lockout audit event, got %+v", events)
+	}
+}
+
+func TestBruteForceGuardPrefixOffByDefault(t *testing.T) {
+	config := DefaultBruteForceConfig()
+	config.IP.MaxFailures = 0
+	guard := NewBruteForceGuard(NewMemoryAttemptStore(), config)
+	handler := guard.Middleware()(http.HandlerFunc(validateCode))
+
+	// Anonymous guesses from many IPs can't lock out a valid code's prefix
+	for i := 0; i < 100; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(`{"code":"123000"}`))
+		r.RemoteAddr = fmt.Sprintf("10.0.%d.%d:1234", i/250, i%250)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(`{"code":"123456"}`))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected the valid code to reach the handler, got %d", recorder.Code)
+	}
+}
+
+func TestBruteForceGuardChallenge(t *testing.T) {
+	var verified []string
+	config := DefaultBruteForceConfig()
+	config.ChallengeAfter = 2
+	config.Challenge = ChallengeVerifierFunc(func(ctx context.Context, token, remoteIP string) (bool, error) {
+		verified = append(verified, token+"@"+remoteIP)
+		if token == "broken" {
+			return false, errors.New("verifier unavailable")
+		}
+		return token == "solved", nil
+	})
+	var events []*types.CodeValidationBlocked
+	config.Audit = func(ctx context.Context, event *types.CodeValidationBlocked) {
+		events = append(events, event)
+	}
+	guard := NewBruteForceGuard(NewMemoryAttemptStore(), config)
+	handler := guard.Middleware()(http.HandlerFunc(validateCode))
+
+	serve := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(`{"code":"000000"}`))
+		r.RemoteAddr = "10.0.0.1:1234"
+		if token != "" {
+			r.Header.Set(ChallengeTokenHeader, token)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	serve("")
+	serve("")
+	recorder := serve("")
+	var body map[string]interface{}
+	json.Unmarshal(recorder.Body.Bytes(), &body)
+	if recorder.Code != http.StatusPreconditionRequired || body["error"] != "challenge_required" {
+		t.Errorf("Expected a challenge after 2 failures, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if len(verified) != 0 {
+		t.Errorf("Expected no verification without a token, got %v", verified)
+	}
+
+	if recorder := serve("wrong"); recorder.Code != http.StatusPreconditionRequired {
+		t.Errorf("Expected a failed challenge to be refused, got %d", recorder.Code)
+	}
+	if len(events) != 1 || events[0].Reason != "challenge_failed" || events[0].Failures != 2 {
+		t.Errorf("Expected a failed challenge audit event, got %+v", events)
+	}
+	if recorder := serve("solved"); recorder.Code != http.StatusOK {
+		t.Errorf("Expected a solved challenge to reach the handler, got %d", recorder.Code)
+	}
+	if recorder := serve("broken"); recorder.Code != http.StatusOK {
+		t.Errorf("Expected verifier errors to let the request through, got %d", recorder.Code)
+	}
+	if verified[0] != "wrong@10.0.0.1" {
+		t.Errorf("Expected the token and client IP to be verified, got %v", verified)
+	}
+}
+
+func TestBruteForceGuardStatusOutcomes(t *testing.T) {
+	tests := []struct {
+		status  int
+		failed  bool
+		counted bool
+	}{
+		{http.StatusOK, false, true},
+		{http.StatusNotFound, true, true},
+		{http.StatusGone, true, true},
+		{http.StatusUnprocessableEntity, true, true},
+		{http.StatusUnauthorized, false, false},
+		{http.StatusTooManyRequests, false, false},
+		{http.StatusServiceUnavailable, false, false},
+	}
+	for _, tt := range tests {
+		failed, counted := (&codeAttempt{}).failed(tt.status)
+		if failed != tt.failed || counted != tt.counted {
+			t.Errorf("Expected %d to give %v, %v, got %v, %v", tt.status, tt.failed, tt.counted, failed, counted)
+		}
+	}
+}
+
+// failingAttemptStore fails every call
+type failingAttemptStore struct{}
+
+func (failingAttemptStore) Reserve(ctx context.Context, key string, policy AttemptPolicy, now time.Time) (int64, time.Time, error) {
+	return 0, time.Time{}, errors.New("connection refused")
+}
+
+func (failingAttemptStore) RecordFailure(ctx context.Context, key string, policy AttemptPolicy, now time.Time) (int64, time.Time, error) {
+	return 0, time.Time{}, errors.New("connection refused")
+}
+
+func (failingAttemptStore) Refund(ctx context.Context, key string) error {
+	return errors.New("connection refused")
+}
+
+func (failingAttemptStore) Reset(ctx context.Context, key string) error {
+	return errors.New("connection refused")
+}
+
+func TestBruteForceGuardFailsOpen(t *testing.T) {
+	var logs bytes.Buffer
+	config := DefaultBruteForceConfig()
+	config.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	handler := NewBruteForceGuard(failingAttemptStore{}, config).Middleware()(http.HandlerFunc(validateCode))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(`{"code":"000000"}`)))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected store failures to let the request through, got %d", recorder.Code)
+	}
+	if !strings.Contains(logs.String(), "brute-force protection unavailable") {
+		t.Errorf("Expected the failure to be logged, got %s", logs.String())
+	}
+}
+
+func TestGinBruteForceGuard(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := DefaultBruteForceConfig()
+	config.IP.MaxFailures = 2
+	guard := NewBruteForceGuard(NewMemoryAttemptStore(), config)
+
+	router := gin.New()
+	router.POST("/validate", guard.GinMiddleware(), func(c *gin.Context) {
+		var request types.CodeValidationRequest
+		c.ShouldBindJSON(&request)
+		ReportCodeAttempt(c.Request.Context(), false)
+		c.JSON(http.StatusOK, types.CodeValidationResponse{Valid: false})
+	})
+	serve := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(`{"code":"000000"}`))
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	serve()
+	serve()
+	if recorder := serve(); recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected the client to be locked out, got %d %v", recorder.Code, recorder.Header())
+	}
+}
@@ -0,0 +1,314 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// OverflowLabelValue replaces label values beyond a cardinality limit
+const OverflowLabelValue = "__overflow__"
+
+// CardinalityConfig holds the configuration for a CardinalityGuard
+type CardinalityConfig struct {
+	// MaxLabelValues is how many distinct values each label of a metric
+	// family may have; further values are collapsed into OverflowLabelValue.
+	// 0 or less disables the limit.
+	MaxLabelValues int `json:"max_label_values"`
+
+	// Limits overrides MaxLabelValues per metric family, e.g.
+	// {"http_requests_total": 500}
+	Limits map[string]int `json:"limits,omitempty"`
+
+	// Drop leaves series with collapsed values out of scrapes instead of
+	// adding them up into one overflow series
+	Drop bool `json:"drop"`
+
+	// AuditInterval is how often Start audits the registry
+	AuditInterval time.Duration `json:"audit_interval"`
+
+	Gatherer prometheus.Gatherer `json:"-"` // nil uses prometheus.DefaultGatherer
+	Logger   *slog.Logger        `json:"-"` // nil uses slog.Default
+	Metrics  *MetricsRegistry    `json:"-"` // nil disables metrics
+}
+
+// DefaultCardinalityConfig returns a configuration allowing 200 values per
+// label, audited every minute
+func DefaultCardinalityConfig() *CardinalityConfig {
+	return &CardinalityConfig{
+		MaxLabelValues: 200,
+		AuditInterval:  time.Minute,
+	}
+}
+
+// FamilyCardinality is the audit of one metric family
+type FamilyCardinality struct {
+	Name        string         `json:"name"`
+	Series      int            `json:"series"`
+	LabelValues map[string]int `json:"label_values"`      // Distinct values per label
+	Limited     []string       `json:"limited,omitempty"` // Labels over the limit
+}
+
+// CardinalityGuard audits the series in a Prometheus registry and limits
+// label cardinality in scrapes. A label that starts taking unbounded values,
+// such as a raw path or an organization ID, keeps its first values and has
+// the rest collapsed, so one bad label can't take down scraping. The
+// process still holds the original series; the audit points at the label
+// to fix.
+type CardinalityGuard struct {
+	config   *CardinalityConfig
+	gatherer prometheus.Gatherer
+	logger   *slog.Logger
+
+	// admitted holds the values each family's labels may keep, first come
+	// first served, so the kept series are stable between scrapes
+	admitted map[string]map[string]map[string]bool
+	mutex    sync.Mutex
+}
+
+// NewCardinalityGuard creates a cardinality guard
+func NewCardinalityGuard(config *CardinalityConfig) *CardinalityGuard {
+	if config == nil {
+		config = DefaultCardinalityConfig()
+	}
+	gatherer := config.Gatherer
+	if gatherer == nil {
+		gatherer = prometheus.DefaultGatherer
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &CardinalityGuard{
+		config:   config,
+		gatherer: gatherer,
+		logger:   logger,
+		admitted: make(map[string]map[string]map[string]bool),
+	}
+}
+
+// limit returns the label value limit for a family
+func (g *CardinalityGuard) limit(family string) int {
+	if limit, ok := g.config.Limits[family]; ok {
+		return limit
+	}
+	return g.config.MaxLabelValues
+}
+
+// Audit counts the series and distinct label values of every metric
+// family, largest families first. Families with labels over their limit
+// are logged and, with metrics enabled, recorded.
+func (g *CardinalityGuard) Audit(ctx context.Context) ([]FamilyCardinality, error) {
+	families, err := g.gatherer.Gather()
+	if err != nil && len(families) == 0 {
+		return nil, err
+	}
+
+	audit := make([]FamilyCardinality, 0, len(families))
+	for _, family := range families {
+		values := make(map[string]map[string]bool)
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if values[label.GetName()] == nil {
+					values[label.GetName()] = make(map[string]bool)
+				}
+				values[label.GetName()][label.GetValue()] = true
+			}
+		}
+
+		result := FamilyCardinality{
+			Name:        family.GetName(),
+			Series:      len(family.GetMetric()),
+			LabelValues: make(map[string]int, len(values)),
+		}
+		limit := g.limit(result.Name)
+		for label, distinct := range values {
+			result.LabelValues[label] = len(distinct)
+			if limit > 0 && len(distinct) > limit {
+				result.Limited = append(result.Limited, label)
+			}
+		}
+		sort.Strings(result.Limited)
+		audit = append(audit, result)
+
+		if g.config.Metrics != nil {
+			g.config.Metrics.RecordMetricCardinality(result.Name, result.Series)
+			for _, label := range result.Limited {
+				g.config.Metrics.RecordLimitedLabel(result.Name, label, result.LabelValues[label])
+			}
+		}
+		for _, label := range result.Limited {
+			g.logger.WarnContext(ctx, "metric label over cardinality limit",
+				"family", result.Name, "label", label, "values", result.LabelValues[label], "limit", limit)
+		}
+	}
+
+	sort.Slice(audit, func(i, j int) bool {
+		if audit[i].Series != audit[j].Series {
+			return audit[i].Series > audit[j].Series
+		}
+		return audit[i].Name < audit[j].Name
+	})
+	return audit, err
+}
+
+// Start audits the registry every AuditInterval until ctx is cancelled
+func (g *CardinalityGuard) Start(ctx context.Context) {
+	interval := g.config.AuditInterval
+	if interval <= 0 {
+		interval = DefaultCardinalityConfig().AuditInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := g.Audit(ctx); err != nil {
+					g.logger.WarnContext(ctx, "metrics cardinality audit failed", "error", err.Error())
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Gather implements prometheus.Gatherer, returning the registry's metrics
+// with label values over their limit collapsed
+func (g *CardinalityGuard) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	for _, family := range families {
+		if limit := g.limit(family.GetName()); limit > 0 {
+			family.Metric = g.collapse(family, limit)
+		}
+	}
+	return families, err
+}
+
+// collapse returns a family's metrics with label values beyond the limit
+// replaced by OverflowLabelValue and the resulting duplicates added up.
+// Summaries can't be added up, so their overflow series are dropped.
+func (g *CardinalityGuard) collapse(family *dto.MetricFamily, limit int) []*dto.Metric {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	admitted := g.admitted[family.GetName()]
+	if admitted == nil {
+		admitted = make(map[string]map[string]bool)
+		g.admitted[family.GetName()] = admitted
+	}
+
+	metrics := make([]*dto.Metric, 0, len(family.GetMetric()))
+	overflow := make(map[string]*dto.Metric)
+	for _, metric := range family.GetMetric() {
+		labels, collapsed := admit(admitted, metric.GetLabel(), limit)
+		if !collapsed {
+			metrics = append(metrics, metric)
+			continue
+		}
+		if g.config.Drop || family.GetType() == dto.MetricType_SUMMARY {
+			continue
+		}
+
+		key := labelKey(labels)
+		if existing, ok := overflow[key]; ok {
+			addMetric(existing, metric)
+			continue
+		}
+		metric.Label = labels
+		overflow[key] = metric
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// admit returns the labels with values beyond the limit replaced, and
+// whether any was
+func admit(admitted map[string]map[string]bool, labels []*dto.LabelPair, limit int) ([]*dto.LabelPair, bool) {
+	var replaced []*dto.LabelPair
+	for i, label := range labels {
+		values := admitted[label.GetName()]
+		if values == nil {
+			values = make(map[string]bool)
+			admitted[label.GetName()] = values
+		}
+		if values[label.GetValue()] {
+			continue
+		}
+		if len(values) < limit {
+			values[label.GetValue()] = true
+			continue
+		}
+		if replaced == nil {
+			replaced = append([]*dto.LabelPair(nil), labels...)
+		}
+		name, value := label.GetName(), OverflowLabelValue
+		replaced[i] = &dto.LabelPair{Name: &name, Value: &value}
+	}
+	if replaced == nil {
+		return labels, false
+	}
+	return replaced, true
+}
+
+// labelKey identifies a series by its labels
+func labelKey(labels []*dto.LabelPair) string {
+	var key strings.Builder
+	for _, label := range labels {
+		key.WriteString(label.GetName())
+		key.WriteByte('=')
+		key.WriteString(label.GetValue())
+		key.WriteByte(0)
+	}
+	return key.String()
+}
+
+// addMetric adds the values of from to into
+func addMetric(into, from *dto.Metric) {
+	add := func(a, b float64) *float64 {
+		sum := a + b
+		return &sum
+	}
+
+	switch {
+	case into.Counter != nil:
+		into.Counter.Value = add(into.Counter.GetValue(), from.GetCounter().GetValue())
+	case into.Gauge != nil:
+		into.Gauge.Value = add(into.Gauge.GetValue(), from.GetGauge().GetValue())
+	case into.Untyped != nil:
+		into.Untyped.Value = add(into.Untyped.GetValue(), from.GetUntyped().GetValue())
+	case into.Histogram != nil:
+		count := into.Histogram.GetSampleCount() + from.GetHistogram().GetSampleCount()
+		into.Histogram.SampleCount = &count
+		into.Histogram.SampleSum = add(into.Histogram.GetSampleSum(), from.GetHistogram().GetSampleSum())
+		for i, bucket := range into.Histogram.GetBucket() {
+			if i < len(from.GetHistogram().GetBucket()) {
+				cumulative := bucket.GetCumulativeCount() + from.GetHistogram().GetBucket()[i].GetCumulativeCount()
+				bucket.CumulativeCount = &cumulative
+			}
+		}
+	}
+}
+
+// HTTPHandler returns a metrics endpoint serving the guarded metrics, in
+// place of MetricsRegistry.HTTPHandler
+func (g *CardinalityGuard) HTTPHandler() http.Handler {
+	return promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+}
+
+// GinHandler returns the guarded metrics endpoint for Gin framework
+func (g *CardinalityGuard) GinHandler() gin.HandlerFunc {
+	return gin.WrapH(g.HTTPHandler())
+}
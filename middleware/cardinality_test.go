@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// newCardinalityRegistry returns a registry with a counter per path and a
+// histogram per organization
+func newCardinalityRegistry(t *testing.T, paths, orgs int) *prometheus.Registry {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_requests_total", Help: "Requests"}, []string{"method", "path"})
+	durations := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test_duration_seconds", Help: "Durations", Buckets: []float64{0.1, 1}}, []string{"org"})
+	registry.MustRegister(requests, durations)
+
+	for i := 0; i < paths; i++ {
+		requests.WithLabelValues("GET", fmt.Sprintf("/codes/%02d", i)).Add(float64(i + 1))
+	}
+	for i := 0; i < orgs; i++ {
+		durations.WithLabelValues(fmt.Sprintf("org-%02d", i)).Observe(0.05)
+	}
+	return registry
+}
+
+// findFamily returns the named family from a gather
+func findFamily(t *testing.T, families []*dto.MetricFamily, name string) *dto.MetricFamily {
+	t.Helper()
+	for _, family := range families {
+		if family.GetName() == name {
+			return family
+		}
+	}
+	t.Fatalf("Family %s not gathered", name)
+	return nil
+}
+
+// labelValue returns a metric's value for a label
+func labelValue(metric *dto.Metric, name string) string {
+	for _, label := range metric.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
+func TestCardinalityGuardAudit(t *testing.T) {
+	guard := NewCardinalityGuard(&CardinalityConfig{
+		MaxLabelValues: 5,
+		Limits:         map[string]int{"test_duration_seconds": 10},
+		Gatherer:       newCardinalityRegistry(t, 8, 6),
+		Metrics:        NewMetricsRegistry("test-service"),
+	})
+
+	audit, err := guard.Audit(context.Background())
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	if len(audit) != 2 || audit[0].Name != "test_requests_total" || audit[0].Series != 8 {
+		t.Fatalf("Expected the largest family first, got %+v", audit)
+	}
+	if audit[0].LabelValues["path"] != 8 || audit[0].LabelValues["method"] != 1 {
+		t.Errorf("Unexpected label values %v", audit[0].LabelValues)
+	}
+	if len(audit[0].Limited) != 1 || audit[0].Limited[0] != "path" {
+		t.Errorf("Expected path to be over the limit, got %v", audit[0].Limited)
+	}
+	if len(audit[1].Limited) != 0 {
+		t.Errorf("Expected the per-family limit to apply, got %v", audit[1].Limited)
+	}
+}
+
+func TestCardinalityGuardAggregatesOverflow(t *testing.T) {
+	registry := newCardinalityRegistry(t, 8, 6)
+	guard := NewCardinalityGuard(&CardinalityConfig{MaxLabelValues: 5, Gatherer: registry})
+
+	families, err := guard.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+
+	requests := findFamily(t, families, "test_requests_total")
+	if len(requests.GetMetric()) != 6 {
+		t.Fatalf("Expected 5 paths and an overflow series, got %d series", len(requests.GetMetric()))
+	}
+	var overflow *dto.Metric
+	for _, metric := range requests.GetMetric() {
+		if labelValue(metric, "path") == OverflowLabelValue {
+			overflow = metric
+		}
+	}
+	if overflow == nil {
+		t.Fatal("Expected an overflow series")
+	}
+	if labelValue(overflow, "method") != "GET" {
+		t.Errorf("Expected labels under the limit to be kept, got %v", overflow.GetLabel())
+	}
+	if got := overflow.GetCounter().GetValue(); got != 6+7+8 {
+		t.Errorf("Expected the overflow to add up the collapsed series, got %f", got)
+	}
+
+	durations := findFamily(t, families, "test_duration_seconds")
+	if len(durations.GetMetric()) != 6 {
+		t.Fatalf("Expected 5 orgs and an overflow series, got %d series", len(durations.GetMetric()))
+	}
+	for _, metric := range durations.GetMetric() {
+		if labelValue(metric, "org") == OverflowLabelValue && metric.GetHistogram().GetSampleCount() != 1 {
+			t.Errorf("Expected one sample in the overflow histogram, got %d", metric.GetHistogram().GetSampleCount())
+		}
+	}
+}
+
+func TestCardinalityGuardKeepsAdmittedValues(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_requests_total", Help: "Requests"}, []string{"path"})
+	registry.MustRegister(requests)
+	guard := NewCardinalityGuard(&CardinalityConfig{MaxLabelValues: 2, Gatherer: registry})
+
+	requests.WithLabelValues("/b").Inc()
+	requests.WithLabelValues("/c").Inc()
+	guard.Gather()
+
+	// A value sorting first arriving later doesn't displace admitted ones
+	requests.WithLabelValues("/a").Inc()
+	families, _ := guard.Gather()
+	for _, metric := range findFamily(t, families, "test_requests_total").GetMetric() {
+		if labelValue(metric, "path") == "/a" {
+			t.Error("Expected /a to be collapsed")
+		}
+	}
+}
+
+func TestCardinalityGuardDrop(t *testing.T) {
+	guard := NewCardinalityGuard(&CardinalityConfig{MaxLabelValues: 5, Drop: true, Gatherer: newCardinalityRegistry(t, 8, 0)})
+
+	families, err := guard.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	requests := findFamily(t, families, "test_requests_total")
+	if len(requests.GetMetric()) != 5 {
+		t.Errorf("Expected only admitted series, got %d", len(requests.GetMetric()))
+	}
+}
+
+func TestCardinalityGuardHTTPHandler(t *testing.T) {
+	guard := NewCardinalityGuard(&CardinalityConfig{MaxLabelValues: 5, Gatherer: newCardinalityRegistry(t, 8, 0)})
+
+	w := httptest.NewRecorder()
+	guard.HTTPHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Body)
+	if !strings.Contains(string(body), `test_requests_total{method="GET",path="__overflow__"} 21`) {
+		t.Errorf("Expected the overflow series in the scrape, got:\n%s", body)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"sync"
 	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
 )
 
 // CircuitBreakerState represents the current state of the circuit breaker
@@ -36,6 +38,7 @@ type CircuitBreakerConfig struct {
 	Timeout        time.Duration `json:"timeout"`
 	ResetTimeout   time.Duration `json:"reset_timeout"`
 	MonitorTimeout time.Duration `json:"monitor_timeout"`
+	Clock          clock.Clock   `json:"-"` // nil uses the system clock
 }
 
 // DefaultCircuitBreakerConfig returns a default configuration
@@ -55,7 +58,11 @@ type CircuitBreaker struct {
 	failures   int
 	lastError  error
 	lastFailure time.Time
+	clock      clock.Clock
 	mutex      sync.RWMutex
+
+	onStateChange func(from, to CircuitBreakerState)
+	onFailure     func(err error)
 }
 
 // NewCircuitBreaker creates a new circuit breaker with the given configuration
@@ -67,6 +74,7 @@ func NewCircuitBreaker(config *CircuitBreakerConfig) *CircuitBreaker {
 	return &CircuitBreaker{
 		config: config,
 		state:  StateClosed,
+		clock:  clock.OrReal(config.Clock),
 	}
 }
 
@@ -92,13 +100,42 @@ func (cb *CircuitBreaker) ExecuteWithResult(ctx context.Context, fn func() (inte
 	return result, err
 }
 
-// Ready checks if the circuit breaker is ready to execute requests
-func (cb *CircuitBreaker) Ready() bool {
+// OnStateChange sets a function called after every state change, e.g. to
+// record it in metrics. It runs without the breaker's lock held.
+func (cb *CircuitBreaker) OnStateChange(fn func(from, to CircuitBreakerState)) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.onStateChange = fn
+}
+
+// OnFailure sets a function called after every failed call
+func (cb *CircuitBreaker) OnFailure(fn func(err error)) {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
+	cb.onFailure = fn
+}
+
+// lock locks the breaker and returns a function that unlocks it and then
+// reports a state change made while it was held
+func (cb *CircuitBreaker) lock() (unlock func()) {
+	cb.mutex.Lock()
+	from := cb.state
+	return func() {
+		to, fn := cb.state, cb.onStateChange
+		cb.mutex.Unlock()
+		if fn != nil && from != to {
+			fn(from, to)
+		}
+	}
+}
+
+// Ready checks if the circuit breaker is ready to execute requests
+func (cb *CircuitBreaker) Ready() bool {
+	unlock := cb.lock()
+	defer unlock()
 
 	// Check if we need to transition from Open to HalfOpen
-	if cb.state == StateOpen && time.Since(cb.lastFailure) >= cb.config.ResetTimeout {
+	if cb.state == StateOpen && cb.clock.Since(cb.lastFailure) >= cb.config.ResetTimeout {
 		cb.state = StateHalfOpen
 	}
 
@@ -107,13 +144,13 @@ func (cb *CircuitBreaker) Ready() bool {
 
 // recordResult records the result of an operation and updates the circuit breaker state
 func (cb *CircuitBreaker) recordResult(err error) {
-	cb.mutex.Lock()
-	defer cb.mutex.Unlock()
+	unlock := cb.lock()
+	onFailure := cb.onFailure
 
 	if err != nil {
 		cb.failures++
 		cb.lastError = err
-		cb.lastFailure = time.Now()
+		cb.lastFailure = cb.clock.Now()
 
 		if cb.failures >= cb.config.MaxFailures {
 			cb.state = StateOpen
@@ -126,6 +163,30 @@ func (cb *CircuitBreaker) recordResult(err error) {
 			cb.state = StateClosed
 		}
 	}
+
+	unlock()
+	if err != nil && onFailure != nil {
+		onFailure(err)
+	}
+}
+
+// Config returns a copy of the breaker's configuration
+func (cb *CircuitBreaker) Config() CircuitBreakerConfig {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+	return *cb.config
+}
+
+// SetConfig replaces the configuration at runtime, e.g. on a config reload.
+// The breaker keeps its state and clock; new thresholds apply from the next
+// call.
+func (cb *CircuitBreaker) SetConfig(config *CircuitBreakerConfig) {
+	if config == nil {
+		config = DefaultCircuitBreakerConfig()
+	}
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.config = config
 }
 
 // GetState returns the current state of the circuit breaker
@@ -158,16 +219,16 @@ func (cb *CircuitBreaker) GetLastFailure() time.Time {
 
 // ForceOpen forces the circuit breaker to open state
 func (cb *CircuitBreaker) ForceOpen() {
-	cb.mutex.Lock()
-	defer cb.mutex.Unlock()
+	unlock := cb.lock()
+	defer unlock()
 	cb.state = StateOpen
-	cb.lastFailure = time.Now()
+	cb.lastFailure = cb.clock.Now()
 }
 
 // ForceClose forces the circuit breaker to closed state
 func (cb *CircuitBreaker) ForceClose() {
-	cb.mutex.Lock()
-	defer cb.mutex.Unlock()
+	unlock := cb.lock()
+	defer unlock()
 	cb.state = StateClosed
 	cb.failures = 0
 	cb.lastError = nil
@@ -175,8 +236,8 @@ func (cb *CircuitBreaker) ForceClose() {
 
 // Reset resets the circuit breaker to its initial state
 func (cb *CircuitBreaker) Reset() {
-	cb.mutex.Lock()
-	defer cb.mutex.Unlock()
+	unlock := cb.lock()
+	defer unlock()
 	cb.state = StateClosed
 	cb.failures = 0
 	cb.lastError = nil
@@ -190,7 +251,7 @@ func (cb *CircuitBreaker) GetStats() map[string]interface{} {
 
 	// Calculate ready status without calling Ready() method
 	ready := cb.state != StateOpen
-	if cb.state == StateOpen && time.Since(cb.lastFailure) >= cb.config.ResetTimeout {
+	if cb.state == StateOpen && cb.clock.Since(cb.lastFailure) >= cb.config.ResetTimeout {
 		ready = true
 	}
 
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"sort"
+	"sync"
+)
+
+// CircuitBreakerRegistry manages named circuit breakers, one per
+// downstream service, and records their state changes and failures in
+// metrics.
+type CircuitBreakerRegistry struct {
+	config   *CircuitBreakerConfig
+	metrics  *MetricsRegistry
+	breakers map[string]*CircuitBreaker
+	mutex    sync.RWMutex
+}
+
+// CircuitBreakerRegistryStats summarizes the breakers in a registry
+type CircuitBreakerRegistryStats struct {
+	Total    int                               `json:"total"`
+	Closed   int                               `json:"closed"`
+	HalfOpen int                               `json:"half_open"`
+	Open     int                               `json:"open"`
+	Breakers map[string]map[string]interface{} `json:"breakers"`
+}
+
+// NewCircuitBreakerRegistry creates a registry whose breakers use config
+// unless configured otherwise. A nil config uses the default one; metrics
+// may be nil.
+func NewCircuitBreakerRegistry(config *CircuitBreakerConfig, metrics *MetricsRegistry) *CircuitBreakerRegistry {
+	if config == nil {
+		config = DefaultCircuitBreakerConfig()
+	}
+	return &CircuitBreakerRegistry{
+		config:   config,
+		metrics:  metrics,
+		breakers: make(map[string]*CircuitBreaker),
+	}
+}
+
+// Get returns the breaker for name, creating it with the registry's
+// configuration on first use
+func (r *CircuitBreakerRegistry) Get(name string) *CircuitBreaker {
+	r.mutex.RLock()
+	breaker, ok := r.breakers[name]
+	r.mutex.RUnlock()
+	if ok {
+		return breaker
+	}
+	return r.getOrCreate(name, r.config)
+}
+
+// Configure returns the breaker for name with config, creating it or
+// replacing the configuration of an existing one. A nil config uses the
+// registry's.
+func (r *CircuitBreakerRegistry) Configure(name string, config *CircuitBreakerConfig) *CircuitBreaker {
+	if config == nil {
+		config = r.config
+	}
+	breaker := r.getOrCreate(name, config)
+	breaker.SetConfig(config)
+	return breaker
+}
+
+// getOrCreate returns the breaker for name, creating it with config
+func (r *CircuitBreakerRegistry) getOrCreate(name string, config *CircuitBreakerConfig) *CircuitBreaker {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if breaker, ok := r.breakers[name]; ok {
+		return breaker
+	}
+	breaker := NewCircuitBreaker(config)
+	if r.metrics != nil {
+		metrics := r.metrics
+		metrics.RecordCircuitBreakerState(name, breaker.GetState())
+		breaker.OnStateChange(func(from, to CircuitBreakerState) {
+			metrics.RecordCircuitBreakerTransition(name, from, to)
+			metrics.RecordCircuitBreakerState(name, to)
+		})
+		breaker.OnFailure(func(error) {
+			metrics.RecordCircuitBreakerFailure(name)
+		})
+	}
+	r.breakers[name] = breaker
+	return breaker
+}
+
+// Names returns the names of the registered breakers, sorted
+func (r *CircuitBreakerRegistry) Names() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := make([]string, 0, len(r.breakers))
+	for name := range r.breakers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stats returns how many breakers are in each state along with the stats
+// of each breaker
+func (r *CircuitBreakerRegistry) Stats() CircuitBreakerRegistryStats {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	stats := CircuitBreakerRegistryStats{
+		Total:    len(r.breakers),
+		Breakers: make(map[string]map[string]interface{}, len(r.breakers)),
+	}
+	for name, breaker := range r.breakers {
+		switch breaker.GetState() {
+		case StateClosed:
+			stats.Closed++
+		case StateHalfOpen:
+			stats.HalfOpen++
+		case StateOpen:
+			stats.Open++
+		}
+		stats.Breakers[name] = breaker.GetStats()
+	}
+	return stats
+}
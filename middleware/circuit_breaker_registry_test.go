@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCircuitBreakerRegistryGet(t *testing.T) {
+	registry := NewCircuitBreakerRegistry(&CircuitBreakerConfig{MaxFailures: 2, ResetTimeout: time.Minute}, nil)
+
+	users := registry.Get("user-service")
+	if users != registry.Get("user-service") {
+		t.Error("Expected Get to return the same breaker for a name")
+	}
+	if users == registry.Get("code-service") {
+		t.Error("Expected each name to get its own breaker")
+	}
+	if users.Config().MaxFailures != 2 {
+		t.Errorf("Expected the registry configuration, got %+v", users.Config())
+	}
+
+	configured := registry.Configure("user-service", &CircuitBreakerConfig{MaxFailures: 5, ResetTimeout: time.Minute})
+	if configured != users || users.Config().MaxFailures != 5 {
+		t.Errorf("Expected Configure to update the existing breaker, got %+v", users.Config())
+	}
+
+	names := registry.Names()
+	if len(names) != 2 || names[0] != "code-service" || names[1] != "user-service" {
+		t.Errorf("Expected sorted names, got %v", names)
+	}
+}
+
+func TestCircuitBreakerRegistryStats(t *testing.T) {
+	registry := NewCircuitBreakerRegistry(nil, nil)
+	registry.Get("user-service")
+	registry.Get("code-service").ForceOpen()
+
+	stats := registry.Stats()
+	if stats.Total != 2 || stats.Closed != 1 || stats.Open != 1 || stats.HalfOpen != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if stats.Breakers["code-service"]["state"] != "OPEN" {
+		t.Errorf("Expected per-breaker stats, got %v", stats.Breakers["code-service"])
+	}
+}
+
+func TestCircuitBreakerRegistryRecordsMetrics(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	registry := NewCircuitBreakerRegistry(&CircuitBreakerConfig{
+		MaxFailures:  2,
+		ResetTimeout: 10 * time.Second,
+		Clock:        fake,
+	}, NewMetricsRegistry("test-service"))
+	breaker := registry.Get("registry-service")
+
+	transitions := func(from, to CircuitBreakerState) float64 {
+		return testutil.ToFloat64(circuitBreakerTransitions.WithLabelValues("registry-service", from.String(), to.String()))
+	}
+	state := func() float64 {
+		return testutil.ToFloat64(circuitBreakerState.WithLabelValues("registry-service"))
+	}
+	if state() != 0 {
+		t.Errorf("Expected a new breaker to be recorded as closed, got %f", state())
+	}
+
+	for i := 0; i < 2; i++ {
+		breaker.Execute(context.Background(), func() error { return errors.New("unavailable") })
+	}
+	if got := testutil.ToFloat64(circuitBreakerFailures.WithLabelValues("registry-service")); got != 2 {
+		t.Errorf("Expected 2 failures recorded, got %f", got)
+	}
+	if transitions(StateClosed, StateOpen) != 1 || state() != 2 {
+		t.Errorf("Expected the open transition to be recorded, got %f transitions and state %f", transitions(StateClosed, StateOpen), state())
+	}
+
+	fake.Advance(10 * time.Second)
+	breaker.Execute(context.Background(), func() error { return nil })
+	if transitions(StateOpen, StateHalfOpen) != 1 || transitions(StateHalfOpen, StateClosed) != 1 || state() != 0 {
+		t.Errorf("Expected recovery transitions to be recorded, state %f", state())
+	}
+
+	breaker.ForceOpen()
+	breaker.Reset()
+	if transitions(StateClosed, StateOpen) != 2 || transitions(StateOpen, StateClosed) != 1 {
+		t.Error("Expected forced transitions to be recorded")
+	}
+}
+
+func TestCircuitBreakerOnStateChangeCanUseBreaker(t *testing.T) {
+	cb := NewCircuitBreaker(&CircuitBreakerConfig{MaxFailures: 1, ResetTimeout: time.Minute})
+	var states []CircuitBreakerState
+	cb.OnStateChange(func(from, to CircuitBreakerState) {
+		// The lock is released before the callback runs
+		states = append(states, cb.GetState())
+	})
+
+	cb.Execute(context.Background(), func() error { return errors.New("unavailable") })
+	cb.ForceClose()
+	if len(states) != 2 || states[0] != StateOpen || states[1] != StateClosed {
+		t.Errorf("Expected OPEN then CLOSED, got %v", states)
+	}
+}
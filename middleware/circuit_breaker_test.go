@@ -5,6 +5,8 @@ import (
 	"errors"
 	"testing"
 	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
 )
 
 func TestNewCircuitBreaker(t *testing.T) {
@@ -114,9 +116,11 @@ func TestCircuitBreakerStateTransition(t *testing.T) {
 }
 
 func TestCircuitBreakerHalfOpenState(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
 	config := &CircuitBreakerConfig{
 		MaxFailures:  1,
-		ResetTimeout: 10 * time.Millisecond,
+		ResetTimeout: 10 * time.Second,
+		Clock:        fake,
 	}
 	cb := NewCircuitBreaker(config)
 	
@@ -129,8 +133,13 @@ func TestCircuitBreakerHalfOpenState(t *testing.T) {
 		t.Errorf("Expected state to be OPEN, got %s", cb.GetState().String())
 	}
 	
+	fake.Advance(9 * time.Second)
+	if cb.Ready() {
+		t.Error("Circuit should not be ready before reset timeout")
+	}
+	
 	// Wait for reset timeout
-	time.Sleep(20 * time.Millisecond)
+	fake.Advance(time.Second)
 	
 	// Call Ready() to trigger state transition to half-open
 	if !cb.Ready() {
@@ -149,9 +158,11 @@ func TestCircuitBreakerHalfOpenState(t *testing.T) {
 }
 
 func TestCircuitBreakerRecovery(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
 	config := &CircuitBreakerConfig{
 		MaxFailures:  1,
-		ResetTimeout: 10 * time.Millisecond,
+		ResetTimeout: 10 * time.Second,
+		Clock:        fake,
 	}
 	cb := NewCircuitBreaker(config)
 	
@@ -161,7 +172,7 @@ func TestCircuitBreakerRecovery(t *testing.T) {
 	})
 	
 	// Wait for reset timeout
-	time.Sleep(20 * time.Millisecond)
+	fake.Advance(10 * time.Second)
 	
 	// Success in half-open state should close circuit
 	err := cb.Execute(context.Background(), func() error {
@@ -267,6 +278,26 @@ func TestCircuitBreakerReset(t *testing.T) {
 	}
 }
 
+func TestCircuitBreakerSetConfig(t *testing.T) {
+	cb := NewCircuitBreaker(&CircuitBreakerConfig{MaxFailures: 5, ResetTimeout: time.Minute})
+	failing := func() error { return errors.New("error") }
+	
+	cb.Execute(context.Background(), failing)
+	cb.SetConfig(&CircuitBreakerConfig{MaxFailures: 2, ResetTimeout: time.Minute})
+	
+	if cb.Config().MaxFailures != 2 {
+		t.Errorf("Expected max failures 2, got %d", cb.Config().MaxFailures)
+	}
+	if cb.GetFailures() != 1 {
+		t.Errorf("Expected failures to survive a config change, got %d", cb.GetFailures())
+	}
+	
+	cb.Execute(context.Background(), failing)
+	if cb.GetState() != StateOpen {
+		t.Errorf("Expected new threshold to open the circuit, got %s", cb.GetState().String())
+	}
+}
+
 func TestCircuitBreakerGetStats(t *testing.T) {
 	cb := NewCircuitBreaker(nil)
 	
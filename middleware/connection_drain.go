@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConnectionDrainConfig holds the configuration for connection draining
+type ConnectionDrainConfig struct {
+	// RetryAfter is the Retry-After hint sent once shutdown begins, roughly
+	// how long the load balancer takes to stop routing to this instance;
+	// zero sends none
+	RetryAfter time.Duration `json:"retry_after"`
+}
+
+// DefaultConnectionDrainConfig returns a configuration with a 5 second
+// Retry-After hint
+func DefaultConnectionDrainConfig() *ConnectionDrainConfig {
+	return &ConnectionDrainConfig{
+		RetryAfter: 5 * time.Second,
+	}
+}
+
+// drainHeaders sets the headers that move a client off this instance once
+// shutdown has begun
+func drainHeaders(lifecycle *Lifecycle, retryAfter string, header http.Header) {
+	if !lifecycle.ShuttingDown() {
+		return
+	}
+	// net/http closes HTTP/1.x connections after the response and sends
+	// GOAWAY on HTTP/2 ones, where the header itself isn't sent
+	header.Set("Connection", "close")
+	if retryAfter != "" {
+		header.Set("Retry-After", retryAfter)
+	}
+}
+
+// connectionDrainRetryAfter formats the Retry-After hint in whole seconds
+func connectionDrainRetryAfter(config *ConnectionDrainConfig) string {
+	if config.RetryAfter <= 0 {
+		return ""
+	}
+	return strconv.Itoa(int(math.Ceil(config.RetryAfter.Seconds())))
+}
+
+// ConnectionDrainMiddleware creates middleware that, once the lifecycle
+// begins shutting down, answers with Connection: close and a Retry-After
+// hint. Keep-alive connections are then closed after their next response
+// instead of pinning clients to this instance for the rest of a rolling
+// deploy, and reconnect through the load balancer to other instances.
+// Requests are still served, so use it with a shutdown that begins before
+// the server stops accepting them, e.g. while readiness fails.
+func ConnectionDrainMiddleware(lifecycle *Lifecycle, config *ConnectionDrainConfig) func(http.Handler) http.Handler {
+	if config == nil {
+		config = DefaultConnectionDrainConfig()
+	}
+	retryAfter := connectionDrainRetryAfter(config)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			drainHeaders(lifecycle, retryAfter, w.Header())
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GinConnectionDrainMiddleware creates connection draining middleware for
+// Gin framework
+func GinConnectionDrainMiddleware(lifecycle *Lifecycle, config *ConnectionDrainConfig) gin.HandlerFunc {
+	if config == nil {
+		config = DefaultConnectionDrainConfig()
+	}
+	retryAfter := connectionDrainRetryAfter(config)
+	return func(c *gin.Context) {
+		drainHeaders(lifecycle, retryAfter, c.Writer.Header())
+		c.Next()
+	}
+}
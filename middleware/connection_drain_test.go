@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestConnectionDrainMiddleware(t *testing.T) {
+	lifecycle := NewLifecycle()
+	handler := ConnectionDrainMiddleware(lifecycle, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/codes", nil))
+	if w.Header().Get("Connection") != "" || w.Header().Get("Retry-After") != "" {
+		t.Errorf("Expected no drain headers before shutdown, got %v", w.Header())
+	}
+
+	lifecycle.Shutdown(context.Background())
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/codes", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected requests to still be served, got %d", w.Code)
+	}
+	if got := w.Header().Get("Connection"); got != "close" {
+		t.Errorf("Expected Connection: close, got %q", got)
+	}
+	if got := w.Header().Get("Retry-After"); got != "5" {
+		t.Errorf("Expected Retry-After: 5, got %q", got)
+	}
+}
+
+func TestConnectionDrainMiddlewareClosesKeepAlive(t *testing.T) {
+	lifecycle := NewLifecycle()
+	config := &ConnectionDrainConfig{RetryAfter: 1500 * time.Millisecond}
+	server := httptest.NewServer(ConnectionDrainMiddleware(lifecycle, config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	defer server.Close()
+
+	get := func() *http.Response {
+		resp, err := server.Client().Get(server.URL)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := get(); resp.Close {
+		t.Error("Expected the connection to be kept alive before shutdown")
+	}
+	lifecycle.Shutdown(context.Background())
+	resp := get()
+	if !resp.Close {
+		t.Error("Expected the server to close the connection during shutdown")
+	}
+	if got := resp.Header.Get("Retry-After"); got != "2" {
+		t.Errorf("Expected Retry-After rounded up to 2, got %q", got)
+	}
+}
+
+func TestGinConnectionDrainMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	lifecycle := NewLifecycle()
+	router := gin.New()
+	router.Use(GinConnectionDrainMiddleware(lifecycle, &ConnectionDrainConfig{}))
+	router.GET("/codes", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	lifecycle.Shutdown(context.Background())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/codes", nil))
+	if got := w.Header().Get("Connection"); got != "close" {
+		t.Errorf("Expected Connection: close, got %q", got)
+	}
+	if got := w.Header().Get("Retry-After"); got != "" {
+		t.Errorf("Expected no Retry-After when disabled, got %q", got)
+	}
+}
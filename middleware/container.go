@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Container holds the values published for one request, keyed by type.
+// Middleware publishes values with Provide and handlers read them with
+// Resolve, instead of passing untyped values through gin's c.Set/c.Get.
+// Publish distinct values of the same underlying type under named types,
+// e.g. type TenantID string.
+type Container struct {
+	values map[reflect.Type]interface{}
+	mutex  sync.RWMutex
+}
+
+// NewContainer creates an empty container
+func NewContainer() *Container {
+	return &Container{values: make(map[reflect.Type]interface{})}
+}
+
+// WithContainer stores a container in the context
+func WithContainer(ctx context.Context, container *Container) context.Context {
+	return context.WithValue(ctx, "request_container", container)
+}
+
+// GetContainer returns the request's container, or nil when there is none
+func GetContainer(ctx context.Context) *Container {
+	if container, ok := ctx.Value("request_container").(*Container); ok {
+		return container
+	}
+	return nil
+}
+
+// typeOf returns the key values of type T are stored under
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// Provide publishes value in the request's container, replacing any earlier
+// value of the same type. Without ContainerMiddleware a container is created
+// and the returned context must be passed on.
+func Provide[T any](ctx context.Context, value T) context.Context {
+	container := GetContainer(ctx)
+	if container == nil {
+		container = NewContainer()
+		ctx = WithContainer(ctx, container)
+	}
+
+	container.mutex.Lock()
+	defer container.mutex.Unlock()
+	container.values[typeOf[T]()] = value
+	return ctx
+}
+
+// Resolve returns the value of type T published for the request
+func Resolve[T any](ctx context.Context) (T, bool) {
+	var zero T
+	container := GetContainer(ctx)
+	if container == nil {
+		return zero, false
+	}
+
+	container.mutex.RLock()
+	defer container.mutex.RUnlock()
+	value, ok := container.values[typeOf[T]()]
+	if !ok {
+		return zero, false
+	}
+	return value.(T), true
+}
+
+// MustResolve returns the value of type T published for the request and
+// panics when there is none. Use it in handlers behind the middleware that
+// provides the value; the panic marks a wiring mistake, not a bad request.
+func MustResolve[T any](ctx context.Context) T {
+	value, ok := Resolve[T](ctx)
+	if !ok {
+		panic(fmt.Sprintf("no %s provided for this request", typeOf[T]()))
+	}
+	return value
+}
+
+// ContainerMiddleware creates middleware that gives each request an empty
+// container. Install it before the middleware that provides values.
+func ContainerMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithContainer(r.Context(), NewContainer())))
+		})
+	}
+}
+
+// GinContainerMiddleware creates request container middleware for Gin framework
+func GinContainerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(WithContainer(c.Request.Context(), NewContainer()))
+		c.Next()
+	}
+}
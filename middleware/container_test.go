@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+type tenantID string
+
+type featureFlags struct {
+	OfflineValidation bool
+}
+
+func TestContainerProvideResolve(t *testing.T) {
+	ctx := WithContainer(context.Background(), NewContainer())
+
+	if _, ok := Resolve[tenantID](ctx); ok {
+		t.Errorf("Expected nothing to be resolved from an empty container")
+	}
+
+	// Values are published in place, so the returned context can be ignored
+	Provide(ctx, tenantID("org-1"))
+	Provide(ctx, &featureFlags{OfflineValidation: true})
+
+	if tenant, ok := Resolve[tenantID](ctx); !ok || tenant != "org-1" {
+		t.Errorf("Expected tenant org-1, got %q", tenant)
+	}
+	if flags := MustResolve[*featureFlags](ctx); !flags.OfflineValidation {
+		t.Errorf("Expected feature flags to be resolved")
+	}
+
+	// Values are keyed by type, not by underlying type
+	if _, ok := Resolve[string](ctx); ok {
+		t.Errorf("Expected string not to resolve tenantID")
+	}
+}
+
+func TestProvideWithoutContainer(t *testing.T) {
+	ctx := Provide(context.Background(), tenantID("org-2"))
+	if tenant, ok := Resolve[tenantID](ctx); !ok || tenant != "org-2" {
+		t.Errorf("Expected a container to be created, got %q", tenant)
+	}
+
+	if _, ok := Resolve[tenantID](context.Background()); ok {
+		t.Errorf("Expected nothing to be resolved without a container")
+	}
+}
+
+func TestMustResolvePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected MustResolve to panic")
+		}
+	}()
+	MustResolve[tenantID](WithContainer(context.Background(), NewContainer()))
+}
+
+func TestContainerMiddlewarePublishesClaims(t *testing.T) {
+	claims := &types.JWTClaims{UserID: "user-1"}
+
+	provideClaims := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithJWTClaims(r.Context(), claims)))
+		})
+	}
+
+	var resolved *types.JWTClaims
+	handler := ContainerMiddleware()(provideClaims(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resolved, _ = Resolve[*types.JWTClaims](r.Context())
+	})))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if resolved != claims {
+		t.Errorf("Expected the claims to be published in the container")
+	}
+}
+
+func TestGinContainerMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(GinContainerMiddleware())
+	router.Use(func(c *gin.Context) {
+		// No need to replace c.Request to publish a value
+		Provide(c.Request.Context(), tenantID("org-3"))
+		c.Next()
+	})
+	router.GET("/codes", func(c *gin.Context) {
+		c.String(http.StatusOK, string(MustResolve[tenantID](c.Request.Context())))
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/codes", nil))
+	if w.Body.String() != "org-3" {
+		t.Errorf("Expected org-3, got %q", w.Body.String())
+	}
+}
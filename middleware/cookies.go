@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// CSRFHeader is the header browser clients echo the CSRF cookie value in
+const CSRFHeader = "X-CSRF-Token"
+
+// CookieConfig holds configuration for cookie-based token transport
+type CookieConfig struct {
+	AccessCookieName  string
+	RefreshCookieName string
+	CSRFCookieName    string
+	CSRFHeaderName    string
+	Domain            string
+	Path              string
+	RefreshPath       string // Path of the refresh cookie; defaults to Path
+	Secure            bool
+	HttpOnly          bool // Applies to the token cookies; the CSRF cookie is always readable by scripts
+	SameSite          http.SameSite
+}
+
+// DefaultCookieConfig returns default cookie configuration
+func DefaultCookieConfig() *CookieConfig {
+	return &CookieConfig{
+		AccessCookieName:  "access_token",
+		RefreshCookieName: "refresh_token",
+		CSRFCookieName:    "csrf_token",
+		CSRFHeaderName:    CSRFHeader,
+		Path:              "/",
+		Secure:            true,
+		HttpOnly:          true,
+		SameSite:          http.SameSiteLaxMode,
+	}
+}
+
+// refreshPath returns the path the refresh cookie is scoped to
+func (c *CookieConfig) refreshPath() string {
+	if c.RefreshPath != "" {
+		return c.RefreshPath
+	}
+	return c.Path
+}
+
+// cookie builds a cookie with the configured attributes; a zero expiry
+// makes it a session cookie
+func (c *CookieConfig) cookie(name, value, path string, expires time.Time, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Domain:   c.Domain,
+		Path:     path,
+		Expires:  expires,
+		Secure:   c.Secure,
+		HttpOnly: httpOnly,
+		SameSite: c.SameSite,
+	}
+}
+
+// expiredCookie builds a cookie that deletes the named cookie
+func (c *CookieConfig) expiredCookie(name, path string, httpOnly bool) *http.Cookie {
+	cookie := c.cookie(name, "", path, time.Unix(0, 0), httpOnly)
+	cookie.MaxAge = -1
+	return cookie
+}
+
+// generateCSRFToken returns a random token for double-submit CSRF protection
+func generateCSRFToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// SetAuthCookies writes the token pair as cookies together with a fresh CSRF
+// cookie and returns the CSRF token. A nil config uses DefaultCookieConfig.
+func SetAuthCookies(w http.ResponseWriter, pair *types.TokenPair, config *CookieConfig) (string, error) {
+	if config == nil {
+		config = DefaultCookieConfig()
+	}
+
+	csrfToken, err := generateCSRFToken()
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, config.cookie(config.AccessCookieName, pair.AccessToken, config.Path, pair.AccessExpiresAt, config.HttpOnly))
+	if pair.RefreshToken != "" {
+		http.SetCookie(w, config.cookie(config.RefreshCookieName, pair.RefreshToken, config.refreshPath(), pair.RefreshExpiresAt, config.HttpOnly))
+	}
+
+	// The CSRF cookie must outlive every token cookie it protects
+	csrfExpires := pair.RefreshExpiresAt
+	if pair.RefreshToken == "" {
+		csrfExpires = pair.AccessExpiresAt
+	}
+	http.SetCookie(w, config.cookie(config.CSRFCookieName, csrfToken, config.Path, csrfExpires, false))
+	return csrfToken, nil
+}
+
+// ClearAuthCookies expires the token and CSRF cookies. A nil config uses DefaultCookieConfig.
+func ClearAuthCookies(w http.ResponseWriter, config *CookieConfig) {
+	if config == nil {
+		config = DefaultCookieConfig()
+	}
+
+	http.SetCookie(w, config.expiredCookie(config.AccessCookieName, config.Path, config.HttpOnly))
+	http.SetCookie(w, config.expiredCookie(config.RefreshCookieName, config.refreshPath(), config.HttpOnly))
+	http.SetCookie(w, config.expiredCookie(config.CSRFCookieName, config.Path, false))
+}
+
+// RefreshTokenFromCookie returns the refresh token cookie value, or "" when absent
+func RefreshTokenFromCookie(r *http.Request, config *CookieConfig) string {
+	if config == nil {
+		config = DefaultCookieConfig()
+	}
+
+	cookie, err := r.Cookie(config.RefreshCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// isSafeMethod reports whether the HTTP method does not change state
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// verifyCSRF checks that the CSRF header matches the CSRF cookie for
+// state-changing requests
+func verifyCSRF(r *http.Request, config *CookieConfig) error {
+	if isSafeMethod(r.Method) {
+		return nil
+	}
+
+	cookie, err := r.Cookie(config.CSRFCookieName)
+	if err != nil || cookie.Value == "" {
+		return errors.New("missing CSRF cookie")
+	}
+
+	header := r.Header.Get(config.CSRFHeaderName)
+	if header == "" || subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+		return errors.New("CSRF token mismatch")
+	}
+	return nil
+}
+
+// cookieToken returns the access token cookie value after CSRF verification,
+// or "" when there is no access token cookie
+func cookieToken(r *http.Request, config *CookieConfig) (string, error) {
+	cookie, err := r.Cookie(config.AccessCookieName)
+	if err != nil || cookie.Value == "" {
+		return "", nil
+	}
+
+	if err := verifyCSRF(r, config); err != nil {
+		return "", err
+	}
+	return cookie.Value, nil
+}
+
+// CookieAuthMiddleware creates authentication middleware that accepts a bearer
+// token or, for browser clients, the access token cookie protected by a
+// double-submit CSRF check on state-changing requests
+func CookieAuthMiddleware(validator TokenValidator, config *CookieConfig) func(http.Handler) http.Handler {
+	if config == nil {
+		config = DefaultCookieConfig()
+	}
+	return authMiddleware(validator, config)
+}
+
+// GinCookieAuthMiddleware creates cookie-aware authentication middleware for Gin framework
+func GinCookieAuthMiddleware(validator TokenValidator, config *CookieConfig) gin.HandlerFunc {
+	if config == nil {
+		config = DefaultCookieConfig()
+	}
+	return ginAuthMiddleware(validator, config)
+}
@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+func testTokenPair() *types.TokenPair {
+	now := time.Now()
+	return &types.TokenPair{
+		AccessToken:      "user-token",
+		RefreshToken:     "refresh-token",
+		TokenType:        "Bearer",
+		AccessExpiresAt:  now.Add(15 * time.Minute),
+		RefreshExpiresAt: now.Add(7 * 24 * time.Hour),
+	}
+}
+
+// responseCookies indexes the cookies set on a recorded response by name
+func responseCookies(w *httptest.ResponseRecorder) map[string]*http.Cookie {
+	cookies := make(map[string]*http.Cookie)
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	return cookies
+}
+
+func TestSetAuthCookies(t *testing.T) {
+	config := DefaultCookieConfig()
+	config.RefreshPath = "/auth/refresh"
+	config.SameSite = http.SameSiteStrictMode
+
+	w := httptest.NewRecorder()
+	csrfToken, err := SetAuthCookies(w, testTokenPair(), config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if csrfToken == "" {
+		t.Fatal("Expected CSRF token")
+	}
+
+	cookies := responseCookies(w)
+
+	access := cookies["access_token"]
+	if access == nil || access.Value != "user-token" || !access.HttpOnly || !access.Secure || access.SameSite != http.SameSiteStrictMode {
+		t.Errorf("Unexpected access cookie: %+v", access)
+	}
+
+	refresh := cookies["refresh_token"]
+	if refresh == nil || refresh.Value != "refresh-token" || refresh.Path != "/auth/refresh" || !refresh.HttpOnly {
+		t.Errorf("Unexpected refresh cookie: %+v", refresh)
+	}
+
+	csrf := cookies["csrf_token"]
+	if csrf == nil || csrf.Value != csrfToken || csrf.HttpOnly {
+		t.Errorf("Unexpected CSRF cookie: %+v", csrf)
+	}
+}
+
+func TestClearAuthCookies(t *testing.T) {
+	w := httptest.NewRecorder()
+	ClearAuthCookies(w, nil)
+
+	cookies := responseCookies(w)
+	for _, name := range []string{"access_token", "refresh_token", "csrf_token"} {
+		cookie := cookies[name]
+		if cookie == nil || cookie.MaxAge >= 0 || cookie.Value != "" {
+			t.Errorf("Expected %s to be cleared, got %+v", name, cookie)
+		}
+	}
+}
+
+func TestRefreshTokenFromCookie(t *testing.T) {
+	req := httptest.NewRequest("POST", "/auth/refresh", nil)
+	if RefreshTokenFromCookie(req, nil) != "" {
+		t.Error("Expected empty refresh token without cookie")
+	}
+
+	req.AddCookie(&http.Cookie{Name: "refresh_token", Value: "refresh-token"})
+	if got := RefreshTokenFromCookie(req, nil); got != "refresh-token" {
+		t.Errorf("Expected refresh-token, got %s", got)
+	}
+}
+
+func TestCookieAuthMiddleware(t *testing.T) {
+	handler := CookieAuthMiddleware(newStubValidator(), nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		cookie string
+		csrf   string
+		header string
+		bearer string
+		status int
+	}{
+		{"no credentials", "GET", "", "", "", "", http.StatusUnauthorized},
+		{"cookie on safe method", "GET", "user-token", "", "", "", http.StatusOK},
+		{"cookie without CSRF", "POST", "user-token", "", "", "", http.StatusForbidden},
+		{"cookie with mismatched CSRF", "POST", "user-token", "csrf-a", "csrf-b", "", http.StatusForbidden},
+		{"cookie with CSRF", "POST", "user-token", "csrf-a", "csrf-a", "", http.StatusOK},
+		{"invalid cookie token", "GET", "bogus", "", "", "", http.StatusUnauthorized},
+		{"bearer skips CSRF", "POST", "", "", "", "user-token", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "access_token", Value: tt.cookie})
+			}
+			if tt.csrf != "" {
+				req.AddCookie(&http.Cookie{Name: "csrf_token", Value: tt.csrf})
+			}
+			if tt.header != "" {
+				req.Header.Set(CSRFHeader, tt.header)
+			}
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, w.Code)
+			}
+		})
+	}
+}
+
+func TestGinCookieAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.POST("/login", func(c *gin.Context) {
+		csrfToken, err := SetAuthCookies(c.Writer, testTokenPair(), nil)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.String(http.StatusOK, csrfToken)
+	})
+	r.POST("/codes", GinCookieAuthMiddleware(newStubValidator(), nil), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/login", nil))
+	csrfToken := w.Body.String()
+
+	req := httptest.NewRequest("POST", "/codes", nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without CSRF header, got %d", http.StatusForbidden, w.Code)
+	}
+
+	req.Header.Set(CSRFHeader, csrfToken)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status %d with CSRF header, got %d", http.StatusCreated, w.Code)
+	}
+}
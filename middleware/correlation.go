@@ -8,6 +8,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 const (
@@ -84,6 +86,7 @@ func CorrelationMiddleware() func(http.Handler) http.Handler {
 			// Add correlation context to request context
 			ctx := context.WithValue(r.Context(), "correlation_context", corrCtx)
 			r = r.WithContext(ctx)
+			captureCorrelation(ctx, corrCtx)
 			
 			next.ServeHTTP(w, r)
 		})
@@ -241,8 +244,10 @@ func WithCorrelationContext(ctx context.Context, correlationID, requestID, trace
 	return context.WithValue(ctx, "correlation_context", corrCtx)
 }
 
-// PropagateCorrelationHeaders adds correlation headers to HTTP request
+// PropagateCorrelationHeaders adds correlation headers to HTTP request, and
+// the W3C trace context when tracing is set up
 func PropagateCorrelationHeaders(req *http.Request, ctx context.Context) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 	if corrCtx := GetCorrelationContext(ctx); corrCtx != nil {
 		if corrCtx.CorrelationID != "" {
 			req.Header.Set(CorrelationIDHeader, corrCtx.CorrelationID)
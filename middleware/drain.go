@@ -0,0 +1,313 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// Connection kinds counted by the drain reporter
+const (
+	ConnectionWebSocket = "websocket"
+	ConnectionSSE       = "sse"
+)
+
+// DrainConfig holds the configuration for a DrainReporter
+type DrainConfig struct {
+	// LogInterval is how often what's still in flight is logged once
+	// shutdown begins
+	LogInterval time.Duration `json:"log_interval"`
+
+	Logger  *slog.Logger     `json:"-"` // nil uses slog.Default
+	Metrics *MetricsRegistry `json:"-"` // nil disables metrics
+	Clock   clock.Clock      `json:"-"` // nil uses the system clock
+}
+
+// DefaultDrainConfig returns a configuration that logs every 5 seconds
+func DefaultDrainConfig() *DrainConfig {
+	return &DrainConfig{
+		LogInterval: 5 * time.Second,
+	}
+}
+
+// DrainSnapshot is the work in flight at one moment
+type DrainSnapshot struct {
+	ShuttingDown bool `json:"shutting_down"`
+	// ShutdownFor is how long ago shutdown began
+	ShutdownFor string `json:"shutdown_for,omitempty"`
+	// Requests counts in-flight requests by "METHOD path"
+	Requests map[string]int `json:"requests"`
+	// Connections counts open long-lived connections by kind
+	Connections map[string]int `json:"connections"`
+	// Tasks counts running background work by source and name
+	Tasks map[string]map[string]int `json:"tasks"`
+	Total int                       `json:"total"`
+}
+
+// DrainReporter tracks the requests, long-lived connections and background
+// work still running, so a shutdown that hangs says what it's waiting for.
+// It serves the current state for /debug/drain and, once registered with a
+// Lifecycle, logs it periodically while the service drains.
+type DrainReporter struct {
+	config       *DrainConfig
+	logger       *slog.Logger
+	clock        clock.Clock
+	requests     map[string]int
+	connections  map[string]int
+	sources      map[string]func() map[string]int
+	shutdownAt   time.Time
+	shuttingDown bool
+	stop         chan struct{}
+	stopOnce     sync.Once
+	mutex        sync.Mutex
+}
+
+// NewDrainReporter creates a drain reporter
+func NewDrainReporter(config *DrainConfig) *DrainReporter {
+	if config == nil {
+		config = DefaultDrainConfig()
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &DrainReporter{
+		config:      config,
+		logger:      logger,
+		clock:       clock.OrReal(config.Clock),
+		requests:    make(map[string]int),
+		connections: make(map[string]int),
+		sources:     make(map[string]func() map[string]int),
+		stop:        make(chan struct{}),
+	}
+}
+
+// Middleware counts in-flight requests by endpoint. WebSocket upgrades and
+// Server-Sent Events streams are counted as connections instead.
+func (d *DrainReporter) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer d.track(r, r.URL.Path)()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GinMiddleware is the Gin version of Middleware. Requests are counted by
+// route pattern rather than path.
+func (d *DrainReporter) GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		endpoint := c.FullPath()
+		if endpoint == "" {
+			endpoint = c.Request.URL.Path
+		}
+		defer d.track(c.Request, endpoint)()
+		c.Next()
+	}
+}
+
+// track counts r until the returned function is called
+func (d *DrainReporter) track(r *http.Request, endpoint string) func() {
+	if kind := connectionKind(r); kind != "" {
+		return d.TrackConnection(kind)
+	}
+	return d.add(d.requests, r.Method+" "+endpoint)
+}
+
+// connectionKind returns the kind of long-lived connection r opens, if any
+func connectionKind(r *http.Request) string {
+	switch {
+	case strings.EqualFold(r.Header.Get("Upgrade"), "websocket"):
+		return ConnectionWebSocket
+	case strings.Contains(r.Header.Get("Accept"), "text/event-stream"):
+		return ConnectionSSE
+	}
+	return ""
+}
+
+// TrackConnection counts a long-lived connection of the given kind until
+// the returned function is called, for connections the middleware can't
+// recognize
+func (d *DrainReporter) TrackConnection(kind string) func() {
+	return d.add(d.connections, kind)
+}
+
+// add increments counts[key] and returns a function that decrements it once
+func (d *DrainReporter) add(counts map[string]int, key string) func() {
+	d.mutex.Lock()
+	counts[key]++
+	d.mutex.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			d.mutex.Lock()
+			defer d.mutex.Unlock()
+			counts[key]--
+			if counts[key] <= 0 {
+				delete(counts, key)
+			}
+		})
+	}
+}
+
+// AddSource reports background work under name. pending returns counts of
+// running work by name, like WorkerGroup.Active or tasks.Queue.Running.
+func (d *DrainReporter) AddSource(name string, pending func() map[string]int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.sources[name] = pending
+}
+
+// Snapshot returns the work in flight now
+func (d *DrainReporter) Snapshot() *DrainSnapshot {
+	d.mutex.Lock()
+	snapshot := &DrainSnapshot{
+		ShuttingDown: d.shuttingDown,
+		Requests:     copyCounts(d.requests),
+		Connections:  copyCounts(d.connections),
+		Tasks:        make(map[string]map[string]int, len(d.sources)),
+	}
+	if d.shuttingDown {
+		snapshot.ShutdownFor = d.clock.Since(d.shutdownAt).Round(time.Millisecond).String()
+	}
+	sources := make(map[string]func() map[string]int, len(d.sources))
+	for name, pending := range d.sources {
+		sources[name] = pending
+	}
+	d.mutex.Unlock()
+
+	// Sources take their own locks, so they're called without ours
+	for name, pending := range sources {
+		counts := copyCounts(pending())
+		if len(counts) > 0 {
+			snapshot.Tasks[name] = counts
+		}
+	}
+
+	requests, connections, tasks := sum(snapshot.Requests), sum(snapshot.Connections), 0
+	for _, counts := range snapshot.Tasks {
+		tasks += sum(counts)
+	}
+	snapshot.Total = requests + connections + tasks
+
+	if d.config.Metrics != nil {
+		d.config.Metrics.RecordDrainInFlight("requests", requests)
+		d.config.Metrics.RecordDrainInFlight("connections", connections)
+		d.config.Metrics.RecordDrainInFlight("tasks", tasks)
+	}
+	return snapshot
+}
+
+// copyCounts returns the non-zero counts in counts
+func copyCounts(counts map[string]int) map[string]int {
+	copied := make(map[string]int, len(counts))
+	for key, count := range counts {
+		if count > 0 {
+			copied[key] = count
+		}
+	}
+	return copied
+}
+
+// sum adds up counts
+func sum(counts map[string]int) int {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	return total
+}
+
+// Handler serves the current snapshot, typically at /debug/drain. Mount it
+// on an internal port or behind admin authentication.
+func (d *DrainReporter) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, body := types.OK(d.Snapshot())
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	})
+}
+
+// GinHandler is the Gin version of Handler
+func (d *DrainReporter) GinHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(types.OK(d.Snapshot()))
+	}
+}
+
+// Register logs what's in flight every LogInterval from the moment the
+// lifecycle begins shutting down until everything has drained, and logs a
+// final report from a shutdown hook. Register the reporter before the
+// components it watches, so the final report runs after they've stopped.
+func (d *DrainReporter) Register(lifecycle *Lifecycle) {
+	lifecycle.OnShutdown("drain-report", func(ctx context.Context) error {
+		d.stopOnce.Do(func() { close(d.stop) })
+		d.markShuttingDown()
+		d.report(ctx, true)
+		return nil
+	})
+
+	interval := d.config.LogInterval
+	if interval <= 0 {
+		interval = DefaultDrainConfig().LogInterval
+	}
+	go func() {
+		select {
+		case <-lifecycle.Done():
+		case <-d.stop:
+			return
+		}
+		d.markShuttingDown()
+
+		for d.report(context.Background(), false) {
+			select {
+			case <-d.clock.After(interval):
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+}
+
+// markShuttingDown records when shutdown began
+func (d *DrainReporter) markShuttingDown() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if !d.shuttingDown {
+		d.shuttingDown = true
+		d.shutdownAt = d.clock.Now()
+	}
+}
+
+// report logs what's still in flight and returns whether anything is. The
+// final report also logs a clean drain and warns about work that never
+// finished.
+func (d *DrainReporter) report(ctx context.Context, final bool) bool {
+	snapshot := d.Snapshot()
+	attrs := []interface{}{
+		"requests", snapshot.Requests,
+		"connections", snapshot.Connections,
+		"tasks", snapshot.Tasks,
+		"total", snapshot.Total,
+		"shutdown_for", snapshot.ShutdownFor,
+	}
+	switch {
+	case snapshot.Total == 0 && final:
+		d.logger.InfoContext(ctx, "drained: nothing in flight", "shutdown_for", snapshot.ShutdownFor)
+	case final:
+		d.logger.WarnContext(ctx, "shutdown finished with work still in flight", attrs...)
+	case snapshot.Total > 0:
+		d.logger.InfoContext(ctx, "draining", attrs...)
+	}
+	return snapshot.Total > 0
+}
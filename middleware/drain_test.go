@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+)
+
+func TestDrainReporterCountsRequests(t *testing.T) {
+	reporter := NewDrainReporter(nil)
+	release := make(chan struct{})
+	started := make(chan struct{}, 3)
+	handler := reporter.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/validate", nil),
+		httptest.NewRequest(http.MethodPost, "/validate", nil),
+		httptest.NewRequest(http.MethodGet, "/ws", nil),
+	}
+	requests[2].Header.Set("Upgrade", "websocket")
+	done := make(chan struct{})
+	for _, r := range requests {
+		go func(r *http.Request) {
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			done <- struct{}{}
+		}(r)
+	}
+	for range requests {
+		<-started
+	}
+
+	snapshot := reporter.Snapshot()
+	if !reflect.DeepEqual(snapshot.Requests, map[string]int{"POST /validate": 2}) {
+		t.Errorf("Expected 2 in-flight validations, got %v", snapshot.Requests)
+	}
+	if !reflect.DeepEqual(snapshot.Connections, map[string]int{ConnectionWebSocket: 1}) {
+		t.Errorf("Expected the WebSocket to count as a connection, got %v", snapshot.Connections)
+	}
+	if snapshot.Total != 3 {
+		t.Errorf("Expected a total of 3, got %d", snapshot.Total)
+	}
+
+	close(release)
+	for range requests {
+		<-done
+	}
+	if total := reporter.Snapshot().Total; total != 0 {
+		t.Errorf("Expected nothing in flight, got %d", total)
+	}
+}
+
+func TestDrainReporterGinUsesRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	reporter := NewDrainReporter(nil)
+
+	var snapshot *DrainSnapshot
+	router := gin.New()
+	router.Use(reporter.GinMiddleware())
+	router.GET("/devices/:id/events", func(c *gin.Context) {
+		snapshot = reporter.Snapshot()
+	})
+	router.GET("/devices/:id", func(c *gin.Context) {
+		snapshot = reporter.Snapshot()
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/devices/42", nil))
+	if !reflect.DeepEqual(snapshot.Requests, map[string]int{"GET /devices/:id": 1}) {
+		t.Errorf("Expected requests counted by route, got %v", snapshot.Requests)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/devices/42/events", nil)
+	r.Header.Set("Accept", "text/event-stream")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if !reflect.DeepEqual(snapshot.Connections, map[string]int{ConnectionSSE: 1}) || len(snapshot.Requests) != 0 {
+		t.Errorf("Expected an SSE connection, got %+v", snapshot)
+	}
+}
+
+func TestDrainReporterSourcesAndHandler(t *testing.T) {
+	reporter := NewDrainReporter(nil)
+	done := reporter.TrackConnection("grpc-stream")
+	reporter.AddSource("tasks", func() map[string]int {
+		return map[string]int{"webhook.deliver": 2, "email.send": 0}
+	})
+	reporter.AddSource("workers", func() map[string]int { return nil })
+
+	recorder := httptest.NewRecorder()
+	reporter.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/drain", nil))
+
+	var body struct {
+		Success bool          `json:"success"`
+		Data    DrainSnapshot `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !body.Success || body.Data.Total != 3 || body.Data.ShuttingDown {
+		t.Errorf("Unexpected snapshot: %s", recorder.Body.String())
+	}
+	if !reflect.DeepEqual(body.Data.Tasks, map[string]map[string]int{"tasks": {"webhook.deliver": 2}}) {
+		t.Errorf("Expected only running tasks, got %v", body.Data.Tasks)
+	}
+
+	done()
+	done()
+	if connections := reporter.Snapshot().Connections; len(connections) != 0 {
+		t.Errorf("Expected the connection to be released once, got %v", connections)
+	}
+}
+
+func TestDrainReporterLogsDuringShutdown(t *testing.T) {
+	var logs syncBuffer
+	fake := clock.NewFake(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	reporter := NewDrainReporter(&DrainConfig{
+		LogInterval: time.Second,
+		Logger:      slog.New(slog.NewTextHandler(&logs, nil)),
+		Clock:       fake,
+	})
+	lifecycle := NewLifecycle()
+	reporter.Register(lifecycle)
+
+	finish := reporter.TrackConnection(ConnectionWebSocket)
+	lifecycle.OnShutdown("server", func(ctx context.Context) error {
+		fake.BlockUntil(1)
+		fake.Advance(time.Second)
+		fake.BlockUntil(1)
+		return nil
+	})
+
+	if err := lifecycle.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected shutdown error: %v", err)
+	}
+	output := logs.String()
+	if strings.Count(output, `msg=draining`) != 2 {
+		t.Errorf("Expected a drain report per interval, got %s", output)
+	}
+	if !strings.Contains(output, "shutdown finished with work still in flight") || !strings.Contains(output, "shutdown_for=1s") {
+		t.Errorf("Expected a final warning, got %s", output)
+	}
+	if !reporter.Snapshot().ShuttingDown {
+		t.Errorf("Expected the snapshot to show shutdown")
+	}
+	finish()
+}
+
+func TestDrainReporterFinalReportWhenDrained(t *testing.T) {
+	var logs syncBuffer
+	reporter := NewDrainReporter(&DrainConfig{Logger: slog.New(slog.NewTextHandler(&logs, nil))})
+	lifecycle := NewLifecycle()
+	reporter.Register(lifecycle)
+
+	if err := lifecycle.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected shutdown error: %v", err)
+	}
+	if !strings.Contains(logs.String(), "drained: nothing in flight") {
+		t.Errorf("Expected a clean drain to be logged, got %s", logs.String())
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/i18n"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// RenderError writes err as a types.APIError, tagged with the request's
+// correlation ID. Errors that aren't APIErrors are reported as internal errors.
+func RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := errorForRequest(r, err)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.HTTPStatus())
+	json.NewEncoder(w).Encode(apiErr)
+}
+
+// GinRenderError writes err as a types.APIError and aborts the request
+func GinRenderError(c *gin.Context, err error) {
+	apiErr := errorForRequest(c.Request, err)
+	c.AbortWithStatusJSON(apiErr.HTTPStatus(), apiErr)
+}
+
+// errorForRequest converts err, fills in the correlation ID and localizes
+// it without modifying an APIError the caller may reuse
+func errorForRequest(r *http.Request, err error) *types.APIError {
+	apiErr := *types.AsAPIError(err)
+	if apiErr.CorrelationID == "" {
+		apiErr.CorrelationID = GetCorrelationID(r.Context())
+	}
+	return i18n.LocalizeError(r.Context(), &apiErr)
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+func TestRenderError(t *testing.T) {
+	handler := CorrelationMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RenderError(w, r, types.NewNotFoundError("Access code"))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/codes/123", nil)
+	req.Header.Set(CorrelationIDHeader, "corr-123")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body["error"] != "not_found" || body["correlation_id"] != "corr-123" || body["success"] != false {
+		t.Errorf("Unexpected error body %v", body)
+	}
+}
+
+func TestRenderErrorHidesInternalErrors(t *testing.T) {
+	w := httptest.NewRecorder()
+	RenderError(w, httptest.NewRequest(http.MethodGet, "/", nil), errors.New("dial tcp 10.0.0.5:5432: refused"))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+
+	var body types.APIResponse
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Error != "internal_error" || body.Message != "An internal error occurred" {
+		t.Errorf("Unexpected error body %+v", body)
+	}
+}
+
+func TestGinRenderError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(GinCorrelationMiddleware())
+	router.POST("/codes", func(c *gin.Context) {
+		GinRenderError(c, types.NewValidationError().WithField("purpose", "required", "Purpose is required"))
+	}, func(c *gin.Context) {
+		t.Error("Expected the request to be aborted")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/codes", nil)
+	req.Header.Set(CorrelationIDHeader, "corr-456")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", w.Code)
+	}
+
+	var body types.APIError
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Code != types.ErrCodeValidationFailed || body.CorrelationID != "corr-456" || len(body.Fields) != 1 {
+		t.Errorf("Unexpected error body %+v", body)
+	}
+}
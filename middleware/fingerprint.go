@@ -0,0 +1,353 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// DefaultBotUserAgents matches the user agents of crawlers, scripting
+// libraries and headless browsers
+const DefaultBotUserAgents = `(?i)bot|crawl|spider|slurp|curl|wget|python-requests|python-urllib|go-http-client|okhttp|java/|libwww|httpclient|scrapy|headless|phantomjs|selenium|puppeteer|playwright`
+
+// fingerprintedHeaders are the headers whose values are part of the header
+// hash; their token order differs between clients. Other headers only
+// contribute their names.
+var fingerprintedHeaders = []string{"Accept", "Accept-Encoding", "Accept-Language"}
+
+// FingerprintAction is what a matching rule does with a request
+type FingerprintAction string
+
+const (
+	FingerprintAllow FingerprintAction = "allow"
+	FingerprintDeny  FingerprintAction = "deny"
+)
+
+// Fingerprint identifies the client behind a request more narrowly than its
+// IP address
+type Fingerprint struct {
+	// ID is a hash of the IP, user agent and header hash
+	ID        string `json:"id"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	// HeaderHash is a hash of the header names sent and the values of the
+	// content negotiation headers. net/http doesn't keep the order headers
+	// arrived in, so it's the set of names rather than their order.
+	HeaderHash string `json:"header_hash"`
+	// Bot is set when the user agent matches the bot pattern
+	Bot bool `json:"bot"`
+	// Rule is the name of the rule that matched, if any
+	Rule string `json:"rule,omitempty"`
+}
+
+// LogValue logs the fingerprint as a group, without the full user agent
+func (f *Fingerprint) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", f.ID),
+		slog.String("ip", f.IP),
+		slog.String("header_hash", f.HeaderHash),
+		slog.Bool("bot", f.Bot),
+	)
+}
+
+// FingerprintRule allows or denies the requests it matches. Every condition
+// that is set must match; a rule without conditions matches every request.
+type FingerprintRule struct {
+	Name   string            `json:"name"`
+	Action FingerprintAction `json:"action"`
+	// UserAgent is a regular expression matched against the user agent
+	UserAgent string `json:"user_agent,omitempty"`
+	// CIDRs match the client IP
+	CIDRs []string `json:"cidrs,omitempty"`
+	// Fingerprints match fingerprint IDs or header hashes
+	Fingerprints []string `json:"fingerprints,omitempty"`
+	// Bot matches user agents the bot pattern matches
+	Bot bool `json:"bot,omitempty"`
+	// MissingUserAgent matches requests without a user agent
+	MissingUserAgent bool `json:"missing_user_agent,omitempty"`
+}
+
+// compiledRule is a FingerprintRule ready to match
+type compiledRule struct {
+	rule         FingerprintRule
+	userAgent    *regexp.Regexp
+	prefixes     []netip.Prefix
+	fingerprints map[string]bool
+}
+
+// compileRule parses a rule's patterns and CIDRs
+func compileRule(rule FingerprintRule) (*compiledRule, error) {
+	if rule.Action != FingerprintAllow && rule.Action != FingerprintDeny {
+		return nil, fmt.Errorf("rule %q: unknown action %q", rule.Name, rule.Action)
+	}
+	compiled := &compiledRule{rule: rule, fingerprints: make(map[string]bool, len(rule.Fingerprints))}
+	if rule.UserAgent != "" {
+		pattern, err := regexp.Compile(rule.UserAgent)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: invalid user agent pattern: %w", rule.Name, err)
+		}
+		compiled.userAgent = pattern
+	}
+	for _, cidr := range rule.CIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return nil, fmt.Errorf("rule %q: invalid CIDR: %w", rule.Name, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		compiled.prefixes = append(compiled.prefixes, prefix.Masked())
+	}
+	for _, fingerprint := range rule.Fingerprints {
+		compiled.fingerprints[fingerprint] = true
+	}
+	return compiled, nil
+}
+
+// matches reports whether the rule matches a fingerprint
+func (c *compiledRule) matches(fingerprint *Fingerprint) bool {
+	if c.userAgent != nil && !c.userAgent.MatchString(fingerprint.UserAgent) {
+		return false
+	}
+	if c.rule.Bot && !fingerprint.Bot {
+		return false
+	}
+	if c.rule.MissingUserAgent && fingerprint.UserAgent != "" {
+		return false
+	}
+	if len(c.fingerprints) > 0 && !c.fingerprints[fingerprint.ID] && !c.fingerprints[fingerprint.HeaderHash] {
+		return false
+	}
+	if len(c.prefixes) > 0 {
+		addr, err := netip.ParseAddr(fingerprint.IP)
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+		for _, prefix := range c.prefixes {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// FingerprintConfig holds the configuration for request fingerprinting
+type FingerprintConfig struct {
+	// Rules are checked in order and the first match decides. Requests no
+	// rule matches are allowed.
+	Rules []FingerprintRule `json:"rules"`
+
+	// BotUserAgents is the pattern that marks a fingerprint as a bot
+	BotUserAgents string `json:"bot_user_agents"`
+
+	// ClientIP returns the client a request comes from; nil uses the
+	// remote address. Use geo.ClientIP behind proxies.
+	ClientIP func(r *http.Request) string `json:"-"`
+
+	Logger  *slog.Logger     `json:"-"` // nil uses slog.Default
+	Metrics *MetricsRegistry `json:"-"` // nil disables metrics
+}
+
+// DefaultFingerprintConfig returns a configuration that marks bots with
+// DefaultBotUserAgents and allows every request
+func DefaultFingerprintConfig() *FingerprintConfig {
+	return &FingerprintConfig{
+		BotUserAgents: DefaultBotUserAgents,
+	}
+}
+
+// Fingerprinter computes a fingerprint for every request, puts it in the
+// request context for rate limiting and audit logs, and applies allow and
+// deny rules to it
+type Fingerprinter struct {
+	config *FingerprintConfig
+	logger *slog.Logger
+	bots   *regexp.Regexp
+	rules  []*compiledRule
+	mutex  sync.RWMutex
+}
+
+// NewFingerprinter creates a fingerprinter, failing on invalid rules
+func NewFingerprinter(config *FingerprintConfig) (*Fingerprinter, error) {
+	if config == nil {
+		config = DefaultFingerprintConfig()
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	f := &Fingerprinter{config: config, logger: logger}
+	if config.BotUserAgents != "" {
+		bots, err := regexp.Compile(config.BotUserAgents)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bot user agent pattern: %w", err)
+		}
+		f.bots = bots
+	}
+	if err := f.SetRules(config.Rules); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SetRules replaces the rules, e.g. from a reload subscription. The old
+// rules are kept when any of the new ones is invalid.
+func (f *Fingerprinter) SetRules(rules []FingerprintRule) error {
+	compiled := make([]*compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		c, err := compileRule(rule)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, c)
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.rules = compiled
+	return nil
+}
+
+// Compute returns the fingerprint of a request
+func (f *Fingerprinter) Compute(r *http.Request) *Fingerprint {
+	fingerprint := &Fingerprint{
+		UserAgent:  r.UserAgent(),
+		HeaderHash: HeaderHash(r.Header),
+	}
+	if f.config.ClientIP != nil {
+		fingerprint.IP = f.config.ClientIP(r)
+	} else {
+		fingerprint.IP = clientIP(r)
+	}
+	fingerprint.Bot = f.bots != nil && f.bots.MatchString(fingerprint.UserAgent)
+	fingerprint.ID = hashParts(fingerprint.IP, fingerprint.UserAgent, fingerprint.HeaderHash)
+	return fingerprint
+}
+
+// HeaderHash hashes the names of the headers sent and the values of the
+// content negotiation headers
+func HeaderHash(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+
+	parts := []string{strings.Join(names, ",")}
+	for _, name := range fingerprintedHeaders {
+		parts = append(parts, strings.Join(header.Values(name), ","))
+	}
+	return hashParts(parts...)
+}
+
+// hashParts returns a short hex hash of parts
+func hashParts(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// evaluate fingerprints a request and applies the rules, returning whether
+// it may continue
+func (f *Fingerprinter) evaluate(r *http.Request) (*Fingerprint, bool) {
+	fingerprint := f.Compute(r)
+
+	f.mutex.RLock()
+	rules := f.rules
+	f.mutex.RUnlock()
+
+	for _, rule := range rules {
+		if !rule.matches(fingerprint) {
+			continue
+		}
+		fingerprint.Rule = rule.rule.Name
+		if f.config.Metrics != nil {
+			f.config.Metrics.RecordFingerprintRule(rule.rule.Name, string(rule.rule.Action))
+		}
+		if rule.rule.Action == FingerprintDeny {
+			f.logger.InfoContext(r.Context(), "request denied by fingerprint rule",
+				"rule", rule.rule.Name,
+				"fingerprint", fingerprint,
+				"user_agent", fingerprint.UserAgent,
+				"path", r.URL.Path,
+				"correlation_id", GetCorrelationID(r.Context()),
+			)
+			return fingerprint, false
+		}
+		break
+	}
+	return fingerprint, true
+}
+
+// deniedError is the response for requests denied by a rule
+func deniedError() *types.APIError {
+	return types.NewForbiddenError("Request blocked")
+}
+
+// Middleware fingerprints requests and responds 403 Forbidden to those a
+// deny rule matches
+func (f *Fingerprinter) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fingerprint, allowed := f.evaluate(r)
+			r = r.WithContext(WithFingerprint(r.Context(), fingerprint))
+			if !allowed {
+				RenderError(w, r, deniedError())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GinMiddleware is the Gin version of Middleware
+func (f *Fingerprinter) GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fingerprint, allowed := f.evaluate(c.Request)
+		c.Request = c.Request.WithContext(WithFingerprint(c.Request.Context(), fingerprint))
+		if !allowed {
+			GinRenderError(c, deniedError())
+			return
+		}
+		c.Next()
+	}
+}
+
+// WithFingerprint adds a request fingerprint to the context
+func WithFingerprint(ctx context.Context, fingerprint *Fingerprint) context.Context {
+	return context.WithValue(ctx, "request_fingerprint", fingerprint)
+}
+
+// GetFingerprint returns the request fingerprint from the context, or nil
+func GetFingerprint(ctx context.Context) *Fingerprint {
+	if fingerprint, ok := ctx.Value("request_fingerprint").(*Fingerprint); ok {
+		return fingerprint
+	}
+	return nil
+}
+
+// FingerprintKey limits requests per fingerprint, so clients sharing a NAT
+// address get separate limits. Clients can change their fingerprint, so use
+// it alongside a per-IP limit rather than instead of one. Requests without
+// a fingerprint use PrincipalOrIPKey.
+func FingerprintKey(r *http.Request) string {
+	if fingerprint := GetFingerprint(r.Context()); fingerprint != nil {
+		return "fp:" + fingerprint.ID
+	}
+	return PrincipalOrIPKey(r)
+}
@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// browserRequest returns a request with browser-like headers from ip
+func browserRequest(ip string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/validate", nil)
+	r.RemoteAddr = ip + ":1234"
+	r.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)")
+	r.Header.Set("Accept", "application/json")
+	r.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	r.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	return r
+}
+
+func TestFingerprinterCompute(t *testing.T) {
+	f, err := NewFingerprinter(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	first := f.Compute(browserRequest("10.0.0.1"))
+	if first.IP != "10.0.0.1" || first.Bot || len(first.ID) != 32 || len(first.HeaderHash) != 32 {
+		t.Errorf("Unexpected fingerprint %+v", first)
+	}
+	if again := f.Compute(browserRequest("10.0.0.1")); again.ID != first.ID {
+		t.Errorf("Expected the same request to get the same fingerprint")
+	}
+
+	// Same headers from another IP share the header hash only
+	other := f.Compute(browserRequest("10.0.0.2"))
+	if other.ID == first.ID || other.HeaderHash != first.HeaderHash {
+		t.Errorf("Expected a different ID with the same header hash, got %+v and %+v", first, other)
+	}
+
+	r := browserRequest("10.0.0.1")
+	r.Header.Set("Accept-Encoding", "br, gzip, deflate")
+	if f.Compute(r).HeaderHash == first.HeaderHash {
+		t.Errorf("Expected negotiation value order to change the header hash")
+	}
+	r = browserRequest("10.0.0.1")
+	r.Header.Set("X-Requested-With", "XMLHttpRequest")
+	if f.Compute(r).HeaderHash == first.HeaderHash {
+		t.Errorf("Expected an extra header to change the header hash")
+	}
+
+	r = browserRequest("10.0.0.1")
+	r.Header.Set("User-Agent", "python-requests/2.31.0")
+	if !f.Compute(r).Bot {
+		t.Errorf("Expected scripting libraries to be marked as bots")
+	}
+}
+
+func TestFingerprinterRules(t *testing.T) {
+	f, err := NewFingerprinter(&FingerprintConfig{
+		BotUserAgents: DefaultBotUserAgents,
+		Rules: []FingerprintRule{
+			{Name: "office", Action: FingerprintAllow, CIDRs: []string{"192.168.0.0/16"}},
+			{Name: "validator-app", Action: FingerprintAllow, UserAgent: `^JarakeyValidator/`},
+			{Name: "no-user-agent", Action: FingerprintDeny, MissingUserAgent: true},
+			{Name: "bots", Action: FingerprintDeny, Bot: true},
+			{Name: "abuser", Action: FingerprintDeny, CIDRs: []string{"203.0.113.7"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		ip        string
+		userAgent string
+		allowed   bool
+		rule      string
+	}{
+		{"browser", "10.0.0.1", "Mozilla/5.0", true, ""},
+		{"curl", "10.0.0.1", "curl/8.4.0", false, "bots"},
+		{"curl from the office", "192.168.1.20", "curl/8.4.0", true, "office"},
+		{"validator devices use a Go client", "10.0.0.1", "JarakeyValidator/2.1 Go-http-client/1.1", true, "validator-app"},
+		{"missing user agent", "10.0.0.1", "", false, "no-user-agent"},
+		{"single address", "203.0.113.7", "Mozilla/5.0", false, "abuser"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := browserRequest(tt.ip)
+			r.Header.Set("User-Agent", tt.userAgent)
+			fingerprint, allowed := f.evaluate(r)
+			if allowed != tt.allowed || fingerprint.Rule != tt.rule {
+				t.Errorf("Expected allowed=%v by %q, got %v by %q", tt.allowed, tt.rule, allowed, fingerprint.Rule)
+			}
+		})
+	}
+}
+
+func TestFingerprinterRuleErrors(t *testing.T) {
+	invalid := [][]FingerprintRule{
+		{{Name: "pattern", Action: FingerprintDeny, UserAgent: "("}},
+		{{Name: "cidr", Action: FingerprintDeny, CIDRs: []string{"10.0.0.0/33"}}},
+		{{Name: "action", Action: "block"}},
+	}
+	for _, rules := range invalid {
+		if _, err := NewFingerprinter(&FingerprintConfig{Rules: rules}); err == nil {
+			t.Errorf("Expected rule %q to be rejected", rules[0].Name)
+		}
+	}
+
+	f, _ := NewFingerprinter(&FingerprintConfig{Rules: []FingerprintRule{{Name: "all", Action: FingerprintDeny}}})
+	if err := f.SetRules(invalid[0]); err == nil {
+		t.Errorf("Expected SetRules to reject invalid rules")
+	}
+	if _, allowed := f.evaluate(browserRequest("10.0.0.1")); allowed {
+		t.Errorf("Expected the old rules to be kept")
+	}
+}
+
+func TestFingerprintMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	f, _ := NewFingerprinter(&FingerprintConfig{
+		Logger: slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+	denied := f.Compute(browserRequest("10.0.0.9"))
+	f.SetRules([]FingerprintRule{{Name: "blocked-client", Action: FingerprintDeny, Fingerprints: []string{denied.ID}}})
+
+	var seen *Fingerprint
+	var key string
+	handler := f.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = GetFingerprint(r.Context())
+		key = FingerprintKey(r)
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, browserRequest("10.0.0.1"))
+	if recorder.Code != http.StatusOK || seen == nil || seen.IP != "10.0.0.1" {
+		t.Fatalf("Expected the fingerprint in the context, got %d %+v", recorder.Code, seen)
+	}
+	if key != "fp:"+seen.ID {
+		t.Errorf("Expected a rate limit key per fingerprint, got %q", key)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, browserRequest("10.0.0.9"))
+	if recorder.Code != http.StatusForbidden || !strings.Contains(recorder.Body.String(), `"error":"forbidden"`) {
+		t.Errorf("Expected the fingerprint to be denied, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if !strings.Contains(logs.String(), "rule=blocked-client") || !strings.Contains(logs.String(), "fingerprint.id="+denied.ID) {
+		t.Errorf("Expected the denial to be logged, got %s", logs.String())
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if key := FingerprintKey(r); key != "ip:192.0.2.1" {
+		t.Errorf("Expected the IP key without a fingerprint, got %q", key)
+	}
+}
+
+func TestGinFingerprintMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	f, _ := NewFingerprinter(&FingerprintConfig{
+		BotUserAgents: DefaultBotUserAgents,
+		Rules:         []FingerprintRule{{Name: "bots", Action: FingerprintDeny, Bot: true}},
+	})
+
+	var events []*types.CodeValidationBlocked
+	config := DefaultBruteForceConfig()
+	config.IP.MaxFailures = 1
+	config.Audit = func(ctx context.Context, event *types.CodeValidationBlocked) {
+		events = append(events, event)
+	}
+	guard := NewBruteForceGuard(NewMemoryAttemptStore(), config)
+
+	router := gin.New()
+	router.Use(f.GinMiddleware())
+	router.POST("/validate", guard.GinMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, types.NewNotFoundError("Code"))
+	})
+
+	r := browserRequest("10.0.0.1")
+	r.Header.Set("User-Agent", "Go-http-client/1.1")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, r)
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected bots to be denied, got %d", recorder.Code)
+	}
+
+	r = browserRequest("10.0.0.1")
+	fingerprint := f.Compute(r)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if len(events) != 1 || events[0].Fingerprint != fingerprint.ID {
+		t.Errorf("Expected brute-force audit events to carry the fingerprint, got %+v", events)
+	}
+}
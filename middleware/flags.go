@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"sort"
+	"sync"
+)
+
+// FeatureFlags is a set of named on/off switches that can be flipped at
+// runtime, e.g. from the admin API
+type FeatureFlags struct {
+	flags map[string]bool
+	mutex sync.RWMutex
+}
+
+// NewFeatureFlags creates feature flags with their default values
+func NewFeatureFlags(defaults map[string]bool) *FeatureFlags {
+	flags := make(map[string]bool, len(defaults))
+	for name, enabled := range defaults {
+		flags[name] = enabled
+	}
+	return &FeatureFlags{flags: flags}
+}
+
+// Enabled reports whether a flag is on. Unknown flags are off.
+func (f *FeatureFlags) Enabled(name string) bool {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.flags[name]
+}
+
+// Set turns a flag on or off
+func (f *FeatureFlags) Set(name string, enabled bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.flags[name] = enabled
+}
+
+// Has reports whether a flag is defined
+func (f *FeatureFlags) Has(name string) bool {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	_, ok := f.flags[name]
+	return ok
+}
+
+// All returns a copy of every flag
+func (f *FeatureFlags) All() map[string]bool {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	flags := make(map[string]bool, len(f.flags))
+	for name, enabled := range f.flags {
+		flags[name] = enabled
+	}
+	return flags
+}
+
+// Names returns the flag names in order
+func (f *FeatureFlags) Names() []string {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	names := make([]string, 0, len(f.flags))
+	for name := range f.flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFeatureFlags(t *testing.T) {
+	defaults := map[string]bool{"offline_validation": true, "sms_invites": false}
+	flags := NewFeatureFlags(defaults)
+
+	if !flags.Enabled("offline_validation") || flags.Enabled("sms_invites") {
+		t.Errorf("Expected default values, got %v", flags.All())
+	}
+	if flags.Enabled("unknown") || flags.Has("unknown") {
+		t.Errorf("Expected unknown flags to be off and undefined")
+	}
+
+	flags.Set("sms_invites", true)
+	if !flags.Enabled("sms_invites") {
+		t.Errorf("Expected sms_invites to be on")
+	}
+	if defaults["sms_invites"] {
+		t.Errorf("Expected the defaults map not to be modified")
+	}
+
+	if !reflect.DeepEqual(flags.Names(), []string{"offline_validation", "sms_invites"}) {
+		t.Errorf("Unexpected flag names %v", flags.Names())
+	}
+}
@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+)
+
+// ErrorReporter sends errors to an error tracking service
+type ErrorReporter interface {
+	ReportError(ctx context.Context, err error, tags map[string]string)
+}
+
+// ErrorReporterFunc adapts a function to ErrorReporter
+type ErrorReporterFunc func(ctx context.Context, err error, tags map[string]string)
+
+// ReportError calls f
+func (f ErrorReporterFunc) ReportError(ctx context.Context, err error, tags map[string]string) {
+	f(ctx, err, tags)
+}
+
+// GoroutineConfig holds what background goroutines log, report and record to
+type GoroutineConfig struct {
+	Logger   *slog.Logger     // nil uses slog.Default
+	Metrics  *MetricsRegistry // nil disables goroutine metrics
+	Reporter ErrorReporter    // nil doesn't report
+}
+
+var (
+	goroutineConfig      = &GoroutineConfig{}
+	goroutineConfigMutex sync.RWMutex
+)
+
+// SetGoroutineConfig sets the configuration used by Go and by worker groups
+// created without one. Call it once at startup.
+func SetGoroutineConfig(config *GoroutineConfig) {
+	if config == nil {
+		config = &GoroutineConfig{}
+	}
+	goroutineConfigMutex.Lock()
+	defer goroutineConfigMutex.Unlock()
+	goroutineConfig = config
+}
+
+// currentGoroutineConfig returns the configuration set by SetGoroutineConfig
+func currentGoroutineConfig() *GoroutineConfig {
+	goroutineConfigMutex.RLock()
+	defer goroutineConfigMutex.RUnlock()
+	return goroutineConfig
+}
+
+// logger returns the configured logger or slog.Default
+func (c *GoroutineConfig) logger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return slog.Default()
+}
+
+// runGoroutine runs fn, recovering panics. Panics and errors are logged with
+// the correlation fields of ctx and reported.
+func runGoroutine(ctx context.Context, config *GoroutineConfig, name string, fn func(ctx context.Context) error) {
+	if config.Metrics != nil {
+		config.Metrics.RecordGoroutineStart(name)
+		defer config.Metrics.RecordGoroutineEnd(name)
+	}
+
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		if config.Metrics != nil {
+			config.Metrics.RecordGoroutinePanic(name)
+		}
+		config.logger().ErrorContext(ctx, "goroutine panicked",
+			goroutineAttrs(ctx, name, "panic", fmt.Sprint(recovered), "stack", string(debug.Stack()))...)
+		if config.Reporter != nil {
+			config.Reporter.ReportError(ctx, panicError(recovered), map[string]string{"goroutine": name, "panic": "true"})
+		}
+	}()
+
+	if err := fn(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		config.logger().ErrorContext(ctx, "goroutine failed", goroutineAttrs(ctx, name, "error", err.Error())...)
+		if config.Reporter != nil {
+			config.Reporter.ReportError(ctx, err, map[string]string{"goroutine": name})
+		}
+	}
+}
+
+// goroutineAttrs returns the log attributes of a goroutine
+func goroutineAttrs(ctx context.Context, name string, extra ...interface{}) []interface{} {
+	return append([]interface{}{
+		"goroutine", name,
+		"correlation_id", GetCorrelationID(ctx),
+		"request_id", GetRequestID(ctx),
+	}, extra...)
+}
+
+// Go runs fn in a goroutine that can't crash the process. fn gets a context
+// that keeps the values of ctx (correlation IDs, claims) but not its
+// cancellation, so work started from a request outlives the response.
+func Go(ctx context.Context, name string, fn func(ctx context.Context) error) {
+	config := currentGoroutineConfig()
+	ctx = context.WithoutCancel(ctx)
+	go runGoroutine(ctx, config, name, fn)
+}
+
+// WorkerGroup runs named background workers that share a context and stop
+// together. Panics in workers are recovered like in Go.
+type WorkerGroup struct {
+	name     string
+	config   *GoroutineConfig
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	active   map[string]int
+	stopping bool
+	mutex    sync.Mutex
+}
+
+// NewWorkerGroup creates a worker group whose workers stop when ctx is
+// cancelled or the group is shut down. A nil config uses SetGoroutineConfig's.
+func NewWorkerGroup(ctx context.Context, name string, config *GoroutineConfig) *WorkerGroup {
+	if config == nil {
+		config = currentGoroutineConfig()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &WorkerGroup{
+		name:   name,
+		config: config,
+		ctx:    ctx,
+		cancel: cancel,
+		active: make(map[string]int),
+	}
+}
+
+// Go starts a worker. It returns false, without starting it, once the group
+// is shutting down.
+func (g *WorkerGroup) Go(name string, fn func(ctx context.Context) error) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.stopping {
+		return false
+	}
+	g.active[name]++
+	g.wg.Add(1)
+
+	go func() {
+		defer g.done(name)
+		runGoroutine(g.ctx, g.config, g.name+"/"+name, fn)
+	}()
+	return true
+}
+
+// done records a worker finishing
+func (g *WorkerGroup) done(name string) {
+	g.mutex.Lock()
+	g.active[name]--
+	if g.active[name] == 0 {
+		delete(g.active, name)
+	}
+	g.mutex.Unlock()
+	g.wg.Done()
+}
+
+// Active returns the number of running workers by name
+func (g *WorkerGroup) Active() map[string]int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	active := make(map[string]int, len(g.active))
+	for name, count := range g.active {
+		active[name] = count
+	}
+	return active
+}
+
+// Shutdown cancels the workers' context and waits for them to return. When
+// ctx ends first it returns an error naming the workers still running.
+func (g *WorkerGroup) Shutdown(ctx context.Context) error {
+	g.mutex.Lock()
+	g.stopping = true
+	g.mutex.Unlock()
+	g.cancel()
+
+	finished := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("worker group %s: workers still running: %v", g.name, g.Active())
+	}
+}
+
+// Register shuts the group down with the lifecycle
+func (g *WorkerGroup) Register(lifecycle *Lifecycle) {
+	lifecycle.OnShutdown("workers:"+g.name, g.Shutdown)
+}
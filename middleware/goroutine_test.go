@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingReporter collects reported errors
+type recordingReporter struct {
+	errs  []error
+	tags  []map[string]string
+	mutex sync.Mutex
+}
+
+func (r *recordingReporter) ReportError(ctx context.Context, err error, tags map[string]string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.errs = append(r.errs, err)
+	r.tags = append(r.tags, tags)
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent log writes
+type syncBuffer struct {
+	buffer bytes.Buffer
+	mutex  sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+func TestGoRecoversPanics(t *testing.T) {
+	var logs syncBuffer
+	reporter := &recordingReporter{}
+	SetGoroutineConfig(&GoroutineConfig{
+		Logger:   slog.New(slog.NewJSONHandler(&logs, nil)),
+		Metrics:  NewMetricsRegistry("goroutine-test"),
+		Reporter: reporter,
+	})
+	defer SetGoroutineConfig(nil)
+
+	ctx, cancel := context.WithCancel(WithCorrelationContext(context.Background(), "corr-123", "req-1", "", ""))
+	done := make(chan struct{})
+	Go(ctx, "send-invite", func(ctx context.Context) error {
+		defer close(done)
+		<-time.After(10 * time.Millisecond)
+		if ctx.Err() != nil {
+			t.Errorf("Expected the goroutine to outlive the request context")
+		}
+		panic("smtp client is nil")
+	})
+	cancel()
+
+	<-done
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(logs.String(), "goroutine panicked") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if !strings.Contains(logs.String(), `"correlation_id":"corr-123"`) {
+		t.Errorf("Expected the panic to be logged with the correlation ID, got %s", logs.String())
+	}
+	reporter.mutex.Lock()
+	defer reporter.mutex.Unlock()
+	if len(reporter.errs) != 1 || reporter.tags[0]["goroutine"] != "send-invite" {
+		t.Errorf("Expected the panic to be reported, got %v %v", reporter.errs, reporter.tags)
+	}
+}
+
+func TestWorkerGroupShutdown(t *testing.T) {
+	reporter := &recordingReporter{}
+	group := NewWorkerGroup(context.Background(), "webhooks", &GoroutineConfig{
+		Logger:   slog.New(slog.NewJSONHandler(&syncBuffer{}, nil)),
+		Reporter: reporter,
+	})
+
+	started := make(chan struct{}, 2)
+	for i := 0; i < 2; i++ {
+		group.Go("deliver", func(ctx context.Context) error {
+			started <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}
+	<-started
+	<-started
+
+	if active := group.Active(); active["deliver"] != 2 {
+		t.Errorf("Expected 2 active workers, got %v", active)
+	}
+
+	lifecycle := NewLifecycle()
+	group.Register(lifecycle)
+	if err := lifecycle.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Expected shutdown to succeed, got %v", err)
+	}
+	if active := group.Active(); len(active) != 0 {
+		t.Errorf("Expected no active workers, got %v", active)
+	}
+	if group.Go("deliver", func(ctx context.Context) error { return nil }) {
+		t.Errorf("Expected workers not to start after shutdown")
+	}
+	if len(reporter.errs) != 0 {
+		t.Errorf("Expected cancellation not to be reported, got %v", reporter.errs)
+	}
+}
+
+func TestWorkerGroupShutdownTimeout(t *testing.T) {
+	group := NewWorkerGroup(context.Background(), "tasks", &GoroutineConfig{
+		Logger: slog.New(slog.NewJSONHandler(&syncBuffer{}, nil)),
+	})
+
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	group.Go("stuck", func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := group.Shutdown(ctx)
+	if err == nil || !strings.Contains(err.Error(), "stuck") {
+		t.Errorf("Expected an error naming the stuck worker, got %v", err)
+	}
+}
+
+func TestWorkerGroupReportsErrors(t *testing.T) {
+	reporter := &recordingReporter{}
+	group := NewWorkerGroup(context.Background(), "tasks", &GoroutineConfig{
+		Logger:   slog.New(slog.NewJSONHandler(&syncBuffer{}, nil)),
+		Reporter: reporter,
+	})
+
+	failure := errors.New("queue unavailable")
+	group.Go("consume", func(ctx context.Context) error {
+		return failure
+	})
+	group.Shutdown(context.Background())
+
+	if len(reporter.errs) != 1 || !errors.Is(reporter.errs[0], failure) {
+		t.Errorf("Expected the worker error to be reported, got %v", reporter.errs)
+	}
+	if reporter.tags[0]["goroutine"] != "tasks/consume" {
+		t.Errorf("Expected the worker to be tagged, got %v", reporter.tags[0])
+	}
+}
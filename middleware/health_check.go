@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
 )
 
 // HealthStatus represents the overall health status of a service
@@ -16,6 +18,8 @@ const (
 	StatusHealthy   HealthStatus = "healthy"
 	StatusDegraded  HealthStatus = "degraded"
 	StatusUnhealthy HealthStatus = "unhealthy"
+	// StatusMaintenance is reported while the service is deliberately taken out of rotation
+	StatusMaintenance HealthStatus = "maintenance"
 )
 
 // String returns the string representation of the health status
@@ -41,6 +45,10 @@ type HealthChecker struct {
 	checks      map[string]HealthCheck
 	mutex       sync.RWMutex
 	timeout     time.Duration
+	clock       clock.Clock
+
+	maintenance        bool
+	maintenanceMessage string
 }
 
 // NewHealthChecker creates a new health checker
@@ -49,6 +57,7 @@ func NewHealthChecker(serviceName string) *HealthChecker {
 		serviceName: serviceName,
 		checks:      make(map[string]HealthCheck),
 		timeout:     30 * time.Second,
+		clock:       clock.Real(),
 	}
 }
 
@@ -73,6 +82,33 @@ func (hc *HealthChecker) SetTimeout(timeout time.Duration) {
 	hc.timeout = timeout
 }
 
+// SetClock sets the clock that timestamps health results
+func (hc *HealthChecker) SetClock(c clock.Clock) {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+	hc.clock = clock.OrReal(c)
+}
+
+// SetMaintenance puts the service in or out of maintenance mode. In
+// maintenance the health endpoint answers 503 so load balancers stop sending
+// traffic, while the dependency checks keep running.
+func (hc *HealthChecker) SetMaintenance(enabled bool, message string) {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+	hc.maintenance = enabled
+	hc.maintenanceMessage = message
+	if !enabled {
+		hc.maintenanceMessage = ""
+	}
+}
+
+// Maintenance reports whether the service is in maintenance mode, and why
+func (hc *HealthChecker) Maintenance() (bool, string) {
+	hc.mutex.RLock()
+	defer hc.mutex.RUnlock()
+	return hc.maintenance, hc.maintenanceMessage
+}
+
 // CheckHealth performs all health checks and returns the overall status
 func (hc *HealthChecker) CheckHealth(ctx context.Context) map[string]interface{} {
 	hc.mutex.RLock()
@@ -81,6 +117,8 @@ func (hc *HealthChecker) CheckHealth(ctx context.Context) map[string]interface{}
 		checks[name] = check
 	}
 	timeout := hc.timeout
+	now := hc.clock.Now
+	maintenance, maintenanceMessage := hc.maintenance, hc.maintenanceMessage
 	hc.mutex.RUnlock()
 
 	// Create context with timeout
@@ -111,14 +149,14 @@ func (hc *HealthChecker) CheckHealth(ctx context.Context) map[string]interface{}
 				if result != nil {
 					result.Name = name
 					if result.Timestamp.IsZero() {
-						result.Timestamp = time.Now()
+						result.Timestamp = now()
 					}
 				} else {
 					result = &DependencyHealth{
 						Name:      name,
 						Status:    StatusUnhealthy,
 						Message:   "Health check returned nil",
-						Timestamp: time.Now(),
+						Timestamp: now(),
 					}
 				}
 				results <- result
@@ -128,7 +166,7 @@ func (hc *HealthChecker) CheckHealth(ctx context.Context) map[string]interface{}
 					Name:      name,
 					Status:    StatusUnhealthy,
 					Message:   "Health check timed out",
-					Timestamp: time.Now(),
+					Timestamp: now(),
 				}
 			}
 		}(name, check)
@@ -158,16 +196,24 @@ func (hc *HealthChecker) CheckHealth(ctx context.Context) map[string]interface{}
 		}
 	}
 
-	return map[string]interface{}{
+	if maintenance {
+		overallStatus = StatusMaintenance
+	}
+
+	health := map[string]interface{}{
 		"service":       hc.serviceName,
 		"status":        overallStatus.String(),
-		"timestamp":     time.Now().UTC(),
+		"timestamp":     now().UTC(),
 		"dependencies":  dependencies,
 		"total_checks":  len(checks),
 		"healthy":       countStatus(dependencies, StatusHealthy),
 		"degraded":      countStatus(dependencies, StatusDegraded),
 		"unhealthy":     countStatus(dependencies, StatusUnhealthy),
 	}
+	if maintenance {
+		health["maintenance_message"] = maintenanceMessage
+	}
+	return health
 }
 
 // countStatus counts dependencies with a specific status
@@ -195,7 +241,7 @@ func (hc *HealthChecker) HTTPHandler() http.HandlerFunc {
 			httpStatus = http.StatusOK
 		case "degraded":
 			httpStatus = http.StatusOK // Service is running but some dependencies are down
-		case "unhealthy":
+		case "unhealthy", "maintenance":
 			httpStatus = http.StatusServiceUnavailable
 		default:
 			httpStatus = http.StatusInternalServerError
@@ -8,6 +8,8 @@ import (
 	"net/http/httptest"
 	"testing"
 	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
 )
 
 func TestNewHealthChecker(t *testing.T) {
@@ -63,6 +65,23 @@ func TestHealthCheckerSetTimeout(t *testing.T) {
 	}
 }
 
+func TestHealthCheckerSetClock(t *testing.T) {
+	hc := NewHealthChecker("test-service")
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	hc.SetClock(clock.NewFake(now))
+	hc.AddCheck("nil", func(ctx context.Context) *DependencyHealth { return nil })
+	
+	health := hc.CheckHealth(context.Background())
+	if !health["timestamp"].(time.Time).Equal(now) {
+		t.Errorf("Expected timestamp from the clock, got %v", health["timestamp"])
+	}
+	
+	dependencies := health["dependencies"].(map[string]*DependencyHealth)
+	if !dependencies["nil"].Timestamp.Equal(now) {
+		t.Errorf("Expected dependency timestamp from the clock, got %v", dependencies["nil"].Timestamp)
+	}
+}
+
 func TestHealthCheckerCheckHealth(t *testing.T) {
 	hc := NewHealthChecker("test-service")
 	
@@ -275,6 +294,30 @@ func TestHealthCheckerHTTPHandlerUnhealthy(t *testing.T) {
 	}
 }
 
+func TestHealthCheckerMaintenance(t *testing.T) {
+	hc := NewHealthChecker("test-service")
+	hc.AddCheck("healthy-dep", func(ctx context.Context) *DependencyHealth {
+		return &DependencyHealth{Status: StatusHealthy, Timestamp: time.Now()}
+	})
+
+	hc.SetMaintenance(true, "database migration")
+	if enabled, message := hc.Maintenance(); !enabled || message != "database migration" {
+		t.Errorf("Expected maintenance mode, got %v %q", enabled, message)
+	}
+
+	w := httptest.NewRecorder()
+	hc.HTTPHandler()(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d in maintenance, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	hc.SetMaintenance(false, "ignored")
+	health := hc.CheckHealth(context.Background())
+	if health["status"] != "healthy" || health["maintenance_message"] != nil {
+		t.Errorf("Expected maintenance to be cleared, got %v", health)
+	}
+}
+
 func TestHealthCheckerHTTPHandlerDegraded(t *testing.T) {
 	hc := NewHealthChecker("test-service")
 	
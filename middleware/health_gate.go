@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// HealthGate keeps the latest result of a HealthChecker's checks so routes
+// can fail fast when a dependency they can't work without is down, instead
+// of every request waiting for its own timeout deep in the handler.
+type HealthGate struct {
+	checker  *HealthChecker
+	interval time.Duration
+	statuses map[string]*DependencyHealth
+	mutex    sync.RWMutex
+}
+
+// NewHealthGate creates a gate over the checker's dependencies, re-checked
+// every interval once started
+func NewHealthGate(checker *HealthChecker, interval time.Duration) *HealthGate {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return &HealthGate{
+		checker:  checker,
+		interval: interval,
+		statuses: make(map[string]*DependencyHealth),
+	}
+}
+
+// Start checks the dependencies immediately and then every interval until
+// ctx is cancelled
+func (g *HealthGate) Start(ctx context.Context) {
+	g.Refresh(ctx)
+
+	go func() {
+		ticker := time.NewTicker(g.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				g.Refresh(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Refresh runs every health check once and stores the results
+func (g *HealthGate) Refresh(ctx context.Context) {
+	health := g.checker.CheckHealth(ctx)
+	dependencies, _ := health["dependencies"].(map[string]*DependencyHealth)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.statuses = dependencies
+}
+
+// Status returns the last known health of a dependency
+func (g *HealthGate) Status(name string) (*DependencyHealth, bool) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	health, ok := g.statuses[name]
+	return health, ok
+}
+
+// Unavailable returns the first of the dependencies that was unhealthy when
+// last checked. Degraded dependencies still take traffic, and dependencies
+// that haven't been checked yet are assumed to be up.
+func (g *HealthGate) Unavailable(dependencies ...string) (string, bool) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	for _, name := range dependencies {
+		if health, ok := g.statuses[name]; ok && health.Status == StatusUnhealthy {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// unavailableError is the response for requests whose dependency is down.
+// The dependency's name is logged by the checker, not sent to clients.
+func unavailableError() *types.APIError {
+	return types.NewAPIError(types.ErrCodeServiceUnavailable, "Service temporarily unavailable")
+}
+
+// retryAfter is how long clients should wait before the next check
+func (g *HealthGate) retryAfter() string {
+	return strconv.Itoa(int(math.Ceil(g.interval.Seconds())))
+}
+
+// Require creates middleware that answers 503 Service Unavailable while any
+// of the named dependencies is unhealthy, e.g. gate.Require("postgres") on
+// /codes/generate
+func (g *HealthGate) Require(dependencies ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, down := g.Unavailable(dependencies...); down {
+				w.Header().Set("Retry-After", g.retryAfter())
+				RenderError(w, r, unavailableError())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GinRequire creates dependency gating middleware for Gin framework
+func (g *HealthGate) GinRequire(dependencies ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, down := g.Unavailable(dependencies...); down {
+			c.Header("Retry-After", g.retryAfter())
+			GinRenderError(c, unavailableError())
+			return
+		}
+		c.Next()
+	}
+}
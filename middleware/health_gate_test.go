@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestHealthGate(postgresUp *atomic.Bool) *HealthGate {
+	checker := NewHealthChecker("codes-service")
+	checker.AddCheck("postgres", CustomHealthCheck(func(ctx context.Context) error {
+		if !postgresUp.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}))
+	checker.AddCheck("redis", CustomHealthCheck(func(ctx context.Context) error {
+		return nil
+	}))
+	return NewHealthGate(checker, 5*time.Second)
+}
+
+func TestHealthGateUnavailable(t *testing.T) {
+	var postgresUp atomic.Bool
+	gate := newTestHealthGate(&postgresUp)
+
+	if _, down := gate.Unavailable("postgres"); down {
+		t.Errorf("Expected unchecked dependencies to be assumed up")
+	}
+
+	gate.Refresh(context.Background())
+	if name, down := gate.Unavailable("redis", "postgres"); !down || name != "postgres" {
+		t.Errorf("Expected postgres to be unavailable, got %q, %v", name, down)
+	}
+	if _, down := gate.Unavailable("redis"); down {
+		t.Errorf("Expected redis to be available")
+	}
+
+	if health, ok := gate.Status("postgres"); !ok || health.Message != "connection refused" {
+		t.Errorf("Expected postgres status to be kept, got %+v", health)
+	}
+
+	postgresUp.Store(true)
+	gate.Refresh(context.Background())
+	if _, down := gate.Unavailable("postgres"); down {
+		t.Errorf("Expected postgres to be available after recovering")
+	}
+}
+
+func TestHealthGateRequire(t *testing.T) {
+	var postgresUp atomic.Bool
+	gate := newTestHealthGate(&postgresUp)
+	gate.Refresh(context.Background())
+
+	handler := gate.Require("postgres")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/codes/generate", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "5" {
+		t.Errorf("Expected Retry-After 5, got %q", w.Header().Get("Retry-After"))
+	}
+
+	postgresUp.Store(true)
+	gate.Refresh(context.Background())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/codes/generate", nil))
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d", w.Code)
+	}
+}
+
+func TestGinHealthGateRequire(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var postgresUp atomic.Bool
+	gate := newTestHealthGate(&postgresUp)
+	gate.Refresh(context.Background())
+
+	router := gin.New()
+	router.POST("/codes/generate", gate.GinRequire("postgres"), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+	router.GET("/codes", gate.GinRequire("redis"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/codes/generate", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/codes", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected routes without the dependency to be served, got %d", w.Code)
+	}
+}
+
+func TestHealthGateStart(t *testing.T) {
+	var postgresUp atomic.Bool
+	gate := newTestHealthGate(&postgresUp)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gate.Start(ctx)
+
+	if _, down := gate.Unavailable("postgres"); !down {
+		t.Errorf("Expected Start to check dependencies immediately")
+	}
+}
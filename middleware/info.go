@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/envcontract"
+	"github.com/jarakey/jarakey-shared-middleware/secrets"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// Build details stamped at link time, e.g.
+//
+//	go build -ldflags "-X github.com/jarakey/jarakey-shared-middleware/middleware.Version=$(git describe --tags)"
+//
+// Empty values fall back to the module version and VCS details Go records
+// in the binary.
+var (
+	Version   string
+	GitSHA    string
+	BuildTime string
+)
+
+// sensitiveConfigKey matches config keys whose values are masked before the
+// config checksum is computed
+var sensitiveConfigKey = regexp.MustCompile(`(?i)(password|passwd|secret|token|api_?key|private_?key|credential|dsn)`)
+
+// InfoConfig holds what the info endpoint reports
+type InfoConfig struct {
+	ServiceName string `json:"service_name"`
+
+	// Version, GitSHA and BuildTime override the package-level build details
+	Version   string `json:"version"`
+	GitSHA    string `json:"git_sha"`
+	BuildTime string `json:"build_time"`
+
+	// Stack's layers are reported as enabled middleware, followed by
+	// Middleware for what's added outside the stack
+	Stack      *Stack   `json:"-"`
+	Middleware []string `json:"middleware"`
+
+	// Config is the service's configuration. Only a checksum of it is
+	// reported, computed with secrets masked, so two instances can be
+	// compared without exposing or fingerprinting credentials.
+	Config interface{} `json:"-"`
+
+	// Environment is reported as the service's environment contract, with
+	// secret values masked
+	Environment *envcontract.Values `json:"-"`
+}
+
+// Info describes a running service for deploy verification
+type Info struct {
+	Service        string   `json:"service"`
+	Version        string   `json:"version"`
+	GitSHA         string   `json:"git_sha"`
+	BuildTime      string   `json:"build_time"`
+	GoVersion      string   `json:"go_version"`
+	Middleware     []string `json:"middleware"`
+	ConfigChecksum string   `json:"config_checksum,omitempty"`
+
+	Environment []envcontract.VarReport `json:"environment,omitempty"`
+}
+
+// NewInfo collects the service's info. It fails when the config can't be
+// encoded as JSON.
+func NewInfo(config *InfoConfig) (*Info, error) {
+	if config == nil {
+		config = &InfoConfig{}
+	}
+
+	info := &Info{
+		Service:    config.ServiceName,
+		Version:    firstNonEmpty(config.Version, Version),
+		GitSHA:     firstNonEmpty(config.GitSHA, GitSHA),
+		BuildTime:  firstNonEmpty(config.BuildTime, BuildTime),
+		GoVersion:  runtime.Version(),
+		Middleware: []string{},
+	}
+	if config.Stack != nil {
+		info.Middleware = append(info.Middleware, config.Stack.Names()...)
+	}
+	info.Middleware = append(info.Middleware, config.Middleware...)
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		info.fillFromBuild(build)
+	}
+
+	if config.Environment != nil {
+		info.Environment = config.Environment.Report()
+	}
+
+	if config.Config != nil {
+		checksum, err := ConfigChecksum(config.Config)
+		if err != nil {
+			return nil, err
+		}
+		info.ConfigChecksum = checksum
+	}
+	return info, nil
+}
+
+// fillFromBuild fills in build details that weren't stamped at link time
+func (i *Info) fillFromBuild(build *debug.BuildInfo) {
+	if i.Version == "" && build.Main.Version != "(devel)" {
+		i.Version = build.Main.Version
+	}
+	settings := make(map[string]string, len(build.Settings))
+	for _, setting := range build.Settings {
+		settings[setting.Key] = setting.Value
+	}
+	if i.GitSHA == "" && settings["vcs.revision"] != "" {
+		i.GitSHA = settings["vcs.revision"]
+		if settings["vcs.modified"] == "true" {
+			i.GitSHA += "-dirty"
+		}
+	}
+	if i.BuildTime == "" {
+		i.BuildTime = settings["vcs.time"]
+	}
+	if i.Version == "" {
+		i.Version = "dev"
+	}
+}
+
+// firstNonEmpty returns the first value that isn't empty
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// ConfigChecksum returns the SHA-256 of config encoded as JSON, with the
+// values of secret-looking keys, secrets.Secret values and credentials in
+// strings masked first. Rotating a secret doesn't change the checksum.
+func ConfigChecksum(config interface{}) (string, error) {
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode config: %w", err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return "", fmt.Errorf("failed to decode config: %w", err)
+	}
+
+	// Maps are encoded with sorted keys, so equal configs hash the same
+	masked, err := json.Marshal(maskConfig(decoded))
+	if err != nil {
+		return "", fmt.Errorf("failed to encode config: %w", err)
+	}
+	sum := sha256.Sum256(masked)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// maskConfig replaces secrets in a decoded JSON value with the placeholder
+func maskConfig(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if s, ok := field.(string); ok && s != "" && sensitiveConfigKey.MatchString(key) {
+				v[key] = secrets.Placeholder
+				continue
+			}
+			v[key] = maskConfig(field)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = maskConfig(item)
+		}
+		return v
+	case string:
+		return secrets.Redact(v)
+	default:
+		return v
+	}
+}
+
+// Handler serves the info, typically at /info
+func (i *Info) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, body := types.OK(i)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	})
+}
+
+// GinHandler is the Gin version of Handler
+func (i *Info) GinHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(types.OK(i))
+	}
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/envcontract"
+	"github.com/jarakey/jarakey-shared-middleware/secrets"
+)
+
+// infoTestConfig is a service config with secrets in it
+type infoTestConfig struct {
+	Port        int            `json:"port"`
+	DatabaseURL string         `json:"database_url"`
+	JWTSecret   string         `json:"jwt_secret"`
+	APIKey      secrets.Secret `json:"api_key"`
+}
+
+func TestNewInfo(t *testing.T) {
+	stack, err := NewStack(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := NewInfo(&InfoConfig{
+		ServiceName: "validation-service",
+		Version:     "v1.4.0",
+		GitSHA:      "3a76a2b",
+		BuildTime:   "2026-10-01T12:00:00Z",
+		Stack:       stack,
+		Middleware:  []string{"locale"},
+		Config:      infoTestConfig{Port: 8080},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Service != "validation-service" || info.Version != "v1.4.0" || info.GitSHA != "3a76a2b" || info.BuildTime != "2026-10-01T12:00:00Z" {
+		t.Errorf("Expected the configured build details, got %+v", info)
+	}
+	if info.GoVersion != runtime.Version() {
+		t.Errorf("Expected Go version %s, got %s", runtime.Version(), info.GoVersion)
+	}
+	if want := []string{"recovery", "correlation", "timeout", "locale"}; !reflect.DeepEqual(info.Middleware, want) {
+		t.Errorf("Expected middleware %v, got %v", want, info.Middleware)
+	}
+	if len(info.ConfigChecksum) != 64 {
+		t.Errorf("Expected a SHA-256 config checksum, got %q", info.ConfigChecksum)
+	}
+}
+
+func TestNewInfoWithoutBuildDetails(t *testing.T) {
+	info, err := NewInfo(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version == "" {
+		t.Error("Expected a version to always be reported")
+	}
+	if info.Middleware == nil || info.ConfigChecksum != "" {
+		t.Errorf("Expected no middleware and no checksum, got %+v", info)
+	}
+}
+
+func TestConfigChecksumMasksSecrets(t *testing.T) {
+	config := infoTestConfig{
+		Port:        8080,
+		DatabaseURL: "postgres://app:hunter2@db:5432/app",
+		JWTSecret:   "first-secret",
+		APIKey:      secrets.NewSecret("first-api-key"),
+	}
+	checksum, err := ConfigChecksum(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := config
+	rotated.DatabaseURL = "postgres://app:correct-horse@db:5432/app"
+	rotated.JWTSecret = "second-secret"
+	rotated.APIKey = secrets.NewSecret("second-api-key")
+	if got, _ := ConfigChecksum(rotated); got != checksum {
+		t.Error("Expected rotating secrets not to change the checksum")
+	}
+
+	changed := config
+	changed.Port = 9090
+	if got, _ := ConfigChecksum(changed); got == checksum {
+		t.Error("Expected a config change to change the checksum")
+	}
+
+	if _, err := ConfigChecksum(map[string]interface{}{"bad": func() {}}); err == nil {
+		t.Error("Expected an error for a config that can't be encoded")
+	}
+}
+
+func TestInfoHandler(t *testing.T) {
+	info, err := NewInfo(&InfoConfig{ServiceName: "validation-service", Version: "v1.4.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body struct {
+		Success bool `json:"success"`
+		Data    Info `json:"data"`
+	}
+	w := httptest.NewRecorder()
+	info.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/info", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if !body.Success || body.Data.Service != "validation-service" || body.Data.Version != "v1.4.0" {
+		t.Errorf("Unexpected info response: %s", w.Body.String())
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/info", info.GinHandler())
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/info", nil))
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &body) != nil || body.Data.GoVersion != runtime.Version() {
+		t.Errorf("Unexpected Gin info response: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestInfoReportsEnvironment(t *testing.T) {
+	env := map[string]string{"PORT": "8080", "JWT_SECRET": "info-jwt-secret"}
+	values, err := envcontract.New("validation-service",
+		envcontract.Var{Name: "PORT", Type: envcontract.TypeInt, Required: true},
+		envcontract.Var{Name: "JWT_SECRET", Required: true, Secret: true},
+	).LoadFrom(func(name string) (string, bool) {
+		value, found := env[name]
+		return value, found
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := NewInfo(&InfoConfig{ServiceName: "validation-service", Environment: values})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	info.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/info", nil))
+	if strings.Contains(w.Body.String(), "info-jwt-secret") {
+		t.Errorf("Expected secret values to be masked: %s", w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"name":"PORT","type":"int","required":true,"secret":false,"value":"8080","source":"env"`) {
+		t.Errorf("Expected the environment contract in the info: %s", w.Body.String())
+	}
+}
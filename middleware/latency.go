@@ -0,0 +1,267 @@
+package middleware
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+)
+
+// OtherEndpoint collects latencies of endpoints beyond MaxEndpoints
+const OtherEndpoint = "other"
+
+// LatencyConfig holds the configuration for a LatencyRecorder
+type LatencyConfig struct {
+	// Window is how much history percentiles cover: between one and two
+	// windows. 0 keeps everything since the recorder was created.
+	Window time.Duration `json:"window"`
+
+	// MaxEndpoints caps the endpoints tracked separately; the rest are
+	// tracked together as OtherEndpoint
+	MaxEndpoints int `json:"max_endpoints"`
+
+	Clock clock.Clock `json:"-"` // nil uses the system clock
+}
+
+// DefaultLatencyConfig returns a configuration covering the last 5 to 10
+// minutes of up to 200 endpoints
+func DefaultLatencyConfig() *LatencyConfig {
+	return &LatencyConfig{
+		Window:       5 * time.Minute,
+		MaxEndpoints: 200,
+	}
+}
+
+// LatencySummary is the latency distribution of one endpoint
+type LatencySummary struct {
+	Endpoint string  `json:"endpoint"`
+	Count    uint64  `json:"count"`
+	MeanMs   float64 `json:"mean_ms"`
+	P50Ms    float64 `json:"p50_ms"`
+	P95Ms    float64 `json:"p95_ms"`
+	P99Ms    float64 `json:"p99_ms"`
+	MaxMs    float64 `json:"max_ms"`
+}
+
+// LatencyRecorder tracks request latency percentiles per endpoint in
+// process, for debugging where Prometheus isn't scraping, such as local
+// development and air-gapped installs. Latencies are kept in HDR-style
+// buckets, so percentiles are within 1% of the true value and memory
+// doesn't grow with traffic.
+type LatencyRecorder struct {
+	config    *LatencyConfig
+	clock     clock.Clock
+	endpoints map[string]*endpointLatency
+	mutex     sync.RWMutex
+}
+
+// NewLatencyRecorder creates a latency recorder
+func NewLatencyRecorder(config *LatencyConfig) *LatencyRecorder {
+	if config == nil {
+		config = DefaultLatencyConfig()
+	}
+	return &LatencyRecorder{
+		config:    config,
+		clock:     clock.OrReal(config.Clock),
+		endpoints: make(map[string]*endpointLatency),
+	}
+}
+
+// Record adds a latency for an endpoint, e.g. "GET /codes/:id"
+func (l *LatencyRecorder) Record(endpoint string, duration time.Duration) {
+	l.endpoint(endpoint).record(duration, l.clock.Now(), l.config.Window)
+}
+
+// endpoint returns the tracker for an endpoint, creating it while under
+// MaxEndpoints
+func (l *LatencyRecorder) endpoint(name string) *endpointLatency {
+	l.mutex.RLock()
+	e, ok := l.endpoints[name]
+	l.mutex.RUnlock()
+	if ok {
+		return e
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if e, ok := l.endpoints[name]; ok {
+		return e
+	}
+	if l.config.MaxEndpoints > 0 && len(l.endpoints) >= l.config.MaxEndpoints && name != OtherEndpoint {
+		if e, ok := l.endpoints[OtherEndpoint]; ok {
+			return e
+		}
+		name = OtherEndpoint
+	}
+	e = &endpointLatency{current: &latencyHistogram{}, rotated: l.clock.Now()}
+	l.endpoints[name] = e
+	return e
+}
+
+// Summary returns the latency distribution of every endpoint with traffic
+// in the window, sorted by endpoint
+func (l *LatencyRecorder) Summary() []LatencySummary {
+	l.mutex.RLock()
+	endpoints := make(map[string]*endpointLatency, len(l.endpoints))
+	names := make([]string, 0, len(l.endpoints))
+	for name, e := range l.endpoints {
+		endpoints[name] = e
+		names = append(names, name)
+	}
+	l.mutex.RUnlock()
+	sort.Strings(names)
+
+	now := l.clock.Now()
+	summaries := make([]LatencySummary, 0, len(names))
+	for _, name := range names {
+		histogram := endpoints[name].snapshot(now, l.config.Window)
+		if histogram.total == 0 {
+			continue
+		}
+		summaries = append(summaries, LatencySummary{
+			Endpoint: name,
+			Count:    histogram.total,
+			MeanMs:   milliseconds(histogram.sum / time.Duration(histogram.total)),
+			P50Ms:    milliseconds(histogram.quantile(0.50)),
+			P95Ms:    milliseconds(histogram.quantile(0.95)),
+			P99Ms:    milliseconds(histogram.quantile(0.99)),
+			MaxMs:    milliseconds(histogram.max),
+		})
+	}
+	return summaries
+}
+
+// milliseconds converts a duration to milliseconds with microsecond precision
+func milliseconds(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Microsecond)) / 1000
+}
+
+// latencyEndpoint names an endpoint by method and route. Routes from an
+// http.ServeMux pattern may already start with the method.
+func latencyEndpoint(method, route string) string {
+	if strings.Contains(route, " ") {
+		return route
+	}
+	return method + " " + route
+}
+
+// endpointLatency keeps the current and previous window of an endpoint
+type endpointLatency struct {
+	current  *latencyHistogram
+	previous *latencyHistogram
+	rotated  time.Time
+	mutex    sync.Mutex
+}
+
+// rotate starts a new window when the current one is over
+func (e *endpointLatency) rotate(now time.Time, window time.Duration) {
+	if window <= 0 || now.Sub(e.rotated) < window {
+		return
+	}
+	e.previous = e.current
+	if now.Sub(e.rotated) >= 2*window {
+		e.previous = nil
+	}
+	e.current = &latencyHistogram{}
+	e.rotated = now
+}
+
+func (e *endpointLatency) record(duration time.Duration, now time.Time, window time.Duration) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.rotate(now, window)
+	e.current.record(duration)
+}
+
+// snapshot returns the current and previous windows merged
+func (e *endpointLatency) snapshot(now time.Time, window time.Duration) *latencyHistogram {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.rotate(now, window)
+	merged := &latencyHistogram{}
+	merged.merge(e.current)
+	if e.previous != nil {
+		merged.merge(e.previous)
+	}
+	return merged
+}
+
+// latencySubBuckets is the number of buckets per power of two. Values below
+// 2*latencySubBuckets microseconds are exact; larger ones are bucketed to
+// within 1/(2*latencySubBuckets) of their value.
+const latencySubBuckets = 64
+
+// latencyHistogram counts latencies in log-linear microsecond buckets
+type latencyHistogram struct {
+	counts []uint64
+	total  uint64
+	sum    time.Duration
+	max    time.Duration
+}
+
+// latencyIndex returns the bucket of a latency in microseconds
+func latencyIndex(us uint64) int {
+	if us < 2*latencySubBuckets {
+		return int(us)
+	}
+	shift := bits.Len64(us) - bits.Len64(2*latencySubBuckets-1)
+	mantissa := us >> shift
+	return 2*latencySubBuckets + (shift-1)*latencySubBuckets + int(mantissa-latencySubBuckets)
+}
+
+// latencyValue returns the middle of a bucket in microseconds
+func latencyValue(index int) uint64 {
+	if index < 2*latencySubBuckets {
+		return uint64(index)
+	}
+	offset := index - 2*latencySubBuckets
+	shift := offset/latencySubBuckets + 1
+	mantissa := uint64(offset%latencySubBuckets + latencySubBuckets)
+	return mantissa<<shift + (uint64(1)<<shift)/2
+}
+
+func (h *latencyHistogram) record(duration time.Duration) {
+	if duration < 0 {
+		duration = 0
+	}
+	index := latencyIndex(uint64(duration / time.Microsecond))
+	if index >= len(h.counts) {
+		h.counts = append(h.counts, make([]uint64, index+1-len(h.counts))...)
+	}
+	h.counts[index]++
+	h.total++
+	h.sum += duration
+	h.max = max(h.max, duration)
+}
+
+func (h *latencyHistogram) merge(other *latencyHistogram) {
+	if len(other.counts) > len(h.counts) {
+		h.counts = append(h.counts, make([]uint64, len(other.counts)-len(h.counts))...)
+	}
+	for i, count := range other.counts {
+		h.counts[i] += count
+	}
+	h.total += other.total
+	h.sum += other.sum
+	h.max = max(h.max, other.max)
+}
+
+// quantile returns the latency below which the fraction q of samples fall
+func (h *latencyHistogram) quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	target := uint64(math.Ceil(q * float64(h.total)))
+	var seen uint64
+	for i, count := range h.counts {
+		seen += count
+		if seen >= target {
+			return min(time.Duration(latencyValue(i))*time.Microsecond, h.max)
+		}
+	}
+	return h.max
+}
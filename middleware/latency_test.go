@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+)
+
+func TestLatencyHistogramBuckets(t *testing.T) {
+	// Every value maps into a bucket whose middle is within 1% of it
+	for _, us := range []uint64{0, 1, 127, 128, 129, 255, 256, 1000, 12345, 999999, 3600000000} {
+		index := latencyIndex(us)
+		got := latencyValue(index)
+		if us >= 128 && math.Abs(float64(got)-float64(us))/float64(us) > 0.01 {
+			t.Errorf("Value %d: bucket %d reports %d, more than 1%% off", us, index, got)
+		}
+		if us < 128 && got != us {
+			t.Errorf("Expected small value %d to be exact, got %d", us, got)
+		}
+		if latencyIndex(got) != index {
+			t.Errorf("Value %d: bucket middle %d falls in another bucket", us, got)
+		}
+	}
+	if latencyIndex(255)+1 != latencyIndex(256) {
+		t.Error("Expected buckets to be contiguous across powers of two")
+	}
+}
+
+func TestLatencyRecorderPercentiles(t *testing.T) {
+	recorder := NewLatencyRecorder(&LatencyConfig{Window: time.Minute})
+	for i := 1; i <= 1000; i++ {
+		recorder.Record("GET /codes/:id", time.Duration(i)*time.Millisecond)
+	}
+
+	summary := recorder.Summary()
+	if len(summary) != 1 {
+		t.Fatalf("Expected one endpoint, got %+v", summary)
+	}
+	s := summary[0]
+	if s.Endpoint != "GET /codes/:id" || s.Count != 1000 {
+		t.Errorf("Unexpected summary %+v", s)
+	}
+	for _, check := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"p50", s.P50Ms, 500},
+		{"p95", s.P95Ms, 950},
+		{"p99", s.P99Ms, 990},
+		{"mean", s.MeanMs, 500.5},
+		{"max", s.MaxMs, 1000},
+	} {
+		if math.Abs(check.got-check.want)/check.want > 0.01 {
+			t.Errorf("Expected %s near %.1fms, got %.3fms", check.name, check.want, check.got)
+		}
+	}
+}
+
+func TestLatencyRecorderWindow(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	recorder := NewLatencyRecorder(&LatencyConfig{Window: time.Minute, Clock: fake})
+
+	recorder.Record("GET /codes", 100*time.Millisecond)
+	fake.Advance(time.Minute)
+	recorder.Record("GET /codes", 10*time.Millisecond)
+	if summary := recorder.Summary(); summary[0].Count != 2 || summary[0].MaxMs != 100 {
+		t.Errorf("Expected the previous window to be included, got %+v", summary)
+	}
+
+	fake.Advance(time.Minute)
+	recorder.Record("GET /codes", 20*time.Millisecond)
+	if summary := recorder.Summary(); summary[0].Count != 2 || summary[0].MaxMs != 20 {
+		t.Errorf("Expected the oldest window to be dropped, got %+v", summary)
+	}
+
+	fake.Advance(5 * time.Minute)
+	if summary := recorder.Summary(); len(summary) != 0 {
+		t.Errorf("Expected idle endpoints to be left out, got %+v", summary)
+	}
+}
+
+func TestLatencyRecorderMaxEndpoints(t *testing.T) {
+	recorder := NewLatencyRecorder(&LatencyConfig{MaxEndpoints: 2})
+	for _, endpoint := range []string{"GET /a", "GET /b", "GET /c", "GET /d"} {
+		recorder.Record(endpoint, time.Millisecond)
+	}
+
+	summary := recorder.Summary()
+	if len(summary) != 3 || summary[2].Endpoint != OtherEndpoint || summary[2].Count != 2 {
+		t.Errorf("Expected endpoints beyond the cap under %q, got %+v", OtherEndpoint, summary)
+	}
+}
+
+func TestMetricsSummaryIncludesLatency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registry := NewMetricsRegistry("test-service")
+	registry.TrackLatency(NewLatencyRecorder(nil))
+	defer registry.TrackLatency(nil)
+
+	router := gin.New()
+	router.Use(registry.GinMetricsMiddleware())
+	router.GET("/codes/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/debug/metrics", registry.GinSummaryHandler())
+	for _, path := range []string{"/codes/1", "/codes/2", "/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/metrics", nil))
+	var body struct {
+		Data struct {
+			Latency []LatencySummary `json:"latency"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode summary: %v", err)
+	}
+	latency := body.Data.Latency
+	if len(latency) != 2 || latency[0].Endpoint != "GET /codes/:id" || latency[0].Count != 2 || latency[1].Endpoint != "GET unmatched" {
+		t.Errorf("Expected latency per route, got %+v", latency)
+	}
+}
+
+func TestMetricsMiddlewareRecordsServeMuxPattern(t *testing.T) {
+	registry := NewMetricsRegistry("test-service")
+	recorder := NewLatencyRecorder(nil)
+	registry.TrackLatency(recorder)
+	defer registry.TrackLatency(nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /codes/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	handler := registry.MetricsMiddleware()(mux)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/codes/42", nil))
+
+	w := httptest.NewRecorder()
+	registry.SummaryHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/metrics", nil))
+	summary := recorder.Summary()
+	if len(summary) != 1 || summary[0].Endpoint != "GET /codes/{id}" {
+		t.Errorf("Expected the mux pattern as endpoint, got %+v", summary)
+	}
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected a JSON summary, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// shutdownHook is a named step of graceful shutdown
+type shutdownHook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Lifecycle coordinates graceful shutdown. Components register hooks as they
+// start; Shutdown runs them in reverse order, so what started last stops first.
+type Lifecycle struct {
+	hooks []shutdownHook
+	done  chan struct{}
+	once  sync.Once
+	mutex sync.Mutex
+}
+
+// NewLifecycle creates a lifecycle manager
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{done: make(chan struct{})}
+}
+
+// OnShutdown registers a hook to run during shutdown
+func (l *Lifecycle) OnShutdown(name string, fn func(ctx context.Context) error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.hooks = append(l.hooks, shutdownHook{name: name, fn: fn})
+}
+
+// Done returns a channel that is closed when shutdown begins
+func (l *Lifecycle) Done() <-chan struct{} {
+	return l.done
+}
+
+// ShuttingDown reports whether shutdown has begun
+func (l *Lifecycle) ShuttingDown() bool {
+	select {
+	case <-l.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Shutdown runs every hook in reverse registration order, even when earlier
+// ones fail, and returns their errors joined. ctx bounds the whole shutdown.
+// Only the first call runs the hooks.
+func (l *Lifecycle) Shutdown(ctx context.Context) error {
+	var hooks []shutdownHook
+	l.once.Do(func() {
+		close(l.done)
+
+		l.mutex.Lock()
+		hooks = append(hooks, l.hooks...)
+		l.mutex.Unlock()
+	})
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i].fn(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", hooks[i].name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLifecycleShutdown(t *testing.T) {
+	lifecycle := NewLifecycle()
+
+	var order []string
+	lifecycle.OnShutdown("database", func(ctx context.Context) error {
+		order = append(order, "database")
+		return nil
+	})
+	lifecycle.OnShutdown("workers", func(ctx context.Context) error {
+		order = append(order, "workers")
+		return errors.New("still running")
+	})
+	lifecycle.OnShutdown("server", func(ctx context.Context) error {
+		order = append(order, "server")
+		if !lifecycle.ShuttingDown() {
+			t.Errorf("Expected ShuttingDown during hooks")
+		}
+		return nil
+	})
+
+	if lifecycle.ShuttingDown() {
+		t.Errorf("Expected not to be shutting down yet")
+	}
+
+	err := lifecycle.Shutdown(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "workers: still running") {
+		t.Errorf("Expected the failed hook to be named, got %v", err)
+	}
+	if !reflect.DeepEqual(order, []string{"server", "workers", "database"}) {
+		t.Errorf("Expected hooks in reverse order, got %v", order)
+	}
+
+	select {
+	case <-lifecycle.Done():
+	default:
+		t.Errorf("Expected Done to be closed")
+	}
+
+	// Hooks run once
+	if err := lifecycle.Shutdown(context.Background()); err != nil || len(order) != 3 {
+		t.Errorf("Expected a second shutdown to do nothing, got %v %v", err, order)
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/i18n"
+	"golang.org/x/text/language"
+)
+
+// LocaleConfig holds the configuration for locale negotiation
+type LocaleConfig struct {
+	// Catalog holds the supported locales and their messages
+	Catalog *i18n.Catalog `json:"-"`
+
+	// QueryParam names a query parameter that takes precedence over
+	// Accept-Language, e.g. "lang"; empty only uses the header
+	QueryParam string `json:"query_param"`
+}
+
+// DefaultLocaleConfig returns a configuration with an empty English catalog
+func DefaultLocaleConfig() *LocaleConfig {
+	return &LocaleConfig{
+		Catalog: i18n.NewCatalog(language.English),
+	}
+}
+
+// negotiateLocale picks the request's locale, stores a localizer for it in
+// the context and describes it in the response headers
+func negotiateLocale(config *LocaleConfig, r *http.Request, header http.Header) context.Context {
+	var preferred []language.Tag
+	if config.QueryParam != "" {
+		if tag, err := language.Parse(r.URL.Query().Get(config.QueryParam)); err == nil {
+			preferred = append(preferred, tag)
+		}
+	}
+	if accepted, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language")); err == nil {
+		preferred = append(preferred, accepted...)
+	}
+
+	tag := config.Catalog.Fallback()
+	if len(preferred) > 0 {
+		tag = config.Catalog.Match(preferred...)
+	}
+	header.Set("Content-Language", tag.String())
+	header.Add("Vary", "Accept-Language")
+	return i18n.NewContext(r.Context(), i18n.NewLocalizer(config.Catalog, tag))
+}
+
+// LocaleMiddleware negotiates each request's locale from Accept-Language
+// and keeps it in the request context. Errors written with RenderError are
+// then localized, and handlers translate their own messages with i18n.T.
+func LocaleMiddleware(config *LocaleConfig) func(http.Handler) http.Handler {
+	if config == nil {
+		config = DefaultLocaleConfig()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(negotiateLocale(config, r, w.Header())))
+		})
+	}
+}
+
+// GinLocaleMiddleware creates locale negotiation middleware for Gin framework
+func GinLocaleMiddleware(config *LocaleConfig) gin.HandlerFunc {
+	if config == nil {
+		config = DefaultLocaleConfig()
+	}
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(negotiateLocale(config, c.Request, c.Writer.Header()))
+		c.Next()
+	}
+}
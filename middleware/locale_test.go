@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/i18n"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"golang.org/x/text/language"
+)
+
+// localeConfig returns a configuration with Spanish messages
+func localeConfig() *LocaleConfig {
+	catalog := i18n.NewCatalog(language.English)
+	catalog.Add(language.Spanish, map[string]string{
+		"Code created":    "Código creado",
+		"error.not_found": "No encontrado",
+		"field.required":  "{field} es obligatorio",
+	})
+	return &LocaleConfig{Catalog: catalog, QueryParam: "lang"}
+}
+
+func TestLocaleMiddleware(t *testing.T) {
+	handler := LocaleMiddleware(localeConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			RenderError(w, r, types.NewValidationError(types.FieldError{Field: "code", Code: "required", Message: "Code is required"}))
+			return
+		}
+		json.NewEncoder(w).Encode(types.APIResponse{Success: true, Message: i18n.T(r.Context(), "Code created", nil)})
+	}))
+
+	tests := []struct {
+		name           string
+		target         string
+		acceptLanguage string
+		language       string
+		message        string
+	}{
+		{"accept language", "/codes", "es-MX,es;q=0.9", "es", "Código creado"},
+		{"unsupported", "/codes", "fr-FR", "en", "Code created"},
+		{"no header", "/codes", "", "en", "Code created"},
+		{"query parameter wins", "/codes?lang=en", "es", "en", "Code created"},
+		{"invalid query parameter", "/codes?lang=!!", "es", "es", "Código creado"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			r.Header.Set("Accept-Language", tt.acceptLanguage)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, r)
+
+			var body types.APIResponse
+			json.Unmarshal(recorder.Body.Bytes(), &body)
+			if recorder.Header().Get("Content-Language") != tt.language || body.Message != tt.message {
+				t.Errorf("Expected %s %q, got %s %q", tt.language, tt.message, recorder.Header().Get("Content-Language"), body.Message)
+			}
+			if recorder.Header().Get("Vary") != "Accept-Language" {
+				t.Errorf("Expected Vary: Accept-Language, got %v", recorder.Header())
+			}
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/missing", nil)
+	r.Header.Set("Accept-Language", "es")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+	var apiErr types.APIError
+	json.Unmarshal(recorder.Body.Bytes(), &apiErr)
+	if len(apiErr.Fields) != 1 || apiErr.Fields[0].Message != "code es obligatorio" || apiErr.Message != "Request validation failed" {
+		t.Errorf("Expected localized field errors, got %s", recorder.Body.String())
+	}
+}
+
+func TestGinLocaleMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(GinLocaleMiddleware(localeConfig()))
+	router.GET("/devices/:id", func(c *gin.Context) {
+		GinRenderError(c, types.NewNotFoundError("Device"))
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/devices/1", nil)
+	r.Header.Set("Accept-Language", "es-ES")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, r)
+
+	var apiErr types.APIError
+	json.Unmarshal(recorder.Body.Bytes(), &apiErr)
+	if recorder.Code != http.StatusNotFound || apiErr.Message != "No encontrado" || recorder.Header().Get("Content-Language") != "es" {
+		t.Errorf("Expected a localized error, got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -1,11 +1,14 @@
 package middleware
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -149,6 +152,14 @@ var (
 		[]string{"service", "database", "error_type"},
 	)
 	
+	databaseSlowQueries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "database_slow_queries_total",
+			Help: "Total number of database queries slower than the slow query threshold",
+		},
+		[]string{"service", "database", "query_type"},
+	)
+	
 	// Redis metrics
 	redisConnections = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -174,12 +185,232 @@ var (
 		},
 		[]string{"service", "operation"},
 	)
+	
+	// Goroutine metrics
+	goroutinesActive = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "goroutines_active",
+			Help: "Current number of running background goroutines",
+		},
+		[]string{"service", "name"},
+	)
+	
+	goroutinePanics = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "goroutine_panics_total",
+			Help: "Total number of panics recovered in background goroutines",
+		},
+		[]string{"service", "name"},
+	)
+	
+	// Event bus metrics
+	eventsPublished = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "events_published_total",
+			Help: "Total number of events published",
+		},
+		[]string{"service", "event_type", "status"},
+	)
+	
+	eventsHandled = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "events_handled_total",
+			Help: "Total number of event deliveries handled",
+		},
+		[]string{"service", "event_type", "status"},
+	)
+	
+	eventHandlingDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "event_handling_duration_seconds",
+			Help:    "Duration of event handling in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"service", "event_type"},
+	)
+	
+	// Saga metrics
+	sagaRuns = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "saga_runs_total",
+			Help: "Total number of saga runs by outcome",
+		},
+		[]string{"service", "saga", "status"},
+	)
+	
+	sagaSteps = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "saga_steps_total",
+			Help: "Total number of saga step executions and compensations",
+		},
+		[]string{"service", "saga", "step", "phase", "status"},
+	)
+	
+	sagaStepDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "saga_step_duration_seconds",
+			Help:    "Duration of saga steps in seconds, including retries",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"service", "saga", "step", "phase"},
+	)
+	
+	// Notification metrics
+	notificationsSent = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notifications_total",
+			Help: "Total number of notifications by delivery outcome",
+		},
+		[]string{"service", "channel", "provider", "status"},
+	)
+	
+	notificationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "notification_delivery_duration_seconds",
+			Help:    "Duration of notification deliveries in seconds, including retries",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"service", "channel", "provider"},
+	)
+	
+	// Webhook metrics
+	webhookDuplicates = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "webhook_duplicates_total",
+			Help: "Total number of duplicate webhook deliveries answered without processing",
+		},
+		[]string{"service", "source"},
+	)
+	
+	// Task queue metrics
+	tasksEnqueued = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tasks_enqueued_total",
+			Help: "Total number of background tasks enqueued",
+		},
+		[]string{"service", "task_type", "status"},
+	)
+	
+	tasksProcessed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tasks_processed_total",
+			Help: "Total number of background task runs by outcome",
+		},
+		[]string{"service", "task_type", "status"},
+	)
+	
+	taskDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "task_duration_seconds",
+			Help:    "Duration of background task runs in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"service", "task_type"},
+	)
+	
+	// Object storage metrics
+	storageOperations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_operations_total",
+			Help: "Total number of object storage operations by outcome",
+		},
+		[]string{"service", "backend", "operation", "status"},
+	)
+	
+	storageOperationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "storage_operation_duration_seconds",
+			Help:    "Duration of object storage operations in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"service", "backend", "operation"},
+	)
+	
+	// Shutdown drain metrics
+	drainInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "drain_in_flight",
+			Help: "Work still in flight while the service drains, by kind",
+		},
+		[]string{"service", "kind"},
+	)
+	
+	// Quota metrics
+	quotaChecks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "quota_checks_total",
+			Help: "Total number of organization quota checks by outcome",
+		},
+		[]string{"service", "metric", "outcome"},
+	)
+
+	// Brute-force protection metrics
+	bruteForceOutcomes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_validation_protection_total",
+			Help: "Total number of code validation attempts counted or blocked by brute-force protection, by outcome",
+		},
+		[]string{"service", "outcome"},
+	)
+
+	// Request filtering metrics
+	fingerprintRules = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "request_filter_matches_total",
+			Help: "Total number of requests matched by fingerprint rules, by rule and action",
+		},
+		[]string{"service", "rule", "action"},
+	)
+
+	// Leader election metrics
+	leaderElectionLeader = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "leader_election_is_leader",
+			Help: "Whether this instance holds the leadership of an election (1) or not (0)",
+		},
+		[]string{"service", "election"},
+	)
+
+	leaderElectionTransitions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "leader_election_transitions_total",
+			Help: "Total number of times this instance gained or lost the leadership of an election",
+		},
+		[]string{"service", "election", "transition"},
+	)
+
+	// Fallback cache metrics
+	fallbackCacheReads = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "fallback_cache_reads_total",
+			Help: "Total number of reads through a fallback cache by result (fresh, stale, unavailable)",
+		},
+		[]string{"service", "cache", "result"},
+	)
+
+	// Cardinality metrics
+	metricFamilySeries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "metrics_cardinality_series",
+			Help: "Number of series in each metric family when last audited",
+		},
+		[]string{"service", "family"},
+	)
+
+	metricLabelValues = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "metrics_cardinality_limited_label_values",
+			Help: "Distinct values of labels over their cardinality limit when last audited",
+		},
+		[]string{"service", "family", "label"},
+	)
 )
 
 // MetricsRegistry holds all metrics for a service
 type MetricsRegistry struct {
 	serviceName string
 	metrics     map[string]prometheus.Collector
+	latency     atomic.Pointer[LatencyRecorder]
 }
 
 // NewMetricsRegistry creates a new metrics registry
@@ -224,11 +455,61 @@ func (mr *MetricsRegistry) registerMetrics() {
 	registerIfNotExists(databaseConnections)
 	registerIfNotExists(databaseQueryDuration)
 	registerIfNotExists(databaseErrors)
+	registerIfNotExists(databaseSlowQueries)
 	
 	// Redis metrics
 	registerIfNotExists(redisConnections)
 	registerIfNotExists(redisOperations)
 	registerIfNotExists(redisOperationDuration)
+	
+	// Goroutine metrics
+	registerIfNotExists(goroutinesActive)
+	registerIfNotExists(goroutinePanics)
+	
+	// Event bus metrics
+	registerIfNotExists(eventsPublished)
+	registerIfNotExists(eventsHandled)
+	registerIfNotExists(eventHandlingDuration)
+	
+	// Saga metrics
+	registerIfNotExists(sagaRuns)
+	registerIfNotExists(sagaSteps)
+	registerIfNotExists(sagaStepDuration)
+	
+	// Notification metrics
+	registerIfNotExists(notificationsSent)
+	registerIfNotExists(notificationDuration)
+	
+	// Webhook metrics
+	registerIfNotExists(webhookDuplicates)
+	
+	// Task queue metrics
+	registerIfNotExists(tasksEnqueued)
+	registerIfNotExists(tasksProcessed)
+	registerIfNotExists(taskDuration)
+	
+	// Object storage metrics
+	registerIfNotExists(storageOperations)
+	registerIfNotExists(storageOperationDuration)
+	
+	// Shutdown drain metrics
+	registerIfNotExists(drainInFlight)
+	
+	// Quota metrics
+	registerIfNotExists(quotaChecks)
+	registerIfNotExists(bruteForceOutcomes)
+	registerIfNotExists(fingerprintRules)
+
+	// Leader election metrics
+	registerIfNotExists(leaderElectionLeader)
+	registerIfNotExists(leaderElectionTransitions)
+
+	// Fallback cache metrics
+	registerIfNotExists(fallbackCacheReads)
+
+	// Cardinality metrics
+	registerIfNotExists(metricFamilySeries)
+	registerIfNotExists(metricLabelValues)
 }
 
 // registerIfNotExists registers a metric only if it's not already registered
@@ -329,6 +610,11 @@ func (mr *MetricsRegistry) RecordDatabaseError(database, errorType string) {
 	databaseErrors.WithLabelValues(mr.serviceName, database, errorType).Inc()
 }
 
+// RecordSlowDatabaseQuery records a query slower than the slow query threshold
+func (mr *MetricsRegistry) RecordSlowDatabaseQuery(database, queryType string) {
+	databaseSlowQueries.WithLabelValues(mr.serviceName, database, queryType).Inc()
+}
+
 // RecordRedisConnection records Redis connection metrics
 func (mr *MetricsRegistry) RecordRedisConnection(count int) {
 	redisConnections.WithLabelValues(mr.serviceName).Set(float64(count))
@@ -340,6 +626,137 @@ func (mr *MetricsRegistry) RecordRedisOperation(operation, status string, durati
 	redisOperationDuration.WithLabelValues(mr.serviceName, operation).Observe(duration.Seconds())
 }
 
+// RecordGoroutineStart records a background goroutine starting
+func (mr *MetricsRegistry) RecordGoroutineStart(name string) {
+	goroutinesActive.WithLabelValues(mr.serviceName, name).Inc()
+}
+
+// RecordGoroutineEnd records a background goroutine finishing
+func (mr *MetricsRegistry) RecordGoroutineEnd(name string) {
+	goroutinesActive.WithLabelValues(mr.serviceName, name).Dec()
+}
+
+// RecordGoroutinePanic records a panic recovered in a background goroutine
+func (mr *MetricsRegistry) RecordGoroutinePanic(name string) {
+	goroutinePanics.WithLabelValues(mr.serviceName, name).Inc()
+}
+
+// RecordEventPublished records an event being published
+func (mr *MetricsRegistry) RecordEventPublished(eventType, status string) {
+	eventsPublished.WithLabelValues(mr.serviceName, eventType, status).Inc()
+}
+
+// RecordEventHandled records the outcome of delivering an event to a handler
+func (mr *MetricsRegistry) RecordEventHandled(eventType, status string, duration time.Duration) {
+	eventsHandled.WithLabelValues(mr.serviceName, eventType, status).Inc()
+	eventHandlingDuration.WithLabelValues(mr.serviceName, eventType).Observe(duration.Seconds())
+}
+
+// RecordSagaRun records the outcome of a saga run
+func (mr *MetricsRegistry) RecordSagaRun(saga, status string) {
+	sagaRuns.WithLabelValues(mr.serviceName, saga, status).Inc()
+}
+
+// RecordSagaStep records a saga step's action or compensation
+func (mr *MetricsRegistry) RecordSagaStep(saga, step, phase, status string, duration time.Duration) {
+	sagaSteps.WithLabelValues(mr.serviceName, saga, step, phase, status).Inc()
+	sagaStepDuration.WithLabelValues(mr.serviceName, saga, step, phase).Observe(duration.Seconds())
+}
+
+// RecordNotification records the outcome of a notification delivery
+func (mr *MetricsRegistry) RecordNotification(channel, provider, status string, duration time.Duration) {
+	notificationsSent.WithLabelValues(mr.serviceName, channel, provider, status).Inc()
+	notificationDuration.WithLabelValues(mr.serviceName, channel, provider).Observe(duration.Seconds())
+}
+
+// RecordWebhookDuplicate records a duplicate webhook delivery
+func (mr *MetricsRegistry) RecordWebhookDuplicate(source string) {
+	webhookDuplicates.WithLabelValues(mr.serviceName, source).Inc()
+}
+
+// RecordTaskEnqueued records a background task being enqueued
+func (mr *MetricsRegistry) RecordTaskEnqueued(taskType, status string) {
+	tasksEnqueued.WithLabelValues(mr.serviceName, taskType, status).Inc()
+}
+
+// RecordTaskProcessed records the outcome of running a background task
+func (mr *MetricsRegistry) RecordTaskProcessed(taskType, status string, duration time.Duration) {
+	tasksProcessed.WithLabelValues(mr.serviceName, taskType, status).Inc()
+	taskDuration.WithLabelValues(mr.serviceName, taskType).Observe(duration.Seconds())
+}
+
+// RecordStorageOperation records the outcome of an object storage operation
+func (mr *MetricsRegistry) RecordStorageOperation(backend, operation, status string, duration time.Duration) {
+	storageOperations.WithLabelValues(mr.serviceName, backend, operation, status).Inc()
+	storageOperationDuration.WithLabelValues(mr.serviceName, backend, operation).Observe(duration.Seconds())
+}
+
+// RecordDrainInFlight records how much work of a kind (requests,
+// connections, tasks) is still in flight
+func (mr *MetricsRegistry) RecordDrainInFlight(kind string, count int) {
+	drainInFlight.WithLabelValues(mr.serviceName, kind).Set(float64(count))
+}
+
+// RecordQuotaCheck records the outcome (allowed, exceeded, error) of an
+// organization quota check
+func (mr *MetricsRegistry) RecordQuotaCheck(metric, outcome string) {
+	quotaChecks.WithLabelValues(mr.serviceName, metric, outcome).Inc()
+}
+
+// RecordBruteForce records a code validation attempt outcome (failure,
+// lockout, locked_out, challenge_required, challenge_failed)
+func (mr *MetricsRegistry) RecordBruteForce(outcome string) {
+	bruteForceOutcomes.WithLabelValues(mr.serviceName, outcome).Inc()
+}
+
+// RecordFingerprintRule records a request matched by a fingerprint rule
+func (mr *MetricsRegistry) RecordFingerprintRule(rule, action string) {
+	fingerprintRules.WithLabelValues(mr.serviceName, rule, action).Inc()
+}
+
+// RecordLeadership records this instance gaining (started) or losing
+// (stopped) the leadership of an election
+func (mr *MetricsRegistry) RecordLeadership(election string, leading bool) {
+	transition := "stopped"
+	value := 0.0
+	if leading {
+		transition = "started"
+		value = 1
+	}
+	leaderElectionLeader.WithLabelValues(mr.serviceName, election).Set(value)
+	leaderElectionTransitions.WithLabelValues(mr.serviceName, election, transition).Inc()
+}
+
+// RecordFallbackRead records a read through a fallback cache: fresh from
+// the source, stale from the cache, or unavailable
+func (mr *MetricsRegistry) RecordFallbackRead(cache, result string) {
+	fallbackCacheReads.WithLabelValues(mr.serviceName, cache, result).Inc()
+}
+
+// RecordMetricCardinality records the number of series in a metric family
+func (mr *MetricsRegistry) RecordMetricCardinality(family string, series int) {
+	metricFamilySeries.WithLabelValues(mr.serviceName, family).Set(float64(series))
+}
+
+// RecordLimitedLabel records the distinct values of a label that exceeds
+// its cardinality limit
+func (mr *MetricsRegistry) RecordLimitedLabel(family, label string, values int) {
+	metricLabelValues.WithLabelValues(mr.serviceName, family, label).Set(float64(values))
+}
+
+// TrackLatency makes the metrics middleware record request latencies per
+// route in recorder, reported by GetMetricsSummary
+func (mr *MetricsRegistry) TrackLatency(recorder *LatencyRecorder) {
+	mr.latency.Store(recorder)
+}
+
+// recordLatency adds a request to the latency recorder, if any
+func (mr *MetricsRegistry) recordLatency(method, route string, duration time.Duration) {
+	if recorder := mr.latency.Load(); recorder != nil {
+		recorder.Record(latencyEndpoint(method, route), duration)
+	}
+}
+
 // HTTPHandler returns an HTTP handler for the metrics endpoint
 func (mr *MetricsRegistry) HTTPHandler() http.Handler {
 	return promhttp.Handler()
@@ -358,6 +775,8 @@ func (mr *MetricsRegistry) MetricsMiddleware() func(http.Handler) http.Handler {
 			wrappedWriter := &responseWriter{ResponseWriter: w, statusCode: 200}
 			
 			// Process request
+			ctx, capture := withRouteCapture(r.Context())
+			r = r.WithContext(ctx)
 			next.ServeHTTP(wrappedWriter, r)
 			
 			// Record request end
@@ -366,6 +785,13 @@ func (mr *MetricsRegistry) MetricsMiddleware() func(http.Handler) http.Handler {
 			// Record request metrics
 			duration := time.Since(start)
 			mr.RecordHTTPRequest(r.Method, r.URL.Path, wrappedWriter.statusCode, duration)
+
+			// A ServeMux sets the pattern that matched while routing
+			route := capture.route(r)
+			if route == "" {
+				route = r.URL.Path
+			}
+			mr.recordLatency(r.Method, route, duration)
 		})
 	}
 }
@@ -387,6 +813,12 @@ func (mr *MetricsRegistry) GinMetricsMiddleware() gin.HandlerFunc {
 		// Record request metrics
 		duration := time.Since(start)
 		mr.RecordHTTPRequest(c.Request.Method, c.Request.URL.Path, c.Writer.Status(), duration)
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		mr.recordLatency(c.Request.Method, route, duration)
 	}
 }
 
@@ -405,9 +837,10 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return rw.ResponseWriter.Write(b)
 }
 
-// GetMetricsSummary returns a summary of all metrics
+// GetMetricsSummary returns a summary of all metrics, with per-route
+// latency percentiles when TrackLatency is set
 func (mr *MetricsRegistry) GetMetricsSummary() map[string]interface{} {
-	return map[string]interface{}{
+	summary := map[string]interface{}{
 		"service": mr.serviceName,
 		"metrics": map[string]interface{}{
 			"service_calls": map[string]interface{}{
@@ -445,4 +878,26 @@ func (mr *MetricsRegistry) GetMetricsSummary() map[string]interface{} {
 			},
 		},
 	}
-} 
\ No newline at end of file
+	if recorder := mr.latency.Load(); recorder != nil {
+		summary["latency"] = recorder.Summary()
+	}
+	return summary
+}
+
+// SummaryHandler serves GetMetricsSummary as JSON, for a quick look at the
+// service where Prometheus isn't scraping
+func (mr *MetricsRegistry) SummaryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, body := types.OK(mr.GetMetricsSummary())
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	})
+}
+
+// GinSummaryHandler is the Gin version of SummaryHandler
+func (mr *MetricsRegistry) GinSummaryHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(types.OK(mr.GetMetricsSummary()))
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// missingPermission returns the first required permission not granted by the claims
+func missingPermission(claims *types.JWTClaims, permissions []types.Permission) (types.Permission, bool) {
+	for _, permission := range permissions {
+		if !claims.Can(permission) {
+			return permission, true
+		}
+	}
+	return "", false
+}
+
+// RequirePermission creates middleware that only lets requests through when
+// the authenticated claims grant every given permission, through the user's
+// role or, for service tokens, their scopes
+func RequirePermission(permissions ...types.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := GetJWTClaims(r.Context())
+			if claims == nil {
+				writeAPIResponse(w, http.StatusUnauthorized, types.APIResponse{
+					Success: false,
+					Message: "Authentication required",
+					Error:   "unauthorized",
+				})
+				return
+			}
+
+			if permission, missing := missingPermission(claims, permissions); missing {
+				writeAPIResponse(w, http.StatusForbidden, types.APIResponse{
+					Success: false,
+					Message: fmt.Sprintf("Missing required permission: %s", permission),
+					Error:   "forbidden",
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GinRequirePermission creates permission-checking middleware for Gin framework
+func GinRequirePermission(permissions ...types.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := GetJWTClaims(c.Request.Context())
+		if claims == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, types.APIResponse{
+				Success: false,
+				Message: "Authentication required",
+				Error:   "unauthorized",
+			})
+			return
+		}
+
+		if permission, missing := missingPermission(claims, permissions); missing {
+			c.AbortWithStatusJSON(http.StatusForbidden, types.APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Missing required permission: %s", permission),
+				Error:   "forbidden",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+func TestRequirePermission(t *testing.T) {
+	handler := RequirePermission(types.PermissionValidateCode)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		claims *types.JWTClaims
+		status int
+	}{
+		{"unauthenticated", nil, http.StatusUnauthorized},
+		{"member", &types.JWTClaims{Role: types.RoleMember}, http.StatusForbidden},
+		{"guard", &types.JWTClaims{Role: types.RoleGuard}, http.StatusOK},
+		{"service with scope", &types.JWTClaims{TokenType: types.TokenTypeService, Scopes: []string{"codes:validate"}}, http.StatusOK},
+		{"service without scope", &types.JWTClaims{TokenType: types.TokenTypeService}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/validate", nil)
+			if tt.claims != nil {
+				req = req.WithContext(WithJWTClaims(req.Context(), tt.claims))
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, w.Code)
+			}
+		})
+	}
+}
+
+func TestGinRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if role := c.GetHeader("X-Test-Role"); role != "" {
+			claims := &types.JWTClaims{Role: types.UserRole(role)}
+			c.Request = c.Request.WithContext(WithJWTClaims(c.Request.Context(), claims))
+		}
+		c.Next()
+	})
+	r.POST("/users", GinRequirePermission(types.PermissionInviteUser), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := map[string]int{
+		"":       http.StatusUnauthorized,
+		"guard":  http.StatusForbidden,
+		"member": http.StatusForbidden,
+		"admin":  http.StatusOK,
+	}
+
+	for role, status := range tests {
+		req := httptest.NewRequest("POST", "/users", nil)
+		if role != "" {
+			req.Header.Set("X-Test-Role", role)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != status {
+			t.Errorf("Role %q: expected status %d, got %d", role, status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,474 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/redis/go-redis/v9"
+)
+
+// QuotaStore counts organization usage in quota windows
+type QuotaStore interface {
+	// Consume adds n to the usage of the window containing now, unless that
+	// would exceed the quota, and returns the usage afterwards
+	Consume(ctx context.Context, orgID string, quota types.Quota, n int64, now time.Time) (used int64, allowed bool, err error)
+	// Release gives back n consumed in the window containing now
+	Release(ctx context.Context, orgID string, quota types.Quota, n int64, now time.Time) error
+	// Usage returns the usage of the window containing now
+	Usage(ctx context.Context, orgID string, quota types.Quota, now time.Time) (int64, error)
+}
+
+// quotaKey returns the key an organization's usage of a quota window is
+// counted under. The period is part of the key, so changing a quota's
+// period starts a fresh count.
+func quotaKey(prefix, orgID string, quota types.Quota, now time.Time) (string, time.Time) {
+	start, end := quota.Period.Window(now)
+	return fmt.Sprintf("%s:%s:%s:%s:%d", prefix, orgID, quota.Metric, quota.Period, start.Unix()), end
+}
+
+// consumeScript increments a window's usage only when it stays within the
+// limit. It returns {allowed, used}.
+var consumeScript = redis.NewScript(`
+local used = tonumber(redis.call('GET', KEYS[1]) or '0')
+local n = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+if limit > 0 and used + n > limit then
+	return {0, used}
+end
+used = redis.call('INCRBY', KEYS[1], n)
+redis.call('PEXPIREAT', KEYS[1], ARGV[3])
+return {1, used}
+`)
+
+// releaseScript decrements a window's usage without going below zero or
+// recreating a window that has expired
+var releaseScript = redis.NewScript(`
+local used = tonumber(redis.call('GET', KEYS[1]) or '0')
+if used <= 0 then
+	return 0
+end
+local n = math.min(tonumber(ARGV[1]), used)
+return redis.call('DECRBY', KEYS[1], n)
+`)
+
+// RedisQuotaStore counts usage in Redis, shared by every instance of every
+// service enforcing the quota. Windows expire when they end.
+type RedisQuotaStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisQuotaStore creates a Redis-backed quota store
+func NewRedisQuotaStore(client *redis.Client) *RedisQuotaStore {
+	return &RedisQuotaStore{client: client, prefix: "quota"}
+}
+
+// Consume atomically counts n against the quota
+func (s *RedisQuotaStore) Consume(ctx context.Context, orgID string, quota types.Quota, n int64, now time.Time) (int64, bool, error) {
+	key, end := quotaKey(s.prefix, orgID, quota, now)
+	result, err := consumeScript.Run(ctx, s.client, []string{key}, n, quota.Limit, end.UnixMilli()).Int64Slice()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to count quota usage: %w", err)
+	}
+	return result[1], result[0] == 1, nil
+}
+
+// Release gives back n
+func (s *RedisQuotaStore) Release(ctx context.Context, orgID string, quota types.Quota, n int64, now time.Time) error {
+	key, _ := quotaKey(s.prefix, orgID, quota, now)
+	if err := releaseScript.Run(ctx, s.client, []string{key}, n).Err(); err != nil {
+		return fmt.Errorf("failed to release quota usage: %w", err)
+	}
+	return nil
+}
+
+// Usage reads the current window's usage
+func (s *RedisQuotaStore) Usage(ctx context.Context, orgID string, quota types.Quota, now time.Time) (int64, error) {
+	key, _ := quotaKey(s.prefix, orgID, quota, now)
+	used, err := s.client.Get(ctx, key).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read quota usage: %w", err)
+	}
+	return used, nil
+}
+
+// quotaWindow is one window's usage in a MemoryQuotaStore
+type quotaWindow struct {
+	used int64
+	end  time.Time
+}
+
+// MemoryQuotaStore counts usage in process memory, for tests and single
+// instance deployments
+type MemoryQuotaStore struct {
+	windows   map[string]*quotaWindow
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+// NewMemoryQuotaStore creates an in-memory quota store
+func NewMemoryQuotaStore() *MemoryQuotaStore {
+	return &MemoryQuotaStore{windows: make(map[string]*quotaWindow)}
+}
+
+// window returns the window for key, starting it when it is new or has ended
+func (s *MemoryQuotaStore) window(key string, end, now time.Time) *quotaWindow {
+	s.sweep(now)
+	window, ok := s.windows[key]
+	if !ok || !now.Before(window.end) {
+		window = &quotaWindow{end: end}
+		s.windows[key] = window
+	}
+	return window
+}
+
+// sweep drops windows that have ended, at most once a minute
+func (s *MemoryQuotaStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, window := range s.windows {
+		if !now.Before(window.end) {
+			delete(s.windows, key)
+		}
+	}
+}
+
+// Consume counts n against the quota
+func (s *MemoryQuotaStore) Consume(ctx context.Context, orgID string, quota types.Quota, n int64, now time.Time) (int64, bool, error) {
+	key, end := quotaKey("quota", orgID, quota, now)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	window := s.window(key, end, now)
+	if !quota.Allows(window.used, n) {
+		return window.used, false, nil
+	}
+	window.used += n
+	return window.used, true, nil
+}
+
+// Release gives back n
+func (s *MemoryQuotaStore) Release(ctx context.Context, orgID string, quota types.Quota, n int64, now time.Time) error {
+	key, end := quotaKey("quota", orgID, quota, now)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	window := s.window(key, end, now)
+	window.used = max(0, window.used-n)
+	return nil
+}
+
+// Usage returns the current window's usage
+func (s *MemoryQuotaStore) Usage(ctx context.Context, orgID string, quota types.Quota, now time.Time) (int64, error) {
+	key, end := quotaKey("quota", orgID, quota, now)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.window(key, end, now).used, nil
+}
+
+// QuotaLookup returns an organization's quotas, typically OrgSettings.Quotas
+// from a cache
+type QuotaLookup func(ctx context.Context, orgID string) ([]types.Quota, error)
+
+// QuotaUsageFunc returns an organization's current usage of a metric that
+// isn't windowed, such as its active codes, from the service that owns it
+type QuotaUsageFunc func(ctx context.Context, orgID string) (int64, error)
+
+// QuotaConfig holds the configuration for quota enforcement
+type QuotaConfig struct {
+	// Quotas looks up an organization's quotas. Metrics without a quota
+	// are unlimited.
+	Quotas QuotaLookup `json:"-"`
+
+	// Usage counts metrics that aren't windowed. They are checked but not
+	// consumed, since the count changes when the owning service creates or
+	// removes things.
+	Usage map[types.QuotaMetric]QuotaUsageFunc `json:"-"`
+
+	// OrgID returns the organization a request is counted against; nil
+	// uses the JWT claims. Requests without an organization aren't limited.
+	OrgID func(r *http.Request) string `json:"-"`
+
+	// ExceededStatus is the HTTP status of quota_exceeded responses. Use
+	// 402 Payment Required for limits lifted by upgrading a plan.
+	ExceededStatus int `json:"exceeded_status"`
+
+	Logger  *slog.Logger     `json:"-"` // nil uses slog.Default
+	Metrics *MetricsRegistry `json:"-"` // nil disables metrics
+	Clock   clock.Clock      `json:"-"` // nil uses the system clock
+}
+
+// DefaultQuotaConfig returns a configuration that responds 429 when a quota
+// is exceeded
+func DefaultQuotaConfig() *QuotaConfig {
+	return &QuotaConfig{
+		ExceededStatus: http.StatusTooManyRequests,
+	}
+}
+
+// QuotaEnforcer applies organization quotas so every service enforces
+// billing limits the same way. Store and lookup failures let requests
+// through, like the rate limiter, so a Redis outage doesn't take the API
+// down with it.
+type QuotaEnforcer struct {
+	store  QuotaStore
+	config *QuotaConfig
+	logger *slog.Logger
+	clock  clock.Clock
+}
+
+// NewQuotaEnforcer creates a quota enforcer
+func NewQuotaEnforcer(store QuotaStore, config *QuotaConfig) *QuotaEnforcer {
+	if config == nil {
+		config = DefaultQuotaConfig()
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &QuotaEnforcer{store: store, config: config, logger: logger, clock: clock.OrReal(config.Clock)}
+}
+
+// quota returns the organization's quota for a metric
+func (e *QuotaEnforcer) quota(ctx context.Context, orgID string, metric types.QuotaMetric) (types.Quota, bool, error) {
+	if e.config.Quotas == nil {
+		return types.Quota{}, false, nil
+	}
+	quotas, err := e.config.Quotas(ctx, orgID)
+	if err != nil {
+		return types.Quota{}, false, fmt.Errorf("failed to look up quotas: %w", err)
+	}
+	for _, quota := range quotas {
+		if quota.Metric == metric && !quota.IsUnlimited() {
+			return quota, true, nil
+		}
+	}
+	return types.Quota{}, false, nil
+}
+
+// Consume counts n of a metric against the organization's quota. It
+// returns the quota's status, nil when the metric is unlimited, and a
+// quota_exceeded APIError when n more would exceed it.
+func (e *QuotaEnforcer) Consume(ctx context.Context, orgID string, metric types.QuotaMetric, n int64) (*types.QuotaStatus, error) {
+	quota, ok, err := e.quota(ctx, orgID, metric)
+	if err != nil {
+		e.failOpen(ctx, orgID, metric, err)
+		return nil, nil
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	now := e.clock.Now()
+	var used int64
+	allowed := true
+	if quota.Metric.Windowed() {
+		used, allowed, err = e.store.Consume(ctx, orgID, quota, n, now)
+	} else {
+		used, err = e.usage(ctx, orgID, metric)
+		allowed = quota.Allows(used, n)
+	}
+	if err != nil {
+		e.failOpen(ctx, orgID, metric, err)
+		return nil, nil
+	}
+
+	status := e.status(quota, used, now)
+	if !allowed {
+		e.record(metric, "exceeded")
+		apiErr := types.AsAPIError(quota.Check(used, n))
+		apiErr.Status = e.exceededStatus()
+		return status, apiErr
+	}
+	e.record(metric, "allowed")
+	return status, nil
+}
+
+// Release gives back n of a windowed metric, for work that was counted but
+// didn't happen
+func (e *QuotaEnforcer) Release(ctx context.Context, orgID string, metric types.QuotaMetric, n int64) error {
+	quota, ok, err := e.quota(ctx, orgID, metric)
+	if err != nil || !ok || !quota.Metric.Windowed() {
+		return err
+	}
+	return e.store.Release(ctx, orgID, quota, n, e.clock.Now())
+}
+
+// Status returns the status of every quota the organization has, for
+// usage and billing pages
+func (e *QuotaEnforcer) Status(ctx context.Context, orgID string) ([]types.QuotaStatus, error) {
+	if e.config.Quotas == nil {
+		return nil, nil
+	}
+	quotas, err := e.config.Quotas(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up quotas: %w", err)
+	}
+
+	now := e.clock.Now()
+	statuses := make([]types.QuotaStatus, 0, len(quotas))
+	for _, quota := range quotas {
+		if quota.IsUnlimited() {
+			continue
+		}
+		var used int64
+		if quota.Metric.Windowed() {
+			used, err = e.store.Usage(ctx, orgID, quota, now)
+		} else {
+			used, err = e.usage(ctx, orgID, quota.Metric)
+		}
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, *e.status(quota, used, now))
+	}
+	return statuses, nil
+}
+
+// usage counts a metric that isn't windowed
+func (e *QuotaEnforcer) usage(ctx context.Context, orgID string, metric types.QuotaMetric) (int64, error) {
+	usage, ok := e.config.Usage[metric]
+	if !ok {
+		return 0, fmt.Errorf("no usage function for quota metric %s", metric)
+	}
+	return usage(ctx, orgID)
+}
+
+// status returns a quota's status; metrics that aren't windowed never reset
+func (e *QuotaEnforcer) status(quota types.Quota, used int64, now time.Time) *types.QuotaStatus {
+	status := quota.Status(used, now)
+	if !quota.Metric.Windowed() {
+		status.ResetAt = time.Time{}
+	}
+	return &status
+}
+
+// exceededStatus returns the HTTP status for exceeded quotas
+func (e *QuotaEnforcer) exceededStatus() int {
+	if e.config.ExceededStatus == 0 {
+		return http.StatusTooManyRequests
+	}
+	return e.config.ExceededStatus
+}
+
+// failOpen logs a failed quota check that let the request through
+func (e *QuotaEnforcer) failOpen(ctx context.Context, orgID string, metric types.QuotaMetric, err error) {
+	e.record(metric, "error")
+	e.logger.WarnContext(ctx, "quota check failed, allowing request",
+		"org_id", orgID,
+		"metric", string(metric),
+		"correlation_id", GetCorrelationID(ctx),
+		"error", err.Error(),
+	)
+}
+
+// record records a quota check outcome
+func (e *QuotaEnforcer) record(metric types.QuotaMetric, outcome string) {
+	if e.config.Metrics != nil {
+		e.config.Metrics.RecordQuotaCheck(string(metric), outcome)
+	}
+}
+
+// orgID returns the organization a request is counted against
+func (e *QuotaEnforcer) orgID(r *http.Request) string {
+	if e.config.OrgID != nil {
+		return e.config.OrgID(r)
+	}
+	if claims := GetJWTClaims(r.Context()); claims != nil {
+		return claims.OrgID
+	}
+	return ""
+}
+
+// setQuotaHeaders describes a quota in the response headers
+func (e *QuotaEnforcer) setQuotaHeaders(header http.Header, status *types.QuotaStatus, exceeded bool) {
+	header.Set("X-Quota-Metric", string(status.Metric))
+	header.Set("X-Quota-Limit", strconv.FormatInt(status.Limit, 10))
+	header.Set("X-Quota-Remaining", strconv.FormatInt(status.Remaining, 10))
+	if status.ResetAt.IsZero() {
+		return
+	}
+	header.Set("X-Quota-Reset", strconv.FormatInt(status.ResetAt.Unix(), 10))
+	if exceeded {
+		header.Set("Retry-After", strconv.Itoa(int(math.Ceil(status.ResetAt.Sub(e.clock.Now()).Seconds()))))
+	}
+}
+
+// consumeRequest counts one request of a metric and sets the quota headers.
+// It returns the organization counted against, or an error to respond with.
+func (e *QuotaEnforcer) consumeRequest(r *http.Request, header http.Header, metric types.QuotaMetric) (string, error) {
+	orgID := e.orgID(r)
+	if orgID == "" {
+		return "", nil
+	}
+	status, err := e.Consume(r.Context(), orgID, metric, 1)
+	if status != nil {
+		e.setQuotaHeaders(header, status, err != nil)
+	}
+	return orgID, err
+}
+
+// releaseFailed gives back a request the service failed to handle, so
+// organizations aren't billed for our errors
+func (e *QuotaEnforcer) releaseFailed(r *http.Request, orgID string, metric types.QuotaMetric, statusCode int) {
+	if orgID == "" || statusCode < http.StatusInternalServerError {
+		return
+	}
+	if err := e.Release(r.Context(), orgID, metric, 1); err != nil {
+		e.logger.WarnContext(r.Context(), "failed to release quota usage",
+			"org_id", orgID,
+			"metric", string(metric),
+			"correlation_id", GetCorrelationID(r.Context()),
+			"error", err.Error(),
+		)
+	}
+}
+
+// Middleware counts each request against the organization's quota for
+// metric, rejecting requests over it with quota_exceeded. Requests the
+// service fails with a 5xx aren't counted.
+func (e *QuotaEnforcer) Middleware(metric types.QuotaMetric) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			orgID, err := e.consumeRequest(r, w.Header(), metric)
+			if err != nil {
+				RenderError(w, r, err)
+				return
+			}
+
+			wrappedWriter := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(wrappedWriter, r)
+			e.releaseFailed(r, orgID, metric, wrappedWriter.statusCode)
+		})
+	}
+}
+
+// GinMiddleware is the Gin version of Middleware
+func (e *QuotaEnforcer) GinMiddleware(metric types.QuotaMetric) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, err := e.consumeRequest(c.Request, c.Writer.Header(), metric)
+		if err != nil {
+			GinRenderError(c, err)
+			return
+		}
+
+		c.Next()
+		e.releaseFailed(c.Request, orgID, metric, c.Writer.Status())
+	}
+}
@@ -0,0 +1,240 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/redis/go-redis/v9"
+)
+
+// staticQuotas returns the same quotas for every organization
+func staticQuotas(quotas ...types.Quota) QuotaLookup {
+	return func(ctx context.Context, orgID string) ([]types.Quota, error) {
+		return quotas, nil
+	}
+}
+
+func TestQuotaStores(t *testing.T) {
+	server := miniredis.RunT(t)
+	stores := map[string]QuotaStore{
+		"memory": NewMemoryQuotaStore(),
+		"redis":  NewRedisQuotaStore(redis.NewClient(&redis.Options{Addr: server.Addr()})),
+	}
+	quota := types.Quota{Metric: types.QuotaValidations, Limit: 3, Period: types.QuotaPeriodDay}
+	now := time.Date(2026, 3, 15, 13, 45, 0, 0, time.UTC)
+	server.SetTime(now)
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if used, allowed, err := store.Consume(ctx, "org-1", quota, 2, now); err != nil || !allowed || used != 2 {
+				t.Fatalf("Expected 2 to be consumed, got %d, %v, %v", used, allowed, err)
+			}
+			if used, allowed, _ := store.Consume(ctx, "org-1", quota, 2, now); allowed || used != 2 {
+				t.Errorf("Expected going over the limit to be refused without counting, got %d, %v", used, allowed)
+			}
+			if _, allowed, _ := store.Consume(ctx, "org-2", quota, 3, now); !allowed {
+				t.Errorf("Expected organizations to be counted separately")
+			}
+
+			if err := store.Release(ctx, "org-1", quota, 5, now); err != nil {
+				t.Fatalf("Unexpected release error: %v", err)
+			}
+			if used, _ := store.Usage(ctx, "org-1", quota, now); used != 0 {
+				t.Errorf("Expected usage not to go below zero, got %d", used)
+			}
+
+			store.Consume(ctx, "org-1", quota, 3, now)
+			if used, _ := store.Usage(ctx, "org-1", quota, now.Add(24*time.Hour)); used != 0 {
+				t.Errorf("Expected the next day to start from zero, got %d", used)
+			}
+		})
+	}
+
+	server.FastForward(24 * time.Hour)
+	if keys := server.Keys(); len(keys) != 0 {
+		t.Errorf("Expected Redis windows to expire, have %v", keys)
+	}
+}
+
+func TestMemoryQuotaStoreSweeps(t *testing.T) {
+	store := NewMemoryQuotaStore()
+	quota := types.Quota{Metric: types.QuotaValidations, Limit: 3, Period: types.QuotaPeriodDay}
+	now := time.Date(2026, 3, 15, 23, 59, 30, 0, time.UTC)
+	ctx := context.Background()
+
+	store.Consume(ctx, "org-1", quota, 1, now)
+	store.Consume(ctx, "org-2", quota, 1, now)
+
+	// Ended windows are only swept once a minute, not on every request
+	store.Usage(ctx, "org-3", quota, now.Add(59*time.Second))
+	if len(store.windows) != 3 {
+		t.Errorf("Expected no sweep within a minute, have %d windows", len(store.windows))
+	}
+	store.Usage(ctx, "org-3", quota, now.Add(time.Minute))
+	if len(store.windows) != 1 {
+		t.Errorf("Expected ended windows to be swept, have %d", len(store.windows))
+	}
+}
+
+func TestQuotaEnforcerConsume(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 3, 15, 13, 45, 0, 0, time.UTC))
+	activeCodes := int64(49)
+	enforcer := NewQuotaEnforcer(NewMemoryQuotaStore(), &QuotaConfig{
+		Quotas: staticQuotas(
+			types.Quota{Metric: types.QuotaCodesGenerated, Limit: 10, Period: types.QuotaPeriodDay},
+			types.Quota{Metric: types.QuotaActiveCodes, Limit: 50},
+			types.Quota{Metric: types.QuotaAPIRequests},
+		),
+		Usage: map[types.QuotaMetric]QuotaUsageFunc{
+			types.QuotaActiveCodes: func(ctx context.Context, orgID string) (int64, error) { return activeCodes, nil },
+		},
+		ExceededStatus: http.StatusPaymentRequired,
+		Clock:          fake,
+	})
+	ctx := context.Background()
+
+	status, err := enforcer.Consume(ctx, "org-1", types.QuotaCodesGenerated, 10)
+	if err != nil || status.Remaining != 0 || !status.ResetAt.Equal(time.Date(2026, 3, 16, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Expected the whole quota to be consumed, got %+v, %v", status, err)
+	}
+	_, err = enforcer.Consume(ctx, "org-1", types.QuotaCodesGenerated, 1)
+	var apiErr *types.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != types.ErrCodeQuotaExceeded || apiErr.HTTPStatus() != http.StatusPaymentRequired {
+		t.Errorf("Expected a 402 quota_exceeded error, got %v", err)
+	}
+
+	// Active codes are checked against the owning service's count
+	if status, err := enforcer.Consume(ctx, "org-1", types.QuotaActiveCodes, 1); err != nil || !status.ResetAt.IsZero() {
+		t.Errorf("Expected the 50th code to be allowed without a reset time, got %+v, %v", status, err)
+	}
+	activeCodes = 50
+	if _, err := enforcer.Consume(ctx, "org-1", types.QuotaActiveCodes, 1); err == nil {
+		t.Errorf("Expected the 51st active code to be refused")
+	}
+
+	if status, err := enforcer.Consume(ctx, "org-1", types.QuotaAPIRequests, 1); status != nil || err != nil {
+		t.Errorf("Expected metrics with a zero limit to be unlimited, got %+v, %v", status, err)
+	}
+	if status, err := enforcer.Consume(ctx, "org-1", types.QuotaValidations, 1); status != nil || err != nil {
+		t.Errorf("Expected metrics without a quota to be unlimited, got %+v, %v", status, err)
+	}
+
+	statuses, err := enforcer.Status(ctx, "org-1")
+	if err != nil || len(statuses) != 2 || statuses[0].Used != 10 || statuses[1].Used != 50 {
+		t.Errorf("Unexpected quota statuses %+v, %v", statuses, err)
+	}
+
+	fake.Advance(11 * time.Hour)
+	if _, err := enforcer.Consume(ctx, "org-1", types.QuotaCodesGenerated, 1); err != nil {
+		t.Errorf("Expected the quota to reset at midnight UTC, got %v", err)
+	}
+}
+
+func TestQuotaEnforcerFailsOpen(t *testing.T) {
+	var logs bytes.Buffer
+	enforcer := NewQuotaEnforcer(NewMemoryQuotaStore(), &QuotaConfig{
+		Quotas: func(ctx context.Context, orgID string) ([]types.Quota, error) {
+			return nil, errors.New("settings cache unavailable")
+		},
+		Logger: slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+
+	status, err := enforcer.Consume(context.Background(), "org-1", types.QuotaValidations, 1)
+	if status != nil || err != nil {
+		t.Errorf("Expected lookup failures to allow the request, got %+v, %v", status, err)
+	}
+	if !bytes.Contains(logs.Bytes(), []byte("quota check failed")) {
+		t.Errorf("Expected the failure to be logged, got %s", logs.String())
+	}
+}
+
+func TestQuotaMiddleware(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 3, 15, 23, 59, 0, 0, time.UTC))
+	enforcer := NewQuotaEnforcer(NewMemoryQuotaStore(), &QuotaConfig{
+		Quotas: staticQuotas(types.Quota{Metric: types.QuotaValidations, Limit: 2, Period: types.QuotaPeriodDay}),
+		Clock:  fake,
+	})
+
+	fail := false
+	handler := enforcer.Middleware(types.QuotaValidations)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	serve := func(orgID string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/validate", nil)
+		if orgID != "" {
+			r = r.WithContext(WithJWTClaims(r.Context(), &types.JWTClaims{UserID: "user-1", OrgID: orgID}))
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	recorder := serve("org-1")
+	if recorder.Code != http.StatusOK || recorder.Header().Get("X-Quota-Limit") != "2" || recorder.Header().Get("X-Quota-Remaining") != "1" {
+		t.Errorf("Expected quota headers, got %d %v", recorder.Code, recorder.Header())
+	}
+	if recorder.Header().Get("X-Quota-Reset") != "1773619200" || recorder.Header().Get("X-Quota-Metric") != "validations" {
+		t.Errorf("Expected the reset time at midnight, got %v", recorder.Header())
+	}
+
+	// Server errors aren't counted
+	fail = true
+	serve("org-1")
+	fail = false
+
+	serve("org-1")
+	recorder = serve("org-1")
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected the third validation to be refused until midnight, got %d %v", recorder.Code, recorder.Header())
+	}
+	var body map[string]interface{}
+	json.Unmarshal(recorder.Body.Bytes(), &body)
+	if body["success"] != false || body["error"] != "quota_exceeded" {
+		t.Errorf("Expected an APIError body, got %s", recorder.Body.String())
+	}
+
+	if recorder := serve(""); recorder.Code != http.StatusOK || recorder.Header().Get("X-Quota-Limit") != "" {
+		t.Errorf("Expected requests without an organization not to be limited")
+	}
+}
+
+func TestGinQuotaMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	enforcer := NewQuotaEnforcer(NewMemoryQuotaStore(), &QuotaConfig{
+		Quotas: staticQuotas(types.Quota{Metric: types.QuotaCodesGenerated, Limit: 1, Period: types.QuotaPeriodMonth}),
+		OrgID:  func(r *http.Request) string { return r.Header.Get("X-Org-ID") },
+	})
+
+	router := gin.New()
+	router.POST("/codes", enforcer.GinMiddleware(types.QuotaCodesGenerated), func(c *gin.Context) {
+		c.JSON(http.StatusCreated, types.APIResponse{Success: true})
+	})
+	serve := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/codes", nil)
+		r.Header.Set("X-Org-ID", "org-1")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	if recorder := serve(); recorder.Code != http.StatusCreated {
+		t.Errorf("Expected the first code to be created, got %d", recorder.Code)
+	}
+	if recorder := serve(); recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("X-Quota-Remaining") != "0" {
+		t.Errorf("Expected the second code to be refused, got %d %v", recorder.Code, recorder.Header())
+	}
+}
@@ -0,0 +1,321 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimitConfig holds configuration for rate limiters
+type RateLimitConfig struct {
+	Limit  int           // Requests allowed per window
+	Window time.Duration // Length of the window
+	Burst  int           // Requests allowed at once by the memory limiter; defaults to Limit
+}
+
+// DefaultRateLimitConfig returns default rate limit configuration
+func DefaultRateLimitConfig() *RateLimitConfig {
+	return &RateLimitConfig{
+		Limit:  100,
+		Window: time.Minute,
+	}
+}
+
+// RateLimitResult is the outcome of a rate limit check
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // Until the next request is allowed, when not allowed
+}
+
+// RateLimiter decides whether a request identified by key may proceed
+type RateLimiter interface {
+	Allow(ctx context.Context, key string) (*RateLimitResult, error)
+}
+
+// RateLimitKeyFunc returns the key requests are counted under
+type RateLimitKeyFunc func(r *http.Request) string
+
+// PrincipalOrIPKey counts authenticated requests per principal and other
+// requests per client IP
+func PrincipalOrIPKey(r *http.Request) string {
+	if claims := GetJWTClaims(r.Context()); claims != nil {
+		return string(claims.Principal()) + ":" + claims.PrincipalID()
+	}
+	return "ip:" + clientIP(r)
+}
+
+// clientIP returns the host part of the request's remote address
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// checkRateLimit applies the limiter to a request and sets the rate limit
+// headers. Limiter errors let the request through so a Redis outage doesn't
+// take the API down with it.
+func checkRateLimit(r *http.Request, header http.Header, limiter RateLimiter, keyFunc RateLimitKeyFunc) bool {
+	if keyFunc == nil {
+		keyFunc = PrincipalOrIPKey
+	}
+
+	result, err := limiter.Allow(r.Context(), keyFunc(r))
+	if err != nil {
+		return true
+	}
+
+	// Exempt keys have no limit to report
+	if result.Limit > 0 {
+		header.Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	}
+	if !result.Allowed {
+		header.Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+	}
+	return result.Allowed
+}
+
+// rateLimitError is the response for rate limited requests
+func rateLimitError() *types.APIError {
+	return types.NewAPIError(types.ErrCodeRateLimited, "Too many requests")
+}
+
+// RateLimitMiddleware creates middleware that rejects requests over the
+// limiter's limit with 429 Too Many Requests. A nil keyFunc uses PrincipalOrIPKey.
+func RateLimitMiddleware(limiter RateLimiter, keyFunc RateLimitKeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !checkRateLimit(r, w.Header(), limiter, keyFunc) {
+				RenderError(w, r, rateLimitError())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GinRateLimitMiddleware creates rate limiting middleware for Gin framework
+func GinRateLimitMiddleware(limiter RateLimiter, keyFunc RateLimitKeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkRateLimit(c.Request, c.Writer.Header(), limiter, keyFunc) {
+			GinRenderError(c, rateLimitError())
+			return
+		}
+		c.Next()
+	}
+}
+
+// tokenBucket is the state of one key in the memory limiter
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryRateLimiter is a token bucket limiter for a single instance. Tokens
+// refill at Limit per Window up to Burst.
+type MemoryRateLimiter struct {
+	config    *RateLimitConfig
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+	mutex     sync.Mutex
+}
+
+// NewMemoryRateLimiter creates an in-memory rate limiter
+func NewMemoryRateLimiter(config *RateLimitConfig) *MemoryRateLimiter {
+	if config == nil {
+		config = DefaultRateLimitConfig()
+	}
+	return &MemoryRateLimiter{
+		config:  config,
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// burst returns the bucket capacity
+func (l *MemoryRateLimiter) burst() float64 {
+	if l.config.Burst > 0 {
+		return float64(l.config.Burst)
+	}
+	return float64(l.config.Limit)
+}
+
+// Allow takes a token from the key's bucket if one is available
+func (l *MemoryRateLimiter) Allow(ctx context.Context, key string) (*RateLimitResult, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	rate := float64(l.config.Limit) / l.config.Window.Seconds()
+	burst := l.burst()
+	l.sweep(now, burst/rate)
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, last: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.last).Seconds()*rate)
+	bucket.last = now
+
+	result := &RateLimitResult{Limit: int(burst)}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+	}
+	result.Remaining = int(bucket.tokens)
+	return result, nil
+}
+
+// sweep drops buckets that have refilled completely, at most once per window
+func (l *MemoryRateLimiter) sweep(now time.Time, refillSeconds float64) {
+	if now.Sub(l.lastSweep) < l.config.Window {
+		return
+	}
+	l.lastSweep = now
+
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last).Seconds() >= refillSeconds {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RedisRateLimiter is a fixed window limiter shared by every instance of a service
+type RedisRateLimiter struct {
+	client *redis.Client
+	config *RateLimitConfig
+	prefix string
+}
+
+// NewRedisRateLimiter creates a Redis-backed rate limiter
+func NewRedisRateLimiter(client *redis.Client, config *RateLimitConfig) *RedisRateLimiter {
+	if config == nil {
+		config = DefaultRateLimitConfig()
+	}
+	return &RedisRateLimiter{
+		client: client,
+		config: config,
+		prefix: "ratelimit",
+	}
+}
+
+// Allow counts the request in the key's current window
+func (l *RedisRateLimiter) Allow(ctx context.Context, key string) (*RateLimitResult, error) {
+	now := time.Now()
+	window := now.UnixNano() / int64(l.config.Window)
+	windowEnd := time.Unix(0, (window+1)*int64(l.config.Window))
+	redisKey := fmt.Sprintf("%s:%s:%d", l.prefix, key, window)
+
+	pipe := l.client.TxPipeline()
+	count := pipe.Incr(ctx, redisKey)
+	pipe.PExpireAt(ctx, redisKey, windowEnd)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to count request: %w", err)
+	}
+
+	result := &RateLimitResult{
+		Allowed:   count.Val() <= int64(l.config.Limit),
+		Limit:     l.config.Limit,
+		Remaining: int(math.Max(0, float64(int64(l.config.Limit)-count.Val()))),
+	}
+	if !result.Allowed {
+		result.RetryAfter = windowEnd.Sub(now)
+	}
+	return result, nil
+}
+
+// RateLimitOverride replaces the limit for one key. A zero Limit exempts the key.
+type RateLimitOverride struct {
+	Limit  int           `json:"limit"`
+	Window time.Duration `json:"window"`
+}
+
+// OverrideRateLimiter applies per-key overrides on top of another limiter,
+// e.g. to raise the limit for a partner or exempt an internal caller. Keys
+// with an override are counted in memory, per instance.
+type OverrideRateLimiter struct {
+	base      RateLimiter
+	overrides map[string]RateLimitOverride
+	limiters  map[string]*MemoryRateLimiter
+	mutex     sync.RWMutex
+}
+
+// NewOverrideRateLimiter wraps a limiter with runtime overrides
+func NewOverrideRateLimiter(base RateLimiter) *OverrideRateLimiter {
+	return &OverrideRateLimiter{
+		base:      base,
+		overrides: make(map[string]RateLimitOverride),
+		limiters:  make(map[string]*MemoryRateLimiter),
+	}
+}
+
+// SetOverride sets the override for a key
+func (l *OverrideRateLimiter) SetOverride(key string, override RateLimitOverride) error {
+	if override.Limit < 0 || (override.Limit > 0 && override.Window <= 0) {
+		return fmt.Errorf("invalid rate limit override %d per %s", override.Limit, override.Window)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.overrides[key] = override
+	delete(l.limiters, key)
+	if override.Limit > 0 {
+		l.limiters[key] = NewMemoryRateLimiter(&RateLimitConfig{Limit: override.Limit, Window: override.Window})
+	}
+	return nil
+}
+
+// RemoveOverride returns a key to the base limiter
+func (l *OverrideRateLimiter) RemoveOverride(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.overrides, key)
+	delete(l.limiters, key)
+}
+
+// Overrides returns a copy of the overrides by key
+func (l *OverrideRateLimiter) Overrides() map[string]RateLimitOverride {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	overrides := make(map[string]RateLimitOverride, len(l.overrides))
+	for key, override := range l.overrides {
+		overrides[key] = override
+	}
+	return overrides
+}
+
+// Allow applies the key's override, or the base limiter when it has none
+func (l *OverrideRateLimiter) Allow(ctx context.Context, key string) (*RateLimitResult, error) {
+	l.mutex.RLock()
+	override, ok := l.overrides[key]
+	limiter := l.limiters[key]
+	l.mutex.RUnlock()
+
+	switch {
+	case !ok:
+		return l.base.Allow(ctx, key)
+	case override.Limit == 0:
+		return &RateLimitResult{Allowed: true}, nil
+	default:
+		return limiter.Allow(ctx, key)
+	}
+}
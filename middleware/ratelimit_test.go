@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMemoryRateLimiter(t *testing.T) {
+	limiter := NewMemoryRateLimiter(&RateLimitConfig{Limit: 2, Window: time.Second})
+	now := time.Unix(1700000000, 0)
+	limiter.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if result, _ := limiter.Allow(ctx, "key"); !result.Allowed {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+
+	result, _ := limiter.Allow(ctx, "key")
+	if result.Allowed || result.Remaining != 0 || result.RetryAfter != 500*time.Millisecond {
+		t.Errorf("Expected third request to be limited for 500ms, got %+v", result)
+	}
+
+	if result, _ := limiter.Allow(ctx, "other"); !result.Allowed {
+		t.Errorf("Expected keys to be limited separately")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if result, _ := limiter.Allow(ctx, "key"); !result.Allowed {
+		t.Errorf("Expected a token to refill after 500ms")
+	}
+
+	// Full buckets are swept once a window has passed
+	now = now.Add(10 * time.Second)
+	limiter.Allow(ctx, "key")
+	if len(limiter.buckets) != 1 {
+		t.Errorf("Expected idle buckets to be swept, have %d", len(limiter.buckets))
+	}
+}
+
+func TestRedisRateLimiter(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	limiter := NewRedisRateLimiter(client, &RateLimitConfig{Limit: 2, Window: time.Minute})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if result, err := limiter.Allow(ctx, "key"); err != nil || !result.Allowed {
+			t.Fatalf("Expected request %d to be allowed, got %+v, %v", i+1, result, err)
+		}
+	}
+
+	result, err := limiter.Allow(ctx, "key")
+	if err != nil || result.Allowed || result.Remaining != 0 || result.RetryAfter <= 0 {
+		t.Errorf("Expected third request to be limited, got %+v, %v", result, err)
+	}
+
+	server.Close()
+	if _, err := limiter.Allow(ctx, "key"); err == nil {
+		t.Errorf("Expected an error when Redis is down")
+	}
+}
+
+// failingLimiter always errors
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string) (*RateLimitResult, error) {
+	return nil, errors.New("redis down")
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limiter := NewMemoryRateLimiter(&RateLimitConfig{Limit: 1, Window: time.Minute})
+	handler := RateLimitMiddleware(limiter, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(remoteAddr string, claims *types.JWTClaims) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		if claims != nil {
+			req = req.WithContext(WithJWTClaims(req.Context(), claims))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := request("10.0.0.1:1234", nil); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "1" {
+		t.Errorf("Expected first request to pass with headers, got %d %v", w.Code, w.Header())
+	}
+
+	w := request("10.0.0.1:5678", nil)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected 429 with Retry-After, got %d %v", w.Code, w.Header())
+	}
+
+	// Authenticated requests are counted per principal, not per IP
+	if w := request("10.0.0.1:5678", &types.JWTClaims{UserID: "user-1"}); w.Code != http.StatusOK {
+		t.Errorf("Expected authenticated request to have its own limit, got %d", w.Code)
+	}
+
+	// Limiter errors fail open
+	failOpen := RateLimitMiddleware(failingLimiter{}, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	w = httptest.NewRecorder()
+	failOpen.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected limiter errors to let requests through, got %d", w.Code)
+	}
+}
+
+func TestGinRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(GinRateLimitMiddleware(NewMemoryRateLimiter(&RateLimitConfig{Limit: 1, Window: time.Minute}), nil))
+	r.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	statuses := []int{http.StatusOK, http.StatusTooManyRequests}
+	for _, status := range statuses {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != status {
+			t.Errorf("Expected status %d, got %d", status, w.Code)
+		}
+	}
+}
+
+func TestOverrideRateLimiter(t *testing.T) {
+	base := NewMemoryRateLimiter(&RateLimitConfig{Limit: 1, Window: time.Minute})
+	limiter := NewOverrideRateLimiter(base)
+	ctx := context.Background()
+
+	if err := limiter.SetOverride("user:partner", RateLimitOverride{Limit: 3, Window: time.Minute}); err != nil {
+		t.Fatalf("Failed to set override: %v", err)
+	}
+	if err := limiter.SetOverride("user:internal", RateLimitOverride{}); err != nil {
+		t.Fatalf("Failed to set exemption: %v", err)
+	}
+	if err := limiter.SetOverride("user:bad", RateLimitOverride{Limit: 5}); err == nil {
+		t.Errorf("Expected an override without a window to be rejected")
+	}
+
+	for i := 0; i < 3; i++ {
+		if result, _ := limiter.Allow(ctx, "user:partner"); !result.Allowed || result.Limit != 3 {
+			t.Fatalf("Expected partner request %d to be allowed under the override, got %+v", i+1, result)
+		}
+	}
+	if result, _ := limiter.Allow(ctx, "user:partner"); result.Allowed {
+		t.Errorf("Expected the override limit to apply")
+	}
+
+	for i := 0; i < 5; i++ {
+		if result, _ := limiter.Allow(ctx, "user:internal"); !result.Allowed {
+			t.Fatalf("Expected exempt keys to be allowed")
+		}
+	}
+
+	limiter.Allow(ctx, "user:other")
+	if result, _ := limiter.Allow(ctx, "user:other"); result.Allowed {
+		t.Errorf("Expected keys without an override to use the base limiter")
+	}
+
+	limiter.RemoveOverride("user:internal")
+	limiter.Allow(ctx, "user:internal")
+	if result, _ := limiter.Allow(ctx, "user:internal"); result.Allowed {
+		t.Errorf("Expected a removed override to fall back to the base limiter")
+	}
+	if len(limiter.Overrides()) != 1 {
+		t.Errorf("Expected one override left, got %v", limiter.Overrides())
+	}
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// logPanic logs a recovered panic with the request's correlation fields
+func logPanic(logger *slog.Logger, r *http.Request, recovered interface{}) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.ErrorContext(r.Context(), "panic recovered",
+		"panic", fmt.Sprint(recovered),
+		"method", r.Method,
+		"path", r.URL.Path,
+		"correlation_id", GetCorrelationID(r.Context()),
+		"request_id", GetRequestID(r.Context()),
+		"stack", string(debug.Stack()),
+	)
+}
+
+// correlationCapture receives the correlation context from correlation
+// middleware further in, which recovery, running outside it, can't see in
+// its own request
+type correlationCapture struct {
+	corrCtx *CorrelationContext
+}
+
+// withCorrelationCapture installs a correlation capture in the request
+func withCorrelationCapture(r *http.Request) (*http.Request, *correlationCapture) {
+	capture := &correlationCapture{}
+	return r.WithContext(context.WithValue(r.Context(), "correlation_capture", capture)), capture
+}
+
+// captureCorrelation hands the correlation context to recovery further out
+func captureCorrelation(ctx context.Context, corrCtx *CorrelationContext) {
+	if capture, ok := ctx.Value("correlation_capture").(*correlationCapture); ok {
+		capture.corrCtx = corrCtx
+	}
+}
+
+// request returns r carrying the captured correlation context
+func (c *correlationCapture) request(r *http.Request) *http.Request {
+	if c.corrCtx == nil || GetCorrelationContext(r.Context()) != nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), "correlation_context", c.corrCtx))
+}
+
+// panicError converts a recovered value into the cause of an internal error
+func panicError(recovered interface{}) error {
+	if err, ok := recovered.(error); ok {
+		return fmt.Errorf("panic: %w", err)
+	}
+	return fmt.Errorf("panic: %v", recovered)
+}
+
+// RecoveryMiddleware creates middleware that turns panics into 500 responses
+// and logs them with their stack trace and correlation IDs, also when the
+// correlation middleware runs inside it. A nil logger uses slog.Default.
+// Panics after the response has started are only logged, since an error
+// can't be appended to a partial response. http.ErrAbortHandler is
+// re-raised so net/http can abort the connection.
+func RecoveryMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, capture := withCorrelationCapture(r)
+			tracker := &writeTracker{ResponseWriter: w}
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+					panic(recovered)
+				}
+
+				// Correlation middleware further in sets the IDs on a copy
+				// of the request
+				r := capture.request(r)
+				logPanic(logger, r, recovered)
+				if tracker.written {
+					return
+				}
+				RenderError(w, r, types.NewInternalError(panicError(recovered)))
+			}()
+
+			next.ServeHTTP(tracker, r)
+		})
+	}
+}
+
+// GinRecoveryMiddleware creates panic recovery middleware for Gin framework
+func GinRecoveryMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(recovered)
+			}
+
+			logPanic(logger, c.Request, recovered)
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			GinRenderError(c, types.NewInternalError(panicError(recovered)))
+		}()
+
+		c.Next()
+	}
+}
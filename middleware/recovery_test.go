@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+
+	handler := CorrelationMiddleware()(RecoveryMiddleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("database exploded")
+	})))
+
+	req := httptest.NewRequest("GET", "/codes", nil)
+	req.Header.Set("X-Correlation-ID", "corr-123")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+
+	var apiErr types.APIError
+	if err := json.Unmarshal(w.Body.Bytes(), &apiErr); err != nil {
+		t.Fatalf("Expected JSON body, got error: %v", err)
+	}
+	if strings.Contains(w.Body.String(), "database exploded") {
+		t.Errorf("Expected panic value to stay out of the response, got %s", w.Body.String())
+	}
+
+	if !strings.Contains(logs.String(), "database exploded") || !strings.Contains(logs.String(), "corr-123") {
+		t.Errorf("Expected panic to be logged with the correlation ID, got %s", logs.String())
+	}
+}
+
+func TestRecoveryMiddlewareAfterWrite(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+
+	handler := RecoveryMiddleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"items":[`))
+		panic("stream broke")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/codes", nil))
+
+	if w.Code != http.StatusOK || w.Body.String() != `{"items":[` {
+		t.Errorf("Expected the partial response to be left alone, got %d %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(logs.String(), "stream broke") {
+		t.Errorf("Expected the panic to be logged, got %s", logs.String())
+	}
+}
+
+func TestRecoveryMiddlewareAbortHandler(t *testing.T) {
+	handler := RecoveryMiddleware(slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if recover() != http.ErrAbortHandler {
+			t.Errorf("Expected http.ErrAbortHandler to be re-raised")
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestGinRecoveryMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(GinRecoveryMiddleware(slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))))
+	r.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"internal_error"`) {
+		t.Errorf("Expected internal_error body, got %s", w.Body.String())
+	}
+}
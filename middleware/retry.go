@@ -6,6 +6,8 @@ import (
 	"math"
 	"math/rand"
 	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
 )
 
 // RetryConfig holds the configuration for retry logic
@@ -16,6 +18,7 @@ type RetryConfig struct {
 	BackoffFactor   float64       `json:"backoff_factor"`
 	RetryableErrors []int         `json:"retryable_errors"`
 	Jitter          bool          `json:"jitter"`
+	Clock           clock.Clock   `json:"-"` // Waits between attempts; nil uses the system clock
 }
 
 // DefaultRetryConfig returns a default retry configuration
@@ -105,7 +108,7 @@ func (rc *RetryConfig) Retry(ctx context.Context, fn func() error) error {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-time.After(delay):
+		case <-clock.OrReal(rc.Clock).After(delay):
 		}
 
 		delay = nextDelay
@@ -160,7 +163,7 @@ func (rc *RetryConfig) RetryWithResult(ctx context.Context, fn func() (interface
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
-		case <-time.After(delay):
+		case <-clock.OrReal(rc.Clock).After(delay):
 		}
 
 		delay = nextDelay
@@ -208,7 +211,7 @@ func (rc *RetryConfig) RetryWithBackoff(ctx context.Context, fn func() error, ba
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-time.After(delay):
+		case <-clock.OrReal(rc.Clock).After(delay):
 		}
 	}
 
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"testing"
 	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
 )
 
 func TestDefaultRetryConfig(t *testing.T) {
@@ -327,4 +329,47 @@ func TestRetryJitter(t *testing.T) {
 	if attempts != 2 {
 		t.Errorf("Expected 2 attempts, got %d", attempts)
 	}
-} 
\ No newline at end of file
+} 
+func TestRetryWaitsOnClock(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	config := &RetryConfig{
+		MaxAttempts:     3,
+		InitialDelay:    time.Minute,
+		MaxDelay:        time.Hour,
+		BackoffFactor:   2.0,
+		RetryableErrors: []int{503},
+		Clock:           fake,
+	}
+	
+	attempts := make(chan int, 3)
+	done := make(chan error, 1)
+	count := 0
+	go func() {
+		done <- config.Retry(context.Background(), func() error {
+			count++
+			attempts <- count
+			if count < 3 {
+				return &RetryableError{StatusCode: 503, Message: "Service Unavailable"}
+			}
+			return nil
+		})
+	}()
+	
+	<-attempts
+	fake.BlockUntil(1)
+	fake.Advance(59 * time.Second)
+	if fake.Waiters() != 1 {
+		t.Fatalf("Expected retry to still be waiting before the initial delay")
+	}
+	fake.Advance(time.Second)
+	<-attempts
+	
+	// The second wait is the backed off delay
+	fake.BlockUntil(1)
+	fake.Advance(2 * time.Minute)
+	<-attempts
+	
+	if err := <-done; err != nil {
+		t.Errorf("Expected success on the third attempt, got %v", err)
+	}
+}
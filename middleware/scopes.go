@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// WithJWTClaims stores validated JWT claims in the context, publishes them
+// in the request's container when there is one, and adds the org and role
+// to the request's trace span
+func WithJWTClaims(ctx context.Context, claims *types.JWTClaims) context.Context {
+	if GetContainer(ctx) != nil {
+		Provide(ctx, claims)
+	}
+	annotateSpanWithClaims(ctx, claims)
+	return context.WithValue(ctx, "jwt_claims", claims)
+}
+
+// GetJWTClaims extracts validated JWT claims from context
+func GetJWTClaims(ctx context.Context) *types.JWTClaims {
+	if claims, ok := ctx.Value("jwt_claims").(*types.JWTClaims); ok {
+		return claims
+	}
+	return nil
+}
+
+// missingScope returns the first required scope not granted by the claims
+func missingScope(claims *types.JWTClaims, scopes []string) (string, bool) {
+	for _, scope := range scopes {
+		if !claims.HasScope(scope) {
+			return scope, true
+		}
+	}
+	return "", false
+}
+
+// RequireScope creates middleware that only lets requests through when the
+// authenticated claims grant every given scope
+func RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := GetJWTClaims(r.Context())
+			if claims == nil {
+				writeAPIResponse(w, http.StatusUnauthorized, types.APIResponse{
+					Success: false,
+					Message: "Authentication required",
+					Error:   "unauthorized",
+				})
+				return
+			}
+
+			if scope, missing := missingScope(claims, scopes); missing {
+				writeAPIResponse(w, http.StatusForbidden, types.APIResponse{
+					Success: false,
+					Message: fmt.Sprintf("Missing required scope: %s", scope),
+					Error:   "insufficient_scope",
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GinRequireScope creates scope-checking middleware for Gin framework
+func GinRequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := GetJWTClaims(c.Request.Context())
+		if claims == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, types.APIResponse{
+				Success: false,
+				Message: "Authentication required",
+				Error:   "unauthorized",
+			})
+			return
+		}
+
+		if scope, missing := missingScope(claims, scopes); missing {
+			c.AbortWithStatusJSON(http.StatusForbidden, types.APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Missing required scope: %s", scope),
+				Error:   "insufficient_scope",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// writeAPIResponse writes a JSON API response with the given status code
+func writeAPIResponse(w http.ResponseWriter, status int, response types.APIResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+func TestJWTClaimsContext(t *testing.T) {
+	if GetJWTClaims(context.Background()) != nil {
+		t.Error("Expected nil claims for empty context")
+	}
+
+	claims := &types.JWTClaims{UserID: "user-123"}
+	ctx := WithJWTClaims(context.Background(), claims)
+	if GetJWTClaims(ctx) != claims {
+		t.Error("Expected claims to be retrievable from context")
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	handler := RequireScope("codes:validate")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		claims *types.JWTClaims
+		status int
+	}{
+		{"unauthenticated", nil, http.StatusUnauthorized},
+		{"missing scope", &types.JWTClaims{Scopes: []string{"codes:generate"}}, http.StatusForbidden},
+		{"granted", &types.JWTClaims{Scopes: []string{"codes:generate", "codes:validate"}}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/validate", nil)
+			if tt.claims != nil {
+				req = req.WithContext(WithJWTClaims(req.Context(), tt.claims))
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, w.Code)
+			}
+
+			if tt.status != http.StatusOK {
+				var response types.APIResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+					t.Fatalf("Expected JSON body, got error: %v", err)
+				}
+				if response.Success {
+					t.Error("Expected unsuccessful API response")
+				}
+			}
+		})
+	}
+}
+
+func TestGinRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if c.GetHeader("X-Test-Scopes") != "" {
+			claims := &types.JWTClaims{Scopes: []string{c.GetHeader("X-Test-Scopes")}}
+			c.Request = c.Request.WithContext(WithJWTClaims(c.Request.Context(), claims))
+		}
+		c.Next()
+	})
+	r.GET("/validate", GinRequireScope("codes:validate"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		scope  string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"codes:generate", http.StatusForbidden},
+		{"codes:validate", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/validate", nil)
+		req.Header.Set("X-Test-Scopes", tt.scope)
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("Scope %q: expected status %d, got %d", tt.scope, tt.status, w.Code)
+		}
+	}
+}
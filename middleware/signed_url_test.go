@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stubSignedURLVerifier accepts URLs carrying sig=valid
+type stubSignedURLVerifier struct{}
+
+func (stubSignedURLVerifier) VerifySignedURL(u *url.URL) (map[string]string, error) {
+	if u.Query().Get("sig") != "valid" {
+		return nil, errors.New("invalid signed URL")
+	}
+	return map[string]string{"report_id": u.Query().Get("report_id")}, nil
+}
+
+func TestSignedURLMiddleware(t *testing.T) {
+	var claims map[string]string
+	handler := SignedURLMiddleware(stubSignedURLVerifier{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims = GetSignedURLClaims(r.Context())
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/download?report_id=42&sig=valid", nil))
+	if recorder.Code != http.StatusOK || !reflect.DeepEqual(claims, map[string]string{"report_id": "42"}) {
+		t.Errorf("Expected the claims in the context, got %d %v", recorder.Code, claims)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/download?report_id=42&sig=forged", nil))
+	if recorder.Code != http.StatusForbidden || !strings.Contains(recorder.Body.String(), "invalid or has expired") {
+		t.Errorf("Expected 403 for an invalid link, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	if GetSignedURLClaims(httptest.NewRequest(http.MethodGet, "/", nil).Context()) != nil {
+		t.Errorf("Expected no claims without the middleware")
+	}
+}
+
+func TestGinSignedURLMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/download", GinSignedURLMiddleware(stubSignedURLVerifier{}), func(c *gin.Context) {
+		c.String(http.StatusOK, GetSignedURLClaims(c.Request.Context())["report_id"])
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/download?report_id=7&sig=valid", nil))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "7" {
+		t.Errorf("Expected the download, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/download?report_id=7", nil))
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected unsigned requests to be refused, got %d", recorder.Code)
+	}
+}
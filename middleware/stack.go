@@ -0,0 +1,273 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StackConfig holds configuration for a middleware stack. Each component has
+// an enable flag; enabled components that need a dependency fail NewStack
+// when it is missing rather than being silently left out.
+type StackConfig struct {
+	EnableRecovery    bool
+	EnableCorrelation bool
+	EnableTracing     bool
+	EnableContainer   bool
+	EnableMetrics     bool
+	EnableAuth        bool
+	EnableRateLimit   bool
+	EnableTimeout     bool
+
+	Logger       *slog.Logger     // Recovery logger; nil uses slog.Default
+	Metrics      *MetricsRegistry // Required by metrics
+	Validator    TokenValidator   // Required by auth
+	Cookies      *CookieConfig    // Also accept cookie tokens when set
+	RateLimiter  RateLimiter      // Required by rate limiting
+	RateLimitKey RateLimitKeyFunc // Defaults to PrincipalOrIPKey
+	Timeout      time.Duration    // Required by timeout
+
+	// Layers are added after the built-in ones, e.g. request logging or a
+	// tenant resolver
+	Layers []Layer
+
+	// Order lists every layer by name, outermost first, replacing the
+	// default order; nil keeps the default order
+	Order []string
+
+	// OrderRules are checked against the final order; nil uses
+	// DefaultOrderRules. Add rules placing custom layers.
+	OrderRules []OrderRule
+
+	// OrderMode is what a broken rule does: OrderStrict (the default),
+	// OrderWarn or OrderNormalize
+	OrderMode string
+}
+
+// DefaultStackConfig returns a stack with recovery, correlation and a 30
+// second timeout. Metrics, auth and rate limiting need their dependencies
+// set before they can be enabled.
+func DefaultStackConfig() *StackConfig {
+	return &StackConfig{
+		EnableRecovery:    true,
+		EnableCorrelation: true,
+		EnableTimeout:     true,
+		Timeout:           30 * time.Second,
+	}
+}
+
+// Layer is one named component of a stack in both flavours. Either may be
+// nil for a layer that only exists in one.
+type Layer struct {
+	Name string
+	HTTP func(http.Handler) http.Handler
+	Gin  gin.HandlerFunc
+}
+
+// Stack is a middleware chain composed by default in this order: recovery,
+// correlation, tracing, container, metrics, auth, rate limiting, timeout.
+// Recovery is outermost so it catches panics in every other layer, and
+// correlation hands it the IDs for its logs and responses; correlation comes
+// before tracing, metrics and auth so their spans, logs and errors carry the
+// correlation ID; the request container exists before auth publishes the
+// claims in it; auth comes before rate limiting so limits apply per
+// principal; the timeout covers only the handler. NewStack checks the order
+// against rules, so a custom Order or extra Layers can't quietly break these
+// guarantees.
+type Stack struct {
+	layers []Layer
+}
+
+// NewStack builds a middleware stack from the configuration
+func NewStack(config *StackConfig) (*Stack, error) {
+	if config == nil {
+		config = DefaultStackConfig()
+	}
+
+	stack := &Stack{}
+
+	if config.EnableRecovery {
+		stack.add(LayerRecovery, RecoveryMiddleware(config.Logger), GinRecoveryMiddleware(config.Logger))
+	}
+
+	if config.EnableCorrelation {
+		stack.add(LayerCorrelation, CorrelationMiddleware(), GinCorrelationMiddleware())
+	}
+
+	if config.EnableTracing {
+		stack.add(LayerTracing, TracingMiddleware(), GinTracingMiddleware())
+	}
+
+	if config.EnableContainer {
+		stack.add(LayerContainer, ContainerMiddleware(), GinContainerMiddleware())
+	}
+
+	if config.EnableMetrics {
+		if config.Metrics == nil {
+			return nil, errors.New("middleware stack: metrics enabled without a metrics registry")
+		}
+		stack.add(LayerMetrics, config.Metrics.MetricsMiddleware(), config.Metrics.GinMetricsMiddleware())
+	}
+
+	if config.EnableAuth {
+		if config.Validator == nil {
+			return nil, errors.New("middleware stack: auth enabled without a token validator")
+		}
+		stack.add(LayerAuth, authMiddleware(config.Validator, config.Cookies), ginAuthMiddleware(config.Validator, config.Cookies))
+	}
+
+	if config.EnableRateLimit {
+		if config.RateLimiter == nil {
+			return nil, errors.New("middleware stack: rate limiting enabled without a rate limiter")
+		}
+		stack.add(LayerRateLimit,
+			RateLimitMiddleware(config.RateLimiter, config.RateLimitKey),
+			GinRateLimitMiddleware(config.RateLimiter, config.RateLimitKey))
+	}
+
+	if config.EnableTimeout {
+		if config.Timeout <= 0 {
+			return nil, errors.New("middleware stack: timeout enabled without a duration")
+		}
+		stack.add(LayerTimeout, TimeoutMiddleware(config.Timeout), GinTimeoutMiddleware(config.Timeout))
+	}
+
+	for _, layer := range config.Layers {
+		if layer.Name == "" {
+			return nil, errors.New("middleware stack: layer without a name")
+		}
+		stack.layers = append(stack.layers, layer)
+	}
+
+	if err := stack.order(config); err != nil {
+		return nil, err
+	}
+	return stack, nil
+}
+
+// order applies the configured order and checks it against the rules
+func (s *Stack) order(config *StackConfig) error {
+	if config.Order != nil {
+		if err := s.reorder(config.Order); err != nil {
+			return err
+		}
+	}
+
+	rules := config.OrderRules
+	if rules == nil {
+		rules = DefaultOrderRules()
+	}
+	err := ValidateOrder(s.Names(), rules)
+	if err == nil {
+		return nil
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	switch config.OrderMode {
+	case OrderWarn:
+		logger.Warn("middleware stack is misordered", "error", err.Error())
+		return nil
+	case OrderNormalize:
+		before := s.Names()
+		normalized, normalizeErr := NormalizeOrder(before, rules)
+		if normalizeErr != nil {
+			return normalizeErr
+		}
+		if err := s.reorder(normalized); err != nil {
+			return err
+		}
+		logger.Info("middleware stack reordered", "from", before, "to", normalized, "reason", err.Error())
+		return nil
+	default:
+		return err
+	}
+}
+
+// reorder arranges the layers as named, outermost first. Every layer must
+// be named exactly once.
+func (s *Stack) reorder(names []string) error {
+	if err := ValidateOrder(s.Names(), nil); err != nil {
+		return err
+	}
+	layers := make(map[string]Layer, len(s.layers))
+	for _, layer := range s.layers {
+		layers[layer.Name] = layer
+	}
+
+	ordered := make([]Layer, 0, len(names))
+	for _, name := range names {
+		layer, ok := layers[name]
+		if !ok {
+			return fmt.Errorf("middleware stack: order names %s, which isn't enabled or is listed twice", name)
+		}
+		delete(layers, name)
+		ordered = append(ordered, layer)
+	}
+	if len(layers) > 0 {
+		missing := make([]string, 0, len(layers))
+		for _, layer := range s.layers {
+			if _, ok := layers[layer.Name]; ok {
+				missing = append(missing, layer.Name)
+			}
+		}
+		return fmt.Errorf("middleware stack: order leaves out %s", strings.Join(missing, ", "))
+	}
+	s.layers = ordered
+	return nil
+}
+
+// add appends a layer
+func (s *Stack) add(name string, httpMiddleware func(http.Handler) http.Handler, ginMiddleware gin.HandlerFunc) {
+	s.layers = append(s.layers, Layer{Name: name, HTTP: httpMiddleware, Gin: ginMiddleware})
+}
+
+// Names returns the enabled layers from outermost to innermost
+func (s *Stack) Names() []string {
+	names := make([]string, len(s.layers))
+	for i, layer := range s.layers {
+		names[i] = layer.Name
+	}
+	return names
+}
+
+// Validate checks the stack's order against rules, e.g. in a test that
+// guards a service's hand-written order
+func (s *Stack) Validate(rules []OrderRule) error {
+	return ValidateOrder(s.Names(), rules)
+}
+
+// Handler wraps next in the stack. Tracing and metrics name requests after
+// the ServeMux pattern next matches, see CaptureRoute.
+func (s *Stack) Handler(next http.Handler) http.Handler {
+	next = CaptureRoute(next)
+	for i := len(s.layers) - 1; i >= 0; i-- {
+		if s.layers[i].HTTP != nil {
+			next = s.layers[i].HTTP(next)
+		}
+	}
+	return next
+}
+
+// Middleware returns the stack as net/http middleware
+func (s *Stack) Middleware() func(http.Handler) http.Handler {
+	return s.Handler
+}
+
+// Gin returns the stack as Gin handlers, for router.Use(stack.Gin()...)
+func (s *Stack) Gin() []gin.HandlerFunc {
+	handlers := make([]gin.HandlerFunc, 0, len(s.layers))
+	for _, layer := range s.layers {
+		if layer.Gin != nil {
+			handlers = append(handlers, layer.Gin)
+		}
+	}
+	return handlers
+}
@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Names of the layers NewStack builds
+const (
+	LayerRecovery    = "recovery"
+	LayerCorrelation = "correlation"
+	LayerTracing     = "tracing"
+	LayerContainer   = "container"
+	LayerMetrics     = "metrics"
+	LayerAuth        = "auth"
+	LayerRateLimit   = "rate_limit"
+	LayerTimeout     = "timeout"
+)
+
+// Ordering modes for a stack whose layers break an OrderRule
+const (
+	OrderStrict    = "strict"    // NewStack fails
+	OrderWarn      = "warn"      // NewStack logs a warning and keeps the order
+	OrderNormalize = "normalize" // NewStack moves layers until every rule holds
+)
+
+// OrderRule requires one layer to run outside another when both are in a
+// stack
+type OrderRule struct {
+	Outer  string `json:"outer"`
+	Inner  string `json:"inner"`
+	Reason string `json:"reason"`
+}
+
+// DefaultOrderRules returns the rules behind NewStack's default order
+func DefaultOrderRules() []OrderRule {
+	var rules []OrderRule
+	for _, inner := range []string{LayerCorrelation, LayerTracing, LayerContainer, LayerMetrics, LayerAuth, LayerRateLimit, LayerTimeout} {
+		rules = append(rules, OrderRule{Outer: LayerRecovery, Inner: inner, Reason: "recovery must be outermost to catch panics in every other layer"})
+	}
+	for _, inner := range []string{LayerTracing, LayerMetrics, LayerAuth, LayerRateLimit} {
+		rules = append(rules, OrderRule{Outer: LayerCorrelation, Inner: inner, Reason: "spans, logs and errors need the correlation ID set first"})
+	}
+	rules = append(rules,
+		OrderRule{Outer: LayerContainer, Inner: LayerAuth, Reason: "auth publishes the claims in the request container"},
+		OrderRule{Outer: LayerAuth, Inner: LayerRateLimit, Reason: "limits apply per principal, which auth resolves"},
+	)
+	for _, outer := range []string{LayerMetrics, LayerAuth, LayerRateLimit} {
+		rules = append(rules, OrderRule{Outer: outer, Inner: LayerTimeout, Reason: "the timeout covers only the handler"})
+	}
+	return rules
+}
+
+// OrderViolation is a rule broken by a stack, with the positions of its
+// layers counted from the outermost
+type OrderViolation struct {
+	Rule  OrderRule `json:"rule"`
+	Outer int       `json:"outer"`
+	Inner int       `json:"inner"`
+}
+
+// String describes the violation
+func (v OrderViolation) String() string {
+	return fmt.Sprintf("%s (#%d) must run outside %s (#%d): %s",
+		v.Rule.Outer, v.Outer+1, v.Rule.Inner, v.Inner+1, v.Rule.Reason)
+}
+
+// OrderError lists the problems with a stack's order
+type OrderError struct {
+	Names      []string
+	Duplicates []string
+	Violations []OrderViolation
+}
+
+// Error describes the stack and every problem found
+func (e *OrderError) Error() string {
+	problems := make([]string, 0, len(e.Duplicates)+len(e.Violations))
+	for _, name := range e.Duplicates {
+		problems = append(problems, name+" appears more than once")
+	}
+	for _, violation := range e.Violations {
+		problems = append(problems, violation.String())
+	}
+	return fmt.Sprintf("middleware stack [%s] is misordered: %s",
+		strings.Join(e.Names, " → "), strings.Join(problems, "; "))
+}
+
+// ValidateOrder checks layer names, outermost first, against the rules and
+// returns an *OrderError describing every problem. Rules for layers that
+// aren't in the stack are ignored.
+func ValidateOrder(names []string, rules []OrderRule) error {
+	positions := make(map[string]int, len(names))
+	var duplicates []string
+	for i, name := range names {
+		if _, exists := positions[name]; exists {
+			duplicates = append(duplicates, name)
+			continue
+		}
+		positions[name] = i
+	}
+
+	var violations []OrderViolation
+	for _, rule := range rules {
+		outer, hasOuter := positions[rule.Outer]
+		inner, hasInner := positions[rule.Inner]
+		if hasOuter && hasInner && outer > inner {
+			violations = append(violations, OrderViolation{Rule: rule, Outer: outer, Inner: inner})
+		}
+	}
+
+	if len(duplicates) == 0 && len(violations) == 0 {
+		return nil
+	}
+	return &OrderError{Names: names, Duplicates: duplicates, Violations: violations}
+}
+
+// NormalizeOrder returns the layer names reordered so every rule holds,
+// keeping the original order wherever the rules allow. It fails when names
+// repeat or the rules contradict each other.
+func NormalizeOrder(names []string, rules []OrderRule) ([]string, error) {
+	if err := ValidateOrder(names, nil); err != nil {
+		return nil, err
+	}
+
+	positions := make(map[string]int, len(names))
+	for i, name := range names {
+		positions[name] = i
+	}
+	// outers[i] counts the layers that must come before layer i
+	outers := make([]int, len(names))
+	inners := make([][]int, len(names))
+	for _, rule := range rules {
+		outer, hasOuter := positions[rule.Outer]
+		inner, hasInner := positions[rule.Inner]
+		if hasOuter && hasInner {
+			outers[inner]++
+			inners[outer] = append(inners[outer], inner)
+		}
+	}
+
+	// Repeatedly place the first layer, in the original order, that no
+	// unplaced layer has to wrap
+	normalized := make([]string, 0, len(names))
+	placed := make([]bool, len(names))
+	for len(normalized) < len(names) {
+		next := -1
+		for i := range names {
+			if !placed[i] && outers[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			var remaining []string
+			for i, name := range names {
+				if !placed[i] {
+					remaining = append(remaining, name)
+				}
+			}
+			return nil, fmt.Errorf("middleware stack: order rules contradict each other for %s", strings.Join(remaining, ", "))
+		}
+		placed[next] = true
+		normalized = append(normalized, names[next])
+		for _, inner := range inners[next] {
+			outers[inner]--
+		}
+	}
+	return normalized, nil
+}
@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// namedTestLayer returns a layer that appends its name to a header
+func namedTestLayer(name string) Layer {
+	return Layer{
+		Name: name,
+		HTTP: func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Layers", name)
+				next.ServeHTTP(w, r)
+			})
+		},
+	}
+}
+
+func TestValidateOrder(t *testing.T) {
+	if err := ValidateOrder([]string{"recovery", "correlation", "metrics", "auth", "timeout"}, DefaultOrderRules()); err != nil {
+		t.Errorf("Expected the default order to be valid, got %v", err)
+	}
+
+	err := ValidateOrder([]string{"metrics", "recovery", "auth", "correlation", "auth"}, DefaultOrderRules())
+	var orderErr *OrderError
+	if !errors.As(err, &orderErr) {
+		t.Fatalf("Expected an OrderError, got %v", err)
+	}
+	if !reflect.DeepEqual(orderErr.Duplicates, []string{"auth"}) {
+		t.Errorf("Expected auth to be reported twice, got %v", orderErr.Duplicates)
+	}
+	if len(orderErr.Violations) != 3 {
+		t.Fatalf("Expected recovery/metrics, correlation/metrics and correlation/auth, got %v", orderErr.Violations)
+	}
+
+	message := err.Error()
+	for _, expected := range []string{
+		"[metrics → recovery → auth → correlation → auth]",
+		"auth appears more than once",
+		"recovery (#2) must run outside metrics (#1): recovery must be outermost",
+		"correlation (#4) must run outside auth (#3)",
+	} {
+		if !strings.Contains(message, expected) {
+			t.Errorf("Expected %q in the diagnostic, got: %s", expected, message)
+		}
+	}
+}
+
+func TestNormalizeOrder(t *testing.T) {
+	rules := append(DefaultOrderRules(), OrderRule{Outer: "auth", Inner: "tenant", Reason: "tenants come from claims"})
+
+	normalized, err := NormalizeOrder([]string{"tenant", "metrics", "auth", "recovery", "correlation"}, rules)
+	if err != nil {
+		t.Fatalf("Failed to normalize: %v", err)
+	}
+	expected := []string{"recovery", "correlation", "metrics", "auth", "tenant"}
+	if !reflect.DeepEqual(normalized, expected) {
+		t.Errorf("Expected %v, got %v", expected, normalized)
+	}
+	if err := ValidateOrder(normalized, rules); err != nil {
+		t.Errorf("Expected the normalized order to be valid, got %v", err)
+	}
+
+	// Layers no rule mentions keep their place
+	normalized, _ = NormalizeOrder([]string{"locale", "recovery", "gzip"}, DefaultOrderRules())
+	if !reflect.DeepEqual(normalized, []string{"locale", "recovery", "gzip"}) {
+		t.Errorf("Expected unrelated layers to stay put, got %v", normalized)
+	}
+
+	contradictory := []OrderRule{{Outer: "a", Inner: "b"}, {Outer: "b", Inner: "a"}}
+	if _, err := NormalizeOrder([]string{"a", "b"}, contradictory); err == nil {
+		t.Error("Expected contradicting rules to fail")
+	}
+	if _, err := NormalizeOrder([]string{"a", "a"}, nil); err == nil {
+		t.Error("Expected duplicate layers to fail")
+	}
+}
+
+func TestNewStackOrderStrict(t *testing.T) {
+	config := newTestStackConfig()
+	config.Order = []string{"auth", "recovery", "correlation", "rate_limit", "timeout"}
+
+	_, err := NewStack(config)
+	var orderErr *OrderError
+	if !errors.As(err, &orderErr) {
+		t.Fatalf("Expected an OrderError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "recovery (#2) must run outside auth (#1)") {
+		t.Errorf("Unexpected diagnostic: %v", err)
+	}
+
+	config.Order = []string{"recovery", "correlation", "auth", "timeout"}
+	if _, err := NewStack(config); err == nil || !strings.Contains(err.Error(), "leaves out rate_limit") {
+		t.Errorf("Expected a missing layer to fail, got %v", err)
+	}
+	config.Order = []string{"recovery", "correlation", "auth", "rate_limit", "timeout", "metrics"}
+	if _, err := NewStack(config); err == nil || !strings.Contains(err.Error(), "metrics") {
+		t.Errorf("Expected a disabled layer to fail, got %v", err)
+	}
+}
+
+func TestNewStackOrderWarn(t *testing.T) {
+	var logs bytes.Buffer
+	config := newTestStackConfig()
+	config.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	config.Order = []string{"auth", "recovery", "correlation", "rate_limit", "timeout"}
+	config.OrderMode = OrderWarn
+
+	stack, err := NewStack(config)
+	if err != nil {
+		t.Fatalf("Expected a warning only, got %v", err)
+	}
+	if !reflect.DeepEqual(stack.Names(), config.Order) {
+		t.Errorf("Expected the order to be kept, got %v", stack.Names())
+	}
+	if !strings.Contains(logs.String(), "middleware stack is misordered") {
+		t.Errorf("Expected a warning, got %q", logs.String())
+	}
+	if stack.Validate(DefaultOrderRules()) == nil {
+		t.Error("Expected Validate to report the misordered stack")
+	}
+}
+
+func TestNewStackOrderNormalize(t *testing.T) {
+	var logs bytes.Buffer
+	config := newTestStackConfig()
+	config.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	config.EnableRateLimit = false
+	config.Layers = []Layer{namedTestLayer("tenant"), namedTestLayer("request_log")}
+	config.Order = []string{"tenant", "timeout", "auth", "request_log", "correlation", "recovery"}
+	config.OrderRules = append(DefaultOrderRules(),
+		OrderRule{Outer: "auth", Inner: "tenant", Reason: "tenants come from claims"},
+		OrderRule{Outer: "correlation", Inner: "request_log", Reason: "log lines carry the correlation ID"},
+	)
+	config.OrderMode = OrderNormalize
+
+	stack, err := NewStack(config)
+	if err != nil {
+		t.Fatalf("Failed to build stack: %v", err)
+	}
+	expected := []string{"recovery", "correlation", "auth", "tenant", "timeout", "request_log"}
+	if !reflect.DeepEqual(stack.Names(), expected) {
+		t.Errorf("Expected %v, got %v", expected, stack.Names())
+	}
+	if err := stack.Validate(config.OrderRules); err != nil {
+		t.Errorf("Expected a valid order after normalizing, got %v", err)
+	}
+	if !strings.Contains(logs.String(), "middleware stack reordered") {
+		t.Errorf("Expected the reorder to be logged, got %q", logs.String())
+	}
+
+	// Custom layers without a Gin flavour are left out of Gin chains
+	if len(stack.Gin()) != 4 {
+		t.Errorf("Expected only the built-in Gin handlers, got %d", len(stack.Gin()))
+	}
+	w := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Authorization", "Bearer user-token")
+	stack.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, request)
+	if got := w.Header().Values("X-Layers"); !reflect.DeepEqual(got, []string{"tenant", "request_log"}) {
+		t.Errorf("Expected custom layers to run, got %v", got)
+	}
+}
+
+func TestNewStackRejectsUnnamedLayers(t *testing.T) {
+	if _, err := NewStack(&StackConfig{Layers: []Layer{{}}}); err == nil {
+		t.Error("Expected a layer without a name to fail")
+	}
+}
@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+func newTestStackConfig() *StackConfig {
+	return &StackConfig{
+		EnableRecovery:    true,
+		EnableCorrelation: true,
+		EnableAuth:        true,
+		EnableRateLimit:   true,
+		EnableTimeout:     true,
+		Logger:            slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)),
+		Validator:         newStubValidator(),
+		RateLimiter:       NewMemoryRateLimiter(&RateLimitConfig{Limit: 1, Window: time.Minute}),
+		Timeout:           time.Second,
+	}
+}
+
+func TestNewStackOrder(t *testing.T) {
+	config := newTestStackConfig()
+	config.EnableMetrics = true
+	config.EnableContainer = true
+	config.EnableTracing = true
+	config.Metrics = NewMetricsRegistry("stack-test")
+
+	stack, err := NewStack(config)
+	if err != nil {
+		t.Fatalf("Failed to build stack: %v", err)
+	}
+
+	expected := []string{"recovery", "correlation", "tracing", "container", "metrics", "auth", "rate_limit", "timeout"}
+	if !reflect.DeepEqual(stack.Names(), expected) {
+		t.Errorf("Expected layers %v, got %v", expected, stack.Names())
+	}
+
+	defaults, err := NewStack(nil)
+	if err != nil {
+		t.Fatalf("Failed to build default stack: %v", err)
+	}
+	if !reflect.DeepEqual(defaults.Names(), []string{"recovery", "correlation", "timeout"}) {
+		t.Errorf("Unexpected default layers %v", defaults.Names())
+	}
+}
+
+func TestNewStackMissingDependencies(t *testing.T) {
+	configs := map[string]*StackConfig{
+		"metrics":    {EnableMetrics: true},
+		"auth":       {EnableAuth: true},
+		"rate limit": {EnableRateLimit: true},
+		"timeout":    {EnableTimeout: true},
+	}
+
+	for name, config := range configs {
+		if _, err := NewStack(config); err == nil {
+			t.Errorf("Expected %s without its dependency to fail", name)
+		}
+	}
+}
+
+func TestStackHandler(t *testing.T) {
+	stack, err := NewStack(newTestStackConfig())
+	if err != nil {
+		t.Fatalf("Failed to build stack: %v", err)
+	}
+
+	var correlationID string
+	handler := stack.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		correlationID = GetCorrelationID(r.Context())
+		if r.URL.Path == "/panic" {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(path, token string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if status := request("/", ""); status != http.StatusUnauthorized {
+		t.Errorf("Expected unauthenticated request to be rejected, got %d", status)
+	}
+	if status := request("/", "user-token"); status != http.StatusOK || correlationID == "" {
+		t.Errorf("Expected authenticated request with a correlation ID, got %d %q", status, correlationID)
+	}
+	// The rate limit is per principal, applied after auth
+	if status := request("/", "user-token"); status != http.StatusTooManyRequests {
+		t.Errorf("Expected second request to be rate limited, got %d", status)
+	}
+	if status := request("/panic", "service-token"); status != http.StatusInternalServerError {
+		t.Errorf("Expected panic to be recovered, got %d", status)
+	}
+}
+
+func TestStackGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	stack, err := NewStack(newTestStackConfig())
+	if err != nil {
+		t.Fatalf("Failed to build stack: %v", err)
+	}
+
+	r := gin.New()
+	r.Use(stack.Gin()...)
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, GetCorrelationID(c.Request.Context()))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer user-token")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Errorf("Expected authenticated request with a correlation ID, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestStackPanicCarriesCorrelationIDs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var logs bytes.Buffer
+	config := DefaultStackConfig()
+	config.Logger = slog.New(slog.NewJSONHandler(&logs, nil))
+	stack, err := NewStack(config)
+	if err != nil {
+		t.Fatalf("Failed to build stack: %v", err)
+	}
+
+	router := gin.New()
+	router.Use(stack.Gin()...)
+	router.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	handlers := map[string]http.Handler{
+		"http": stack.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") })),
+		"gin":  router,
+	}
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			logs.Reset()
+			req := httptest.NewRequest("GET", "/panic", nil)
+			req.Header.Set(CorrelationIDHeader, "corr-123")
+			req.Header.Set(RequestIDHeader, "req-456")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			var apiErr types.APIError
+			if err := json.Unmarshal(w.Body.Bytes(), &apiErr); err != nil {
+				t.Fatalf("Expected a JSON error, got %d %q", w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusInternalServerError || apiErr.CorrelationID != "corr-123" {
+				t.Errorf("Expected a 500 carrying the correlation ID, got %d %+v", w.Code, apiErr)
+			}
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+				t.Fatalf("Expected one panic log, got %q", logs.String())
+			}
+			if entry["correlation_id"] != "corr-123" || entry["request_id"] != "req-456" {
+				t.Errorf("Expected the panic log to carry the IDs, got %v %v", entry["correlation_id"], entry["request_id"])
+			}
+		})
+	}
+}
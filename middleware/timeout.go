@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// timeoutError is the response for requests that ran out of time
+func timeoutError() *types.APIError {
+	return types.NewAPIError(types.ErrCodeTimeout, "Request timed out")
+}
+
+// writeTracker records whether a response has been started
+type writeTracker struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *writeTracker) WriteHeader(code int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *writeTracker) Write(b []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *writeTracker) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// TimeoutMiddleware creates middleware that gives each request a deadline.
+// Handlers and the clients they call must honour the request context; when
+// the deadline passes before a handler has written anything, the request is
+// answered with 504 Gateway Timeout.
+func TimeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			tracker := &writeTracker{ResponseWriter: w}
+			next.ServeHTTP(tracker, r.WithContext(ctx))
+
+			if !tracker.written && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				RenderError(w, r.WithContext(ctx), timeoutError())
+			}
+		})
+	}
+}
+
+// GinTimeoutMiddleware creates request deadline middleware for Gin framework
+func GinTimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		if !c.Writer.Written() && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			GinRenderError(c, timeoutError())
+		}
+	}
+}
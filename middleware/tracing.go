@@ -0,0 +1,254 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans this package creates
+const tracerName = "github.com/jarakey/jarakey-shared-middleware/middleware"
+
+// Span attributes for our domain
+const (
+	AttrOrgID         = attribute.Key("jarakey.org_id")
+	AttrUserRole      = attribute.Key("jarakey.user.role")
+	AttrPrincipal     = attribute.Key("jarakey.principal")
+	AttrCodePurpose   = attribute.Key("jarakey.code.purpose")
+	AttrCorrelationID = attribute.Key("jarakey.correlation_id")
+	AttrRequestID     = attribute.Key("jarakey.request_id")
+)
+
+// TracingConfig holds the configuration for exporting traces over OTLP/HTTP
+type TracingConfig struct {
+	ServiceName    string  `json:"service_name"`
+	ServiceVersion string  `json:"service_version"`
+	Environment    string  `json:"environment"`
+	Endpoint       string  `json:"endpoint"` // host:port of the collector; empty uses OTEL_EXPORTER_OTLP_ENDPOINT
+	Insecure       bool    `json:"insecure"` // Plain HTTP, for a collector sidecar
+	SampleRatio    float64 `json:"sample_ratio"`
+}
+
+// DefaultTracingConfig returns a configuration that samples every trace and
+// exports to a local collector
+func DefaultTracingConfig() *TracingConfig {
+	return &TracingConfig{
+		Endpoint:    "localhost:4318",
+		Insecure:    true,
+		SampleRatio: 1.0,
+	}
+}
+
+// NewTracerProvider creates a tracer provider exporting over OTLP/HTTP and
+// installs it, with W3C trace context propagation, as the global provider.
+// Call Shutdown on it when the service stops so buffered spans are flushed.
+func NewTracerProvider(ctx context.Context, config *TracingConfig) (*sdktrace.TracerProvider, error) {
+	if config == nil {
+		config = DefaultTracingConfig()
+	}
+
+	var options []otlptracehttp.Option
+	if config.Endpoint != "" {
+		options = append(options, otlptracehttp.WithEndpoint(config.Endpoint))
+	}
+	if config.Insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(config.ServiceName),
+		semconv.ServiceVersion(config.ServiceVersion),
+		semconv.DeploymentEnvironment(config.Environment),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider, nil
+}
+
+// startRequestSpan continues the caller's trace from the request headers and
+// starts a server span. The span's IDs replace the trace and span IDs of the
+// request's correlation context, so logs and traces can be joined.
+func startRequestSpan(r *http.Request, route string) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(r.Method),
+		semconv.URLPath(r.URL.Path),
+	}
+	if route != "" {
+		attrs = append(attrs, semconv.HTTPRoute(route))
+	}
+	if claims := GetJWTClaims(ctx); claims != nil {
+		attrs = append(attrs, claimAttributes(claims)...)
+	}
+
+	ctx, span := otel.Tracer(tracerName).Start(ctx, spanName(r.Method, route),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attrs...),
+	)
+
+	if corrCtx := GetCorrelationContext(ctx); corrCtx != nil {
+		span.SetAttributes(AttrCorrelationID.String(corrCtx.CorrelationID), AttrRequestID.String(corrCtx.RequestID))
+		if spanContext := span.SpanContext(); spanContext.IsValid() {
+			corrCtx.TraceID = spanContext.TraceID().String()
+			corrCtx.SpanID = spanContext.SpanID().String()
+		}
+	}
+	return ctx, span
+}
+
+// endRequestSpan records the response status and ends the span
+func endRequestSpan(span trace.Span, method, route string, status int) {
+	if route != "" {
+		span.SetName(spanName(method, route))
+		span.SetAttributes(semconv.HTTPRoute(route))
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if status >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
+// spanName names a server span after the route template, never the raw path
+func spanName(method, route string) string {
+	if route == "" {
+		return method
+	}
+	return method + " " + route
+}
+
+// claimAttributes returns the span attributes of an authenticated principal
+func claimAttributes(claims *types.JWTClaims) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{AttrPrincipal.String(string(claims.Principal()))}
+	if claims.OrgID != "" {
+		attrs = append(attrs, AttrOrgID.String(claims.OrgID))
+	}
+	if claims.Role != "" {
+		attrs = append(attrs, AttrUserRole.String(string(claims.Role)))
+	}
+	return attrs
+}
+
+// annotateSpanWithClaims adds the principal's attributes to the request's span
+func annotateSpanWithClaims(ctx context.Context, claims *types.JWTClaims) {
+	if span := trace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(claimAttributes(claims)...)
+	}
+}
+
+// SetCodePurpose records the purpose of the access code a request works on
+// in the request's span
+func SetCodePurpose(ctx context.Context, purpose string) {
+	trace.SpanFromContext(ctx).SetAttributes(AttrCodePurpose.String(purpose))
+}
+
+// patternRoute returns the path of a ServeMux pattern such as "GET /codes/{id}"
+func patternRoute(pattern string) string {
+	if i := strings.IndexAny(pattern, " \t"); i >= 0 {
+		return strings.TrimLeft(pattern[i:], " \t")
+	}
+	return pattern
+}
+
+// routeCapture holds the pattern a ServeMux matched. A ServeMux sets the
+// pattern on the request it is given, which is a copy whenever a layer in
+// between calls WithContext, so outer layers read it from here instead.
+type routeCapture struct {
+	pattern string
+}
+
+// withRouteCapture returns a context carrying a route capture, reusing one
+// installed further out
+func withRouteCapture(ctx context.Context) (context.Context, *routeCapture) {
+	if capture, ok := ctx.Value("route_capture").(*routeCapture); ok {
+		return ctx, capture
+	}
+	capture := &routeCapture{}
+	return context.WithValue(ctx, "route_capture", capture), capture
+}
+
+// route returns the captured pattern, falling back to the request's own
+// for a ServeMux wrapped directly
+func (c *routeCapture) route(r *http.Request) string {
+	if c.pattern != "" {
+		return c.pattern
+	}
+	return r.Pattern
+}
+
+// CaptureRoute wraps a ServeMux so tracing and metrics see the pattern it
+// matched however many layers sit between them. Stack.Handler applies it;
+// wrap the mux with it when composing middleware by hand.
+func CaptureRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if capture, ok := r.Context().Value("route_capture").(*routeCapture); ok && r.Pattern != "" {
+			capture.pattern = r.Pattern
+		}
+	})
+}
+
+// TracingMiddleware creates middleware that traces each request with a
+// server span named after its route. Install it after the correlation
+// middleware; auth annotates the span with the org and role once it runs.
+// Layers between it and the ServeMux need the mux wrapped in CaptureRoute,
+// which Stack does.
+func TracingMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, capture := withRouteCapture(r.Context())
+			ctx, span := startRequestSpan(r.WithContext(ctx), patternRoute(r.Pattern))
+			if spanContext := span.SpanContext(); spanContext.IsValid() {
+				w.Header().Set(TraceIDHeader, spanContext.TraceID().String())
+			}
+
+			rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			r = r.WithContext(ctx)
+			next.ServeHTTP(rw, r)
+
+			endRequestSpan(span, r.Method, patternRoute(capture.route(r)), rw.statusCode)
+		})
+	}
+}
+
+// GinTracingMiddleware creates tracing middleware for Gin framework
+func GinTracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, span := startRequestSpan(c.Request, c.FullPath())
+		if spanContext := span.SpanContext(); spanContext.IsValid() {
+			c.Header(TraceIDHeader, spanContext.TraceID().String())
+		}
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		endRequestSpan(span, c.Request.Method, c.FullPath(), c.Writer.Status())
+	}
+}
@@ -0,0 +1,198 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// useTestTracer records spans for the duration of a test
+func useTestTracer(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return recorder
+}
+
+// spanAttributes returns a span's attributes by key
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	recorder := useTestTracer(t)
+
+	var corrCtx *CorrelationContext
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /codes/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := WithJWTClaims(r.Context(), &types.JWTClaims{UserID: "user-1", OrgID: "org-1", Role: types.RoleAdmin})
+		SetCodePurpose(ctx, "event_entry")
+		corrCtx = GetCorrelationContext(ctx)
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := CorrelationMiddleware()(TracingMiddleware()(mux))
+
+	req := httptest.NewRequest(http.MethodGet, "/codes/123", nil)
+	req.Header.Set(CorrelationIDHeader, "corr-123")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+
+	if span.Name() != "GET /codes/{id}" {
+		t.Errorf("Expected the span to be named after the route, got %q", span.Name())
+	}
+	if span.Parent().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the caller's trace to be continued, got parent %v", span.Parent())
+	}
+
+	attrs := spanAttributes(span)
+	expected := map[attribute.Key]string{
+		AttrOrgID:         "org-1",
+		AttrUserRole:      string(types.RoleAdmin),
+		AttrCodePurpose:   "event_entry",
+		AttrCorrelationID: "corr-123",
+		"http.route":      "/codes/{id}",
+	}
+	for key, value := range expected {
+		if attrs[key].AsString() != value {
+			t.Errorf("Expected %s=%q, got %q", key, value, attrs[key].AsString())
+		}
+	}
+	if attrs["http.response.status_code"].AsInt64() != http.StatusOK {
+		t.Errorf("Expected the status code attribute, got %v", attrs["http.response.status_code"])
+	}
+
+	if corrCtx.TraceID != span.SpanContext().TraceID().String() || corrCtx.SpanID != span.SpanContext().SpanID().String() {
+		t.Errorf("Expected the correlation context to carry the span IDs, got %+v", corrCtx)
+	}
+	if w.Header().Get(TraceIDHeader) != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the trace ID in the response, got %q", w.Header().Get(TraceIDHeader))
+	}
+}
+
+func TestTracingMiddlewareInStack(t *testing.T) {
+	recorder := useTestTracer(t)
+
+	config := newTestStackConfig()
+	config.EnableTracing = true
+	config.EnableContainer = true
+	config.EnableMetrics = true
+	config.Metrics = NewMetricsRegistry("tracing-stack-test")
+	latency := NewLatencyRecorder(nil)
+	config.Metrics.TrackLatency(latency)
+	stack, err := NewStack(config)
+	if err != nil {
+		t.Fatalf("Failed to build stack: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /codes/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/codes/123", nil)
+	req.Header.Set("Authorization", "Bearer user-token")
+	w := httptest.NewRecorder()
+	stack.Handler(mux).ServeHTTP(w, req)
+
+	spans := recorder.Ended()
+	if w.Code != http.StatusOK || len(spans) != 1 {
+		t.Fatalf("Expected 1 span for a successful request, got %d spans and %d", len(spans), w.Code)
+	}
+	// Container, metrics, auth and timeout each hand the mux a copy of the
+	// request, so the route must reach tracing through the capture
+	if spans[0].Name() != "GET /codes/{id}" {
+		t.Errorf("Expected the span to be named after the route, got %q", spans[0].Name())
+	}
+	if summary := latency.Summary(); len(summary) != 1 || summary[0].Endpoint != "GET /codes/{id}" {
+		t.Errorf("Expected latency recorded under the route, got %+v", summary)
+	}
+}
+
+func TestGinTracingMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := useTestTracer(t)
+
+	router := gin.New()
+	router.Use(GinCorrelationMiddleware(), GinTracingMiddleware())
+	router.POST("/codes/:id/validate", func(c *gin.Context) {
+		c.Status(http.StatusInternalServerError)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/codes/123/validate", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Name() != "POST /codes/:id/validate" {
+		t.Errorf("Expected the span to be named after the route, got %q", spans[0].Name())
+	}
+	if spans[0].Status().Code != codes.Error {
+		t.Errorf("Expected 5xx responses to mark the span as failed")
+	}
+}
+
+func TestPropagateCorrelationHeadersInjectsTraceContext(t *testing.T) {
+	useTestTracer(t)
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "outbound")
+	defer span.End()
+
+	req := httptest.NewRequest(http.MethodGet, "http://users-service/users/1", nil)
+	PropagateCorrelationHeaders(req, ctx)
+
+	if req.Header.Get("traceparent") == "" {
+		t.Errorf("Expected a traceparent header")
+	}
+}
+
+func TestTracingMiddlewarePropagatesTraceState(t *testing.T) {
+	useTestTracer(t)
+
+	var outbound *http.Request
+	handler := CorrelationMiddleware()(TracingMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		outbound = httptest.NewRequest(http.MethodGet, "http://users-service/users/1", nil)
+		PropagateCorrelationHeaders(outbound, r.Context())
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/codes/123", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=abc")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	traceparent := outbound.Header.Get("traceparent")
+	if len(traceparent) != 55 || traceparent[3:35] != "4bf92f3577b34da6a3ce929d0e0e4736" || traceparent[36:52] == "00f067aa0ba902b7" {
+		t.Errorf("Expected the outbound call to continue the trace from the server span, got %q", traceparent)
+	}
+	if got := outbound.Header.Get("tracestate"); got != "vendor=abc" {
+		t.Errorf("Expected tracestate to be passed on, got %q", got)
+	}
+}
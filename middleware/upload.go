@@ -0,0 +1,319 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// ErrUploadRejected is returned by an UploadScanner for a file it rejects,
+// e.g. because it carries malware. Other scanner errors answer 503.
+var ErrUploadRejected = errors.New("upload rejected by scanner")
+
+// uploadFormOverhead is how much a multipart body may exceed MaxSize for
+// boundaries, part headers and small fields
+const uploadFormOverhead = 64 << 10
+
+// UploadScanner checks an uploaded file before the handler sees it, e.g.
+// with an antivirus daemon
+type UploadScanner interface {
+	Scan(ctx context.Context, upload *Upload) error
+}
+
+// UploadConfig holds configuration for upload middleware
+type UploadConfig struct {
+	// Field is the multipart form field holding the file
+	Field string `json:"field"`
+
+	// MaxSize is the largest file accepted, in bytes
+	MaxSize int64 `json:"max_size"`
+
+	// AllowedTypes are the media types files may have, judged from their
+	// content, e.g. "image/png" or "image/*". Empty allows any.
+	AllowedTypes []string `json:"allowed_types"`
+
+	// AllowedExtensions are the file name extensions accepted, e.g. ".png".
+	// Empty allows any.
+	AllowedExtensions []string `json:"allowed_extensions"`
+
+	// TempDir holds uploads while the request runs; empty uses os.TempDir
+	TempDir string `json:"temp_dir"`
+
+	Scanner UploadScanner `json:"-"` // nil skips scanning
+	Logger  *slog.Logger  `json:"-"` // nil uses slog.Default
+}
+
+// DefaultUploadConfig returns a configuration for images up to 5 MiB in the
+// "file" field, e.g. organization logos and avatars
+func DefaultUploadConfig() *UploadConfig {
+	return &UploadConfig{
+		Field:             "file",
+		MaxSize:           5 << 20,
+		AllowedTypes:      []string{"image/png", "image/jpeg", "image/gif", "image/webp"},
+		AllowedExtensions: []string{".png", ".jpg", ".jpeg", ".gif", ".webp"},
+	}
+}
+
+// Upload is a validated file, stored in a temporary file that is removed
+// once the handler returns
+type Upload struct {
+	// Filename is the client's file name without any directory
+	Filename string `json:"filename"`
+
+	// ContentType is sniffed from the content, not taken from the client
+	ContentType string `json:"content_type"`
+
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+
+	// File is positioned at the start of the content
+	File *os.File `json:"-"`
+}
+
+// uploader validates and stores uploads
+type uploader struct {
+	config *UploadConfig
+	logger *slog.Logger
+}
+
+// newUploader applies the config defaults
+func newUploader(config *UploadConfig) *uploader {
+	if config == nil {
+		config = DefaultUploadConfig()
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &uploader{config: config, logger: logger}
+}
+
+// receive streams the upload to a temporary file, hashing and checking it
+// on the way. The caller must removeUpload an upload it gets.
+func (u *uploader) receive(w http.ResponseWriter, r *http.Request) (*Upload, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return nil, types.NewAPIError(types.ErrCodeUnsupportedMedia, "Uploads must be sent as multipart/form-data")
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, u.config.MaxSize+uploadFormOverhead)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, types.NewBadRequestError("Malformed multipart body").WithCause(err)
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, types.NewValidationError(types.FieldError{Field: u.config.Field, Code: "required", Message: "A file is required"})
+		}
+		if err != nil {
+			return nil, u.readError(err)
+		}
+		if part.FormName() == u.config.Field && part.FileName() != "" {
+			upload, err := u.store(r.Context(), part)
+			part.Close()
+			return upload, err
+		}
+		part.Close()
+	}
+}
+
+// store checks the file name and content of a part and writes it to a
+// temporary file
+func (u *uploader) store(ctx context.Context, part *multipart.Part) (*Upload, error) {
+	filename := uploadFilename(part.FileName())
+	extension := strings.ToLower(filepath.Ext(filename))
+	if len(u.config.AllowedExtensions) > 0 && !containsFold(u.config.AllowedExtensions, extension) {
+		return nil, u.fieldError("extension", fmt.Sprintf("Files ending in %q are not accepted", extension))
+	}
+
+	// Sniff the content type from the first bytes
+	head := make([]byte, 512)
+	n, err := io.ReadFull(part, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, u.readError(err)
+	}
+	head = head[:n]
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if len(u.config.AllowedTypes) > 0 && !mediaTypeAllowed(contentType, u.config.AllowedTypes) {
+		return nil, types.NewAPIError(types.ErrCodeUnsupportedMedia, fmt.Sprintf("Files of type %s are not accepted", contentType))
+	}
+	if expected, _, _ := mime.ParseMediaType(mime.TypeByExtension(extension)); expected != "" && contentType != "application/octet-stream" && expected != contentType {
+		return nil, u.fieldError("content_mismatch", fmt.Sprintf("The file's content is %s, not what %q suggests", contentType, extension))
+	}
+
+	file, err := os.CreateTemp(u.config.TempDir, "upload-*")
+	if err != nil {
+		return nil, types.NewInternalError(fmt.Errorf("failed to create upload file: %w", err))
+	}
+	upload := &Upload{Filename: filename, ContentType: contentType, File: file}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(io.MultiReader(bytes.NewReader(head), part), u.config.MaxSize+1))
+	switch {
+	case err != nil:
+		removeUpload(upload)
+		return nil, u.readError(err)
+	case size > u.config.MaxSize:
+		removeUpload(upload)
+		return nil, tooLargeError(u.config.MaxSize)
+	}
+	upload.Size = size
+	upload.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if err := u.scan(ctx, upload); err != nil {
+		removeUpload(upload)
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		removeUpload(upload)
+		return nil, types.NewInternalError(fmt.Errorf("failed to rewind upload file: %w", err))
+	}
+	return upload, nil
+}
+
+// scan runs the scanner, if any, over the stored upload
+func (u *uploader) scan(ctx context.Context, upload *Upload) error {
+	if u.config.Scanner == nil {
+		return nil
+	}
+	if _, err := upload.File.Seek(0, io.SeekStart); err != nil {
+		return types.NewInternalError(fmt.Errorf("failed to rewind upload file: %w", err))
+	}
+	err := u.config.Scanner.Scan(ctx, upload)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrUploadRejected):
+		u.logger.WarnContext(ctx, "upload rejected by scanner", "filename", upload.Filename, "sha256", upload.SHA256, "error", err.Error())
+		return u.fieldError("rejected", "The file was rejected")
+	default:
+		return types.NewAPIError(types.ErrCodeServiceUnavailable, "Uploads can't be checked right now").WithCause(err)
+	}
+}
+
+// readError maps an error reading the body to a response
+func (u *uploader) readError(err error) error {
+	var maxBytes *http.MaxBytesError
+	if errors.As(err, &maxBytes) {
+		return tooLargeError(u.config.MaxSize)
+	}
+	return types.NewBadRequestError("Malformed multipart body").WithCause(err)
+}
+
+// fieldError is a validation error on the file field
+func (u *uploader) fieldError(code, message string) error {
+	return types.NewValidationError(types.FieldError{Field: u.config.Field, Code: code, Message: message})
+}
+
+// tooLargeError is the response for files over the size limit
+func tooLargeError(maxSize int64) error {
+	return types.NewAPIError(types.ErrCodePayloadTooLarge, fmt.Sprintf("Files must be at most %d bytes", maxSize))
+}
+
+// uploadFilename strips directories and control characters from a client
+// supplied file name
+func uploadFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// mediaTypeAllowed reports whether a media type matches one of the allowed
+// types, which may end in "/*"
+func mediaTypeAllowed(mediaType string, allowed []string) bool {
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+		if pattern == mediaType {
+			return true
+		}
+		if family, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mediaType, family+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold reports whether values contains s, ignoring case
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeUpload closes and deletes an upload's temporary file
+func removeUpload(upload *Upload) {
+	upload.File.Close()
+	os.Remove(upload.File.Name())
+}
+
+// UploadMiddleware creates middleware that accepts one file from a
+// multipart form, streaming it to a temporary file while checking its size,
+// extension and sniffed content type and hashing it, then runs the
+// scanner. Handlers read the file with GetUpload; it is deleted when they
+// return. Other form fields are ignored.
+func UploadMiddleware(config *UploadConfig) func(http.Handler) http.Handler {
+	u := newUploader(config)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			upload, err := u.receive(w, r)
+			if err != nil {
+				RenderError(w, r, err)
+				return
+			}
+			defer removeUpload(upload)
+			next.ServeHTTP(w, r.WithContext(WithUpload(r.Context(), upload)))
+		})
+	}
+}
+
+// GinUploadMiddleware creates upload middleware for Gin framework
+func GinUploadMiddleware(config *UploadConfig) gin.HandlerFunc {
+	u := newUploader(config)
+	return func(c *gin.Context) {
+		upload, err := u.receive(c.Writer, c.Request)
+		if err != nil {
+			GinRenderError(c, err)
+			return
+		}
+		defer removeUpload(upload)
+		c.Request = c.Request.WithContext(WithUpload(c.Request.Context(), upload))
+		c.Next()
+	}
+}
+
+// WithUpload adds an upload to the context
+func WithUpload(ctx context.Context, upload *Upload) context.Context {
+	return context.WithValue(ctx, "upload", upload)
+}
+
+// GetUpload returns the request's upload, or nil
+func GetUpload(ctx context.Context) *Upload {
+	upload, _ := ctx.Value("upload").(*Upload)
+	return upload
+}
@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// testPNG is the start of a PNG file, enough for content sniffing
+var testPNG = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 600)...)
+
+// newUploadRequest builds a multipart request with a file in field
+func newUploadRequest(t *testing.T, field, filename string, content []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("description", "Organization logo")
+	part, err := writer.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	writer.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/orgs/1/logo", &body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	return r
+}
+
+// scannerFunc adapts a function to UploadScanner
+type scannerFunc func(ctx context.Context, upload *Upload) error
+
+func (f scannerFunc) Scan(ctx context.Context, upload *Upload) error {
+	return f(ctx, upload)
+}
+
+// serveUpload runs a request through upload middleware, returning the
+// response and the upload the handler saw
+func serveUpload(config *UploadConfig, r *http.Request) (*httptest.ResponseRecorder, *Upload, []byte) {
+	var seen *Upload
+	var content []byte
+	handler := UploadMiddleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = GetUpload(r.Context())
+		content, _ = io.ReadAll(seen.File)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w, seen, content
+}
+
+// uploadErrorCode decodes the error code of a response
+func uploadErrorCode(t *testing.T, w *httptest.ResponseRecorder) types.ErrorCode {
+	t.Helper()
+	var apiErr types.APIError
+	if err := json.Unmarshal(w.Body.Bytes(), &apiErr); err != nil {
+		t.Fatalf("Invalid error response %q: %v", w.Body.String(), err)
+	}
+	return apiErr.Code
+}
+
+func TestUploadMiddleware(t *testing.T) {
+	config := DefaultUploadConfig()
+	config.TempDir = t.TempDir()
+
+	w, upload, content := serveUpload(config, newUploadRequest(t, "file", "../../logo.PNG", testPNG))
+	if w.Code != http.StatusOK || upload == nil {
+		t.Fatalf("Expected the upload to reach the handler, got %d %s", w.Code, w.Body.String())
+	}
+	sum := sha256.Sum256(testPNG)
+	if upload.Filename != "logo.PNG" || upload.ContentType != "image/png" || upload.Size != int64(len(testPNG)) || upload.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("Unexpected upload %+v", upload)
+	}
+	if !bytes.Equal(content, testPNG) {
+		t.Error("Expected the handler to read the whole file")
+	}
+	if _, err := os.Stat(upload.File.Name()); !os.IsNotExist(err) {
+		t.Error("Expected the temporary file to be removed after the handler")
+	}
+}
+
+func TestUploadMiddlewareRejects(t *testing.T) {
+	tests := map[string]struct {
+		request func(t *testing.T) *http.Request
+		maxSize int64
+		code    types.ErrorCode
+		status  int
+	}{
+		"not multipart": {
+			request: func(t *testing.T) *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+			},
+			code:   types.ErrCodeUnsupportedMedia,
+			status: http.StatusUnsupportedMediaType,
+		},
+		"missing file": {
+			request: func(t *testing.T) *http.Request { return newUploadRequest(t, "avatar", "logo.png", testPNG) },
+			code:    types.ErrCodeValidationFailed,
+			status:  http.StatusUnprocessableEntity,
+		},
+		"extension": {
+			request: func(t *testing.T) *http.Request { return newUploadRequest(t, "file", "logo.exe", testPNG) },
+			code:    types.ErrCodeValidationFailed,
+			status:  http.StatusUnprocessableEntity,
+		},
+		"content type": {
+			request: func(t *testing.T) *http.Request {
+				return newUploadRequest(t, "file", "logo.png", []byte("<html><script>alert(1)</script></html>"))
+			},
+			code:   types.ErrCodeUnsupportedMedia,
+			status: http.StatusUnsupportedMediaType,
+		},
+		"extension mismatch": {
+			request: func(t *testing.T) *http.Request { return newUploadRequest(t, "file", "logo.jpg", testPNG) },
+			code:    types.ErrCodeValidationFailed,
+			status:  http.StatusUnprocessableEntity,
+		},
+		"too large": {
+			request: func(t *testing.T) *http.Request { return newUploadRequest(t, "file", "logo.png", testPNG) },
+			maxSize: 100,
+			code:    types.ErrCodePayloadTooLarge,
+			status:  http.StatusRequestEntityTooLarge,
+		},
+		"body over the limit": {
+			request: func(t *testing.T) *http.Request {
+				return newUploadRequest(t, "file", "logo.png", append(testPNG, make([]byte, uploadFormOverhead+1000)...))
+			},
+			maxSize: 1000,
+			code:    types.ErrCodePayloadTooLarge,
+			status:  http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := DefaultUploadConfig()
+			config.TempDir = t.TempDir()
+			if test.maxSize > 0 {
+				config.MaxSize = test.maxSize
+			}
+
+			w, upload, _ := serveUpload(config, test.request(t))
+			if upload != nil {
+				t.Fatal("Expected the handler not to run")
+			}
+			if w.Code != test.status || uploadErrorCode(t, w) != test.code {
+				t.Errorf("Expected %d %s, got %d %s", test.status, test.code, w.Code, w.Body.String())
+			}
+			if entries, _ := os.ReadDir(config.TempDir); len(entries) != 0 {
+				t.Errorf("Expected no temporary files left, got %d", len(entries))
+			}
+		})
+	}
+}
+
+func TestUploadMiddlewareScanner(t *testing.T) {
+	config := DefaultUploadConfig()
+	config.TempDir = t.TempDir()
+
+	var scanned []byte
+	config.Scanner = scannerFunc(func(ctx context.Context, upload *Upload) error {
+		scanned, _ = io.ReadAll(upload.File)
+		return nil
+	})
+	w, _, content := serveUpload(config, newUploadRequest(t, "file", "logo.png", testPNG))
+	if w.Code != http.StatusOK || !bytes.Equal(scanned, testPNG) || !bytes.Equal(content, testPNG) {
+		t.Errorf("Expected the scanner and handler to read the whole file, got %d", w.Code)
+	}
+
+	config.Scanner = scannerFunc(func(ctx context.Context, upload *Upload) error {
+		return errors.Join(ErrUploadRejected, errors.New("Eicar-Test-Signature"))
+	})
+	w, _, _ = serveUpload(config, newUploadRequest(t, "file", "logo.png", testPNG))
+	if w.Code != http.StatusUnprocessableEntity || strings.Contains(w.Body.String(), "Eicar") {
+		t.Errorf("Expected a rejection without scanner details, got %d %s", w.Code, w.Body.String())
+	}
+
+	config.Scanner = scannerFunc(func(ctx context.Context, upload *Upload) error {
+		return errors.New("clamd: connection refused")
+	})
+	w, _, _ = serveUpload(config, newUploadRequest(t, "file", "logo.png", testPNG))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected scanner failures to fail closed, got %d", w.Code)
+	}
+}
+
+func TestGinUploadMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := DefaultUploadConfig()
+	config.TempDir = t.TempDir()
+
+	router := gin.New()
+	router.POST("/orgs/:id/logo", GinUploadMiddleware(config), func(c *gin.Context) {
+		c.JSON(types.OK(GetUpload(c.Request.Context())))
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newUploadRequest(t, "file", "logo.png", testPNG))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"content_type":"image/png"`) {
+		t.Errorf("Unexpected response %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, newUploadRequest(t, "file", "logo.gif", testPNG))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected a mismatched extension to be rejected, got %d", w.Code)
+	}
+}
@@ -0,0 +1,391 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/redis/go-redis/v9"
+)
+
+// WebhookDuplicateHeader is set on the 200 answering a duplicate delivery
+const WebhookDuplicateHeader = "X-Webhook-Duplicate"
+
+// DedupeState is the state of a webhook delivery in a DedupeStore
+type DedupeState int
+
+// Delivery states
+const (
+	DedupeClaimed    DedupeState = iota // New, and now in progress for the caller
+	DedupeInProgress                    // Claimed by an attempt that hasn't finished
+	DedupeCompleted                     // Processed and acknowledged
+)
+
+// DedupeStore remembers which webhook deliveries are in progress or done
+type DedupeStore interface {
+	// Claim marks key in progress for ttl unless it is already recorded,
+	// reporting DedupeClaimed when it did and the recorded state otherwise
+	Claim(ctx context.Context, key string, ttl time.Duration) (DedupeState, error)
+	// Complete marks a claimed key as processed for ttl
+	Complete(ctx context.Context, key string, ttl time.Duration) error
+	// Release forgets key so the delivery can be processed again
+	Release(ctx context.Context, key string) error
+}
+
+// WebhookKeyFunc returns the key a delivery is deduplicated on; an empty key
+// isn't deduplicated
+type WebhookKeyFunc func(r *http.Request) string
+
+// WebhookIDKey deduplicates on the webhook ID header, falling back to the
+// signature header for senders that don't set one
+func WebhookIDKey(r *http.Request) string {
+	if id := r.Header.Get(types.WebhookIDHeader); id != "" {
+		return "id:" + id
+	}
+	if signature := r.Header.Get(types.WebhookSignatureHeader); signature != "" {
+		return "sig:" + signature
+	}
+	return ""
+}
+
+// WebhookDedupeConfig holds configuration for webhook deduplication
+type WebhookDedupeConfig struct {
+	Source        string           // Sender name in keys, logs and metrics, e.g. "stripe"
+	Store         DedupeStore      // nil uses a MemoryDedupeStore
+	TTL           time.Duration    // How long a processed delivery is remembered
+	ProcessingTTL time.Duration    // How long an unfinished delivery holds its claim; 0 uses 5 minutes
+	RetryAfter    time.Duration    // Retry-After for retries of an unfinished delivery; 0 uses 30 seconds
+	KeyFunc       WebhookKeyFunc   // nil uses WebhookIDKey
+	Logger        *slog.Logger     // nil uses slog.Default
+	Metrics       *MetricsRegistry // nil disables duplicate metrics
+}
+
+// DefaultWebhookDedupeConfig returns a configuration that remembers
+// deliveries in memory for 24 hours
+func DefaultWebhookDedupeConfig() *WebhookDedupeConfig {
+	return &WebhookDedupeConfig{
+		Source:        "webhook",
+		TTL:           24 * time.Hour,
+		ProcessingTTL: 5 * time.Minute,
+		RetryAfter:    30 * time.Second,
+	}
+}
+
+// webhookDeduper is the state shared by both middleware variants
+type webhookDeduper struct {
+	config        *WebhookDedupeConfig
+	store         DedupeStore
+	keyFunc       WebhookKeyFunc
+	logger        *slog.Logger
+	processingTTL time.Duration
+	retryAfter    time.Duration
+}
+
+func newWebhookDeduper(config *WebhookDedupeConfig) *webhookDeduper {
+	if config == nil {
+		config = DefaultWebhookDedupeConfig()
+	}
+	d := &webhookDeduper{
+		config:        config,
+		store:         config.Store,
+		keyFunc:       config.KeyFunc,
+		logger:        config.Logger,
+		processingTTL: config.ProcessingTTL,
+		retryAfter:    config.RetryAfter,
+	}
+	if d.store == nil {
+		d.store = NewMemoryDedupeStore()
+	}
+	if d.keyFunc == nil {
+		d.keyFunc = WebhookIDKey
+	}
+	if d.logger == nil {
+		d.logger = slog.Default()
+	}
+	if d.processingTTL <= 0 {
+		d.processingTTL = 5 * time.Minute
+	}
+	if d.retryAfter <= 0 {
+		d.retryAfter = 30 * time.Second
+	}
+	return d
+}
+
+// claim returns the store key of a delivery seen for the first time, or the
+// state of one seen before. Store errors let the delivery through so a Redis
+// outage doesn't drop webhooks.
+func (d *webhookDeduper) claim(r *http.Request) (string, DedupeState) {
+	key := d.keyFunc(r)
+	if key == "" {
+		return "", DedupeClaimed
+	}
+	key = d.config.Source + ":" + key
+
+	state, err := d.store.Claim(r.Context(), key, d.processingTTL)
+	if err != nil {
+		d.logger.WarnContext(r.Context(), "webhook dedupe store unavailable",
+			"source", d.config.Source,
+			"error", err.Error(),
+			"correlation_id", GetCorrelationID(r.Context()),
+			"request_id", GetRequestID(r.Context()),
+		)
+		return "", DedupeClaimed
+	}
+	switch state {
+	case DedupeClaimed:
+		return key, state
+	case DedupeInProgress:
+		d.logger.InfoContext(r.Context(), "webhook delivery retried while in progress",
+			"source", d.config.Source,
+			"key", key,
+			"correlation_id", GetCorrelationID(r.Context()),
+			"request_id", GetRequestID(r.Context()),
+		)
+		return "", state
+	}
+
+	d.logger.InfoContext(r.Context(), "duplicate webhook delivery",
+		"source", d.config.Source,
+		"key", key,
+		"correlation_id", GetCorrelationID(r.Context()),
+		"request_id", GetRequestID(r.Context()),
+	)
+	if d.config.Metrics != nil {
+		d.config.Metrics.RecordWebhookDuplicate(d.config.Source)
+	}
+	return "", state
+}
+
+// inProgressError answers a retry of a delivery that is still being
+// processed, so the sender retries again rather than treating it as done
+func (d *webhookDeduper) inProgressError(header http.Header) *types.APIError {
+	header.Set("Retry-After", strconv.Itoa(int(math.Ceil(d.retryAfter.Seconds()))))
+	return types.NewAPIError(types.ErrCodeConflict, "This delivery is still being processed, retry later")
+}
+
+// finish marks a delivery the handler accepted as completed, and releases
+// the claim on one it didn't so the sender's retry is processed rather than
+// acknowledged as a duplicate
+func (d *webhookDeduper) finish(ctx context.Context, key string, status int, completed bool) {
+	if key == "" {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	if completed && status < http.StatusBadRequest {
+		if err := d.store.Complete(ctx, key, d.config.TTL); err != nil {
+			d.logger.WarnContext(ctx, "failed to complete webhook delivery",
+				"source", d.config.Source,
+				"key", key,
+				"error", err.Error(),
+				"correlation_id", GetCorrelationID(ctx),
+				"request_id", GetRequestID(ctx),
+			)
+		}
+		return
+	}
+	if err := d.store.Release(ctx, key); err != nil {
+		d.logger.WarnContext(ctx, "failed to release webhook delivery",
+			"source", d.config.Source,
+			"key", key,
+			"error", err.Error(),
+			"correlation_id", GetCorrelationID(ctx),
+			"request_id", GetRequestID(ctx),
+		)
+	}
+}
+
+// WebhookDedupeMiddleware creates middleware that answers repeated webhook
+// deliveries with 200 OK without calling the handler. A delivery is only
+// remembered as done once the handler accepts it with a 2xx or 3xx status;
+// retries arriving while it is still running get 409 Conflict with
+// Retry-After, so a failing first attempt can't get its retry acknowledged.
+// Place it after signature verification so unsigned requests can't claim IDs.
+func WebhookDedupeMiddleware(config *WebhookDedupeConfig) func(http.Handler) http.Handler {
+	d := newWebhookDeduper(config)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, state := d.claim(r)
+			switch state {
+			case DedupeInProgress:
+				RenderError(w, r, d.inProgressError(w.Header()))
+				return
+			case DedupeCompleted:
+				w.Header().Set(WebhookDuplicateHeader, "true")
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			completed := false
+			defer func() {
+				d.finish(r.Context(), key, wrapped.statusCode, completed)
+			}()
+
+			next.ServeHTTP(wrapped, r)
+			completed = true
+		})
+	}
+}
+
+// GinWebhookDedupeMiddleware creates webhook deduplication middleware for Gin framework
+func GinWebhookDedupeMiddleware(config *WebhookDedupeConfig) gin.HandlerFunc {
+	d := newWebhookDeduper(config)
+
+	return func(c *gin.Context) {
+		key, state := d.claim(c.Request)
+		switch state {
+		case DedupeInProgress:
+			GinRenderError(c, d.inProgressError(c.Writer.Header()))
+			return
+		case DedupeCompleted:
+			c.Header(WebhookDuplicateHeader, "true")
+			c.AbortWithStatus(http.StatusOK)
+			return
+		}
+
+		completed := false
+		defer func() {
+			d.finish(c.Request.Context(), key, c.Writer.Status(), completed)
+		}()
+
+		c.Next()
+		completed = true
+	}
+}
+
+// dedupeEntry is a delivery recorded in a MemoryDedupeStore
+type dedupeEntry struct {
+	expires   time.Time
+	completed bool
+}
+
+// MemoryDedupeStore is a dedupe store for a single instance
+type MemoryDedupeStore struct {
+	entries   map[string]dedupeEntry
+	lastSweep time.Time
+	now       func() time.Time
+	mutex     sync.Mutex
+}
+
+// NewMemoryDedupeStore creates an in-memory dedupe store
+func NewMemoryDedupeStore() *MemoryDedupeStore {
+	return &MemoryDedupeStore{
+		entries: make(map[string]dedupeEntry),
+		now:     time.Now,
+	}
+}
+
+// Claim records key as in progress unless an unexpired entry exists
+func (s *MemoryDedupeStore) Claim(ctx context.Context, key string, ttl time.Duration) (DedupeState, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	if entry, ok := s.entries[key]; ok && now.Before(entry.expires) {
+		if entry.completed {
+			return DedupeCompleted, nil
+		}
+		return DedupeInProgress, nil
+	}
+	s.entries[key] = dedupeEntry{expires: now.Add(ttl)}
+	return DedupeClaimed, nil
+}
+
+// Complete records key as processed
+func (s *MemoryDedupeStore) Complete(ctx context.Context, key string, ttl time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.entries[key] = dedupeEntry{expires: s.now().Add(ttl), completed: true}
+	return nil
+}
+
+// Release removes the entry for key
+func (s *MemoryDedupeStore) Release(ctx context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep drops expired entries, at most once a minute
+func (s *MemoryDedupeStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, entry := range s.entries {
+		if !now.Before(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// RedisDedupeStore is a dedupe store shared by every instance of a service
+type RedisDedupeStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisDedupeStore creates a Redis-backed dedupe store
+func NewRedisDedupeStore(client *redis.Client) *RedisDedupeStore {
+	return &RedisDedupeStore{
+		client: client,
+		prefix: "webhook:dedupe",
+	}
+}
+
+// Values of a delivery's key in Redis
+const (
+	redisDedupeProcessing = "processing"
+	redisDedupeCompleted  = "completed"
+)
+
+// Claim sets key to processing if it isn't already set
+func (s *RedisDedupeStore) Claim(ctx context.Context, key string, ttl time.Duration) (DedupeState, error) {
+	claimed, err := s.client.SetNX(ctx, s.prefix+":"+key, redisDedupeProcessing, ttl).Result()
+	if err != nil {
+		return DedupeClaimed, fmt.Errorf("failed to claim webhook delivery: %w", err)
+	}
+	if claimed {
+		return DedupeClaimed, nil
+	}
+
+	// A key that expired since SETNX is treated as in progress; the retry
+	// after it claims the delivery
+	value, err := s.client.Get(ctx, s.prefix+":"+key).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return DedupeClaimed, fmt.Errorf("failed to read webhook delivery: %w", err)
+	}
+	if value == redisDedupeCompleted {
+		return DedupeCompleted, nil
+	}
+	return DedupeInProgress, nil
+}
+
+// Complete sets key to completed
+func (s *RedisDedupeStore) Complete(ctx context.Context, key string, ttl time.Duration) error {
+	if err := s.client.Set(ctx, s.prefix+":"+key, redisDedupeCompleted, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to complete webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// Release deletes key
+func (s *RedisDedupeStore) Release(ctx context.Context, key string) error {
+	if err := s.client.Del(ctx, s.prefix+":"+key).Err(); err != nil {
+		return fmt.Errorf("failed to release webhook delivery: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+)
+
+// failingDedupeStore is a store whose backend is down
+type failingDedupeStore struct{}
+
+func (failingDedupeStore) Claim(ctx context.Context, key string, ttl time.Duration) (DedupeState, error) {
+	return DedupeClaimed, errors.New("connection refused")
+}
+
+func (failingDedupeStore) Complete(ctx context.Context, key string, ttl time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func (failingDedupeStore) Release(ctx context.Context, key string) error {
+	return errors.New("connection refused")
+}
+
+func webhookRequest(id string) *http.Request {
+	req := httptest.NewRequest("POST", "/webhooks", nil)
+	if id != "" {
+		req.Header.Set(types.WebhookIDHeader, id)
+	}
+	return req
+}
+
+func TestWebhookDedupeMiddleware(t *testing.T) {
+	registry := NewMetricsRegistry("dedupe-test")
+	calls := 0
+	status := http.StatusNoContent
+	handler := WebhookDedupeMiddleware(&WebhookDedupeConfig{
+		Source:  "partner",
+		TTL:     time.Hour,
+		Metrics: registry,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, webhookRequest("evt_1"))
+	if w.Code != http.StatusNoContent || calls != 1 {
+		t.Fatalf("Expected first delivery to reach the handler, got %d after %d calls", w.Code, calls)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, webhookRequest("evt_1"))
+	if w.Code != http.StatusOK || calls != 1 {
+		t.Errorf("Expected duplicate to be answered with 200, got %d after %d calls", w.Code, calls)
+	}
+	if w.Header().Get(WebhookDuplicateHeader) != "true" {
+		t.Errorf("Expected duplicate header to be set")
+	}
+	if got := testutil.ToFloat64(webhookDuplicates.WithLabelValues("dedupe-test", "partner")); got != 1 {
+		t.Errorf("Expected 1 duplicate recorded, got %f", got)
+	}
+
+	// Requests without an ID or signature are not deduplicated
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), webhookRequest(""))
+	}
+	if calls != 3 {
+		t.Errorf("Expected deliveries without a key to reach the handler, got %d calls", calls)
+	}
+}
+
+func TestWebhookDedupeMiddlewareReleasesFailedDeliveries(t *testing.T) {
+	calls := 0
+	handler := WebhookDedupeMiddleware(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), webhookRequest("evt_1"))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, webhookRequest("evt_1"))
+	if calls != 2 || w.Code != http.StatusOK || w.Header().Get(WebhookDuplicateHeader) != "" {
+		t.Errorf("Expected retry of a failed delivery to be processed, got %d calls", calls)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, webhookRequest("evt_1"))
+	if calls != 2 || w.Header().Get(WebhookDuplicateHeader) != "true" {
+		t.Errorf("Expected accepted delivery to be remembered, got %d calls", calls)
+	}
+}
+
+func TestWebhookDedupeMiddlewareReleasesOnPanic(t *testing.T) {
+	store := NewMemoryDedupeStore()
+	handler := WebhookDedupeMiddleware(&WebhookDedupeConfig{Store: store, TTL: time.Hour})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	func() {
+		defer func() { recover() }()
+		handler.ServeHTTP(httptest.NewRecorder(), webhookRequest("evt_1"))
+	}()
+
+	if len(store.entries) != 0 {
+		t.Errorf("Expected panicking delivery to be released, have %d claims", len(store.entries))
+	}
+}
+
+func TestWebhookDedupeMiddlewareRetryWhileInProgress(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	calls := 0
+	handler := WebhookDedupeMiddleware(&WebhookDedupeConfig{TTL: time.Hour, RetryAfter: 10 * time.Second})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			close(started)
+			<-release
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+
+	first := make(chan struct{})
+	go func() {
+		defer close(first)
+		handler.ServeHTTP(httptest.NewRecorder(), webhookRequest("evt_1"))
+	}()
+	<-started
+
+	// The retry must not be acknowledged while the first attempt may still fail
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, webhookRequest("evt_1"))
+	if w.Code != http.StatusConflict || w.Header().Get("Retry-After") != "10" || w.Header().Get(WebhookDuplicateHeader) != "" {
+		t.Errorf("Expected 409 with Retry-After while in progress, got %d %v", w.Code, w.Header())
+	}
+
+	close(release)
+	<-first
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, webhookRequest("evt_1"))
+	if calls != 2 || w.Code != http.StatusOK || w.Header().Get(WebhookDuplicateHeader) != "" {
+		t.Errorf("Expected the retry after the failed attempt to be processed, got %d after %d calls", w.Code, calls)
+	}
+}
+
+func TestWebhookDedupeMiddlewareFailsOpen(t *testing.T) {
+	calls := 0
+	handler := WebhookDedupeMiddleware(&WebhookDedupeConfig{Store: failingDedupeStore{}, TTL: time.Hour})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), webhookRequest("evt_1"))
+	}
+	if calls != 2 {
+		t.Errorf("Expected store errors to let deliveries through, got %d calls", calls)
+	}
+}
+
+func TestGinWebhookDedupeMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	calls := 0
+	router := gin.New()
+	router.Use(GinWebhookDedupeMiddleware(nil))
+	router.POST("/webhooks", func(c *gin.Context) {
+		calls++
+		if c.GetHeader(types.WebhookIDHeader) == "evt_bad" {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.Status(http.StatusAccepted)
+	})
+
+	for i := 0; i < 2; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), webhookRequest("evt_bad"))
+	}
+	if calls != 2 {
+		t.Errorf("Expected rejected deliveries to be released, got %d calls", calls)
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), webhookRequest("evt_1"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, webhookRequest("evt_1"))
+	if calls != 3 || w.Code != http.StatusOK || w.Header().Get(WebhookDuplicateHeader) != "true" {
+		t.Errorf("Expected duplicate to be answered with 200, got %d after %d calls", w.Code, calls)
+	}
+}
+
+func TestWebhookIDKey(t *testing.T) {
+	req := webhookRequest("")
+	req.Header.Set(types.WebhookSignatureHeader, "t=1,v1=abc")
+	if key := WebhookIDKey(req); key != "sig:t=1,v1=abc" {
+		t.Errorf("Expected signature key without an ID, got %q", key)
+	}
+
+	req.Header.Set(types.WebhookIDHeader, "evt_1")
+	if key := WebhookIDKey(req); key != "id:evt_1" {
+		t.Errorf("Expected ID key, got %q", key)
+	}
+}
+
+func TestMemoryDedupeStore(t *testing.T) {
+	store := NewMemoryDedupeStore()
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if state, _ := store.Claim(ctx, "key", time.Minute); state != DedupeClaimed {
+		t.Fatalf("Expected first claim to succeed")
+	}
+	if state, _ := store.Claim(ctx, "key", time.Minute); state != DedupeInProgress {
+		t.Errorf("Expected second claim to find the delivery in progress, got %d", state)
+	}
+
+	now = now.Add(time.Minute)
+	if state, _ := store.Claim(ctx, "key", time.Minute); state != DedupeClaimed {
+		t.Errorf("Expected claim to succeed after the TTL")
+	}
+
+	store.Complete(ctx, "key", time.Hour)
+	if state, _ := store.Claim(ctx, "key", time.Minute); state != DedupeCompleted {
+		t.Errorf("Expected claim to find the delivery completed, got %d", state)
+	}
+
+	store.Release(ctx, "key")
+	if state, _ := store.Claim(ctx, "key", time.Minute); state != DedupeClaimed {
+		t.Errorf("Expected claim to succeed after release")
+	}
+
+	// Expired claims are swept
+	now = now.Add(time.Hour)
+	store.Claim(ctx, "other", time.Minute)
+	if len(store.entries) != 1 {
+		t.Errorf("Expected expired claims to be swept, have %d", len(store.entries))
+	}
+}
+
+func TestRedisDedupeStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := NewRedisDedupeStore(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	ctx := context.Background()
+
+	if state, err := store.Claim(ctx, "key", time.Minute); err != nil || state != DedupeClaimed {
+		t.Fatalf("Expected first claim to succeed, got %v, %v", state, err)
+	}
+	if state, _ := store.Claim(ctx, "key", time.Minute); state != DedupeInProgress {
+		t.Errorf("Expected second claim to find the delivery in progress, got %d", state)
+	}
+	if ttl := server.TTL("webhook:dedupe:key"); ttl != time.Minute {
+		t.Errorf("Expected claim to expire in a minute, got %s", ttl)
+	}
+
+	server.FastForward(time.Minute)
+	if state, _ := store.Claim(ctx, "key", time.Minute); state != DedupeClaimed {
+		t.Errorf("Expected claim to succeed after the TTL")
+	}
+
+	if err := store.Complete(ctx, "key", time.Hour); err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if state, _ := store.Claim(ctx, "key", time.Minute); state != DedupeCompleted {
+		t.Errorf("Expected claim to find the delivery completed, got %d", state)
+	}
+	if ttl := server.TTL("webhook:dedupe:key"); ttl != time.Hour {
+		t.Errorf("Expected completed delivery to be remembered for the TTL, got %s", ttl)
+	}
+
+	if err := store.Release(ctx, "key"); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if server.Exists("webhook:dedupe:key") {
+		t.Errorf("Expected release to delete the key")
+	}
+}
@@ -0,0 +1,217 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/internal/awsv4"
+)
+
+// SESConfig holds the configuration for sending email with Amazon SES
+type SESConfig struct {
+	Region           string        `json:"region"`
+	Endpoint         string        `json:"endpoint"` // Defaults to https://email.<region>.amazonaws.com
+	From             string        `json:"from"`     // A verified identity, optionally "Name <address>"
+	ConfigurationSet string        `json:"configuration_set,omitempty"`
+	AccessKeyID      string        `json:"access_key_id"`
+	SecretAccessKey  string        `json:"-"`
+	SessionToken     string        `json:"-"`
+	Timeout          time.Duration `json:"timeout"`
+}
+
+// DefaultSESConfig returns an SES configuration with credentials and region
+// read from the standard AWS environment variables
+func DefaultSESConfig() *SESConfig {
+	credentials := awsv4.CredentialsFromEnv()
+	return &SESConfig{
+		Region:          awsv4.RegionFromEnv(),
+		AccessKeyID:     credentials.AccessKeyID,
+		SecretAccessKey: credentials.SecretAccessKey,
+		SessionToken:    credentials.SessionToken,
+		Timeout:         10 * time.Second,
+	}
+}
+
+// SESProvider sends email through the SES v2 API
+type SESProvider struct {
+	config     *SESConfig
+	signer     awsv4.Signer
+	endpoint   string
+	httpClient *http.Client
+}
+
+// NewSESProvider creates an SES email provider
+func NewSESProvider(config *SESConfig) (*SESProvider, error) {
+	if config == nil {
+		config = DefaultSESConfig()
+	}
+	if config.Region == "" || config.From == "" {
+		return nil, errors.New("SES region and sender are required")
+	}
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://email.%s.amazonaws.com", config.Region)
+	}
+
+	return &SESProvider{
+		config: config,
+		signer: awsv4.Signer{
+			Credentials: awsv4.Credentials{
+				AccessKeyID:     config.AccessKeyID,
+				SecretAccessKey: config.SecretAccessKey,
+				SessionToken:    config.SessionToken,
+			},
+			Region:  config.Region,
+			Service: "ses",
+		},
+		endpoint:   strings.TrimRight(endpoint, "/"),
+		httpClient: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Name returns "ses"
+func (p *SESProvider) Name() string {
+	return "ses"
+}
+
+// Channel returns ChannelEmail
+func (p *SESProvider) Channel() Channel {
+	return ChannelEmail
+}
+
+// sesContent is a piece of SES message content
+type sesContent struct {
+	Data    string `json:"Data"`
+	Charset string `json:"Charset"`
+}
+
+// Send sends the notification with the SendEmail API
+func (p *SESProvider) Send(ctx context.Context, notification *Notification) error {
+	message := map[string]interface{}{
+		"Subject": sesContent{Data: notification.Subject, Charset: "UTF-8"},
+		"Body":    sesBody(notification),
+	}
+	input := map[string]interface{}{
+		"FromEmailAddress": p.config.From,
+		"Destination":      map[string]interface{}{"ToAddresses": []string{notification.To}},
+		"Content":          map[string]interface{}{"Simple": message},
+		"EmailTags":        []map[string]string{{"Name": "notification_id", "Value": notification.ID}},
+	}
+	if p.config.ConfigurationSet != "" {
+		input["ConfigurationSetName"] = p.config.ConfigurationSet
+	}
+
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+"/v2/email/outbound-emails", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := p.signer.Sign(req, body, time.Now()); err != nil {
+		return err
+	}
+
+	return doRequest(p.httpClient, p.Name(), req)
+}
+
+// sesBody returns the text and HTML bodies that are set
+func sesBody(notification *Notification) map[string]sesContent {
+	body := make(map[string]sesContent)
+	if notification.Text != "" {
+		body["Text"] = sesContent{Data: notification.Text, Charset: "UTF-8"}
+	}
+	if notification.HTML != "" {
+		body["Html"] = sesContent{Data: notification.HTML, Charset: "UTF-8"}
+	}
+	return body
+}
+
+// SendGridConfig holds the configuration for sending email with SendGrid
+type SendGridConfig struct {
+	APIKey   string        `json:"-"`
+	From     string        `json:"from"`
+	FromName string        `json:"from_name,omitempty"`
+	BaseURL  string        `json:"base_url"`
+	Timeout  time.Duration `json:"timeout"`
+}
+
+// DefaultSendGridConfig returns a SendGrid configuration for the public API
+func DefaultSendGridConfig() *SendGridConfig {
+	return &SendGridConfig{
+		BaseURL: "https://api.sendgrid.com",
+		Timeout: 10 * time.Second,
+	}
+}
+
+// SendGridProvider sends email through the SendGrid v3 API
+type SendGridProvider struct {
+	config     *SendGridConfig
+	httpClient *http.Client
+}
+
+// NewSendGridProvider creates a SendGrid email provider
+func NewSendGridProvider(config *SendGridConfig) (*SendGridProvider, error) {
+	if config == nil {
+		config = DefaultSendGridConfig()
+	}
+	if config.APIKey == "" || config.From == "" {
+		return nil, errors.New("SendGrid API key and sender are required")
+	}
+	return &SendGridProvider{
+		config:     config,
+		httpClient: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Name returns "sendgrid"
+func (p *SendGridProvider) Name() string {
+	return "sendgrid"
+}
+
+// Channel returns ChannelEmail
+func (p *SendGridProvider) Channel() Channel {
+	return ChannelEmail
+}
+
+// Send sends the notification with the mail send API
+func (p *SendGridProvider) Send(ctx context.Context, notification *Notification) error {
+	var content []map[string]string
+	if notification.Text != "" {
+		content = append(content, map[string]string{"type": "text/plain", "value": notification.Text})
+	}
+	if notification.HTML != "" {
+		content = append(content, map[string]string{"type": "text/html", "value": notification.HTML})
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"personalizations": []map[string]interface{}{
+			{"to": []map[string]string{{"email": notification.To}}},
+		},
+		"from":        map[string]string{"email": p.config.From, "name": p.config.FromName},
+		"subject":     notification.Subject,
+		"content":     content,
+		"custom_args": map[string]string{"notification_id": notification.ID},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(p.config.BaseURL, "/")+"/v3/mail/send", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.config.APIKey)
+
+	return doRequest(p.httpClient, p.Name(), req)
+}
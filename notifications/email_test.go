@@ -0,0 +1,111 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureServer records the last request and answers with status
+func captureServer(t *testing.T, status int) (*httptest.Server, *http.Request, *map[string]interface{}) {
+	var (
+		captured http.Request
+		body     map[string]interface{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured = *r
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			json.NewDecoder(r.Body).Decode(&body)
+		} else {
+			r.ParseForm()
+			captured.PostForm = r.PostForm
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"message":"rejected"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &captured, &body
+}
+
+// testNotification returns a rendered invite
+func testNotification(channel Channel, to string) *Notification {
+	return &Notification{
+		ID:      "notification-1",
+		Channel: channel,
+		To:      to,
+		Subject: "Join Acme",
+		Text:    "Your access code is ABC123",
+		HTML:    "<p>Your access code is ABC123</p>",
+	}
+}
+
+func TestSESProvider(t *testing.T) {
+	server, req, body := captureServer(t, http.StatusOK)
+	provider, err := NewSESProvider(&SESConfig{
+		Region:           "eu-west-1",
+		Endpoint:         server.URL,
+		From:             "Jarakey <no-reply@jarakey.com>",
+		ConfigurationSet: "transactional",
+		AccessKeyID:      "AKIDEXAMPLE",
+		SecretAccessKey:  "secret",
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, provider.Send(context.Background(), testNotification(ChannelEmail, "guest@example.com")))
+
+	assert.Equal(t, "/v2/email/outbound-emails", req.URL.Path)
+	assert.Contains(t, req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/")
+	assert.Contains(t, req.Header.Get("Authorization"), "/eu-west-1/ses/aws4_request")
+	assert.Equal(t, "Jarakey <no-reply@jarakey.com>", (*body)["FromEmailAddress"])
+	assert.Equal(t, "transactional", (*body)["ConfigurationSetName"])
+
+	simple := (*body)["Content"].(map[string]interface{})["Simple"].(map[string]interface{})
+	assert.Equal(t, "Join Acme", simple["Subject"].(map[string]interface{})["Data"])
+	assert.Contains(t, simple["Body"], "Html")
+}
+
+func TestSESProviderErrors(t *testing.T) {
+	server, _, _ := captureServer(t, http.StatusServiceUnavailable)
+	provider, err := NewSESProvider(&SESConfig{Region: "eu-west-1", Endpoint: server.URL, From: "no-reply@jarakey.com", AccessKeyID: "id", SecretAccessKey: "secret"})
+	require.NoError(t, err)
+
+	err = provider.Send(context.Background(), testNotification(ChannelEmail, "guest@example.com"))
+	var providerErr *ProviderError
+	require.ErrorAs(t, err, &providerErr)
+	assert.True(t, providerErr.Retryable())
+
+	_, err = NewSESProvider(&SESConfig{Region: "eu-west-1"})
+	assert.Error(t, err)
+}
+
+func TestSendGridProvider(t *testing.T) {
+	server, req, body := captureServer(t, http.StatusAccepted)
+	config := DefaultSendGridConfig()
+	config.BaseURL = server.URL
+	config.APIKey = "SG.key"
+	config.From = "no-reply@jarakey.com"
+	provider, err := NewSendGridProvider(config)
+	require.NoError(t, err)
+
+	require.NoError(t, provider.Send(context.Background(), testNotification(ChannelEmail, "guest@example.com")))
+
+	assert.Equal(t, "/v3/mail/send", req.URL.Path)
+	assert.Equal(t, "Bearer SG.key", req.Header.Get("Authorization"))
+	assert.Equal(t, "Join Acme", (*body)["subject"])
+	assert.Len(t, (*body)["content"], 2)
+	assert.Equal(t, "notification-1", (*body)["custom_args"].(map[string]interface{})["notification_id"])
+
+	rejecting, _, _ := captureServer(t, http.StatusBadRequest)
+	config.BaseURL = rejecting.URL
+	err = provider.Send(context.Background(), testNotification(ChannelEmail, "guest@example.com"))
+	var providerErr *ProviderError
+	require.ErrorAs(t, err, &providerErr)
+	assert.False(t, providerErr.Retryable())
+	assert.Contains(t, providerErr.Message, "rejected")
+}
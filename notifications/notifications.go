@@ -0,0 +1,348 @@
+// Package notifications sends email, SMS and push notifications through one
+// audited path: messages are rendered from named templates, limited per org,
+// sent through the channel's provider (SES or SendGrid, Twilio, FCM) with
+// retries, and every delivery is logged, audited and recorded in metrics.
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+)
+
+// Channel is a delivery channel
+type Channel string
+
+const (
+	ChannelEmail Channel = "email"
+	ChannelSMS   Channel = "sms"
+	ChannelPush  Channel = "push"
+)
+
+// Delivery statuses in audit records and metrics
+const (
+	StatusSent        = "sent"
+	StatusFailed      = "failed"
+	StatusRateLimited = "rate_limited"
+)
+
+var (
+	// ErrNoProvider is returned when no provider is configured for a channel
+	ErrNoProvider = errors.New("no notification provider for channel")
+
+	// ErrRateLimited is returned when an org has used up its notification limit
+	ErrRateLimited = errors.New("notification rate limit exceeded")
+)
+
+// Message is a notification to send
+type Message struct {
+	Channel Channel
+	OrgID   string // Limits apply per org; empty isn't limited
+	To      string // Email address, E.164 phone number or device token
+
+	Template string
+	Data     map[string]interface{} // Template data
+
+	PushData map[string]string // Extra key/values delivered with push notifications
+}
+
+// Notification is a rendered message handed to a provider
+type Notification struct {
+	ID      string // Unique per message; providers pass it on where they can
+	Channel Channel
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Data    map[string]string
+}
+
+// Provider delivers notifications on one channel
+type Provider interface {
+	Name() string
+	Channel() Channel
+	Send(ctx context.Context, notification *Notification) error
+}
+
+// ProviderError is a rejected provider API call
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s responded %d: %s", e.Provider, e.StatusCode, e.Message)
+}
+
+// Retryable reports whether the call may succeed if sent again
+func (e *ProviderError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// DeliveryRecord is the audit record of one message
+type DeliveryRecord struct {
+	ID            string    `json:"id"`
+	OrgID         string    `json:"org_id,omitempty"`
+	Channel       Channel   `json:"channel"`
+	Provider      string    `json:"provider,omitempty"`
+	Template      string    `json:"template"`
+	Recipient     string    `json:"recipient"` // Masked
+	Status        string    `json:"status"`
+	Error         string    `json:"error,omitempty"`
+	Attempts      int       `json:"attempts"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	Time          time.Time `json:"time"`
+}
+
+// AuditFunc stores delivery records, e.g. in the audit log
+type AuditFunc func(ctx context.Context, record *DeliveryRecord)
+
+// Config holds the configuration for a dispatcher
+type Config struct {
+	Templates *Templates `json:"-"`
+	Providers []Provider `json:"-"` // At most one per channel
+
+	// RateLimiter limits each org per channel; nil disables the limits
+	RateLimiter middleware.RateLimiter `json:"-"`
+
+	// Retry is the policy for transient provider failures; nil sends once
+	Retry *middleware.RetryConfig `json:"retry,omitempty"`
+
+	Audit   AuditFunc                   `json:"-"` // nil only logs deliveries
+	Logger  *slog.Logger                `json:"-"` // nil uses slog.Default
+	Metrics *middleware.MetricsRegistry `json:"-"` // nil disables metrics
+}
+
+// DefaultConfig returns a configuration with the default retry policy. The
+// templates and providers must be set.
+func DefaultConfig() *Config {
+	return &Config{
+		Retry: middleware.DefaultRetryConfig(),
+	}
+}
+
+// Dispatcher renders and sends notifications
+type Dispatcher struct {
+	config    *Config
+	providers map[Channel]Provider
+	logger    *slog.Logger
+}
+
+// New creates a dispatcher
+func New(config *Config) (*Dispatcher, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if config.Templates == nil {
+		return nil, errors.New("notifications: templates are required")
+	}
+
+	providers := make(map[Channel]Provider, len(config.Providers))
+	for _, provider := range config.Providers {
+		if existing, ok := providers[provider.Channel()]; ok {
+			return nil, fmt.Errorf("notifications: both %s and %s send %s", existing.Name(), provider.Name(), provider.Channel())
+		}
+		providers[provider.Channel()] = provider
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Dispatcher{config: config, providers: providers, logger: logger}, nil
+}
+
+// Send renders a message and delivers it, returning its notification ID
+func (d *Dispatcher) Send(ctx context.Context, message *Message) (string, error) {
+	record := &DeliveryRecord{
+		ID:            uuid.New().String(),
+		OrgID:         message.OrgID,
+		Channel:       message.Channel,
+		Template:      message.Template,
+		Recipient:     maskRecipient(message.Channel, message.To),
+		CorrelationID: middleware.GetCorrelationID(ctx),
+		Time:          time.Now().UTC(),
+	}
+
+	err := d.deliver(ctx, message, record)
+	switch {
+	case err == nil:
+		record.Status = StatusSent
+	case errors.Is(err, ErrRateLimited):
+		record.Status = StatusRateLimited
+		record.Error = err.Error()
+	default:
+		record.Status = StatusFailed
+		record.Error = err.Error()
+	}
+	d.audit(ctx, record)
+
+	return record.ID, err
+}
+
+// deliver renders, limits and sends a message, filling in the record
+func (d *Dispatcher) deliver(ctx context.Context, message *Message, record *DeliveryRecord) error {
+	provider, ok := d.providers[message.Channel]
+	if !ok {
+		return fmt.Errorf("%w %s", ErrNoProvider, message.Channel)
+	}
+	record.Provider = provider.Name()
+
+	if message.To == "" {
+		return errors.New("notification has no recipient")
+	}
+	content, err := d.config.Templates.Render(message.Template, message.Data)
+	if err != nil {
+		return err
+	}
+
+	if err := d.checkRateLimit(ctx, message); err != nil {
+		return err
+	}
+
+	notification := &Notification{
+		ID:      record.ID,
+		Channel: message.Channel,
+		To:      message.To,
+		Subject: content.Subject,
+		Text:    content.Text,
+		HTML:    content.HTML,
+		Data:    message.PushData,
+	}
+
+	start := time.Now()
+	err = d.send(ctx, provider, notification, record)
+	if d.config.Metrics != nil {
+		status := StatusSent
+		if err != nil {
+			status = StatusFailed
+		}
+		d.config.Metrics.RecordNotification(string(message.Channel), provider.Name(), status, time.Since(start))
+	}
+	return err
+}
+
+// checkRateLimit applies the org's limit for the channel. Limiter errors let
+// the message through, as for request rate limits.
+func (d *Dispatcher) checkRateLimit(ctx context.Context, message *Message) error {
+	if d.config.RateLimiter == nil || message.OrgID == "" {
+		return nil
+	}
+
+	result, err := d.config.RateLimiter.Allow(ctx, "notifications:"+message.OrgID+":"+string(message.Channel))
+	if err != nil || result.Allowed {
+		return nil
+	}
+	if d.config.Metrics != nil {
+		d.config.Metrics.RecordNotification(string(message.Channel), d.providers[message.Channel].Name(), StatusRateLimited, 0)
+	}
+	return fmt.Errorf("%w for org %s on %s, retry in %s", ErrRateLimited, message.OrgID, message.Channel, result.RetryAfter.Round(time.Second))
+}
+
+// send hands the notification to the provider, retrying transient failures
+func (d *Dispatcher) send(ctx context.Context, provider Provider, notification *Notification, record *DeliveryRecord) error {
+	if d.config.Retry == nil {
+		record.Attempts = 1
+		return provider.Send(ctx, notification)
+	}
+
+	// Only transient failures are retried, whatever statuses the policy lists
+	policy := *d.config.Retry
+	policy.RetryableErrors = []int{http.StatusServiceUnavailable}
+
+	var lastErr error
+	err := policy.Retry(ctx, func() error {
+		record.Attempts++
+		lastErr = provider.Send(ctx, notification)
+		if lastErr != nil && isTransient(ctx, lastErr) {
+			return &middleware.RetryableError{StatusCode: http.StatusServiceUnavailable, Message: lastErr.Error()}
+		}
+		return nil
+	})
+	if lastErr == nil {
+		return err
+	}
+	return lastErr
+}
+
+// isTransient reports whether a failed send may succeed if retried:
+// throttling, provider errors and network failures
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.Retryable()
+	}
+	return true
+}
+
+// audit logs a delivery and passes it to the audit function
+func (d *Dispatcher) audit(ctx context.Context, record *DeliveryRecord) {
+	attrs := []interface{}{
+		"notification_id", record.ID,
+		"org_id", record.OrgID,
+		"channel", record.Channel,
+		"provider", record.Provider,
+		"template", record.Template,
+		"recipient", record.Recipient,
+		"status", record.Status,
+		"attempts", record.Attempts,
+		"correlation_id", record.CorrelationID,
+	}
+	if record.Error != "" {
+		d.logger.WarnContext(ctx, "notification not sent", append(attrs, "error", record.Error)...)
+	} else {
+		d.logger.InfoContext(ctx, "notification sent", attrs...)
+	}
+
+	if d.config.Audit != nil {
+		d.config.Audit(ctx, record)
+	}
+}
+
+// maskRecipient hides most of an address so audit records and logs don't
+// hold contact details
+func maskRecipient(channel Channel, to string) string {
+	switch {
+	case to == "":
+		return ""
+	case channel == ChannelEmail:
+		local, domain, ok := strings.Cut(to, "@")
+		if !ok || local == "" {
+			return "***"
+		}
+		return local[:1] + "***@" + domain
+	case len(to) > 4:
+		return "***" + to[len(to)-4:]
+	default:
+		return "***"
+	}
+}
+
+// doRequest sends a provider API request, returning a ProviderError for
+// responses other than 2xx
+func doRequest(client *http.Client, provider string, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", provider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	return &ProviderError{Provider: provider, StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+}
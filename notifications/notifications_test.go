@@ -0,0 +1,189 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider records notifications and fails with errs in turn
+type fakeProvider struct {
+	channel Channel
+	sent    []*Notification
+	errs    []error
+}
+
+func (p *fakeProvider) Name() string     { return "fake-" + string(p.channel) }
+func (p *fakeProvider) Channel() Channel { return p.channel }
+
+func (p *fakeProvider) Send(ctx context.Context, notification *Notification) error {
+	p.sent = append(p.sent, notification)
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+		return err
+	}
+	return nil
+}
+
+// testTemplates returns the invite template
+func testTemplates() *Templates {
+	templates := NewTemplates()
+	templates.MustRegister("invite", Template{
+		Subject: "Join {{.OrgName}}",
+		Text:    "Your access code is {{.Code}}",
+		HTML:    "<p>Your access code is <b>{{.Code}}</b></p>",
+	})
+	return templates
+}
+
+// newTestDispatcher creates a dispatcher with fast retries that collects audit records
+func newTestDispatcher(t *testing.T, config *Config) (*Dispatcher, *[]*DeliveryRecord) {
+	var records []*DeliveryRecord
+	if config.Templates == nil {
+		config.Templates = testTemplates()
+	}
+	config.Retry = &middleware.RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffFactor: 1}
+	config.Audit = func(ctx context.Context, record *DeliveryRecord) {
+		records = append(records, record)
+	}
+	config.Metrics = middleware.NewMetricsRegistry("notifications-test")
+
+	dispatcher, err := New(config)
+	require.NoError(t, err)
+	return dispatcher, &records
+}
+
+// inviteMessage returns an invite email
+func inviteMessage() *Message {
+	return &Message{
+		Channel:  ChannelEmail,
+		OrgID:    "org-1",
+		To:       "guest@example.com",
+		Template: "invite",
+		Data:     map[string]interface{}{"OrgName": "Acme", "Code": "ABC123"},
+	}
+}
+
+func TestDispatcherSends(t *testing.T) {
+	email := &fakeProvider{channel: ChannelEmail}
+	dispatcher, records := newTestDispatcher(t, &Config{Providers: []Provider{email}})
+
+	ctx := middleware.WithCorrelationContext(context.Background(), "corr-1", "req-1", "", "")
+	id, err := dispatcher.Send(ctx, inviteMessage())
+	require.NoError(t, err)
+
+	require.Len(t, email.sent, 1)
+	sent := email.sent[0]
+	assert.Equal(t, id, sent.ID)
+	assert.Equal(t, "guest@example.com", sent.To)
+	assert.Equal(t, "Join Acme", sent.Subject)
+	assert.Equal(t, "Your access code is ABC123", sent.Text)
+	assert.Equal(t, "<p>Your access code is <b>ABC123</b></p>", sent.HTML)
+
+	require.Len(t, *records, 1)
+	record := (*records)[0]
+	assert.Equal(t, StatusSent, record.Status)
+	assert.Equal(t, "fake-email", record.Provider)
+	assert.Equal(t, "g***@example.com", record.Recipient)
+	assert.Equal(t, "corr-1", record.CorrelationID)
+	assert.Equal(t, 1, record.Attempts)
+}
+
+func TestDispatcherRetriesTransientFailures(t *testing.T) {
+	email := &fakeProvider{channel: ChannelEmail, errs: []error{
+		&ProviderError{Provider: "fake", StatusCode: http.StatusTooManyRequests},
+		errors.New("connection reset"),
+	}}
+	dispatcher, records := newTestDispatcher(t, &Config{Providers: []Provider{email}})
+
+	_, err := dispatcher.Send(context.Background(), inviteMessage())
+	require.NoError(t, err)
+	assert.Len(t, email.sent, 3)
+	assert.Equal(t, 3, (*records)[0].Attempts)
+}
+
+func TestDispatcherDoesNotRetryRejections(t *testing.T) {
+	rejected := &ProviderError{Provider: "fake", StatusCode: http.StatusBadRequest, Message: "invalid recipient"}
+	email := &fakeProvider{channel: ChannelEmail, errs: []error{rejected}}
+	dispatcher, records := newTestDispatcher(t, &Config{Providers: []Provider{email}})
+
+	_, err := dispatcher.Send(context.Background(), inviteMessage())
+	assert.ErrorIs(t, err, rejected)
+	assert.Len(t, email.sent, 1)
+	assert.Equal(t, StatusFailed, (*records)[0].Status)
+	assert.Contains(t, (*records)[0].Error, "invalid recipient")
+}
+
+func TestDispatcherRateLimitsPerOrg(t *testing.T) {
+	email := &fakeProvider{channel: ChannelEmail}
+	limiter := middleware.NewMemoryRateLimiter(&middleware.RateLimitConfig{Limit: 1, Window: time.Hour})
+	dispatcher, records := newTestDispatcher(t, &Config{Providers: []Provider{email}, RateLimiter: limiter})
+
+	_, err := dispatcher.Send(context.Background(), inviteMessage())
+	require.NoError(t, err)
+
+	_, err = dispatcher.Send(context.Background(), inviteMessage())
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, StatusRateLimited, (*records)[1].Status)
+
+	other := inviteMessage()
+	other.OrgID = "org-2"
+	_, err = dispatcher.Send(context.Background(), other)
+	assert.NoError(t, err, "limits are per org")
+	assert.Len(t, email.sent, 2)
+}
+
+func TestDispatcherFailures(t *testing.T) {
+	dispatcher, records := newTestDispatcher(t, &Config{Providers: []Provider{&fakeProvider{channel: ChannelEmail}}})
+
+	sms := inviteMessage()
+	sms.Channel = ChannelSMS
+	_, err := dispatcher.Send(context.Background(), sms)
+	assert.ErrorIs(t, err, ErrNoProvider)
+
+	unknown := inviteMessage()
+	unknown.Template = "reset_password"
+	_, err = dispatcher.Send(context.Background(), unknown)
+	assert.ErrorIs(t, err, ErrUnknownTemplate)
+
+	missingData := inviteMessage()
+	missingData.Data = map[string]interface{}{"OrgName": "Acme"}
+	_, err = dispatcher.Send(context.Background(), missingData)
+	assert.Error(t, err)
+
+	noRecipient := inviteMessage()
+	noRecipient.To = ""
+	_, err = dispatcher.Send(context.Background(), noRecipient)
+	assert.Error(t, err)
+
+	assert.Len(t, *records, 4, "failures are audited too")
+	for _, record := range *records {
+		assert.Equal(t, StatusFailed, record.Status)
+	}
+}
+
+func TestNewRequiresTemplatesAndOneProviderPerChannel(t *testing.T) {
+	_, err := New(&Config{})
+	assert.Error(t, err)
+
+	_, err = New(&Config{
+		Templates: NewTemplates(),
+		Providers: []Provider{&fakeProvider{channel: ChannelEmail}, &fakeProvider{channel: ChannelEmail}},
+	})
+	assert.Error(t, err)
+}
+
+func TestMaskRecipient(t *testing.T) {
+	assert.Equal(t, "g***@example.com", maskRecipient(ChannelEmail, "guest@example.com"))
+	assert.Equal(t, "***", maskRecipient(ChannelEmail, "not-an-address"))
+	assert.Equal(t, "***4567", maskRecipient(ChannelSMS, "+15551234567"))
+	assert.Equal(t, "***", maskRecipient(ChannelPush, "abc"))
+	assert.Equal(t, "", maskRecipient(ChannelSMS, ""))
+}
@@ -0,0 +1,102 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clients"
+)
+
+// FCMConfig holds the configuration for sending push notifications with
+// Firebase Cloud Messaging
+type FCMConfig struct {
+	ProjectID string        `json:"project_id"`
+	BaseURL   string        `json:"base_url"`
+	Timeout   time.Duration `json:"timeout"`
+
+	// TokenSource supplies OAuth 2.0 access tokens for a service account
+	// with the firebase.messaging scope
+	TokenSource clients.TokenSource `json:"-"`
+}
+
+// DefaultFCMConfig returns an FCM configuration for the public API
+func DefaultFCMConfig() *FCMConfig {
+	return &FCMConfig{
+		BaseURL: "https://fcm.googleapis.com",
+		Timeout: 10 * time.Second,
+	}
+}
+
+// FCMProvider sends push notifications through the FCM HTTP v1 API
+type FCMProvider struct {
+	config     *FCMConfig
+	httpClient *http.Client
+}
+
+// NewFCMProvider creates an FCM push provider
+func NewFCMProvider(config *FCMConfig) (*FCMProvider, error) {
+	if config == nil {
+		config = DefaultFCMConfig()
+	}
+	if config.ProjectID == "" || config.TokenSource == nil {
+		return nil, errors.New("FCM project ID and token source are required")
+	}
+	return &FCMProvider{
+		config:     config,
+		httpClient: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Name returns "fcm"
+func (p *FCMProvider) Name() string {
+	return "fcm"
+}
+
+// Channel returns ChannelPush
+func (p *FCMProvider) Channel() Channel {
+	return ChannelPush
+}
+
+// Send sends the notification to the device token in To, with the subject
+// as the title and the text as the body
+func (p *FCMProvider) Send(ctx context.Context, notification *Notification) error {
+	data := map[string]string{"notification_id": notification.ID}
+	for key, value := range notification.Data {
+		data[key] = value
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"token": notification.To,
+			"notification": map[string]string{
+				"title": notification.Subject,
+				"body":  notification.Text,
+			},
+			"data": data,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	token, err := p.config.TokenSource(ctx)
+	if err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimRight(p.config.BaseURL, "/") + "/v1/projects/" + url.PathEscape(p.config.ProjectID) + "/messages:send"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return doRequest(p.httpClient, p.Name(), req)
+}
@@ -0,0 +1,51 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/jarakey/jarakey-shared-middleware/clients"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFCMProvider(t *testing.T) {
+	server, req, body := captureServer(t, http.StatusOK)
+	config := DefaultFCMConfig()
+	config.BaseURL = server.URL
+	config.ProjectID = "jarakey-prod"
+	config.TokenSource = clients.StaticToken("access-token")
+	provider, err := NewFCMProvider(config)
+	require.NoError(t, err)
+
+	notification := testNotification(ChannelPush, "device-token")
+	notification.Data = map[string]string{"code_id": "code-1"}
+	require.NoError(t, provider.Send(context.Background(), notification))
+
+	assert.Equal(t, "/v1/projects/jarakey-prod/messages:send", req.URL.Path)
+	assert.Equal(t, "Bearer access-token", req.Header.Get("Authorization"))
+
+	message := (*body)["message"].(map[string]interface{})
+	assert.Equal(t, "device-token", message["token"])
+	assert.Equal(t, "Join Acme", message["notification"].(map[string]interface{})["title"])
+	data := message["data"].(map[string]interface{})
+	assert.Equal(t, "code-1", data["code_id"])
+	assert.Equal(t, "notification-1", data["notification_id"])
+}
+
+func TestFCMProviderTokenFailure(t *testing.T) {
+	provider, err := NewFCMProvider(&FCMConfig{
+		ProjectID:   "jarakey-prod",
+		BaseURL:     "http://127.0.0.1:0",
+		TokenSource: func(ctx context.Context) (string, error) { return "", errors.New("no credentials") },
+	})
+	require.NoError(t, err)
+
+	err = provider.Send(context.Background(), testNotification(ChannelPush, "device-token"))
+	assert.ErrorContains(t, err, "no credentials")
+
+	_, err = NewFCMProvider(&FCMConfig{ProjectID: "jarakey-prod"})
+	assert.Error(t, err)
+}
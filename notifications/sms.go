@@ -0,0 +1,86 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TwilioConfig holds the configuration for sending SMS with Twilio
+type TwilioConfig struct {
+	AccountSID string `json:"account_sid"`
+	AuthToken  string `json:"-"`
+
+	// From is the sending number; MessagingServiceSID takes precedence when set
+	From                string `json:"from"`
+	MessagingServiceSID string `json:"messaging_service_sid,omitempty"`
+
+	BaseURL string        `json:"base_url"`
+	Timeout time.Duration `json:"timeout"`
+}
+
+// DefaultTwilioConfig returns a Twilio configuration for the public API
+func DefaultTwilioConfig() *TwilioConfig {
+	return &TwilioConfig{
+		BaseURL: "https://api.twilio.com",
+		Timeout: 10 * time.Second,
+	}
+}
+
+// TwilioProvider sends SMS through the Twilio Messages API
+type TwilioProvider struct {
+	config     *TwilioConfig
+	httpClient *http.Client
+}
+
+// NewTwilioProvider creates a Twilio SMS provider
+func NewTwilioProvider(config *TwilioConfig) (*TwilioProvider, error) {
+	if config == nil {
+		config = DefaultTwilioConfig()
+	}
+	if config.AccountSID == "" || config.AuthToken == "" {
+		return nil, errors.New("Twilio account SID and auth token are required")
+	}
+	if config.From == "" && config.MessagingServiceSID == "" {
+		return nil, errors.New("Twilio sender number or messaging service is required")
+	}
+	return &TwilioProvider{
+		config:     config,
+		httpClient: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Name returns "twilio"
+func (p *TwilioProvider) Name() string {
+	return "twilio"
+}
+
+// Channel returns ChannelSMS
+func (p *TwilioProvider) Channel() Channel {
+	return ChannelSMS
+}
+
+// Send sends the notification's text as an SMS
+func (p *TwilioProvider) Send(ctx context.Context, notification *Notification) error {
+	form := url.Values{}
+	form.Set("To", notification.To)
+	form.Set("Body", notification.Text)
+	if p.config.MessagingServiceSID != "" {
+		form.Set("MessagingServiceSid", p.config.MessagingServiceSID)
+	} else {
+		form.Set("From", p.config.From)
+	}
+
+	endpoint := strings.TrimRight(p.config.BaseURL, "/") + "/2010-04-01/Accounts/" + url.PathEscape(p.config.AccountSID) + "/Messages.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(p.config.AccountSID, p.config.AuthToken)
+
+	return doRequest(p.httpClient, p.Name(), req)
+}
@@ -0,0 +1,45 @@
+package notifications
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwilioProvider(t *testing.T) {
+	server, req, _ := captureServer(t, http.StatusCreated)
+	config := DefaultTwilioConfig()
+	config.BaseURL = server.URL
+	config.AccountSID = "AC123"
+	config.AuthToken = "token"
+	config.From = "+15550000000"
+	provider, err := NewTwilioProvider(config)
+	require.NoError(t, err)
+
+	require.NoError(t, provider.Send(context.Background(), testNotification(ChannelSMS, "+15551234567")))
+
+	assert.Equal(t, "/2010-04-01/Accounts/AC123/Messages.json", req.URL.Path)
+	user, password, ok := req.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "AC123", user)
+	assert.Equal(t, "token", password)
+	assert.Equal(t, "+15551234567", req.PostForm.Get("To"))
+	assert.Equal(t, "+15550000000", req.PostForm.Get("From"))
+	assert.Equal(t, "Your access code is ABC123", req.PostForm.Get("Body"))
+}
+
+func TestTwilioProviderMessagingService(t *testing.T) {
+	server, req, _ := captureServer(t, http.StatusCreated)
+	provider, err := NewTwilioProvider(&TwilioConfig{AccountSID: "AC123", AuthToken: "token", MessagingServiceSID: "MG123", BaseURL: server.URL})
+	require.NoError(t, err)
+
+	require.NoError(t, provider.Send(context.Background(), testNotification(ChannelSMS, "+15551234567")))
+	assert.Equal(t, "MG123", req.PostForm.Get("MessagingServiceSid"))
+	assert.Empty(t, req.PostForm.Get("From"))
+
+	_, err = NewTwilioProvider(&TwilioConfig{AccountSID: "AC123", AuthToken: "token"})
+	assert.Error(t, err)
+}
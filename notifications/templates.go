@@ -0,0 +1,109 @@
+package notifications
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"sync"
+	texttemplate "text/template"
+)
+
+// ErrUnknownTemplate is returned when rendering a template that isn't registered
+var ErrUnknownTemplate = errors.New("unknown notification template")
+
+// Template is the source of a notification template. Subject and Text are
+// text/template sources and HTML is an html/template source, so values are
+// escaped in HTML emails. Data missing from a render is an error rather than
+// "<no value>" in a customer's inbox. SMS uses Text; push uses Subject as
+// the title and Text as the body.
+type Template struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html,omitempty"`
+}
+
+// Content is a rendered template
+type Content struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// parsedTemplate is a registered template ready to render
+type parsedTemplate struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// Templates holds the named notification templates
+type Templates struct {
+	templates map[string]*parsedTemplate
+	mutex     sync.RWMutex
+}
+
+// NewTemplates creates an empty template set
+func NewTemplates() *Templates {
+	return &Templates{templates: make(map[string]*parsedTemplate)}
+}
+
+// Register parses a template and adds it under name, replacing any template
+// of that name
+func (t *Templates) Register(name string, template Template) error {
+	if template.Text == "" && template.HTML == "" {
+		return fmt.Errorf("notification template %s has no body", name)
+	}
+
+	parsed := &parsedTemplate{}
+	var err error
+	if parsed.subject, err = texttemplate.New(name + ".subject").Option("missingkey=error").Parse(template.Subject); err != nil {
+		return fmt.Errorf("notification template %s: %w", name, err)
+	}
+	if parsed.text, err = texttemplate.New(name + ".text").Option("missingkey=error").Parse(template.Text); err != nil {
+		return fmt.Errorf("notification template %s: %w", name, err)
+	}
+	if template.HTML != "" {
+		if parsed.html, err = htmltemplate.New(name + ".html").Option("missingkey=error").Parse(template.HTML); err != nil {
+			return fmt.Errorf("notification template %s: %w", name, err)
+		}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.templates[name] = parsed
+	return nil
+}
+
+// MustRegister registers a template and panics if it doesn't parse. It is
+// meant for templates compiled into the service.
+func (t *Templates) MustRegister(name string, template Template) {
+	if err := t.Register(name, template); err != nil {
+		panic(err)
+	}
+}
+
+// Render renders the named template with data
+func (t *Templates) Render(name string, data interface{}) (*Content, error) {
+	t.mutex.RLock()
+	parsed, ok := t.templates[name]
+	t.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := parsed.subject.Execute(&subject, data); err != nil {
+		return nil, fmt.Errorf("failed to render %s subject: %w", name, err)
+	}
+	if err := parsed.text.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("failed to render %s text: %w", name, err)
+	}
+	if parsed.html != nil {
+		if err := parsed.html.Execute(&html, data); err != nil {
+			return nil, fmt.Errorf("failed to render %s HTML: %w", name, err)
+		}
+	}
+
+	return &Content{Subject: subject.String(), Text: text.String(), HTML: html.String()}, nil
+}
@@ -0,0 +1,37 @@
+package notifications
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplatesRender(t *testing.T) {
+	templates := testTemplates()
+
+	content, err := templates.Render("invite", map[string]interface{}{"OrgName": "Acme & Co", "Code": "<ABC123>"})
+	require.NoError(t, err)
+	assert.Equal(t, "Join Acme & Co", content.Subject)
+	assert.Equal(t, "Your access code is <ABC123>", content.Text)
+	assert.Equal(t, "<p>Your access code is <b>&lt;ABC123&gt;</b></p>", content.HTML, "HTML values are escaped")
+}
+
+func TestTemplatesRejectMissingData(t *testing.T) {
+	_, err := testTemplates().Render("invite", map[string]interface{}{"OrgName": "Acme"})
+	assert.Error(t, err)
+}
+
+func TestTemplatesRegister(t *testing.T) {
+	templates := NewTemplates()
+
+	assert.Error(t, templates.Register("empty", Template{Subject: "Hi"}))
+	assert.Error(t, templates.Register("broken", Template{Text: "{{.Code"}))
+	assert.Panics(t, func() { templates.MustRegister("broken", Template{Text: "{{.Code"}) })
+
+	require.NoError(t, templates.Register("sms", Template{Text: "Code {{.Code}}"}))
+	content, err := templates.Render("sms", map[string]interface{}{"Code": "ABC123"})
+	require.NoError(t, err)
+	assert.Equal(t, "Code ABC123", content.Text)
+	assert.Empty(t, content.HTML)
+}
@@ -0,0 +1,81 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/jarakey/jarakey-shared-middleware/utils"
+)
+
+// ErrUserInactive is returned when the resolved user account is deactivated
+var ErrUserInactive = errors.New("user account is inactive")
+
+// UserResolver finds or creates our user for a verified external identity.
+// It receives the user mapped from the ID token (without an ID) and returns
+// the persisted user.
+type UserResolver func(ctx context.Context, identity *types.User) (*types.User, error)
+
+// MapUser maps verified ID token claims of the named provider to a User.
+// Emails the provider has not verified, or that are malformed, are left
+// empty; Facebook only issues verified emails and does not send email_verified.
+func MapUser(providerName string, claims *IDTokenClaims) *types.User {
+	user := &types.User{
+		Name:       claims.Name,
+		Avatar:     claims.Picture,
+		Role:       types.RoleMember,
+		Provider:   providerName,
+		ProviderID: claims.Subject,
+		IsActive:   true,
+	}
+	if bool(claims.EmailVerified) || providerName == ProviderFacebook {
+		if email, err := types.ParseEmail(claims.Email); err == nil {
+			user.Email = email
+		}
+	}
+	return user
+}
+
+// Exchanger exchanges provider ID tokens for our own JWT pair
+type Exchanger struct {
+	verifier   *Verifier
+	jwtManager *utils.JWTManager
+	resolver   UserResolver
+}
+
+// NewExchanger creates an exchanger that verifies ID tokens with verifier,
+// resolves users with resolver and issues tokens with jwtManager
+func NewExchanger(verifier *Verifier, jwtManager *utils.JWTManager, resolver UserResolver) *Exchanger {
+	return &Exchanger{
+		verifier:   verifier,
+		jwtManager: jwtManager,
+		resolver:   resolver,
+	}
+}
+
+// Exchange verifies the provider ID token, resolves the user and issues a token pair
+func (e *Exchanger) Exchange(ctx context.Context, providerName, rawIDToken, nonce string) (*types.TokenPair, *types.User, error) {
+	claims, err := e.verifier.Verify(ctx, providerName, rawIDToken, nonce)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to verify ID token: %w", err)
+	}
+
+	if e.resolver == nil {
+		return nil, nil, errors.New("no user resolver configured")
+	}
+
+	user, err := e.resolver(ctx, MapUser(providerName, claims))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve user: %w", err)
+	}
+	if !user.IsActive {
+		return nil, nil, ErrUserInactive
+	}
+
+	pair, err := e.jwtManager.GenerateTokenPair(user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, user, nil
+}
@@ -0,0 +1,81 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/jarakey/jarakey-shared-middleware/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapUser(t *testing.T) {
+	claims := validClaims()
+
+	user := MapUser(ProviderGoogle, claims)
+	assert.Equal(t, ProviderGoogle, user.Provider)
+	assert.Equal(t, "google-sub-1", user.ProviderID)
+	assert.Equal(t, types.Email("user@example.com"), user.Email)
+	assert.Equal(t, "Test User", user.Name)
+	assert.Equal(t, "https://example.com/avatar.png", user.Avatar)
+	assert.Equal(t, types.RoleMember, user.Role)
+	assert.True(t, user.IsActive)
+
+	claims.EmailVerified = false
+	assert.Empty(t, MapUser(ProviderApple, claims).Email)
+	assert.Equal(t, types.Email("user@example.com"), MapUser(ProviderFacebook, claims).Email)
+}
+
+func TestExchange(t *testing.T) {
+	provider := newTestProvider(t)
+	verifier, err := NewVerifier(nil, provider.config())
+	require.NoError(t, err)
+
+	jwtManager := utils.NewJWTManager("test-secret-key-32-chars-long")
+	exchanger := NewExchanger(verifier, jwtManager, func(ctx context.Context, identity *types.User) (*types.User, error) {
+		identity.ID = "user-123"
+		identity.OrgID = "org-456"
+		return identity, nil
+	})
+
+	pair, user, err := exchanger.Exchange(context.Background(), ProviderGoogle, provider.sign(t, validClaims()), "nonce-1")
+	require.NoError(t, err)
+	assert.Equal(t, "user-123", user.ID)
+
+	claims, err := jwtManager.ValidateToken(pair.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "user-123", claims.UserID)
+	assert.Equal(t, "org-456", claims.OrgID)
+	assert.Equal(t, "user@example.com", claims.Email)
+
+	_, err = jwtManager.ValidateRefreshToken(pair.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestExchangeRejects(t *testing.T) {
+	provider := newTestProvider(t)
+	verifier, err := NewVerifier(nil, provider.config())
+	require.NoError(t, err)
+	jwtManager := utils.NewJWTManager("test-secret-key-32-chars-long")
+	token := provider.sign(t, validClaims())
+
+	inactive := NewExchanger(verifier, jwtManager, func(ctx context.Context, identity *types.User) (*types.User, error) {
+		identity.ID = "user-123"
+		identity.IsActive = false
+		return identity, nil
+	})
+	_, _, err = inactive.Exchange(context.Background(), ProviderGoogle, token, "")
+	assert.ErrorIs(t, err, ErrUserInactive)
+
+	resolveErr := errors.New("database unavailable")
+	failing := NewExchanger(verifier, jwtManager, func(ctx context.Context, identity *types.User) (*types.User, error) {
+		return nil, resolveErr
+	})
+	_, _, err = failing.Exchange(context.Background(), ProviderGoogle, token, "")
+	assert.ErrorIs(t, err, resolveErr)
+
+	_, _, err = failing.Exchange(context.Background(), ProviderGoogle, "not-a-token", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,51 @@
+// Package oidc verifies ID tokens issued by external identity providers
+// (Google, Apple, Facebook), maps them to types.User and exchanges them for
+// our own JWT pair.
+package oidc
+
+// Provider names, matching types.User.Provider
+const (
+	ProviderGoogle   = "google"
+	ProviderApple    = "apple"
+	ProviderFacebook = "facebook"
+)
+
+// ProviderConfig describes an OpenID Connect identity provider
+type ProviderConfig struct {
+	Name      string   `json:"name"`
+	Issuers   []string `json:"issuers"`
+	JWKSURL   string   `json:"jwks_url"`
+	ClientIDs []string `json:"client_ids"` // Accepted audiences, i.e. our OAuth client IDs
+}
+
+// GoogleProvider returns the configuration for Google Sign-In
+func GoogleProvider(clientIDs ...string) *ProviderConfig {
+	return &ProviderConfig{
+		Name:      ProviderGoogle,
+		Issuers:   []string{"https://accounts.google.com", "accounts.google.com"},
+		JWKSURL:   "https://www.googleapis.com/oauth2/v3/certs",
+		ClientIDs: clientIDs,
+	}
+}
+
+// AppleProvider returns the configuration for Sign in with Apple. The client
+// IDs are the app bundle IDs and/or service IDs.
+func AppleProvider(clientIDs ...string) *ProviderConfig {
+	return &ProviderConfig{
+		Name:      ProviderApple,
+		Issuers:   []string{"https://appleid.apple.com"},
+		JWKSURL:   "https://appleid.apple.com/auth/keys",
+		ClientIDs: clientIDs,
+	}
+}
+
+// FacebookProvider returns the configuration for Facebook Limited Login,
+// which issues OIDC ID tokens. The client IDs are Facebook app IDs.
+func FacebookProvider(appIDs ...string) *ProviderConfig {
+	return &ProviderConfig{
+		Name:      ProviderFacebook,
+		Issuers:   []string{"https://www.facebook.com", "https://limited.facebook.com"},
+		JWKSURL:   "https://limited.facebook.com/.well-known/oauth/openid/jwks/",
+		ClientIDs: appIDs,
+	}
+}
@@ -0,0 +1,158 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jarakey/jarakey-shared-middleware/utils"
+)
+
+var (
+	// ErrUnknownProvider is returned when a token is presented for a provider that is not configured
+	ErrUnknownProvider = errors.New("unknown identity provider")
+
+	// ErrInvalidIssuer is returned when an ID token was not issued by the expected provider
+	ErrInvalidIssuer = errors.New("invalid ID token issuer")
+
+	// ErrNonceMismatch is returned when the ID token nonce does not match the expected nonce
+	ErrNonceMismatch = errors.New("ID token nonce mismatch")
+)
+
+// flexibleBool decodes booleans that some providers (Apple) encode as strings
+type flexibleBool bool
+
+// UnmarshalJSON accepts true, false, "true" and "false"
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	raw := string(data)
+	if unquoted, err := strconv.Unquote(raw); err == nil {
+		raw = unquoted
+	}
+
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	*b = flexibleBool(value)
+	return nil
+}
+
+// IDTokenClaims represents the claims of a provider ID token
+type IDTokenClaims struct {
+	Email         string       `json:"email,omitempty"`
+	EmailVerified flexibleBool `json:"email_verified,omitempty"`
+	Name          string       `json:"name,omitempty"`
+	Picture       string       `json:"picture,omitempty"`
+	Nonce         string       `json:"nonce,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// VerifierConfig holds the configuration for ID token verification
+type VerifierConfig struct {
+	Leeway time.Duration           `json:"leeway"`
+	JWKS   *utils.JWKSClientConfig `json:"jwks"`
+}
+
+// DefaultVerifierConfig returns a default verifier configuration
+func DefaultVerifierConfig() *VerifierConfig {
+	return &VerifierConfig{
+		Leeway: 30 * time.Second,
+		JWKS:   utils.DefaultJWKSClientConfig(),
+	}
+}
+
+// provider is a configured identity provider with its key set
+type provider struct {
+	config *ProviderConfig
+	jwks   *utils.JWKSClient
+}
+
+// Verifier validates ID tokens from the configured identity providers
+type Verifier struct {
+	config    *VerifierConfig
+	providers map[string]*provider
+}
+
+// NewVerifier creates a verifier for the given providers. Every provider must
+// list at least one client ID so that tokens minted for other applications
+// are rejected.
+func NewVerifier(config *VerifierConfig, providers ...*ProviderConfig) (*Verifier, error) {
+	if config == nil {
+		config = DefaultVerifierConfig()
+	}
+
+	v := &Verifier{
+		config:    config,
+		providers: make(map[string]*provider, len(providers)),
+	}
+	for _, p := range providers {
+		if p.Name == "" || p.JWKSURL == "" || len(p.Issuers) == 0 {
+			return nil, fmt.Errorf("incomplete configuration for provider %q", p.Name)
+		}
+		if len(p.ClientIDs) == 0 {
+			return nil, fmt.Errorf("provider %q requires at least one client ID", p.Name)
+		}
+		v.providers[p.Name] = &provider{
+			config: p,
+			jwks:   utils.NewJWKSClient(p.JWKSURL, config.JWKS),
+		}
+	}
+	return v, nil
+}
+
+// Verify validates an ID token issued by the named provider. When nonce is
+// non-empty the token must carry the same nonce.
+func (v *Verifier) Verify(ctx context.Context, providerName, rawIDToken, nonce string) (*IDTokenClaims, error) {
+	p, ok := v.providers[providerName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, providerName)
+	}
+
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		jwk, err := p.jwks.Key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if jwk.Alg != "" && jwk.Alg != token.Method.Alg() {
+			return nil, fmt.Errorf("key %q is not valid for algorithm %s", kid, token.Method.Alg())
+		}
+		return jwk.PublicKey()
+	}
+
+	claims := &IDTokenClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, keyFunc,
+		jwt.WithValidMethods([]string{utils.AlgorithmRS256, utils.AlgorithmES256}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(v.config.Leeway),
+		jwt.WithAudience(p.config.ClientIDs...),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if !issuerAllowed(claims.Issuer, p.config.Issuers) {
+		return nil, ErrInvalidIssuer
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("ID token has no subject")
+	}
+	if nonce != "" && claims.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+	return claims, nil
+}
+
+// issuerAllowed reports whether the issuer is one of the allowed issuers
+func issuerAllowed(issuer string, allowed []string) bool {
+	for _, candidate := range allowed {
+		if issuer == candidate {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jarakey/jarakey-shared-middleware/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testIssuer = "https://accounts.google.com"
+
+// testProvider is a fake identity provider publishing a JWKS
+type testProvider struct {
+	key    *rsa.PrivateKey
+	server *httptest.Server
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwk, err := utils.NewJWK(&key.PublicKey, utils.AlgorithmRS256, "kid-1")
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(utils.JWKSet{Keys: []utils.JWK{jwk}})
+	}))
+	t.Cleanup(server.Close)
+
+	return &testProvider{key: key, server: server}
+}
+
+// config returns a Google-like provider configuration pointing at the fake JWKS
+func (p *testProvider) config() *ProviderConfig {
+	config := GoogleProvider("client-1")
+	config.JWKSURL = p.server.URL
+	return config
+}
+
+// sign issues an ID token with the given claims
+func (p *testProvider) sign(t *testing.T, claims *IDTokenClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "kid-1"
+	signed, err := token.SignedString(p.key)
+	require.NoError(t, err)
+	return signed
+}
+
+// validClaims returns ID token claims accepted by the fake provider configuration
+func validClaims() *IDTokenClaims {
+	now := time.Now()
+	return &IDTokenClaims{
+		Email:         "user@example.com",
+		EmailVerified: true,
+		Name:          "Test User",
+		Picture:       "https://example.com/avatar.png",
+		Nonce:         "nonce-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    testIssuer,
+			Subject:   "google-sub-1",
+			Audience:  jwt.ClaimStrings{"client-1"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}
+}
+
+func TestVerify(t *testing.T) {
+	provider := newTestProvider(t)
+	verifier, err := NewVerifier(nil, provider.config())
+	require.NoError(t, err)
+
+	claims, err := verifier.Verify(context.Background(), ProviderGoogle, provider.sign(t, validClaims()), "nonce-1")
+	require.NoError(t, err)
+	assert.Equal(t, "google-sub-1", claims.Subject)
+	assert.Equal(t, "user@example.com", claims.Email)
+	assert.True(t, bool(claims.EmailVerified))
+}
+
+func TestVerifyRejects(t *testing.T) {
+	provider := newTestProvider(t)
+	verifier, err := NewVerifier(nil, provider.config())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		provider string
+		mutate   func(claims *IDTokenClaims)
+		err      error
+	}{
+		{"unknown provider", ProviderApple, func(c *IDTokenClaims) {}, ErrUnknownProvider},
+		{"wrong issuer", ProviderGoogle, func(c *IDTokenClaims) { c.Issuer = "https://evil.test" }, ErrInvalidIssuer},
+		{"wrong audience", ProviderGoogle, func(c *IDTokenClaims) { c.Audience = jwt.ClaimStrings{"other-client"} }, jwt.ErrTokenInvalidAudience},
+		{"expired", ProviderGoogle, func(c *IDTokenClaims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour)) }, jwt.ErrTokenExpired},
+		{"nonce mismatch", ProviderGoogle, func(c *IDTokenClaims) { c.Nonce = "replayed" }, ErrNonceMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.mutate(claims)
+
+			_, err := verifier.Verify(context.Background(), tt.provider, provider.sign(t, claims), "nonce-1")
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestVerifyRejectsForeignSignature(t *testing.T) {
+	provider := newTestProvider(t)
+	impostor := newTestProvider(t)
+	verifier, err := NewVerifier(nil, provider.config())
+	require.NoError(t, err)
+
+	_, err = verifier.Verify(context.Background(), ProviderGoogle, impostor.sign(t, validClaims()), "")
+	assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+}
+
+func TestNewVerifierRequiresClientIDs(t *testing.T) {
+	_, err := NewVerifier(nil, GoogleProvider())
+	assert.Error(t, err)
+
+	_, err = NewVerifier(nil, &ProviderConfig{Name: "custom", ClientIDs: []string{"client-1"}})
+	assert.Error(t, err)
+}
+
+func TestFlexibleBool(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`true`, true},
+		{`false`, false},
+		{`"true"`, true},
+		{`"false"`, false},
+	}
+
+	for _, tt := range tests {
+		var b flexibleBool
+		require.NoError(t, json.Unmarshal([]byte(tt.input), &b))
+		assert.Equal(t, tt.expected, bool(b), tt.input)
+	}
+
+	var b flexibleBool
+	assert.Error(t, json.Unmarshal([]byte(`"yes please"`), &b))
+}
@@ -0,0 +1,167 @@
+// Package proxy forwards gateway requests to upstream services. It builds on
+// httputil.ReverseProxy with the transport of a clients.Client, so each
+// upstream gets that target's circuit breaker, retries for idempotent
+// requests, per-attempt timeout, correlation header propagation and service
+// call metrics. Upstream failures are answered with the shared APIError format.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/clients"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// Config holds the configuration for a proxy
+type Config struct {
+	// StripPrefix is removed from the request path before forwarding, so
+	// /users/123 can be served by the upstream's /123
+	StripPrefix string `json:"strip_prefix"`
+
+	// FlushInterval is how often the response is flushed to the client while
+	// copying; -1 flushes after every write, for streamed responses
+	FlushInterval time.Duration `json:"flush_interval"`
+
+	Logger *slog.Logger `json:"-"` // nil uses slog.Default
+}
+
+// DefaultConfig returns a proxy configuration that forwards paths unchanged
+func DefaultConfig() *Config {
+	return &Config{}
+}
+
+// Proxy forwards requests to one upstream
+type Proxy struct {
+	name    string
+	config  *Config
+	logger  *slog.Logger
+	reverse *httputil.ReverseProxy
+}
+
+// New creates a proxy to the client's target. The target's base URL path is
+// prepended to forwarded paths.
+func New(client *clients.Client, config *Config) (*Proxy, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	target, err := url.Parse(client.BaseURL())
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: invalid base URL: %w", client.Name(), err)
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	p := &Proxy{
+		name:   client.Name(),
+		config: config,
+		logger: logger,
+	}
+	p.reverse = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			p.stripPrefix(pr.Out.URL)
+			pr.SetURL(target)
+			pr.SetXForwarded()
+		},
+		Transport:     client.HTTPClient().Transport,
+		FlushInterval: config.FlushInterval,
+		ErrorHandler:  p.handleError,
+	}
+	return p, nil
+}
+
+// stripPrefix removes the configured prefix from the outgoing path. The
+// prefix must match whole segments of the escaped path, so /usersettings
+// and /users%2Fsettings are left alone for /users.
+func (p *Proxy) stripPrefix(u *url.URL) {
+	prefix := strings.TrimRight(p.config.StripPrefix, "/")
+	if prefix == "" {
+		return
+	}
+
+	rest, ok := strings.CutPrefix(u.EscapedPath(), prefix)
+	if !ok || (rest != "" && rest[0] != '/') {
+		return
+	}
+	rawPath := "/" + strings.TrimLeft(rest, "/")
+	path, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return
+	}
+	u.Path, u.RawPath = path, rawPath
+}
+
+// ServeHTTP forwards the request
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.reverse.ServeHTTP(w, r)
+}
+
+// Gin returns the proxy as a Gin handler, e.g. for router.Any("/users/*path", proxy.Gin())
+func (p *Proxy) Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p.reverse.ServeHTTP(ginWriter{c.Writer}, c.Request)
+	}
+}
+
+// ginWriter hides the CloseNotify of Gin's writer, which panics when the
+// underlying writer lacks it; the request context already reports clients
+// going away
+type ginWriter struct {
+	http.ResponseWriter
+}
+
+// Unwrap lets http.ResponseController flush through to Gin's writer
+func (w ginWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// handleError answers a request the upstream couldn't serve: 503 while its
+// circuit breaker is open, 504 when it timed out and 502 otherwise
+func (p *Proxy) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *types.APIError
+	switch {
+	case errors.Is(err, clients.ErrCircuitOpen):
+		apiErr = types.NewAPIError(types.ErrCodeServiceUnavailable, fmt.Sprintf("%s is unavailable", p.name))
+	case isTimeout(err):
+		apiErr = types.NewAPIError(types.ErrCodeTimeout, fmt.Sprintf("%s did not respond in time", p.name))
+	default:
+		apiErr = types.NewAPIError(types.ErrCodeBadGateway, fmt.Sprintf("%s could not be reached", p.name))
+	}
+	apiErr.Cause = err
+
+	// A client that went away needn't be logged as an upstream failure
+	if r.Context().Err() == nil {
+		p.logger.WarnContext(r.Context(), "proxy request failed",
+			"upstream", p.name,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"error", err.Error(),
+			"correlation_id", middleware.GetCorrelationID(r.Context()),
+			"request_id", middleware.GetRequestID(r.Context()),
+		)
+	}
+	middleware.RenderError(w, r, apiErr)
+}
+
+// isTimeout reports whether err is a deadline or network timeout
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
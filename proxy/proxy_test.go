@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/clients"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestProxy creates a proxy to handler through a client with fast retries
+func newTestProxy(t *testing.T, handler http.HandlerFunc, configure func(target *clients.TargetConfig), config *Config) *Proxy {
+	upstream := httptest.NewServer(handler)
+	t.Cleanup(upstream.Close)
+
+	target := clients.DefaultTargetConfig()
+	target.BaseURL = upstream.URL + "/api"
+	target.Retry = &middleware.RetryConfig{
+		MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffFactor: 1,
+		RetryableErrors: []int{http.StatusServiceUnavailable},
+	}
+	if configure != nil {
+		configure(target)
+	}
+
+	factory, err := clients.NewFactory(map[string]*clients.TargetConfig{"users-service": target}, nil)
+	require.NoError(t, err)
+	t.Cleanup(factory.Close)
+
+	proxy, err := New(factory.MustClient("users-service"), config)
+	require.NoError(t, err)
+	return proxy
+}
+
+// decodeAPIError decodes an error response
+func decodeAPIError(t *testing.T, w *httptest.ResponseRecorder) types.APIError {
+	var apiErr types.APIError
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&apiErr))
+	return apiErr
+}
+
+func TestProxyForwards(t *testing.T) {
+	var received *http.Request
+	proxy := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		w.Header().Set("X-Upstream", "users")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}, nil, &Config{StripPrefix: "/users/"})
+
+	handler := middleware.CorrelationMiddleware()(proxy)
+	req := httptest.NewRequest(http.MethodPost, "/users/123/roles?active=true", strings.NewReader(`{"role":"admin"}`))
+	req.Header.Set(middleware.CorrelationIDHeader, "corr-1")
+	req.Header.Set("Authorization", "Bearer user-token")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "created", w.Body.String())
+	assert.Equal(t, "users", w.Header().Get("X-Upstream"))
+
+	require.NotNil(t, received)
+	assert.Equal(t, "/api/123/roles", received.URL.Path)
+	assert.Equal(t, "active=true", received.URL.RawQuery)
+	assert.Equal(t, "corr-1", received.Header.Get(middleware.CorrelationIDHeader))
+	assert.Equal(t, "Bearer user-token", received.Header.Get("Authorization"))
+	assert.NotEmpty(t, received.Header.Get("X-Forwarded-For"))
+}
+
+func TestProxyStripsWholeSegments(t *testing.T) {
+	var received *http.Request
+	proxy := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		received = r
+	}, nil, &Config{StripPrefix: "/users"})
+
+	for path, expected := range map[string]string{
+		"/users":            "/api/",
+		"/users/123":        "/api/123",
+		"/usersettings":     "/api/usersettings",
+		"/users%2Fx/123":    "/api/users/x/123",
+		"/users/a%20b":      "/api/a b",
+		"/users/a%2Fb":      "/api/a/b",
+		"/userservice/keys": "/api/userservice/keys",
+	} {
+		proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		require.NotNil(t, received, path)
+		assert.Equal(t, expected, received.URL.Path, path)
+	}
+}
+
+func TestProxyRetriesIdempotentRequests(t *testing.T) {
+	var calls atomic.Int32
+	proxy := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}, nil, nil)
+
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/123", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(2), calls.Load())
+
+	calls.Store(0)
+	w = httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users", strings.NewReader("{}")))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "non-idempotent requests are sent once")
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestProxyCircuitOpen(t *testing.T) {
+	proxy := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}, func(target *clients.TargetConfig) {
+		target.Retry = nil
+		target.CircuitBreaker = &middleware.CircuitBreakerConfig{MaxFailures: 1, ResetTimeout: time.Minute}
+	}, nil)
+
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/123", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code, "upstream errors are passed through")
+
+	w = httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/123", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, types.ErrCodeServiceUnavailable, decodeAPIError(t, w).Code)
+}
+
+func TestProxyTimeout(t *testing.T) {
+	proxy := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}, func(target *clients.TargetConfig) {
+		target.Retry = nil
+		target.Timeout = 20 * time.Millisecond
+	}, nil)
+
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/123", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, types.ErrCodeTimeout, decodeAPIError(t, w).Code)
+}
+
+func TestProxyUnreachable(t *testing.T) {
+	target := clients.DefaultTargetConfig()
+	target.BaseURL = "http://127.0.0.1:1"
+	target.Retry = nil
+	factory, err := clients.NewFactory(map[string]*clients.TargetConfig{"users-service": target}, nil)
+	require.NoError(t, err)
+	defer factory.Close()
+
+	proxy, err := New(factory.MustClient("users-service"), nil)
+	require.NoError(t, err)
+
+	handler := middleware.CorrelationMiddleware()(proxy)
+	req := httptest.NewRequest(http.MethodGet, "/users/123", nil)
+	req.Header.Set(middleware.CorrelationIDHeader, "corr-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	apiErr := decodeAPIError(t, w)
+	assert.Equal(t, types.ErrCodeBadGateway, apiErr.Code)
+	assert.Equal(t, "corr-1", apiErr.CorrelationID)
+}
+
+func TestProxyGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var path string
+	proxy := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+	}, nil, &Config{StripPrefix: "/users"})
+
+	router := gin.New()
+	router.Any("/users/*path", proxy.Gin())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/123", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/api/123", path)
+}
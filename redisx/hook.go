@@ -0,0 +1,188 @@
+package redisx
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/redis/go-redis/v9"
+)
+
+// transientPrefixes are server replies meaning the command wasn't run and
+// may succeed shortly
+var transientPrefixes = []string{"LOADING ", "READONLY ", "CLUSTERDOWN ", "TRYAGAIN ", "MASTERDOWN "}
+
+// isTransient reports whether err is safe to retry because the command
+// certainly wasn't executed: a failed dial or a transient server reply.
+// Errors after a command was written are not retried, since commands like
+// INCR aren't idempotent.
+func isTransient(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	message := err.Error()
+	for _, prefix := range transientPrefixes {
+		if strings.HasPrefix(message, prefix) {
+			return true
+		}
+	}
+	return message == "ERR max number of clients reached"
+}
+
+// isFailure reports whether err says Redis itself is unavailable, as opposed
+// to a cache miss or an error reply to a bad command, which don't count
+// against the circuit breaker
+func isFailure(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		return isTransient(err)
+	}
+	return true
+}
+
+// status labels an operation in the metrics
+func status(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, redis.Nil):
+		return "miss"
+	case errors.Is(err, ErrCircuitOpen):
+		return "circuit_open"
+	default:
+		return "error"
+	}
+}
+
+// hook wraps every command and pipeline with the circuit breaker, retries,
+// metrics and logging
+type hook struct {
+	name          string
+	retry         *middleware.RetryConfig
+	breaker       *middleware.CircuitBreaker
+	logger        *slog.Logger
+	metrics       *middleware.MetricsRegistry
+	slowThreshold time.Duration
+}
+
+// DialHook implements redis.Hook
+func (h *hook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+// ProcessHook implements redis.Hook
+func (h *hook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		return h.process(ctx, cmd.Name(), func() error {
+			return next(ctx, cmd)
+		})
+	}
+}
+
+// ProcessPipelineHook implements redis.Hook
+func (h *hook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		return h.process(ctx, "pipeline", func() error {
+			return next(ctx, cmds)
+		})
+	}
+}
+
+// process runs one operation under the breaker and retry policy
+func (h *hook) process(ctx context.Context, operation string, run func() error) error {
+	start := time.Now()
+
+	err := h.withRetry(ctx, func() error {
+		return h.withBreaker(ctx, run)
+	})
+
+	duration := time.Since(start)
+	if h.metrics != nil {
+		h.metrics.RecordRedisOperation(operation, status(err), duration)
+	}
+	h.log(ctx, operation, err, duration)
+	return err
+}
+
+// withRetry retries transient failures under the retry policy and returns
+// the last error unwrapped, so callers can still compare it with redis.Nil
+func (h *hook) withRetry(ctx context.Context, run func() error) error {
+	if h.retry == nil {
+		return run()
+	}
+
+	var (
+		lastErr error
+		ran     bool
+	)
+	err := h.retry.Retry(ctx, func() error {
+		err := run()
+		if errors.Is(err, ErrCircuitOpen) && ran {
+			// Our own retries opened the breaker; report what actually failed
+			return nil
+		}
+		lastErr, ran = err, true
+		if err == nil || errors.Is(err, ErrCircuitOpen) || !isTransient(err) {
+			return nil
+		}
+		return &middleware.RetryableError{StatusCode: 503, Message: lastErr.Error()}
+	})
+	if !ran {
+		return err
+	}
+	return lastErr
+}
+
+// withBreaker runs the operation through the circuit breaker
+func (h *hook) withBreaker(ctx context.Context, run func() error) error {
+	if h.breaker == nil {
+		return run()
+	}
+	if !h.breaker.Ready() {
+		return ErrCircuitOpen
+	}
+
+	var err error
+	h.breaker.Execute(ctx, func() error {
+		err = run()
+		if isFailure(err) {
+			return err
+		}
+		return nil
+	})
+	return err
+}
+
+// log records failed and slow operations with the caller's correlation fields
+func (h *hook) log(ctx context.Context, operation string, err error, duration time.Duration) {
+	switch {
+	case isFailure(err) || errors.Is(err, ErrCircuitOpen):
+		h.logger.WarnContext(ctx, "redis operation failed", h.attrs(ctx, operation, duration, "error", err.Error())...)
+	case h.slowThreshold > 0 && duration >= h.slowThreshold:
+		h.logger.WarnContext(ctx, "slow redis operation", h.attrs(ctx, operation, duration)...)
+	}
+}
+
+// attrs returns the log attributes of an operation
+func (h *hook) attrs(ctx context.Context, operation string, duration time.Duration, extra ...interface{}) []interface{} {
+	return append([]interface{}{
+		"client", h.name,
+		"operation", operation,
+		"duration_ms", duration.Milliseconds(),
+		"correlation_id", middleware.GetCorrelationID(ctx),
+		"request_id", middleware.GetRequestID(ctx),
+	}, extra...)
+}
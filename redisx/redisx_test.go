@@ -0,0 +1,192 @@
+package redisx
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingHook counts commands that reach the connection, below the shared hook
+type countingHook struct {
+	calls int32
+}
+
+func (h *countingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *countingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		atomic.AddInt32(&h.calls, 1)
+		return next(ctx, cmd)
+	}
+}
+
+func (h *countingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func newTestConfig(server *miniredis.Miniredis) *Config {
+	config := DefaultConfig()
+	config.Addr = server.Addr()
+	config.Retry = &middleware.RetryConfig{
+		MaxAttempts:     3,
+		InitialDelay:    time.Millisecond,
+		MaxDelay:        5 * time.Millisecond,
+		BackoffFactor:   2,
+		RetryableErrors: []int{503},
+	}
+	config.CircuitBreaker = &middleware.CircuitBreakerConfig{MaxFailures: 5, ResetTimeout: time.Hour}
+	return config
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	_, err := New(&Config{})
+	assert.Error(t, err)
+
+	_, err = New(&Config{URL: "http://localhost"})
+	assert.Error(t, err)
+
+	client, err := New(&Config{URL: "redis://:secret@localhost:6380/2"})
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:6380", client.Options().Addr)
+	assert.Equal(t, 2, client.Options().DB)
+	assert.Equal(t, "redis", client.Name())
+}
+
+func TestClientCommands(t *testing.T) {
+	server := miniredis.RunT(t)
+	client, err := New(newTestConfig(server))
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	require.NoError(t, client.Set(ctx, "code:123", "active", time.Minute).Err())
+	value, err := client.Get(ctx, "code:123").Result()
+	require.NoError(t, err)
+	assert.Equal(t, "active", value)
+
+	// Misses don't count against the circuit breaker
+	for i := 0; i < 5; i++ {
+		assert.ErrorIs(t, client.Get(ctx, "missing").Err(), redis.Nil)
+	}
+	assert.Equal(t, middleware.StateClosed, client.CircuitBreaker().GetState())
+
+	pipe := client.Pipeline()
+	pipe.Incr(ctx, "counter")
+	pipe.Incr(ctx, "counter")
+	_, err = pipe.Exec(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "2", mustGet(t, server, "counter"))
+}
+
+func mustGet(t *testing.T, server *miniredis.Miniredis, key string) string {
+	value, err := server.Get(key)
+	require.NoError(t, err)
+	return value
+}
+
+func TestClientRetriesTransientErrors(t *testing.T) {
+	server := miniredis.RunT(t)
+	client, err := New(newTestConfig(server))
+	require.NoError(t, err)
+	defer client.Close()
+
+	counter := &countingHook{}
+	client.AddHook(counter)
+
+	server.SetError("LOADING Redis is loading the dataset in memory")
+	err = client.Get(context.Background(), "key").Err()
+	assert.ErrorContains(t, err, "LOADING")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&counter.calls))
+
+	// Other error replies are returned straight away
+	atomic.StoreInt32(&counter.calls, 0)
+	server.SetError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	assert.Error(t, client.Get(context.Background(), "key").Err())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&counter.calls))
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	server := miniredis.RunT(t)
+	config := newTestConfig(server)
+	config.Retry = nil
+	config.CircuitBreaker.MaxFailures = 2
+	client, err := New(config)
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	server.Close()
+	for i := 0; i < 2; i++ {
+		assert.Error(t, client.Get(ctx, "key").Err())
+	}
+	assert.ErrorIs(t, client.Get(ctx, "key").Err(), ErrCircuitOpen)
+	assert.Equal(t, middleware.StateOpen, client.CircuitBreaker().GetState())
+}
+
+func TestClientRetriesOpeningBreakerKeepCause(t *testing.T) {
+	server := miniredis.RunT(t)
+	config := newTestConfig(server)
+	config.CircuitBreaker.MaxFailures = 2
+	client, err := New(config)
+	require.NoError(t, err)
+	defer client.Close()
+
+	server.Close()
+	err = client.Get(context.Background(), "key").Err()
+	assert.NotErrorIs(t, err, ErrCircuitOpen)
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, middleware.StateOpen, client.CircuitBreaker().GetState())
+}
+
+func TestClientLogsWithCorrelation(t *testing.T) {
+	server := miniredis.RunT(t)
+	var logs bytes.Buffer
+	config := newTestConfig(server)
+	config.Retry = nil
+	config.Logger = slog.New(slog.NewJSONHandler(&logs, nil))
+	client, err := New(config)
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := middleware.WithCorrelationContext(context.Background(), "corr-123", "req-1", "", "")
+	client.Get(ctx, "missing")
+	assert.Empty(t, logs.String(), "expected misses not to be logged")
+
+	server.SetError("LOADING Redis is loading the dataset in memory")
+	client.Get(ctx, "key")
+	assert.Contains(t, logs.String(), `"correlation_id":"corr-123"`)
+	assert.Contains(t, logs.String(), `"operation":"get"`)
+}
+
+func TestClientHealthCheck(t *testing.T) {
+	server := miniredis.RunT(t)
+	checker := middleware.NewHealthChecker("codes-service")
+	config := newTestConfig(server)
+	config.HealthChecker = checker
+	client, err := New(config)
+	require.NoError(t, err)
+	defer client.Close()
+
+	health := checker.CheckHealth(context.Background())
+	dependencies := health["dependencies"].(map[string]*middleware.DependencyHealth)
+	require.Contains(t, dependencies, "redis")
+	assert.Equal(t, middleware.StatusHealthy, dependencies["redis"].Status)
+
+	server.Close()
+	check := client.HealthCheck(nil)
+	assert.Equal(t, middleware.StatusUnhealthy, check(context.Background()).Status)
+
+	client.CircuitBreaker().ForceOpen()
+	assert.Equal(t, middleware.StatusDegraded, check(context.Background()).Status)
+}
@@ -0,0 +1,253 @@
+// Package reload watches configuration sources (a file, the environment,
+// Consul) and notifies subscribers when their values change, so operational
+// knobs such as rate limits, circuit breaker thresholds, the log level and
+// feature flags can be tuned without a rolling restart.
+//
+// Configuration is a flat set of dotted keys such as "log.level" or
+// "breakers.users-service.max_failures". Subscribers register for a prefix
+// and receive the values under it with the prefix removed.
+package reload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Values are configuration values by dotted key
+type Values map[string]string
+
+// String returns the value of key, or fallback when it isn't set
+func (v Values) String(key, fallback string) string {
+	if value, ok := v[key]; ok {
+		return value
+	}
+	return fallback
+}
+
+// Bool parses the value of key, returning fallback when it isn't set
+func (v Values) Bool(key string, fallback bool) (bool, error) {
+	value, ok := v[key]
+	if !ok {
+		return fallback, nil
+	}
+	parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return fallback, fmt.Errorf("%s: invalid boolean %q", key, value)
+	}
+	return parsed, nil
+}
+
+// Int parses the value of key, returning fallback when it isn't set
+func (v Values) Int(key string, fallback int) (int, error) {
+	value, ok := v[key]
+	if !ok {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return fallback, fmt.Errorf("%s: invalid integer %q", key, value)
+	}
+	return parsed, nil
+}
+
+// Duration parses the value of key as a Go duration such as "30s",
+// returning fallback when it isn't set
+func (v Values) Duration(key string, fallback time.Duration) (time.Duration, error) {
+	value, ok := v[key]
+	if !ok {
+		return fallback, nil
+	}
+	parsed, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return fallback, fmt.Errorf("%s: invalid duration %q", key, value)
+	}
+	return parsed, nil
+}
+
+// Sub returns the values under prefix with the prefix and its dot removed.
+// An empty prefix returns a copy of every value.
+func (v Values) Sub(prefix string) Values {
+	sub := make(Values)
+	for key, value := range v {
+		if prefix == "" {
+			sub[key] = value
+		} else if rest, ok := strings.CutPrefix(key, prefix+"."); ok {
+			sub[rest] = value
+		}
+	}
+	return sub
+}
+
+// Source loads configuration values
+type Source interface {
+	Name() string
+	Load(ctx context.Context) (Values, error)
+}
+
+// Subscriber applies the values under its prefix. It is called once on the
+// first reload after it subscribes and again whenever those values change.
+type Subscriber func(ctx context.Context, values Values) error
+
+// WatcherConfig holds the configuration for a watcher
+type WatcherConfig struct {
+	Interval time.Duration `json:"interval"` // How often Start reloads the sources
+	Logger   *slog.Logger  `json:"-"`        // nil uses slog.Default
+}
+
+// DefaultWatcherConfig returns a watcher configuration that reloads every 30 seconds
+func DefaultWatcherConfig() *WatcherConfig {
+	return &WatcherConfig{
+		Interval: 30 * time.Second,
+	}
+}
+
+// subscription is a registered subscriber and the values it last applied
+type subscription struct {
+	prefix   string
+	fn       Subscriber
+	applied  Values
+	notified bool
+}
+
+// Watcher merges configuration from its sources and notifies subscribers of changes
+type Watcher struct {
+	config        *WatcherConfig
+	sources       []Source
+	logger        *slog.Logger
+	values        Values
+	subscriptions []*subscription
+	mutex         sync.RWMutex
+	reloadMutex   sync.Mutex
+}
+
+// NewWatcher creates a watcher over the given sources. When several sources
+// set a key the first one wins, as for secrets.
+func NewWatcher(config *WatcherConfig, sources ...Source) *Watcher {
+	if config == nil {
+		config = DefaultWatcherConfig()
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &Watcher{
+		config:  config,
+		sources: sources,
+		logger:  logger,
+		values:  make(Values),
+	}
+}
+
+// Subscribe registers fn for the values under prefix. It is first called on
+// the next Reload, so subscribe before the initial Reload at startup.
+func (w *Watcher) Subscribe(prefix string, fn Subscriber) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.subscriptions = append(w.subscriptions, &subscription{prefix: prefix, fn: fn})
+}
+
+// Values returns a copy of the current configuration
+func (w *Watcher) Values() Values {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return maps.Clone(w.values)
+}
+
+// Reload loads every source and notifies the subscribers whose values
+// changed. When a source fails the previous configuration is kept and no
+// subscriber is called. A subscriber that fails is called again on the
+// next reload.
+func (w *Watcher) Reload(ctx context.Context) error {
+	w.reloadMutex.Lock()
+	defer w.reloadMutex.Unlock()
+
+	values, err := w.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	changed := changedKeys(w.values, values)
+	w.values = values
+	subscriptions := append([]*subscription(nil), w.subscriptions...)
+	w.mutex.Unlock()
+
+	if len(changed) > 0 {
+		// Values may be sensitive, so only the keys are logged
+		w.logger.InfoContext(ctx, "configuration changed", "keys", changed)
+	}
+
+	var errs []error
+	for _, sub := range subscriptions {
+		values := values.Sub(sub.prefix)
+		if sub.notified && maps.Equal(values, sub.applied) {
+			continue
+		}
+
+		if err := sub.fn(ctx, values); err != nil {
+			w.logger.ErrorContext(ctx, "failed to apply configuration", "prefix", sub.prefix, "error", err.Error())
+			errs = append(errs, fmt.Errorf("%s: %w", sub.prefix, err))
+			continue
+		}
+		sub.applied = values
+		sub.notified = true
+	}
+	return errors.Join(errs...)
+}
+
+// Start reloads the sources every Interval until ctx is done. Failures are
+// logged and the last good configuration stays in effect.
+func (w *Watcher) Start(ctx context.Context) {
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.Reload(ctx); err != nil && ctx.Err() == nil {
+				w.logger.WarnContext(ctx, "configuration reload failed", "error", err.Error())
+			}
+		}
+	}
+}
+
+// load merges the values of every source, the first source of a key winning
+func (w *Watcher) load(ctx context.Context) (Values, error) {
+	merged := make(Values)
+	for i := len(w.sources) - 1; i >= 0; i-- {
+		values, err := w.sources[i].Load(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to load configuration: %w", w.sources[i].Name(), err)
+		}
+		maps.Copy(merged, values)
+	}
+	return merged, nil
+}
+
+// changedKeys returns the sorted keys added, removed or changed between two configurations
+func changedKeys(previous, current Values) []string {
+	var keys []string
+	for key, value := range current {
+		if old, ok := previous[key]; !ok || old != value {
+			keys = append(keys, key)
+		}
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
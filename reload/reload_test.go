@@ -0,0 +1,164 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticSource is a source whose values a test changes between reloads
+type staticSource struct {
+	name   string
+	values Values
+	err    error
+}
+
+func (s *staticSource) Name() string { return s.name }
+
+func (s *staticSource) Load(ctx context.Context) (Values, error) {
+	return s.values, s.err
+}
+
+func TestValues(t *testing.T) {
+	values := Values{
+		"log.level":           "debug",
+		"flags.new_checkout":  "true",
+		"breakers.users.max":  "5",
+		"breakers.users.wait": "30s",
+		"bad":                 "nope",
+	}
+
+	assert.Equal(t, "debug", values.String("log.level", "info"))
+	assert.Equal(t, "info", values.String("missing", "info"))
+
+	enabled, err := values.Bool("flags.new_checkout", false)
+	require.NoError(t, err)
+	assert.True(t, enabled)
+
+	max, err := values.Int("breakers.users.max", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 5, max)
+
+	wait, err := values.Duration("breakers.users.wait", time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, wait)
+
+	fallback, err := values.Int("missing", 7)
+	require.NoError(t, err)
+	assert.Equal(t, 7, fallback)
+
+	_, err = values.Bool("bad", false)
+	assert.ErrorContains(t, err, "bad: invalid boolean")
+	_, err = values.Duration("bad", 0)
+	assert.ErrorContains(t, err, "bad: invalid duration")
+
+	assert.Equal(t, Values{"max": "5", "wait": "30s"}, values.Sub("breakers.users"))
+	assert.Len(t, values.Sub(""), len(values))
+}
+
+func TestWatcherMergesSources(t *testing.T) {
+	override := &staticSource{name: "consul", values: Values{"log.level": "debug"}}
+	base := &staticSource{name: "file", values: Values{"log.level": "info", "flags.beta": "true"}}
+	watcher := NewWatcher(nil, override, base)
+
+	require.NoError(t, watcher.Reload(context.Background()))
+	assert.Equal(t, Values{"log.level": "debug", "flags.beta": "true"}, watcher.Values())
+}
+
+func TestWatcherNotifiesChangedSubscribers(t *testing.T) {
+	source := &staticSource{name: "file", values: Values{"log.level": "info", "flags.beta": "false"}}
+	watcher := NewWatcher(nil, source)
+
+	var logCalls, flagCalls []Values
+	watcher.Subscribe("log", func(ctx context.Context, values Values) error {
+		logCalls = append(logCalls, values)
+		return nil
+	})
+	watcher.Subscribe("flags", func(ctx context.Context, values Values) error {
+		flagCalls = append(flagCalls, values)
+		return nil
+	})
+
+	// Every subscriber is called on the first reload
+	require.NoError(t, watcher.Reload(context.Background()))
+	assert.Equal(t, []Values{{"level": "info"}}, logCalls)
+	assert.Equal(t, []Values{{"beta": "false"}}, flagCalls)
+
+	// Only subscribers whose values changed are called again
+	source.values = Values{"log.level": "debug", "flags.beta": "false"}
+	require.NoError(t, watcher.Reload(context.Background()))
+	assert.Equal(t, []Values{{"level": "info"}, {"level": "debug"}}, logCalls)
+	assert.Len(t, flagCalls, 1)
+
+	// Removed keys are a change too
+	source.values = Values{"log.level": "debug"}
+	require.NoError(t, watcher.Reload(context.Background()))
+	assert.Equal(t, []Values{{"beta": "false"}, {}}, flagCalls)
+}
+
+func TestWatcherKeepsConfigurationWhenASourceFails(t *testing.T) {
+	source := &staticSource{name: "consul", values: Values{"log.level": "info"}}
+	watcher := NewWatcher(nil, source)
+
+	calls := 0
+	watcher.Subscribe("log", func(ctx context.Context, values Values) error {
+		calls++
+		return nil
+	})
+	require.NoError(t, watcher.Reload(context.Background()))
+
+	source.values, source.err = nil, errors.New("connection refused")
+	err := watcher.Reload(context.Background())
+	assert.ErrorContains(t, err, "consul: failed to load configuration")
+	assert.Equal(t, Values{"log.level": "info"}, watcher.Values())
+	assert.Equal(t, 1, calls)
+}
+
+func TestWatcherRetriesFailedSubscribers(t *testing.T) {
+	source := &staticSource{name: "file", values: Values{"log.level": "loud"}}
+	watcher := NewWatcher(nil, source)
+
+	calls := 0
+	fail := true
+	watcher.Subscribe("log", func(ctx context.Context, values Values) error {
+		calls++
+		if fail {
+			return errors.New("invalid level")
+		}
+		return nil
+	})
+
+	assert.ErrorContains(t, watcher.Reload(context.Background()), "log: invalid level")
+
+	// Unchanged values are applied again until the subscriber succeeds
+	fail = false
+	require.NoError(t, watcher.Reload(context.Background()))
+	require.NoError(t, watcher.Reload(context.Background()))
+	assert.Equal(t, 2, calls)
+}
+
+func TestWatcherStart(t *testing.T) {
+	source := &staticSource{name: "file", values: Values{"log.level": "info"}}
+	watcher := NewWatcher(&WatcherConfig{Interval: time.Millisecond}, source)
+
+	applied := make(chan string, 10)
+	watcher.Subscribe("log", func(ctx context.Context, values Values) error {
+		applied <- values["level"]
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		watcher.Start(ctx)
+		close(done)
+	}()
+
+	assert.Equal(t, "info", <-applied)
+	cancel()
+	<-done
+}
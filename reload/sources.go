@@ -0,0 +1,203 @@
+package reload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// FileSource reads a JSON file. Nested objects become dotted keys, so
+// {"log": {"level": "debug"}} sets "log.level".
+type FileSource struct {
+	Path     string
+	Optional bool // A missing file yields no values instead of an error
+}
+
+// Name returns "file"
+func (s FileSource) Name() string {
+	return "file"
+}
+
+// Load reads and flattens the file
+func (s FileSource) Load(ctx context.Context) (Values, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) && s.Optional {
+		return Values{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document map[string]interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("invalid JSON in %s: %w", s.Path, err)
+	}
+
+	values := make(Values)
+	flatten(values, "", document)
+	return values, nil
+}
+
+// flatten adds the leaves of a decoded JSON object under dotted keys. Arrays
+// are kept as JSON text.
+func flatten(values Values, prefix string, node map[string]interface{}) {
+	for key, value := range node {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch value := value.(type) {
+		case map[string]interface{}:
+			flatten(values, key, value)
+		case string:
+			values[key] = value
+		case nil:
+			values[key] = ""
+		case []interface{}:
+			data, _ := json.Marshal(value)
+			values[key] = string(data)
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+}
+
+// EnvSource reads environment variables starting with Prefix. The rest of the
+// name is lowercased and double underscores become dots, so with the prefix
+// "JARAKEY_" the variable JARAKEY_LOG__LEVEL sets "log.level".
+type EnvSource struct {
+	Prefix string
+}
+
+// Name returns "env"
+func (s EnvSource) Name() string {
+	return "env"
+}
+
+// Load reads the matching variables
+func (s EnvSource) Load(ctx context.Context) (Values, error) {
+	values := make(Values)
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		rest, ok := strings.CutPrefix(name, s.Prefix)
+		if !ok || rest == "" {
+			continue
+		}
+		values[strings.ReplaceAll(strings.ToLower(rest), "__", ".")] = value
+	}
+	return values, nil
+}
+
+// ConsulConfig holds the configuration for a Consul KV source
+type ConsulConfig struct {
+	Address    string        `json:"address"`
+	Token      string        `json:"-"`
+	Datacenter string        `json:"datacenter,omitempty"`
+	Prefix     string        `json:"prefix"` // KV folder, e.g. "config/users-service"
+	Timeout    time.Duration `json:"timeout"`
+}
+
+// DefaultConsulConfig returns a Consul configuration with the address and
+// token read from CONSUL_HTTP_ADDR and CONSUL_HTTP_TOKEN
+func DefaultConsulConfig() *ConsulConfig {
+	address := os.Getenv("CONSUL_HTTP_ADDR")
+	if address != "" && !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	return &ConsulConfig{
+		Address: address,
+		Token:   os.Getenv("CONSUL_HTTP_TOKEN"),
+		Timeout: 10 * time.Second,
+	}
+}
+
+// ConsulSource reads the keys under a Consul KV folder. Slashes in key paths
+// below the folder become dots, so config/users-service/log/level sets
+// "log.level".
+type ConsulSource struct {
+	config     *ConsulConfig
+	httpClient *http.Client
+}
+
+// NewConsulSource creates a source for the KV folder at config.Prefix
+func NewConsulSource(config *ConsulConfig) (*ConsulSource, error) {
+	if config == nil {
+		config = DefaultConsulConfig()
+	}
+	if config.Address == "" || strings.Trim(config.Prefix, "/") == "" {
+		return nil, errors.New("Consul address and prefix are required")
+	}
+
+	return &ConsulSource{
+		config:     config,
+		httpClient: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Name returns "consul"
+func (s *ConsulSource) Name() string {
+	return "consul"
+}
+
+// consulPair is one entry of a recursive KV read; Value is base64 in JSON
+type consulPair struct {
+	Key   string `json:"Key"`
+	Value []byte `json:"Value"`
+}
+
+// Load reads every key under the folder
+func (s *ConsulSource) Load(ctx context.Context) (Values, error) {
+	prefix := strings.Trim(s.config.Prefix, "/")
+	query := url.Values{"recurse": {"true"}}
+	if s.config.Datacenter != "" {
+		query.Set("dc", s.config.Datacenter)
+	}
+	endpoint := fmt.Sprintf("%s/v1/kv/%s?%s", strings.TrimSuffix(s.config.Address, "/"), prefix, query.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.config.Token != "" {
+		req.Header.Set("X-Consul-Token", s.config.Token)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// An empty folder doesn't exist in Consul
+	if resp.StatusCode == http.StatusNotFound {
+		return Values{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return nil, fmt.Errorf("consul responded %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var pairs []consulPair
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return nil, fmt.Errorf("invalid consul response: %w", err)
+	}
+
+	values := make(Values)
+	for _, pair := range pairs {
+		key, ok := strings.CutPrefix(pair.Key, prefix+"/")
+		if !ok || key == "" || strings.HasSuffix(key, "/") {
+			continue
+		}
+		values[strings.ReplaceAll(key, "/", ".")] = string(pair.Value)
+	}
+	return values, nil
+}
@@ -0,0 +1,121 @@
+package reload
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"log": {"level": "debug"},
+		"breakers": {"users-service": {"max_failures": 10, "reset_timeout": "30s"}},
+		"flags": {"new_checkout": true},
+		"origins": ["https://a.example", "https://b.example"]
+	}`), 0o600))
+
+	values, err := FileSource{Path: path}.Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Values{
+		"log.level":                            "debug",
+		"breakers.users-service.max_failures":  "10",
+		"breakers.users-service.reset_timeout": "30s",
+		"flags.new_checkout":                   "true",
+		"origins":                              `["https://a.example","https://b.example"]`,
+	}, values)
+}
+
+func TestFileSourceErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.json")
+
+	_, err := FileSource{Path: missing}.Load(context.Background())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	values, err := FileSource{Path: missing, Optional: true}.Load(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, values)
+
+	invalid := filepath.Join(t.TempDir(), "invalid.json")
+	require.NoError(t, os.WriteFile(invalid, []byte("level: debug"), 0o600))
+	_, err = FileSource{Path: invalid}.Load(context.Background())
+	assert.ErrorContains(t, err, "invalid JSON")
+}
+
+func TestEnvSource(t *testing.T) {
+	t.Setenv("RELOADTEST_LOG__LEVEL", "warn")
+	t.Setenv("RELOADTEST_FLAGS__NEW_CHECKOUT", "true")
+	t.Setenv("OTHER_LOG__LEVEL", "error")
+
+	values, err := EnvSource{Prefix: "RELOADTEST_"}.Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Values{"log.level": "warn", "flags.new_checkout": "true"}, values)
+}
+
+func TestConsulSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/kv/config/users-service", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("recurse"))
+		assert.Equal(t, "dc2", r.URL.Query().Get("dc"))
+		assert.Equal(t, "consul-token", r.Header.Get("X-Consul-Token"))
+
+		// Values are base64: "debug" and "10"
+		w.Write([]byte(`[
+			{"Key": "config/users-service/", "Value": null},
+			{"Key": "config/users-service/log/level", "Value": "ZGVidWc="},
+			{"Key": "config/users-service/breakers/users-service/max_failures", "Value": "MTA="}
+		]`))
+	}))
+	defer server.Close()
+
+	source, err := NewConsulSource(&ConsulConfig{
+		Address:    server.URL,
+		Token:      "consul-token",
+		Datacenter: "dc2",
+		Prefix:     "/config/users-service/",
+	})
+	require.NoError(t, err)
+
+	values, err := source.Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Values{"log.level": "debug", "breakers.users-service.max_failures": "10"}, values)
+}
+
+func TestConsulSourceErrors(t *testing.T) {
+	_, err := NewConsulSource(&ConsulConfig{Address: "http://localhost:8500"})
+	assert.Error(t, err)
+
+	status := http.StatusNotFound
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("Permission denied"))
+	}))
+	defer server.Close()
+
+	source, err := NewConsulSource(&ConsulConfig{Address: server.URL, Prefix: "config/users-service"})
+	require.NoError(t, err)
+
+	// A folder without keys doesn't exist
+	values, err := source.Load(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, values)
+
+	status = http.StatusForbidden
+	_, err = source.Load(context.Background())
+	assert.ErrorContains(t, err, "consul responded 403: Permission denied")
+}
+
+func TestDefaultConsulConfig(t *testing.T) {
+	t.Setenv("CONSUL_HTTP_ADDR", "127.0.0.1:8500")
+	t.Setenv("CONSUL_HTTP_TOKEN", "token")
+
+	config := DefaultConsulConfig()
+	assert.Equal(t, "http://127.0.0.1:8500", config.Address)
+	assert.Equal(t, "token", config.Token)
+}
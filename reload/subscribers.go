@@ -0,0 +1,167 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+)
+
+// LogLevel sets the log level from the "level" key, e.g. subscribed under
+// "log" for "log.level". Without the key the level is left as it is.
+func LogLevel(level *slog.LevelVar) Subscriber {
+	return func(ctx context.Context, values Values) error {
+		value, ok := values["level"]
+		if !ok {
+			return nil
+		}
+		var parsed slog.Level
+		if err := parsed.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("level: invalid log level %q", value)
+		}
+		level.Set(parsed)
+		return nil
+	}
+}
+
+// FeatureFlags sets each defined flag from the key of the same name, e.g.
+// subscribed under "flags" for "flags.new_checkout". Flags without a key keep
+// their value; keys for undefined flags are an error.
+func FeatureFlags(flags *middleware.FeatureFlags) Subscriber {
+	return func(ctx context.Context, values Values) error {
+		var errs []error
+		for name := range values {
+			if !flags.Has(name) {
+				errs = append(errs, fmt.Errorf("%s: unknown feature flag", name))
+				continue
+			}
+			enabled, err := values.Bool(name, false)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			flags.Set(name, enabled)
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// RateLimits sets rate limit overrides from "<key>.limit" and "<key>.window"
+// keys, e.g. subscribed under "ratelimits" for "ratelimits.org:acme.limit".
+// Overrides it set are removed when their keys disappear; overrides set
+// through the admin API are left alone.
+func RateLimits(limiter *middleware.OverrideRateLimiter) Subscriber {
+	applied := make(map[string]bool)
+
+	return func(ctx context.Context, values Values) error {
+		overrides := make(map[string]*middleware.RateLimitOverride)
+		var errs []error
+		for key := range values {
+			index := strings.LastIndex(key, ".")
+			if index <= 0 {
+				errs = append(errs, fmt.Errorf("%s: expected <key>.limit or <key>.window", key))
+				continue
+			}
+			name, field := key[:index], key[index+1:]
+			override, ok := overrides[name]
+			if !ok {
+				override = &middleware.RateLimitOverride{}
+				overrides[name] = override
+			}
+
+			var err error
+			switch field {
+			case "limit":
+				override.Limit, err = values.Int(key, 0)
+			case "window":
+				override.Window, err = values.Duration(key, 0)
+			default:
+				err = fmt.Errorf("%s: unknown rate limit setting %s", key, field)
+			}
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		current := limiter.Overrides()
+		for name, override := range overrides {
+			if _, ok := values[name+".limit"]; !ok {
+				errs = append(errs, fmt.Errorf("%s.limit: required, 0 exempts the key", name))
+				continue
+			}
+			// Unchanged overrides keep their counts
+			if existing, ok := current[name]; ok && existing == *override {
+				applied[name] = true
+				continue
+			}
+			if err := limiter.SetOverride(name, *override); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				continue
+			}
+			applied[name] = true
+		}
+		for name := range applied {
+			if _, ok := overrides[name]; !ok {
+				limiter.RemoveOverride(name)
+				delete(applied, name)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// Breakers sets circuit breaker thresholds from "<name>.max_failures",
+// "<name>.timeout" and "<name>.reset_timeout" keys, e.g. subscribed under
+// "breakers" for "breakers.users-service.max_failures". A breaker whose keys
+// disappear returns to the configuration it had when Breakers was called.
+func Breakers(breakers map[string]*middleware.CircuitBreaker) Subscriber {
+	initial := make(map[string]middleware.CircuitBreakerConfig, len(breakers))
+	for name, breaker := range breakers {
+		initial[name] = breaker.Config()
+	}
+
+	return func(ctx context.Context, values Values) error {
+		var errs []error
+		for key := range values {
+			name, _, _ := strings.Cut(key, ".")
+			if _, ok := breakers[name]; !ok {
+				errs = append(errs, fmt.Errorf("%s: unknown circuit breaker", key))
+			}
+		}
+
+		names := make([]string, 0, len(breakers))
+		for name := range breakers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			settings := values.Sub(name)
+			config := initial[name]
+
+			var err error
+			if config.MaxFailures, err = settings.Int("max_failures", config.MaxFailures); err != nil {
+				errs = append(errs, fmt.Errorf("%s.%w", name, err))
+			}
+			if config.Timeout, err = settings.Duration("timeout", config.Timeout); err != nil {
+				errs = append(errs, fmt.Errorf("%s.%w", name, err))
+			}
+			if config.ResetTimeout, err = settings.Duration("reset_timeout", config.ResetTimeout); err != nil {
+				errs = append(errs, fmt.Errorf("%s.%w", name, err))
+			}
+			if config.MaxFailures < 1 {
+				errs = append(errs, fmt.Errorf("%s.max_failures: must be at least 1", name))
+				continue
+			}
+
+			if config != breakers[name].Config() {
+				breakers[name].SetConfig(&config)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
@@ -0,0 +1,94 @@
+package reload
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogLevel(t *testing.T) {
+	level := new(slog.LevelVar)
+	apply := LogLevel(level)
+
+	require.NoError(t, apply(context.Background(), Values{"level": "debug"}))
+	assert.Equal(t, slog.LevelDebug, level.Level())
+
+	require.NoError(t, apply(context.Background(), Values{}))
+	assert.Equal(t, slog.LevelDebug, level.Level())
+
+	assert.Error(t, apply(context.Background(), Values{"level": "loud"}))
+	assert.Equal(t, slog.LevelDebug, level.Level())
+}
+
+func TestFeatureFlags(t *testing.T) {
+	flags := middleware.NewFeatureFlags(map[string]bool{"new_checkout": false, "beta": true})
+	apply := FeatureFlags(flags)
+
+	require.NoError(t, apply(context.Background(), Values{"new_checkout": "true"}))
+	assert.True(t, flags.Enabled("new_checkout"))
+	assert.True(t, flags.Enabled("beta"))
+
+	err := apply(context.Background(), Values{"beta": "false", "unknown": "true", "new_checkout": "maybe"})
+	assert.ErrorContains(t, err, "unknown: unknown feature flag")
+	assert.ErrorContains(t, err, "new_checkout: invalid boolean")
+	assert.False(t, flags.Enabled("beta"))
+	assert.False(t, flags.Has("unknown"))
+}
+
+func TestRateLimits(t *testing.T) {
+	limiter := middleware.NewOverrideRateLimiter(middleware.NewMemoryRateLimiter(nil))
+	require.NoError(t, limiter.SetOverride("admin-set", middleware.RateLimitOverride{}))
+	apply := RateLimits(limiter)
+
+	require.NoError(t, apply(context.Background(), Values{
+		"org:acme.limit":  "500",
+		"org:acme.window": "1m",
+		"internal.limit":  "0",
+	}))
+	assert.Equal(t, map[string]middleware.RateLimitOverride{
+		"admin-set": {},
+		"org:acme":  {Limit: 500, Window: time.Minute},
+		"internal":  {},
+	}, limiter.Overrides())
+
+	// Overrides whose keys disappear are removed, other overrides are kept
+	require.NoError(t, apply(context.Background(), Values{"internal.limit": "0"}))
+	assert.Equal(t, map[string]middleware.RateLimitOverride{
+		"admin-set": {},
+		"internal":  {},
+	}, limiter.Overrides())
+
+	err := apply(context.Background(), Values{"org:acme.window": "1m", "internal.limit": "0"})
+	assert.ErrorContains(t, err, "org:acme.limit: required")
+
+	err = apply(context.Background(), Values{"internal.burst": "5", "internal.limit": "0"})
+	assert.ErrorContains(t, err, "unknown rate limit setting burst")
+}
+
+func TestBreakers(t *testing.T) {
+	users := middleware.NewCircuitBreaker(&middleware.CircuitBreakerConfig{MaxFailures: 5, Timeout: time.Second, ResetTimeout: time.Minute})
+	apply := Breakers(map[string]*middleware.CircuitBreaker{"users-service": users})
+
+	require.NoError(t, apply(context.Background(), Values{
+		"users-service.max_failures":  "10",
+		"users-service.reset_timeout": "30s",
+	}))
+	assert.Equal(t, 10, users.Config().MaxFailures)
+	assert.Equal(t, 30*time.Second, users.Config().ResetTimeout)
+	assert.Equal(t, time.Second, users.Config().Timeout)
+
+	// Without keys the breaker returns to its original configuration
+	require.NoError(t, apply(context.Background(), Values{}))
+	assert.Equal(t, 5, users.Config().MaxFailures)
+	assert.Equal(t, time.Minute, users.Config().ResetTimeout)
+
+	err := apply(context.Background(), Values{"orders-service.max_failures": "3", "users-service.max_failures": "0"})
+	assert.ErrorContains(t, err, "orders-service.max_failures: unknown circuit breaker")
+	assert.ErrorContains(t, err, "users-service.max_failures: must be at least 1")
+	assert.Equal(t, 5, users.Config().MaxFailures)
+}
@@ -0,0 +1,181 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+)
+
+// CaptureConfig holds the configuration for request capture
+type CaptureConfig struct {
+	// SampleRate is the fraction of requests captured, from 0 to 1
+	SampleRate float64 `json:"sample_rate"`
+
+	// MaxBodyBytes skips requests with larger bodies, since a truncated
+	// body can't be replayed
+	MaxBodyBytes int64 `json:"max_body_bytes"`
+
+	// SkipPaths are path prefixes never captured, e.g. health checks
+	SkipPaths []string `json:"skip_paths"`
+
+	// RedactHeaders are left out of captures; nil uses DefaultRedactHeaders
+	RedactHeaders []string `json:"redact_headers"`
+
+	// RedactFields are JSON body fields masked in captures; nil uses
+	// DefaultRedactFields
+	RedactFields []string `json:"redact_fields"`
+
+	Logger *slog.Logger `json:"-"` // nil uses slog.Default
+	Clock  clock.Clock  `json:"-"` // nil uses the system clock
+}
+
+// DefaultCaptureConfig returns a configuration that captures 1% of
+// requests with bodies up to 64 KiB, skipping health checks and metrics
+func DefaultCaptureConfig() *CaptureConfig {
+	return &CaptureConfig{
+		SampleRate:   0.01,
+		MaxBodyBytes: 64 << 10,
+		SkipPaths:    []string{"/health", "/metrics"},
+	}
+}
+
+// Capturer samples requests and saves sanitized copies to a store
+type Capturer struct {
+	store     Store
+	config    *CaptureConfig
+	sanitizer *sanitizer
+	clock     clock.Clock
+	logger    *slog.Logger
+	sample    func() bool
+}
+
+// NewCapturer creates a capturer that saves to store
+func NewCapturer(store Store, config *CaptureConfig) *Capturer {
+	if config == nil {
+		config = DefaultCaptureConfig()
+	}
+	headers := config.RedactHeaders
+	if headers == nil {
+		headers = DefaultRedactHeaders
+	}
+	fields := config.RedactFields
+	if fields == nil {
+		fields = DefaultRedactFields
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &Capturer{
+		store:     store,
+		config:    config,
+		sanitizer: newSanitizer(headers, fields),
+		clock:     clock.OrReal(config.Clock),
+		logger:    logger,
+		sample:    func() bool { return rand.Float64() < config.SampleRate },
+	}
+}
+
+// begin reads the body of a request picked for capture and returns the
+// capture without its outcome, or nil for requests that aren't captured
+func (cp *Capturer) begin(r *http.Request) *Request {
+	if r.Header.Get(ReplayHeader) != "" || !cp.sample() {
+		return nil
+	}
+	for _, prefix := range cp.config.SkipPaths {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return nil
+		}
+	}
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, cp.config.MaxBodyBytes+1))
+		// The handler reads what was consumed followed by the rest
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if err != nil || int64(len(body)) > cp.config.MaxBodyBytes {
+			return nil
+		}
+	}
+
+	return &Request{
+		ID:         uuid.New().String(),
+		Method:     r.Method,
+		URL:        r.URL.RequestURI(),
+		Header:     r.Header.Clone(),
+		Body:       body,
+		CapturedAt: cp.clock.Now().UTC(),
+	}
+}
+
+// finish sanitizes a capture and saves it in the background
+func (cp *Capturer) finish(ctx context.Context, request *Request, status int) {
+	request.Status = status
+	request.Duration = cp.clock.Since(request.CapturedAt)
+	request.CorrelationID = middleware.GetCorrelationID(ctx)
+	request.URL = cp.sanitizer.url(request.URL)
+	request.Header = cp.sanitizer.header(request.Header)
+	if len(request.Body) > 0 {
+		request.Body = cp.sanitizer.body(request.Body)
+	}
+
+	middleware.Go(ctx, "replay-capture", func(ctx context.Context) error {
+		if err := cp.store.Save(ctx, request); err != nil {
+			cp.logger.WarnContext(ctx, "failed to save captured request", "capture_id", request.ID, "error", err.Error())
+		}
+		return nil
+	})
+}
+
+// statusRecorder records the status a handler writes
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Middleware captures a sample of requests. Mount it inside the
+// correlation middleware so captures carry the correlation ID.
+func (cp *Capturer) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			request := cp.begin(r)
+			if request == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+			cp.finish(r.Context(), request, recorder.status)
+		})
+	}
+}
+
+// GinMiddleware creates capture middleware for Gin framework
+func (cp *Capturer) GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		request := cp.begin(c.Request)
+		c.Next()
+		if request != nil {
+			cp.finish(c.Request.Context(), request, c.Writer.Status())
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package replay
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/jarakey/jarakey-shared-middleware/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCapturer captures every request into a memory store
+func newTestCapturer() (*Capturer, *MemoryStore) {
+	store := NewMemoryStore(0)
+	config := DefaultCaptureConfig()
+	config.SampleRate = 1
+	config.MaxBodyBytes = 64
+	config.Clock = clock.NewFake(time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC))
+	return NewCapturer(store, config), store
+}
+
+// captured waits for n captures to be saved
+func captured(t *testing.T, store *MemoryStore, n int) []*Request {
+	t.Helper()
+	var requests []*Request
+	require.Eventually(t, func() bool {
+		requests, _ = store.List(context.Background(), 0)
+		return len(requests) == n
+	}, time.Second, time.Millisecond)
+	return requests
+}
+
+func TestCaptureMiddleware(t *testing.T) {
+	capturer, store := newTestCapturer()
+	handler := middleware.CorrelationMiddleware()(capturer.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, `{"code":"ABC123","password":"hunter22"}`, string(body), "the handler still reads the whole body")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	})))
+
+	r := httptest.NewRequest(http.MethodPost, "/codes/validate?lang=en", strings.NewReader(`{"code":"ABC123","password":"hunter22"}`))
+	r.Header.Set("Authorization", "Bearer abc")
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(middleware.CorrelationIDHeader, "corr-1")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	request := captured(t, store, 1)[0]
+	assert.NotEmpty(t, request.ID)
+	assert.Equal(t, http.MethodPost, request.Method)
+	assert.Equal(t, "/codes/validate?lang=en", request.URL)
+	assert.Equal(t, `{"code":"ABC123","password":"`+secrets.Placeholder+`"}`, string(request.Body))
+	assert.Empty(t, request.Header.Get("Authorization"))
+	assert.Equal(t, "application/json", request.Header.Get("Content-Type"))
+	assert.Equal(t, "corr-1", request.CorrelationID)
+	assert.Equal(t, http.StatusUnprocessableEntity, request.Status)
+	assert.Equal(t, time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC), request.CapturedAt)
+}
+
+func TestCaptureSkips(t *testing.T) {
+	capturer, store := newTestCapturer()
+	var bodies []string
+	handler := capturer.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+
+	replayed := httptest.NewRequest(http.MethodGet, "/codes", nil)
+	replayed.Header.Set(ReplayHeader, "capture-1")
+	large := strings.Repeat("x", 100)
+	for _, r := range []*http.Request{
+		replayed,
+		httptest.NewRequest(http.MethodGet, "/health/ready", nil),
+		httptest.NewRequest(http.MethodPost, "/uploads", strings.NewReader(large)),
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	assert.Equal(t, large, bodies[2], "a body too large to capture is still passed on whole")
+
+	// A request that is captured, to know the skipped ones were processed
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/codes", nil))
+	assert.Equal(t, "/codes", captured(t, store, 1)[0].URL)
+
+	capturer.config.SampleRate = 0
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/codes", nil))
+	time.Sleep(10 * time.Millisecond)
+	captured(t, store, 1)
+}
+
+func TestGinCaptureMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	capturer, store := newTestCapturer()
+	router := gin.New()
+	router.Use(capturer.GinMiddleware())
+	router.DELETE("/codes/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/codes/42", nil))
+	request := captured(t, store, 1)[0]
+	assert.Equal(t, "/codes/42", request.URL)
+	assert.Equal(t, http.StatusNoContent, request.Status)
+	assert.Empty(t, request.Body)
+}
@@ -0,0 +1,122 @@
+// Package replay captures a sample of production requests and replays them
+// against a staging environment for load and regression testing. Capture
+// middleware stores sanitized copies of sampled requests, with credentials
+// and secret-looking fields masked, and a Replayer re-issues them with
+// correlation markers so staging logs and traces can tell replays apart.
+package replay
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/secrets"
+)
+
+// ReplayHeader carries the ID of the captured request a replay re-issues.
+// Requests with it aren't captured again.
+const ReplayHeader = "X-Replay-ID"
+
+// Request is a captured request
+type Request struct {
+	ID            string        `json:"id"`
+	Method        string        `json:"method"`
+	URL           string        `json:"url"` // Path and query
+	Header        http.Header   `json:"header"`
+	Body          []byte        `json:"body,omitempty"`
+	CorrelationID string        `json:"correlation_id,omitempty"`
+	Status        int           `json:"status"` // Status of the original response
+	Duration      time.Duration `json:"duration"`
+	CapturedAt    time.Time     `json:"captured_at"`
+}
+
+// DefaultRedactHeaders are the headers left out of captured requests.
+// Replays authenticate with the replayer's own headers.
+var DefaultRedactHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"X-Api-Key",
+	"X-Challenge-Token",
+}
+
+// DefaultRedactFields are the JSON body fields masked in captured requests
+var DefaultRedactFields = []string{
+	"password",
+	"secret",
+	"token",
+	"access_token",
+	"refresh_token",
+	"api_key",
+	"otp",
+}
+
+// sanitizer masks credentials in captured requests
+type sanitizer struct {
+	headers map[string]bool
+	fields  *regexp.Regexp
+}
+
+// newSanitizer creates a sanitizer for the given headers and body fields
+func newSanitizer(headers, fields []string) *sanitizer {
+	s := &sanitizer{headers: make(map[string]bool, len(headers))}
+	for _, header := range headers {
+		s.headers[http.CanonicalHeaderKey(header)] = true
+	}
+	if len(fields) > 0 {
+		quoted := make([]string, len(fields))
+		for i, field := range fields {
+			quoted[i] = regexp.QuoteMeta(field)
+		}
+		s.fields = regexp.MustCompile(`(?i)^(` + strings.Join(quoted, "|") + `)$`)
+	}
+	return s
+}
+
+// header returns a copy of header without the redacted headers
+func (s *sanitizer) header(header http.Header) http.Header {
+	sanitized := make(http.Header, len(header))
+	for name, values := range header {
+		if !s.headers[http.CanonicalHeaderKey(name)] {
+			sanitized[name] = append([]string(nil), values...)
+		}
+	}
+	return sanitized
+}
+
+// url masks credentials in a path and query
+func (s *sanitizer) url(url string) string {
+	return secrets.Redact(url)
+}
+
+// body masks redacted fields of a JSON body and credentials anywhere in it
+func (s *sanitizer) body(body []byte) []byte {
+	var decoded interface{}
+	if s.fields != nil && json.Unmarshal(body, &decoded) == nil {
+		if masked, err := json.Marshal(s.mask(decoded)); err == nil {
+			body = masked
+		}
+	}
+	return []byte(secrets.Redact(string(body)))
+}
+
+// mask replaces the values of redacted fields in a decoded JSON value
+func (s *sanitizer) mask(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if s.fields.MatchString(key) {
+				v[key] = secrets.Placeholder
+				continue
+			}
+			v[key] = s.mask(field)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = s.mask(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,45 @@
+package replay
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/jarakey/jarakey-shared-middleware/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizerHeader(t *testing.T) {
+	s := newSanitizer(DefaultRedactHeaders, DefaultRedactFields)
+	header := http.Header{
+		"Authorization": {"Bearer abc"},
+		"Cookie":        {"session=abc"},
+		"X-Api-Key":     {"jk_live_abc"},
+		"Content-Type":  {"application/json"},
+	}
+
+	sanitized := s.header(header)
+	assert.Equal(t, http.Header{"Content-Type": {"application/json"}}, sanitized)
+	assert.Len(t, header, 4, "the original header isn't changed")
+}
+
+func TestSanitizerBody(t *testing.T) {
+	s := newSanitizer(DefaultRedactHeaders, []string{"password", "code"})
+
+	body := s.body([]byte(`{"email":"ada@example.com","Password":"hunter22","devices":[{"code":"123456"}]}`))
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &decoded))
+	assert.Equal(t, "ada@example.com", decoded["email"])
+	assert.Equal(t, secrets.Placeholder, decoded["Password"], "field names match case-insensitively")
+	assert.Equal(t, secrets.Placeholder, decoded["devices"].([]interface{})[0].(map[string]interface{})["code"], "nested fields are masked")
+
+	form := s.body([]byte("username=ada&password=hunter22"))
+	assert.Equal(t, "username=ada&password="+secrets.Placeholder, string(form), "credentials outside JSON are redacted too")
+}
+
+func TestSanitizerURL(t *testing.T) {
+	s := newSanitizer(nil, nil)
+	assert.Equal(t, "/reset?token="+secrets.Placeholder+"&lang=en", s.url("/reset?token=abc123&lang=en"))
+	assert.Equal(t, "/codes/validate", s.url("/codes/validate"))
+}
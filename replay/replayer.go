@@ -0,0 +1,176 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+)
+
+// ReplayConfig holds the configuration for a Replayer
+type ReplayConfig struct {
+	// BaseURL is the staging environment requests are sent to, e.g.
+	// "https://validation.staging.internal"
+	BaseURL string `json:"base_url"`
+
+	// Concurrency is the number of requests in flight at once
+	Concurrency int `json:"concurrency"`
+
+	// Header is added to every replayed request, e.g. staging credentials
+	// in place of the redacted ones
+	Header http.Header `json:"-"`
+
+	Client *http.Client `json:"-"` // nil uses a client with a 30 second timeout
+	Logger *slog.Logger `json:"-"` // nil uses slog.Default
+}
+
+// DefaultReplayConfig returns a configuration that replays 10 requests at
+// a time. BaseURL must be set.
+func DefaultReplayConfig() *ReplayConfig {
+	return &ReplayConfig{
+		Concurrency: 10,
+	}
+}
+
+// Mismatch is a replayed request whose status differs from the original
+type Mismatch struct {
+	ID           string `json:"id"`
+	Method       string `json:"method"`
+	URL          string `json:"url"`
+	Status       int    `json:"status"`
+	ReplayStatus int    `json:"replay_status"`
+}
+
+// Report is the outcome of a replay
+type Report struct {
+	Total      int           `json:"total"`
+	Matched    int           `json:"matched"`
+	Mismatches []Mismatch    `json:"mismatches"`
+	Errors     int           `json:"errors"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// Replayer re-issues captured requests against a staging environment.
+// Each replay carries the captured request's ID in ReplayHeader and a
+// correlation ID of "replay-" plus the original one.
+type Replayer struct {
+	config *ReplayConfig
+	base   *url.URL
+	client *http.Client
+	logger *slog.Logger
+}
+
+// NewReplayer creates a replayer
+func NewReplayer(config *ReplayConfig) (*Replayer, error) {
+	if config == nil {
+		config = DefaultReplayConfig()
+	}
+	base, err := url.Parse(strings.TrimRight(config.BaseURL, "/"))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid replay base URL %q", config.BaseURL)
+	}
+	client := config.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Replayer{config: config, base: base, client: client, logger: logger}, nil
+}
+
+// Replay re-issues requests and reports which got a different status than
+// the original. It stops early when ctx ends.
+func (r *Replayer) Replay(ctx context.Context, requests []*Request) (*Report, error) {
+	start := time.Now()
+	report := &Report{Mismatches: []Mismatch{}}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, max(r.config.Concurrency, 1))
+
+requests:
+	for _, request := range requests {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			break requests
+		case slots <- struct{}{}:
+			wg.Add(1)
+			go func(request *Request) {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+				status, err := r.send(ctx, request)
+
+				mutex.Lock()
+				defer mutex.Unlock()
+				report.Total++
+				switch {
+				case err != nil:
+					report.Errors++
+					r.logger.WarnContext(ctx, "replay failed", "capture_id", request.ID, "error", err.Error())
+				case status == request.Status:
+					report.Matched++
+				default:
+					report.Mismatches = append(report.Mismatches, Mismatch{
+						ID:           request.ID,
+						Method:       request.Method,
+						URL:          request.URL,
+						Status:       request.Status,
+						ReplayStatus: status,
+					})
+				}
+			}(request)
+		}
+	}
+	wg.Wait()
+
+	report.Duration = time.Since(start)
+	return report, ctx.Err()
+}
+
+// send re-issues one request and returns the response status
+func (r *Replayer) send(ctx context.Context, request *Request) (int, error) {
+	target, err := r.base.Parse(r.base.Path + request.URL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid captured URL %q: %w", request.URL, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, request.Method, target.String(), bytes.NewReader(request.Body))
+	if err != nil {
+		return 0, err
+	}
+	for name, values := range request.Header {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	for name, values := range r.config.Header {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	req.Header.Del("Content-Length")
+	req.Header.Del(middleware.RequestIDHeader)
+	req.Header.Set(ReplayHeader, request.ID)
+	correlationID := request.CorrelationID
+	if correlationID == "" {
+		correlationID = request.ID
+	}
+	req.Header.Set(middleware.CorrelationIDHeader, "replay-"+correlationID)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,79 @@
+package replay
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayer(t *testing.T) {
+	var mutex sync.Mutex
+	received := make(map[string]*http.Request)
+	bodies := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		received[r.Header.Get(ReplayHeader)] = r
+		bodies[r.Header.Get(ReplayHeader)] = string(body)
+		mutex.Unlock()
+		if r.URL.Path == "/staging/codes/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	replayer, err := NewReplayer(&ReplayConfig{
+		BaseURL:     server.URL + "/staging/",
+		Concurrency: 2,
+		Header:      http.Header{"Authorization": {"Bearer staging-token"}},
+	})
+	require.NoError(t, err)
+
+	report, err := replayer.Replay(context.Background(), []*Request{
+		{ID: "1", Method: http.MethodPost, URL: "/codes/validate?lang=en", Header: http.Header{"Content-Type": {"application/json"}}, Body: []byte(`{"code":"ABC123"}`), CorrelationID: "corr-1", Status: http.StatusOK},
+		{ID: "2", Method: http.MethodGet, URL: "/codes/missing", Status: http.StatusOK},
+		{ID: "3", Method: http.MethodGet, URL: "/codes/3", Status: http.StatusOK},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, report.Total)
+	assert.Equal(t, 2, report.Matched)
+	assert.Zero(t, report.Errors)
+	assert.Equal(t, []Mismatch{{ID: "2", Method: http.MethodGet, URL: "/codes/missing", Status: http.StatusOK, ReplayStatus: http.StatusNotFound}}, report.Mismatches)
+
+	first := received["1"]
+	require.NotNil(t, first)
+	assert.Equal(t, "/staging/codes/validate", first.URL.Path)
+	assert.Equal(t, "lang=en", first.URL.RawQuery)
+	assert.Equal(t, `{"code":"ABC123"}`, bodies["1"])
+	assert.Equal(t, "application/json", first.Header.Get("Content-Type"))
+	assert.Equal(t, "Bearer staging-token", first.Header.Get("Authorization"))
+	assert.Equal(t, "replay-corr-1", first.Header.Get(middleware.CorrelationIDHeader))
+	assert.Equal(t, "replay-3", received["3"].Header.Get(middleware.CorrelationIDHeader), "requests captured without a correlation ID use their capture ID")
+}
+
+func TestReplayerErrors(t *testing.T) {
+	_, err := NewReplayer(nil)
+	assert.Error(t, err, "a base URL is required")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+	replayer, err := NewReplayer(&ReplayConfig{BaseURL: server.URL})
+	require.NoError(t, err)
+	report, err := replayer.Replay(context.Background(), []*Request{{ID: "1", Method: http.MethodGet, URL: "/codes"}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Errors)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err = replayer.Replay(ctx, []*Request{{ID: "1", Method: http.MethodGet, URL: "/codes"}})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, report.Total)
+}
@@ -0,0 +1,111 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store keeps captured requests
+type Store interface {
+	// Save stores a captured request
+	Save(ctx context.Context, request *Request) error
+
+	// List returns up to limit captured requests, oldest first; zero or
+	// less returns all of them
+	List(ctx context.Context, limit int) ([]*Request, error)
+}
+
+// RedisStore keeps the most recent captured requests in a capped Redis list
+type RedisStore struct {
+	client *redis.Client
+	key    string
+	max    int64
+	ttl    time.Duration
+}
+
+// NewRedisStore creates a store that keeps the last max requests under key,
+// e.g. "replay:validation-service", expiring ttl after the last capture
+func NewRedisStore(client *redis.Client, key string, max int, ttl time.Duration) *RedisStore {
+	return &RedisStore{client: client, key: key, max: int64(max), ttl: ttl}
+}
+
+// Save adds a request, dropping the oldest beyond the cap
+func (s *RedisStore) Save(ctx context.Context, request *Request) error {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode captured request %s: %w", request.ID, err)
+	}
+	pipe := s.client.TxPipeline()
+	pipe.LPush(ctx, s.key, data)
+	pipe.LTrim(ctx, s.key, 0, s.max-1)
+	if s.ttl > 0 {
+		pipe.Expire(ctx, s.key, s.ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save captured request %s: %w", request.ID, err)
+	}
+	return nil
+}
+
+// List returns the oldest captured requests first
+func (s *RedisStore) List(ctx context.Context, limit int) ([]*Request, error) {
+	// Newest are at the head, so the oldest limit are at the tail
+	start := int64(0)
+	if limit > 0 {
+		start = int64(-limit)
+	}
+	items, err := s.client.LRange(ctx, s.key, start, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list captured requests: %w", err)
+	}
+
+	requests := make([]*Request, 0, len(items))
+	for i := len(items) - 1; i >= 0; i-- {
+		var request Request
+		if err := json.Unmarshal([]byte(items[i]), &request); err != nil {
+			return nil, fmt.Errorf("failed to decode captured request: %w", err)
+		}
+		requests = append(requests, &request)
+	}
+	return requests, nil
+}
+
+// MemoryStore keeps captured requests in memory, for tests and one-off
+// captures
+type MemoryStore struct {
+	requests []*Request
+	max      int
+	mutex    sync.Mutex
+}
+
+// NewMemoryStore creates a store that keeps the last max requests
+func NewMemoryStore(max int) *MemoryStore {
+	return &MemoryStore{max: max}
+}
+
+// Save adds a request, dropping the oldest beyond the cap
+func (s *MemoryStore) Save(ctx context.Context, request *Request) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.requests = append(s.requests, request)
+	if s.max > 0 && len(s.requests) > s.max {
+		s.requests = s.requests[len(s.requests)-s.max:]
+	}
+	return nil
+}
+
+// List returns the oldest captured requests first
+func (s *MemoryStore) List(ctx context.Context, limit int) ([]*Request, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	requests := s.requests
+	if limit > 0 && len(requests) > limit {
+		requests = requests[:limit]
+	}
+	return append([]*Request(nil), requests...), nil
+}
@@ -0,0 +1,46 @@
+package replay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStore checks that store keeps the last 3 requests, oldest first
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	for _, id := range []string{"1", "2", "3", "4"} {
+		require.NoError(t, store.Save(ctx, &Request{ID: id, Method: "POST", URL: "/codes/validate", Body: []byte(`{"code":"X"}`)}))
+	}
+
+	requests, err := store.List(ctx, 0)
+	require.NoError(t, err)
+	ids := make([]string, len(requests))
+	for i, request := range requests {
+		ids[i] = request.ID
+	}
+	assert.Equal(t, []string{"2", "3", "4"}, ids)
+	assert.Equal(t, `{"code":"X"}`, string(requests[0].Body))
+
+	requests, err = store.List(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, requests, 2)
+	assert.Equal(t, "2", requests[0].ID)
+	assert.Equal(t, "3", requests[1].ID)
+}
+
+func TestRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "replay:codes", 3, time.Hour)
+	testStore(t, store)
+	assert.Equal(t, time.Hour, server.TTL("replay:codes"))
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore(3))
+}
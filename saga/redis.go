@@ -0,0 +1,110 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps saga state in Redis so any instance can resume a run.
+// Finished runs expire after a retention period; unfinished ones are kept
+// until they finish.
+type RedisStore struct {
+	client    *redis.Client
+	prefix    string
+	retention time.Duration
+}
+
+// NewRedisStore creates a Redis saga store. A zero retention keeps finished
+// runs for 7 days.
+func NewRedisStore(client *redis.Client, retention time.Duration) *RedisStore {
+	if retention <= 0 {
+		retention = 7 * 24 * time.Hour
+	}
+	return &RedisStore{
+		client:    client,
+		prefix:    "saga",
+		retention: retention,
+	}
+}
+
+// stateKey returns the key of a run's state
+func (s *RedisStore) stateKey(id string) string {
+	return s.prefix + ":state:" + id
+}
+
+// incompleteKey returns the key of the set of a saga's unfinished runs
+func (s *RedisStore) incompleteKey(saga string) string {
+	return s.prefix + ":incomplete:" + saga
+}
+
+// Save stores the state and tracks whether the run is unfinished
+func (s *RedisStore) Save(ctx context.Context, state *State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode saga %s: %w", state.ID, err)
+	}
+
+	pipe := s.client.TxPipeline()
+	if state.Status.Terminal() {
+		pipe.Set(ctx, s.stateKey(state.ID), data, s.retention)
+		pipe.SRem(ctx, s.incompleteKey(state.Saga), state.ID)
+	} else {
+		pipe.Set(ctx, s.stateKey(state.ID), data, 0)
+		pipe.SAdd(ctx, s.incompleteKey(state.Saga), state.ID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save saga %s: %w", state.ID, err)
+	}
+	return nil
+}
+
+// Load returns the stored state of a run
+func (s *RedisStore) Load(ctx context.Context, id string) (*State, error) {
+	data, err := s.client.Get(ctx, s.stateKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load saga %s: %w", id, err)
+	}
+	return decodeState(data)
+}
+
+// Incomplete returns the saga's unfinished runs
+func (s *RedisStore) Incomplete(ctx context.Context, saga string) ([]*State, error) {
+	ids, err := s.client.SMembers(ctx, s.incompleteKey(saga)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unfinished %s sagas: %w", saga, err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.stateKey(id)
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load unfinished %s sagas: %w", saga, err)
+	}
+
+	var states []*State
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		state, err := decodeState([]byte(data))
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
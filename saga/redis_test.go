@@ -0,0 +1,60 @@
+package saga
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), time.Hour)
+
+	_, err := store.Load(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	state := &State{ID: "run-1", Saga: "issue_code", Status: StatusRunning, Completed: 1}
+	require.NoError(t, state.Set("code", "ABC123"))
+	require.NoError(t, store.Save(ctx, state))
+
+	loaded, err := store.Load(ctx, "run-1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, loaded.Completed)
+	var code string
+	_, err = loaded.Get("code", &code)
+	require.NoError(t, err)
+	assert.Equal(t, "ABC123", code)
+
+	assert.Zero(t, server.TTL("saga:state:run-1"), "unfinished runs don't expire")
+	incomplete, err := store.Incomplete(ctx, "issue_code")
+	require.NoError(t, err)
+	require.Len(t, incomplete, 1)
+
+	state.Status = StatusCompleted
+	require.NoError(t, store.Save(ctx, state))
+
+	assert.Equal(t, time.Hour, server.TTL("saga:state:run-1"))
+	incomplete, err = store.Incomplete(ctx, "issue_code")
+	require.NoError(t, err)
+	assert.Empty(t, incomplete)
+}
+
+func TestRedisStoreRunsSaga(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), 0)
+	calls := &recorder{}
+
+	saga, err := New("issue_code", testConfig(store), calls.step("generate", nil), calls.step("notify", nil))
+	require.NoError(t, err)
+
+	state, err := saga.Start(context.Background(), "run-1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompleted, state.Status)
+	assert.Equal(t, 7*24*time.Hour, server.TTL("saga:state:run-1"))
+}
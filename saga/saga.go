@@ -0,0 +1,351 @@
+// Package saga runs multi-step operations such as generate code → notify →
+// audit so that a failure part way through doesn't leave them half done.
+// Each step may have a compensation; when a step fails for good, the
+// compensations of the steps before it run in reverse order. State is saved
+// after every step, so a run interrupted by a crash or deploy can be resumed
+// by any instance.
+//
+// A step can run more than once: it is retried under the saga's retry policy,
+// and a step that succeeded just before a crash runs again on resume. Actions
+// and compensations must therefore be idempotent.
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+)
+
+// Step phases in metrics and logs
+const (
+	phaseAction     = "action"
+	phaseCompensate = "compensate"
+)
+
+// Step is one step of a saga
+type Step struct {
+	Name   string
+	Action func(ctx context.Context, state *State) error
+
+	// Compensate undoes the action; nil when there is nothing to undo
+	Compensate func(ctx context.Context, state *State) error
+}
+
+// Config holds the configuration shared by a saga's runs
+type Config struct {
+	Store Store                   `json:"-"`               // nil uses a MemoryStore
+	Retry *middleware.RetryConfig `json:"retry,omitempty"` // nil runs each step once
+
+	Logger  *slog.Logger                `json:"-"` // nil uses slog.Default
+	Metrics *middleware.MetricsRegistry `json:"-"` // nil disables metrics
+}
+
+// DefaultConfig returns an in-memory configuration with the default retry policy
+func DefaultConfig() *Config {
+	return &Config{
+		Retry: middleware.DefaultRetryConfig(),
+	}
+}
+
+// Error is returned when a saga run fails. Err is the step's error; when
+// CompensationErr is also set the run is StatusFailed and needs repair by hand.
+type Error struct {
+	Saga            string
+	ID              string
+	Step            string
+	Err             error
+	CompensationErr error
+}
+
+func (e *Error) Error() string {
+	if e.CompensationErr != nil {
+		return fmt.Sprintf("saga %s %s: step %s failed: %v; compensation failed: %v", e.Saga, e.ID, e.Step, e.Err, e.CompensationErr)
+	}
+	return fmt.Sprintf("saga %s %s: step %s failed: %v", e.Saga, e.ID, e.Step, e.Err)
+}
+
+// Unwrap returns the step's error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Saga is a named sequence of steps
+type Saga struct {
+	name    string
+	steps   []Step
+	store   Store
+	retry   *middleware.RetryConfig
+	logger  *slog.Logger
+	metrics *middleware.MetricsRegistry
+}
+
+// New creates a saga. Step names must be unique and every step needs an action.
+func New(name string, config *Config, steps ...Step) (*Saga, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("saga %s: at least one step is required", name)
+	}
+
+	names := make(map[string]bool, len(steps))
+	for _, step := range steps {
+		if step.Name == "" || step.Action == nil {
+			return nil, fmt.Errorf("saga %s: every step needs a name and an action", name)
+		}
+		if names[step.Name] {
+			return nil, fmt.Errorf("saga %s: duplicate step %s", name, step.Name)
+		}
+		names[step.Name] = true
+	}
+
+	store := config.Store
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &Saga{
+		name:    name,
+		steps:   steps,
+		store:   store,
+		retry:   config.Retry,
+		logger:  logger,
+		metrics: config.Metrics,
+	}, nil
+}
+
+// Name returns the saga's name
+func (s *Saga) Name() string {
+	return s.name
+}
+
+// Start runs the saga with the given input values. An empty id generates
+// one. Starting an id that is already stored resumes that run instead, so a
+// retried request doesn't run the saga twice.
+func (s *Saga) Start(ctx context.Context, id string, values map[string]interface{}) (*State, error) {
+	if id == "" {
+		id = uuid.New().String()
+	}
+
+	existing, err := s.store.Load(ctx, id)
+	switch {
+	case err == nil:
+		return s.execute(ctx, existing)
+	case !errors.Is(err, ErrNotFound):
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	state := &State{
+		ID:        id,
+		Saga:      s.name,
+		Status:    StatusRunning,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for key, value := range values {
+		if err := state.Set(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.store.Save(ctx, state); err != nil {
+		return nil, err
+	}
+	return s.execute(ctx, state)
+}
+
+// Resume continues a stored run from where it stopped
+func (s *Saga) Resume(ctx context.Context, id string) (*State, error) {
+	state, err := s.store.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.execute(ctx, state)
+}
+
+// ResumeIncomplete resumes every unfinished run of the saga, e.g. at startup.
+// Run it on one instance at a time so a run isn't resumed twice concurrently.
+func (s *Saga) ResumeIncomplete(ctx context.Context) error {
+	states, err := s.store.Incomplete(ctx, s.name)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, state := range states {
+		if _, err := s.execute(ctx, state); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// execute moves a run forward or through its compensations
+func (s *Saga) execute(ctx context.Context, state *State) (*State, error) {
+	if state.Saga != s.name {
+		return state, fmt.Errorf("saga %s: run %s belongs to saga %s", s.name, state.ID, state.Saga)
+	}
+
+	switch state.Status {
+	case StatusRunning:
+		return s.forward(ctx, state)
+	case StatusCompensating:
+		return s.compensate(ctx, state, errors.New(state.Error))
+	case StatusCompleted:
+		return state, nil
+	default:
+		return state, s.runError(state)
+	}
+}
+
+// forward runs the remaining steps, compensating when one fails. A step
+// interrupted by ctx ending leaves the run to be resumed.
+func (s *Saga) forward(ctx context.Context, state *State) (*State, error) {
+	for state.Completed < len(s.steps) {
+		step := s.steps[state.Completed]
+
+		if err := s.runStep(ctx, state, step, phaseAction, step.Action); err != nil {
+			if ctx.Err() != nil {
+				return state, err
+			}
+
+			state.Status = StatusCompensating
+			state.FailedStep = step.Name
+			state.Error = err.Error()
+			if err := s.save(ctx, state); err != nil {
+				return state, err
+			}
+			return s.compensate(ctx, state, err)
+		}
+
+		state.Completed++
+		if err := s.save(ctx, state); err != nil {
+			return state, err
+		}
+	}
+
+	state.Status = StatusCompleted
+	if err := s.save(ctx, state); err != nil {
+		return state, err
+	}
+	s.recordRun(state)
+	return state, nil
+}
+
+// compensate undoes the completed steps in reverse order. A compensation
+// that fails for good leaves the run failed.
+func (s *Saga) compensate(ctx context.Context, state *State, cause error) (*State, error) {
+	for state.Completed > 0 {
+		step := s.steps[state.Completed-1]
+
+		if step.Compensate != nil {
+			if err := s.runStep(ctx, state, step, phaseCompensate, step.Compensate); err != nil {
+				if ctx.Err() != nil {
+					return state, err
+				}
+
+				state.Status = StatusFailed
+				state.CompensationError = fmt.Sprintf("%s: %v", step.Name, err)
+				if err := s.save(ctx, state); err != nil {
+					return state, err
+				}
+				s.recordRun(state)
+				s.logger.ErrorContext(ctx, "saga compensation failed", s.attrs(ctx, state, "step", step.Name, "error", err.Error())...)
+				return state, &Error{Saga: s.name, ID: state.ID, Step: state.FailedStep, Err: cause, CompensationErr: err}
+			}
+		}
+
+		state.Completed--
+		if err := s.save(ctx, state); err != nil {
+			return state, err
+		}
+	}
+
+	state.Status = StatusCompensated
+	if err := s.save(ctx, state); err != nil {
+		return state, err
+	}
+	s.recordRun(state)
+	return state, &Error{Saga: s.name, ID: state.ID, Step: state.FailedStep, Err: cause}
+}
+
+// runStep runs an action or compensation under the retry policy
+func (s *Saga) runStep(ctx context.Context, state *State, step Step, phase string, fn func(ctx context.Context, state *State) error) error {
+	start := time.Now()
+
+	var err error
+	if s.retry == nil {
+		err = fn(ctx, state)
+	} else {
+		// Every failure is retried, whatever statuses the policy lists
+		policy := *s.retry
+		policy.RetryableErrors = []int{http.StatusServiceUnavailable}
+
+		var lastErr error
+		err = policy.Retry(ctx, func() error {
+			lastErr = fn(ctx, state)
+			if lastErr != nil {
+				return &middleware.RetryableError{StatusCode: http.StatusServiceUnavailable, Message: lastErr.Error()}
+			}
+			return nil
+		})
+		if lastErr != nil {
+			err = lastErr
+		}
+	}
+
+	status := "success"
+	if err != nil {
+		status = "error"
+		s.logger.WarnContext(ctx, "saga step failed", s.attrs(ctx, state, "step", step.Name, "phase", phase, "error", err.Error())...)
+	}
+	if s.metrics != nil {
+		s.metrics.RecordSagaStep(s.name, step.Name, phase, status, time.Since(start))
+	}
+	return err
+}
+
+// save stores the state
+func (s *Saga) save(ctx context.Context, state *State) error {
+	state.UpdatedAt = time.Now().UTC()
+	if err := s.store.Save(ctx, state); err != nil {
+		return fmt.Errorf("saga %s %s: %w", s.name, state.ID, err)
+	}
+	return nil
+}
+
+// runError rebuilds the error of a run that already finished unsuccessfully
+func (s *Saga) runError(state *State) error {
+	err := &Error{Saga: s.name, ID: state.ID, Step: state.FailedStep, Err: errors.New(state.Error)}
+	if state.CompensationError != "" {
+		err.CompensationErr = errors.New(state.CompensationError)
+	}
+	return err
+}
+
+// recordRun records a finished run in the metrics
+func (s *Saga) recordRun(state *State) {
+	if s.metrics != nil {
+		s.metrics.RecordSagaRun(s.name, string(state.Status))
+	}
+}
+
+// attrs returns the log attributes of a run
+func (s *Saga) attrs(ctx context.Context, state *State, extra ...interface{}) []interface{} {
+	return append([]interface{}{
+		"saga", s.name,
+		"saga_id", state.ID,
+		"correlation_id", middleware.GetCorrelationID(ctx),
+		"request_id", middleware.GetRequestID(ctx),
+	}, extra...)
+}
@@ -0,0 +1,234 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder logs the order steps and compensations run in
+type recorder struct {
+	calls []string
+}
+
+// step returns a step that records its calls and fails its action with err
+func (r *recorder) step(name string, err error) Step {
+	return Step{
+		Name: name,
+		Action: func(ctx context.Context, state *State) error {
+			r.calls = append(r.calls, name)
+			return err
+		},
+		Compensate: func(ctx context.Context, state *State) error {
+			r.calls = append(r.calls, "undo "+name)
+			return nil
+		},
+	}
+}
+
+// testConfig retries quickly
+func testConfig(store Store) *Config {
+	return &Config{
+		Store:   store,
+		Retry:   &middleware.RetryConfig{MaxAttempts: 2, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffFactor: 1},
+		Metrics: middleware.NewMetricsRegistry("saga-test"),
+	}
+}
+
+func TestSagaCompletes(t *testing.T) {
+	calls := &recorder{}
+	generate := Step{
+		Name: "generate",
+		Action: func(ctx context.Context, state *State) error {
+			calls.calls = append(calls.calls, "generate")
+			return state.Set("code", "ABC123")
+		},
+	}
+	notify := Step{
+		Name: "notify",
+		Action: func(ctx context.Context, state *State) error {
+			var code, email string
+			if _, err := state.Get("code", &code); err != nil {
+				return err
+			}
+			if _, err := state.Get("email", &email); err != nil {
+				return err
+			}
+			calls.calls = append(calls.calls, "notify "+email+" "+code)
+			return nil
+		},
+	}
+
+	saga, err := New("issue_code", testConfig(nil), generate, notify, calls.step("audit", nil))
+	require.NoError(t, err)
+
+	state, err := saga.Start(context.Background(), "run-1", map[string]interface{}{"email": "guest@example.com"})
+	require.NoError(t, err)
+
+	assert.Equal(t, StatusCompleted, state.Status)
+	assert.Equal(t, 3, state.Completed)
+	assert.Equal(t, []string{"generate", "notify guest@example.com ABC123", "audit"}, calls.calls)
+}
+
+func TestSagaCompensatesInReverse(t *testing.T) {
+	calls := &recorder{}
+	failure := errors.New("smtp unavailable")
+
+	store := NewMemoryStore()
+	saga, err := New("issue_code", testConfig(store),
+		calls.step("generate", nil),
+		calls.step("reserve", nil),
+		calls.step("notify", failure),
+		calls.step("audit", nil),
+	)
+	require.NoError(t, err)
+
+	state, err := saga.Start(context.Background(), "run-1", nil)
+
+	var sagaErr *Error
+	require.ErrorAs(t, err, &sagaErr)
+	assert.Equal(t, "notify", sagaErr.Step)
+	assert.ErrorIs(t, err, failure)
+	assert.Nil(t, sagaErr.CompensationErr)
+
+	assert.Equal(t, StatusCompensated, state.Status)
+	assert.Equal(t, 0, state.Completed)
+	assert.Equal(t, []string{"generate", "reserve", "notify", "notify", "undo reserve", "undo generate"}, calls.calls)
+
+	stored, err := store.Load(context.Background(), "run-1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompensated, stored.Status)
+	assert.Equal(t, "notify", stored.FailedStep)
+}
+
+func TestSagaCompensationFailure(t *testing.T) {
+	calls := &recorder{}
+	generate := calls.step("generate", nil)
+	generate.Compensate = func(ctx context.Context, state *State) error {
+		return errors.New("code already used")
+	}
+
+	saga, err := New("issue_code", testConfig(nil), generate, calls.step("notify", errors.New("smtp unavailable")))
+	require.NoError(t, err)
+
+	state, err := saga.Start(context.Background(), "run-1", nil)
+
+	var sagaErr *Error
+	require.ErrorAs(t, err, &sagaErr)
+	assert.ErrorContains(t, sagaErr.CompensationErr, "code already used")
+	assert.Equal(t, StatusFailed, state.Status)
+	assert.Equal(t, 1, state.Completed, "the step that couldn't be undone is still completed")
+
+	// Starting it again reports the same failure without running anything
+	calls.calls = nil
+	_, err = saga.Start(context.Background(), "run-1", nil)
+	require.ErrorAs(t, err, &sagaErr)
+	assert.NotNil(t, sagaErr.CompensationErr)
+	assert.Empty(t, calls.calls)
+}
+
+func TestSagaRetriesSteps(t *testing.T) {
+	attempts := 0
+	flaky := Step{
+		Name: "notify",
+		Action: func(ctx context.Context, state *State) error {
+			attempts++
+			if attempts == 1 {
+				return errors.New("timeout")
+			}
+			return nil
+		},
+	}
+
+	saga, err := New("issue_code", testConfig(nil), flaky)
+	require.NoError(t, err)
+
+	state, err := saga.Start(context.Background(), "", nil)
+	require.NoError(t, err)
+	assert.NotEmpty(t, state.ID)
+	assert.Equal(t, StatusCompleted, state.Status)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestSagaResumesInterruptedRuns(t *testing.T) {
+	calls := &recorder{}
+	store := NewMemoryStore()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := Step{
+		Name: "notify",
+		Action: func(stepCtx context.Context, state *State) error {
+			calls.calls = append(calls.calls, "notify")
+			if len(calls.calls) == 2 {
+				cancel()
+				return stepCtx.Err()
+			}
+			return nil
+		},
+	}
+
+	saga, err := New("issue_code", testConfig(store), calls.step("generate", nil), interrupt, calls.step("audit", nil))
+	require.NoError(t, err)
+
+	state, err := saga.Start(ctx, "run-1", nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, StatusRunning, state.Status, "an interrupted run isn't compensated")
+
+	incomplete, err := store.Incomplete(context.Background(), "issue_code")
+	require.NoError(t, err)
+	require.Len(t, incomplete, 1)
+
+	require.NoError(t, saga.ResumeIncomplete(context.Background()))
+	assert.Equal(t, []string{"generate", "notify", "notify", "audit"}, calls.calls)
+
+	state, err = saga.Resume(context.Background(), "run-1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompleted, state.Status)
+}
+
+func TestSagaStartIsIdempotent(t *testing.T) {
+	calls := &recorder{}
+	saga, err := New("issue_code", testConfig(nil), calls.step("generate", nil))
+	require.NoError(t, err)
+
+	_, err = saga.Start(context.Background(), "run-1", nil)
+	require.NoError(t, err)
+	_, err = saga.Start(context.Background(), "run-1", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"generate"}, calls.calls)
+}
+
+func TestNewValidatesSteps(t *testing.T) {
+	calls := &recorder{}
+
+	_, err := New("empty", nil)
+	assert.Error(t, err)
+
+	_, err = New("unnamed", nil, Step{Action: calls.step("x", nil).Action})
+	assert.Error(t, err)
+
+	_, err = New("duplicate", nil, calls.step("generate", nil), calls.step("generate", nil))
+	assert.ErrorContains(t, err, "duplicate step generate")
+}
+
+func TestSagaRejectsOtherSagasRuns(t *testing.T) {
+	store := NewMemoryStore()
+	calls := &recorder{}
+
+	issue, err := New("issue_code", testConfig(store), calls.step("generate", nil))
+	require.NoError(t, err)
+	revoke, err := New("revoke_code", testConfig(store), calls.step("revoke", nil))
+	require.NoError(t, err)
+
+	_, err = issue.Start(context.Background(), "run-1", nil)
+	require.NoError(t, err)
+
+	_, err = revoke.Resume(context.Background(), "run-1")
+	assert.ErrorContains(t, err, "belongs to saga issue_code")
+}
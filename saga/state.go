@@ -0,0 +1,147 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when loading a saga that isn't stored
+var ErrNotFound = errors.New("saga not found")
+
+// Status is the progress of a saga run
+type Status string
+
+const (
+	StatusRunning      Status = "running"
+	StatusCompleted    Status = "completed"
+	StatusCompensating Status = "compensating"
+	StatusCompensated  Status = "compensated" // A step failed and earlier steps were undone
+	StatusFailed       Status = "failed"      // A compensation failed; needs manual repair
+)
+
+// Terminal reports whether a saga in this status will make no further progress
+func (s Status) Terminal() bool {
+	return s == StatusCompleted || s == StatusCompensated || s == StatusFailed
+}
+
+// State is the persisted state of one saga run. Steps pass values to later
+// steps and to compensations through Data, so a run can be resumed by
+// another instance after a crash.
+type State struct {
+	ID     string `json:"id"`
+	Saga   string `json:"saga"`
+	Status Status `json:"status"`
+
+	// Completed is the number of steps whose action succeeded and haven't
+	// been compensated
+	Completed int `json:"completed"`
+
+	FailedStep        string `json:"failed_step,omitempty"`
+	Error             string `json:"error,omitempty"`
+	CompensationError string `json:"compensation_error,omitempty"`
+
+	Data      map[string]json.RawMessage `json:"data"`
+	CreatedAt time.Time                  `json:"created_at"`
+	UpdatedAt time.Time                  `json:"updated_at"`
+}
+
+// Set stores a value for later steps, encoded as JSON
+func (s *State) Set(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode saga value %q: %w", key, err)
+	}
+	if s.Data == nil {
+		s.Data = make(map[string]json.RawMessage)
+	}
+	s.Data[key] = data
+	return nil
+}
+
+// Get decodes a stored value into v and reports whether it was set
+func (s *State) Get(key string, v interface{}) (bool, error) {
+	data, ok := s.Data[key]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return true, fmt.Errorf("failed to decode saga value %q: %w", key, err)
+	}
+	return true, nil
+}
+
+// Store persists saga state
+type Store interface {
+	Save(ctx context.Context, state *State) error
+	Load(ctx context.Context, id string) (*State, error)
+
+	// Incomplete returns the runs of a saga that haven't reached a terminal status
+	Incomplete(ctx context.Context, saga string) ([]*State, error)
+}
+
+// MemoryStore keeps saga state in memory, for tests and single-instance tools
+type MemoryStore struct {
+	states map[string][]byte
+	mutex  sync.Mutex
+}
+
+// NewMemoryStore creates an in-memory saga store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: make(map[string][]byte)}
+}
+
+// Save stores a copy of the state
+func (s *MemoryStore) Save(ctx context.Context, state *State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode saga %s: %w", state.ID, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.states[state.ID] = data
+	return nil
+}
+
+// Load returns a copy of the stored state
+func (s *MemoryStore) Load(ctx context.Context, id string) (*State, error) {
+	s.mutex.Lock()
+	data, ok := s.states[id]
+	s.mutex.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return decodeState(data)
+}
+
+// Incomplete returns the saga's runs that haven't finished
+func (s *MemoryStore) Incomplete(ctx context.Context, saga string) ([]*State, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var states []*State
+	for _, data := range s.states {
+		state, err := decodeState(data)
+		if err != nil {
+			return nil, err
+		}
+		if state.Saga == saga && !state.Status.Terminal() {
+			states = append(states, state)
+		}
+	}
+	return states, nil
+}
+
+// decodeState decodes a stored state
+func decodeState(data []byte) (*State, error) {
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode saga state: %w", err)
+	}
+	return &state, nil
+}
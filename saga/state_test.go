@@ -0,0 +1,59 @@
+package saga
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateValues(t *testing.T) {
+	state := &State{}
+	require.NoError(t, state.Set("code", map[string]string{"value": "ABC123"}))
+
+	var code map[string]string
+	ok, err := state.Get("code", &code)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "ABC123", code["value"])
+
+	ok, err = state.Get("missing", &code)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	var wrongType int
+	_, err = state.Get("code", &wrongType)
+	assert.Error(t, err)
+}
+
+func TestStatusTerminal(t *testing.T) {
+	assert.False(t, StatusRunning.Terminal())
+	assert.False(t, StatusCompensating.Terminal())
+	assert.True(t, StatusCompleted.Terminal())
+	assert.True(t, StatusCompensated.Terminal())
+	assert.True(t, StatusFailed.Terminal())
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	_, err := store.Load(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	state := &State{ID: "run-1", Saga: "issue_code", Status: StatusRunning}
+	require.NoError(t, store.Save(ctx, state))
+	require.NoError(t, store.Save(ctx, &State{ID: "run-2", Saga: "issue_code", Status: StatusCompleted}))
+
+	// The store keeps a copy
+	state.Completed = 5
+	loaded, err := store.Load(ctx, "run-1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, loaded.Completed)
+
+	incomplete, err := store.Incomplete(ctx, "issue_code")
+	require.NoError(t, err)
+	require.Len(t, incomplete, 1)
+	assert.Equal(t, "run-1", incomplete[0].ID)
+}
@@ -0,0 +1,145 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Placeholder replaces redacted values
+const Placeholder = "[REDACTED]"
+
+// minRegisteredLength keeps short values such as "true" or port numbers
+// from being redacted everywhere they appear
+const minRegisteredLength = 6
+
+// patterns match secrets that were never registered: bearer tokens, JWTs,
+// our API keys and credentials in URLs or key=value pairs
+var patterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9\-._~+/]+=*`),
+	regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+	regexp.MustCompile(`\bjk_[a-z0-9_]+_[0-9A-Za-z]{36}\b`),
+	regexp.MustCompile(`(://[^:/@\s]+:)[^@\s]+(@)`),
+	regexp.MustCompile(`(?i)((?:password|passwd|secret|token|api_key|apikey)=)[^&\s]+`),
+}
+
+var (
+	registered      = make(map[string]struct{})
+	registeredOrder []string
+	registryMutex   sync.RWMutex
+)
+
+// Register adds a value that Redact will replace wherever it appears.
+// Secrets loaded by a Manager are registered automatically.
+func Register(value string) {
+	if len(value) < minRegisteredLength {
+		return
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, exists := registered[value]; exists {
+		return
+	}
+	registered[value] = struct{}{}
+
+	// Longest first, so a secret containing another is replaced whole
+	registeredOrder = append(registeredOrder, value)
+	sort.Slice(registeredOrder, func(i, j int) bool {
+		return len(registeredOrder[i]) > len(registeredOrder[j])
+	})
+}
+
+// Redact replaces registered secret values and well-known credential
+// patterns in s with the placeholder
+func Redact(s string) string {
+	registryMutex.RLock()
+	for _, value := range registeredOrder {
+		if strings.Contains(s, value) {
+			s = strings.ReplaceAll(s, value, Placeholder)
+		}
+	}
+	registryMutex.RUnlock()
+
+	for _, pattern := range patterns {
+		if pattern.NumSubexp() == 0 {
+			s = pattern.ReplaceAllString(s, Placeholder)
+		} else {
+			s = pattern.ReplaceAllString(s, "${1}"+Placeholder+"${2}")
+		}
+	}
+	return s
+}
+
+// RedactPanic formats a value recovered from a panic with secrets redacted,
+// for recovery middleware that logs or returns panic messages
+func RedactPanic(recovered interface{}) string {
+	return Redact(fmt.Sprint(recovered))
+}
+
+// RedactingHandler is a slog.Handler that redacts the message and every
+// string attribute before passing the record on
+type RedactingHandler struct {
+	next slog.Handler
+}
+
+// NewRedactingHandler wraps a slog handler so secrets never reach its output
+func NewRedactingHandler(next slog.Handler) *RedactingHandler {
+	return &RedactingHandler{next: next}
+}
+
+// Enabled reports whether the wrapped handler handles the level
+func (h *RedactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle redacts the record and passes it to the wrapped handler
+func (h *RedactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, Redact(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+// WithAttrs returns a handler with the redacted attributes added
+func (h *RedactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = redactAttr(attr)
+	}
+	return &RedactingHandler{next: h.next.WithAttrs(redacted)}
+}
+
+// WithGroup returns a handler that nests attributes in the group
+func (h *RedactingHandler) WithGroup(name string) slog.Handler {
+	return &RedactingHandler{next: h.next.WithGroup(name)}
+}
+
+// redactAttr redacts string values, errors and groups recursively
+func redactAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, Redact(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, len(group))
+		for i, member := range group {
+			redacted[i] = redactAttr(member)
+		}
+		return slog.Group(attr.Key, redacted...)
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			return slog.String(attr.Key, Redact(err.Error()))
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
@@ -0,0 +1,223 @@
+// Package secrets loads secrets from the environment, mounted files and
+// HashiCorp Vault, caches them, notifies subscribers when they rotate, and
+// keeps their values out of logs.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when no source has the requested secret
+var ErrNotFound = errors.New("secret not found")
+
+// Source is a place secrets are read from
+type Source interface {
+	// Name identifies the source in errors
+	Name() string
+	// Get returns the secret value, or ErrNotFound
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// Secret holds a secret value. It formats as [REDACTED] in fmt, JSON and
+// slog output so it can't be logged by accident; call Value to use it.
+type Secret struct {
+	value string
+}
+
+// NewSecret wraps a value and registers it for redaction
+func NewSecret(value string) Secret {
+	Register(value)
+	return Secret{value: value}
+}
+
+// Value returns the secret value
+func (s Secret) Value() string {
+	return s.value
+}
+
+// IsZero reports whether the secret is empty
+func (s Secret) IsZero() bool {
+	return s.value == ""
+}
+
+// String returns the redaction placeholder
+func (s Secret) String() string {
+	return Placeholder
+}
+
+// GoString returns the redaction placeholder for %#v
+func (s Secret) GoString() string {
+	return Placeholder
+}
+
+// Format writes the redaction placeholder for every verb
+func (s Secret) Format(f fmt.State, verb rune) {
+	fmt.Fprint(f, Placeholder)
+}
+
+// MarshalJSON encodes the redaction placeholder
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + Placeholder + `"`), nil
+}
+
+// LogValue implements slog.LogValuer
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(Placeholder)
+}
+
+// RotationHandler is called when a cached secret changes
+type RotationHandler func(name string, previous, current Secret)
+
+// ManagerConfig holds the configuration for a secrets manager
+type ManagerConfig struct {
+	TTL             time.Duration `json:"ttl"`              // How long a cached value is served without reloading
+	RefreshInterval time.Duration `json:"refresh_interval"` // How often Start checks cached secrets for rotation
+}
+
+// DefaultManagerConfig returns a default secrets manager configuration
+func DefaultManagerConfig() *ManagerConfig {
+	return &ManagerConfig{
+		TTL:             5 * time.Minute,
+		RefreshInterval: time.Minute,
+	}
+}
+
+// cachedSecret is a loaded secret and when it was loaded
+type cachedSecret struct {
+	secret   Secret
+	loadedAt time.Time
+}
+
+// Manager resolves secrets from its sources in order and caches them
+type Manager struct {
+	config   *ManagerConfig
+	sources  []Source
+	cache    map[string]cachedSecret
+	handlers map[string][]RotationHandler
+	mutex    sync.RWMutex
+}
+
+// NewManager creates a manager that reads from the given sources, first match wins
+func NewManager(config *ManagerConfig, sources ...Source) *Manager {
+	if config == nil {
+		config = DefaultManagerConfig()
+	}
+
+	return &Manager{
+		config:   config,
+		sources:  sources,
+		cache:    make(map[string]cachedSecret),
+		handlers: make(map[string][]RotationHandler),
+	}
+}
+
+// Get returns the named secret, loading it when it isn't cached or the
+// cached value is older than the TTL
+func (m *Manager) Get(ctx context.Context, name string) (Secret, error) {
+	m.mutex.RLock()
+	cached, found := m.cache[name]
+	m.mutex.RUnlock()
+
+	if found && time.Since(cached.loadedAt) < m.config.TTL {
+		return cached.secret, nil
+	}
+
+	secret, err := m.reload(ctx, name)
+	if err != nil && found {
+		// Keep serving the last known value while a source is unavailable
+		return cached.secret, nil
+	}
+	return secret, err
+}
+
+// MustGet returns the named secret or panics. It is meant for startup code.
+func (m *Manager) MustGet(ctx context.Context, name string) Secret {
+	secret, err := m.Get(ctx, name)
+	if err != nil {
+		panic(fmt.Sprintf("secrets: %v", err))
+	}
+	return secret
+}
+
+// OnRotate registers a handler called when the named secret changes
+func (m *Manager) OnRotate(name string, handler RotationHandler) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.handlers[name] = append(m.handlers[name], handler)
+}
+
+// Refresh reloads every cached secret and notifies rotation handlers of changes
+func (m *Manager) Refresh(ctx context.Context) error {
+	m.mutex.RLock()
+	names := make([]string, 0, len(m.cache))
+	for name := range m.cache {
+		names = append(names, name)
+	}
+	m.mutex.RUnlock()
+
+	var errs []error
+	for _, name := range names {
+		if _, err := m.reload(ctx, name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Start refreshes cached secrets every RefreshInterval until ctx is done
+func (m *Manager) Start(ctx context.Context) {
+	ticker := time.NewTicker(m.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Refresh(ctx)
+		}
+	}
+}
+
+// reload reads the secret from the sources, updates the cache and calls
+// rotation handlers if the value changed
+func (m *Manager) reload(ctx context.Context, name string) (Secret, error) {
+	value, err := m.load(ctx, name)
+	if err != nil {
+		return Secret{}, err
+	}
+	secret := NewSecret(value)
+
+	m.mutex.Lock()
+	previous, found := m.cache[name]
+	m.cache[name] = cachedSecret{secret: secret, loadedAt: time.Now()}
+	handlers := append([]RotationHandler(nil), m.handlers[name]...)
+	m.mutex.Unlock()
+
+	if found && previous.secret.value != secret.value {
+		for _, handler := range handlers {
+			handler(name, previous.secret, secret)
+		}
+	}
+	return secret, nil
+}
+
+// load returns the value from the first source that has the secret
+func (m *Manager) load(ctx context.Context, name string) (string, error) {
+	for _, source := range m.sources {
+		value, err := source.Get(ctx, name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("%s: failed to load secret %q: %w", source.Name(), name, err)
+		}
+		return value, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrNotFound, name)
+}
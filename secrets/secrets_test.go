@@ -0,0 +1,216 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticSource is a Source backed by a map
+type staticSource struct {
+	values map[string]string
+	err    error
+	calls  atomic.Int32
+}
+
+func (s *staticSource) Name() string { return "static" }
+
+func (s *staticSource) Get(ctx context.Context, name string) (string, error) {
+	s.calls.Add(1)
+	if s.err != nil {
+		return "", s.err
+	}
+	value, found := s.values[name]
+	if !found {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func TestSecretFormatting(t *testing.T) {
+	secret := NewSecret("hunter2-database-password")
+
+	assert.Equal(t, "hunter2-database-password", secret.Value())
+	assert.Equal(t, Placeholder, fmt.Sprint(secret))
+	for _, verb := range []string{"%v", "%+v", "%#v", "%s", "%q", "%x"} {
+		assert.Equal(t, Placeholder, fmt.Sprintf(verb, secret), verb)
+	}
+	assert.Equal(t, "{[REDACTED]}", fmt.Sprintf("%v", struct{ Password Secret }{secret}))
+
+	encoded, err := json.Marshal(struct{ Password Secret }{secret})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"Password":"[REDACTED]"}`, string(encoded))
+
+	assert.True(t, Secret{}.IsZero())
+	assert.False(t, secret.IsZero())
+}
+
+func TestManagerSourcesInOrder(t *testing.T) {
+	first := &staticSource{values: map[string]string{"db/password": "from-first-source"}}
+	second := &staticSource{values: map[string]string{"db/password": "ignored", "smtp/password": "from-second-source"}}
+	manager := NewManager(nil, first, second)
+	ctx := context.Background()
+
+	secret, err := manager.Get(ctx, "db/password")
+	require.NoError(t, err)
+	assert.Equal(t, "from-first-source", secret.Value())
+
+	secret, err = manager.Get(ctx, "smtp/password")
+	require.NoError(t, err)
+	assert.Equal(t, "from-second-source", secret.Value())
+
+	_, err = manager.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Cached values are served without hitting the sources
+	calls := first.calls.Load()
+	_, err = manager.Get(ctx, "db/password")
+	require.NoError(t, err)
+	assert.Equal(t, calls, first.calls.Load())
+
+	assert.Panics(t, func() { manager.MustGet(ctx, "missing") })
+}
+
+func TestManagerSourceError(t *testing.T) {
+	source := &staticSource{values: map[string]string{"api-key": "initial-api-key"}}
+	manager := NewManager(&ManagerConfig{TTL: 0, RefreshInterval: time.Minute}, source)
+	ctx := context.Background()
+
+	_, err := manager.Get(ctx, "api-key")
+	require.NoError(t, err)
+
+	// The last known value is served while the source is down
+	source.err = errors.New("connection refused")
+	secret, err := manager.Get(ctx, "api-key")
+	require.NoError(t, err)
+	assert.Equal(t, "initial-api-key", secret.Value())
+
+	_, err = manager.Get(ctx, "other")
+	assert.ErrorContains(t, err, "connection refused")
+}
+
+func TestManagerRotation(t *testing.T) {
+	source := &staticSource{values: map[string]string{"jwt/secret": "first-jwt-secret"}}
+	manager := NewManager(&ManagerConfig{TTL: time.Hour, RefreshInterval: 10 * time.Millisecond}, source)
+	ctx := context.Background()
+
+	rotated := make(chan [2]string, 1)
+	manager.OnRotate("jwt/secret", func(name string, previous, current Secret) {
+		rotated <- [2]string{previous.Value(), current.Value()}
+	})
+
+	_, err := manager.Get(ctx, "jwt/secret")
+	require.NoError(t, err)
+
+	// Unchanged values don't notify
+	require.NoError(t, manager.Refresh(ctx))
+	assert.Len(t, rotated, 0)
+
+	source.values = map[string]string{"jwt/secret": "second-jwt-secret"}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go manager.Start(runCtx)
+
+	select {
+	case change := <-rotated:
+		assert.Equal(t, [2]string{"first-jwt-secret", "second-jwt-secret"}, change)
+	case <-time.After(time.Second):
+		t.Fatal("rotation handler was not called")
+	}
+
+	secret, err := manager.Get(ctx, "jwt/secret")
+	require.NoError(t, err)
+	assert.Equal(t, "second-jwt-secret", secret.Value())
+}
+
+func TestEnvSource(t *testing.T) {
+	t.Setenv("JARAKEY_DB_PASSWORD", "env-password")
+	source := EnvSource{Prefix: "jarakey"}
+
+	value, err := source.Get(context.Background(), "db/password")
+	require.NoError(t, err)
+	assert.Equal(t, "env-password", value)
+
+	_, err = source.Get(context.Background(), "db/user")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "smtp-password"), []byte("file-password\n"), 0o600))
+	source := FileSource{Dir: dir}
+
+	value, err := source.Get(context.Background(), "smtp-password")
+	require.NoError(t, err)
+	assert.Equal(t, "file-password", value)
+
+	_, err = source.Get(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Names can't escape the directory
+	_, err = source.Get(context.Background(), "../"+filepath.Base(dir)+"/smtp-password")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestVaultSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "vault-token", r.Header.Get("X-Vault-Token"))
+		if r.URL.Path != "/v1/secret/data/jarakey/users-service" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"db_password":"vault-password","pool":{"size":5}},"metadata":{"version":3}}}`))
+	}))
+	defer server.Close()
+
+	config := DefaultVaultConfig()
+	config.Address = server.URL
+	config.Token = "vault-token"
+	config.Path = "jarakey/users-service"
+	source, err := NewVaultSource(config)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	value, err := source.Get(ctx, "db_password")
+	require.NoError(t, err)
+	assert.Equal(t, "vault-password", value)
+
+	value, err = source.Get(ctx, "pool")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"size":5}`, value)
+
+	_, err = source.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	config.Path = "jarakey/other"
+	_, err = source.Get(ctx, "db_password")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = NewVaultSource(&VaultConfig{Address: server.URL})
+	assert.Error(t, err)
+}
+
+func TestManagerRegistersForRedaction(t *testing.T) {
+	manager := NewManager(nil, &staticSource{values: map[string]string{"webhook": "registered-webhook-secret"}})
+	_, err := manager.Get(context.Background(), "webhook")
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	logger := slog.New(NewRedactingHandler(slog.NewTextHandler(&out, nil)))
+	logger.Info("calling with registered-webhook-secret")
+	assert.NotContains(t, out.String(), "registered-webhook-secret")
+}
@@ -0,0 +1,170 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// EnvSource reads secrets from environment variables. The name "db/password"
+// with prefix "APP" is read from APP_DB_PASSWORD.
+type EnvSource struct {
+	Prefix string
+}
+
+// Name returns "env"
+func (s EnvSource) Name() string {
+	return "env"
+}
+
+// Get returns the environment variable for the secret name
+func (s EnvSource) Get(ctx context.Context, name string) (string, error) {
+	value, found := os.LookupEnv(s.key(name))
+	if !found {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// key maps a secret name to an environment variable name
+func (s EnvSource) key(name string) string {
+	key := strings.ToUpper(strings.NewReplacer("/", "_", "-", "_", ".", "_").Replace(name))
+	if s.Prefix != "" {
+		key = strings.ToUpper(s.Prefix) + "_" + key
+	}
+	return key
+}
+
+// FileSource reads secrets from files in a directory, such as a mounted
+// Kubernetes secret. Trailing newlines are trimmed.
+type FileSource struct {
+	Dir string
+}
+
+// Name returns "file"
+func (s FileSource) Name() string {
+	return "file"
+}
+
+// Get returns the contents of the file named after the secret
+func (s FileSource) Get(ctx context.Context, name string) (string, error) {
+	path := filepath.Join(s.Dir, filepath.Clean("/"+name))
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// VaultConfig holds the configuration for a Vault KV version 2 source
+type VaultConfig struct {
+	Address   string        `json:"address"`
+	Token     string        `json:"-"`
+	Namespace string        `json:"namespace"`
+	Mount     string        `json:"mount"` // KV v2 mount, "secret" by default
+	Path      string        `json:"path"`  // Secret path under the mount, e.g. "jarakey/users-service"
+	Timeout   time.Duration `json:"timeout"`
+}
+
+// DefaultVaultConfig returns a Vault configuration with the address, token
+// and namespace read from VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE
+func DefaultVaultConfig() *VaultConfig {
+	return &VaultConfig{
+		Address:   os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+		Mount:     "secret",
+		Timeout:   10 * time.Second,
+	}
+}
+
+// VaultSource reads secrets as keys of one Vault KV v2 secret
+type VaultSource struct {
+	config     *VaultConfig
+	httpClient *http.Client
+}
+
+// NewVaultSource creates a source for the KV v2 secret at config.Path
+func NewVaultSource(config *VaultConfig) (*VaultSource, error) {
+	if config == nil {
+		config = DefaultVaultConfig()
+	}
+	if config.Address == "" || config.Token == "" || config.Path == "" {
+		return nil, errors.New("Vault address, token and path are required")
+	}
+
+	return &VaultSource{
+		config:     config,
+		httpClient: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Name returns "vault"
+func (s *VaultSource) Name() string {
+	return "vault"
+}
+
+// Get reads the latest version of the secret and returns the named key
+func (s *VaultSource) Get(ctx context.Context, name string) (string, error) {
+	mount := strings.Trim(s.config.Mount, "/")
+	if mount == "" {
+		mount = "secret"
+	}
+	url := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimSuffix(s.config.Address, "/"), mount, strings.Trim(s.config.Path, "/"))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", s.config.Token)
+	if s.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.config.Namespace)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("vault responded with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var payload struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return "", fmt.Errorf("failed to decode vault response: %w", err)
+	}
+
+	value, found := payload.Data.Data[name]
+	if !found {
+		return "", ErrNotFound
+	}
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
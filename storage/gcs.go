@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clients"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/utils"
+)
+
+const gcsAlgorithm = "GOOG4-RSA-SHA256"
+
+// GCSConfig holds the configuration for a Google Cloud Storage bucket
+type GCSConfig struct {
+	Bucket  string        `json:"bucket"`
+	BaseURL string        `json:"base_url"`
+	Timeout time.Duration `json:"timeout"`
+
+	// TokenSource supplies OAuth 2.0 access tokens with the
+	// devstorage.read_write scope
+	TokenSource clients.TokenSource `json:"-"`
+
+	// ServiceAccountEmail and PrivateKeyPEM (the private_key of a service
+	// account key file) sign presigned URLs. Without them only Put, Get and
+	// Delete work.
+	ServiceAccountEmail string `json:"service_account_email"`
+	PrivateKeyPEM       []byte `json:"-"`
+
+	Clock clock.Clock `json:"-"` // nil uses the system clock
+}
+
+// DefaultGCSConfig returns a GCS configuration for the public API
+func DefaultGCSConfig() *GCSConfig {
+	return &GCSConfig{
+		BaseURL: "https://storage.googleapis.com",
+		Timeout: 30 * time.Second,
+	}
+}
+
+// GCSStore stores objects in a GCS bucket through the JSON API and signs
+// URLs for the XML API
+type GCSStore struct {
+	config     *GCSConfig
+	baseURL    *url.URL
+	signingKey *rsa.PrivateKey
+	clock      clock.Clock
+	httpClient *http.Client
+}
+
+// NewGCSStore creates a store for a GCS bucket
+func NewGCSStore(config *GCSConfig) (*GCSStore, error) {
+	if config == nil {
+		config = DefaultGCSConfig()
+	}
+	if config.Bucket == "" || config.TokenSource == nil {
+		return nil, errors.New("GCS bucket and token source are required")
+	}
+
+	rawURL := config.BaseURL
+	if rawURL == "" {
+		rawURL = DefaultGCSConfig().BaseURL
+	}
+	baseURL, err := url.Parse(strings.TrimRight(rawURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GCS base URL: %w", err)
+	}
+
+	store := &GCSStore{
+		config:     config,
+		baseURL:    baseURL,
+		clock:      clock.OrReal(config.Clock),
+		httpClient: &http.Client{Timeout: config.Timeout},
+	}
+	if len(config.PrivateKeyPEM) > 0 {
+		key, err := utils.ParsePrivateKeyPEM(config.PrivateKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GCS signing key: %w", err)
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok || config.ServiceAccountEmail == "" {
+			return nil, errors.New("GCS signing requires a service account email and RSA key")
+		}
+		store.signingKey = rsaKey
+	}
+	return store, nil
+}
+
+// Name returns "gcs"
+func (s *GCSStore) Name() string {
+	return "gcs"
+}
+
+// Put uploads the object with a simple media upload
+func (s *GCSStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	query := url.Values{"uploadType": {"media"}, "name": {key}}
+	endpoint := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?%s", s.baseURL, url.PathEscape(s.config.Bucket), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError("gcs", resp)
+	}
+	return nil
+}
+
+// Get downloads the object's media
+func (s *GCSStore) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key)+"?alt=media", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, nil, responseError("gcs", resp)
+	}
+	return resp.Body, objectInfo(key, resp), nil
+}
+
+// Delete removes the object
+func (s *GCSStore) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return responseError("gcs", resp)
+	}
+	return nil
+}
+
+// PresignPut returns a V4 signed upload URL
+func (s *GCSStore) PresignPut(ctx context.Context, key, contentType string, expires time.Duration) (string, error) {
+	return s.sign(http.MethodPut, key, contentType, expires)
+}
+
+// PresignGet returns a V4 signed download URL
+func (s *GCSStore) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return s.sign(http.MethodGet, key, "", expires)
+}
+
+// objectURL returns the JSON API URL of an object
+func (s *GCSStore) objectURL(key string) string {
+	return fmt.Sprintf("%s/storage/v1/b/%s/o/%s", s.baseURL, url.PathEscape(s.config.Bucket), url.PathEscape(key))
+}
+
+// do authorizes and sends a JSON API request
+func (s *GCSStore) do(req *http.Request) (*http.Response, error) {
+	token, err := s.config.TokenSource(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("gcs %s: %w", strings.ToLower(req.Method), err)
+	}
+	return resp, nil
+}
+
+// sign returns a V4 signed URL for a path-style XML API request. A content
+// type, when given, is signed and must be sent with the request.
+func (s *GCSStore) sign(method, key, contentType string, expires time.Duration) (string, error) {
+	if s.signingKey == nil {
+		return "", errors.New("GCS signed URLs require a service account key")
+	}
+
+	now := s.clock.Now().UTC()
+	scope := now.Format("20060102") + "/auto/storage/goog4_request"
+	path := "/" + escape(s.config.Bucket) + "/" + escapePath(key)
+
+	headers := "host:" + s.baseURL.Host + "\n"
+	signedHeaders := "host"
+	if contentType != "" {
+		headers = "content-type:" + contentType + "\n" + headers
+		signedHeaders = "content-type;host"
+	}
+
+	query := url.Values{
+		"X-Goog-Algorithm":     {gcsAlgorithm},
+		"X-Goog-Credential":    {s.config.ServiceAccountEmail + "/" + scope},
+		"X-Goog-Date":          {now.Format("20060102T150405Z")},
+		"X-Goog-Expires":       {strconv.Itoa(int(expires.Seconds()))},
+		"X-Goog-SignedHeaders": {signedHeaders},
+	}
+	canonicalRequest := strings.Join([]string{
+		method,
+		path,
+		canonicalQuery(query),
+		headers,
+		signedHeaders,
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		gcsAlgorithm,
+		now.Format("20060102T150405Z"),
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	digest := sha256.Sum256([]byte(stringToSign))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.signingKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GCS URL: %w", err)
+	}
+
+	return fmt.Sprintf("%s://%s%s?%s&X-Goog-Signature=%s",
+		s.baseURL.Scheme, s.baseURL.Host, path, canonicalQuery(query), hex.EncodeToString(signature)), nil
+}
+
+// canonicalQuery returns the query sorted by name and RFC 3986 encoded
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		for _, value := range query[name] {
+			pairs = append(pairs, escape(name)+"="+escape(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clients"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGCSStoreRequiresBucketAndTokenSource(t *testing.T) {
+	_, err := NewGCSStore(&GCSConfig{Bucket: "uploads"})
+	assert.Error(t, err)
+
+	_, err = NewGCSStore(&GCSConfig{Bucket: "uploads", TokenSource: clients.StaticToken("token"), PrivateKeyPEM: []byte("not a key")})
+	assert.Error(t, err)
+}
+
+func TestGCSStorePutGetDelete(t *testing.T) {
+	ctx := context.Background()
+	objects := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/jarakey-uploads/o":
+			assert.Equal(t, "media", r.URL.Query().Get("uploadType"))
+			assert.Equal(t, "image/png", r.Header.Get("Content-Type"))
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Query().Get("name")] = string(body)
+			io.WriteString(w, `{}`)
+		case r.Method == http.MethodGet:
+			assert.Equal(t, "media", r.URL.Query().Get("alt"))
+			name := strings.TrimPrefix(r.URL.Path, "/storage/v1/b/jarakey-uploads/o/")
+			body, ok := objects[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, body)
+		case r.Method == http.MethodDelete:
+			delete(objects, strings.TrimPrefix(r.URL.Path, "/storage/v1/b/jarakey-uploads/o/"))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	store, err := NewGCSStore(&GCSConfig{Bucket: "jarakey-uploads", BaseURL: server.URL, TokenSource: clients.StaticToken("token")})
+	require.NoError(t, err)
+
+	require.NoError(t, store.Put(ctx, "avatars/user-1.png", pngHeader, "image/png"))
+	assert.Contains(t, objects, "avatars/user-1.png")
+
+	body, info, err := store.Get(ctx, "avatars/user-1.png")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, pngHeader, data)
+	assert.Equal(t, "image/png", info.ContentType)
+
+	require.NoError(t, store.Delete(ctx, "avatars/user-1.png"))
+	_, _, err = store.Get(ctx, "avatars/user-1.png")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = store.PresignGet(ctx, "avatars/user-1.png", time.Minute)
+	assert.Error(t, err, "signing needs a service account key")
+}
+
+func TestGCSStorePresign(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	store, err := NewGCSStore(&GCSConfig{
+		Bucket:              "jarakey-uploads",
+		TokenSource:         clients.StaticToken("token"),
+		ServiceAccountEmail: "uploads@jarakey.iam.gserviceaccount.com",
+		PrivateKeyPEM:       pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		Clock:               clock.NewFake(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)),
+	})
+	require.NoError(t, err)
+
+	presigned, err := store.PresignPut(context.Background(), "avatars/user 1.png", "image/png", 15*time.Minute)
+	require.NoError(t, err)
+	signedURL, signature, ok := strings.Cut(presigned, "&X-Goog-Signature=")
+	require.True(t, ok)
+
+	parsed, err := url.Parse(signedURL)
+	require.NoError(t, err)
+	assert.Equal(t, "storage.googleapis.com", parsed.Host)
+	assert.Equal(t, "/jarakey-uploads/avatars/user%201.png", parsed.EscapedPath())
+
+	query := "X-Goog-Algorithm=GOOG4-RSA-SHA256" +
+		"&X-Goog-Credential=uploads%40jarakey.iam.gserviceaccount.com%2F20260102%2Fauto%2Fstorage%2Fgoog4_request" +
+		"&X-Goog-Date=20260102T030405Z&X-Goog-Expires=900&X-Goog-SignedHeaders=content-type%3Bhost"
+	assert.Equal(t, query, parsed.RawQuery)
+
+	canonicalRequest := "PUT\n" +
+		"/jarakey-uploads/avatars/user%201.png\n" +
+		query + "\n" +
+		"content-type:image/png\nhost:storage.googleapis.com\n\n" +
+		"content-type;host\n" +
+		"UNSIGNED-PAYLOAD"
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "GOOG4-RSA-SHA256\n20260102T030405Z\n20260102/auto/storage/goog4_request\n" + hex.EncodeToString(requestHash[:])
+	digest := sha256.Sum256([]byte(stringToSign))
+	decoded, err := hex.DecodeString(signature)
+	require.NoError(t, err)
+	assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], decoded))
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/internal/awsv4"
+)
+
+// S3Config holds the configuration for an Amazon S3 bucket
+type S3Config struct {
+	Bucket string `json:"bucket"`
+	Region string `json:"region"`
+
+	// Endpoint defaults to https://<bucket>.s3.<region>.amazonaws.com. Set it
+	// for S3-compatible stores such as MinIO, or GCS with HMAC keys
+	// (https://storage.googleapis.com, region "auto"); objects are then
+	// addressed as <endpoint>/<bucket>/<key>.
+	Endpoint string `json:"endpoint"`
+
+	AccessKeyID     string        `json:"access_key_id"`
+	SecretAccessKey string        `json:"-"`
+	SessionToken    string        `json:"-"`
+	Timeout         time.Duration `json:"timeout"`
+
+	Clock clock.Clock `json:"-"` // nil uses the system clock
+}
+
+// DefaultS3Config returns an S3 configuration with credentials and region
+// read from the standard AWS environment variables
+func DefaultS3Config() *S3Config {
+	credentials := awsv4.CredentialsFromEnv()
+	return &S3Config{
+		Region:          awsv4.RegionFromEnv(),
+		AccessKeyID:     credentials.AccessKeyID,
+		SecretAccessKey: credentials.SecretAccessKey,
+		SessionToken:    credentials.SessionToken,
+		Timeout:         30 * time.Second,
+	}
+}
+
+// S3Store stores objects in an S3 bucket through the REST API
+type S3Store struct {
+	config     *S3Config
+	signer     awsv4.Signer
+	baseURL    string
+	clock      clock.Clock
+	httpClient *http.Client
+}
+
+// NewS3Store creates a store for an S3 bucket
+func NewS3Store(config *S3Config) (*S3Store, error) {
+	if config == nil {
+		config = DefaultS3Config()
+	}
+	if config.Bucket == "" || config.Region == "" {
+		return nil, errors.New("S3 bucket and region are required")
+	}
+
+	baseURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com", config.Bucket, config.Region)
+	if config.Endpoint != "" {
+		baseURL = strings.TrimRight(config.Endpoint, "/") + "/" + config.Bucket
+	}
+
+	return &S3Store{
+		config: config,
+		signer: awsv4.Signer{
+			Credentials: awsv4.Credentials{
+				AccessKeyID:     config.AccessKeyID,
+				SecretAccessKey: config.SecretAccessKey,
+				SessionToken:    config.SessionToken,
+			},
+			Region:  config.Region,
+			Service: "s3",
+		},
+		baseURL:    baseURL,
+		clock:      clock.OrReal(config.Clock),
+		httpClient: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Name returns "s3"
+func (s *S3Store) Name() string {
+	return "s3"
+}
+
+// Put uploads the object with PutObject
+func (s *S3Store) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	req, err := s.request(ctx, http.MethodPut, key, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := s.do(req, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError("s3", resp)
+	}
+	return nil
+}
+
+// Get downloads the object with GetObject
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	req, err := s.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := s.do(req, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, nil, responseError("s3", resp)
+	}
+	return resp.Body, objectInfo(key, resp), nil
+}
+
+// Delete removes the object with DeleteObject
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	req, err := s.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return responseError("s3", resp)
+	}
+	return nil
+}
+
+// PresignPut returns a presigned PutObject URL
+func (s *S3Store) PresignPut(ctx context.Context, key, contentType string, expires time.Duration) (string, error) {
+	req, err := s.request(ctx, http.MethodPut, key, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return s.signer.Presign(req, expires, s.clock.Now())
+}
+
+// PresignGet returns a presigned GetObject URL
+func (s *S3Store) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	req, err := s.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return "", err
+	}
+	return s.signer.Presign(req, expires, s.clock.Now())
+}
+
+// request builds an unsigned request for an object
+func (s *S3Store) request(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, method, s.baseURL+"/"+escapePath(key), body)
+}
+
+// do signs and sends a request whose body is data
+func (s *S3Store) do(req *http.Request, data []byte) (*http.Response, error) {
+	if err := s.signer.Sign(req, data, s.clock.Now()); err != nil {
+		return nil, err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s: %w", strings.ToLower(req.Method), err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestS3Store(t *testing.T, handler http.HandlerFunc) *S3Store {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	store, err := NewS3Store(&S3Config{
+		Bucket:          "jarakey-uploads",
+		Region:          "eu-west-1",
+		Endpoint:        server.URL,
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		Timeout:         time.Second,
+		Clock:           clock.NewFake(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)),
+	})
+	require.NoError(t, err)
+	return store
+}
+
+func TestS3StoreRequiresBucketAndRegion(t *testing.T) {
+	_, err := NewS3Store(&S3Config{Bucket: "uploads"})
+	assert.Error(t, err)
+}
+
+func TestS3StorePutGetDelete(t *testing.T) {
+	ctx := context.Background()
+	objects := make(map[string]string)
+	store := newTestS3Store(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.Header.Get("Authorization"), "Credential=AKIDEXAMPLE/20260102/eu-west-1/s3/aws4_request")
+		assert.NotEmpty(t, r.Header.Get("X-Amz-Content-Sha256"))
+
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.EscapedPath()] = string(body)
+			assert.Equal(t, "text/csv", r.Header.Get("Content-Type"))
+		case http.MethodGet:
+			body, ok := objects[r.URL.EscapedPath()]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("ETag", `"abc123"`)
+			w.Header().Set("Last-Modified", "Fri, 02 Jan 2026 03:04:05 GMT")
+			io.WriteString(w, body)
+		case http.MethodDelete:
+			delete(objects, r.URL.EscapedPath())
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	require.NoError(t, store.Put(ctx, "exports/org 1/audit.csv", []byte("id,action\n"), "text/csv"))
+	assert.Contains(t, objects, "/jarakey-uploads/exports/org%201/audit.csv", "keys are path-style and escaped")
+
+	body, info, err := store.Get(ctx, "exports/org 1/audit.csv")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, "id,action\n", string(data))
+	assert.Equal(t, "text/csv", info.ContentType)
+	assert.Equal(t, int64(10), info.Size)
+	assert.Equal(t, "abc123", info.ETag)
+	assert.Equal(t, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), info.LastModified)
+
+	require.NoError(t, store.Delete(ctx, "exports/org 1/audit.csv"))
+	_, _, err = store.Get(ctx, "exports/org 1/audit.csv")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestS3StoreErrors(t *testing.T) {
+	store := newTestS3Store(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "<Error><Code>AccessDenied</Code></Error>")
+	})
+
+	err := store.Put(context.Background(), "a.csv", []byte("a"), "text/csv")
+	assert.EqualError(t, err, "s3 responded 403: <Error><Code>AccessDenied</Code></Error>")
+}
+
+func TestS3StorePresign(t *testing.T) {
+	store, err := NewS3Store(&S3Config{
+		Bucket:          "jarakey-uploads",
+		Region:          "eu-west-1",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		Clock:           clock.NewFake(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)),
+	})
+	require.NoError(t, err)
+
+	presigned, err := store.PresignPut(context.Background(), "avatars/user-1.png", "image/png", 15*time.Minute)
+	require.NoError(t, err)
+	parsed, err := url.Parse(presigned)
+	require.NoError(t, err)
+	assert.Equal(t, "jarakey-uploads.s3.eu-west-1.amazonaws.com", parsed.Host)
+	assert.Equal(t, "/avatars/user-1.png", parsed.Path)
+
+	query := parsed.Query()
+	assert.Equal(t, "AKIDEXAMPLE/20260102/eu-west-1/s3/aws4_request", query.Get("X-Amz-Credential"))
+	assert.Equal(t, "900", query.Get("X-Amz-Expires"))
+	assert.Equal(t, "content-type;host", query.Get("X-Amz-SignedHeaders"))
+	assert.Len(t, query.Get("X-Amz-Signature"), 64)
+
+	presigned, err = store.PresignGet(context.Background(), "avatars/user-1.png", time.Minute)
+	require.NoError(t, err)
+	assert.Contains(t, presigned, "X-Amz-SignedHeaders=host&")
+}
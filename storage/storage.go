@@ -0,0 +1,343 @@
+// Package storage stores objects such as avatars and audit exports in S3 or
+// Google Cloud Storage and hands out presigned URLs, so clients upload and
+// download large objects directly instead of through our services.
+//
+// A Store talks to one bucket. A Bucket wraps a Store with a key prefix,
+// content type and size checks, logging and metrics, and is what services
+// use.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+)
+
+var (
+	// ErrNotFound is returned when an object doesn't exist
+	ErrNotFound = errors.New("object not found")
+
+	// ErrInvalidKey is returned for empty keys, keys starting with a slash and
+	// keys with empty, "." or ".." segments
+	ErrInvalidKey = errors.New("invalid object key")
+
+	// ErrContentType is returned for a content type the bucket doesn't allow,
+	// or data that doesn't look like its declared content type
+	ErrContentType = errors.New("content type not allowed")
+
+	// ErrTooLarge is returned for data larger than the bucket's MaxSize
+	ErrTooLarge = errors.New("object too large")
+)
+
+// maxPresignExpiry is the longest presigned URL S3 and GCS accept
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified,omitempty"`
+}
+
+// Store reads and writes the objects of one bucket
+type Store interface {
+	Name() string
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+
+	// Get returns the object's content, which the caller must close
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+
+	// Delete removes the object. Deleting a missing object succeeds.
+	Delete(ctx context.Context, key string) error
+
+	// PresignPut returns a URL the holder can PUT the object to until it
+	// expires. The upload must send the same Content-Type.
+	PresignPut(ctx context.Context, key, contentType string, expires time.Duration) (string, error)
+
+	// PresignGet returns a URL the holder can GET the object from until it expires
+	PresignGet(ctx context.Context, key string, expires time.Duration) (string, error)
+}
+
+// Config holds the configuration for a bucket
+type Config struct {
+	// Prefix is prepended to every key, e.g. "avatars/"
+	Prefix string `json:"prefix"`
+
+	// AllowedContentTypes are the media types objects may have, e.g.
+	// "image/png" or "image/*". Empty allows any.
+	AllowedContentTypes []string `json:"allowed_content_types"`
+
+	// MaxSize is the largest object Put accepts in bytes; zero is unlimited.
+	// Presigned uploads aren't limited.
+	MaxSize int64 `json:"max_size"`
+
+	// MaxExpiry caps the lifetime of presigned URLs
+	MaxExpiry time.Duration `json:"max_expiry"`
+
+	Logger  *slog.Logger                `json:"-"` // nil uses slog.Default
+	Metrics *middleware.MetricsRegistry `json:"-"` // nil disables metrics
+}
+
+// DefaultConfig returns a bucket configuration that allows any content type
+// and presigned URLs of up to an hour
+func DefaultConfig() *Config {
+	return &Config{
+		MaxExpiry: time.Hour,
+	}
+}
+
+// Bucket is a Store with a key prefix, content type and size checks,
+// logging and metrics
+type Bucket struct {
+	store  Store
+	config *Config
+	logger *slog.Logger
+}
+
+// New creates a bucket over store
+func New(store Store, config *Config) *Bucket {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Bucket{store: store, config: config, logger: logger}
+}
+
+// Name returns the name of the underlying store
+func (b *Bucket) Name() string {
+	return b.store.Name()
+}
+
+// Put stores data under key. The content type must be allowed and, when
+// the data is recognizable, match it, so HTML can't be uploaded as an image.
+func (b *Bucket) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	start := time.Now()
+	key, err := b.key(key)
+	if err == nil {
+		contentType, err = b.checkContentType(contentType)
+	}
+	if err == nil && b.config.MaxSize > 0 && int64(len(data)) > b.config.MaxSize {
+		err = fmt.Errorf("%w: %d bytes, the limit is %d", ErrTooLarge, len(data), b.config.MaxSize)
+	}
+	if err == nil {
+		err = checkData(data, contentType)
+	}
+	if err == nil {
+		err = b.store.Put(ctx, key, data, contentType)
+	}
+	return b.record(ctx, "put", key, start, err)
+}
+
+// Get returns the object under key, which the caller must close
+func (b *Bucket) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	start := time.Now()
+	key, err := b.key(key)
+	if err != nil {
+		return nil, nil, b.record(ctx, "get", key, start, err)
+	}
+
+	body, info, err := b.store.Get(ctx, key)
+	if err != nil {
+		return nil, nil, b.record(ctx, "get", key, start, err)
+	}
+	info.Key = strings.TrimPrefix(info.Key, b.config.Prefix)
+	b.record(ctx, "get", key, start, nil)
+	return body, info, nil
+}
+
+// Delete removes the object under key
+func (b *Bucket) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+	key, err := b.key(key)
+	if err == nil {
+		err = b.store.Delete(ctx, key)
+	}
+	return b.record(ctx, "delete", key, start, err)
+}
+
+// PresignPut returns an upload URL for key. The content type must be
+// allowed, and expires is capped at MaxExpiry.
+func (b *Bucket) PresignPut(ctx context.Context, key, contentType string, expires time.Duration) (string, error) {
+	start := time.Now()
+	key, err := b.key(key)
+	if err == nil {
+		contentType, err = b.checkContentType(contentType)
+	}
+	var presigned string
+	if err == nil {
+		presigned, err = b.store.PresignPut(ctx, key, contentType, b.expiry(expires))
+	}
+	return presigned, b.record(ctx, "presign_put", key, start, err)
+}
+
+// PresignGet returns a download URL for key; expires is capped at MaxExpiry
+func (b *Bucket) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	start := time.Now()
+	key, err := b.key(key)
+	var presigned string
+	if err == nil {
+		presigned, err = b.store.PresignGet(ctx, key, b.expiry(expires))
+	}
+	return presigned, b.record(ctx, "presign_get", key, start, err)
+}
+
+// key validates key and adds the prefix
+func (b *Bucket) key(key string) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return key, err
+	}
+	return b.config.Prefix + key, nil
+}
+
+// expiry caps a presigned URL lifetime at MaxExpiry
+func (b *Bucket) expiry(expires time.Duration) time.Duration {
+	limit := b.config.MaxExpiry
+	if limit <= 0 || limit > maxPresignExpiry {
+		limit = maxPresignExpiry
+	}
+	if expires <= 0 || expires > limit {
+		return limit
+	}
+	return expires
+}
+
+// checkContentType normalizes a content type and checks it is allowed
+func (b *Bucket) checkContentType(contentType string) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q", ErrContentType, contentType)
+	}
+	if len(b.config.AllowedContentTypes) > 0 && !contentTypeAllowed(mediaType, b.config.AllowedContentTypes) {
+		return "", fmt.Errorf("%w: %s", ErrContentType, mediaType)
+	}
+	return mime.FormatMediaType(mediaType, params), nil
+}
+
+// record logs failures and records the operation in the metrics
+func (b *Bucket) record(ctx context.Context, operation, key string, start time.Time, err error) error {
+	status := "success"
+	switch {
+	case errors.Is(err, ErrNotFound):
+		status = "not_found"
+	case errors.Is(err, ErrInvalidKey), errors.Is(err, ErrContentType), errors.Is(err, ErrTooLarge):
+		status = "rejected"
+	case err != nil:
+		status = "error"
+		b.logger.ErrorContext(ctx, "storage operation failed",
+			"backend", b.store.Name(),
+			"operation", operation,
+			"key", key,
+			"correlation_id", middleware.GetCorrelationID(ctx),
+			"request_id", middleware.GetRequestID(ctx),
+			"error", err.Error(),
+		)
+	}
+	if b.config.Metrics != nil {
+		b.config.Metrics.RecordStorageOperation(b.store.Name(), operation, status, time.Since(start))
+	}
+	return err
+}
+
+// ValidateKey checks that key is a relative object path without empty, "."
+// or ".." segments
+func ValidateKey(key string) error {
+	if key == "" || len(key) > 1024 || strings.HasPrefix(key, "/") {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		}
+	}
+	for _, r := range key {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		}
+	}
+	return nil
+}
+
+// contentTypeAllowed reports whether a media type matches one of the
+// allowed types, which may end in "/*"
+func contentTypeAllowed(mediaType string, allowed []string) bool {
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+		if pattern == mediaType {
+			return true
+		}
+		if family, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mediaType, family+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkData rejects data whose sniffed type contradicts its declared type.
+// Data the sniffer can't place, such as CSV or JSON, is accepted.
+func checkData(data []byte, contentType string) error {
+	declared, _, _ := mime.ParseMediaType(contentType)
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+
+	switch {
+	case sniffed == declared, sniffed == "application/octet-stream", sniffed == "text/plain":
+		return nil
+	case sniffed == "text/xml" && (declared == "application/xml" || strings.HasSuffix(declared, "+xml")):
+		return nil
+	case sniffed == "application/zip" && (strings.HasSuffix(declared, "+zip") || strings.Contains(declared, "openxmlformats")):
+		return nil
+	}
+	return fmt.Errorf("%w: declared %s but the data is %s", ErrContentType, declared, sniffed)
+}
+
+// escapePath percent-encodes each segment of a key for a request path,
+// leaving only RFC 3986 unreserved characters, as signatures require
+func escapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// escape percent-encodes everything except RFC 3986 unreserved characters
+func escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// responseError describes an unexpected storage API response, mapping 404
+// to ErrNotFound
+func responseError(backend string, resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	return fmt.Errorf("%s responded %d: %s", backend, resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// objectInfo reads an object's metadata from response headers
+func objectInfo(key string, resp *http.Response) *ObjectInfo {
+	info := &ObjectInfo{
+		Key:         key,
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        resp.ContentLength,
+		ETag:        strings.Trim(resp.Header.Get("ETag"), `"`),
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = modified
+	}
+	return info
+}
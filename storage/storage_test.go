@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pngHeader is enough of a PNG file for content sniffing
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// fakeStore records the calls a bucket makes
+type fakeStore struct {
+	objects     map[string]string
+	types       map[string]string
+	expires     time.Duration
+	err         error
+	presignedAs string
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{objects: make(map[string]string), types: make(map[string]string)}
+}
+
+func (s *fakeStore) Name() string { return "fake" }
+
+func (s *fakeStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.objects[key] = string(data)
+	s.types[key] = contentType
+	return nil
+}
+
+func (s *fakeStore) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	info := &ObjectInfo{Key: key, ContentType: s.types[key], Size: int64(len(data))}
+	return io.NopCloser(strings.NewReader(data)), info, nil
+}
+
+func (s *fakeStore) Delete(ctx context.Context, key string) error {
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *fakeStore) PresignPut(ctx context.Context, key, contentType string, expires time.Duration) (string, error) {
+	s.expires = expires
+	s.presignedAs = contentType
+	return "https://fake/" + key, nil
+}
+
+func (s *fakeStore) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	s.expires = expires
+	return "https://fake/" + key, nil
+}
+
+func TestValidateKey(t *testing.T) {
+	for _, key := range []string{"avatar.png", "avatars/user-1/original.png", "exports/2026-01-02 audit.csv"} {
+		assert.NoError(t, ValidateKey(key), key)
+	}
+	for _, key := range []string{"", "/avatar.png", "avatars//a.png", "avatars/../secrets", "./a", "a/", "a\nb", strings.Repeat("a", 1025)} {
+		assert.ErrorIs(t, ValidateKey(key), ErrInvalidKey, key)
+	}
+}
+
+func TestBucketPrefixAndRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	bucket := New(store, &Config{Prefix: "avatars/", Metrics: middleware.NewMetricsRegistry("storage-test")})
+
+	require.NoError(t, bucket.Put(ctx, "user-1.png", pngHeader, "image/PNG"))
+	assert.Equal(t, "image/png", store.types["avatars/user-1.png"], "content types are normalized")
+
+	body, info, err := bucket.Get(ctx, "user-1.png")
+	require.NoError(t, err)
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, pngHeader, data)
+	assert.Equal(t, "user-1.png", info.Key)
+
+	require.NoError(t, bucket.Delete(ctx, "user-1.png"))
+	_, _, err = bucket.Get(ctx, "user-1.png")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.ErrorIs(t, bucket.Put(ctx, "../user-1.png", pngHeader, "image/png"), ErrInvalidKey)
+}
+
+func TestBucketContentTypes(t *testing.T) {
+	ctx := context.Background()
+	bucket := New(newFakeStore(), &Config{AllowedContentTypes: []string{"image/*", "text/csv"}, MaxSize: 64})
+
+	assert.NoError(t, bucket.Put(ctx, "a.png", pngHeader, "image/png"))
+	assert.NoError(t, bucket.Put(ctx, "a.csv", []byte("id,name\n1,Acme\n"), "text/csv; charset=utf-8"))
+
+	err := bucket.Put(ctx, "a.json", []byte(`{}`), "application/json")
+	assert.ErrorIs(t, err, ErrContentType)
+
+	err = bucket.Put(ctx, "a.png", []byte("<html><script>alert(1)</script></html>"), "image/png")
+	assert.ErrorIs(t, err, ErrContentType, "data must match its declared type")
+
+	err = bucket.Put(ctx, "a.jpg", pngHeader, "image/jpeg")
+	assert.ErrorIs(t, err, ErrContentType)
+
+	assert.ErrorIs(t, bucket.Put(ctx, "a.png", []byte("not a type"), "image"), ErrContentType)
+	assert.ErrorIs(t, bucket.Put(ctx, "big.csv", make([]byte, 65), "text/csv"), ErrTooLarge)
+}
+
+func TestBucketPresign(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	bucket := New(store, &Config{Prefix: "exports/", AllowedContentTypes: []string{"text/csv"}, MaxExpiry: 15 * time.Minute})
+
+	presigned, err := bucket.PresignPut(ctx, "audit.csv", "text/csv", 5*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "https://fake/exports/audit.csv", presigned)
+	assert.Equal(t, 5*time.Minute, store.expires)
+	assert.Equal(t, "text/csv", store.presignedAs)
+
+	_, err = bucket.PresignGet(ctx, "audit.csv", 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 15*time.Minute, store.expires, "expiry is capped")
+
+	_, err = bucket.PresignGet(ctx, "audit.csv", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 15*time.Minute, store.expires)
+
+	_, err = bucket.PresignPut(ctx, "audit.csv", "text/html", time.Minute)
+	assert.ErrorIs(t, err, ErrContentType)
+
+	bucket = New(store, &Config{})
+	_, err = bucket.PresignGet(ctx, "audit.csv", 30*24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, store.expires, "the providers' limit applies")
+}
+
+func TestBucketPassesStoreErrors(t *testing.T) {
+	store := newFakeStore()
+	store.err = errors.New("connection reset")
+	bucket := New(store, nil)
+
+	err := bucket.Put(context.Background(), "a.csv", []byte("a,b"), "text/csv")
+	assert.EqualError(t, err, "connection reset")
+}
@@ -0,0 +1,520 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/redis/go-redis/v9"
+)
+
+// enqueueScript stores a task unless its ID is already queued, then makes it
+// ready or schedules it.
+// KEYS: task, ready, scheduled. ARGV: task JSON, ID, run-at in ms (0 for now).
+var enqueueScript = redis.NewScript(`
+if not redis.call('SET', KEYS[1], ARGV[1], 'NX') then
+	return 0
+end
+if ARGV[3] == '0' then
+	redis.call('LPUSH', KEYS[2], ARGV[2])
+else
+	redis.call('ZADD', KEYS[3], ARGV[3], ARGV[2])
+end
+return 1
+`)
+
+// claimScript makes due scheduled tasks ready, returns tasks whose lease ran
+// out to the front of the ready list, then leases the next ready task.
+// KEYS: ready, scheduled, processing. ARGV: now in ms, lease deadline in ms.
+var claimScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, id in ipairs(due) do
+	redis.call('ZREM', KEYS[2], id)
+	redis.call('LPUSH', KEYS[1], id)
+end
+local expired = redis.call('ZRANGEBYSCORE', KEYS[3], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, id in ipairs(expired) do
+	redis.call('ZREM', KEYS[3], id)
+	redis.call('RPUSH', KEYS[1], id)
+end
+local id = redis.call('RPOP', KEYS[1])
+if not id then
+	return false
+end
+redis.call('ZADD', KEYS[3], ARGV[2], id)
+return id
+`)
+
+// Stats are the number of tasks of a type in each state
+type Stats struct {
+	Ready     int64 `json:"ready"`
+	Scheduled int64 `json:"scheduled"`
+	Running   int64 `json:"running"`
+	Dead      int64 `json:"dead"`
+}
+
+// Queue is a task queue in Redis. Each task type has a ready list, a set of
+// scheduled tasks, a set of leased tasks and a dead-letter list; a type's keys
+// share a hash tag so the scripts work on Redis Cluster.
+type Queue struct {
+	client   *redis.Client
+	config   *Config
+	prefix   string
+	clock    clock.Clock
+	logger   *slog.Logger
+	workers  *middleware.WorkerGroup
+	handlers map[string]bool
+	running  map[string]int
+	closed   bool
+	mutex    sync.Mutex
+}
+
+// New creates a task queue. Workers run until ctx is cancelled or the queue
+// is shut down.
+func New(ctx context.Context, client *redis.Client, config *Config) *Queue {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &Queue{
+		client:   client,
+		config:   config,
+		prefix:   "tasks",
+		clock:    clock.OrReal(config.Clock),
+		logger:   logger,
+		workers:  middleware.NewWorkerGroup(ctx, "tasks", &middleware.GoroutineConfig{Logger: logger, Metrics: config.Metrics}),
+		handlers: make(map[string]bool),
+		running:  make(map[string]int),
+	}
+}
+
+// key returns the key of one of a task type's structures
+func (q *Queue) key(taskType, name string) string {
+	return q.prefix + ":{" + taskType + "}:" + name
+}
+
+// taskKey returns the key of a task's JSON
+func (q *Queue) taskKey(taskType, id string) string {
+	return q.key(taskType, "task:"+id)
+}
+
+// Enqueue queues a task, stamping it with the caller's correlation IDs and
+// trace context. A task whose ID is already queued returns ErrDuplicate, so
+// an ID derived from the work (such as a webhook delivery ID) enqueues it once.
+func (q *Queue) Enqueue(ctx context.Context, task *Task) error {
+	if task.Type == "" {
+		return errors.New("task type is required")
+	}
+	now := q.clock.Now()
+	stamp(ctx, task, now)
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s task %s: %w", task.Type, task.ID, err)
+	}
+	var runAt int64
+	if task.RunAt.After(now) {
+		runAt = task.RunAt.UnixMilli()
+	}
+
+	keys := []string{q.taskKey(task.Type, task.ID), q.key(task.Type, "ready"), q.key(task.Type, "scheduled")}
+	added, err := enqueueScript.Run(ctx, q.client, keys, data, task.ID, runAt).Int()
+	status := "success"
+	switch {
+	case err != nil:
+		status = "error"
+		err = fmt.Errorf("failed to enqueue %s task %s: %w", task.Type, task.ID, err)
+	case added == 0:
+		status = "duplicate"
+		err = ErrDuplicate
+	}
+	if q.config.Metrics != nil {
+		q.config.Metrics.RecordTaskEnqueued(task.Type, status)
+	}
+	return err
+}
+
+// Handle starts concurrency workers for a task type; zero or less uses
+// Config.Concurrency. Each type has one handler.
+func (q *Queue) Handle(taskType string, handler Handler, concurrency int) error {
+	if concurrency <= 0 {
+		concurrency = q.config.Concurrency
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+	if q.handlers[taskType] {
+		return ErrAlreadyHandled
+	}
+	for i := 0; i < concurrency; i++ {
+		if !q.workers.Go("work:"+taskType, func(ctx context.Context) error {
+			return q.work(ctx, taskType, handler)
+		}) {
+			return ErrClosed
+		}
+	}
+	q.handlers[taskType] = true
+	return nil
+}
+
+// work runs tasks of a type until ctx is done, polling when none are ready
+func (q *Queue) work(ctx context.Context, taskType string, handler Handler) error {
+	for {
+		task, err := q.claim(ctx, taskType)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			q.logger.WarnContext(ctx, "failed to claim task", "task_type", taskType, "error", err.Error())
+		}
+		if task != nil {
+			// A task that has started finishes even when the queue shuts down
+			q.process(context.WithoutCancel(ctx), task, handler)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(q.config.PollInterval):
+		}
+	}
+}
+
+// claim leases the next ready task of a type and counts the attempt. It
+// returns nil when no task is ready.
+func (q *Queue) claim(ctx context.Context, taskType string) (*Task, error) {
+	now := q.clock.Now()
+	keys := []string{q.key(taskType, "ready"), q.key(taskType, "scheduled"), q.key(taskType, "processing")}
+	id, err := claimScript.Run(ctx, q.client, keys, now.UnixMilli(), now.Add(q.config.Lease).UnixMilli()).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := q.client.Get(ctx, q.taskKey(taskType, id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// Finished by a worker whose lease had run out
+		return nil, q.client.ZRem(ctx, q.key(taskType, "processing"), id).Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var task Task
+	if err := json.Unmarshal(data, &task); err != nil {
+		pipe := q.client.TxPipeline()
+		pipe.ZRem(ctx, q.key(taskType, "processing"), id)
+		pipe.LPush(ctx, q.key(taskType, "dead"), id)
+		pipe.Expire(ctx, q.taskKey(taskType, id), q.config.DeadLetterRetention)
+		_, pipeErr := pipe.Exec(ctx)
+		return nil, errors.Join(fmt.Errorf("invalid %s task %s dead-lettered: %w", taskType, id, err), pipeErr)
+	}
+
+	// The attempt is stored first, so a task that crashes its worker still
+	// runs out of attempts
+	task.Attempts++
+	if err := q.save(ctx, &task, redis.KeepTTL); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// process runs a claimed task, then completes it, schedules a retry or
+// dead-letters it
+func (q *Queue) process(ctx context.Context, task *Task, handler Handler) {
+	q.setRunning(task.Type, 1)
+	defer q.setRunning(task.Type, -1)
+
+	start := q.clock.Now()
+	stopRenewing := q.renewLease(ctx, task)
+	err := q.run(handlerContext(ctx, task), task, handler)
+	stopRenewing()
+	duration := q.clock.Since(start)
+
+	attrs := []interface{}{
+		"task_id", task.ID,
+		"task_type", task.Type,
+		"attempt", task.Attempts,
+		"correlation_id", task.Metadata[MetadataCorrelationID],
+		"request_id", task.Metadata[MetadataRequestID],
+		"duration", duration,
+	}
+
+	var status string
+	var storeErr error
+	switch {
+	case err == nil:
+		status = StatusSuccess
+		storeErr = q.complete(ctx, task)
+	case IsPermanent(err) || task.Attempts >= q.maxAttempts(task):
+		status = StatusDeadLetter
+		task.LastError = err.Error()
+		storeErr = q.deadLetter(ctx, task)
+		q.logger.ErrorContext(ctx, "task dead-lettered", append(attrs, "error", err.Error())...)
+	default:
+		status = StatusRetry
+		task.LastError = err.Error()
+		task.RunAt = q.clock.Now().Add(q.retryDelay(task.Attempts))
+		storeErr = q.retry(ctx, task)
+		q.logger.WarnContext(ctx, "task failed, retrying", append(attrs, "error", err.Error(), "retry_at", task.RunAt)...)
+	}
+	if storeErr != nil {
+		// The lease runs out and the task runs again
+		q.logger.ErrorContext(ctx, "failed to update task", append(attrs, "status", status, "error", storeErr.Error())...)
+	}
+
+	if q.config.Metrics != nil {
+		q.config.Metrics.RecordTaskProcessed(task.Type, status, duration)
+	}
+}
+
+// run calls the handler, turning a panic into a failed attempt
+func (q *Queue) run(ctx context.Context, task *Task, handler Handler) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("handler for %s task %s panicked: %v", task.Type, task.ID, recovered)
+		}
+	}()
+	return handler(ctx, task)
+}
+
+// renewLease extends the task's lease while its handler runs. The returned
+// function stops renewing.
+func (q *Queue) renewLease(ctx context.Context, task *Task) func() {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(q.config.Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				deadline := float64(q.clock.Now().Add(q.config.Lease).UnixMilli())
+				err := q.client.ZAddXX(ctx, q.key(task.Type, "processing"), redis.Z{Score: deadline, Member: task.ID}).Err()
+				if err != nil {
+					q.logger.WarnContext(ctx, "failed to renew task lease", "task_id", task.ID, "task_type", task.Type, "error", err.Error())
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// maxAttempts returns how many times a task may run
+func (q *Queue) maxAttempts(task *Task) int {
+	if task.MaxAttempts > 0 {
+		return task.MaxAttempts
+	}
+	if q.config.Retry != nil && q.config.Retry.MaxAttempts > 0 {
+		return q.config.Retry.MaxAttempts
+	}
+	return 1
+}
+
+// retryDelay returns the wait before the attempt after the given one
+func (q *Queue) retryDelay(attempt int) time.Duration {
+	policy := q.config.Retry
+	if policy == nil {
+		return 0
+	}
+	delay := middleware.ExponentialBackoff(attempt-1, policy.InitialDelay, policy.BackoffFactor)
+	if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	if policy.Jitter {
+		delay += time.Duration(rand.Float64() * float64(delay) * 0.1) // 10% jitter
+	}
+	return delay
+}
+
+// save stores a task's JSON
+func (q *Queue) save(ctx context.Context, task *Task, ttl time.Duration) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s task %s: %w", task.Type, task.ID, err)
+	}
+	return q.client.Set(ctx, q.taskKey(task.Type, task.ID), data, ttl).Err()
+}
+
+// complete removes a finished task
+func (q *Queue) complete(ctx context.Context, task *Task) error {
+	pipe := q.client.TxPipeline()
+	pipe.ZRem(ctx, q.key(task.Type, "processing"), task.ID)
+	pipe.Del(ctx, q.taskKey(task.Type, task.ID))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// retry schedules a failed task for its RunAt
+func (q *Queue) retry(ctx context.Context, task *Task) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s task %s: %w", task.Type, task.ID, err)
+	}
+	pipe := q.client.TxPipeline()
+	pipe.Set(ctx, q.taskKey(task.Type, task.ID), data, 0)
+	pipe.ZRem(ctx, q.key(task.Type, "processing"), task.ID)
+	pipe.ZAdd(ctx, q.key(task.Type, "scheduled"), redis.Z{Score: float64(task.RunAt.UnixMilli()), Member: task.ID})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// deadLetter moves a failed task to the dead-letter list, keeping it for
+// DeadLetterRetention
+func (q *Queue) deadLetter(ctx context.Context, task *Task) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s task %s: %w", task.Type, task.ID, err)
+	}
+	pipe := q.client.TxPipeline()
+	pipe.Set(ctx, q.taskKey(task.Type, task.ID), data, q.config.DeadLetterRetention)
+	pipe.ZRem(ctx, q.key(task.Type, "processing"), task.ID)
+	pipe.LPush(ctx, q.key(task.Type, "dead"), task.ID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// DeadLetters returns up to limit dead-lettered tasks of a type, newest
+// first. Tasks past their retention are skipped.
+func (q *Queue) DeadLetters(ctx context.Context, taskType string, limit int) ([]*Task, error) {
+	ids, err := q.client.LRange(ctx, q.key(taskType, "dead"), 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead-lettered %s tasks: %w", taskType, err)
+	}
+
+	tasks := make([]*Task, 0, len(ids))
+	for _, id := range ids {
+		data, err := q.client.Get(ctx, q.taskKey(taskType, id)).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s task %s: %w", taskType, id, err)
+		}
+		var task Task
+		if err := json.Unmarshal(data, &task); err != nil {
+			continue
+		}
+		tasks = append(tasks, &task)
+	}
+	return tasks, nil
+}
+
+// Requeue moves a dead-lettered task back to the ready list with its
+// attempts reset, e.g. once the endpoint it failed against is fixed
+func (q *Queue) Requeue(ctx context.Context, taskType, id string) error {
+	removed, err := q.client.LRem(ctx, q.key(taskType, "dead"), 1, id).Result()
+	if err != nil {
+		return fmt.Errorf("failed to requeue %s task %s: %w", taskType, id, err)
+	}
+	if removed == 0 {
+		return ErrNotFound
+	}
+
+	data, err := q.client.Get(ctx, q.taskKey(taskType, id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load %s task %s: %w", taskType, id, err)
+	}
+	var task Task
+	if err := json.Unmarshal(data, &task); err != nil {
+		return fmt.Errorf("invalid %s task %s: %w", taskType, id, err)
+	}
+	task.Attempts = 0
+	task.LastError = ""
+	task.RunAt = time.Time{}
+	if data, err = json.Marshal(&task); err != nil {
+		return fmt.Errorf("failed to encode %s task %s: %w", taskType, id, err)
+	}
+
+	pipe := q.client.TxPipeline()
+	pipe.Set(ctx, q.taskKey(taskType, id), data, 0)
+	pipe.LPush(ctx, q.key(taskType, "ready"), id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to requeue %s task %s: %w", taskType, id, err)
+	}
+	return nil
+}
+
+// setRunning adjusts the number of tasks of a type this process is running
+func (q *Queue) setRunning(taskType string, delta int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.running[taskType] += delta
+	if q.running[taskType] <= 0 {
+		delete(q.running, taskType)
+	}
+}
+
+// Running returns the number of tasks this process is running by type.
+// Unlike Stats it doesn't count other processes' tasks, so it shows what
+// shutdown is waiting for.
+func (q *Queue) Running() map[string]int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	running := make(map[string]int, len(q.running))
+	for taskType, count := range q.running {
+		running[taskType] = count
+	}
+	return running
+}
+
+// Stats returns the number of tasks of a type in each state
+func (q *Queue) Stats(ctx context.Context, taskType string) (Stats, error) {
+	pipe := q.client.Pipeline()
+	ready := pipe.LLen(ctx, q.key(taskType, "ready"))
+	scheduled := pipe.ZCard(ctx, q.key(taskType, "scheduled"))
+	running := pipe.ZCard(ctx, q.key(taskType, "processing"))
+	dead := pipe.LLen(ctx, q.key(taskType, "dead"))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Stats{}, fmt.Errorf("failed to read %s task stats: %w", taskType, err)
+	}
+	return Stats{Ready: ready.Val(), Scheduled: scheduled.Val(), Running: running.Val(), Dead: dead.Val()}, nil
+}
+
+// Shutdown stops the workers from claiming tasks and waits for running
+// tasks to finish. Tasks still running when ctx ends run again once their
+// lease runs out.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.mutex.Lock()
+	q.closed = true
+	q.mutex.Unlock()
+	return q.workers.Shutdown(ctx)
+}
+
+// Register shuts the queue down with the lifecycle
+func (q *Queue) Register(lifecycle *middleware.Lifecycle) {
+	lifecycle.OnShutdown("tasks", q.Shutdown)
+}
@@ -0,0 +1,251 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestQueue returns a queue on miniredis with a fake clock and a retry
+// policy of 3 attempts, 1s apart and doubling
+func newTestQueue(t *testing.T) (*Queue, *clock.Fake, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	clk := clock.NewFake(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	config := DefaultConfig()
+	config.PollInterval = 10 * time.Millisecond
+	config.Clock = clk
+	config.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	config.Retry = &middleware.RetryConfig{MaxAttempts: 3, InitialDelay: time.Second, BackoffFactor: 2, MaxDelay: time.Minute}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	queue := New(ctx, redis.NewClient(&redis.Options{Addr: server.Addr()}), config)
+	return queue, clk, server
+}
+
+func enqueue(t *testing.T, queue *Queue, task *Task) {
+	t.Helper()
+	require.NoError(t, queue.Enqueue(context.Background(), task))
+}
+
+func stats(t *testing.T, queue *Queue, taskType string) Stats {
+	t.Helper()
+	stats, err := queue.Stats(context.Background(), taskType)
+	require.NoError(t, err)
+	return stats
+}
+
+func TestQueueRunsTasks(t *testing.T) {
+	queue, _, _ := newTestQueue(t)
+	ctx := middleware.WithCorrelationContext(context.Background(), "corr-1", "req-1", "", "")
+
+	task, err := NewTask("webhook.deliver", delivery{WebhookID: "wh-1"})
+	require.NoError(t, err)
+	require.NoError(t, queue.Enqueue(ctx, task))
+	assert.Equal(t, Stats{Ready: 1}, stats(t, queue, "webhook.deliver"))
+
+	seen := make(chan string, 1)
+	require.NoError(t, queue.Handle("webhook.deliver", func(ctx context.Context, task *Task) error {
+		var payload delivery
+		if err := task.Decode(&payload); err != nil {
+			return err
+		}
+		assert.Equal(t, map[string]int{"webhook.deliver": 1}, queue.Running())
+		seen <- payload.WebhookID + " " + middleware.GetCorrelationID(ctx)
+		return nil
+	}, 2))
+
+	select {
+	case got := <-seen:
+		assert.Equal(t, "wh-1 corr-1", got)
+	case <-time.After(5 * time.Second):
+		t.Fatal("task was not run")
+	}
+
+	require.NoError(t, queue.Shutdown(context.Background()))
+	assert.Equal(t, Stats{}, stats(t, queue, "webhook.deliver"))
+	assert.Empty(t, queue.Running())
+}
+
+func TestQueueHandle(t *testing.T) {
+	queue, _, _ := newTestQueue(t)
+	handler := func(ctx context.Context, task *Task) error { return nil }
+
+	require.NoError(t, queue.Handle("notification.send", handler, 0))
+	assert.ErrorIs(t, queue.Handle("notification.send", handler, 0), ErrAlreadyHandled)
+	assert.Equal(t, map[string]int{"work:notification.send": 10}, queue.workers.Active())
+
+	require.NoError(t, queue.Shutdown(context.Background()))
+	assert.ErrorIs(t, queue.Handle("webhook.deliver", handler, 0), ErrClosed)
+}
+
+func TestQueueEnqueueDuplicate(t *testing.T) {
+	queue, _, _ := newTestQueue(t)
+
+	enqueue(t, queue, &Task{ID: "wh-1", Type: "webhook.deliver"})
+	err := queue.Enqueue(context.Background(), &Task{ID: "wh-1", Type: "webhook.deliver"})
+	assert.ErrorIs(t, err, ErrDuplicate)
+	assert.Equal(t, Stats{Ready: 1}, stats(t, queue, "webhook.deliver"))
+
+	assert.Error(t, queue.Enqueue(context.Background(), &Task{ID: "untyped"}))
+}
+
+func TestQueueScheduledTasks(t *testing.T) {
+	queue, clk, _ := newTestQueue(t)
+	ctx := context.Background()
+
+	enqueue(t, queue, &Task{ID: "later", Type: "notification.send", RunAt: clk.Now().Add(time.Hour)})
+	enqueue(t, queue, &Task{ID: "now", Type: "notification.send"})
+	assert.Equal(t, Stats{Ready: 1, Scheduled: 1}, stats(t, queue, "notification.send"))
+
+	task, err := queue.claim(ctx, "notification.send")
+	require.NoError(t, err)
+	require.NotNil(t, task)
+	assert.Equal(t, "now", task.ID)
+	assert.Equal(t, 1, task.Attempts)
+	require.NoError(t, queue.complete(ctx, task))
+
+	task, err = queue.claim(ctx, "notification.send")
+	require.NoError(t, err)
+	assert.Nil(t, task, "scheduled tasks wait for their time")
+
+	clk.Advance(time.Hour)
+	task, err = queue.claim(ctx, "notification.send")
+	require.NoError(t, err)
+	require.NotNil(t, task)
+	assert.Equal(t, "later", task.ID)
+	assert.Equal(t, Stats{Running: 1}, stats(t, queue, "notification.send"))
+}
+
+func TestQueueRetriesThenDeadLetters(t *testing.T) {
+	queue, clk, server := newTestQueue(t)
+	ctx := context.Background()
+	enqueue(t, queue, &Task{ID: "wh-1", Type: "webhook.deliver"})
+
+	var calls atomic.Int32
+	failing := func(ctx context.Context, task *Task) error {
+		calls.Add(1)
+		return errors.New("partner returned 502")
+	}
+
+	delays := []time.Duration{time.Second, 2 * time.Second}
+	for _, delay := range delays {
+		task, err := queue.claim(ctx, "webhook.deliver")
+		require.NoError(t, err)
+		require.NotNil(t, task)
+		queue.process(ctx, task, failing)
+		assert.Equal(t, Stats{Scheduled: 1}, stats(t, queue, "webhook.deliver"))
+
+		clk.Advance(delay - time.Millisecond)
+		task, err = queue.claim(ctx, "webhook.deliver")
+		require.NoError(t, err)
+		assert.Nil(t, task, "retries wait for the backoff")
+		clk.Advance(time.Millisecond)
+	}
+
+	task, err := queue.claim(ctx, "webhook.deliver")
+	require.NoError(t, err)
+	require.NotNil(t, task)
+	queue.process(ctx, task, failing)
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, Stats{Dead: 1}, stats(t, queue, "webhook.deliver"))
+	assert.Equal(t, 7*24*time.Hour, server.TTL("tasks:{webhook.deliver}:task:wh-1"))
+
+	dead, err := queue.DeadLetters(ctx, "webhook.deliver", 10)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, "partner returned 502", dead[0].LastError)
+
+	require.NoError(t, queue.Requeue(ctx, "webhook.deliver", "wh-1"))
+	assert.ErrorIs(t, queue.Requeue(ctx, "webhook.deliver", "wh-1"), ErrNotFound)
+	assert.Equal(t, Stats{Ready: 1}, stats(t, queue, "webhook.deliver"))
+	assert.Zero(t, server.TTL("tasks:{webhook.deliver}:task:wh-1"))
+
+	task, err = queue.claim(ctx, "webhook.deliver")
+	require.NoError(t, err)
+	require.NotNil(t, task)
+	assert.Equal(t, 1, task.Attempts)
+	assert.Empty(t, task.LastError)
+}
+
+func TestQueuePermanentFailuresAndPanics(t *testing.T) {
+	queue, _, _ := newTestQueue(t)
+	ctx := context.Background()
+
+	enqueue(t, queue, &Task{ID: "bad", Type: "webhook.deliver", Payload: []byte(`"not an object"`)})
+	task, err := queue.claim(ctx, "webhook.deliver")
+	require.NoError(t, err)
+	queue.process(ctx, task, func(ctx context.Context, task *Task) error {
+		var payload delivery
+		return task.Decode(&payload)
+	})
+	assert.Equal(t, Stats{Dead: 1}, stats(t, queue, "webhook.deliver"), "permanent failures aren't retried")
+
+	enqueue(t, queue, &Task{ID: "panics", Type: "webhook.deliver"})
+	task, err = queue.claim(ctx, "webhook.deliver")
+	require.NoError(t, err)
+	queue.process(ctx, task, func(ctx context.Context, task *Task) error {
+		panic("nil map")
+	})
+	assert.Equal(t, Stats{Scheduled: 1, Dead: 1}, stats(t, queue, "webhook.deliver"), "panics are retried")
+}
+
+func TestQueueMaxAttemptsOverride(t *testing.T) {
+	queue, _, _ := newTestQueue(t)
+	ctx := context.Background()
+
+	enqueue(t, queue, &Task{ID: "once", Type: "notification.send", MaxAttempts: 1})
+	task, err := queue.claim(ctx, "notification.send")
+	require.NoError(t, err)
+	queue.process(ctx, task, func(ctx context.Context, task *Task) error {
+		return errors.New("provider unavailable")
+	})
+	assert.Equal(t, Stats{Dead: 1}, stats(t, queue, "notification.send"))
+}
+
+func TestQueueExpiredLeaseRunsAgain(t *testing.T) {
+	queue, clk, _ := newTestQueue(t)
+	ctx := context.Background()
+	enqueue(t, queue, &Task{ID: "wh-1", Type: "webhook.deliver"})
+
+	// The first worker crashes without finishing the task
+	task, err := queue.claim(ctx, "webhook.deliver")
+	require.NoError(t, err)
+	require.NotNil(t, task)
+
+	task, err = queue.claim(ctx, "webhook.deliver")
+	require.NoError(t, err)
+	assert.Nil(t, task, "leased tasks aren't claimed twice")
+
+	clk.Advance(queue.config.Lease)
+	task, err = queue.claim(ctx, "webhook.deliver")
+	require.NoError(t, err)
+	require.NotNil(t, task)
+	assert.Equal(t, "wh-1", task.ID)
+	assert.Equal(t, 2, task.Attempts, "the crashed attempt counts")
+}
+
+func TestQueueRetryDelay(t *testing.T) {
+	queue, _, _ := newTestQueue(t)
+
+	assert.Equal(t, time.Second, queue.retryDelay(1))
+	assert.Equal(t, 4*time.Second, queue.retryDelay(3))
+	assert.Equal(t, time.Minute, queue.retryDelay(20), "capped at MaxDelay")
+
+	queue.config.Retry = nil
+	assert.Zero(t, queue.retryDelay(1))
+	assert.Equal(t, 1, queue.maxAttempts(&Task{}))
+}
@@ -0,0 +1,207 @@
+// Package tasks runs background work, such as webhook deliveries and
+// notification sends, off the request path. Tasks are queued in Redis by
+// type and run by a pool of workers per type, with delayed retries, a
+// dead-letter list for tasks that keep failing and scheduled tasks that run
+// at a given time.
+//
+// Delivery is at least once. A task whose worker crashes, or whose handler
+// outlives its lease without the worker renewing it, runs again, so handlers
+// must be idempotent.
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Metadata keys set on every enqueued task
+const (
+	MetadataCorrelationID = "correlation_id"
+	MetadataRequestID     = "request_id"
+)
+
+// Task processing outcomes in metrics
+const (
+	StatusSuccess    = "success"
+	StatusRetry      = "retry"
+	StatusDeadLetter = "dead_letter"
+)
+
+var (
+	// ErrDuplicate is returned when enqueuing a task whose ID is already queued
+	ErrDuplicate = errors.New("task is already queued")
+
+	// ErrAlreadyHandled is returned when a task type already has a handler
+	ErrAlreadyHandled = errors.New("task type already has a handler")
+
+	// ErrClosed is returned when handling tasks on a queue that was shut down
+	ErrClosed = errors.New("task queue is closed")
+
+	// ErrNotFound is returned for a dead-lettered task that doesn't exist
+	ErrNotFound = errors.New("task not found")
+)
+
+// Task is a unit of background work
+type Task struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"` // e.g. "webhook.deliver"
+	Payload json.RawMessage `json:"payload"`
+
+	// RunAt delays the task; zero runs it as soon as a worker is free
+	RunAt time.Time `json:"run_at"`
+
+	// MaxAttempts overrides the queue's retry policy; zero uses it
+	MaxAttempts int `json:"max_attempts,omitempty"`
+
+	Attempts  int               `json:"attempts"`
+	LastError string            `json:"last_error,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// NewTask creates a task of the given type with payload encoded as JSON
+func NewTask(taskType string, payload interface{}) (*Task, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s task: %w", taskType, err)
+	}
+	return &Task{
+		ID:       uuid.New().String(),
+		Type:     taskType,
+		Payload:  encoded,
+		Metadata: make(map[string]string),
+	}, nil
+}
+
+// Decode decodes the task payload into v. Decoding errors are permanent.
+func (t *Task) Decode(v interface{}) error {
+	if err := json.Unmarshal(t.Payload, v); err != nil {
+		return Permanent(fmt.Errorf("failed to decode %s task %s: %w", t.Type, t.ID, err))
+	}
+	return nil
+}
+
+// Handler runs one task. Returning an error retries the task later.
+type Handler func(ctx context.Context, task *Task) error
+
+// permanentError marks a failure that retrying can't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks a handler error that retrying can't fix, such as an
+// undecodable payload or a rejected request. The task is dead-lettered at
+// once.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// Config holds the configuration for a task queue
+type Config struct {
+	// Concurrency is the number of workers per task type when Handle isn't
+	// given one
+	Concurrency int `json:"concurrency"`
+
+	// PollInterval is how long an idle worker waits before checking for tasks
+	PollInterval time.Duration `json:"poll_interval"`
+
+	// Lease is how long a running task is reserved for its worker. Workers
+	// renew it while the handler runs, so it only needs to outlast a
+	// crashed worker's pause before the task runs elsewhere.
+	Lease time.Duration `json:"lease"`
+
+	// Retry is the backoff policy for failed tasks: MaxAttempts, InitialDelay,
+	// BackoffFactor, MaxDelay and Jitter. nil runs each task once.
+	Retry *middleware.RetryConfig `json:"retry,omitempty"`
+
+	// DeadLetterRetention is how long dead-lettered tasks are kept
+	DeadLetterRetention time.Duration `json:"dead_letter_retention"`
+
+	Clock   clock.Clock                 `json:"-"` // nil uses the system clock
+	Logger  *slog.Logger                `json:"-"` // nil uses slog.Default
+	Metrics *middleware.MetricsRegistry `json:"-"` // nil disables metrics
+}
+
+// DefaultConfig returns a queue configuration that retries a task up to 8
+// times over about 40 minutes
+func DefaultConfig() *Config {
+	return &Config{
+		Concurrency:  10,
+		PollInterval: time.Second,
+		Lease:        time.Minute,
+		Retry: &middleware.RetryConfig{
+			MaxAttempts:   8,
+			InitialDelay:  10 * time.Second,
+			MaxDelay:      30 * time.Minute,
+			BackoffFactor: 2.0,
+			Jitter:        true,
+		},
+		DeadLetterRetention: 7 * 24 * time.Hour,
+	}
+}
+
+// stamp sets a task's defaults and the enqueuer's correlation IDs and trace
+// context in its metadata
+func stamp(ctx context.Context, task *Task, now time.Time) {
+	if task.ID == "" {
+		task.ID = uuid.New().String()
+	}
+	if task.CreatedAt.IsZero() {
+		task.CreatedAt = now.UTC()
+	}
+	if task.Metadata == nil {
+		task.Metadata = make(map[string]string)
+	}
+
+	if correlationID := middleware.GetCorrelationID(ctx); correlationID != "" {
+		task.Metadata[MetadataCorrelationID] = correlationID
+	}
+	if requestID := middleware.GetRequestID(ctx); requestID != "" {
+		task.Metadata[MetadataRequestID] = requestID
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(task.Metadata))
+}
+
+// handlerContext gives a handler the enqueuer's correlation IDs and trace
+// context. Tasks without a correlation ID use the task ID.
+func handlerContext(ctx context.Context, task *Task) context.Context {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(task.Metadata))
+
+	correlationID := task.Metadata[MetadataCorrelationID]
+	if correlationID == "" {
+		correlationID = task.ID
+	}
+	var traceID, spanID string
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		traceID, spanID = spanContext.TraceID().String(), spanContext.SpanID().String()
+	}
+	return middleware.WithCorrelationContext(ctx, correlationID, task.Metadata[MetadataRequestID], traceID, spanID)
+}
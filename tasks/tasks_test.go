@@ -0,0 +1,64 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type delivery struct {
+	WebhookID string `json:"webhook_id"`
+	URL       string `json:"url"`
+}
+
+func TestNewTaskAndDecode(t *testing.T) {
+	task, err := NewTask("webhook.deliver", delivery{WebhookID: "wh-1", URL: "https://partner.example/hooks"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, task.ID)
+	assert.Equal(t, "webhook.deliver", task.Type)
+
+	var payload delivery
+	require.NoError(t, task.Decode(&payload))
+	assert.Equal(t, "wh-1", payload.WebhookID)
+
+	task.Payload = []byte("not json")
+	err = task.Decode(&payload)
+	assert.Error(t, err)
+	assert.True(t, IsPermanent(err), "decode errors can't be fixed by retrying")
+}
+
+func TestPermanent(t *testing.T) {
+	cause := errors.New("endpoint rejected the payload")
+	err := Permanent(cause)
+
+	assert.True(t, IsPermanent(err))
+	assert.ErrorIs(t, err, cause)
+	assert.False(t, IsPermanent(cause))
+	assert.Nil(t, Permanent(nil))
+}
+
+func TestStampAndHandlerContext(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	ctx := middleware.WithCorrelationContext(context.Background(), "corr-1", "req-1", "", "")
+	task := &Task{Type: "notification.send"}
+	stamp(ctx, task, now)
+
+	assert.NotEmpty(t, task.ID)
+	assert.Equal(t, now, task.CreatedAt)
+	assert.Equal(t, "corr-1", task.Metadata[MetadataCorrelationID])
+	assert.Equal(t, "req-1", task.Metadata[MetadataRequestID])
+
+	seen := middleware.GetCorrelationContext(handlerContext(context.Background(), task))
+	require.NotNil(t, seen)
+	assert.Equal(t, "corr-1", seen.CorrelationID)
+	assert.Equal(t, "req-1", seen.RequestID)
+
+	// Tasks enqueued outside a request correlate on their own ID
+	seen = middleware.GetCorrelationContext(handlerContext(context.Background(), &Task{ID: "task-1"}))
+	assert.Equal(t, "task-1", seen.CorrelationID)
+}
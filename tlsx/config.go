@@ -0,0 +1,80 @@
+package tlsx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+)
+
+// ServerConfig returns a TLS configuration for servers that requires a
+// client certificate signed by a trusted CA. Each handshake uses the
+// current certificate and CAs, so rotations apply to new connections.
+// Use it for http.Server.TLSConfig or grpc credentials.NewTLS.
+func (c *Certificates) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return c.Certificate(), nil
+		},
+		// ClientCAs would be fixed when the config is built, so client
+		// certificates are verified by VerifyConnection with the current CAs
+		ClientAuth:       tls.RequireAnyClientCert,
+		VerifyConnection: c.verifyClient,
+	}
+}
+
+// verifyClient verifies a client's certificate chain against the current CAs
+func (c *Certificates) verifyClient(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("client presented no certificate")
+	}
+	return c.verify(state.PeerCertificates, x509.VerifyOptions{
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+}
+
+// ClientConfig returns a TLS configuration for clients that presents the
+// current certificate and verifies servers against the current CAs and
+// the server name being dialled.
+func (c *Certificates) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return c.Certificate(), nil
+		},
+		// The standard verification only knows the CAs of when the config
+		// was built, so it's replaced by VerifyConnection with the current ones
+		InsecureSkipVerify: true,
+		VerifyConnection:   c.verifyServer,
+	}
+}
+
+// verifyServer verifies a server's certificate chain and name against the
+// current CAs
+func (c *Certificates) verifyServer(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+	return c.verify(state.PeerCertificates, x509.VerifyOptions{DNSName: state.ServerName})
+}
+
+// verify verifies a peer's certificate chain, leaf first, against the
+// current CAs
+func (c *Certificates) verify(chain []*x509.Certificate, options x509.VerifyOptions) error {
+	options.Roots = c.Roots()
+	options.Intermediates = x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		options.Intermediates.AddCert(cert)
+	}
+	_, err := chain[0].Verify(options)
+	return err
+}
+
+// Transport returns an HTTP transport that calls other services over
+// mutual TLS
+func (c *Certificates) Transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = c.ClientConfig()
+	return transport
+}
@@ -0,0 +1,103 @@
+package tlsx
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMTLSServer serves the caller's SPIFFE ID over mutual TLS
+func newMTLSServer(t *testing.T, certs *Certificates) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(PeerIdentityMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, GetPeerIdentity(r.Context()).ID())
+	})))
+	server.TLS = certs.ServerConfig()
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// get calls url with a fresh connection and returns the response body
+func get(client *http.Client, url string) (string, error) {
+	client.CloseIdleConnections()
+	resp, err := client.Get(strings.Replace(url, "127.0.0.1", "localhost", 1))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	serverCerts, err := Load(writeIdentity(t, t.TempDir(), ca, "validation-service", time.Now().Add(time.Hour)))
+	require.NoError(t, err)
+	clientCerts, err := Load(writeIdentity(t, t.TempDir(), ca, "gateway", time.Now().Add(time.Hour)))
+	require.NoError(t, err)
+	server := newMTLSServer(t, serverCerts)
+
+	body, err := get(&http.Client{Transport: clientCerts.Transport()}, server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "spiffe://jarakey.internal/ns/prod/sa/gateway", body)
+
+	// Without a client certificate the handshake fails
+	anonymous := http.DefaultTransport.(*http.Transport).Clone()
+	anonymous.TLSClientConfig = clientCerts.ClientConfig()
+	anonymous.TLSClientConfig.GetClientCertificate = nil
+	_, err = get(&http.Client{Transport: anonymous}, server.URL)
+	assert.Error(t, err)
+
+	// A client from another CA is rejected
+	otherCerts, err := Load(writeIdentity(t, t.TempDir(), newTestCA(t, "other"), "intruder", time.Now().Add(time.Hour)))
+	require.NoError(t, err)
+	_, err = get(&http.Client{Transport: otherCerts.Transport()}, server.URL)
+	assert.Error(t, err)
+}
+
+func TestMutualTLSVerifiesServer(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	clientCerts, err := Load(writeIdentity(t, t.TempDir(), ca, "gateway", time.Now().Add(time.Hour)))
+	require.NoError(t, err)
+
+	// A server with a certificate from another CA
+	otherCerts, err := Load(writeIdentity(t, t.TempDir(), newTestCA(t, "other"), "impostor", time.Now().Add(time.Hour)))
+	require.NoError(t, err)
+	server := newMTLSServer(t, otherCerts)
+	_, err = get(&http.Client{Transport: clientCerts.Transport()}, server.URL)
+	assert.ErrorContains(t, err, "unknown authority")
+}
+
+func TestMutualTLSFollowsRotation(t *testing.T) {
+	oldCA, newCA := newTestCA(t, "old"), newTestCA(t, "new")
+	serverConfig := writeIdentity(t, t.TempDir(), oldCA, "validation-service", time.Now().Add(time.Hour))
+	serverCerts, err := Load(serverConfig)
+	require.NoError(t, err)
+	clientCerts, err := Load(writeIdentity(t, t.TempDir(), newCA, "gateway", time.Now().Add(time.Hour)))
+	require.NoError(t, err)
+	server := newMTLSServer(t, serverCerts)
+	client := &http.Client{Transport: clientCerts.Transport()}
+
+	_, err = get(client, server.URL)
+	require.Error(t, err, "the server doesn't trust the new CA yet")
+
+	// The server is rotated to the new CA without a restart
+	writeIdentity(t, filepath.Dir(serverConfig.CertFile), newCA, "validation-service", time.Now().Add(time.Hour))
+	require.NoError(t, os.WriteFile(serverConfig.CAFile, append(oldCA.pem, newCA.pem...), 0o600))
+	changed, err := serverCerts.Reload()
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	body, err := get(client, server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "spiffe://jarakey.internal/ns/prod/sa/gateway", body)
+}
@@ -0,0 +1,122 @@
+package tlsx
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// PeerIdentity is who a client certificate was issued to
+type PeerIdentity struct {
+	// SPIFFEID is the certificate's spiffe:// URI SAN, e.g.
+	// "spiffe://jarakey.internal/ns/prod/sa/validation-service"
+	SPIFFEID    string   `json:"spiffe_id,omitempty"`
+	TrustDomain string   `json:"trust_domain,omitempty"`
+	CommonName  string   `json:"common_name,omitempty"`
+	DNSNames    []string `json:"dns_names,omitempty"`
+}
+
+// ID returns the SPIFFE ID, or the common name for certificates without one
+func (p *PeerIdentity) ID() string {
+	if p.SPIFFEID != "" {
+		return p.SPIFFEID
+	}
+	return p.CommonName
+}
+
+// Matches reports whether the identity matches pattern: a SPIFFE ID or
+// common name, or a SPIFFE ID prefix ending in "/*", e.g.
+// "spiffe://jarakey.internal/ns/prod/*"
+func (p *PeerIdentity) Matches(pattern string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return p.SPIFFEID != "" && strings.HasPrefix(p.SPIFFEID, prefix+"/")
+	}
+	return pattern == p.SPIFFEID || pattern == p.CommonName
+}
+
+// IdentityFromCertificate returns the identity a certificate was issued to
+func IdentityFromCertificate(cert *x509.Certificate) *PeerIdentity {
+	identity := &PeerIdentity{
+		CommonName: cert.Subject.CommonName,
+		DNSNames:   cert.DNSNames,
+	}
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			identity.SPIFFEID = uri.String()
+			identity.TrustDomain = uri.Host
+			break
+		}
+	}
+	return identity
+}
+
+// peerIdentity returns the identity of r's client certificate, or nil
+func peerIdentity(r *http.Request) *PeerIdentity {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return IdentityFromCertificate(r.TLS.PeerCertificates[0])
+}
+
+// authorizePeer returns the error for a peer that isn't allowed, or nil
+func authorizePeer(identity *PeerIdentity, allowed []string) *types.APIError {
+	if identity == nil {
+		return types.NewUnauthorizedError("Client certificate required")
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, pattern := range allowed {
+		if identity.Matches(pattern) {
+			return nil
+		}
+	}
+	return types.NewForbiddenError("Peer is not allowed to call this service")
+}
+
+// PeerIdentityMiddleware creates middleware that puts the identity of the
+// caller's client certificate into the request context, answering 401
+// Unauthorized without one. When allowed is given only matching peers get
+// through; others get 403 Forbidden. Serve with ServerConfig so the
+// certificate has been verified.
+func PeerIdentityMiddleware(allowed ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity := peerIdentity(r)
+			if err := authorizePeer(identity, allowed); err != nil {
+				middleware.RenderError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithPeerIdentity(r.Context(), identity)))
+		})
+	}
+}
+
+// GinPeerIdentityMiddleware creates peer identity middleware for Gin framework
+func GinPeerIdentityMiddleware(allowed ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity := peerIdentity(c.Request)
+		if err := authorizePeer(identity, allowed); err != nil {
+			middleware.GinRenderError(c, err)
+			return
+		}
+		c.Request = c.Request.WithContext(WithPeerIdentity(c.Request.Context(), identity))
+		c.Next()
+	}
+}
+
+// WithPeerIdentity adds a peer identity to the context
+func WithPeerIdentity(ctx context.Context, identity *PeerIdentity) context.Context {
+	return context.WithValue(ctx, "peer_identity", identity)
+}
+
+// GetPeerIdentity returns the caller's peer identity, or nil
+func GetPeerIdentity(ctx context.Context) *PeerIdentity {
+	identity, _ := ctx.Value("peer_identity").(*PeerIdentity)
+	return identity
+}
@@ -0,0 +1,91 @@
+package tlsx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCertificate issues a parsed certificate for a service
+func testCertificate(t *testing.T, service string) *x509.Certificate {
+	t.Helper()
+	certPEM, _ := newTestCA(t, "ca").issue(t, service, time.Now().Add(time.Hour))
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestIdentityFromCertificate(t *testing.T) {
+	identity := IdentityFromCertificate(testCertificate(t, "gateway"))
+	assert.Equal(t, &PeerIdentity{
+		SPIFFEID:    "spiffe://jarakey.internal/ns/prod/sa/gateway",
+		TrustDomain: "jarakey.internal",
+		CommonName:  "gateway",
+		DNSNames:    []string{"localhost"},
+	}, identity)
+	assert.Equal(t, identity.SPIFFEID, identity.ID())
+
+	assert.Equal(t, "legacy", (&PeerIdentity{CommonName: "legacy"}).ID())
+}
+
+func TestPeerIdentityMatches(t *testing.T) {
+	identity := &PeerIdentity{SPIFFEID: "spiffe://jarakey.internal/ns/prod/sa/gateway", CommonName: "gateway"}
+
+	assert.True(t, identity.Matches("spiffe://jarakey.internal/ns/prod/sa/gateway"))
+	assert.True(t, identity.Matches("gateway"))
+	assert.True(t, identity.Matches("spiffe://jarakey.internal/ns/prod/*"))
+	assert.False(t, identity.Matches("spiffe://jarakey.internal/ns/staging/*"))
+	assert.False(t, identity.Matches("spiffe://jarakey.internal/ns/pro/*"), "prefixes match whole path segments")
+	assert.False(t, (&PeerIdentity{CommonName: "gateway"}).Matches("spiffe://jarakey.internal/*"))
+}
+
+func TestPeerIdentityMiddleware(t *testing.T) {
+	cert := testCertificate(t, "gateway")
+	handler := PeerIdentityMiddleware("spiffe://jarakey.internal/ns/prod/sa/gateway")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gateway", GetPeerIdentity(r.Context()).CommonName)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(certs ...*x509.Certificate) int {
+		r := httptest.NewRequest(http.MethodGet, "/internal/codes", nil)
+		if certs != nil {
+			r.TLS = &tls.ConnectionState{PeerCertificates: certs}
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, serve(cert))
+	assert.Equal(t, http.StatusUnauthorized, serve())
+	assert.Equal(t, http.StatusForbidden, serve(testCertificate(t, "reports")))
+}
+
+func TestGinPeerIdentityMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(GinPeerIdentityMiddleware())
+	router.GET("/internal/codes", func(c *gin.Context) {
+		c.String(http.StatusOK, GetPeerIdentity(c.Request.Context()).ID())
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/internal/codes", nil)
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{testCertificate(t, "reports")}}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "spiffe://jarakey.internal/ns/prod/sa/reports", w.Body.String(), "any verified peer gets through without an allow list")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/internal/codes", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,140 @@
+package tlsx
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA signs certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM certificate and key of a leaf for a service, valid
+// for localhost as a server and as a client
+func (ca *testCA) issue(t *testing.T, service string, notAfter time.Time) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	spiffeID, err := url.Parse("spiffe://jarakey.internal/ns/prod/sa/" + service)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: service},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		URIs:         []*url.URL{spiffeID},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeIdentity writes a service's files to dir and returns their config
+func writeIdentity(t *testing.T, dir string, ca *testCA, service string, notAfter time.Time) *Config {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, service, notAfter)
+	config := DefaultConfig()
+	config.CertFile = filepath.Join(dir, "tls.crt")
+	config.KeyFile = filepath.Join(dir, "tls.key")
+	config.CAFile = filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(config.CertFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(config.KeyFile, keyPEM, 0o600))
+	require.NoError(t, os.WriteFile(config.CAFile, ca.pem, 0o600))
+	return config
+}
+
+func TestLoad(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	notAfter := time.Now().Add(time.Hour).Truncate(time.Second)
+	config := writeIdentity(t, t.TempDir(), ca, "validation-service", notAfter)
+
+	certs, err := Load(config)
+	require.NoError(t, err)
+	assert.Equal(t, "validation-service", certs.Certificate().Leaf.Subject.CommonName)
+	assert.True(t, certs.NotAfter().Equal(notAfter))
+	assert.NotNil(t, certs.Roots())
+
+	_, err = Load(&Config{CertFile: config.CertFile, KeyFile: config.KeyFile})
+	assert.Error(t, err, "the CA bundle is required")
+
+	missing := *config
+	missing.KeyFile = filepath.Join(t.TempDir(), "missing.key")
+	_, err = Load(&missing)
+	assert.ErrorContains(t, err, "TLS key")
+
+	require.NoError(t, os.WriteFile(config.CAFile, []byte("not a certificate"), 0o600))
+	_, err = Load(config)
+	assert.ErrorContains(t, err, "no certificates")
+}
+
+func TestReload(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	dir := t.TempDir()
+	config := writeIdentity(t, dir, ca, "validation-service", time.Now().Add(time.Hour))
+	certs, err := Load(config)
+	require.NoError(t, err)
+	first := certs.Certificate()
+
+	changed, err := certs.Reload()
+	require.NoError(t, err)
+	assert.False(t, changed, "unchanged files aren't reloaded")
+
+	// A rotation that has written the certificate but not yet its key
+	rotatedCert, rotatedKey := ca.issue(t, "validation-service", time.Now().Add(2*time.Hour))
+	require.NoError(t, os.WriteFile(config.CertFile, rotatedCert, 0o600))
+	changed, err = certs.Reload()
+	assert.Error(t, err)
+	assert.False(t, changed)
+	assert.Same(t, first, certs.Certificate(), "the current certificate stays in use")
+
+	require.NoError(t, os.WriteFile(config.KeyFile, rotatedKey, 0o600))
+	changed, err = certs.Reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.NotSame(t, first, certs.Certificate())
+	assert.True(t, certs.NotAfter().After(time.Now().Add(time.Hour)))
+}
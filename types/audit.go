@@ -0,0 +1,47 @@
+package types
+
+import "time"
+
+// AuditFields records who created and last changed a record, and when it was
+// soft-deleted. Embed it in models; the sqlx tags map to the standard
+// created_at, updated_at, deleted_at, created_by and updated_by columns.
+type AuditFields struct {
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	CreatedBy string     `json:"created_by,omitempty" db:"created_by"`
+	UpdatedBy string     `json:"updated_by,omitempty" db:"updated_by"`
+}
+
+// Touch records a change by actor, filling in the creation fields the first time
+func (a *AuditFields) Touch(actor string) {
+	now := time.Now()
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = now
+		a.CreatedBy = actor
+	}
+	a.UpdatedAt = now
+	a.UpdatedBy = actor
+}
+
+// SoftDelete marks the record deleted by actor. Deleting twice keeps the
+// original deletion time.
+func (a *AuditFields) SoftDelete(actor string) {
+	if a.DeletedAt != nil {
+		return
+	}
+	a.Touch(actor)
+	deletedAt := a.UpdatedAt
+	a.DeletedAt = &deletedAt
+}
+
+// Restore undoes a soft delete
+func (a *AuditFields) Restore(actor string) {
+	a.DeletedAt = nil
+	a.Touch(actor)
+}
+
+// IsDeleted reports whether the record has been soft-deleted
+func (a AuditFields) IsDeleted() bool {
+	return a.DeletedAt != nil
+}
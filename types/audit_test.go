@@ -0,0 +1,75 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAuditFieldsTouch(t *testing.T) {
+	var audit AuditFields
+	audit.Touch("user-1")
+
+	if audit.CreatedAt.IsZero() || audit.CreatedBy != "user-1" || audit.UpdatedBy != "user-1" {
+		t.Errorf("Expected creation fields to be set, got %+v", audit)
+	}
+
+	created := audit.CreatedAt
+	time.Sleep(time.Millisecond)
+	audit.Touch("user-2")
+
+	if !audit.CreatedAt.Equal(created) || audit.CreatedBy != "user-1" {
+		t.Errorf("Expected creation fields to be kept, got %+v", audit)
+	}
+	if !audit.UpdatedAt.After(created) || audit.UpdatedBy != "user-2" {
+		t.Errorf("Expected update fields to change, got %+v", audit)
+	}
+}
+
+func TestAuditFieldsSoftDelete(t *testing.T) {
+	code := AccessCode{ID: "code-1"}
+	code.Touch("user-1")
+
+	if code.IsDeleted() {
+		t.Errorf("Expected new record not to be deleted")
+	}
+
+	code.SoftDelete("admin-1")
+	if !code.IsDeleted() || code.UpdatedBy != "admin-1" {
+		t.Errorf("Expected record to be deleted by admin-1, got %+v", code.AuditFields)
+	}
+
+	deletedAt := *code.DeletedAt
+	code.SoftDelete("admin-2")
+	if !code.DeletedAt.Equal(deletedAt) || code.UpdatedBy != "admin-1" {
+		t.Errorf("Expected second delete to be a no-op, got %+v", code.AuditFields)
+	}
+
+	code.Restore("admin-2")
+	if code.IsDeleted() || code.UpdatedBy != "admin-2" {
+		t.Errorf("Expected record to be restored, got %+v", code.AuditFields)
+	}
+}
+
+func TestAuditFieldsJSON(t *testing.T) {
+	user := User{ID: "user-1", AuditFields: AuditFields{CreatedAt: time.Unix(0, 0).UTC()}}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		t.Fatalf("Failed to marshal user: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	json.Unmarshal(data, &decoded)
+
+	// Embedded fields stay at the top level, as before
+	if decoded["created_at"] != "1970-01-01T00:00:00Z" {
+		t.Errorf("Expected flattened created_at, got %v", decoded["created_at"])
+	}
+	if _, ok := decoded["deleted_at"]; ok {
+		t.Errorf("Expected deleted_at to be omitted, got %s", data)
+	}
+	if _, ok := decoded["AuditFields"]; ok {
+		t.Errorf("Expected no nested AuditFields object, got %s", data)
+	}
+}
@@ -0,0 +1,219 @@
+package types
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+var (
+	// ErrInvalidEmail is returned for malformed email addresses
+	ErrInvalidEmail = errors.New("invalid email address")
+	// ErrInvalidPhoneNumber is returned for numbers that can't be put in E.164 form
+	ErrInvalidPhoneNumber = errors.New("invalid phone number")
+)
+
+// maxEmailLength is the longest address that fits in SMTP forward paths
+const maxEmailLength = 254
+
+// Email is a normalized email address: trimmed and lowercased
+type Email string
+
+// ParseEmail normalizes and validates a bare email address. Display names
+// ("Jane <jane@example.com>") are rejected.
+func ParseEmail(s string) (Email, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || len(s) > maxEmailLength {
+		return "", ErrInvalidEmail
+	}
+
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s || addr.Name != "" {
+		return "", ErrInvalidEmail
+	}
+
+	_, domain, _ := strings.Cut(s, "@")
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", ErrInvalidEmail
+	}
+	return Email(s), nil
+}
+
+// String returns the address
+func (e Email) String() string {
+	return string(e)
+}
+
+// IsZero reports whether the address is empty
+func (e Email) IsZero() bool {
+	return e == ""
+}
+
+// Domain returns the part after the @
+func (e Email) Domain() string {
+	_, domain, _ := strings.Cut(string(e), "@")
+	return domain
+}
+
+// UnmarshalJSON parses and normalizes the address; an empty string is allowed
+func (e *Email) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if strings.TrimSpace(s) == "" {
+		*e = ""
+		return nil
+	}
+
+	parsed, err := ParseEmail(s)
+	if err != nil {
+		return fmt.Errorf("%w: %q", err, s)
+	}
+	*e = parsed
+	return nil
+}
+
+// Value implements driver.Valuer, refusing to write malformed addresses
+func (e Email) Value() (driver.Value, error) {
+	if e == "" {
+		return "", nil
+	}
+	parsed, err := ParseEmail(string(e))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", err, string(e))
+	}
+	return string(parsed), nil
+}
+
+// Scan implements sql.Scanner. Stored values are normalized but not
+// validated, so rows written before validation existed can still be read.
+func (e *Email) Scan(src interface{}) error {
+	s, err := scanString(src)
+	if err != nil {
+		return fmt.Errorf("cannot scan email: %w", err)
+	}
+	*e = Email(strings.ToLower(strings.TrimSpace(s)))
+	return nil
+}
+
+// PhoneNumber is a phone number in E.164 form, e.g. +14155550123
+type PhoneNumber string
+
+// phoneSeparators are the formatting characters people type in numbers
+var phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "", "/", "")
+
+// ParsePhoneNumber normalizes an international number to E.164. The number
+// must start with + or the 00 international prefix.
+func ParsePhoneNumber(s string) (PhoneNumber, error) {
+	s = phoneSeparators.Replace(strings.TrimSpace(s))
+	switch {
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	case strings.HasPrefix(s, "00"):
+		s = s[2:]
+	default:
+		return "", ErrInvalidPhoneNumber
+	}
+
+	// E.164 allows at most 15 digits and country codes never start with 0
+	if len(s) < 7 || len(s) > 15 || s[0] == '0' || !isDigits(s) {
+		return "", ErrInvalidPhoneNumber
+	}
+	return PhoneNumber("+" + s), nil
+}
+
+// ParseNationalPhoneNumber normalizes a number that may be in national
+// format, using callingCode (e.g. "44") for numbers without a country code.
+// A national trunk prefix 0 is dropped.
+func ParseNationalPhoneNumber(s, callingCode string) (PhoneNumber, error) {
+	trimmed := phoneSeparators.Replace(strings.TrimSpace(s))
+	if strings.HasPrefix(trimmed, "+") || strings.HasPrefix(trimmed, "00") {
+		return ParsePhoneNumber(trimmed)
+	}
+	if callingCode == "" || !isDigits(callingCode) {
+		return "", ErrInvalidPhoneNumber
+	}
+	return ParsePhoneNumber("+" + callingCode + strings.TrimPrefix(trimmed, "0"))
+}
+
+// String returns the number in E.164 form
+func (p PhoneNumber) String() string {
+	return string(p)
+}
+
+// IsZero reports whether the number is empty
+func (p PhoneNumber) IsZero() bool {
+	return p == ""
+}
+
+// UnmarshalJSON parses and normalizes the number; an empty string is allowed
+func (p *PhoneNumber) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if strings.TrimSpace(s) == "" {
+		*p = ""
+		return nil
+	}
+
+	parsed, err := ParsePhoneNumber(s)
+	if err != nil {
+		return fmt.Errorf("%w: %q", err, s)
+	}
+	*p = parsed
+	return nil
+}
+
+// Value implements driver.Valuer, refusing to write numbers not in E.164 form
+func (p PhoneNumber) Value() (driver.Value, error) {
+	if p == "" {
+		return "", nil
+	}
+	parsed, err := ParsePhoneNumber(string(p))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", err, string(p))
+	}
+	return string(parsed), nil
+}
+
+// Scan implements sql.Scanner. Stored values are read as they are.
+func (p *PhoneNumber) Scan(src interface{}) error {
+	s, err := scanString(src)
+	if err != nil {
+		return fmt.Errorf("cannot scan phone number: %w", err)
+	}
+	*p = PhoneNumber(strings.TrimSpace(s))
+	return nil
+}
+
+// scanString converts a database value to a string; NULL becomes ""
+func scanString(src interface{}) (string, error) {
+	switch v := src.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	default:
+		return "", fmt.Errorf("unsupported type %T", src)
+	}
+}
+
+// isDigits reports whether s is non-empty and only ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
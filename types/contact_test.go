@@ -0,0 +1,114 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseEmail(t *testing.T) {
+	valid := map[string]Email{
+		"user@example.com":          "user@example.com",
+		"  User.Name@Example.COM  ": "user.name@example.com",
+		"a+tag@sub.example.co.uk":   "a+tag@sub.example.co.uk",
+	}
+	for input, expected := range valid {
+		email, err := ParseEmail(input)
+		if err != nil || email != expected {
+			t.Errorf("ParseEmail(%q) = %q, %v; expected %q", input, email, err, expected)
+		}
+	}
+
+	invalid := []string{"", "user", "user@", "@example.com", "user@localhost", "Jane <jane@example.com>", "a@b@example.com", "user@example."}
+	for _, input := range invalid {
+		if _, err := ParseEmail(input); !errors.Is(err, ErrInvalidEmail) {
+			t.Errorf("Expected ParseEmail(%q) to fail, got %v", input, err)
+		}
+	}
+
+	if Email("user@example.com").Domain() != "example.com" {
+		t.Errorf("Expected domain example.com")
+	}
+}
+
+func TestParsePhoneNumber(t *testing.T) {
+	valid := map[string]PhoneNumber{
+		"+1 (415) 555-0123": "+14155550123",
+		"0044 20 7946 0958": "+442079460958",
+		"+49.30.901820":     "+4930901820",
+	}
+	for input, expected := range valid {
+		phone, err := ParsePhoneNumber(input)
+		if err != nil || phone != expected {
+			t.Errorf("ParsePhoneNumber(%q) = %q, %v; expected %q", input, phone, err, expected)
+		}
+	}
+
+	invalid := []string{"", "4155550123", "+0123456789", "+1234", "+1234567890123456", "+1 415 CALL NOW"}
+	for _, input := range invalid {
+		if _, err := ParsePhoneNumber(input); !errors.Is(err, ErrInvalidPhoneNumber) {
+			t.Errorf("Expected ParsePhoneNumber(%q) to fail, got %v", input, err)
+		}
+	}
+
+	phone, err := ParseNationalPhoneNumber("020 7946 0958", "44")
+	if err != nil || phone != "+442079460958" {
+		t.Errorf("Expected national number to gain the calling code, got %q, %v", phone, err)
+	}
+	phone, err = ParseNationalPhoneNumber("+1 415 555 0123", "44")
+	if err != nil || phone != "+14155550123" {
+		t.Errorf("Expected international number to keep its country code, got %q, %v", phone, err)
+	}
+}
+
+func TestContactJSON(t *testing.T) {
+	var invite UserInvited
+	if err := json.Unmarshal([]byte(`{"email":" Guard@Example.com "}`), &invite); err != nil {
+		t.Fatalf("Failed to unmarshal invite: %v", err)
+	}
+	if invite.Email != "guard@example.com" {
+		t.Errorf("Expected normalized email, got %q", invite.Email)
+	}
+
+	if err := json.Unmarshal([]byte(`{"email":"not-an-email"}`), &invite); !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("Expected ErrInvalidEmail, got %v", err)
+	}
+
+	var user User
+	if err := json.Unmarshal([]byte(`{"email":""}`), &user); err != nil || !user.Email.IsZero() {
+		t.Errorf("Expected empty email to be accepted, got %q, %v", user.Email, err)
+	}
+
+	var phone PhoneNumber
+	if err := json.Unmarshal([]byte(`"+44 20 7946 0958"`), &phone); err != nil || phone != "+442079460958" {
+		t.Errorf("Expected normalized phone number, got %q, %v", phone, err)
+	}
+}
+
+func TestContactSQL(t *testing.T) {
+	if _, err := Email("not-an-email").Value(); !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("Expected malformed email to be refused, got %v", err)
+	}
+	if value, err := Email("User@Example.com").Value(); err != nil || value != "user@example.com" {
+		t.Errorf("Expected normalized value, got %v, %v", value, err)
+	}
+
+	var email Email
+	if err := email.Scan([]byte(" Legacy@Example.com")); err != nil || email != "legacy@example.com" {
+		t.Errorf("Expected scanned email to be normalized, got %q, %v", email, err)
+	}
+	if err := email.Scan(nil); err != nil || !email.IsZero() {
+		t.Errorf("Expected NULL to scan as empty, got %q, %v", email, err)
+	}
+	if err := email.Scan(42); err == nil {
+		t.Errorf("Expected an error scanning an integer")
+	}
+
+	if _, err := PhoneNumber("555-0123").Value(); !errors.Is(err, ErrInvalidPhoneNumber) {
+		t.Errorf("Expected malformed phone number to be refused, got %v", err)
+	}
+	var phone PhoneNumber
+	if err := phone.Scan("+14155550123"); err != nil || phone != "+14155550123" {
+		t.Errorf("Expected scanned phone number, got %q, %v", phone, err)
+	}
+}
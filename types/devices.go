@@ -0,0 +1,210 @@
+package types
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxOfflineBatchSize is the most validations a device may upload in one batch
+const MaxOfflineBatchSize = 500
+
+var (
+	// ErrInvalidDeviceKey is returned when a device's public key can't be decoded
+	ErrInvalidDeviceKey = errors.New("invalid device public key")
+	// ErrInvalidBatchSignature is returned when a batch isn't signed by its device
+	ErrInvalidBatchSignature = errors.New("invalid batch signature")
+	// ErrDeviceRevoked is returned for batches from revoked devices
+	ErrDeviceRevoked = errors.New("device revoked")
+)
+
+// ValidatorDevice is a phone or tablet a validator uses to check codes,
+// including offline. The device holds the private half of PublicKey and
+// signs the validation batches it uploads with it.
+type ValidatorDevice struct {
+	ID          string   `json:"id" db:"id"`
+	ValidatorID string   `json:"validator_id" db:"validator_id"`
+	OrgID       string   `json:"org_id" db:"org_id"`
+	Name        string   `json:"name" db:"name"`
+	Platform    string   `json:"platform" db:"platform"` // ios, android
+	AppVersion  string   `json:"app_version" db:"app_version"`
+	PublicKey   string   `json:"public_key" db:"public_key"` // Base64url Ed25519 public key
+	LastSeenAt  NullTime `json:"last_seen_at" db:"last_seen_at"`
+	RevokedAt   NullTime `json:"revoked_at" db:"revoked_at"`
+	AuditFields
+}
+
+// IsActive reports whether the device may validate codes and upload batches
+func (d *ValidatorDevice) IsActive() bool {
+	return !d.RevokedAt.Valid() && !d.IsDeleted()
+}
+
+// Seen records that the device connected running appVersion
+func (d *ValidatorDevice) Seen(appVersion string, at time.Time) {
+	d.LastSeenAt = Some(at)
+	if appVersion != "" {
+		d.AppVersion = appVersion
+	}
+}
+
+// Revoke stops the device from uploading further batches
+func (d *ValidatorDevice) Revoke(actor string) {
+	if !d.RevokedAt.Valid() {
+		d.Touch(actor)
+		d.RevokedAt = Some(d.UpdatedAt)
+	}
+}
+
+// Ed25519PublicKey decodes the device's public key
+func (d *ValidatorDevice) Ed25519PublicKey() (ed25519.PublicKey, error) {
+	key, err := base64.RawURLEncoding.DecodeString(d.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, ErrInvalidDeviceKey
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// OfflineValidation is one code check a device made while offline
+type OfflineValidation struct {
+	ClientID    string    `json:"client_id"` // Generated on the device; makes uploads idempotent
+	Code        string    `json:"code"`
+	Nonce       string    `json:"nonce,omitempty"` // QR code nonce, for replay detection
+	Status      string    `json:"status"`          // valid, invalid, expired
+	Location    string    `json:"location,omitempty"`
+	ValidatedAt time.Time `json:"validated_at"`
+}
+
+// ValidationLog converts the validation into a log entry for the code it matched
+func (v OfflineValidation) ValidationLog(device *ValidatorDevice, codeID string) ValidationLog {
+	return ValidationLog{
+		ID:          v.ClientID,
+		CodeID:      codeID,
+		ValidatorID: device.ValidatorID,
+		Status:      v.Status,
+		UserAgent:   strings.TrimSpace(device.Platform + "/" + device.AppVersion),
+		Location:    v.Location,
+		CreatedAt:   v.ValidatedAt,
+	}
+}
+
+// OfflineValidationBatch is a signed set of offline validations uploaded when
+// a device reconnects
+type OfflineValidationBatch struct {
+	BatchID     string              `json:"batch_id"`
+	DeviceID    string              `json:"device_id"`
+	Validations []OfflineValidation `json:"validations"`
+	CreatedAt   time.Time           `json:"created_at"`
+	Signature   string              `json:"signature"` // Base64url Ed25519 signature of SigningPayload
+}
+
+// SigningPayload returns the bytes the batch signature covers: the batch
+// encoded as JSON with an empty signature
+func (b *OfflineValidationBatch) SigningPayload() ([]byte, error) {
+	unsigned := *b
+	unsigned.Signature = ""
+	return json.Marshal(unsigned)
+}
+
+// Sign signs the batch with the device's private key
+func (b *OfflineValidationBatch) Sign(key ed25519.PrivateKey) error {
+	payload, err := b.SigningPayload()
+	if err != nil {
+		return fmt.Errorf("failed to encode batch: %w", err)
+	}
+	b.Signature = base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, payload))
+	return nil
+}
+
+// Verify checks that the batch was signed by the device and that the device
+// is still active
+func (b *OfflineValidationBatch) Verify(device *ValidatorDevice) error {
+	if b.DeviceID != device.ID {
+		return fmt.Errorf("%w: batch is from device %s", ErrInvalidBatchSignature, b.DeviceID)
+	}
+	if !device.IsActive() {
+		return ErrDeviceRevoked
+	}
+
+	key, err := device.Ed25519PublicKey()
+	if err != nil {
+		return err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(b.Signature)
+	if err != nil {
+		return ErrInvalidBatchSignature
+	}
+	payload, err := b.SigningPayload()
+	if err != nil {
+		return fmt.Errorf("failed to encode batch: %w", err)
+	}
+	if !ed25519.Verify(key, payload, signature) {
+		return ErrInvalidBatchSignature
+	}
+	return nil
+}
+
+// Validate checks the batch, returning a validation APIError listing every
+// invalid field
+func (b *OfflineValidationBatch) Validate() error {
+	err := NewValidationError()
+
+	if b.BatchID == "" {
+		err.WithField("batch_id", "required", "Batch ID is required")
+	}
+	if b.DeviceID == "" {
+		err.WithField("device_id", "required", "Device ID is required")
+	}
+	if b.Signature == "" {
+		err.WithField("signature", "required", "Signature is required")
+	}
+
+	switch {
+	case len(b.Validations) == 0:
+		err.WithField("validations", "required", "At least one validation is required")
+	case len(b.Validations) > MaxOfflineBatchSize:
+		err.WithField("validations", "max", fmt.Sprintf("At most %d validations are allowed per batch", MaxOfflineBatchSize))
+	}
+
+	for i, v := range b.Validations {
+		if v.ClientID == "" {
+			err.WithField(fmt.Sprintf("validations[%d].client_id", i), "required", "Client ID is required")
+		}
+		switch v.Status {
+		case StatusValid, StatusInvalid, StatusExpired:
+		default:
+			err.WithField(fmt.Sprintf("validations[%d].status", i), "oneof", "Status must be one of valid, invalid, expired")
+		}
+	}
+
+	if len(err.Fields) > 0 {
+		return err
+	}
+	return nil
+}
+
+// BatchUploadRequest is the body a device sends when it reconnects
+type BatchUploadRequest struct {
+	DeviceID   string                   `json:"device_id"`
+	AppVersion string                   `json:"app_version"`
+	Batches    []OfflineValidationBatch `json:"batches"`
+}
+
+// BatchRejection explains why a validation in an upload was not stored
+type BatchRejection struct {
+	BatchID  string `json:"batch_id"`
+	ClientID string `json:"client_id,omitempty"` // Empty when the whole batch was rejected
+	Reason   string `json:"reason"`
+}
+
+// BatchUploadResponse tells the device which validations it can discard.
+// Duplicates were stored by an earlier upload and are safe to discard too.
+type BatchUploadResponse struct {
+	Accepted   []string         `json:"accepted"`
+	Duplicates []string         `json:"duplicates,omitempty"`
+	Rejected   []BatchRejection `json:"rejected,omitempty"`
+	SyncedAt   time.Time        `json:"synced_at"`
+}
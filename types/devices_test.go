@@ -0,0 +1,114 @@
+package types
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestDevice(t *testing.T) (*ValidatorDevice, ed25519.PrivateKey) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return &ValidatorDevice{
+		ID:          "device-1",
+		ValidatorID: "validator-1",
+		Platform:    "android",
+		AppVersion:  "2.4.0",
+		PublicKey:   base64.RawURLEncoding.EncodeToString(public),
+	}, private
+}
+
+func newTestBatch() *OfflineValidationBatch {
+	return &OfflineValidationBatch{
+		BatchID:  "batch-1",
+		DeviceID: "device-1",
+		Validations: []OfflineValidation{
+			{ClientID: "v-1", Code: "123456", Status: StatusValid, ValidatedAt: time.Now().UTC()},
+			{ClientID: "v-2", Code: "654321", Status: StatusExpired, ValidatedAt: time.Now().UTC()},
+		},
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+func TestOfflineValidationBatchSignature(t *testing.T) {
+	device, key := newTestDevice(t)
+	batch := newTestBatch()
+
+	if err := batch.Sign(key); err != nil {
+		t.Fatalf("Failed to sign batch: %v", err)
+	}
+	if err := batch.Validate(); err != nil {
+		t.Errorf("Expected signed batch to be valid, got %v", err)
+	}
+	if err := batch.Verify(device); err != nil {
+		t.Errorf("Expected signature to verify, got %v", err)
+	}
+
+	batch.Validations[0].Status = StatusInvalid
+	if err := batch.Verify(device); !errors.Is(err, ErrInvalidBatchSignature) {
+		t.Errorf("Expected tampered batch to fail, got %v", err)
+	}
+
+	other, _ := newTestDevice(t)
+	batch.Validations[0].Status = StatusValid
+	if err := batch.Verify(other); !errors.Is(err, ErrInvalidBatchSignature) {
+		t.Errorf("Expected batch to fail against another device key, got %v", err)
+	}
+
+	device.Revoke("admin-1")
+	if err := batch.Verify(device); !errors.Is(err, ErrDeviceRevoked) {
+		t.Errorf("Expected revoked device to be rejected, got %v", err)
+	}
+}
+
+func TestOfflineValidationBatchValidate(t *testing.T) {
+	var apiErr *APIError
+	empty := &OfflineValidationBatch{}
+	if !errors.As(empty.Validate(), &apiErr) || len(apiErr.Fields) != 4 {
+		t.Errorf("Expected 4 field errors, got %v", apiErr)
+	}
+
+	batch := newTestBatch()
+	batch.Signature = "sig"
+	batch.Validations[1].Status = "maybe"
+	batch.Validations[1].ClientID = ""
+	if !errors.As(batch.Validate(), &apiErr) || len(apiErr.Fields) != 2 {
+		t.Errorf("Expected 2 field errors, got %v", apiErr)
+	}
+
+	batch = newTestBatch()
+	batch.Signature = "sig"
+	batch.Validations = make([]OfflineValidation, MaxOfflineBatchSize+1)
+	if batch.Validate() == nil {
+		t.Errorf("Expected oversized batch to be rejected")
+	}
+}
+
+func TestValidatorDevice(t *testing.T) {
+	device, _ := newTestDevice(t)
+	if !device.IsActive() {
+		t.Errorf("Expected new device to be active")
+	}
+
+	seen := time.Now()
+	device.Seen("2.5.0", seen)
+	if device.AppVersion != "2.5.0" || !device.LastSeenAt.ValueOr(time.Time{}).Equal(seen) {
+		t.Errorf("Expected Seen to record the app version and time, got %+v", device)
+	}
+
+	log := newTestBatch().Validations[0].ValidationLog(device, "code-1")
+	if log.ID != "v-1" || log.CodeID != "code-1" || log.ValidatorID != "validator-1" || log.UserAgent != "android/2.5.0" {
+		t.Errorf("Unexpected validation log %+v", log)
+	}
+
+	device.PublicKey = "not-a-key"
+	if _, err := device.Ed25519PublicKey(); !errors.Is(err, ErrInvalidDeviceKey) {
+		t.Errorf("Expected ErrInvalidDeviceKey, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrorCode is a machine-readable error identifier returned to clients
+type ErrorCode string
+
+const (
+	ErrCodeBadRequest         ErrorCode = "bad_request"
+	ErrCodeValidationFailed   ErrorCode = "validation_failed"
+	ErrCodeUnauthorized       ErrorCode = "unauthorized"
+	ErrCodeInvalidToken       ErrorCode = "invalid_token"
+	ErrCodeForbidden          ErrorCode = "forbidden"
+	ErrCodeInsufficientScope  ErrorCode = "insufficient_scope"
+	ErrCodeNotFound           ErrorCode = "not_found"
+	ErrCodeConflict           ErrorCode = "conflict"
+	ErrCodePayloadTooLarge    ErrorCode = "payload_too_large"
+	ErrCodeUnsupportedMedia   ErrorCode = "unsupported_media_type"
+	ErrCodeCodeExpired        ErrorCode = "code_expired"
+	ErrCodeCodeUsed           ErrorCode = "code_used"
+	ErrCodeRateLimited        ErrorCode = "rate_limited"
+	ErrCodeQuotaExceeded      ErrorCode = "quota_exceeded"
+	ErrCodeChallengeRequired  ErrorCode = "challenge_required"
+	ErrCodeInternal           ErrorCode = "internal_error"
+	ErrCodeBadGateway         ErrorCode = "bad_gateway"
+	ErrCodeServiceUnavailable ErrorCode = "service_unavailable"
+	ErrCodeTimeout            ErrorCode = "timeout"
+)
+
+// errorCodeStatus maps error codes to their default HTTP status
+var errorCodeStatus = map[ErrorCode]int{
+	ErrCodeBadRequest:         http.StatusBadRequest,
+	ErrCodeValidationFailed:   http.StatusUnprocessableEntity,
+	ErrCodeUnauthorized:       http.StatusUnauthorized,
+	ErrCodeInvalidToken:       http.StatusUnauthorized,
+	ErrCodeForbidden:          http.StatusForbidden,
+	ErrCodeInsufficientScope:  http.StatusForbidden,
+	ErrCodeNotFound:           http.StatusNotFound,
+	ErrCodeConflict:           http.StatusConflict,
+	ErrCodePayloadTooLarge:    http.StatusRequestEntityTooLarge,
+	ErrCodeUnsupportedMedia:   http.StatusUnsupportedMediaType,
+	ErrCodeCodeExpired:        http.StatusGone,
+	ErrCodeCodeUsed:           http.StatusConflict,
+	ErrCodeRateLimited:        http.StatusTooManyRequests,
+	ErrCodeQuotaExceeded:      http.StatusTooManyRequests,
+	ErrCodeChallengeRequired:  http.StatusPreconditionRequired,
+	ErrCodeInternal:           http.StatusInternalServerError,
+	ErrCodeBadGateway:         http.StatusBadGateway,
+	ErrCodeServiceUnavailable: http.StatusServiceUnavailable,
+	ErrCodeTimeout:            http.StatusGatewayTimeout,
+}
+
+// Status returns the default HTTP status for the code, 500 for unknown codes
+func (c ErrorCode) Status() int {
+	if status, ok := errorCodeStatus[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// FieldError describes a problem with one request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// APIError is the standard error payload. It is a superset of APIResponse,
+// so clients reading success/message/error keep working.
+type APIError struct {
+	Code          ErrorCode    `json:"error"`
+	Status        int          `json:"status"`
+	Message       string       `json:"message"`
+	Fields        []FieldError `json:"fields,omitempty"`
+	CorrelationID string       `json:"correlation_id,omitempty"`
+
+	// Cause is the underlying error; it is logged but never sent to clients
+	Cause error `json:"-"`
+}
+
+// NewAPIError creates an error with the default status for the code
+func NewAPIError(code ErrorCode, message string) *APIError {
+	return &APIError{Code: code, Status: code.Status(), Message: message}
+}
+
+// NewBadRequestError creates a 400 error
+func NewBadRequestError(message string) *APIError {
+	return NewAPIError(ErrCodeBadRequest, message)
+}
+
+// NewValidationError creates a 422 error listing the invalid fields
+func NewValidationError(fields ...FieldError) *APIError {
+	err := NewAPIError(ErrCodeValidationFailed, "Request validation failed")
+	err.Fields = fields
+	return err
+}
+
+// NewUnauthorizedError creates a 401 error
+func NewUnauthorizedError(message string) *APIError {
+	return NewAPIError(ErrCodeUnauthorized, message)
+}
+
+// NewForbiddenError creates a 403 error
+func NewForbiddenError(message string) *APIError {
+	return NewAPIError(ErrCodeForbidden, message)
+}
+
+// NewNotFoundError creates a 404 error for the named resource
+func NewNotFoundError(resource string) *APIError {
+	return NewAPIError(ErrCodeNotFound, fmt.Sprintf("%s not found", resource))
+}
+
+// NewConflictError creates a 409 error
+func NewConflictError(message string) *APIError {
+	return NewAPIError(ErrCodeConflict, message)
+}
+
+// NewInternalError creates a 500 error that hides the cause from clients
+func NewInternalError(cause error) *APIError {
+	err := NewAPIError(ErrCodeInternal, "An internal error occurred")
+	err.Cause = cause
+	return err
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Cause)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Unwrap returns the underlying cause
+func (e *APIError) Unwrap() error {
+	return e.Cause
+}
+
+// WithField adds a field error
+func (e *APIError) WithField(field, code, message string) *APIError {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Message: message})
+	return e
+}
+
+// WithCause records the underlying error
+func (e *APIError) WithCause(cause error) *APIError {
+	e.Cause = cause
+	return e
+}
+
+// WithCorrelationID sets the correlation ID reported to the client
+func (e *APIError) WithCorrelationID(correlationID string) *APIError {
+	e.CorrelationID = correlationID
+	return e
+}
+
+// HTTPStatus returns the status to respond with
+func (e *APIError) HTTPStatus() int {
+	if e.Status == 0 {
+		return e.Code.Status()
+	}
+	return e.Status
+}
+
+// apiErrorJSON is APIError without its JSON methods, used to avoid recursion
+type apiErrorJSON APIError
+
+// MarshalJSON encodes the error with "success": false
+func (e APIError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Success bool `json:"success"`
+		apiErrorJSON
+	}{false, apiErrorJSON(e)})
+}
+
+// AsAPIError converts any error into an APIError. Errors that don't wrap an
+// APIError become internal errors so their details never reach clients.
+func AsAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return NewInternalError(err)
+}
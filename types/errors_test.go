@@ -0,0 +1,93 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestErrorCodeStatus(t *testing.T) {
+	cases := map[ErrorCode]int{
+		ErrCodeBadRequest:        http.StatusBadRequest,
+		ErrCodeValidationFailed:  http.StatusUnprocessableEntity,
+		ErrCodeInvalidToken:      http.StatusUnauthorized,
+		ErrCodeNotFound:          http.StatusNotFound,
+		ErrCodeRateLimited:       http.StatusTooManyRequests,
+		ErrCodeChallengeRequired: http.StatusPreconditionRequired,
+		ErrCodeBadGateway:        http.StatusBadGateway,
+		ErrorCode("unknown"):     http.StatusInternalServerError,
+	}
+	for code, status := range cases {
+		if code.Status() != status {
+			t.Errorf("Expected %s to map to %d, got %d", code, status, code.Status())
+		}
+	}
+}
+
+func TestAPIErrorJSON(t *testing.T) {
+	err := NewValidationError(FieldError{Field: "purpose", Code: "required", Message: "Purpose is required"}).
+		WithField("duration", "oneof", "Duration must be one of 10min, 30min, 1hour, unlimited").
+		WithCorrelationID("corr-123")
+
+	data, marshalErr := json.Marshal(err)
+	if marshalErr != nil {
+		t.Fatalf("Failed to marshal APIError: %v", marshalErr)
+	}
+
+	var decoded map[string]interface{}
+	json.Unmarshal(data, &decoded)
+	if decoded["success"] != false {
+		t.Errorf("Expected success false, got %v", decoded["success"])
+	}
+	if decoded["error"] != "validation_failed" {
+		t.Errorf("Expected error code validation_failed, got %v", decoded["error"])
+	}
+	if decoded["status"] != float64(http.StatusUnprocessableEntity) {
+		t.Errorf("Expected status 422, got %v", decoded["status"])
+	}
+	if decoded["correlation_id"] != "corr-123" {
+		t.Errorf("Expected correlation ID, got %v", decoded["correlation_id"])
+	}
+	if fields, ok := decoded["fields"].([]interface{}); !ok || len(fields) != 2 {
+		t.Errorf("Expected 2 field errors, got %v", decoded["fields"])
+	}
+
+	// Readers of the old APIResponse shape still understand it
+	var response APIResponse
+	json.Unmarshal(data, &response)
+	if response.Success || response.Error != "validation_failed" || response.Message != "Request validation failed" {
+		t.Errorf("Expected APIResponse-compatible payload, got %+v", response)
+	}
+}
+
+func TestAsAPIError(t *testing.T) {
+	notFound := NewNotFoundError("Access code")
+	if notFound.Message != "Access code not found" || notFound.HTTPStatus() != http.StatusNotFound {
+		t.Errorf("Unexpected not found error %+v", notFound)
+	}
+
+	wrapped := fmt.Errorf("loading code: %w", notFound)
+	if AsAPIError(wrapped) != notFound {
+		t.Errorf("Expected wrapped APIError to be returned as is")
+	}
+
+	cause := errors.New("pq: connection refused")
+	internal := AsAPIError(cause)
+	if internal.Code != ErrCodeInternal || internal.HTTPStatus() != http.StatusInternalServerError {
+		t.Errorf("Expected internal error, got %+v", internal)
+	}
+	if !errors.Is(internal, cause) {
+		t.Errorf("Expected internal error to wrap its cause")
+	}
+
+	data, _ := json.Marshal(internal)
+	if strings.Contains(string(data), "connection refused") {
+		t.Errorf("Cause leaked to client payload: %s", data)
+	}
+	if !strings.Contains(internal.Error(), "connection refused") {
+		t.Errorf("Expected cause in Error(), got %q", internal.Error())
+	}
+}
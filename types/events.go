@@ -0,0 +1,183 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventType names a domain event, e.g. "code.generated"
+type EventType string
+
+const (
+	EventCodeGenerated EventType = "code.generated"
+	EventCodeValidated EventType = "code.validated"
+	EventUserInvited   EventType = "user.invited"
+
+	EventCodeValidationBlocked EventType = "code.validation_blocked"
+)
+
+var (
+	// ErrUnknownEventType is returned when decoding an event type with no registered payload
+	ErrUnknownEventType = errors.New("unknown event type")
+	// ErrUnsupportedEventVersion is returned when an event is newer than the payload struct
+	ErrUnsupportedEventVersion = errors.New("unsupported event version")
+)
+
+// Event is implemented by domain event payloads. The version is bumped on
+// breaking changes to the payload; adding optional fields keeps it.
+type Event interface {
+	EventType() EventType
+	EventVersion() int
+}
+
+// events lists the payload constructor for every known event type
+var events = map[EventType]func() Event{
+	EventCodeGenerated: func() Event { return &CodeGenerated{} },
+	EventCodeValidated: func() Event { return &CodeValidated{} },
+	EventUserInvited:   func() Event { return &UserInvited{} },
+
+	EventCodeValidationBlocked: func() Event { return &CodeValidationBlocked{} },
+}
+
+// CodeGenerated is published when a user generates an access code. The code
+// itself is left out so event consumers never see live codes.
+type CodeGenerated struct {
+	CodeID    string     `json:"code_id"`
+	UserID    string     `json:"user_id"`
+	Purpose   string     `json:"purpose"`
+	Duration  Duration   `json:"duration"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // nil for unlimited codes
+}
+
+func (CodeGenerated) EventType() EventType { return EventCodeGenerated }
+func (CodeGenerated) EventVersion() int    { return 1 }
+
+// CodeValidated is published for every validation attempt, valid or not
+type CodeValidated struct {
+	CodeID      string `json:"code_id,omitempty"` // empty when the code wasn't found
+	ValidatorID string `json:"validator_id"`
+	Status      string `json:"status"` // valid, invalid, expired
+	Offline     bool   `json:"offline,omitempty"`
+	IPAddress   string `json:"ip_address,omitempty"`
+}
+
+func (CodeValidated) EventType() EventType { return EventCodeValidated }
+func (CodeValidated) EventVersion() int    { return 1 }
+
+// CodeValidationBlocked is published when brute-force protection locks out
+// a client or code prefix, or a client fails its challenge
+type CodeValidationBlocked struct {
+	Reason      string     `json:"reason"` // locked_out, challenge_failed
+	Scope       string     `json:"scope"`  // ip, subject, prefix
+	IPAddress   string     `json:"ip_address,omitempty"`
+	Subject     string     `json:"subject,omitempty"` // principal type and ID
+	CodePrefix  string     `json:"code_prefix,omitempty"`
+	Fingerprint string     `json:"fingerprint,omitempty"` // request fingerprint ID
+	Failures    int64      `json:"failures"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+}
+
+func (CodeValidationBlocked) EventType() EventType { return EventCodeValidationBlocked }
+func (CodeValidationBlocked) EventVersion() int    { return 1 }
+
+// UserInvited is published when a user is invited to an organization
+type UserInvited struct {
+	InviteID  string    `json:"invite_id"`
+	Email     Email     `json:"email"`
+	Role      UserRole  `json:"role"`
+	InvitedBy string    `json:"invited_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (UserInvited) EventType() EventType { return EventUserInvited }
+func (UserInvited) EventVersion() int    { return 1 }
+
+// Envelope wraps an event payload with the metadata every consumer needs
+type Envelope struct {
+	ID            string          `json:"id"`
+	Type          EventType       `json:"type"`
+	Version       int             `json:"version"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	OrgID         string          `json:"org_id,omitempty"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	CausationID   string          `json:"causation_id,omitempty"` // ID of the event that caused this one
+	Data          json.RawMessage `json:"data"`
+}
+
+// NewEnvelope wraps an event for the given organization with a new event ID
+func NewEnvelope(event Event, orgID string) (*Envelope, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %w", event.EventType(), err)
+	}
+
+	return &Envelope{
+		ID:         uuid.New().String(),
+		Type:       event.EventType(),
+		Version:    event.EventVersion(),
+		OccurredAt: time.Now().UTC(),
+		OrgID:      orgID,
+		Data:       data,
+	}, nil
+}
+
+// WithCorrelationID sets the correlation ID of the request that produced the event
+func (e *Envelope) WithCorrelationID(id string) *Envelope {
+	e.CorrelationID = id
+	return e
+}
+
+// WithCausationID records the event that caused this one
+func (e *Envelope) WithCausationID(id string) *Envelope {
+	e.CausationID = id
+	return e
+}
+
+// DecodeInto decodes the payload into event, checking its type and version
+func (e *Envelope) DecodeInto(event Event) error {
+	if e.Type != event.EventType() {
+		return fmt.Errorf("cannot decode %s event into %s", e.Type, event.EventType())
+	}
+	if e.Version > event.EventVersion() {
+		return fmt.Errorf("%w: %s v%d", ErrUnsupportedEventVersion, e.Type, e.Version)
+	}
+	return json.Unmarshal(e.Data, event)
+}
+
+// Event decodes the payload into the struct registered for the envelope type
+func (e *Envelope) Event() (Event, error) {
+	newEvent, ok := events[e.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEventType, e.Type)
+	}
+
+	event := newEvent()
+	if err := e.DecodeInto(event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// EventSchemas returns a JSON schema for the envelope of every known event
+// type, with the payload schema under the data property
+func EventSchemas() map[EventType]map[string]interface{} {
+	schemas := make(map[EventType]map[string]interface{}, len(events))
+	for eventType, newEvent := range events {
+		event := newEvent()
+
+		schema := JSONSchema(Envelope{})
+		properties := schema["properties"].(map[string]interface{})
+		properties["type"] = map[string]interface{}{"const": eventType}
+		properties["version"] = map[string]interface{}{"const": event.EventVersion()}
+		properties["data"] = JSONSchema(event)
+
+		schema["$schema"] = jsonSchemaDraft
+		schema["title"] = string(eventType)
+		schemas[eventType] = schema
+	}
+	return schemas
+}
@@ -0,0 +1,98 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	invite := &UserInvited{
+		InviteID:  "invite-1",
+		Email:     "guard@example.com",
+		Role:      RoleGuard,
+		InvitedBy: "admin-1",
+		ExpiresAt: time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second),
+	}
+
+	envelope, err := NewEnvelope(invite, "org-1")
+	if err != nil {
+		t.Fatalf("Failed to create envelope: %v", err)
+	}
+	envelope.WithCorrelationID("corr-1").WithCausationID("event-0")
+
+	if envelope.ID == "" || envelope.Type != EventUserInvited || envelope.Version != 1 {
+		t.Errorf("Unexpected envelope metadata: %+v", envelope)
+	}
+
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatalf("Failed to marshal envelope: %v", err)
+	}
+
+	var decoded Envelope
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal envelope: %v", err)
+	}
+	if decoded.OrgID != "org-1" || decoded.CorrelationID != "corr-1" || decoded.CausationID != "event-0" {
+		t.Errorf("Expected envelope metadata to survive encoding, got %+v", decoded)
+	}
+
+	event, err := decoded.Event()
+	if err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	got, ok := event.(*UserInvited)
+	if !ok {
+		t.Fatalf("Expected *UserInvited, got %T", event)
+	}
+	if *got != *invite {
+		t.Errorf("Expected %+v, got %+v", invite, got)
+	}
+}
+
+func TestEnvelopeDecodeErrors(t *testing.T) {
+	envelope, _ := NewEnvelope(&CodeValidated{ValidatorID: "validator-1", Status: StatusValid}, "org-1")
+
+	if err := envelope.DecodeInto(&CodeGenerated{}); err == nil {
+		t.Errorf("Expected an error decoding into the wrong event type")
+	}
+
+	envelope.Version = 2
+	if _, err := envelope.Event(); !errors.Is(err, ErrUnsupportedEventVersion) {
+		t.Errorf("Expected ErrUnsupportedEventVersion, got %v", err)
+	}
+
+	envelope.Type = "code.deleted"
+	if _, err := envelope.Event(); !errors.Is(err, ErrUnknownEventType) {
+		t.Errorf("Expected ErrUnknownEventType, got %v", err)
+	}
+}
+
+func TestEventSchemas(t *testing.T) {
+	schemas := EventSchemas()
+
+	for _, eventType := range []EventType{EventCodeGenerated, EventCodeValidated, EventUserInvited, EventCodeValidationBlocked} {
+		schema, ok := schemas[eventType]
+		if !ok {
+			t.Fatalf("Expected a schema for %s", eventType)
+		}
+
+		properties := schema["properties"].(map[string]interface{})
+		if properties["type"].(map[string]interface{})["const"] != eventType {
+			t.Errorf("Expected %s schema to pin the event type", eventType)
+		}
+		if _, ok := properties["occurred_at"]; !ok {
+			t.Errorf("Expected %s schema to include envelope fields", eventType)
+		}
+		if _, err := json.Marshal(schema); err != nil {
+			t.Errorf("Expected %s schema to encode as JSON: %v", eventType, err)
+		}
+	}
+
+	data := schemas[EventCodeGenerated]["properties"].(map[string]interface{})["data"].(map[string]interface{})
+	if _, ok := data["properties"].(map[string]interface{})["purpose"]; !ok {
+		t.Errorf("Expected code.generated payload schema to include purpose, got %v", data)
+	}
+}
@@ -0,0 +1,125 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// FieldsParam is the query parameter naming the response fields a client
+// wants, e.g. ?fields=id,name,role
+const FieldsParam = "fields"
+
+// Fields is a set of requested response fields. Nested fields use dots,
+// e.g. "owner.name". An empty Fields selects everything.
+type Fields []string
+
+// ParseFields parses a comma separated fields parameter. Every field must
+// be in allowed or nested under an allowed field, so clients can't probe
+// for fields that aren't part of the documented response.
+func ParseFields(raw string, allowed ...string) (Fields, error) {
+	var fields Fields
+	var invalid []FieldError
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !fieldAllowed(field, allowed) {
+			invalid = append(invalid, FieldError{
+				Field:   FieldsParam,
+				Code:    "unknown_field",
+				Message: fmt.Sprintf("field %q cannot be selected", field),
+			})
+			continue
+		}
+		fields = append(fields, field)
+	}
+	if len(invalid) > 0 {
+		return nil, NewValidationError(invalid...)
+	}
+	return fields, nil
+}
+
+// fieldAllowed reports whether field is allowed itself or nested under an
+// allowed field
+func fieldAllowed(field string, allowed []string) bool {
+	for _, a := range allowed {
+		if field == a || strings.HasPrefix(field, a+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns v with only the selected fields, using v's JSON encoding.
+// Arrays are filtered element by element, so a page of items and a single
+// item take the same fields. With no fields v is returned unchanged.
+func (f Fields) Select(v interface{}) (interface{}, error) {
+	if len(f) == 0 {
+		return v, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode response: %w", err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return f.tree().apply(decoded), nil
+}
+
+// fieldTree is the selection as nested keys; a nil subtree keeps the
+// whole value
+type fieldTree map[string]fieldTree
+
+// tree builds the selection tree, where a field selects all of its
+// nested fields
+func (f Fields) tree() fieldTree {
+	root := fieldTree{}
+	for _, field := range f {
+		node := root
+		parts := strings.Split(field, ".")
+		for i, part := range parts {
+			child, seen := node[part]
+			if seen && child == nil {
+				break // An ancestor is already selected whole
+			}
+			if i == len(parts)-1 {
+				node[part] = nil
+				break
+			}
+			if child == nil {
+				child = fieldTree{}
+				node[part] = child
+			}
+			node = child
+		}
+	}
+	return root
+}
+
+// apply filters a decoded JSON value to the tree
+func (t fieldTree) apply(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		selected := make(map[string]interface{}, len(t))
+		for key, subtree := range t {
+			field, ok := v[key]
+			if !ok {
+				continue
+			}
+			if subtree != nil {
+				field = subtree.apply(field)
+			}
+			selected[key] = field
+		}
+		return selected
+	case []interface{}:
+		for i, item := range v {
+			v[i] = t.apply(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,126 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// fieldsDevice has a nested owner to exercise dotted fields
+type fieldsDevice struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Role  string `json:"role"`
+	Key   string `json:"key"`
+	Owner struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	} `json:"owner"`
+}
+
+func newFieldsDevice(id string) fieldsDevice {
+	device := fieldsDevice{ID: id, Name: "Gate " + id, Role: "validator", Key: "secret"}
+	device.Owner.Name = "Ana"
+	device.Owner.Email = "ana@example.com"
+	return device
+}
+
+// selectJSON selects fields from v and returns the result encoded
+func selectJSON(t *testing.T, fields Fields, v interface{}) string {
+	t.Helper()
+	selected, err := fields.Select(v)
+	if err != nil {
+		t.Fatalf("Failed to select fields: %v", err)
+	}
+	data, err := json.Marshal(selected)
+	if err != nil {
+		t.Fatalf("Failed to encode selection: %v", err)
+	}
+	return string(data)
+}
+
+func TestParseFields(t *testing.T) {
+	fields, err := ParseFields(" id, name,,owner.name ", "id", "name", "owner")
+	if err != nil {
+		t.Fatalf("Expected fields to parse, got %v", err)
+	}
+	if len(fields) != 3 || fields[0] != "id" || fields[1] != "name" || fields[2] != "owner.name" {
+		t.Errorf("Unexpected fields %v", fields)
+	}
+
+	fields, err = ParseFields("", "id")
+	if err != nil || len(fields) != 0 {
+		t.Errorf("Expected no fields for an empty parameter, got %v, %v", fields, err)
+	}
+
+	_, err = ParseFields("id,key,ownerx", "id", "owner")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected an APIError, got %v", err)
+	}
+	if apiErr.Code != ErrCodeValidationFailed || len(apiErr.Fields) != 2 {
+		t.Errorf("Expected two field errors, got %+v", apiErr)
+	}
+	if apiErr.Fields[0].Field != FieldsParam || apiErr.Fields[0].Code != "unknown_field" {
+		t.Errorf("Unexpected field error %+v", apiErr.Fields[0])
+	}
+}
+
+func TestFieldsSelect(t *testing.T) {
+	device := newFieldsDevice("d1")
+
+	got := selectJSON(t, Fields{"id", "role"}, device)
+	if want := `{"id":"d1","role":"validator"}`; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	got = selectJSON(t, Fields{"id", "owner.name"}, device)
+	if want := `{"id":"d1","owner":{"name":"Ana"}}`; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	// A parent selects all nested fields, in either order
+	for _, fields := range []Fields{{"owner", "owner.name"}, {"owner.name", "owner"}} {
+		got = selectJSON(t, fields, device)
+		if want := `{"owner":{"email":"ana@example.com","name":"Ana"}}`; got != want {
+			t.Errorf("Expected %s for %v, got %s", want, fields, got)
+		}
+	}
+
+	// Missing fields are left out rather than sent as null
+	got = selectJSON(t, Fields{"id", "missing"}, device)
+	if want := `{"id":"d1"}`; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestFieldsSelectSlice(t *testing.T) {
+	devices := []fieldsDevice{newFieldsDevice("d1"), newFieldsDevice("d2")}
+
+	got := selectJSON(t, Fields{"id"}, devices)
+	if want := `[{"id":"d1"},{"id":"d2"}]`; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	// Selected items fit the standard page envelope
+	items, err := Fields{"id"}.Select(devices)
+	if err != nil {
+		t.Fatalf("Failed to select fields: %v", err)
+	}
+	page := NewPaginatedResponse(items.([]interface{}), 2, Pagination{Page: 1, PageSize: 20})
+	data, _ := json.Marshal(page)
+	if want := `{"data":[{"id":"d1"},{"id":"d2"}],"total":2,"page":1,"page_size":20,"total_pages":1}`; string(data) != want {
+		t.Errorf("Expected %s, got %s", want, data)
+	}
+}
+
+func TestFieldsSelectAll(t *testing.T) {
+	device := newFieldsDevice("d1")
+	selected, err := Fields(nil).Select(device)
+	if err != nil {
+		t.Fatalf("Failed to select fields: %v", err)
+	}
+	if _, ok := selected.(fieldsDevice); !ok {
+		t.Errorf("Expected the value unchanged without fields, got %T", selected)
+	}
+}
@@ -0,0 +1,141 @@
+package types
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// Optional holds a value that may be absent. It encodes as JSON null and SQL
+// NULL when absent, so zero values such as 0001-01-01T00:00:00Z never reach
+// clients or the database in place of "no value".
+type Optional[T any] struct {
+	value T
+	valid bool
+}
+
+// NullTime is an optional timestamp
+type NullTime = Optional[time.Time]
+
+// NullString is an optional string; unlike a plain string it tells "" and
+// "not set" apart
+type NullString = Optional[string]
+
+// Some returns an Optional holding v
+func Some[T any](v T) Optional[T] {
+	return Optional[T]{value: v, valid: true}
+}
+
+// None returns an empty Optional
+func None[T any]() Optional[T] {
+	return Optional[T]{}
+}
+
+// FromPtr returns an Optional holding *p, or an empty one when p is nil
+func FromPtr[T any](p *T) Optional[T] {
+	if p == nil {
+		return None[T]()
+	}
+	return Some(*p)
+}
+
+// Get returns the value and whether it is present
+func (o Optional[T]) Get() (T, bool) {
+	return o.value, o.valid
+}
+
+// Valid reports whether a value is present
+func (o Optional[T]) Valid() bool {
+	return o.valid
+}
+
+// IsZero reports whether the value is absent. It lets `json:",omitzero"`
+// omit empty optionals on Go 1.24 and later.
+func (o Optional[T]) IsZero() bool {
+	return !o.valid
+}
+
+// ValueOr returns the value, or fallback when it is absent
+func (o Optional[T]) ValueOr(fallback T) T {
+	if !o.valid {
+		return fallback
+	}
+	return o.value
+}
+
+// Ptr returns a pointer to a copy of the value, or nil when it is absent
+func (o Optional[T]) Ptr() *T {
+	if !o.valid {
+		return nil
+	}
+	v := o.value
+	return &v
+}
+
+// Set stores v
+func (o *Optional[T]) Set(v T) {
+	o.value = v
+	o.valid = true
+}
+
+// Clear removes the value
+func (o *Optional[T]) Clear() {
+	var zero T
+	o.value = zero
+	o.valid = false
+}
+
+// MarshalJSON encodes the value, or null when it is absent
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if !o.valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.value)
+}
+
+// UnmarshalJSON decodes the value; null leaves it absent
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		o.Clear()
+		return nil
+	}
+
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	o.Set(v)
+	return nil
+}
+
+// jsonSchema returns the schema of T, also allowing null
+func (o Optional[T]) jsonSchema() map[string]interface{} {
+	schema := schemaFor(reflect.TypeOf((*T)(nil)).Elem())
+	if typ, ok := schema["type"].(string); ok {
+		schema["type"] = []string{typ, "null"}
+	}
+	return schema
+}
+
+// Scan implements sql.Scanner; NULL leaves the value absent
+func (o *Optional[T]) Scan(src interface{}) error {
+	var n sql.Null[T]
+	if err := n.Scan(src); err != nil {
+		return err
+	}
+	o.value, o.valid = n.V, n.Valid
+	return nil
+}
+
+// Value implements driver.Valuer, writing NULL when the value is absent.
+// Present values are converted like a plain query argument, so ints of any
+// size, named types and driver.Valuers all work.
+func (o Optional[T]) Value() (driver.Value, error) {
+	if !o.valid {
+		return nil, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(o.value)
+}
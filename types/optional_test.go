@@ -0,0 +1,109 @@
+package types
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestOptionalJSON(t *testing.T) {
+	code := AccessCode{ID: "code-1"}
+
+	data, err := json.Marshal(code)
+	if err != nil {
+		t.Fatalf("Failed to marshal code: %v", err)
+	}
+	var decoded map[string]interface{}
+	json.Unmarshal(data, &decoded)
+	if value, ok := decoded["used_at"]; !ok || value != nil {
+		t.Errorf("Expected used_at to be null, got %v", value)
+	}
+
+	usedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	code.UsedAt = Some(usedAt)
+	data, _ = json.Marshal(code)
+
+	var roundTrip AccessCode
+	if err := json.Unmarshal(data, &roundTrip); err != nil {
+		t.Fatalf("Failed to unmarshal code: %v", err)
+	}
+	if got, ok := roundTrip.UsedAt.Get(); !ok || !got.Equal(usedAt) {
+		t.Errorf("Expected used_at %v, got %v (valid %v)", usedAt, got, ok)
+	}
+
+	if err := json.Unmarshal([]byte(`{"used_at":null}`), &roundTrip); err != nil || roundTrip.UsedAt.Valid() {
+		t.Errorf("Expected null to clear used_at, got %v", roundTrip.UsedAt)
+	}
+}
+
+func TestOptionalSQL(t *testing.T) {
+	var name NullString
+	if err := name.Scan(nil); err != nil || name.Valid() {
+		t.Errorf("Expected NULL to scan as absent")
+	}
+	if err := name.Scan([]byte("gate")); err != nil || name.ValueOr("") != "gate" {
+		t.Errorf("Expected scanned string, got %v", name)
+	}
+
+	if value, err := name.Value(); err != nil || value != "gate" {
+		t.Errorf("Expected value gate, got %v, %v", value, err)
+	}
+	name.Clear()
+	if value, err := name.Value(); err != nil || value != nil {
+		t.Errorf("Expected NULL value, got %v, %v", value, err)
+	}
+
+	// Value types that implement driver.Valuer are validated on write
+	email := Some(Email("not-an-email"))
+	if _, err := email.Value(); err == nil {
+		t.Errorf("Expected wrapped Valuer errors to be returned")
+	}
+
+	var usedAt NullTime
+	now := time.Now().UTC()
+	if err := usedAt.Scan(now); err != nil || !usedAt.ValueOr(time.Time{}).Equal(now) {
+		t.Errorf("Expected scanned time, got %v, %v", usedAt, err)
+	}
+}
+
+func TestOptionalSQLValueConversion(t *testing.T) {
+	type attempts int
+	type purpose string
+
+	tests := map[string]struct {
+		value    driver.Valuer
+		expected driver.Value
+	}{
+		"int":          {Some(3), int64(3)},
+		"int32":        {Some(int32(3)), int64(3)},
+		"uint8":        {Some(uint8(3)), int64(3)},
+		"named int":    {Some(attempts(3)), int64(3)},
+		"named string": {Some(purpose("event_entry")), "event_entry"},
+		"float32":      {Some(float32(0.5)), float64(0.5)},
+	}
+	for name, test := range tests {
+		value, err := test.value.Value()
+		if err != nil || !driver.IsValue(value) || value != test.expected {
+			t.Errorf("%s: expected driver value %#v, got %#v, %v", name, test.expected, value, err)
+		}
+	}
+}
+
+func TestOptionalHelpers(t *testing.T) {
+	if FromPtr[string](nil).Valid() {
+		t.Errorf("Expected nil pointer to be absent")
+	}
+
+	s := "value"
+	opt := FromPtr(&s)
+	if p := opt.Ptr(); p == nil || *p != "value" || p == &s {
+		t.Errorf("Expected Ptr to return a copy of the value")
+	}
+	if None[int]().ValueOr(7) != 7 || !None[int]().IsZero() {
+		t.Errorf("Expected None to use the fallback and report zero")
+	}
+	if Some("").IsZero() {
+		t.Errorf("Expected an empty string to be a present value")
+	}
+}
@@ -0,0 +1,96 @@
+package types
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Cursor pagination limits
+const (
+	DefaultCursorLimit = 20
+	MaxCursorLimit     = 100
+)
+
+// ErrInvalidCursor is returned when a cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// CursorPagination represents keyset pagination parameters. Unlike page
+// numbers, cursors stay stable while rows are inserted or deleted.
+type CursorPagination struct {
+	Cursor string `json:"cursor,omitempty" query:"cursor"`
+	Limit  int    `json:"limit,omitempty" query:"limit"`
+}
+
+// Validate checks the limit, defaulting it when unset
+func (p *CursorPagination) Validate() error {
+	if p.Limit == 0 {
+		p.Limit = DefaultCursorLimit
+	}
+	if p.Limit < 0 || p.Limit > MaxCursorLimit {
+		return fmt.Errorf("limit must be between 1 and %d, got %d", MaxCursorLimit, p.Limit)
+	}
+	return nil
+}
+
+// Decode decodes the cursor into v. It returns false without touching v
+// when no cursor was given, i.e. for the first page.
+func (p CursorPagination) Decode(v interface{}) (bool, error) {
+	if p.Cursor == "" {
+		return false, nil
+	}
+	return true, DecodeCursor(p.Cursor, v)
+}
+
+// EncodeCursor encodes a position, typically the sort key and ID of the last
+// row returned, as an opaque URL-safe cursor
+func EncodeCursor(position interface{}) (string, error) {
+	data, err := json.Marshal(position)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor decodes a cursor produced by EncodeCursor into v
+func DecodeCursor(cursor string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// PaginatedResult represents one page of a cursor-paginated listing
+type PaginatedResult[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// NewPaginatedResult builds a page from up to limit+1 fetched rows: fetching
+// one extra row tells whether another page exists without a COUNT query.
+// position returns the cursor position of an item, used for the last item kept.
+func NewPaginatedResult[T any](rows []T, limit int, position func(item T) interface{}) (*PaginatedResult[T], error) {
+	result := &PaginatedResult[T]{Items: rows}
+	if result.Items == nil {
+		result.Items = []T{}
+	}
+	if limit <= 0 || len(rows) <= limit {
+		return result, nil
+	}
+
+	result.Items = rows[:limit]
+	result.HasMore = true
+
+	cursor, err := EncodeCursor(position(result.Items[limit-1]))
+	if err != nil {
+		return nil, err
+	}
+	result.NextCursor = cursor
+	return result, nil
+}
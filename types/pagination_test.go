@@ -0,0 +1,102 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testPosition is a typical keyset position: sort key plus tie-breaking ID
+type testPosition struct {
+	CreatedAt time.Time `json:"c"`
+	ID        string    `json:"i"`
+}
+
+func TestCursorPaginationValidate(t *testing.T) {
+	p := CursorPagination{}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Expected empty pagination to be valid, got %v", err)
+	}
+	if p.Limit != DefaultCursorLimit {
+		t.Errorf("Expected default limit %d, got %d", DefaultCursorLimit, p.Limit)
+	}
+
+	for _, limit := range []int{-1, MaxCursorLimit + 1} {
+		p := CursorPagination{Limit: limit}
+		if err := p.Validate(); err == nil {
+			t.Errorf("Expected limit %d to be rejected", limit)
+		}
+	}
+
+	p = CursorPagination{Limit: MaxCursorLimit}
+	if err := p.Validate(); err != nil {
+		t.Errorf("Expected limit %d to be valid, got %v", MaxCursorLimit, err)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	position := testPosition{CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), ID: "code-42"}
+
+	cursor, err := EncodeCursor(position)
+	if err != nil {
+		t.Fatalf("Failed to encode cursor: %v", err)
+	}
+
+	var decoded testPosition
+	found, err := CursorPagination{Cursor: cursor}.Decode(&decoded)
+	if err != nil || !found {
+		t.Fatalf("Failed to decode cursor: found=%v err=%v", found, err)
+	}
+	if !decoded.CreatedAt.Equal(position.CreatedAt) || decoded.ID != position.ID {
+		t.Errorf("Expected %+v, got %+v", position, decoded)
+	}
+
+	found, err = CursorPagination{}.Decode(&decoded)
+	if found || err != nil {
+		t.Errorf("Expected no cursor on the first page, got found=%v err=%v", found, err)
+	}
+
+	for _, invalid := range []string{"not base64!", "bm90IGpzb24"} {
+		if err := DecodeCursor(invalid, &decoded); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Expected ErrInvalidCursor for %q, got %v", invalid, err)
+		}
+	}
+}
+
+func TestNewPaginatedResult(t *testing.T) {
+	position := func(id string) interface{} { return testPosition{ID: id} }
+
+	// limit+1 rows means there is another page
+	page, err := NewPaginatedResult([]string{"a", "b", "c"}, 2, position)
+	if err != nil {
+		t.Fatalf("Failed to build page: %v", err)
+	}
+	if len(page.Items) != 2 || !page.HasMore {
+		t.Errorf("Expected 2 items and more pages, got %+v", page)
+	}
+
+	var next testPosition
+	if err := DecodeCursor(page.NextCursor, &next); err != nil || next.ID != "b" {
+		t.Errorf("Expected next cursor after 'b', got %+v (%v)", next, err)
+	}
+
+	// The last page has no cursor
+	page, err = NewPaginatedResult([]string{"c"}, 2, position)
+	if err != nil {
+		t.Fatalf("Failed to build page: %v", err)
+	}
+	if page.HasMore || page.NextCursor != "" {
+		t.Errorf("Expected last page, got %+v", page)
+	}
+
+	// Empty results encode as an empty list, not null
+	empty, err := NewPaginatedResult[string](nil, 2, position)
+	if err != nil {
+		t.Fatalf("Failed to build page: %v", err)
+	}
+	data, _ := json.Marshal(empty)
+	if string(data) != `{"items":[],"has_more":false}` {
+		t.Errorf("Unexpected JSON %s", data)
+	}
+}
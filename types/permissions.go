@@ -0,0 +1,81 @@
+package types
+
+// Permission is a capability granted to roles. Permission names use the same
+// resource:action form as token scopes, so a service token can be granted a
+// permission by including it in its scopes.
+type Permission string
+
+const (
+	PermissionGenerateCode     Permission = "codes:generate"
+	PermissionValidateCode     Permission = "codes:validate"
+	PermissionViewCodes        Permission = "codes:read"
+	PermissionRevokeCode       Permission = "codes:revoke"
+	PermissionInviteUser       Permission = "users:invite"
+	PermissionManageUsers      Permission = "users:manage"
+	PermissionManageValidators Permission = "validators:manage"
+	PermissionManageOrg        Permission = "org:manage"
+	PermissionViewAuditLog     Permission = "audit:read"
+)
+
+// RolePermissions is the permission matrix: the permissions granted to each role
+var RolePermissions = map[UserRole][]Permission{
+	RoleAdmin: {
+		PermissionGenerateCode,
+		PermissionValidateCode,
+		PermissionViewCodes,
+		PermissionRevokeCode,
+		PermissionInviteUser,
+		PermissionManageUsers,
+		PermissionManageValidators,
+		PermissionManageOrg,
+		PermissionViewAuditLog,
+	},
+	RoleMember: {
+		PermissionGenerateCode,
+		PermissionViewCodes,
+		PermissionRevokeCode,
+	},
+	RoleGuard: {
+		PermissionValidateCode,
+		PermissionViewCodes,
+	},
+}
+
+// IsValid reports whether r is a known role
+func (r UserRole) IsValid() bool {
+	_, ok := RolePermissions[r]
+	return ok
+}
+
+// Permissions returns the permissions granted to the role
+func (r UserRole) Permissions() []Permission {
+	return RolePermissions[r]
+}
+
+// Can reports whether the role grants the permission
+func (r UserRole) Can(permission Permission) bool {
+	for _, p := range RolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether the user may perform the action. Inactive and
+// soft-deleted users have no permissions.
+func (u *User) Can(permission Permission) bool {
+	if !u.IsActive || u.IsDeleted() {
+		return false
+	}
+	return u.Role.Can(permission)
+}
+
+// Can reports whether the token grants the permission: through the user's
+// role for user tokens, or through a scope of the same name for service tokens
+func (c JWTClaims) Can(permission Permission) bool {
+	if c.Principal() == PrincipalService {
+		return c.HasScope(string(permission))
+	}
+	return c.Role.Can(permission)
+}
@@ -0,0 +1,65 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoleCan(t *testing.T) {
+	tests := []struct {
+		role       UserRole
+		permission Permission
+		expected   bool
+	}{
+		{RoleAdmin, PermissionManageOrg, true},
+		{RoleAdmin, PermissionValidateCode, true},
+		{RoleMember, PermissionGenerateCode, true},
+		{RoleMember, PermissionValidateCode, false},
+		{RoleGuard, PermissionValidateCode, true},
+		{RoleGuard, PermissionGenerateCode, false},
+		{"owner", PermissionViewCodes, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.role.Can(tt.permission); got != tt.expected {
+			t.Errorf("%s.Can(%s) = %v, expected %v", tt.role, tt.permission, got, tt.expected)
+		}
+	}
+
+	if UserRole("owner").IsValid() || !RoleGuard.IsValid() {
+		t.Errorf("Unexpected IsValid results")
+	}
+}
+
+func TestUserCan(t *testing.T) {
+	user := &User{Role: RoleGuard, IsActive: true}
+	if !user.Can(PermissionValidateCode) {
+		t.Errorf("Expected active guard to validate codes")
+	}
+
+	user.IsActive = false
+	if user.Can(PermissionValidateCode) {
+		t.Errorf("Expected inactive user to have no permissions")
+	}
+
+	deletedAt := time.Now()
+	user = &User{Role: RoleAdmin, IsActive: true, AuditFields: AuditFields{DeletedAt: &deletedAt}}
+	if user.Can(PermissionViewCodes) {
+		t.Errorf("Expected deleted user to have no permissions")
+	}
+}
+
+func TestJWTClaimsCan(t *testing.T) {
+	claims := JWTClaims{Role: RoleMember}
+	if !claims.Can(PermissionGenerateCode) || claims.Can(PermissionManageUsers) {
+		t.Errorf("Expected user claims to use the role permissions")
+	}
+
+	service := JWTClaims{TokenType: TokenTypeService, Role: RoleAdmin, Scopes: []string{"codes:validate"}}
+	if !service.Can(PermissionValidateCode) {
+		t.Errorf("Expected service token to be granted permissions by scope")
+	}
+	if service.Can(PermissionManageOrg) {
+		t.Errorf("Expected service token permissions to ignore the role")
+	}
+}
@@ -0,0 +1,108 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxPurposeLength is the longest purpose accepted for an access code
+const MaxPurposeLength = 100
+
+// AccessCodeLength is the length of access codes accepted for validation
+const AccessCodeLength = 6
+
+// Duration is how long a generated access code stays valid
+type Duration string
+
+// durations maps each allowed duration to its length; unlimited maps to 0
+var durations = map[Duration]time.Duration{
+	Duration10Min:     10 * time.Minute,
+	Duration30Min:     30 * time.Minute,
+	Duration1Hour:     time.Hour,
+	DurationUnlimited: 0,
+}
+
+// ParseDuration parses a duration such as "30min", ignoring case and
+// surrounding whitespace
+func ParseDuration(s string) (Duration, error) {
+	d := Duration(strings.ToLower(strings.TrimSpace(s)))
+	if !d.IsValid() {
+		return "", fmt.Errorf("invalid duration %q: must be one of 10min, 30min, 1hour, unlimited", s)
+	}
+	return d, nil
+}
+
+// IsValid reports whether d is one of the allowed durations
+func (d Duration) IsValid() bool {
+	_, ok := durations[d]
+	return ok
+}
+
+// IsUnlimited reports whether codes with this duration never expire
+func (d Duration) IsUnlimited() bool {
+	return d == DurationUnlimited
+}
+
+// TimeDuration returns the length of the duration; unlimited returns 0
+func (d Duration) TimeDuration() (time.Duration, error) {
+	length, ok := durations[d]
+	if !ok {
+		return 0, fmt.Errorf("invalid duration %q", string(d))
+	}
+	return length, nil
+}
+
+// Validate normalizes and checks a code generation request, returning a
+// validation APIError listing every invalid field
+func (r *CodeGenerationRequest) Validate() error {
+	err := NewValidationError()
+
+	r.Purpose = strings.TrimSpace(r.Purpose)
+	switch {
+	case r.Purpose == "":
+		err.WithField("purpose", "required", "Purpose is required")
+	case utf8.RuneCountInString(r.Purpose) > MaxPurposeLength:
+		err.WithField("purpose", "max", fmt.Sprintf("Purpose must be at most %d characters", MaxPurposeLength))
+	}
+
+	if r.Duration == "" {
+		err.WithField("duration", "required", "Duration is required")
+	} else if duration, parseErr := ParseDuration(string(r.Duration)); parseErr != nil {
+		err.WithField("duration", "oneof", "Duration must be one of 10min, 30min, 1hour, unlimited")
+	} else {
+		r.Duration = duration
+	}
+
+	if len(err.Fields) > 0 {
+		return err
+	}
+	return nil
+}
+
+// Validate normalizes and checks a code validation request. Codes are
+// accepted with spaces or dashes and in either case, as users type them.
+func (r *CodeValidationRequest) Validate() error {
+	r.Code = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(r.Code))
+	r.Validator = strings.TrimSpace(r.Validator)
+
+	switch {
+	case r.Code == "":
+		return NewValidationError().WithField("code", "required", "Code is required")
+	case len(r.Code) != AccessCodeLength || !isAlphanumeric(r.Code):
+		return NewValidationError().WithField("code", "len", fmt.Sprintf("Code must be %d letters or digits", AccessCodeLength))
+	}
+	return nil
+}
+
+// isAlphanumeric reports whether s contains only ASCII letters and digits
+func isAlphanumeric(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package types
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	cases := map[string]time.Duration{
+		"10min":     10 * time.Minute,
+		"30min":     30 * time.Minute,
+		"1hour":     time.Hour,
+		" 1HOUR ":   time.Hour,
+		"unlimited": 0,
+	}
+	for input, expected := range cases {
+		d, err := ParseDuration(input)
+		if err != nil {
+			t.Errorf("Expected %q to parse, got %v", input, err)
+			continue
+		}
+		length, err := d.TimeDuration()
+		if err != nil || length != expected {
+			t.Errorf("Expected %q to map to %v, got %v (%v)", input, expected, length, err)
+		}
+	}
+
+	for _, input := range []string{"", "15min", "1h", "forever"} {
+		if _, err := ParseDuration(input); err == nil {
+			t.Errorf("Expected %q to be rejected", input)
+		}
+	}
+
+	if !DurationUnlimited.IsUnlimited() || Duration1Hour.IsUnlimited() {
+		t.Errorf("Expected only unlimited to be unlimited")
+	}
+	if _, err := Duration("2hours").TimeDuration(); err == nil {
+		t.Errorf("Expected invalid duration to fail")
+	}
+}
+
+func TestCodeGenerationRequestValidate(t *testing.T) {
+	req := CodeGenerationRequest{Purpose: "  Visitor  ", Duration: "30MIN"}
+	if err := req.Validate(); err != nil {
+		t.Fatalf("Expected request to be valid, got %v", err)
+	}
+	if req.Purpose != "Visitor" || req.Duration != Duration30Min {
+		t.Errorf("Expected request to be normalized, got %+v", req)
+	}
+
+	req = CodeGenerationRequest{Purpose: strings.Repeat("x", MaxPurposeLength+1), Duration: "2hours"}
+	err := req.Validate()
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected APIError, got %v", err)
+	}
+	if apiErr.Code != ErrCodeValidationFailed || len(apiErr.Fields) != 2 {
+		t.Errorf("Expected two field errors, got %+v", apiErr)
+	}
+
+	req = CodeGenerationRequest{}
+	if err := req.Validate(); !errors.As(err, &apiErr) || len(apiErr.Fields) != 2 || apiErr.Fields[0].Code != "required" {
+		t.Errorf("Expected required errors, got %v", err)
+	}
+}
+
+func TestCodeValidationRequestValidate(t *testing.T) {
+	req := CodeValidationRequest{Code: "abc-123", Validator: " gate-1 "}
+	if err := req.Validate(); err != nil {
+		t.Fatalf("Expected request to be valid, got %v", err)
+	}
+	if req.Code != "ABC123" || req.Validator != "gate-1" {
+		t.Errorf("Expected request to be normalized, got %+v", req)
+	}
+
+	for _, code := range []string{"", "12345", "1234567", "12345!"} {
+		req := CodeValidationRequest{Code: code}
+		if err := req.Validate(); err == nil {
+			t.Errorf("Expected code %q to be rejected", code)
+		}
+	}
+}
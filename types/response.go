@@ -0,0 +1,59 @@
+package types
+
+import "net/http"
+
+// APIResponseT is the standard API response with typed data
+type APIResponseT[T any] struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Data    T      `json:"data,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// PaginatedResponseT is a page-number paginated response with typed data.
+// T is normally a slice type; see NewPaginatedResponse.
+type PaginatedResponseT[T any] struct {
+	Data       T   `json:"data"`
+	Total      int `json:"total"`
+	Page       int `json:"page"`
+	PageSize   int `json:"page_size"`
+	TotalPages int `json:"total_pages"`
+}
+
+// OK returns a 200 status and a successful response. The pair can be passed
+// straight to Gin: c.JSON(types.OK(user)).
+func OK[T any](data T) (int, APIResponseT[T]) {
+	return http.StatusOK, APIResponseT[T]{Success: true, Data: data}
+}
+
+// Created returns a 201 status and a successful response
+func Created[T any](data T) (int, APIResponseT[T]) {
+	return http.StatusCreated, APIResponseT[T]{Success: true, Data: data}
+}
+
+// Error returns the status and payload for err, see AsAPIError
+func Error(err error) (int, *APIError) {
+	apiErr := AsAPIError(err)
+	return apiErr.HTTPStatus(), apiErr
+}
+
+// NewPaginatedResponse builds a page of items for the given page parameters
+// and total item count
+func NewPaginatedResponse[T any](items []T, total int, pagination Pagination) PaginatedResponseT[[]T] {
+	if items == nil {
+		items = []T{}
+	}
+
+	totalPages := 0
+	if pagination.PageSize > 0 {
+		totalPages = (total + pagination.PageSize - 1) / pagination.PageSize
+	}
+
+	return PaginatedResponseT[[]T]{
+		Data:       items,
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: totalPages,
+	}
+}
@@ -0,0 +1,65 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestAPIResponseAliases(t *testing.T) {
+	// The untyped names still accept any data
+	response := APIResponse{Success: true, Message: "ok", Data: map[string]string{"id": "1"}}
+	var typed APIResponseT[interface{}] = response
+	if !typed.Success {
+		t.Errorf("Expected alias to share the typed representation")
+	}
+
+	page := PaginatedResponse{Data: []string{"a"}, Total: 1}
+	if page.Total != 1 {
+		t.Errorf("Expected PaginatedResponse fields to be kept, got %+v", page)
+	}
+}
+
+func TestResponseBuilders(t *testing.T) {
+	user := User{ID: "user-123", Email: "test@example.com"}
+
+	status, response := OK(user)
+	if status != http.StatusOK || !response.Success || response.Data.ID != "user-123" {
+		t.Errorf("Unexpected OK response %d %+v", status, response)
+	}
+
+	status, created := Created(&AccessCode{ID: "code-1"})
+	if status != http.StatusCreated || created.Data.ID != "code-1" {
+		t.Errorf("Unexpected Created response %d %+v", status, created)
+	}
+
+	data, _ := json.Marshal(response)
+	var decoded APIResponseT[User]
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Data.Email != "test@example.com" {
+		t.Errorf("Expected typed round trip, got %+v (%v)", decoded, err)
+	}
+
+	status, apiErr := Error(NewConflictError("Code already used"))
+	if status != http.StatusConflict || apiErr.Code != ErrCodeConflict {
+		t.Errorf("Unexpected Error response %d %+v", status, apiErr)
+	}
+
+	status, apiErr = Error(errors.New("boom"))
+	if status != http.StatusInternalServerError || apiErr.Code != ErrCodeInternal {
+		t.Errorf("Expected internal error, got %d %+v", status, apiErr)
+	}
+}
+
+func TestNewPaginatedResponse(t *testing.T) {
+	page := NewPaginatedResponse([]User{{ID: "1"}, {ID: "2"}}, 45, Pagination{Page: 2, PageSize: 20})
+	if page.TotalPages != 3 || page.Page != 2 || len(page.Data) != 2 {
+		t.Errorf("Unexpected page %+v", page)
+	}
+
+	empty := NewPaginatedResponse[User](nil, 0, Pagination{Page: 1, PageSize: 20})
+	data, _ := json.Marshal(empty)
+	if string(data) != `{"data":[],"total":0,"page":1,"page_size":20,"total_pages":0}` {
+		t.Errorf("Unexpected JSON %s", data)
+	}
+}
@@ -0,0 +1,60 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJSONSchema(t *testing.T) {
+	schema := JSONSchema(AccessCode{})
+
+	if schema["type"] != "object" {
+		t.Fatalf("Expected object schema, got %v", schema["type"])
+	}
+
+	properties := schema["properties"].(map[string]interface{})
+
+	tests := map[string]map[string]interface{}{
+		"code":       {"type": "string"},
+		"is_used":    {"type": "boolean"},
+		"expires_at": {"type": "string", "format": "date-time"},
+		"used_at":    {"type": []string{"string", "null"}, "format": "date-time"},
+		// Embedded AuditFields are flattened
+		"created_at": {"type": "string", "format": "date-time"},
+		"deleted_at": {"type": "string", "format": "date-time"},
+	}
+	for name, expected := range tests {
+		if !reflect.DeepEqual(properties[name], expected) {
+			t.Errorf("Expected %s schema %v, got %v", name, expected, properties[name])
+		}
+	}
+
+	required := schema["required"].([]string)
+	contains := func(name string) bool {
+		for _, r := range required {
+			if r == name {
+				return true
+			}
+		}
+		return false
+	}
+	if !contains("code") || !contains("created_at") {
+		t.Errorf("Expected code and created_at to be required, got %v", required)
+	}
+	if contains("deleted_at") || contains("created_by") {
+		t.Errorf("Expected omitempty fields to be optional, got %v", required)
+	}
+}
+
+func TestJSONSchemaCollections(t *testing.T) {
+	schema := JSONSchema(JWTClaims{})
+	properties := schema["properties"].(map[string]interface{})
+
+	scopes := properties["scopes"].(map[string]interface{})
+	if scopes["type"] != "array" || !reflect.DeepEqual(scopes["items"], map[string]interface{}{"type": "string"}) {
+		t.Errorf("Expected string array schema for scopes, got %v", scopes)
+	}
+	if _, ok := properties["Extra"]; ok {
+		t.Errorf("Expected json:\"-\" fields to be skipped")
+	}
+}
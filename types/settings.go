@@ -0,0 +1,282 @@
+package types
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OrgSettings holds an organization's policy for access codes and its
+// integrations. It is stored as a JSON document per organization.
+type OrgSettings struct {
+	OrgID               string            `json:"org_id"`
+	DefaultCodeDuration Duration          `json:"default_code_duration"`
+	MaxCodeDuration     Duration          `json:"max_code_duration"`
+	MaxActiveCodes      int               `json:"max_active_codes"`           // Per user; 0 means no limit
+	AllowedPurposes     []string          `json:"allowed_purposes,omitempty"` // Empty allows any purpose
+	WebhookEndpoints    []WebhookEndpoint `json:"webhook_endpoints,omitempty"`
+	Quotas              []Quota           `json:"quotas,omitempty"`
+}
+
+// WebhookEndpoint is a URL that receives an organization's events
+type WebhookEndpoint struct {
+	ID      string      `json:"id"`
+	URL     string      `json:"url"`
+	Events  []EventType `json:"events,omitempty"` // Empty subscribes to every event
+	Enabled bool        `json:"enabled"`
+}
+
+// Subscribes reports whether the endpoint is enabled and wants the event type
+func (w WebhookEndpoint) Subscribes(eventType EventType) bool {
+	if !w.Enabled {
+		return false
+	}
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultOrgSettings returns the settings used for organizations that haven't
+// configured their own
+func DefaultOrgSettings() *OrgSettings {
+	return &OrgSettings{
+		DefaultCodeDuration: Duration30Min,
+		MaxCodeDuration:     DurationUnlimited,
+		MaxActiveCodes:      10,
+	}
+}
+
+// durationRank orders durations from shortest to longest
+var durationRank = map[Duration]int{
+	Duration10Min:     1,
+	Duration30Min:     2,
+	Duration1Hour:     3,
+	DurationUnlimited: 4,
+}
+
+// Validate checks the settings, returning a validation APIError listing every
+// invalid field
+func (s *OrgSettings) Validate() error {
+	err := NewValidationError()
+
+	if !s.DefaultCodeDuration.IsValid() {
+		err.WithField("default_code_duration", "oneof", "Default code duration must be one of 10min, 30min, 1hour, unlimited")
+	}
+	if !s.MaxCodeDuration.IsValid() {
+		err.WithField("max_code_duration", "oneof", "Maximum code duration must be one of 10min, 30min, 1hour, unlimited")
+	} else if durationRank[s.DefaultCodeDuration] > durationRank[s.MaxCodeDuration] {
+		err.WithField("default_code_duration", "max", "Default code duration must not exceed the maximum")
+	}
+	if s.MaxActiveCodes < 0 {
+		err.WithField("max_active_codes", "min", "Maximum active codes must not be negative")
+	}
+
+	for i, endpoint := range s.WebhookEndpoints {
+		u, parseErr := url.Parse(endpoint.URL)
+		if parseErr != nil || u.Scheme != "https" || u.Host == "" {
+			err.WithField(fmt.Sprintf("webhook_endpoints[%d].url", i), "url", "Webhook URL must be an absolute https URL")
+		}
+	}
+
+	for i, quota := range s.Quotas {
+		if quota.Metric.Windowed() && !quota.Period.IsValid() {
+			err.WithField(fmt.Sprintf("quotas[%d].period", i), "oneof", "Quota period must be one of minute, hour, day, month")
+		}
+	}
+
+	if len(err.Fields) > 0 {
+		return err
+	}
+	return nil
+}
+
+// IsPurposeAllowed reports whether codes may be generated for the purpose,
+// ignoring case and surrounding whitespace
+func (s *OrgSettings) IsPurposeAllowed(purpose string) bool {
+	if len(s.AllowedPurposes) == 0 {
+		return true
+	}
+	purpose = strings.TrimSpace(purpose)
+	for _, allowed := range s.AllowedPurposes {
+		if strings.EqualFold(allowed, purpose) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveDuration returns the duration to use for a requested duration: the
+// default when none was requested, or an error when it exceeds the maximum
+func (s *OrgSettings) ResolveDuration(requested Duration) (Duration, error) {
+	if requested == "" {
+		return s.DefaultCodeDuration, nil
+	}
+	if !requested.IsValid() {
+		return "", NewValidationError().WithField("duration", "oneof", "Duration must be one of 10min, 30min, 1hour, unlimited")
+	}
+	if s.MaxCodeDuration.IsValid() && durationRank[requested] > durationRank[s.MaxCodeDuration] {
+		return "", NewValidationError().WithField("duration", "max", fmt.Sprintf("Duration must not exceed %s", s.MaxCodeDuration))
+	}
+	return requested, nil
+}
+
+// CheckCodeRequest applies the organization policy to a validated code
+// generation request for a user who already has activeCodes unexpired codes
+func (s *OrgSettings) CheckCodeRequest(req *CodeGenerationRequest, activeCodes int) error {
+	if !s.IsPurposeAllowed(req.Purpose) {
+		return NewValidationError().WithField("purpose", "oneof", "Purpose is not allowed for this organization")
+	}
+
+	duration, err := s.ResolveDuration(req.Duration)
+	if err != nil {
+		return err
+	}
+	req.Duration = duration
+
+	if s.MaxActiveCodes > 0 && activeCodes >= s.MaxActiveCodes {
+		return NewAPIError(ErrCodeQuotaExceeded, fmt.Sprintf("At most %d active codes are allowed", s.MaxActiveCodes))
+	}
+	return nil
+}
+
+// WebhooksFor returns the enabled endpoints subscribed to the event type
+func (s *OrgSettings) WebhooksFor(eventType EventType) []WebhookEndpoint {
+	var endpoints []WebhookEndpoint
+	for _, endpoint := range s.WebhookEndpoints {
+		if endpoint.Subscribes(eventType) {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+// Quota returns the organization's quota for a metric
+func (s *OrgSettings) Quota(metric QuotaMetric) (Quota, bool) {
+	for _, quota := range s.Quotas {
+		if quota.Metric == metric {
+			return quota, true
+		}
+	}
+	return Quota{}, false
+}
+
+// QuotaMetric names a counted resource
+type QuotaMetric string
+
+const (
+	QuotaCodesGenerated QuotaMetric = "codes_generated"
+	QuotaValidations    QuotaMetric = "validations"
+	QuotaAPIRequests    QuotaMetric = "api_requests"
+	// QuotaActiveCodes counts the organization's unexpired codes rather than
+	// usage over a period
+	QuotaActiveCodes QuotaMetric = "active_codes"
+)
+
+// Windowed reports whether the metric counts usage over the quota's period.
+// Other metrics count what exists now, and their quotas have no period.
+func (m QuotaMetric) Windowed() bool {
+	return m != QuotaActiveCodes
+}
+
+// QuotaPeriod is the calendar window a quota counts over, in UTC
+type QuotaPeriod string
+
+const (
+	QuotaPeriodMinute QuotaPeriod = "minute"
+	QuotaPeriodHour   QuotaPeriod = "hour"
+	QuotaPeriodDay    QuotaPeriod = "day"
+	QuotaPeriodMonth  QuotaPeriod = "month"
+)
+
+// IsValid reports whether p is one of the supported periods
+func (p QuotaPeriod) IsValid() bool {
+	switch p {
+	case QuotaPeriodMinute, QuotaPeriodHour, QuotaPeriodDay, QuotaPeriodMonth:
+		return true
+	}
+	return false
+}
+
+// Window returns the start and end of the period containing now
+func (p QuotaPeriod) Window(now time.Time) (start, end time.Time) {
+	now = now.UTC()
+	switch p {
+	case QuotaPeriodMinute:
+		start = now.Truncate(time.Minute)
+		return start, start.Add(time.Minute)
+	case QuotaPeriodHour:
+		start = now.Truncate(time.Hour)
+		return start, start.Add(time.Hour)
+	case QuotaPeriodMonth:
+		start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 1)
+	}
+}
+
+// Quota limits how much of a metric an organization may use per period
+type Quota struct {
+	Metric QuotaMetric `json:"metric"`
+	Limit  int64       `json:"limit"` // 0 or less means no limit
+	Period QuotaPeriod `json:"period"`
+}
+
+// QuotaStatus is the state of a quota at a point in time, suitable for
+// X-RateLimit style response headers
+type QuotaStatus struct {
+	Metric    QuotaMetric `json:"metric"`
+	Limit     int64       `json:"limit"`
+	Used      int64       `json:"used"`
+	Remaining int64       `json:"remaining"`
+	ResetAt   time.Time   `json:"reset_at"`
+}
+
+// IsUnlimited reports whether the quota has no limit
+func (q Quota) IsUnlimited() bool {
+	return q.Limit <= 0
+}
+
+// Remaining returns how much is left after used, never less than zero
+func (q Quota) Remaining(used int64) int64 {
+	if q.IsUnlimited() || used >= q.Limit {
+		return 0
+	}
+	return q.Limit - used
+}
+
+// Allows reports whether n more can be used on top of used
+func (q Quota) Allows(used, n int64) bool {
+	return q.IsUnlimited() || used+n <= q.Limit
+}
+
+// Status returns the quota state for the current window
+func (q Quota) Status(used int64, now time.Time) QuotaStatus {
+	_, resetAt := q.Period.Window(now)
+	return QuotaStatus{
+		Metric:    q.Metric,
+		Limit:     q.Limit,
+		Used:      used,
+		Remaining: q.Remaining(used),
+		ResetAt:   resetAt,
+	}
+}
+
+// Check returns a quota_exceeded APIError when n more would exceed the quota
+func (q Quota) Check(used, n int64) error {
+	if q.Allows(used, n) {
+		return nil
+	}
+	if !q.Metric.Windowed() {
+		return NewAPIError(ErrCodeQuotaExceeded, fmt.Sprintf("Quota for %s exceeded: limit is %d", q.Metric, q.Limit))
+	}
+	return NewAPIError(ErrCodeQuotaExceeded, fmt.Sprintf("Quota for %s exceeded: limit is %d per %s", q.Metric, q.Limit, q.Period))
+}
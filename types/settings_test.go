@@ -0,0 +1,129 @@
+package types
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOrgSettingsValidate(t *testing.T) {
+	if err := DefaultOrgSettings().Validate(); err != nil {
+		t.Errorf("Expected default settings to be valid, got %v", err)
+	}
+
+	settings := &OrgSettings{
+		DefaultCodeDuration: DurationUnlimited,
+		MaxCodeDuration:     Duration1Hour,
+		MaxActiveCodes:      -1,
+		WebhookEndpoints:    []WebhookEndpoint{{URL: "http://example.com/hook"}},
+		Quotas: []Quota{
+			{Metric: QuotaValidations, Limit: 10, Period: "week"},
+			{Metric: QuotaActiveCodes, Limit: 50}, // No period needed
+		},
+	}
+
+	var apiErr *APIError
+	if !errors.As(settings.Validate(), &apiErr) {
+		t.Fatalf("Expected a validation APIError")
+	}
+	if len(apiErr.Fields) != 4 {
+		t.Errorf("Expected 4 field errors, got %+v", apiErr.Fields)
+	}
+}
+
+func TestOrgSettingsCheckCodeRequest(t *testing.T) {
+	settings := DefaultOrgSettings()
+	settings.MaxCodeDuration = Duration1Hour
+	settings.MaxActiveCodes = 2
+	settings.AllowedPurposes = []string{"Delivery", "Visitor"}
+
+	req := &CodeGenerationRequest{Purpose: "delivery"}
+	if err := settings.CheckCodeRequest(req, 0); err != nil {
+		t.Fatalf("Expected request to be allowed, got %v", err)
+	}
+	if req.Duration != Duration30Min {
+		t.Errorf("Expected default duration to be filled in, got %s", req.Duration)
+	}
+
+	if err := settings.CheckCodeRequest(&CodeGenerationRequest{Purpose: "Party"}, 0); err == nil {
+		t.Errorf("Expected purpose outside the allowlist to be rejected")
+	}
+	if err := settings.CheckCodeRequest(&CodeGenerationRequest{Purpose: "Visitor", Duration: DurationUnlimited}, 0); err == nil {
+		t.Errorf("Expected duration above the maximum to be rejected")
+	}
+
+	err := settings.CheckCodeRequest(&CodeGenerationRequest{Purpose: "Visitor", Duration: Duration10Min}, 2)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != ErrCodeQuotaExceeded || apiErr.HTTPStatus() != 429 {
+		t.Errorf("Expected quota_exceeded error, got %v", err)
+	}
+}
+
+func TestOrgSettingsWebhooksFor(t *testing.T) {
+	settings := &OrgSettings{WebhookEndpoints: []WebhookEndpoint{
+		{ID: "all", Enabled: true},
+		{ID: "codes", Enabled: true, Events: []EventType{EventCodeGenerated}},
+		{ID: "disabled"},
+	}}
+
+	if got := settings.WebhooksFor(EventCodeGenerated); len(got) != 2 {
+		t.Errorf("Expected 2 endpoints for code.generated, got %+v", got)
+	}
+	if got := settings.WebhooksFor(EventUserInvited); len(got) != 1 || got[0].ID != "all" {
+		t.Errorf("Expected only the catch-all endpoint for user.invited, got %+v", got)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	quota := Quota{Metric: QuotaCodesGenerated, Limit: 5, Period: QuotaPeriodDay}
+
+	if !quota.Allows(4, 1) || quota.Allows(5, 1) {
+		t.Errorf("Expected quota to allow up to the limit")
+	}
+	if quota.Remaining(3) != 2 || quota.Remaining(9) != 0 {
+		t.Errorf("Unexpected remaining values")
+	}
+	if err := quota.Check(5, 1); err == nil {
+		t.Errorf("Expected an error above the limit")
+	}
+
+	unlimited := Quota{Metric: QuotaAPIRequests}
+	if !unlimited.IsUnlimited() || unlimited.Check(1e9, 1) != nil {
+		t.Errorf("Expected a zero limit to be unlimited")
+	}
+
+	active := Quota{Metric: QuotaActiveCodes, Limit: 50}
+	if active.Metric.Windowed() || !quota.Metric.Windowed() {
+		t.Errorf("Expected only active codes to have no window")
+	}
+	if err := active.Check(50, 1); err == nil || err.Error() != "quota_exceeded: Quota for active_codes exceeded: limit is 50" {
+		t.Errorf("Unexpected active codes error: %v", err)
+	}
+
+	now := time.Date(2024, 3, 15, 13, 45, 0, 0, time.UTC)
+	status := quota.Status(2, now)
+	if status.Remaining != 3 || !status.ResetAt.Equal(time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestQuotaPeriodWindow(t *testing.T) {
+	now := time.Date(2024, 12, 31, 23, 59, 30, 0, time.UTC)
+
+	tests := []struct {
+		period     QuotaPeriod
+		start, end time.Time
+	}{
+		{QuotaPeriodMinute, time.Date(2024, 12, 31, 23, 59, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{QuotaPeriodHour, time.Date(2024, 12, 31, 23, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{QuotaPeriodDay, time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{QuotaPeriodMonth, time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		start, end := tt.period.Window(now)
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("%s: expected %v-%v, got %v-%v", tt.period, tt.start, tt.end, start, end)
+		}
+	}
+}
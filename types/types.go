@@ -1,15 +1,18 @@
 package types
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
 )
 
 // User represents a user in the system
 type User struct {
 	ID           string    `json:"id" db:"id"`
-	Email        string    `json:"email" db:"email"`
+	Email        Email     `json:"email" db:"email"`
 	Name         string    `json:"name" db:"name"`
 	Avatar       string    `json:"avatar" db:"avatar"`
 	Role         UserRole  `json:"role" db:"role"`
@@ -17,8 +20,7 @@ type User struct {
 	Provider     string    `json:"provider" db:"provider"` // google, facebook, apple
 	ProviderID   string    `json:"provider_id" db:"provider_id"`
 	IsActive     bool      `json:"is_active" db:"is_active"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	AuditFields
 }
 
 // UserRole represents user roles
@@ -37,8 +39,7 @@ type Organization struct {
 	Description string    `json:"description" db:"description"`
 	Domain      string    `json:"domain" db:"domain"`
 	IsActive    bool      `json:"is_active" db:"is_active"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	AuditFields
 }
 
 // AccessCode represents a generated access code
@@ -50,9 +51,22 @@ type AccessCode struct {
 	Purpose     string    `json:"purpose" db:"purpose"`
 	ExpiresAt   time.Time `json:"expires_at" db:"expires_at"`
 	IsUsed      bool      `json:"is_used" db:"is_used"`
-	UsedAt      *time.Time `json:"used_at" db:"used_at"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	UsedAt      NullTime  `json:"used_at" db:"used_at"`
+	AuditFields
+}
+
+// IsExpired reports whether the code has expired on the given clock; nil uses
+// the system clock. Unlimited codes have no expiry time and never expire.
+func (c *AccessCode) IsExpired(clk clock.Clock) bool {
+	if c.ExpiresAt.IsZero() {
+		return false
+	}
+	return clock.OrReal(clk).Now().After(c.ExpiresAt)
+}
+
+// IsRedeemable reports whether the code is unused and unexpired
+func (c *AccessCode) IsRedeemable(clk clock.Clock) bool {
+	return !c.IsUsed && !c.IsExpired(clk)
 }
 
 // ValidationLog represents a code validation attempt
@@ -79,8 +93,8 @@ type Validator struct {
 
 // CodeGenerationRequest represents a request to generate a code
 type CodeGenerationRequest struct {
-	Purpose   string `json:"purpose" validate:"required"`
-	Duration  string `json:"duration" validate:"required,oneof=10min 30min 1hour unlimited"`
+	Purpose   string   `json:"purpose" validate:"required"`
+	Duration  Duration `json:"duration" validate:"required,oneof=10min 30min 1hour unlimited"`
 }
 
 // CodeValidationRequest represents a request to validate a code
@@ -100,20 +114,19 @@ type CodeValidationResponse struct {
 
 // QRCodeData represents the data encoded in QR codes for offline validation
 type QRCodeData struct {
-	Code      string    `json:"code"`
-	Signature string    `json:"signature"`
-	ExpiresAt time.Time `json:"expires_at"`
-	Purpose   string    `json:"purpose"`
-	OrgID     string    `json:"org_id"`
+	Code        string    `json:"code"`
+	Signature   string    `json:"signature"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Purpose     string    `json:"purpose"`
+	OrgID       string    `json:"org_id"`
+	KeyID       string    `json:"kid,omitempty"`
+	Nonce       string    `json:"nonce,omitempty"`        // Single-use ID for replay protection
+	ValidatorID string    `json:"validator_id,omitempty"` // Validator device the code is bound to, if any
 }
 
-// APIResponse represents a standard API response
-type APIResponse struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
-}
+// APIResponse represents a standard API response. New code should prefer
+// APIResponseT, which keeps the type of Data.
+type APIResponse = APIResponseT[interface{}]
 
 // Pagination represents pagination parameters
 type Pagination struct {
@@ -121,14 +134,9 @@ type Pagination struct {
 	PageSize int `json:"page_size" query:"page_size"`
 }
 
-// PaginatedResponse represents a paginated response
-type PaginatedResponse struct {
-	Data       interface{} `json:"data"`
-	Total      int         `json:"total"`
-	Page       int         `json:"page"`
-	PageSize   int         `json:"page_size"`
-	TotalPages int         `json:"total_pages"`
-}
+// PaginatedResponse represents a paginated response. New code should prefer
+// PaginatedResponseT, which keeps the type of Data.
+type PaginatedResponse = PaginatedResponseT[interface{}]
 
 // OAuthProvider represents OAuth provider configuration
 type OAuthProvider struct {
@@ -137,62 +145,154 @@ type OAuthProvider struct {
 	RedirectURL  string `json:"redirect_url"`
 }
 
-// JWTClaims represents JWT token claims
+// JWTClaims represents JWT token claims. The registered claims (iss, sub,
+// aud, exp, nbf, iat, jti) come from the embedded jwt.RegisteredClaims, which
+// also makes JWTClaims satisfy jwt.Claims.
 type JWTClaims struct {
-	UserID string   `json:"user_id"`
-	Email  string   `json:"email"`
-	Role   UserRole `json:"role"`
-	OrgID  string   `json:"org_id"`
-	Exp    int64    `json:"exp"`
-	Iat    int64    `json:"iat"`
-}
-
-// GetExpirationTime returns the expiration time as a NumericDate
-func (c JWTClaims) GetExpirationTime() (*jwt.NumericDate, error) {
-	if c.Exp == 0 {
-		return nil, nil
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	Role      UserRole  `json:"role"`
+	OrgID     string    `json:"org_id"`
+	TokenType TokenType `json:"token_type,omitempty"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	Purpose   string    `json:"purpose,omitempty"`
+	jwt.RegisteredClaims
+
+	// Extra holds custom claims; they are flattened into the token payload
+	Extra map[string]interface{} `json:"-"`
+}
+
+// jwtClaimsJSON is JWTClaims without its JSON methods, used to avoid recursion
+type jwtClaimsJSON JWTClaims
+
+// reservedClaims lists the claim names owned by JWTClaims fields
+var reservedClaims = map[string]bool{
+	"user_id": true, "email": true, "role": true, "org_id": true, "token_type": true,
+	"jti": true, "iss": true, "aud": true, "exp": true, "iat": true, "nbf": true,
+	"scopes": true, "purpose": true, "sub": true,
+}
+
+// IsReservedClaim reports whether a claim name is owned by a JWTClaims field
+// and therefore cannot be used as a custom claim
+func IsReservedClaim(name string) bool {
+	return reservedClaims[name]
+}
+
+// MarshalJSON encodes the claims with custom claims flattened into the payload
+func (c JWTClaims) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(jwtClaimsJSON(c))
+	if err != nil || len(c.Extra) == 0 {
+		return data, err
+	}
+
+	merged := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	for name, value := range c.Extra {
+		if reservedClaims[name] {
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode claim %q: %w", name, err)
+		}
+		merged[name] = raw
 	}
-	return jwt.NewNumericDate(time.Unix(c.Exp, 0)), nil
+	return json.Marshal(merged)
 }
 
-// GetIssuedAt returns the issued at time as a NumericDate
-func (c JWTClaims) GetIssuedAt() (*jwt.NumericDate, error) {
-	if c.Iat == 0 {
-		return nil, nil
+// UnmarshalJSON decodes the claims, collecting unknown claims into Extra
+func (c *JWTClaims) UnmarshalJSON(data []byte) error {
+	var decoded jwtClaimsJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	var all map[string]interface{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	for name, value := range all {
+		if reservedClaims[name] {
+			continue
+		}
+		if decoded.Extra == nil {
+			decoded.Extra = make(map[string]interface{})
+		}
+		decoded.Extra[name] = value
 	}
-	return jwt.NewNumericDate(time.Unix(c.Iat, 0)), nil
+
+	*c = JWTClaims(decoded)
+	return nil
 }
 
-// GetNotBefore returns the not before time as a NumericDate
-func (c JWTClaims) GetNotBefore() (*jwt.NumericDate, error) {
-	// NotBefore is not used in our claims, return nil
-	return nil, nil
+// HasScope reports whether the claims grant the given scope
+func (c JWTClaims) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
 }
 
-// GetIssuer returns the issuer
-func (c JWTClaims) GetIssuer() (string, error) {
-	// Issuer is not used in our claims, return empty string
-	return "", nil
+// TokenType distinguishes user access tokens, refresh tokens, service tokens
+// and single-purpose action tokens
+type TokenType string
+
+const (
+	TokenTypeAccess  TokenType = "access"
+	TokenTypeRefresh TokenType = "refresh"
+	TokenTypeService TokenType = "service"
+	TokenTypeAction  TokenType = "action"
+)
+
+// PrincipalType identifies who a token was issued to
+type PrincipalType string
+
+const (
+	PrincipalUser    PrincipalType = "user"
+	PrincipalService PrincipalType = "service"
+)
+
+// Principal returns the kind of principal the claims were issued to
+func (c JWTClaims) Principal() PrincipalType {
+	if c.TokenType == TokenTypeService {
+		return PrincipalService
+	}
+	return PrincipalUser
+}
+
+// PrincipalID returns the service name for service tokens and the user ID otherwise
+func (c JWTClaims) PrincipalID() string {
+	if c.Principal() == PrincipalService {
+		return c.Subject
+	}
+	return c.UserID
 }
 
-// GetSubject returns the subject
-func (c JWTClaims) GetSubject() (string, error) {
-	// Subject is not used in our claims, return empty string
-	return "", nil
+// IsRefresh reports whether the claims belong to a refresh token. Tokens
+// issued before token types were introduced are treated as access tokens.
+func (c JWTClaims) IsRefresh() bool {
+	return c.TokenType == TokenTypeRefresh
 }
 
-// GetAudience returns the audience
-func (c JWTClaims) GetAudience() (jwt.ClaimStrings, error) {
-	// Audience is not used in our claims, return empty ClaimStrings
-	return jwt.ClaimStrings{}, nil
+// TokenPair represents an access token and its matching refresh token
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	TokenType        string    `json:"token_type"`
+	AccessExpiresAt  time.Time `json:"access_expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
 }
 
 // Duration constants
 const (
-	Duration10Min    = "10min"
-	Duration30Min    = "30min"
-	Duration1Hour    = "1hour"
-	DurationUnlimited = "unlimited"
+	Duration10Min     Duration = "10min"
+	Duration30Min     Duration = "30min"
+	Duration1Hour     Duration = "1hour"
+	DurationUnlimited Duration = "unlimited"
 )
 
 // Status constants
@@ -1,8 +1,13 @@
 package types
 
 import (
+	"encoding/json"
+	"errors"
 	"testing"
 	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
 )
 
 func TestUserRoleConstants(t *testing.T) {
@@ -29,8 +34,7 @@ func TestUserStruct(t *testing.T) {
 		Role:      RoleMember,
 		OrgID:     "org-123",
 		IsActive:  true,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		AuditFields: AuditFields{CreatedAt: time.Now(), UpdatedAt: time.Now()},
 	}
 	
 	if user.ID != "test-id" {
@@ -54,8 +58,7 @@ func TestOrganizationStruct(t *testing.T) {
 		Description: "Test Description",
 		Domain:      "test.com",
 		IsActive:    true,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		AuditFields: AuditFields{CreatedAt: time.Now(), UpdatedAt: time.Now()},
 	}
 	
 	if org.ID != "org-123" {
@@ -84,8 +87,7 @@ func TestAccessCodeStruct(t *testing.T) {
 		Purpose:   "test",
 		ExpiresAt: expiresAt,
 		IsUsed:    false,
-		CreatedAt: now,
-		UpdatedAt: now,
+		AuditFields: AuditFields{CreatedAt: now, UpdatedAt: now},
 	}
 	
 	if code.ID != "code-123" {
@@ -105,6 +107,35 @@ func TestAccessCodeStruct(t *testing.T) {
 	}
 }
 
+func TestAccessCodeIsExpired(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	code := AccessCode{ExpiresAt: fake.Now().Add(time.Hour)}
+
+	if code.IsExpired(fake) || !code.IsRedeemable(fake) {
+		t.Error("Expected code to be redeemable before it expires")
+	}
+
+	fake.Advance(time.Hour)
+	if code.IsExpired(fake) {
+		t.Error("Expected code to be valid until its expiry time")
+	}
+
+	fake.Advance(time.Second)
+	if !code.IsExpired(fake) || code.IsRedeemable(fake) {
+		t.Error("Expected code to expire after its expiry time")
+	}
+
+	unlimited := AccessCode{}
+	if unlimited.IsExpired(fake) {
+		t.Error("Expected a code without an expiry time never to expire")
+	}
+
+	used := AccessCode{IsUsed: true}
+	if used.IsRedeemable(fake) {
+		t.Error("Expected a used code not to be redeemable")
+	}
+}
+
 func TestValidatorStruct(t *testing.T) {
 	// Test Validator struct creation
 	validator := Validator{
@@ -186,3 +217,138 @@ func TestCodeValidationResponseStruct(t *testing.T) {
 		t.Errorf("Expected message 'Code is valid', got %s", resp.Message)
 	}
 }
+
+func TestJWTClaimsRegisteredClaims(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	claims := JWTClaims{
+		UserID: "user-123",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://auth.jarakey.test",
+			Subject:   "user-123",
+			Audience:  []string{"codes-api"},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+
+	if iss, _ := claims.GetIssuer(); iss != "https://auth.jarakey.test" {
+		t.Errorf("Expected issuer 'https://auth.jarakey.test', got %s", iss)
+	}
+
+	if sub, _ := claims.GetSubject(); sub != "user-123" {
+		t.Errorf("Expected subject 'user-123', got %s", sub)
+	}
+
+	if aud, _ := claims.GetAudience(); len(aud) != 1 || aud[0] != "codes-api" {
+		t.Errorf("Expected audience [codes-api], got %v", aud)
+	}
+
+	if nbf, _ := claims.GetNotBefore(); nbf == nil || !nbf.Time.Equal(now) {
+		t.Errorf("Expected not before %v, got %v", now, nbf)
+	}
+
+	empty := JWTClaims{}
+	if exp, _ := empty.GetExpirationTime(); exp != nil {
+		t.Errorf("Expected nil expiration for empty claims, got %v", exp)
+	}
+}
+
+func TestJWTClaimsTimeValidation(t *testing.T) {
+	now := time.Now()
+	validator := jwt.NewValidator(jwt.WithExpirationRequired(), jwt.WithIssuedAt(), jwt.WithTimeFunc(func() time.Time { return now }))
+
+	tests := []struct {
+		name   string
+		claims jwt.RegisteredClaims
+		err    error
+	}{
+		{"valid", jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute))}, nil},
+		{"expired", jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(-time.Second))}, jwt.ErrTokenExpired},
+		{"missing expiry", jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(now)}, jwt.ErrTokenRequiredClaimMissing},
+		{"not yet valid", jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			NotBefore: jwt.NewNumericDate(now.Add(time.Minute)),
+		}, jwt.ErrTokenNotValidYet},
+		{"issued in the future", jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now.Add(time.Minute)),
+		}, jwt.ErrTokenUsedBeforeIssued},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validator.Validate(JWTClaims{UserID: "user-123", RegisteredClaims: tt.claims})
+			if tt.err == nil && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestJWTClaimsLegacyJSON(t *testing.T) {
+	// Payload as issued before the registered claims were embedded
+	payload := `{"user_id":"user-123","email":"test@example.com","role":"member","org_id":"org-456","exp":1700003600,"iat":1700000000}`
+
+	var claims JWTClaims
+	if err := json.Unmarshal([]byte(payload), &claims); err != nil {
+		t.Fatalf("Expected no unmarshal error, got %v", err)
+	}
+	if claims.UserID != "user-123" || claims.Role != RoleMember {
+		t.Errorf("Expected identity claims to decode, got %+v", claims)
+	}
+	if claims.ExpiresAt == nil || claims.ExpiresAt.Unix() != 1700003600 {
+		t.Errorf("Expected exp 1700003600, got %v", claims.ExpiresAt)
+	}
+	if claims.IssuedAt == nil || claims.IssuedAt.Unix() != 1700000000 {
+		t.Errorf("Expected iat 1700000000, got %v", claims.IssuedAt)
+	}
+	if len(claims.Extra) != 0 {
+		t.Errorf("Expected no custom claims, got %v", claims.Extra)
+	}
+}
+
+func TestJWTClaimsExtraJSON(t *testing.T) {
+	claims := JWTClaims{
+		UserID: "user-123",
+		Scopes: []string{"codes:validate"},
+		Extra: map[string]interface{}{
+			"device_id": "device-42",
+			"exp":       "ignored",
+		},
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Unix(1700000000, 0))},
+	}
+	
+	data, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("Expected no marshal error, got %v", err)
+	}
+	
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatalf("Expected valid JSON, got %v", err)
+	}
+	if raw["device_id"] != "device-42" {
+		t.Errorf("Expected flattened device_id claim, got %v", raw["device_id"])
+	}
+	if raw["exp"] != float64(1700000000) {
+		t.Errorf("Expected reserved exp claim to be preserved, got %v", raw["exp"])
+	}
+	
+	var decoded JWTClaims
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Expected no unmarshal error, got %v", err)
+	}
+	if decoded.UserID != "user-123" || decoded.ExpiresAt == nil || decoded.ExpiresAt.Unix() != 1700000000 {
+		t.Errorf("Expected registered fields to round trip, got %+v", decoded)
+	}
+	if decoded.Extra["device_id"] != "device-42" || len(decoded.Extra) != 1 {
+		t.Errorf("Expected only device_id in Extra, got %v", decoded.Extra)
+	}
+	if !decoded.HasScope("codes:validate") {
+		t.Error("Expected codes:validate scope")
+	}
+}
@@ -0,0 +1,259 @@
+package types
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Webhook request headers. Receivers should deduplicate on the ID header, as
+// failed deliveries are retried with the same ID.
+const (
+	WebhookIDHeader        = "Jarakey-Webhook-Id"
+	WebhookTimestampHeader = "Jarakey-Webhook-Timestamp"
+	WebhookSignatureHeader = "Jarakey-Webhook-Signature"
+)
+
+// WebhookSignatureVersion is the scheme of signatures in the signature header
+const WebhookSignatureVersion = "v1"
+
+// DefaultWebhookTolerance is how far a delivery timestamp may be from the
+// receiver's clock before the delivery is rejected as a replay
+const DefaultWebhookTolerance = 5 * time.Minute
+
+var (
+	// ErrInvalidWebhookSignature is returned when no signature matches the body
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+	// ErrWebhookTimestampExpired is returned when the delivery timestamp is outside the tolerance
+	ErrWebhookTimestampExpired = errors.New("webhook timestamp outside tolerance")
+)
+
+// WebhookEvent is the JSON body delivered to webhook endpoints
+type WebhookEvent struct {
+	ID        string          `json:"id"`
+	Type      EventType       `json:"type"`
+	Version   int             `json:"version"`
+	OrgID     string          `json:"org_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// NewWebhookEvent creates the webhook body for a domain event. The webhook
+// keeps the event ID so partners can correlate deliveries with our logs.
+func NewWebhookEvent(envelope *Envelope) *WebhookEvent {
+	return &WebhookEvent{
+		ID:        envelope.ID,
+		Type:      envelope.Type,
+		Version:   envelope.Version,
+		OrgID:     envelope.OrgID,
+		CreatedAt: envelope.OccurredAt,
+		Data:      envelope.Data,
+	}
+}
+
+// WebhookSignature is the parsed signature header, "t=<unix>,v1=<hex>". While
+// an endpoint secret is being rotated the header carries one v1 signature per
+// secret.
+type WebhookSignature struct {
+	Timestamp  time.Time
+	Signatures []string
+}
+
+// SignWebhook signs a delivery body with the endpoint secret. The signature
+// covers "<id>.<unix timestamp>.<body>".
+func SignWebhook(secret []byte, id string, timestamp time.Time, body []byte) string {
+	h := hmac.New(sha256.New, secret)
+	fmt.Fprintf(h, "%s.%d.", id, timestamp.Unix())
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// NewWebhookSignature signs a delivery with each of the endpoint secrets
+func NewWebhookSignature(secrets [][]byte, id string, timestamp time.Time, body []byte) *WebhookSignature {
+	signature := &WebhookSignature{Timestamp: timestamp}
+	for _, secret := range secrets {
+		signature.Signatures = append(signature.Signatures, SignWebhook(secret, id, timestamp, body))
+	}
+	return signature
+}
+
+// String formats the signature header value
+func (s *WebhookSignature) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "t=%d", s.Timestamp.Unix())
+	for _, sig := range s.Signatures {
+		b.WriteString("," + WebhookSignatureVersion + "=" + sig)
+	}
+	return b.String()
+}
+
+// ParseWebhookSignature parses a signature header. Signatures of unknown
+// versions are ignored so new schemes can be rolled out alongside v1.
+func ParseWebhookSignature(header string) (*WebhookSignature, error) {
+	signature := &WebhookSignature{}
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			unix, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: bad timestamp", ErrInvalidWebhookSignature)
+			}
+			signature.Timestamp = time.Unix(unix, 0)
+		case WebhookSignatureVersion:
+			signature.Signatures = append(signature.Signatures, value)
+		}
+	}
+
+	if signature.Timestamp.IsZero() || len(signature.Signatures) == 0 {
+		return nil, fmt.Errorf("%w: missing timestamp or signature", ErrInvalidWebhookSignature)
+	}
+	return signature, nil
+}
+
+// VerifyWebhook checks a delivery's signature header against the endpoint
+// secrets and rejects timestamps more than tolerance away from now
+func VerifyWebhook(secrets [][]byte, id, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	signature, err := ParseWebhookSignature(header)
+	if err != nil {
+		return err
+	}
+
+	if skew := now.Sub(signature.Timestamp); skew > tolerance || skew < -tolerance {
+		return ErrWebhookTimestampExpired
+	}
+
+	for _, secret := range secrets {
+		expected := SignWebhook(secret, id, signature.Timestamp, body)
+		for _, sig := range signature.Signatures {
+			if hmac.Equal([]byte(sig), []byte(expected)) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidWebhookSignature
+}
+
+// DeliveryStatus is the outcome of a webhook delivery attempt
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed"    // Will be retried
+	DeliveryAbandoned DeliveryStatus = "abandoned" // Out of retries
+)
+
+// MaxDeliveryResponseBody is how much of an endpoint's response is kept
+const MaxDeliveryResponseBody = 1024
+
+// DeliveryAttempt records one attempt to deliver a webhook event
+type DeliveryAttempt struct {
+	ID             string         `json:"id" db:"id"`
+	EventID        string         `json:"event_id" db:"event_id"`
+	EndpointID     string         `json:"endpoint_id" db:"endpoint_id"`
+	URL            string         `json:"url" db:"url"`
+	Attempt        int            `json:"attempt" db:"attempt"` // Starts at 1
+	Status         DeliveryStatus `json:"status" db:"status"`
+	ResponseStatus int            `json:"response_status,omitempty" db:"response_status"`
+	ResponseBody   string         `json:"response_body,omitempty" db:"response_body"` // Truncated to MaxDeliveryResponseBody
+	Error          string         `json:"error,omitempty" db:"error"`
+	DurationMS     int64          `json:"duration_ms" db:"duration_ms"`
+	AttemptedAt    time.Time      `json:"attempted_at" db:"attempted_at"`
+	NextAttemptAt  NullTime       `json:"next_attempt_at" db:"next_attempt_at"`
+}
+
+// SetResponse records the endpoint's response, truncating the body
+func (d *DeliveryAttempt) SetResponse(status int, body []byte) {
+	d.ResponseStatus = status
+	if len(body) > MaxDeliveryResponseBody {
+		body = body[:MaxDeliveryResponseBody]
+	}
+	d.ResponseBody = string(body)
+}
+
+// Succeeded reports whether the endpoint accepted the delivery with a 2xx response
+func (d *DeliveryAttempt) Succeeded() bool {
+	return d.Error == "" && d.ResponseStatus >= 200 && d.ResponseStatus < 300
+}
+
+// Retryable reports whether a failed attempt is worth retrying: network
+// errors, timeouts, rate limiting and server errors are; other client
+// errors are not
+func (d *DeliveryAttempt) Retryable() bool {
+	if d.Succeeded() {
+		return false
+	}
+	switch {
+	case d.ResponseStatus == 0, d.ResponseStatus >= 500:
+		return true
+	case d.ResponseStatus == 408, d.ResponseStatus == 429:
+		return true
+	}
+	return false
+}
+
+// NotificationChannel is how a notification reaches its recipient
+type NotificationChannel string
+
+const (
+	ChannelEmail NotificationChannel = "email"
+	ChannelSMS   NotificationChannel = "sms"
+	ChannelPush  NotificationChannel = "push"
+)
+
+// NotificationMessage is a request to send a templated notification
+type NotificationMessage struct {
+	ID            string                 `json:"id"`
+	OrgID         string                 `json:"org_id"`
+	Channel       NotificationChannel    `json:"channel"`
+	Recipient     string                 `json:"recipient"` // Email address, E.164 number or push device token
+	Template      string                 `json:"template"`
+	Locale        string                 `json:"locale,omitempty"`
+	Data          map[string]interface{} `json:"data,omitempty"`
+	CorrelationID string                 `json:"correlation_id,omitempty"`
+	CreatedAt     time.Time              `json:"created_at"`
+}
+
+// Validate normalizes the recipient for the channel and checks the message,
+// returning a validation APIError listing every invalid field
+func (m *NotificationMessage) Validate() error {
+	err := NewValidationError()
+
+	m.Recipient = strings.TrimSpace(m.Recipient)
+	switch m.Channel {
+	case ChannelEmail:
+		if email, parseErr := ParseEmail(m.Recipient); parseErr != nil {
+			err.WithField("recipient", "email", "Recipient must be a valid email address")
+		} else {
+			m.Recipient = email.String()
+		}
+	case ChannelSMS:
+		if phone, parseErr := ParsePhoneNumber(m.Recipient); parseErr != nil {
+			err.WithField("recipient", "e164", "Recipient must be a phone number in international format")
+		} else {
+			m.Recipient = phone.String()
+		}
+	case ChannelPush:
+		if m.Recipient == "" {
+			err.WithField("recipient", "required", "Recipient is required")
+		}
+	default:
+		err.WithField("channel", "oneof", "Channel must be one of email, sms, push")
+	}
+
+	if strings.TrimSpace(m.Template) == "" {
+		err.WithField("template", "required", "Template is required")
+	}
+
+	if len(err.Fields) > 0 {
+		return err
+	}
+	return nil
+}
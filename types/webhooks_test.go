@@ -0,0 +1,109 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookSignatureRoundTrip(t *testing.T) {
+	envelope, _ := NewEnvelope(&CodeValidated{ValidatorID: "validator-1", Status: StatusValid}, "org-1")
+	event := NewWebhookEvent(envelope)
+	if event.ID != envelope.ID || event.Type != EventCodeValidated {
+		t.Errorf("Expected webhook event to keep the envelope ID and type, got %+v", event)
+	}
+
+	body, _ := json.Marshal(event)
+	now := time.Unix(1700000000, 0)
+	oldSecret, newSecret := []byte("whsec_old"), []byte("whsec_new")
+
+	header := NewWebhookSignature([][]byte{oldSecret, newSecret}, event.ID, now, body).String()
+	if !strings.HasPrefix(header, "t=1700000000,v1=") || strings.Count(header, "v1=") != 2 {
+		t.Errorf("Unexpected signature header %q", header)
+	}
+
+	// A receiver that only knows one of the secrets still verifies
+	if err := VerifyWebhook([][]byte{newSecret}, event.ID, header, body, now.Add(time.Minute), DefaultWebhookTolerance); err != nil {
+		t.Errorf("Expected signature to verify, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		id     string
+		body   []byte
+		now    time.Time
+		secret []byte
+		err    error
+	}{
+		{"tampered body", event.ID, append(body, ' '), now, newSecret, ErrInvalidWebhookSignature},
+		{"different ID", "other-id", body, now, newSecret, ErrInvalidWebhookSignature},
+		{"wrong secret", event.ID, body, now, []byte("whsec_other"), ErrInvalidWebhookSignature},
+		{"stale", event.ID, body, now.Add(10 * time.Minute), newSecret, ErrWebhookTimestampExpired},
+	}
+	for _, tt := range tests {
+		err := VerifyWebhook([][]byte{tt.secret}, tt.id, header, tt.body, tt.now, DefaultWebhookTolerance)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestParseWebhookSignature(t *testing.T) {
+	signature, err := ParseWebhookSignature("t=1700000000, v2=future, v1=abc")
+	if err != nil {
+		t.Fatalf("Failed to parse signature: %v", err)
+	}
+	if signature.Timestamp.Unix() != 1700000000 || len(signature.Signatures) != 1 || signature.Signatures[0] != "abc" {
+		t.Errorf("Unexpected signature %+v", signature)
+	}
+
+	for _, header := range []string{"", "v1=abc", "t=1700000000", "t=soon,v1=abc"} {
+		if _, err := ParseWebhookSignature(header); !errors.Is(err, ErrInvalidWebhookSignature) {
+			t.Errorf("Expected %q to be rejected, got %v", header, err)
+		}
+	}
+}
+
+func TestDeliveryAttempt(t *testing.T) {
+	attempt := &DeliveryAttempt{Attempt: 1}
+	attempt.SetResponse(200, []byte(strings.Repeat("x", 5000)))
+	if !attempt.Succeeded() || attempt.Retryable() || len(attempt.ResponseBody) != MaxDeliveryResponseBody {
+		t.Errorf("Unexpected successful attempt %+v", attempt)
+	}
+
+	retryable := map[int]bool{0: true, 400: false, 404: false, 408: true, 429: true, 500: true, 503: true}
+	for status, expected := range retryable {
+		attempt := &DeliveryAttempt{ResponseStatus: status}
+		if status == 0 {
+			attempt.Error = "connection refused"
+		}
+		if got := attempt.Retryable(); got != expected {
+			t.Errorf("Status %d: expected retryable %v, got %v", status, expected, got)
+		}
+	}
+}
+
+func TestNotificationMessageValidate(t *testing.T) {
+	msg := &NotificationMessage{Channel: ChannelEmail, Recipient: " Guard@Example.com ", Template: "invite"}
+	if err := msg.Validate(); err != nil || msg.Recipient != "guard@example.com" {
+		t.Errorf("Expected email recipient to be normalized, got %q, %v", msg.Recipient, err)
+	}
+
+	msg = &NotificationMessage{Channel: ChannelSMS, Recipient: "+1 415 555 0123", Template: "code"}
+	if err := msg.Validate(); err != nil || msg.Recipient != "+14155550123" {
+		t.Errorf("Expected SMS recipient in E.164 form, got %q, %v", msg.Recipient, err)
+	}
+
+	var apiErr *APIError
+	msg = &NotificationMessage{Channel: "fax", Recipient: "123"}
+	if !errors.As(msg.Validate(), &apiErr) || len(apiErr.Fields) != 2 {
+		t.Errorf("Expected channel and template errors, got %v", apiErr)
+	}
+
+	msg = &NotificationMessage{Channel: ChannelSMS, Recipient: "555-0123", Template: "code"}
+	if msg.Validate() == nil {
+		t.Errorf("Expected national number to be rejected for SMS")
+	}
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+const (
+	// apiKeyRandomLength is the number of base62 characters of randomness (~178 bits)
+	apiKeyRandomLength = 30
+
+	// apiKeyChecksumLength is the number of base62 characters holding the CRC32
+	apiKeyChecksumLength = 6
+
+	apiKeyAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// Common API key prefixes
+const (
+	APIKeyPrefixLive    = "jk_live"
+	APIKeyPrefixTest    = "jk_test"
+	APIKeyPrefixWebhook = "jk_whsec"
+)
+
+// ErrInvalidAPIKey is returned when a key is malformed or its checksum doesn't match
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+var apiKeyPrefixPattern = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+
+// APIKey is a parsed API key
+type APIKey struct {
+	Prefix string // e.g. "jk_live"
+	Secret string // Random part followed by the checksum
+}
+
+// String returns the full key
+func (k *APIKey) String() string {
+	return k.Prefix + "_" + k.Secret
+}
+
+// Hash returns the value to store for the key, see HashAPIKey
+func (k *APIKey) Hash() string {
+	return HashAPIKey(k.String())
+}
+
+// GenerateAPIKey generates a key such as jk_live_<30 random chars><6 char
+// checksum>. The CRC32 checksum lets ParseAPIKey reject typos and random
+// strings without a database lookup, and the prefix makes leaked keys easy
+// for secret scanners to find.
+func GenerateAPIKey(prefix string) (string, error) {
+	if !apiKeyPrefixPattern.MatchString(prefix) {
+		return "", fmt.Errorf("invalid API key prefix %q", prefix)
+	}
+
+	random := make([]byte, apiKeyRandomLength)
+	max := big.NewInt(int64(len(apiKeyAlphabet)))
+	for i := range random {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		random[i] = apiKeyAlphabet[n.Int64()]
+	}
+
+	body := prefix + "_" + string(random)
+	return body + apiKeyChecksum(body), nil
+}
+
+// ParseAPIKey splits a key into prefix and secret and verifies its checksum.
+// A valid result only means the key is well formed; it must still be looked
+// up by its hash.
+func ParseAPIKey(key string) (*APIKey, error) {
+	separator := strings.LastIndexByte(key, '_')
+	if separator <= 0 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	prefix, secret := key[:separator], key[separator+1:]
+	if !apiKeyPrefixPattern.MatchString(prefix) || len(secret) != apiKeyRandomLength+apiKeyChecksumLength {
+		return nil, ErrInvalidAPIKey
+	}
+	for i := 0; i < len(secret); i++ {
+		if strings.IndexByte(apiKeyAlphabet, secret[i]) < 0 {
+			return nil, ErrInvalidAPIKey
+		}
+	}
+
+	body := key[:len(key)-apiKeyChecksumLength]
+	if apiKeyChecksum(body) != key[len(key)-apiKeyChecksumLength:] {
+		return nil, ErrInvalidAPIKey
+	}
+
+	return &APIKey{Prefix: prefix, Secret: secret}, nil
+}
+
+// HashAPIKey returns the SHA-256 hex digest to store instead of the key.
+// API keys are high-entropy, so a fast hash is sufficient.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyChecksum returns the CRC32 of the key body as fixed-width base62
+func apiKeyChecksum(body string) string {
+	n := crc32.ChecksumIEEE([]byte(body))
+
+	checksum := make([]byte, apiKeyChecksumLength)
+	for i := len(checksum) - 1; i >= 0; i-- {
+		checksum[i] = apiKeyAlphabet[n%62]
+		n /= 62
+	}
+	return string(checksum)
+}
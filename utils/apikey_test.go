@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, err := GenerateAPIKey(APIKeyPrefixLive)
+	require.NoError(t, err)
+	assert.Regexp(t, `^jk_live_[0-9A-Za-z]{36}$`, key)
+
+	parsed, err := ParseAPIKey(key)
+	require.NoError(t, err)
+	assert.Equal(t, APIKeyPrefixLive, parsed.Prefix)
+	assert.Equal(t, key, parsed.String())
+	assert.Equal(t, HashAPIKey(key), parsed.Hash())
+	assert.Len(t, parsed.Hash(), 64)
+
+	other, err := GenerateAPIKey(APIKeyPrefixLive)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+
+	for _, prefix := range []string{"", "JK_live", "jk-live", "jk_", "_jk", "1jk"} {
+		_, err := GenerateAPIKey(prefix)
+		assert.Error(t, err, prefix)
+	}
+}
+
+func TestParseAPIKeyRejectsInvalid(t *testing.T) {
+	key, err := GenerateAPIKey(APIKeyPrefixWebhook)
+	require.NoError(t, err)
+
+	// Flip one character of the random part
+	body := []byte(key)
+	i := len(APIKeyPrefixWebhook) + 1
+	if body[i] == 'a' {
+		body[i] = 'b'
+	} else {
+		body[i] = 'a'
+	}
+
+	for _, invalid := range []string{
+		"",
+		"jk_live",
+		"jk_live_",
+		string(body),
+		strings.Replace(key, APIKeyPrefixWebhook, APIKeyPrefixLive, 1),
+		key[:len(key)-1],
+		key + "0",
+		key[:len(key)-1] + "!",
+		"jk_live_" + strings.Repeat("a", 36),
+	} {
+		_, err := ParseAPIKey(invalid)
+		assert.ErrorIs(t, err, ErrInvalidAPIKey, invalid)
+	}
+}
+
+func TestAPIKeyChecksumFixedWidth(t *testing.T) {
+	for _, body := range []string{"", "jk_live_x", strings.Repeat("z", 100)} {
+		assert.Len(t, apiKeyChecksum(body), apiKeyChecksumLength)
+	}
+}
@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Access code charsets
+const (
+	// CodeCharsetNumeric produces codes that are easy to type on a keypad
+	CodeCharsetNumeric = "0123456789"
+
+	// CodeCharsetAlphanumeric omits characters that are easily confused (0/O, 1/I/L)
+	CodeCharsetAlphanumeric = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+)
+
+// ErrCodeCollision is returned when GenerateUniqueCode exhausts its attempts
+var ErrCodeCollision = errors.New("could not generate a unique code")
+
+// CodeConfig holds the parameters for generated access codes
+type CodeConfig struct {
+	Length      int    `json:"length"`
+	Charset     string `json:"charset"`
+	MaxAttempts int    `json:"max_attempts"` // Attempts GenerateUniqueCode makes before giving up
+
+	// AllowLeadingZero lets codes start with "0". Off by default so numeric
+	// codes stay in 100000-999999 for callers that store or validate them as
+	// integers; turning it on grows the code space by a tenth.
+	AllowLeadingZero bool `json:"allow_leading_zero"`
+}
+
+// DefaultCodeConfig returns the default access code parameters (6 digits,
+// 100000-999999)
+func DefaultCodeConfig() *CodeConfig {
+	return &CodeConfig{
+		Length:      6,
+		Charset:     CodeCharsetNumeric,
+		MaxAttempts: 10,
+	}
+}
+
+// Validate checks the code parameters
+func (c *CodeConfig) Validate() error {
+	if c.Length <= 0 {
+		return fmt.Errorf("code length must be positive, got %d", c.Length)
+	}
+
+	seen := make(map[rune]bool)
+	for _, r := range c.Charset {
+		if seen[r] {
+			return fmt.Errorf("code charset contains %q more than once", r)
+		}
+		seen[r] = true
+	}
+	if len(seen) < 2 {
+		return errors.New("code charset must contain at least two characters")
+	}
+	return nil
+}
+
+// SetCodeConfig sets the parameters for generated access codes
+func (c *CryptoManager) SetCodeConfig(config *CodeConfig) error {
+	if config == nil {
+		config = DefaultCodeConfig()
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.codeConfig = config
+	return nil
+}
+
+// CodeConfig returns the parameters for generated access codes
+func (c *CryptoManager) CodeConfig() *CodeConfig {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.codeConfig == nil {
+		return DefaultCodeConfig()
+	}
+	return c.codeConfig
+}
+
+// GenerateCode generates a code with the given parameters, independent of
+// the manager's configuration
+func (c *CryptoManager) GenerateCode(config *CodeConfig) (string, error) {
+	if err := config.Validate(); err != nil {
+		return "", err
+	}
+	return generateCode(config)
+}
+
+// GenerateUniqueCode generates access codes until exists reports one as
+// unused, making at most CodeConfig.MaxAttempts attempts
+func (c *CryptoManager) GenerateUniqueCode(ctx context.Context, exists func(ctx context.Context, code string) (bool, error)) (string, error) {
+	config := c.CodeConfig()
+
+	attempts := config.MaxAttempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	for i := 0; i < attempts; i++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		code, err := generateCode(config)
+		if err != nil {
+			return "", err
+		}
+
+		taken, err := exists(ctx, code)
+		if err != nil {
+			return "", fmt.Errorf("failed to check code uniqueness: %w", err)
+		}
+		if !taken {
+			return code, nil
+		}
+	}
+	return "", fmt.Errorf("%w after %d attempts", ErrCodeCollision, attempts)
+}
+
+// generateCode draws each character uniformly from the charset, the first
+// from the charset without "0" unless leading zeros are allowed
+func generateCode(config *CodeConfig) (string, error) {
+	charset := []rune(config.Charset)
+	first := charset
+	if !config.AllowLeadingZero {
+		first = []rune(strings.ReplaceAll(config.Charset, "0", ""))
+	}
+
+	code := make([]rune, config.Length)
+	for i := range code {
+		chars := charset
+		if i == 0 {
+			chars = first
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = chars[n.Int64()]
+	}
+	return string(code), nil
+}
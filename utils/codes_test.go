@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateSecureCodeConfigurable(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+
+	code, err := crypto.GenerateSecureCode()
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9]{6}$`, code)
+
+	require.NoError(t, crypto.SetCodeConfig(&CodeConfig{Length: 8, Charset: CodeCharsetAlphanumeric, MaxAttempts: 5}))
+	for i := 0; i < 50; i++ {
+		code, err := crypto.GenerateSecureCode()
+		require.NoError(t, err)
+		assert.Len(t, code, 8)
+		assert.False(t, strings.ContainsAny(code, "01OIL"), "ambiguous character in %s", code)
+	}
+}
+
+func TestGenerateSecureCodeLeadingZero(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+
+	// Default codes keep the 100000-999999 range
+	for i := 0; i < 200; i++ {
+		code, err := crypto.GenerateSecureCode()
+		require.NoError(t, err)
+		assert.Regexp(t, `^[1-9][0-9]{5}$`, code)
+	}
+
+	config := DefaultCodeConfig()
+	config.Length = 1
+	config.AllowLeadingZero = true
+	seen := map[string]bool{}
+	for i := 0; i < 500 && !seen["0"]; i++ {
+		code, err := crypto.GenerateCode(config)
+		require.NoError(t, err)
+		seen[code] = true
+	}
+	assert.True(t, seen["0"], "expected leading zeros once allowed")
+}
+
+func TestCodeConfigValidation(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+
+	assert.Error(t, crypto.SetCodeConfig(&CodeConfig{Length: 0, Charset: CodeCharsetNumeric}))
+	assert.Error(t, crypto.SetCodeConfig(&CodeConfig{Length: 6, Charset: "A"}))
+	assert.Error(t, crypto.SetCodeConfig(&CodeConfig{Length: 6, Charset: "ABCA"}))
+
+	// A rejected configuration leaves the previous one in place
+	assert.Equal(t, 6, crypto.CodeConfig().Length)
+
+	_, err := crypto.GenerateCode(&CodeConfig{Length: 4, Charset: "x"})
+	assert.Error(t, err)
+
+	code, err := crypto.GenerateCode(&CodeConfig{Length: 4, Charset: "AB"})
+	require.NoError(t, err)
+	assert.Regexp(t, `^[AB]{4}$`, code)
+}
+
+func TestSetCodeConfigConcurrently(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, crypto.SetCodeConfig(&CodeConfig{Length: 8, Charset: CodeCharsetAlphanumeric}))
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		_, err := crypto.GenerateSecureCode()
+		assert.NoError(t, err)
+	}
+	<-done
+}
+
+func TestGenerateUniqueCode(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	ctx := context.Background()
+
+	calls := 0
+	code, err := crypto.GenerateUniqueCode(ctx, func(ctx context.Context, code string) (bool, error) {
+		calls++
+		return calls < 3, nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, code, 6)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	_, err = crypto.GenerateUniqueCode(ctx, func(ctx context.Context, code string) (bool, error) {
+		calls++
+		return true, nil
+	})
+	assert.ErrorIs(t, err, ErrCodeCollision)
+	assert.Equal(t, DefaultCodeConfig().MaxAttempts, calls)
+
+	lookupErr := errors.New("database unavailable")
+	_, err = crypto.GenerateUniqueCode(ctx, func(ctx context.Context, code string) (bool, error) {
+		return false, lookupErr
+	})
+	assert.ErrorIs(t, err, lookupErr)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = crypto.GenerateUniqueCode(cancelled, func(ctx context.Context, code string) (bool, error) {
+		return false, nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -1,85 +1,177 @@
 package utils
 
 import (
+	"crypto/ed25519"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"math/big"
+	"sync"
 	"time"
 
+	"github.com/jarakey/jarakey-shared-middleware/clock"
 	"github.com/jarakey/jarakey-shared-middleware/types"
 )
 
 // CryptoManager handles cryptographic operations
 type CryptoManager struct {
-	secretKey string
+	secretKey      string
+	passwordConfig *PasswordHashConfig
+	encryptionKey  []byte
+	totpConfig     *TOTPConfig
+	codeConfig     *CodeConfig
+	keyProvider    KeyProvider
+	replayCache    ReplayCache
+	qrEd25519Key   *ed25519SigningKey
+	qrPublicKeys   map[string]ed25519.PublicKey
+	qrJWKS         *JWKSClient
+	signingKeys    []signingKey
+	clock          clock.Clock
+	mutex          sync.RWMutex
 }
 
 // NewCryptoManager creates a new crypto manager
 func NewCryptoManager(secretKey string) *CryptoManager {
 	return &CryptoManager{
-		secretKey: secretKey,
+		secretKey:      secretKey,
+		passwordConfig: DefaultPasswordHashConfig(),
+		totpConfig:     DefaultTOTPConfig(),
+		codeConfig:     DefaultCodeConfig(),
+		signingKeys:    []signingKey{{secret: []byte(secretKey)}},
 	}
 }
 
-// GenerateSecureCode generates a secure 6-digit code
+// SetClock sets the clock QR code and TOTP expiry are checked against
+func (c *CryptoManager) SetClock(clk clock.Clock) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.clock = clk
+}
+
+// now returns the current time on the manager's clock
+func (c *CryptoManager) now() time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return clock.OrReal(c.clock).Now()
+}
+
+// GenerateSecureCode generates a secure access code using the configured
+// length and charset (6 digits by default)
 func (c *CryptoManager) GenerateSecureCode() (string, error) {
-	// Generate a random number between 100000 and 999999
-	max := big.NewInt(900000)
-	n, err := rand.Int(rand.Reader, max)
-	if err != nil {
-		return "", err
-	}
-	
-	// Add 100000 to ensure it's 6 digits
-	code := n.Add(n, big.NewInt(100000))
-	return code.String(), nil
+	return generateCode(c.CodeConfig())
 }
 
-// GenerateSignature creates a HMAC signature for QR code data
+// GenerateSignature creates a HMAC signature with the current signing key
 func (c *CryptoManager) GenerateSignature(data string) string {
-	h := hmac.New(sha256.New, []byte(c.secretKey))
-	h.Write([]byte(data))
-	return hex.EncodeToString(h.Sum(nil))
+	return hmacSignature(c.currentSigningKey().secret, data)
 }
 
-// VerifySignature verifies a HMAC signature
+// VerifySignature verifies a HMAC signature against every configured signing key
 func (c *CryptoManager) VerifySignature(data, signature string) bool {
-	expectedSignature := c.GenerateSignature(data)
-	return hmac.Equal([]byte(signature), []byte(expectedSignature))
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	valid := 0
+	for _, key := range c.signingKeys {
+		valid |= subtle.ConstantTimeCompare([]byte(signature), []byte(hmacSignature(key.secret, data)))
+	}
+	return valid == 1
 }
 
-// CreateQRCodeData creates data for QR code generation
+// CreateQRCodeData creates data for QR code generation, signed with the
+// current signing key whose ID is recorded in the data. Each QR code gets a
+// random nonce so validators can reject replays with ValidateQRCodeDataOnce.
 func (c *CryptoManager) CreateQRCodeData(code *types.AccessCode, orgID string) (*types.QRCodeData, error) {
-	// Create data string for signing
-	dataString := fmt.Sprintf("%s:%s:%s:%d", code.Code, code.Purpose, orgID, code.ExpiresAt.Unix())
-	
-	// Generate signature
-	signature := c.GenerateSignature(dataString)
-	
-	return &types.QRCodeData{
-		Code:      code.Code,
-		Signature: signature,
-		ExpiresAt: code.ExpiresAt,
-		Purpose:   code.Purpose,
-		OrgID:     orgID,
-	}, nil
+	return c.CreateBoundQRCodeData(code, orgID, "")
+}
+
+// CreateBoundQRCodeData creates QR code data that only the given validator
+// device accepts. The binding is covered by the signature.
+func (c *CryptoManager) CreateBoundQRCodeData(code *types.AccessCode, orgID, validatorID string) (*types.QRCodeData, error) {
+	nonce := make([]byte, qrNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate QR nonce: %w", err)
+	}
+
+	qrData := &types.QRCodeData{
+		Code:        code.Code,
+		ExpiresAt:   code.ExpiresAt,
+		Purpose:     code.Purpose,
+		OrgID:       orgID,
+		Nonce:       base64.RawURLEncoding.EncodeToString(nonce),
+		ValidatorID: validatorID,
+	}
+
+	if edKey := c.qrSigningKeyEd25519(); edKey != nil {
+		qrData.KeyID = edKey.id
+		qrData.Signature = hex.EncodeToString(ed25519.Sign(edKey.key, []byte(qrSigningData(qrData))))
+		return qrData, nil
+	}
+
+	key := c.currentSigningKey()
+	qrData.KeyID = key.id
+	qrData.Signature = hmacSignature(key.secret, qrSigningData(qrData))
+	return qrData, nil
 }
 
-// ValidateQRCodeData validates QR code data offline
+// ValidateQRCodeData validates QR code data offline against the signing key it
+// names, either an HMAC key or an Ed25519 public key
 func (c *CryptoManager) ValidateQRCodeData(qrData *types.QRCodeData) bool {
-	// Check if code is expired
-	if time.Now().After(qrData.ExpiresAt) {
-		return false
+	unexpired, signed := c.checkQRCodeData(qrData, c.now())
+	return unexpired&signed == 1
+}
+
+// checkQRCodeData evaluates expiry and signature without returning early, so
+// expired codes, unknown keys and bad signatures all take the same time. Each
+// result is 1 when the check passed and 0 otherwise. A zero ExpiresAt never
+// expires, as for AccessCode.IsExpired.
+func (c *CryptoManager) checkQRCodeData(qrData *types.QRCodeData, now time.Time) (unexpired, signed int) {
+	if qrData.ExpiresAt.IsZero() || !now.After(qrData.ExpiresAt) {
+		unexpired = 1
 	}
-	
-	// Create data string for verification
-	dataString := fmt.Sprintf("%s:%s:%s:%d", qrData.Code, qrData.Purpose, qrData.OrgID, qrData.ExpiresAt.Unix())
-	
-	// Verify signature
-	return c.VerifySignature(dataString, qrData.Signature)
+
+	// An unknown key ID is still checked against the current key so the
+	// lookup result doesn't show in the timing
+	key, found := c.findSigningKey(qrData.KeyID)
+	if !found {
+		if publicKey, ok := c.findQRPublicKey(qrData.KeyID); ok {
+			return unexpired, verifyQRSignatureEd25519(publicKey, qrSigningData(qrData), qrData.Signature)
+		}
+		key = c.currentSigningKey()
+	}
+
+	expected := hmacSignature(key.secret, qrSigningData(qrData))
+	signed = subtle.ConstantTimeCompare([]byte(qrData.Signature), []byte(expected))
+	if !found {
+		signed = 0
+	}
+	return unexpired, signed
+}
+
+// qrSigningData returns the string a QR code signature covers. Data signed
+// with a versioned key also covers the key ID, and data with a nonce or
+// validator binding covers those too; data without them keeps the original
+// format so codes signed before these fields existed remain valid.
+func qrSigningData(qrData *types.QRCodeData) string {
+	data := fmt.Sprintf("%s:%s:%s:%d", qrData.Code, qrData.Purpose, qrData.OrgID, qrData.ExpiresAt.Unix())
+	if qrData.KeyID != "" {
+		data = qrData.KeyID + ":" + data
+	}
+	if qrData.Nonce != "" || qrData.ValidatorID != "" {
+		data += ":" + qrData.Nonce + ":" + qrData.ValidatorID
+	}
+	return data
+}
+
+// hmacSignature returns the hex encoded HMAC-SHA256 of data
+func hmacSignature(secret []byte, data string) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
 }
 
 // GenerateRandomString generates a random string of specified length
@@ -100,16 +192,3 @@ func (c *CryptoManager) GenerateRandomString(length int) (string, error) {
 	}
 	return string(b), nil
 }
-
-// HashPassword creates a secure hash of a password
-func (c *CryptoManager) HashPassword(password string) string {
-	h := sha256.New()
-	h.Write([]byte(password + c.secretKey))
-	return hex.EncodeToString(h.Sum(nil))
-}
-
-// VerifyPasswordHash verifies a password against its hash
-func (c *CryptoManager) VerifyPasswordHash(password, hash string) bool {
-	expectedHash := c.HashPassword(password)
-	return hash == expectedHash
-} 
\ No newline at end of file
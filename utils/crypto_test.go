@@ -1,9 +1,12 @@
 package utils
 
 import (
+	"context"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/jarakey/jarakey-shared-middleware/clock"
 	"github.com/jarakey/jarakey-shared-middleware/types"
 	"github.com/stretchr/testify/assert"
 )
@@ -85,8 +88,7 @@ func TestCreateQRCodeData(t *testing.T) {
 		Purpose:   "entry",
 		ExpiresAt: time.Now().Add(1 * time.Hour),
 		IsUsed:    false,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		AuditFields: types.AuditFields{CreatedAt: time.Now(), UpdatedAt: time.Now()},
 	}
 	
 	orgID := "org-456"
@@ -113,8 +115,7 @@ func TestValidateQRCodeData(t *testing.T) {
 		Purpose:   "entry",
 		ExpiresAt: time.Now().Add(1 * time.Hour),
 		IsUsed:    false,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		AuditFields: types.AuditFields{CreatedAt: time.Now(), UpdatedAt: time.Now()},
 	}
 	
 	orgID := "org-456"
@@ -133,6 +134,79 @@ func TestValidateQRCodeData(t *testing.T) {
 	assert.False(t, crypto.ValidateQRCodeData(qrData))
 }
 
+func TestValidateQRCodeDataClock(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	fake := clock.NewFake(time.Now())
+	crypto.SetClock(fake)
+
+	qrData, err := crypto.CreateQRCodeData(testAccessCode(), "org-456")
+	assert.NoError(t, err)
+	assert.True(t, crypto.ValidateQRCodeData(qrData))
+
+	// The code expires an hour after it was created
+	fake.Advance(time.Hour + time.Second)
+	assert.False(t, crypto.ValidateQRCodeData(qrData))
+}
+
+func TestValidateQRCodeDataWithoutExpiry(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	fake := clock.NewFake(time.Now())
+	crypto.SetClock(fake)
+	cache := NewMemoryReplayCache()
+	cache.SetClock(fake)
+	crypto.SetReplayCache(cache)
+
+	// Unlimited codes have no expiry time and never expire, on either path
+	code := testAccessCode()
+	code.ExpiresAt = time.Time{}
+	qrData, err := crypto.CreateQRCodeData(code, "org-456")
+	assert.NoError(t, err)
+
+	fake.Advance(10 * 365 * 24 * time.Hour)
+	assert.False(t, code.IsExpired(fake))
+	assert.True(t, crypto.ValidateQRCodeData(qrData))
+
+	payload, err := EncodeQRPayload(qrData)
+	assert.NoError(t, err)
+	decoded, err := DecodeQRPayload(payload)
+	assert.NoError(t, err)
+	assert.True(t, crypto.ValidateQRCodeData(decoded))
+
+	// Their nonces are remembered for good
+	assert.NoError(t, crypto.ValidateQRCodeDataOnce(context.Background(), decoded, "gate-1"))
+	fake.Advance(time.Hour)
+	assert.ErrorIs(t, crypto.ValidateQRCodeDataOnce(context.Background(), decoded, "gate-1"), ErrQRCodeReplayed)
+}
+
+func TestValidateQRCodeDataNoEarlyReturn(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+
+	qrData, err := crypto.CreateQRCodeData(testAccessCode(), "org-456")
+	assert.NoError(t, err)
+
+	// The signature is still checked once the code has expired
+	later := qrData.ExpiresAt.Add(time.Minute)
+	unexpired, signed := crypto.checkQRCodeData(qrData, later)
+	assert.Equal(t, 0, unexpired)
+	assert.Equal(t, 1, signed)
+
+	// and expiry is still checked when the signature is bad
+	tampered := *qrData
+	tampered.OrgID = "org-999"
+	unexpired, signed = crypto.checkQRCodeData(&tampered, time.Now())
+	assert.Equal(t, 1, unexpired)
+	assert.Equal(t, 0, signed)
+
+	// An unknown key ID never validates, even with a signature from the current key
+	unknown := *qrData
+	unknown.KeyID = "missing"
+	unknown.Signature = hmacSignature(crypto.currentSigningKey().secret, qrSigningData(&unknown))
+	unexpired, signed = crypto.checkQRCodeData(&unknown, time.Now())
+	assert.Equal(t, 1, unexpired)
+	assert.Equal(t, 0, signed)
+	assert.False(t, crypto.ValidateQRCodeData(&unknown))
+}
+
 func TestGenerateRandomString(t *testing.T) {
 	secretKey := "test-secret-key-32-chars-long"
 	crypto := NewCryptoManager(secretKey)
@@ -171,11 +245,12 @@ func TestHashPassword(t *testing.T) {
 	crypto := NewCryptoManager(secretKey)
 	
 	password := "my-secure-password"
-	hash := crypto.HashPassword(password)
+	hash, err := crypto.HashPassword(password)
 	
+	assert.NoError(t, err)
 	assert.NotEmpty(t, hash)
-	assert.NotEqual(t, password, hash) // Hash should be different from password
-	assert.Len(t, hash, 64) // SHA-256 hash is always 64 characters
+	assert.NotContains(t, hash, password) // Hash should not contain the password
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=2$")) // Parameters are encoded in the hash
 }
 
 func TestVerifyPasswordHash(t *testing.T) {
@@ -183,7 +258,8 @@ func TestVerifyPasswordHash(t *testing.T) {
 	crypto := NewCryptoManager(secretKey)
 	
 	password := "my-secure-password"
-	hash := crypto.HashPassword(password)
+	hash, err := crypto.HashPassword(password)
+	assert.NoError(t, err)
 	
 	// Correct password should verify
 	assert.True(t, crypto.VerifyPasswordHash(password, hash))
@@ -203,13 +279,15 @@ func TestHashPasswordConsistency(t *testing.T) {
 	crypto := NewCryptoManager(secretKey)
 	
 	password := "same-password"
-	hash1 := crypto.HashPassword(password)
-	hash2 := crypto.HashPassword(password)
+	hash1, err := crypto.HashPassword(password)
+	assert.NoError(t, err)
+	hash2, err := crypto.HashPassword(password)
+	assert.NoError(t, err)
 	
-	// Same password should produce the same hash (SHA-256 is deterministic)
-	assert.Equal(t, hash1, hash2)
+	// Same password should produce different hashes (per-password salt)
+	assert.NotEqual(t, hash1, hash2)
 	
 	// Both should verify correctly
 	assert.True(t, crypto.VerifyPasswordHash(password, hash1))
 	assert.True(t, crypto.VerifyPasswordHash(password, hash2))
-} 
\ No newline at end of file
+}
@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// EncryptionKeySize is the key size for AES-256-GCM
+const EncryptionKeySize = 32
+
+// ciphertextVersion prefixes ciphertexts so the format can evolve
+const ciphertextVersion byte = 1
+
+// encryptionKeyInfo separates the derived encryption key from other uses of the secret
+const encryptionKeyInfo = "jarakey-shared-middleware/aes-256-gcm/v1"
+
+// ErrInvalidCiphertext is returned when a ciphertext is malformed or fails authentication
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// EncryptAESGCM encrypts plaintext with AES-256-GCM under key using a random
+// nonce. The additional data is authenticated but not encrypted; the same aad
+// must be passed to DecryptAESGCM. The result is version || nonce || ciphertext.
+func EncryptAESGCM(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := make([]byte, 0, 1+len(nonce)+len(plaintext)+gcm.Overhead())
+	out = append(out, ciphertextVersion)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plaintext, aad), nil
+}
+
+// DecryptAESGCM decrypts a ciphertext produced by EncryptAESGCM
+func DecryptAESGCM(key, ciphertext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < 1+gcm.NonceSize()+gcm.Overhead() || ciphertext[0] != ciphertextVersion {
+		return nil, ErrInvalidCiphertext
+	}
+
+	nonce := ciphertext[1 : 1+gcm.NonceSize()]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext[1+gcm.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return plaintext, nil
+}
+
+// newGCM creates an AES-GCM cipher for a 256-bit key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", EncryptionKeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SetEncryptionKey sets a dedicated 32-byte AES-256 key. Without it the key is
+// derived from the manager's secret with HKDF-SHA256.
+func (c *CryptoManager) SetEncryptionKey(key []byte) error {
+	if len(key) != EncryptionKeySize {
+		return fmt.Errorf("encryption key must be %d bytes, got %d", EncryptionKeySize, len(key))
+	}
+	c.encryptionKey = append([]byte(nil), key...)
+	return nil
+}
+
+// getEncryptionKey returns the configured encryption key or derives one from the secret
+func (c *CryptoManager) getEncryptionKey() ([]byte, error) {
+	if c.encryptionKey != nil {
+		return c.encryptionKey, nil
+	}
+	if c.secretKey == "" {
+		return nil, errors.New("no encryption key configured")
+	}
+
+	key := make([]byte, EncryptionKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(c.secretKey), nil, []byte(encryptionKeyInfo)), key); err != nil {
+		return nil, fmt.Errorf("failed to derive encryption key: %w", err)
+	}
+	return key, nil
+}
+
+// Encrypt encrypts plaintext with AES-256-GCM. The optional additional data,
+// e.g. a record ID, binds the ciphertext to its context.
+func (c *CryptoManager) Encrypt(plaintext, aad []byte) ([]byte, error) {
+	key, err := c.getEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	return EncryptAESGCM(key, plaintext, aad)
+}
+
+// Decrypt decrypts a ciphertext produced by Encrypt with the same additional data
+func (c *CryptoManager) Decrypt(ciphertext, aad []byte) ([]byte, error) {
+	key, err := c.getEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	return DecryptAESGCM(key, ciphertext, aad)
+}
+
+// EncryptString encrypts a string such as a phone number and returns it base64url encoded
+func (c *CryptoManager) EncryptString(plaintext string) (string, error) {
+	ciphertext, err := c.Encrypt([]byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptString decrypts a string produced by EncryptString
+func (c *CryptoManager) DecryptString(ciphertext string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+
+	plaintext, err := c.Decrypt(raw, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+
+	plaintext := []byte("+1 555 0100")
+	aad := []byte("user-123")
+
+	ciphertext, err := crypto.Encrypt(plaintext, aad)
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(ciphertext, plaintext))
+
+	decrypted, err := crypto.Decrypt(ciphertext, aad)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	// Random nonces make every ciphertext unique
+	again, err := crypto.Encrypt(plaintext, aad)
+	require.NoError(t, err)
+	assert.NotEqual(t, ciphertext, again)
+}
+
+func TestDecryptRejectsTampering(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+
+	ciphertext, err := crypto.Encrypt([]byte("+1 555 0100"), []byte("user-123"))
+	require.NoError(t, err)
+
+	// Different additional data
+	_, err = crypto.Decrypt(ciphertext, []byte("user-456"))
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	// Flipped ciphertext bit
+	tampered := append([]byte(nil), ciphertext...)
+	tampered[len(tampered)-1] ^= 0x01
+	_, err = crypto.Decrypt(tampered, []byte("user-123"))
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	// Truncated and empty input
+	_, err = crypto.Decrypt(ciphertext[:10], []byte("user-123"))
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+	_, err = crypto.Decrypt(nil, nil)
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	// Different secret
+	other := NewCryptoManager("another-secret-key-32-chars-long")
+	_, err = other.Decrypt(ciphertext, []byte("user-123"))
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+}
+
+func TestEncryptString(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+
+	encrypted, err := crypto.EncryptString("+1 555 0100")
+	require.NoError(t, err)
+	assert.NotContains(t, encrypted, "555")
+
+	decrypted, err := crypto.DecryptString(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "+1 555 0100", decrypted)
+
+	_, err = crypto.DecryptString("not base64!")
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+}
+
+func TestSetEncryptionKey(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+
+	assert.Error(t, crypto.SetEncryptionKey([]byte("too-short")))
+
+	key := bytes.Repeat([]byte{0x42}, EncryptionKeySize)
+	require.NoError(t, crypto.SetEncryptionKey(key))
+
+	ciphertext, err := crypto.Encrypt([]byte("secret"), nil)
+	require.NoError(t, err)
+
+	// The dedicated key is used instead of the derived one
+	plaintext, err := DecryptAESGCM(key, ciphertext, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secret"), plaintext)
+
+	_, err = NewCryptoManager("test-secret-key-32-chars-long").Decrypt(ciphertext, nil)
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+}
+
+func TestEncryptWithoutKey(t *testing.T) {
+	_, err := NewCryptoManager("").Encrypt([]byte("secret"), nil)
+	assert.Error(t, err)
+
+	_, err = EncryptAESGCM([]byte("short"), []byte("secret"), nil)
+	assert.Error(t, err)
+}
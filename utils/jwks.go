@@ -0,0 +1,311 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// JWK represents a single public JSON Web Key (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet represents a JSON Web Key Set
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK builds a signature JWK for a public key
+func NewJWK(publicKey crypto.PublicKey, alg, kid string) (JWK, error) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwk := JWK{Use: "sig", Kid: kid, Alg: alg}
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64(key.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return JWK{}, errors.New("only P-256 EC keys are supported")
+		}
+		jwk.Kty = "EC"
+		jwk.Crv = "P-256"
+		jwk.X = b64(key.X.FillBytes(make([]byte, 32)))
+		jwk.Y = b64(key.Y.FillBytes(make([]byte, 32)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64(key)
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+
+	return jwk, nil
+}
+
+// PublicKey decodes the JWK into a Go public key
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported EC curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate: %w", err)
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate: %w", err)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("EC point is not on curve")
+		}
+		return key, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// JWKThumbprint computes the RFC 7638 SHA-256 thumbprint of a public key,
+// used as the default key ID
+func JWKThumbprint(publicKey crypto.PublicKey) (string, error) {
+	jwk, err := NewJWK(publicKey, "", "")
+	if err != nil {
+		return "", err
+	}
+
+	// Members must be in lexicographic order with no whitespace
+	var canonical string
+	switch jwk.Kty {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, jwk.Crv, jwk.X, jwk.Y)
+	default:
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, jwk.Crv, jwk.X)
+	}
+
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// JWKS returns the public key set for the manager, including keys kept only
+// for verification during rotation. Symmetric keys are never published.
+func (j *JWTManager) JWKS() (*JWKSet, error) {
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+
+	set := &JWKSet{Keys: []JWK{}}
+	for _, key := range j.keys {
+		if key.method.Alg() == AlgorithmHS256 {
+			continue
+		}
+		jwk, err := NewJWK(key.verifyKey, key.method.Alg(), key.id)
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	if len(set.Keys) == 0 {
+		return nil, errors.New("jwt manager has no public keys to publish")
+	}
+	return set, nil
+}
+
+// JWKSHandler returns an HTTP handler serving the manager's public keys,
+// typically mounted at /.well-known/jwks.json
+func (j *JWTManager) JWKSHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		set, err := j.JWKS()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(set)
+	}
+}
+
+// JWKSClientConfig holds the configuration for a remote JWKS client
+type JWKSClientConfig struct {
+	RefreshInterval    time.Duration `json:"refresh_interval"`
+	MinRefreshInterval time.Duration `json:"min_refresh_interval"`
+	Timeout            time.Duration `json:"timeout"`
+}
+
+// DefaultJWKSClientConfig returns a default remote JWKS configuration
+func DefaultJWKSClientConfig() *JWKSClientConfig {
+	return &JWKSClientConfig{
+		RefreshInterval:    15 * time.Minute,
+		MinRefreshInterval: 30 * time.Second,
+		Timeout:            10 * time.Second,
+	}
+}
+
+// JWKSClient fetches and caches a remote JWKS. Keys are refreshed periodically
+// and on demand when a token references an unknown key ID, so issuer key
+// rotation is picked up without a restart.
+type JWKSClient struct {
+	url         string
+	config      *JWKSClientConfig
+	httpClient  *http.Client
+	keys        map[string]JWK
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	mutex       sync.RWMutex
+}
+
+// NewJWKSClient creates a client for the JWKS published at url
+func NewJWKSClient(url string, config *JWKSClientConfig) *JWKSClient {
+	if config == nil {
+		config = DefaultJWKSClientConfig()
+	}
+
+	return &JWKSClient{
+		url:        url,
+		config:     config,
+		httpClient: &http.Client{Timeout: config.Timeout},
+		keys:       make(map[string]JWK),
+	}
+}
+
+// Refresh fetches the remote key set and replaces the cached keys
+func (c *JWKSClient) Refresh(ctx context.Context) error {
+	c.mutex.Lock()
+	c.lastAttempt = time.Now()
+	c.mutex.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS endpoint responded with status %d", resp.StatusCode)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]JWK, len(set.Keys))
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		keys[key.Kid] = key
+	}
+
+	c.mutex.Lock()
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	c.mutex.Unlock()
+
+	return nil
+}
+
+// Key returns the cached key with the given ID, refreshing the set when it
+// is stale or the key is unknown
+func (c *JWKSClient) Key(ctx context.Context, kid string) (JWK, error) {
+	c.mutex.RLock()
+	key, found := c.keys[kid]
+	stale := time.Since(c.fetchedAt) >= c.config.RefreshInterval
+	throttled := time.Since(c.lastAttempt) < c.config.MinRefreshInterval
+	c.mutex.RUnlock()
+
+	if (!found || stale) && !throttled {
+		if err := c.Refresh(ctx); err != nil && !found {
+			return JWK{}, err
+		}
+		c.mutex.RLock()
+		key, found = c.keys[kid]
+		c.mutex.RUnlock()
+	}
+
+	if !found {
+		return JWK{}, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// NewJWTManagerWithJWKS creates a verify-only JWT manager that resolves
+// verification keys from a remote JWKS by the token's kid header
+func NewJWTManagerWithJWKS(client *JWKSClient) *JWTManager {
+	return &JWTManager{jwks: client}
+}
+
+// jwksKey resolves the verification key for a token from the remote JWKS
+func (j *JWTManager) jwksKey(ctx context.Context, alg, kid string) (interface{}, error) {
+	jwk, err := j.jwks.Key(ctx, kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if jwk.Alg != "" && jwk.Alg != alg {
+		return nil, fmt.Errorf("key %q is not valid for algorithm %s", kid, alg)
+	}
+
+	key, err := jwk.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKeyType(alg, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKRoundTrip(t *testing.T) {
+	for _, alg := range []string{AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			key := generateTestKey(t, alg)
+
+			jwk, err := NewJWK(key.Public(), alg, "kid-1")
+			require.NoError(t, err)
+			assert.Equal(t, "sig", jwk.Use)
+			assert.Equal(t, "kid-1", jwk.Kid)
+
+			publicKey, err := jwk.PublicKey()
+			require.NoError(t, err)
+			assert.NoError(t, checkKeyType(alg, publicKey))
+
+			original, err := JWKThumbprint(key.Public())
+			require.NoError(t, err)
+			decoded, err := JWKThumbprint(publicKey)
+			require.NoError(t, err)
+			assert.Equal(t, original, decoded)
+		})
+	}
+}
+
+func TestJWKSHandler(t *testing.T) {
+	manager, err := NewJWTManagerWithKeys(AlgorithmES256, generateTestKey(t, AlgorithmES256), nil)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	manager.JWKSHandler()(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var set JWKSet
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &set))
+	require.Len(t, set.Keys, 1)
+	assert.Equal(t, manager.KeyID(), set.Keys[0].Kid)
+	assert.Equal(t, AlgorithmES256, set.Keys[0].Alg)
+}
+
+func TestJWKSHandlerSymmetric(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewJWTManager("test-secret-key-32-chars-long").JWKSHandler()(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRemoteJWKSVerification(t *testing.T) {
+	signer, err := NewJWTManagerWithKeys(AlgorithmRS256, generateTestKey(t, AlgorithmRS256), nil)
+	require.NoError(t, err)
+
+	var fetches int32
+	current := signer
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		current.JWKSHandler()(w, r)
+	}))
+	defer server.Close()
+
+	client := NewJWKSClient(server.URL, &JWKSClientConfig{
+		RefreshInterval: time.Hour,
+		Timeout:         time.Second,
+	})
+	verifier := NewJWTManagerWithJWKS(client)
+
+	token, err := signer.GenerateToken(testUser())
+	require.NoError(t, err)
+
+	claims, err := verifier.ValidateToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "user-123", claims.UserID)
+
+	// Cached keys are reused
+	_, err = verifier.ValidateToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	// A rotated key is fetched on demand
+	rotated, err := NewJWTManagerWithKeys(AlgorithmEdDSA, generateTestKey(t, AlgorithmEdDSA), nil)
+	require.NoError(t, err)
+	current = rotated
+
+	token, err = rotated.GenerateToken(testUser())
+	require.NoError(t, err)
+
+	_, err = verifier.ValidateToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+}
+
+func TestRemoteJWKSUnknownKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer server.Close()
+
+	signer, err := NewJWTManagerWithKeys(AlgorithmEdDSA, generateTestKey(t, AlgorithmEdDSA), nil)
+	require.NoError(t, err)
+	token, err := signer.GenerateToken(testUser())
+	require.NoError(t, err)
+
+	verifier := NewJWTManagerWithJWKS(NewJWKSClient(server.URL, nil))
+	_, err = verifier.ValidateToken(token)
+	assert.Error(t, err)
+	assert.False(t, verifier.CanSign())
+}
+
+func TestRemoteJWKSFetchHonoursContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	signer, err := NewJWTManagerWithKeys(AlgorithmEdDSA, generateTestKey(t, AlgorithmEdDSA), nil)
+	require.NoError(t, err)
+	token, err := signer.GenerateToken(testUser())
+	require.NoError(t, err)
+
+	// The fetch an unknown kid triggers stops at the request's deadline,
+	// not the client's much longer timeout
+	verifier := NewJWTManagerWithJWKS(NewJWKSClient(server.URL, &JWKSClientConfig{RefreshInterval: time.Hour, Timeout: time.Minute}))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = verifier.ValidateTokenWithContext(ctx, token)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -1,62 +1,192 @@
 package utils
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
 	"github.com/jarakey/jarakey-shared-middleware/types"
 )
 
+// JWTConfig holds token lifetime and registered claim settings
+type JWTConfig struct {
+	AccessTTL  time.Duration `json:"access_ttl"`
+	RefreshTTL time.Duration `json:"refresh_ttl"`
+	Issuer     string        `json:"issuer"`
+	Audience   []string      `json:"audience"`
+	Leeway     time.Duration `json:"leeway"`
+}
+
+// DefaultJWTConfig returns a default JWT configuration
+func DefaultJWTConfig() *JWTConfig {
+	return &JWTConfig{
+		AccessTTL:  24 * time.Hour,
+		RefreshTTL: 30 * 24 * time.Hour,
+	}
+}
+
 // JWTManager handles JWT token operations
 type JWTManager struct {
-	secretKey string
+	secretKey      string
+	config         *JWTConfig
+	keys           []*jwtKey
+	jwks           *JWKSClient
+	refreshStore   RefreshTokenStore
+	onRefreshReuse RefreshReuseHandler
+	revoker        TokenRevoker
+	clock          clock.Clock
+	mutex          sync.RWMutex
+}
+
+// jwtKey is a single signing/verification key identified by its kid
+type jwtKey struct {
+	id         string
+	method     jwt.SigningMethod
+	signingKey interface{}
+	verifyKey  interface{}
 }
 
 // NewJWTManager creates a new JWT manager
 func NewJWTManager(secretKey string) *JWTManager {
+	return NewJWTManagerWithConfig(secretKey, nil)
+}
+
+// NewJWTManagerWithConfig creates a new HS256 JWT manager with the given configuration
+func NewJWTManagerWithConfig(secretKey string, config *JWTConfig) *JWTManager {
+	if config == nil {
+		config = DefaultJWTConfig()
+	}
+
 	return &JWTManager{
 		secretKey: secretKey,
+		config:    config,
+		keys: []*jwtKey{{
+			method:     jwt.SigningMethodHS256,
+			signingKey: []byte(secretKey),
+			verifyKey:  []byte(secretKey),
+		}},
 	}
 }
 
-// GenerateToken generates a new JWT token for a user
-func (j *JWTManager) GenerateToken(user *types.User) (string, error) {
-	claims := types.JWTClaims{
-		UserID: user.ID,
-		Email:  user.Email,
-		Role:   user.Role,
-		OrgID:  user.OrgID,
-		Exp:    time.Now().Add(24 * time.Hour).Unix(),
-		Iat:    time.Now().Unix(),
+// SetConfig replaces the token lifetime and registered claim settings
+func (j *JWTManager) SetConfig(config *JWTConfig) {
+	if config == nil {
+		config = DefaultJWTConfig()
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(j.secretKey))
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.config = config
 }
 
-// ValidateToken validates a JWT token and returns the claims
-func (j *JWTManager) ValidateToken(tokenString string) (*types.JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &types.JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(j.secretKey), nil
-	})
+// Config returns the active JWT configuration
+func (j *JWTManager) Config() *JWTConfig {
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+	if j.config == nil {
+		return DefaultJWTConfig()
+	}
+	return j.config
+}
 
-	if err != nil {
-		return nil, err
+// SetClock sets the clock tokens are issued and validated against
+func (j *JWTManager) SetClock(c clock.Clock) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.clock = c
+}
+
+// now returns the current time on the manager's clock
+func (j *JWTManager) now() time.Time {
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+	return clock.OrReal(j.clock).Now()
+}
+
+// Algorithm returns the JWS algorithm used to sign new tokens
+func (j *JWTManager) Algorithm() string {
+	if key := j.currentKey(); key != nil {
+		return key.method.Alg()
 	}
+	return ""
+}
 
-	if claims, ok := token.Claims.(*types.JWTClaims); ok && token.Valid {
-		return claims, nil
+// KeyID returns the key ID placed in the kid header of newly issued tokens
+func (j *JWTManager) KeyID() string {
+	if key := j.currentKey(); key != nil {
+		return key.id
 	}
+	return ""
+}
 
-	return nil, errors.New("invalid token")
+// CanSign reports whether the manager holds a key that can issue tokens
+func (j *JWTManager) CanSign() bool {
+	return j.currentKey() != nil
 }
 
-// RefreshToken generates a new token with extended expiration
+// GenerateToken generates a new JWT token for a user
+func (j *JWTManager) GenerateToken(user *types.User) (string, error) {
+	token, _, err := j.issue(claimsForUser(user), types.TokenTypeAccess, j.Config().AccessTTL, j.now())
+	return token, err
+}
+
+// GenerateTokenWithClaims generates an access token for a user with custom
+// claims. A "scopes" entry ([]string or a space separated string) populates
+// JWTClaims.Scopes; other reserved claim names are rejected.
+func (j *JWTManager) GenerateTokenWithClaims(user *types.User, extra map[string]interface{}) (string, error) {
+	claims := claimsForUser(user)
+
+	for name, value := range extra {
+		if name == "scopes" {
+			scopes, err := parseScopes(value)
+			if err != nil {
+				return "", err
+			}
+			claims.Scopes = scopes
+			continue
+		}
+		if types.IsReservedClaim(name) {
+			return "", fmt.Errorf("claim %q is reserved", name)
+		}
+		if claims.Extra == nil {
+			claims.Extra = make(map[string]interface{})
+		}
+		claims.Extra[name] = value
+	}
+
+	token, _, err := j.issue(claims, types.TokenTypeAccess, j.Config().AccessTTL, j.now())
+	return token, err
+}
+
+// parseScopes accepts scopes as a string slice or a space separated string
+func parseScopes(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case []string:
+		return v, nil
+	case string:
+		return strings.Fields(v), nil
+	default:
+		return nil, fmt.Errorf("scopes must be []string or string, got %T", value)
+	}
+}
+
+// ValidateToken validates an access token and returns the claims. Refresh
+// tokens are rejected; use ValidateRefreshToken for those.
+func (j *JWTManager) ValidateToken(tokenString string) (*types.JWTClaims, error) {
+	return j.ValidateTokenWithContext(context.Background(), tokenString)
+}
+
+// RefreshToken generates a new token with extended expiration.
+//
+// Deprecated: any valid access token can be re-minted indefinitely. Issue
+// pairs with GenerateTokenPair and exchange refresh tokens with
+// RotateRefreshToken instead.
 func (j *JWTManager) RefreshToken(tokenString string) (string, error) {
 	claims, err := j.ValidateToken(tokenString)
 	if err != nil {
@@ -65,25 +195,255 @@ func (j *JWTManager) RefreshToken(tokenString string) (string, error) {
 
 	// Create new claims with extended expiration
 	// Ensure the new token has a later expiration time than the original
-	now := time.Now()
-	
-	// Calculate new expiration time: either 24 hours from now, or 1 hour after the original expiration
+	config := j.Config()
+	now := j.now()
+
+	// Calculate new expiration time: either one TTL from now, or 1 hour after the original expiration
 	// whichever is later, to ensure the new token expires after the original
-	originalExp := time.Unix(claims.Exp, 0)
-	newExp := now.Add(24 * time.Hour)
+	originalExp := claims.ExpiresAt.Time
+	newExp := now.Add(config.AccessTTL)
 	if newExp.Before(originalExp.Add(1 * time.Hour)) {
 		newExp = originalExp.Add(1 * time.Hour)
 	}
-	
+
 	newClaims := types.JWTClaims{
-		UserID: claims.UserID,
-		Email:  claims.Email,
-		Role:   claims.Role,
-		OrgID:  claims.OrgID,
-		Exp:    newExp.Unix(),
-		Iat:    now.Unix(),
+		UserID:    claims.UserID,
+		Email:     claims.Email,
+		Role:      claims.Role,
+		OrgID:     claims.OrgID,
+		Scopes:    claims.Scopes,
+		Extra:     claims.Extra,
+		TokenType: types.TokenTypeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    config.Issuer,
+			Subject:   claims.UserID,
+			Audience:  config.Audience,
+			ExpiresAt: jwt.NewNumericDate(newExp),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+
+	return j.sign(newClaims)
+}
+
+// claimsForUser returns the identity claims for a user
+func claimsForUser(user *types.User) types.JWTClaims {
+	return types.JWTClaims{
+		UserID: user.ID,
+		Email:  user.Email.String(),
+		Role:   user.Role,
+		OrgID:  user.OrgID,
+	}
+}
+
+// issue signs a token of the given type with a fresh jti and lifetime
+func (j *JWTManager) issue(claims types.JWTClaims, tokenType types.TokenType, ttl time.Duration, now time.Time) (string, time.Time, error) {
+	config := j.Config()
+	expiresAt := now.Add(ttl)
+
+	claims.TokenType = tokenType
+	subject := claims.Subject
+	if subject == "" {
+		subject = claims.UserID
+	}
+
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        uuid.New().String(),
+		Issuer:    config.Issuer,
+		Subject:   subject,
+		Audience:  config.Audience,
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+	}
+
+	token, err := j.sign(claims)
+	return token, expiresAt, err
+}
+
+// parse verifies a token's signature and registered claims. ctx bounds any
+// JWKS fetch needed to find the key.
+func (j *JWTManager) parse(ctx context.Context, tokenString string) (*types.JWTClaims, error) {
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		return j.keyFunc(ctx, token)
+	}
+	token, err := jwt.ParseWithClaims(tokenString, &types.JWTClaims{}, keyFunc, j.parserOptions()...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*types.JWTClaims); ok && token.Valid {
+		return claims, nil
+	}
+
+	return nil, errors.New("invalid token")
+}
+
+// AddSecret adds an HS256 secret under the given key ID. The newest key is
+// used for signing while all configured keys remain valid for verification.
+func (j *JWTManager) AddSecret(kid, secret string) error {
+	if kid == "" {
+		return errors.New("key id is required")
+	}
+	if secret == "" {
+		return errors.New("secret is required")
+	}
+
+	return j.addKey(&jwtKey{
+		id:         kid,
+		method:     jwt.SigningMethodHS256,
+		signingKey: []byte(secret),
+		verifyKey:  []byte(secret),
+	})
+}
+
+// RemoveKey retires the key with the given ID. Tokens signed with it no
+// longer validate. The key created by NewJWTManager has an empty ID.
+func (j *JWTManager) RemoveKey(kid string) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	for i, key := range j.keys {
+		if key.id == kid {
+			if len(j.keys) == 1 {
+				return errors.New("cannot remove the last key")
+			}
+			j.keys = append(j.keys[:i:i], j.keys[i+1:]...)
+			return nil
+		}
 	}
+	return fmt.Errorf("unknown key id %q", kid)
+}
+
+// KeyIDs returns the configured key IDs, oldest first
+func (j *JWTManager) KeyIDs() []string {
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+
+	ids := make([]string, len(j.keys))
+	for i, key := range j.keys {
+		ids[i] = key.id
+	}
+	return ids
+}
+
+// addKey appends a key, making it the signing key if it has a private part
+func (j *JWTManager) addKey(key *jwtKey) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	for _, existing := range j.keys {
+		if existing.id == key.id {
+			return fmt.Errorf("key id %q already exists", key.id)
+		}
+	}
+	j.keys = append(j.keys, key)
+	return nil
+}
+
+// currentKey returns the newest key that can sign tokens
+func (j *JWTManager) currentKey() *jwtKey {
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims)
-	return token.SignedString([]byte(j.secretKey))
-} 
\ No newline at end of file
+	for i := len(j.keys) - 1; i >= 0; i-- {
+		if j.keys[i].signingKey != nil {
+			return j.keys[i]
+		}
+	}
+	return nil
+}
+
+// validMethods returns the algorithms accepted during validation
+func (j *JWTManager) validMethods() []string {
+	if j.jwks != nil {
+		return []string{AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA}
+	}
+
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+
+	seen := make(map[string]bool)
+	var methods []string
+	for _, key := range j.keys {
+		if alg := key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// parserOptions builds the validation options from the configuration
+func (j *JWTManager) parserOptions() []jwt.ParserOption {
+	config := j.Config()
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(j.validMethods()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(config.Leeway),
+		jwt.WithTimeFunc(j.now),
+	}
+	if config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Issuer))
+	}
+	if len(config.Audience) > 0 {
+		options = append(options, jwt.WithAudience(config.Audience...))
+	}
+	return options
+}
+
+// sign signs the claims with the current key
+func (j *JWTManager) sign(claims jwt.Claims) (string, error) {
+	key := j.currentKey()
+	if key == nil {
+		return "", errors.New("jwt manager has no signing key")
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	if key.id != "" {
+		token.Header["kid"] = key.id
+	}
+	return token.SignedString(key.signingKey)
+}
+
+// keyFunc resolves the verification key from the token's kid header. Tokens
+// without a kid are checked against every key of the matching algorithm.
+func (j *JWTManager) keyFunc(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	alg := token.Method.Alg()
+
+	if j.jwks != nil {
+		return j.jwksKey(ctx, alg, kid)
+	}
+
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+
+	if kid != "" {
+		for _, key := range j.keys {
+			if key.id == kid {
+				if key.method.Alg() != alg {
+					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+				}
+				return key.verifyKey, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	var candidates []jwt.VerificationKey
+	for _, key := range j.keys {
+		if key.method.Alg() == alg {
+			candidates = append(candidates, key.verifyKey)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return jwt.VerificationKeySet{Keys: candidates}, nil
+}
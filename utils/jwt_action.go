@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// Common action token purposes
+const (
+	PurposeEmailVerification = "email_verification"
+	PurposePasswordReset     = "password_reset"
+	PurposeGuardInvite       = "guard_invite"
+)
+
+var (
+	// ErrInvalidTokenPurpose is returned when an action token was issued for a different purpose
+	ErrInvalidTokenPurpose = errors.New("invalid token purpose")
+
+	// ErrActionTokenUsed is returned when an action token has already been redeemed
+	ErrActionTokenUsed = errors.New("action token has already been used")
+
+	// ErrRevokerRequired is returned when single-use enforcement needs a TokenRevoker but none is configured
+	ErrRevokerRequired = errors.New("a token revoker is required for single-use tokens")
+)
+
+// onceRevoker is implemented by revokers that can atomically revoke a token
+// only if it was not revoked before
+type onceRevoker interface {
+	RevokeTokenOnce(ctx context.Context, jti string, expiresAt time.Time) (bool, error)
+}
+
+// GenerateActionToken issues a short-lived token for a single action such as
+// email verification, password reset or a guard invite link. The subject
+// identifies who the action is for, e.g. a user ID or an invited email.
+func (j *JWTManager) GenerateActionToken(purpose, subject string, ttl time.Duration) (string, error) {
+	if purpose == "" {
+		return "", errors.New("token purpose is required")
+	}
+	if subject == "" {
+		return "", errors.New("token subject is required")
+	}
+	if ttl <= 0 {
+		return "", errors.New("token ttl must be positive")
+	}
+
+	claims := types.JWTClaims{Purpose: purpose}
+	claims.Subject = subject
+
+	token, _, err := j.issue(claims, types.TokenTypeAction, ttl, j.now())
+	return token, err
+}
+
+// ValidateActionToken validates an action token for the given purpose and
+// redeems it, so each token can be used only once. Redemption is recorded in
+// the configured TokenRevoker, which is therefore required.
+func (j *JWTManager) ValidateActionToken(ctx context.Context, tokenString, purpose string) (*types.JWTClaims, error) {
+	claims, err := j.parse(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.TokenType != types.TokenTypeAction {
+		return nil, ErrInvalidTokenType
+	}
+	if claims.Purpose != purpose {
+		return nil, ErrInvalidTokenPurpose
+	}
+
+	j.mutex.RLock()
+	revoker := j.revoker
+	j.mutex.RUnlock()
+
+	if revoker == nil {
+		return nil, ErrRevokerRequired
+	}
+
+	if once, ok := revoker.(onceRevoker); ok {
+		fresh, err := once.RevokeTokenOnce(ctx, claims.ID, claims.ExpiresAt.Time)
+		if err != nil {
+			return nil, fmt.Errorf("failed to redeem action token: %w", err)
+		}
+		if !fresh {
+			return nil, ErrActionTokenUsed
+		}
+		return claims, nil
+	}
+
+	revoked, err := revoker.IsRevoked(ctx, claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	if revoked {
+		return nil, ErrActionTokenUsed
+	}
+	if err := revoker.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return nil, fmt.Errorf("failed to redeem action token: %w", err)
+	}
+	return claims, nil
+}
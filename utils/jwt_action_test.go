@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActionToken(t *testing.T) {
+	revokers := map[string]TokenRevoker{
+		"memory": NewMemoryTokenRevoker(),
+		"redis":  NewRedisTokenRevoker(newTestRedis(t), "", time.Hour),
+	}
+
+	for name, revoker := range revokers {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			jwtManager := NewJWTManager("test-secret-key-32-chars-long")
+			jwtManager.SetTokenRevoker(revoker)
+
+			token, err := jwtManager.GenerateActionToken(PurposePasswordReset, "user-123", 30*time.Minute)
+			require.NoError(t, err)
+
+			// Action tokens are not access tokens
+			_, err = jwtManager.ValidateToken(token)
+			assert.ErrorIs(t, err, ErrInvalidTokenType)
+
+			_, err = jwtManager.ValidateActionToken(ctx, token, PurposeEmailVerification)
+			assert.ErrorIs(t, err, ErrInvalidTokenPurpose)
+
+			claims, err := jwtManager.ValidateActionToken(ctx, token, PurposePasswordReset)
+			require.NoError(t, err)
+			assert.Equal(t, types.TokenTypeAction, claims.TokenType)
+			assert.Equal(t, PurposePasswordReset, claims.Purpose)
+			assert.Equal(t, "user-123", claims.Subject)
+
+			_, err = jwtManager.ValidateActionToken(ctx, token, PurposePasswordReset)
+			assert.ErrorIs(t, err, ErrActionTokenUsed)
+		})
+	}
+}
+
+// checkingRevoker hides the atomic RevokeTokenOnce of the wrapped revoker
+type checkingRevoker struct {
+	TokenRevoker
+}
+
+func TestActionTokenWithPlainRevoker(t *testing.T) {
+	ctx := context.Background()
+	jwtManager := NewJWTManager("test-secret-key-32-chars-long")
+	jwtManager.SetTokenRevoker(checkingRevoker{NewMemoryTokenRevoker()})
+
+	token, err := jwtManager.GenerateActionToken(PurposeGuardInvite, "guard@example.com", time.Hour)
+	require.NoError(t, err)
+
+	_, err = jwtManager.ValidateActionToken(ctx, token, PurposeGuardInvite)
+	require.NoError(t, err)
+
+	_, err = jwtManager.ValidateActionToken(ctx, token, PurposeGuardInvite)
+	assert.ErrorIs(t, err, ErrActionTokenUsed)
+}
+
+func TestActionTokenValidation(t *testing.T) {
+	ctx := context.Background()
+	jwtManager := NewJWTManager("test-secret-key-32-chars-long")
+
+	_, err := jwtManager.GenerateActionToken("", "user-123", time.Hour)
+	assert.Error(t, err)
+	_, err = jwtManager.GenerateActionToken(PurposePasswordReset, "", time.Hour)
+	assert.Error(t, err)
+	_, err = jwtManager.GenerateActionToken(PurposePasswordReset, "user-123", 0)
+	assert.Error(t, err)
+
+	token, err := jwtManager.GenerateActionToken(PurposeEmailVerification, "user-123", time.Hour)
+	require.NoError(t, err)
+
+	// Single use cannot be enforced without a revoker
+	_, err = jwtManager.ValidateActionToken(ctx, token, PurposeEmailVerification)
+	assert.ErrorIs(t, err, ErrRevokerRequired)
+
+	// Access tokens cannot be redeemed as action tokens
+	jwtManager.SetTokenRevoker(NewMemoryTokenRevoker())
+	access, err := jwtManager.GenerateToken(testUser())
+	require.NoError(t, err)
+	_, err = jwtManager.ValidateActionToken(ctx, access, PurposeEmailVerification)
+	assert.ErrorIs(t, err, ErrInvalidTokenType)
+}
@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported JWT signing algorithms
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// NewJWTManagerWithKeys creates a JWT manager that signs with an asymmetric key pair.
+// The private key may be nil to create a verify-only manager; the public key may be
+// nil when it can be derived from the private key. The key ID defaults to the
+// key's JWK thumbprint.
+func NewJWTManagerWithKeys(algorithm string, privateKey crypto.PrivateKey, publicKey crypto.PublicKey) (*JWTManager, error) {
+	key, err := newAsymmetricKey(algorithm, "", privateKey, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JWTManager{keys: []*jwtKey{key}}, nil
+}
+
+// AddKeyPair adds an asymmetric key under the given key ID (the JWK thumbprint
+// when empty). A key with a private part becomes the signing key; a public-only
+// key is used for verification alone.
+func (j *JWTManager) AddKeyPair(kid, algorithm string, privateKey crypto.PrivateKey, publicKey crypto.PublicKey) error {
+	key, err := newAsymmetricKey(algorithm, kid, privateKey, publicKey)
+	if err != nil {
+		return err
+	}
+	return j.addKey(key)
+}
+
+// newAsymmetricKey validates a key pair against the algorithm
+func newAsymmetricKey(algorithm, kid string, privateKey crypto.PrivateKey, publicKey crypto.PublicKey) (*jwtKey, error) {
+	method, err := asymmetricSigningMethod(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	if privateKey == nil && publicKey == nil {
+		return nil, errors.New("either a private or a public key is required")
+	}
+
+	if publicKey == nil {
+		signer, ok := privateKey.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("cannot derive public key from %T", privateKey)
+		}
+		publicKey = signer.Public()
+	}
+
+	if privateKey != nil {
+		if err := checkKeyType(algorithm, privateKey); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkKeyType(algorithm, publicKey); err != nil {
+		return nil, err
+	}
+
+	if kid == "" {
+		if kid, err = JWKThumbprint(publicKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return &jwtKey{
+		id:         kid,
+		method:     method,
+		signingKey: privateKey,
+		verifyKey:  publicKey,
+	}, nil
+}
+
+// NewJWTManagerFromPEM creates an asymmetric JWT manager from PEM encoded keys.
+// Pass a nil privateKeyPEM to create a verify-only manager.
+func NewJWTManagerFromPEM(algorithm string, privateKeyPEM, publicKeyPEM []byte) (*JWTManager, error) {
+	var privateKey crypto.PrivateKey
+	var publicKey crypto.PublicKey
+	var err error
+
+	if len(privateKeyPEM) > 0 {
+		if privateKey, err = ParsePrivateKeyPEM(privateKeyPEM); err != nil {
+			return nil, err
+		}
+	}
+	if len(publicKeyPEM) > 0 {
+		if publicKey, err = ParsePublicKeyPEM(publicKeyPEM); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewJWTManagerWithKeys(algorithm, privateKey, publicKey)
+}
+
+// NewJWTVerifier creates a verify-only JWT manager from a PEM encoded public key,
+// for services that validate tokens but must not hold the signing key
+func NewJWTVerifier(algorithm string, publicKeyPEM []byte) (*JWTManager, error) {
+	return NewJWTManagerFromPEM(algorithm, nil, publicKeyPEM)
+}
+
+// ParsePrivateKeyPEM parses an RSA, ECDSA or Ed25519 private key in PKCS#8, PKCS#1 or SEC 1 form
+func ParsePrivateKeyPEM(data []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM private key")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unsupported private key type %q", block.Type)
+}
+
+// ParsePublicKeyPEM parses an RSA, ECDSA or Ed25519 public key in PKIX or PKCS#1 form, or from a certificate
+func ParsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM public key")
+	}
+
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+		return cert.PublicKey, nil
+	}
+
+	return nil, fmt.Errorf("unsupported public key type %q", block.Type)
+}
+
+// asymmetricSigningMethod maps an algorithm name to its jwt signing method
+func asymmetricSigningMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgorithmES256:
+		return jwt.SigningMethodES256, nil
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported asymmetric signing algorithm: %s", algorithm)
+	}
+}
+
+// checkKeyType verifies that a key matches the given algorithm
+func checkKeyType(algorithm string, key interface{}) error {
+	ok := false
+	switch algorithm {
+	case AlgorithmRS256:
+		switch key.(type) {
+		case *rsa.PrivateKey, *rsa.PublicKey:
+			ok = true
+		}
+	case AlgorithmES256:
+		switch k := key.(type) {
+		case *ecdsa.PrivateKey:
+			ok = k.Curve == elliptic.P256()
+		case *ecdsa.PublicKey:
+			ok = k.Curve == elliptic.P256()
+		}
+	case AlgorithmEdDSA:
+		switch key.(type) {
+		case ed25519.PrivateKey, ed25519.PublicKey:
+			ok = true
+		}
+	}
+
+	if !ok {
+		return fmt.Errorf("key of type %T cannot be used with %s", key, algorithm)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testUser() *types.User {
+	return &types.User{
+		ID:    "user-123",
+		Email: "test@example.com",
+		Role:  types.RoleMember,
+		OrgID: "org-456",
+	}
+}
+
+func generateTestKey(t *testing.T, algorithm string) crypto.Signer {
+	t.Helper()
+	switch algorithm {
+	case AlgorithmRS256:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		return key
+	case AlgorithmES256:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		return key
+	default:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		return key
+	}
+}
+
+func encodeTestKeys(t *testing.T, key crypto.Signer) ([]byte, []byte) {
+	t.Helper()
+	privDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+}
+
+func TestAsymmetricSignAndVerify(t *testing.T) {
+	for _, alg := range []string{AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			privPEM, pubPEM := encodeTestKeys(t, generateTestKey(t, alg))
+
+			signer, err := NewJWTManagerFromPEM(alg, privPEM, nil)
+			require.NoError(t, err)
+			assert.Equal(t, alg, signer.Algorithm())
+			assert.True(t, signer.CanSign())
+
+			token, err := signer.GenerateToken(testUser())
+			require.NoError(t, err)
+
+			verifier, err := NewJWTVerifier(alg, pubPEM)
+			require.NoError(t, err)
+			assert.False(t, verifier.CanSign())
+
+			claims, err := verifier.ValidateToken(token)
+			require.NoError(t, err)
+			assert.Equal(t, "user-123", claims.UserID)
+
+			_, err = verifier.GenerateToken(testUser())
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAsymmetricRejectsOtherKeys(t *testing.T) {
+	signer, err := NewJWTManagerWithKeys(AlgorithmES256, generateTestKey(t, AlgorithmES256), nil)
+	require.NoError(t, err)
+	other, err := NewJWTManagerWithKeys(AlgorithmES256, generateTestKey(t, AlgorithmES256), nil)
+	require.NoError(t, err)
+
+	token, err := signer.GenerateToken(testUser())
+	require.NoError(t, err)
+
+	_, err = other.ValidateToken(token)
+	assert.Error(t, err)
+}
+
+func TestAsymmetricRejectsAlgorithmConfusion(t *testing.T) {
+	key := generateTestKey(t, AlgorithmRS256)
+	verifier, err := NewJWTManagerWithKeys(AlgorithmRS256, nil, key.Public())
+	require.NoError(t, err)
+
+	hmacToken, err := NewJWTManager("test-secret-key-32-chars-long").GenerateToken(testUser())
+	require.NoError(t, err)
+
+	_, err = verifier.ValidateToken(hmacToken)
+	assert.Error(t, err)
+}
+
+func TestNewJWTManagerWithKeysInvalid(t *testing.T) {
+	_, err := NewJWTManagerWithKeys("HS512", generateTestKey(t, AlgorithmEdDSA), nil)
+	assert.Error(t, err)
+
+	_, err = NewJWTManagerWithKeys(AlgorithmRS256, generateTestKey(t, AlgorithmEdDSA), nil)
+	assert.Error(t, err)
+
+	_, err = NewJWTManagerWithKeys(AlgorithmEdDSA, nil, nil)
+	assert.Error(t, err)
+
+	_, err = NewJWTManagerFromPEM(AlgorithmEdDSA, []byte("not a pem"), nil)
+	assert.Error(t, err)
+}
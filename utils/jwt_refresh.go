@@ -0,0 +1,208 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrInvalidTokenType is returned when a refresh token is used as an access token or vice versa
+	ErrInvalidTokenType = errors.New("invalid token type")
+
+	// ErrRefreshTokenReused is returned when an already exchanged refresh token is presented again
+	ErrRefreshTokenReused = errors.New("refresh token has already been used")
+)
+
+// RefreshTokenStore records exchanged refresh tokens so each can be used only once
+type RefreshTokenStore interface {
+	// MarkUsed atomically records the refresh token ID as used until expiresAt.
+	// It returns false if the ID had already been marked.
+	MarkUsed(ctx context.Context, jti string, expiresAt time.Time) (bool, error)
+}
+
+// RefreshReuseHandler is invoked when a used refresh token is presented again,
+// which usually means it was stolen. Implementations typically revoke every
+// session of the user.
+type RefreshReuseHandler func(ctx context.Context, claims *types.JWTClaims)
+
+// SetRefreshTokenStore enables refresh token rotation with reuse detection
+func (j *JWTManager) SetRefreshTokenStore(store RefreshTokenStore, onReuse RefreshReuseHandler) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.refreshStore = store
+	j.onRefreshReuse = onReuse
+}
+
+// GenerateTokenPair issues a short-lived access token and a long-lived refresh token for a user
+func (j *JWTManager) GenerateTokenPair(user *types.User) (*types.TokenPair, error) {
+	return j.generateTokenPair(claimsForUser(user))
+}
+
+// ValidateRefreshToken validates a refresh token and returns its claims
+func (j *JWTManager) ValidateRefreshToken(tokenString string) (*types.JWTClaims, error) {
+	return j.validateRefreshToken(context.Background(), tokenString)
+}
+
+// validateRefreshToken checks type, signature and revocation of a refresh token
+func (j *JWTManager) validateRefreshToken(ctx context.Context, tokenString string) (*types.JWTClaims, error) {
+	claims, err := j.parse(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.IsRefresh() {
+		return nil, ErrInvalidTokenType
+	}
+
+	if err := j.checkRevoked(ctx, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new token pair. When a
+// RefreshTokenStore is configured every refresh token can be exchanged once;
+// presenting it again calls the reuse handler and returns ErrRefreshTokenReused.
+func (j *JWTManager) RotateRefreshToken(ctx context.Context, refreshToken string) (*types.TokenPair, error) {
+	claims, err := j.validateRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	j.mutex.RLock()
+	store, onReuse := j.refreshStore, j.onRefreshReuse
+	j.mutex.RUnlock()
+
+	if store != nil {
+		fresh, err := store.MarkUsed(ctx, claims.ID, claims.ExpiresAt.Time)
+		if err != nil {
+			return nil, err
+		}
+		if !fresh {
+			if onReuse != nil {
+				onReuse(ctx, claims)
+			}
+			return nil, ErrRefreshTokenReused
+		}
+	}
+
+	return j.generateTokenPair(types.JWTClaims{
+		UserID: claims.UserID,
+		Email:  claims.Email,
+		Role:   claims.Role,
+		OrgID:  claims.OrgID,
+		Scopes: claims.Scopes,
+		Extra:  claims.Extra,
+	})
+}
+
+// generateTokenPair signs an access and refresh token for the identity claims
+func (j *JWTManager) generateTokenPair(identity types.JWTClaims) (*types.TokenPair, error) {
+	config := j.Config()
+	now := j.now()
+
+	accessToken, accessExp, err := j.issue(identity, types.TokenTypeAccess, config.AccessTTL, now)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshExp, err := j.issue(identity, types.TokenTypeRefresh, config.RefreshTTL, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		TokenType:        "Bearer",
+		AccessExpiresAt:  accessExp,
+		RefreshExpiresAt: refreshExp,
+	}, nil
+}
+
+// MemoryRefreshTokenStore is an in-process RefreshTokenStore, suitable for
+// tests and single-instance services
+type MemoryRefreshTokenStore struct {
+	used      map[string]time.Time
+	lastSweep time.Time
+	clock     clock.Clock
+	mutex     sync.Mutex
+}
+
+// NewMemoryRefreshTokenStore creates a new in-memory refresh token store
+func NewMemoryRefreshTokenStore() *MemoryRefreshTokenStore {
+	return &MemoryRefreshTokenStore{
+		used: make(map[string]time.Time),
+	}
+}
+
+// SetClock sets the clock used token IDs expire against; pass the
+// JWTManager's clock in tests
+func (s *MemoryRefreshTokenStore) SetClock(c clock.Clock) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.clock = c
+}
+
+// MarkUsed records the refresh token ID as used until it expires
+func (s *MemoryRefreshTokenStore) MarkUsed(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := clock.OrReal(s.clock).Now()
+	s.sweep(now)
+
+	if exp, exists := s.used[jti]; exists && !now.After(exp) {
+		return false, nil
+	}
+	s.used[jti] = expiresAt
+	return true, nil
+}
+
+// sweep drops expired token IDs, at most once a minute
+func (s *MemoryRefreshTokenStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for id, exp := range s.used {
+		if now.After(exp) {
+			delete(s.used, id)
+		}
+	}
+}
+
+// RedisRefreshTokenStore is a RefreshTokenStore backed by Redis, shared by
+// every instance of a service
+type RedisRefreshTokenStore struct {
+	client    redis.UniversalClient
+	keyPrefix string
+}
+
+// NewRedisRefreshTokenStore creates a Redis backed refresh token store
+func NewRedisRefreshTokenStore(client redis.UniversalClient, keyPrefix string) *RedisRefreshTokenStore {
+	if keyPrefix == "" {
+		keyPrefix = "jwt:refresh:used"
+	}
+
+	return &RedisRefreshTokenStore{
+		client:    client,
+		keyPrefix: keyPrefix,
+	}
+}
+
+// MarkUsed records the refresh token ID as used with SETNX until it expires
+func (s *RedisRefreshTokenStore) MarkUsed(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		ttl = time.Second
+	}
+	return s.client.SetNX(ctx, s.keyPrefix+":"+jti, 1, ttl).Result()
+}
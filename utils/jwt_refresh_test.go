@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPairManager() *JWTManager {
+	return NewJWTManagerWithConfig("test-secret-key-32-chars-long", &JWTConfig{
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: 7 * 24 * time.Hour,
+	})
+}
+
+func TestGenerateTokenPair(t *testing.T) {
+	jwtManager := newPairManager()
+
+	pair, err := jwtManager.GenerateTokenPair(testUser())
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer", pair.TokenType)
+	assert.True(t, pair.RefreshExpiresAt.After(pair.AccessExpiresAt))
+
+	access, err := jwtManager.ValidateToken(pair.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, types.TokenTypeAccess, access.TokenType)
+	assert.NotEmpty(t, access.ID)
+
+	refresh, err := jwtManager.ValidateRefreshToken(pair.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, types.TokenTypeRefresh, refresh.TokenType)
+	assert.Equal(t, "user-123", refresh.UserID)
+	assert.NotEqual(t, access.ID, refresh.ID)
+}
+
+func TestTokenTypesAreNotInterchangeable(t *testing.T) {
+	jwtManager := newPairManager()
+
+	pair, err := jwtManager.GenerateTokenPair(testUser())
+	require.NoError(t, err)
+
+	_, err = jwtManager.ValidateToken(pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidTokenType)
+
+	_, err = jwtManager.ValidateRefreshToken(pair.AccessToken)
+	assert.ErrorIs(t, err, ErrInvalidTokenType)
+
+	_, err = jwtManager.RotateRefreshToken(context.Background(), pair.AccessToken)
+	assert.ErrorIs(t, err, ErrInvalidTokenType)
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	jwtManager := newPairManager()
+
+	var reused *types.JWTClaims
+	jwtManager.SetRefreshTokenStore(NewMemoryRefreshTokenStore(), func(ctx context.Context, claims *types.JWTClaims) {
+		reused = claims
+	})
+
+	pair, err := jwtManager.GenerateTokenPair(testUser())
+	require.NoError(t, err)
+
+	rotated, err := jwtManager.RotateRefreshToken(context.Background(), pair.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, pair.RefreshToken, rotated.RefreshToken)
+
+	claims, err := jwtManager.ValidateToken(rotated.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "user-123", claims.UserID)
+	assert.Equal(t, types.RoleMember, claims.Role)
+
+	// Presenting the original refresh token again triggers reuse detection
+	_, err = jwtManager.RotateRefreshToken(context.Background(), pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	require.NotNil(t, reused)
+	assert.Equal(t, "user-123", reused.UserID)
+
+	// The rotated token is still usable once
+	_, err = jwtManager.RotateRefreshToken(context.Background(), rotated.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestMemoryRefreshTokenStorePrunesExpired(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 3, 15, 13, 45, 0, 0, time.UTC))
+	store := NewMemoryRefreshTokenStore()
+	store.SetClock(fake)
+
+	fresh, err := store.MarkUsed(context.Background(), "expiring", fake.Now().Add(30*time.Second))
+	require.NoError(t, err)
+	assert.True(t, fresh)
+
+	fresh, err = store.MarkUsed(context.Background(), "active", fake.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, fresh)
+
+	fresh, err = store.MarkUsed(context.Background(), "active", fake.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, fresh)
+
+	// Expiry follows the store's clock, and expired IDs are swept once a minute
+	fake.Advance(time.Minute)
+	fresh, err = store.MarkUsed(context.Background(), "other", fake.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, fresh)
+	assert.NotContains(t, store.used, "expiring")
+	assert.Contains(t, store.used, "active")
+}
@@ -0,0 +1,285 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrTokenRevoked is returned when a token has been revoked
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// TokenRevoker stores revoked token IDs and per-user revoke-before timestamps
+type TokenRevoker interface {
+	// RevokeToken revokes a single token by jti until it expires
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+
+	// RevokeUser revokes every token of the user issued at or before the given time
+	RevokeUser(ctx context.Context, userID string, before time.Time) error
+
+	// IsRevoked reports whether the token described by the claims has been revoked
+	IsRevoked(ctx context.Context, claims *types.JWTClaims) (bool, error)
+}
+
+// SetTokenRevoker makes token validation consult the given revoker
+func (j *JWTManager) SetTokenRevoker(revoker TokenRevoker) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.revoker = revoker
+}
+
+// ValidateTokenWithContext validates an access token like ValidateToken,
+// using ctx for the revocation lookup
+func (j *JWTManager) ValidateTokenWithContext(ctx context.Context, tokenString string) (*types.JWTClaims, error) {
+	claims, err := j.parse(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.IsRefresh() || claims.TokenType == types.TokenTypeAction {
+		return nil, ErrInvalidTokenType
+	}
+
+	if err := j.checkRevoked(ctx, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkRevoked consults the configured revoker, if any
+func (j *JWTManager) checkRevoked(ctx context.Context, claims *types.JWTClaims) error {
+	j.mutex.RLock()
+	revoker := j.revoker
+	j.mutex.RUnlock()
+
+	if revoker == nil {
+		return nil
+	}
+
+	revoked, err := revoker.IsRevoked(ctx, claims)
+	if err != nil {
+		return fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// revokedBefore reports whether a token issued at iat falls under a
+// revoke-before timestamp. Tokens without iat are treated as revoked.
+func revokedBefore(iat *jwt.NumericDate, before time.Time) bool {
+	if before.IsZero() {
+		return false
+	}
+	return iat == nil || iat.Unix() <= before.Unix()
+}
+
+// MemoryTokenRevoker is an in-process TokenRevoker, suitable for tests and
+// single-instance services
+type MemoryTokenRevoker struct {
+	tokens    map[string]time.Time
+	users     map[string]time.Time
+	lastSweep time.Time
+	clock     clock.Clock
+	mutex     sync.RWMutex
+}
+
+// NewMemoryTokenRevoker creates a new in-memory token revoker
+func NewMemoryTokenRevoker() *MemoryTokenRevoker {
+	return &MemoryTokenRevoker{
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]time.Time),
+	}
+}
+
+// SetClock sets the clock revoked token IDs expire against; pass the
+// JWTManager's clock in tests
+func (r *MemoryTokenRevoker) SetClock(c clock.Clock) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.clock = c
+}
+
+// RevokeToken revokes a single token by jti until it expires
+func (r *MemoryTokenRevoker) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return errors.New("token id is required")
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.sweep(clock.OrReal(r.clock).Now())
+	r.tokens[jti] = expiresAt
+	return nil
+}
+
+// tokenRevoked reports whether jti is revoked and not yet expired. The
+// caller must hold the lock.
+func (r *MemoryTokenRevoker) tokenRevoked(jti string, now time.Time) bool {
+	exp, revoked := r.tokens[jti]
+	return revoked && !now.After(exp)
+}
+
+// sweep drops expired token IDs, at most once a minute. The caller must
+// hold the write lock.
+func (r *MemoryTokenRevoker) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < time.Minute {
+		return
+	}
+	r.lastSweep = now
+
+	for id, exp := range r.tokens {
+		if now.After(exp) {
+			delete(r.tokens, id)
+		}
+	}
+}
+
+// RevokeUser revokes every token of the user issued at or before the given time
+func (r *MemoryTokenRevoker) RevokeUser(ctx context.Context, userID string, before time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if before.After(r.users[userID]) {
+		r.users[userID] = before
+	}
+	return nil
+}
+
+// RevokeTokenOnce atomically revokes a token, returning false if it was already revoked
+func (r *MemoryTokenRevoker) RevokeTokenOnce(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	if jti == "" {
+		return false, errors.New("token id is required")
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := clock.OrReal(r.clock).Now()
+	r.sweep(now)
+	if r.tokenRevoked(jti, now) {
+		return false, nil
+	}
+	r.tokens[jti] = expiresAt
+	return true, nil
+}
+
+// IsRevoked reports whether the token described by the claims has been revoked
+func (r *MemoryTokenRevoker) IsRevoked(ctx context.Context, claims *types.JWTClaims) (bool, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if claims.ID != "" && r.tokenRevoked(claims.ID, clock.OrReal(r.clock).Now()) {
+		return true, nil
+	}
+	return revokedBefore(claims.IssuedAt, r.users[claims.UserID]), nil
+}
+
+// RedisTokenRevoker is a TokenRevoker backed by Redis, shared by every
+// instance of a service
+type RedisTokenRevoker struct {
+	client    redis.UniversalClient
+	keyPrefix string
+	userTTL   time.Duration
+}
+
+// NewRedisTokenRevoker creates a Redis backed revoker. userTTL bounds how long
+// user revoke-before markers are kept and should be at least the longest token
+// lifetime (typically JWTConfig.RefreshTTL).
+func NewRedisTokenRevoker(client redis.UniversalClient, keyPrefix string, userTTL time.Duration) *RedisTokenRevoker {
+	if keyPrefix == "" {
+		keyPrefix = "jwt:revoked"
+	}
+
+	return &RedisTokenRevoker{
+		client:    client,
+		keyPrefix: keyPrefix,
+		userTTL:   userTTL,
+	}
+}
+
+// RevokeToken revokes a single token by jti until it expires
+func (r *RedisTokenRevoker) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return errors.New("token id is required")
+	}
+
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return r.client.Set(ctx, r.tokenKey(jti), 1, ttl).Err()
+}
+
+// RevokeTokenOnce atomically revokes a token with SETNX, returning false if it was already revoked
+func (r *RedisTokenRevoker) RevokeTokenOnce(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	if jti == "" {
+		return false, errors.New("token id is required")
+	}
+
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		ttl = time.Second
+	}
+	return r.client.SetNX(ctx, r.tokenKey(jti), 1, ttl).Result()
+}
+
+// revokeUserScript raises a user's revoke-before marker, leaving a later one
+// in place so an older revocation can't un-revoke tokens
+var revokeUserScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]))
+if current and current >= tonumber(ARGV[1]) then
+	return 0
+end
+if tonumber(ARGV[2]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// RevokeUser revokes every token of the user issued at or before the given
+// time. Like the memory revoker it keeps the latest time it has been given.
+func (r *RedisTokenRevoker) RevokeUser(ctx context.Context, userID string, before time.Time) error {
+	return revokeUserScript.Run(ctx, r.client, []string{r.userKey(userID)}, before.Unix(), r.userTTL.Milliseconds()).Err()
+}
+
+// IsRevoked reports whether the token described by the claims has been revoked
+func (r *RedisTokenRevoker) IsRevoked(ctx context.Context, claims *types.JWTClaims) (bool, error) {
+	values, err := r.client.MGet(ctx, r.tokenKey(claims.ID), r.userKey(claims.UserID)).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if values[0] != nil && claims.ID != "" {
+		return true, nil
+	}
+
+	if raw, ok := values[1].(string); ok {
+		before, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid revocation timestamp for user %s: %w", claims.UserID, err)
+		}
+		return revokedBefore(claims.IssuedAt, time.Unix(before, 0)), nil
+	}
+	return false, nil
+}
+
+func (r *RedisTokenRevoker) tokenKey(jti string) string {
+	return r.keyPrefix + ":jti:" + jti
+}
+
+func (r *RedisTokenRevoker) userKey(userID string) string {
+	return r.keyPrefix + ":user:" + userID
+}
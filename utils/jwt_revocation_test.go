@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedis(t *testing.T) redis.UniversalClient {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestTokenRevokers(t *testing.T) {
+	revokers := map[string]TokenRevoker{
+		"memory": NewMemoryTokenRevoker(),
+		"redis":  NewRedisTokenRevoker(newTestRedis(t), "", time.Hour),
+	}
+
+	for name, revoker := range revokers {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now()
+
+			token := &types.JWTClaims{UserID: "user-1", RegisteredClaims: jwt.RegisteredClaims{ID: "jti-1", IssuedAt: jwt.NewNumericDate(now)}}
+			other := &types.JWTClaims{UserID: "user-1", RegisteredClaims: jwt.RegisteredClaims{ID: "jti-2", IssuedAt: jwt.NewNumericDate(now)}}
+
+			revoked, err := revoker.IsRevoked(ctx, token)
+			require.NoError(t, err)
+			assert.False(t, revoked)
+
+			// Revoking by jti affects only that token
+			require.NoError(t, revoker.RevokeToken(ctx, "jti-1", now.Add(time.Hour)))
+			revoked, err = revoker.IsRevoked(ctx, token)
+			require.NoError(t, err)
+			assert.True(t, revoked)
+			revoked, err = revoker.IsRevoked(ctx, other)
+			require.NoError(t, err)
+			assert.False(t, revoked)
+
+			// Revoking a user affects tokens issued before the cutoff only
+			require.NoError(t, revoker.RevokeUser(ctx, "user-1", now))
+			revoked, err = revoker.IsRevoked(ctx, other)
+			require.NoError(t, err)
+			assert.True(t, revoked)
+
+			later := &types.JWTClaims{UserID: "user-1", RegisteredClaims: jwt.RegisteredClaims{ID: "jti-3", IssuedAt: jwt.NewNumericDate(now.Add(time.Minute))}}
+			revoked, err = revoker.IsRevoked(ctx, later)
+			require.NoError(t, err)
+			assert.False(t, revoked)
+
+			// An older cutoff arriving late doesn't un-revoke tokens
+			require.NoError(t, revoker.RevokeUser(ctx, "user-1", now.Add(-time.Hour)))
+			revoked, err = revoker.IsRevoked(ctx, other)
+			require.NoError(t, err)
+			assert.True(t, revoked, "expected the later cutoff to be kept")
+
+			require.NoError(t, revoker.RevokeUser(ctx, "user-1", now.Add(time.Minute)))
+			revoked, err = revoker.IsRevoked(ctx, later)
+			require.NoError(t, err)
+			assert.True(t, revoked, "expected a later cutoff to replace an earlier one")
+
+			assert.Error(t, revoker.RevokeToken(ctx, "", now.Add(time.Hour)))
+		})
+	}
+}
+
+func TestMemoryTokenRevokerExpires(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 3, 15, 13, 45, 0, 0, time.UTC))
+	revoker := NewMemoryTokenRevoker()
+	revoker.SetClock(fake)
+	ctx := context.Background()
+	token := &types.JWTClaims{UserID: "user-1", RegisteredClaims: jwt.RegisteredClaims{ID: "expiring"}}
+
+	require.NoError(t, revoker.RevokeToken(ctx, "expiring", fake.Now().Add(30*time.Second)))
+	require.NoError(t, revoker.RevokeToken(ctx, "active", fake.Now().Add(time.Hour)))
+	revoked, err := revoker.IsRevoked(ctx, token)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	// Expired IDs no longer read as revoked before they are swept
+	fake.Advance(45 * time.Second)
+	revoked, err = revoker.IsRevoked(ctx, token)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+	fresh, err := revoker.RevokeTokenOnce(ctx, "expiring", fake.Now().Add(30*time.Second))
+	require.NoError(t, err)
+	assert.True(t, fresh)
+	assert.Len(t, revoker.tokens, 2)
+
+	// and are swept once a minute
+	fake.Advance(time.Minute)
+	fresh, err = revoker.RevokeTokenOnce(ctx, "active", fake.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, fresh)
+	assert.NotContains(t, revoker.tokens, "expiring")
+	assert.Contains(t, revoker.tokens, "active")
+}
+
+func TestValidateTokenConsultsRevoker(t *testing.T) {
+	jwtManager := newPairManager()
+	revoker := NewMemoryTokenRevoker()
+	jwtManager.SetTokenRevoker(revoker)
+
+	pair, err := jwtManager.GenerateTokenPair(testUser())
+	require.NoError(t, err)
+
+	claims, err := jwtManager.ValidateToken(pair.AccessToken)
+	require.NoError(t, err)
+
+	// Logout revokes the access token by jti
+	require.NoError(t, revoker.RevokeToken(context.Background(), claims.ID, claims.ExpiresAt.Time))
+	_, err = jwtManager.ValidateTokenWithContext(context.Background(), pair.AccessToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+
+	// Compromised accounts revoke every session, including refresh tokens
+	_, err = jwtManager.ValidateRefreshToken(pair.RefreshToken)
+	require.NoError(t, err)
+	require.NoError(t, revoker.RevokeUser(context.Background(), "user-123", time.Now()))
+	_, err = jwtManager.RotateRefreshToken(context.Background(), pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+}
+
+func TestRedisRefreshTokenStore(t *testing.T) {
+	store := NewRedisRefreshTokenStore(newTestRedis(t), "")
+
+	fresh, err := store.MarkUsed(context.Background(), "jti-1", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, fresh)
+
+	fresh, err = store.MarkUsed(context.Background(), "jti-1", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, fresh)
+}
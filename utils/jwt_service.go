@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/types"
+)
+
+// DefaultServiceTokenTTL is the lifetime of service tokens issued without an explicit TTL
+const DefaultServiceTokenTTL = 5 * time.Minute
+
+// GenerateServiceToken issues a short-lived machine token for service-to-service
+// calls. The token's subject is the calling service and it carries no user
+// identity; ttl <= 0 uses DefaultServiceTokenTTL.
+func (j *JWTManager) GenerateServiceToken(serviceName string, scopes []string, ttl time.Duration) (string, error) {
+	if serviceName == "" {
+		return "", errors.New("service name is required")
+	}
+	if ttl <= 0 {
+		ttl = DefaultServiceTokenTTL
+	}
+
+	claims := types.JWTClaims{Scopes: scopes}
+	claims.Subject = serviceName
+
+	token, _, err := j.issue(claims, types.TokenTypeService, ttl, j.now())
+	return token, err
+}
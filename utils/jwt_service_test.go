@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateServiceToken(t *testing.T) {
+	jwtManager := NewJWTManager("test-secret-key-32-chars-long")
+
+	token, err := jwtManager.GenerateServiceToken("codes-service", []string{"users:read"}, time.Minute)
+	require.NoError(t, err)
+
+	claims, err := jwtManager.ValidateToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, types.TokenTypeService, claims.TokenType)
+	assert.Equal(t, types.PrincipalService, claims.Principal())
+	assert.Equal(t, "codes-service", claims.Subject)
+	assert.Equal(t, "codes-service", claims.PrincipalID())
+	assert.Empty(t, claims.UserID)
+	assert.True(t, claims.HasScope("users:read"))
+	assert.InDelta(t, time.Now().Add(time.Minute).Unix(), claims.ExpiresAt.Unix(), 2)
+}
+
+func TestGenerateServiceTokenDefaults(t *testing.T) {
+	jwtManager := NewJWTManager("test-secret-key-32-chars-long")
+
+	_, err := jwtManager.GenerateServiceToken("", nil, time.Minute)
+	assert.Error(t, err)
+
+	token, err := jwtManager.GenerateServiceToken("codes-service", nil, 0)
+	require.NoError(t, err)
+
+	claims, err := jwtManager.ValidateToken(token)
+	require.NoError(t, err)
+	assert.InDelta(t, time.Now().Add(DefaultServiceTokenTTL).Unix(), claims.ExpiresAt.Unix(), 2)
+
+	// Service tokens cannot be exchanged like refresh tokens
+	_, err = jwtManager.ValidateRefreshToken(token)
+	assert.ErrorIs(t, err, ErrInvalidTokenType)
+}
+
+func TestUserTokenPrincipal(t *testing.T) {
+	jwtManager := NewJWTManager("test-secret-key-32-chars-long")
+
+	token, err := jwtManager.GenerateToken(testUser())
+	require.NoError(t, err)
+
+	claims, err := jwtManager.ValidateToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, types.PrincipalUser, claims.Principal())
+	assert.Equal(t, "user-123", claims.PrincipalID())
+}
@@ -1,11 +1,17 @@
 package utils
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/middleware"
 	"github.com/jarakey/jarakey-shared-middleware/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewJWTManager(t *testing.T) {
@@ -27,8 +33,7 @@ func TestGenerateToken(t *testing.T) {
 		Role:      types.RoleMember,
 		OrgID:     "org-456",
 		IsActive:  true,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		AuditFields: types.AuditFields{CreatedAt: time.Now(), UpdatedAt: time.Now()},
 	}
 	
 	token, err := jwtManager.GenerateToken(user)
@@ -53,8 +58,7 @@ func TestGenerateTokenWithDifferentUsers(t *testing.T) {
 			Role:      types.RoleMember,
 			OrgID:     "org-1",
 			IsActive:  true,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
+			AuditFields: types.AuditFields{CreatedAt: time.Now(), UpdatedAt: time.Now()},
 		},
 		{
 			ID:        "user-2",
@@ -63,8 +67,7 @@ func TestGenerateTokenWithDifferentUsers(t *testing.T) {
 			Role:      types.RoleAdmin,
 			OrgID:     "org-2",
 			IsActive:  true,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
+			AuditFields: types.AuditFields{CreatedAt: time.Now(), UpdatedAt: time.Now()},
 		},
 	}
 	
@@ -92,8 +95,7 @@ func TestValidateToken(t *testing.T) {
 		Role:      types.RoleMember,
 		OrgID:     "org-456",
 		IsActive:  true,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		AuditFields: types.AuditFields{CreatedAt: time.Now(), UpdatedAt: time.Now()},
 	}
 	
 	token, err := jwtManager.GenerateToken(user)
@@ -105,15 +107,15 @@ func TestValidateToken(t *testing.T) {
 	assert.NotNil(t, claims)
 	
 	assert.Equal(t, user.ID, claims.UserID)
-	assert.Equal(t, user.Email, claims.Email)
+	assert.Equal(t, user.Email.String(), claims.Email)
 	assert.Equal(t, user.Role, claims.Role)
 	assert.Equal(t, user.OrgID, claims.OrgID)
 	
 	// Expiration should be in the future
-	assert.True(t, claims.Exp > time.Now().Unix())
+	assert.True(t, claims.ExpiresAt.After(time.Now()))
 	
 	// Issued at should be in the past
-	assert.True(t, claims.Iat <= time.Now().Unix())
+	assert.True(t, claims.IssuedAt.Unix() <= time.Now().Unix())
 }
 
 func TestValidateTokenInvalid(t *testing.T) {
@@ -136,8 +138,7 @@ func TestValidateTokenInvalid(t *testing.T) {
 		Role:      types.RoleMember,
 		OrgID:     "org-456",
 		IsActive:  true,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		AuditFields: types.AuditFields{CreatedAt: time.Now(), UpdatedAt: time.Now()},
 	}
 	
 	token, err := jwtManager.GenerateToken(user)
@@ -160,8 +161,7 @@ func TestRefreshToken(t *testing.T) {
 		Role:      types.RoleMember,
 		OrgID:     "org-456",
 		IsActive:  true,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		AuditFields: types.AuditFields{CreatedAt: time.Now(), UpdatedAt: time.Now()},
 	}
 	
 	originalToken, err := jwtManager.GenerateToken(user)
@@ -192,7 +192,7 @@ func TestRefreshToken(t *testing.T) {
 	assert.Equal(t, originalClaims.OrgID, refreshedClaims.OrgID)
 	
 	// Refreshed token should have later expiration
-	assert.True(t, refreshedClaims.Exp > originalClaims.Exp)
+	assert.True(t, refreshedClaims.ExpiresAt.After(originalClaims.ExpiresAt.Time))
 }
 
 func TestRefreshTokenInvalid(t *testing.T) {
@@ -219,8 +219,7 @@ func TestTokenExpiration(t *testing.T) {
 		Role:      types.RoleMember,
 		OrgID:     "org-456",
 		IsActive:  true,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		AuditFields: types.AuditFields{CreatedAt: time.Now(), UpdatedAt: time.Now()},
 	}
 	
 	token, err := jwtManager.GenerateToken(user)
@@ -230,9 +229,253 @@ func TestTokenExpiration(t *testing.T) {
 	assert.NoError(t, err)
 	
 	// Token should not be expired
-	assert.True(t, claims.Exp > time.Now().Unix())
+	assert.True(t, claims.ExpiresAt.After(time.Now()))
 	
 	// Token should have been issued recently
-	assert.True(t, claims.Iat <= time.Now().Unix())
-	assert.True(t, claims.Iat > time.Now().Add(-1*time.Minute).Unix())
-} 
\ No newline at end of file
+	assert.True(t, claims.IssuedAt.Unix() <= time.Now().Unix())
+	assert.True(t, claims.IssuedAt.After(time.Now().Add(-1*time.Minute)))
+} 
+func TestSecretRotation(t *testing.T) {
+	jwtManager := NewJWTManager("test-secret-key-32-chars-long")
+	
+	legacyToken, err := jwtManager.GenerateToken(testUser())
+	assert.NoError(t, err)
+	
+	// Rotating in a new secret signs with it and keeps old tokens valid
+	assert.NoError(t, jwtManager.AddSecret("2025-10", "rotated-secret-key-32-chars-long"))
+	assert.Equal(t, "2025-10", jwtManager.KeyID())
+	assert.Equal(t, []string{"", "2025-10"}, jwtManager.KeyIDs())
+	
+	rotatedToken, err := jwtManager.GenerateToken(testUser())
+	assert.NoError(t, err)
+	
+	_, err = jwtManager.ValidateToken(legacyToken)
+	assert.NoError(t, err)
+	_, err = jwtManager.ValidateToken(rotatedToken)
+	assert.NoError(t, err)
+	
+	// Tokens signed with the new key are rejected by managers without it
+	_, err = NewJWTManager("test-secret-key-32-chars-long").ValidateToken(rotatedToken)
+	assert.Error(t, err)
+	
+	// Retiring the old secret invalidates its tokens only
+	assert.NoError(t, jwtManager.RemoveKey(""))
+	_, err = jwtManager.ValidateToken(legacyToken)
+	assert.Error(t, err)
+	_, err = jwtManager.ValidateToken(rotatedToken)
+	assert.NoError(t, err)
+}
+
+func TestKeyRotationErrors(t *testing.T) {
+	jwtManager := NewJWTManager("test-secret-key-32-chars-long")
+	
+	assert.Error(t, jwtManager.AddSecret("", "secret"))
+	assert.Error(t, jwtManager.AddSecret("k1", ""))
+	assert.NoError(t, jwtManager.AddSecret("k1", "secret"))
+	assert.Error(t, jwtManager.AddSecret("k1", "other-secret"))
+	
+	assert.Error(t, jwtManager.RemoveKey("missing"))
+	assert.NoError(t, jwtManager.RemoveKey("k1"))
+	assert.Error(t, jwtManager.RemoveKey(""))
+}
+
+func TestMixedKeyRotation(t *testing.T) {
+	jwtManager := NewJWTManager("test-secret-key-32-chars-long")
+	hmacToken, err := jwtManager.GenerateToken(testUser())
+	assert.NoError(t, err)
+	
+	// Move from a shared secret to an asymmetric key
+	key := generateTestKey(t, AlgorithmEdDSA)
+	assert.NoError(t, jwtManager.AddKeyPair("", AlgorithmEdDSA, key, nil))
+	assert.Equal(t, AlgorithmEdDSA, jwtManager.Algorithm())
+	
+	edToken, err := jwtManager.GenerateToken(testUser())
+	assert.NoError(t, err)
+	
+	_, err = jwtManager.ValidateToken(hmacToken)
+	assert.NoError(t, err)
+	_, err = jwtManager.ValidateToken(edToken)
+	assert.NoError(t, err)
+	
+	// Only the asymmetric key is published
+	set, err := jwtManager.JWKS()
+	assert.NoError(t, err)
+	assert.Len(t, set.Keys, 1)
+	assert.Equal(t, jwtManager.KeyID(), set.Keys[0].Kid)
+}
+
+func TestJWTConfigClaims(t *testing.T) {
+	config := &JWTConfig{
+		AccessTTL: 15 * time.Minute,
+		Issuer:    "https://auth.jarakey.test",
+		Audience:  []string{"codes-api"},
+	}
+	jwtManager := NewJWTManagerWithConfig("test-secret-key-32-chars-long", config)
+	
+	token, err := jwtManager.GenerateToken(testUser())
+	assert.NoError(t, err)
+	
+	claims, err := jwtManager.ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, config.Issuer, claims.Issuer)
+	assert.Equal(t, []string{"codes-api"}, []string(claims.Audience))
+	assert.Equal(t, "user-123", claims.Subject)
+	assert.InDelta(t, time.Now().Add(15*time.Minute).Unix(), claims.ExpiresAt.Unix(), 2)
+	assert.Equal(t, claims.IssuedAt, claims.NotBefore)
+	
+	// Issuer and audience must match
+	otherIssuer := NewJWTManagerWithConfig("test-secret-key-32-chars-long", &JWTConfig{
+		AccessTTL: time.Hour,
+		Issuer:    "https://other.test",
+	})
+	_, err = otherIssuer.ValidateToken(token)
+	assert.Error(t, err)
+	
+	otherAudience := NewJWTManagerWithConfig("test-secret-key-32-chars-long", &JWTConfig{
+		AccessTTL: time.Hour,
+		Audience:  []string{"admin-api"},
+	})
+	_, err = otherAudience.ValidateToken(token)
+	assert.Error(t, err)
+}
+
+// timedClaims returns claims with the given registered time claims; zero times are omitted
+func timedClaims(exp, iat, nbf time.Time) types.JWTClaims {
+	claims := types.JWTClaims{UserID: "user-123"}
+	if !exp.IsZero() {
+		claims.ExpiresAt = jwt.NewNumericDate(exp)
+	}
+	if !iat.IsZero() {
+		claims.IssuedAt = jwt.NewNumericDate(iat)
+	}
+	if !nbf.IsZero() {
+		claims.NotBefore = jwt.NewNumericDate(nbf)
+	}
+	return claims
+}
+
+func TestJWTConfigTimeValidation(t *testing.T) {
+	jwtManager := NewJWTManagerWithConfig("test-secret-key-32-chars-long", &JWTConfig{
+		AccessTTL: time.Hour,
+		Leeway:    30 * time.Second,
+	})
+	now := time.Now()
+	
+	tests := []struct {
+		name   string
+		claims types.JWTClaims
+		err    error
+	}{
+		{"expired within leeway", timedClaims(now.Add(-10*time.Second), now.Add(-time.Hour), time.Time{}), nil},
+		{"expired beyond leeway", timedClaims(now.Add(-time.Minute), now.Add(-time.Hour), time.Time{}), jwt.ErrTokenExpired},
+		{"not yet valid", timedClaims(now.Add(2*time.Hour), time.Time{}, now.Add(time.Hour)), jwt.ErrTokenNotValidYet},
+		{"not before within leeway", timedClaims(now.Add(time.Hour), time.Time{}, now.Add(10*time.Second)), nil},
+		{"issued in the future", timedClaims(now.Add(2*time.Hour), now.Add(time.Hour), time.Time{}), jwt.ErrTokenUsedBeforeIssued},
+		{"missing expiration", timedClaims(time.Time{}, now, time.Time{}), jwt.ErrTokenRequiredClaimMissing},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwtManager.sign(tt.claims)
+			require.NoError(t, err)
+	
+			_, err = jwtManager.ValidateToken(token)
+			if tt.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestExpiredIssuedToken(t *testing.T) {
+	jwtManager := NewJWTManagerWithConfig("test-secret-key-32-chars-long", &JWTConfig{
+		AccessTTL: -time.Second,
+	})
+	
+	token, err := jwtManager.GenerateToken(testUser())
+	require.NoError(t, err)
+	
+	_, err = jwtManager.ValidateToken(token)
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+}
+
+func TestJWTManagerClock(t *testing.T) {
+	fake := clock.NewFake(time.Now().Add(-48 * time.Hour).Truncate(time.Second))
+	jwtManager := NewJWTManagerWithConfig("test-secret-key-32-chars-long", &JWTConfig{AccessTTL: time.Hour})
+	jwtManager.SetClock(fake)
+
+	token, err := jwtManager.GenerateToken(testUser())
+	require.NoError(t, err)
+
+	claims, err := jwtManager.ValidateToken(token)
+	require.NoError(t, err, "tokens are validated on the manager's clock, not the system clock")
+	assert.Equal(t, fake.Now(), claims.IssuedAt.Time)
+	assert.Equal(t, fake.Now().Add(time.Hour), claims.ExpiresAt.Time)
+
+	fake.Advance(time.Hour + time.Second)
+	_, err = jwtManager.ValidateToken(token)
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+}
+
+func TestGenerateTokenWithClaims(t *testing.T) {
+	jwtManager := NewJWTManager("test-secret-key-32-chars-long")
+	
+	token, err := jwtManager.GenerateTokenWithClaims(testUser(), map[string]interface{}{
+		"scopes":    "codes:generate codes:validate",
+		"device_id": "device-42",
+		"tier":      float64(2),
+	})
+	assert.NoError(t, err)
+	
+	claims, err := jwtManager.ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"codes:generate", "codes:validate"}, claims.Scopes)
+	assert.True(t, claims.HasScope("codes:validate"))
+	assert.False(t, claims.HasScope("admin"))
+	assert.Equal(t, "device-42", claims.Extra["device_id"])
+	assert.Equal(t, float64(2), claims.Extra["tier"])
+	assert.Equal(t, "user-123", claims.UserID)
+}
+
+func TestGenerateTokenWithClaimsRejectsReserved(t *testing.T) {
+	jwtManager := NewJWTManager("test-secret-key-32-chars-long")
+	
+	_, err := jwtManager.GenerateTokenWithClaims(testUser(), map[string]interface{}{"exp": 0})
+	assert.Error(t, err)
+	
+	_, err = jwtManager.GenerateTokenWithClaims(testUser(), map[string]interface{}{"scopes": 42})
+	assert.Error(t, err)
+}
+
+func TestJWTManagerWithAuthMiddleware(t *testing.T) {
+	jwtManager := NewJWTManager("test-secret-key-32-chars-long")
+	var _ middleware.TokenValidator = jwtManager
+
+	var userID, correlationUserID string
+	handler := middleware.CorrelationMiddleware()(middleware.AuthMiddleware(jwtManager)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID = middleware.GetJWTClaims(r.Context()).UserID
+		correlationUserID = middleware.GetUserID(r.Context())
+	})))
+
+	token, err := jwtManager.GenerateToken(&types.User{ID: "user-123", Email: "test@example.com", Role: types.RoleMember, OrgID: "org-456", IsActive: true})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user-123", userID)
+	assert.Equal(t, "user-123", correlationUserID)
+
+	// Tokens from another key are rejected with the standard body
+	other, err := NewJWTManager("another-secret-key-32-chars-long").GenerateToken(&types.User{ID: "user-123"})
+	require.NoError(t, err)
+	req = httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+other)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"success":false,"message":"Invalid or expired token","error":"invalid_token"}`, w.Body.String())
+}
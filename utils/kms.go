@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// envelopeVersion prefixes envelope ciphertexts produced by EncryptWithDataKey
+const envelopeVersion byte = 2
+
+// ErrNoKeyProvider is returned by the data key methods when no provider is set
+var ErrNoKeyProvider = errors.New("no key provider configured")
+
+// KeyProvider wraps and unwraps data keys with a master key that never leaves
+// a key management service
+type KeyProvider interface {
+	// Name identifies the provider in errors and logs
+	Name() string
+	// WrapKey encrypts a data key under the master key
+	WrapKey(ctx context.Context, dataKey []byte) ([]byte, error)
+	// UnwrapKey decrypts a data key wrapped by WrapKey
+	UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// LocalKeyProvider wraps data keys with a 32-byte master key held in memory.
+// It is meant for development and tests.
+type LocalKeyProvider struct {
+	masterKey []byte
+}
+
+// NewLocalKeyProvider creates a provider for the given 32-byte master key
+func NewLocalKeyProvider(masterKey []byte) (*LocalKeyProvider, error) {
+	if len(masterKey) != EncryptionKeySize {
+		return nil, fmt.Errorf("master key must be %d bytes, got %d", EncryptionKeySize, len(masterKey))
+	}
+	return &LocalKeyProvider{masterKey: append([]byte(nil), masterKey...)}, nil
+}
+
+// Name returns "local"
+func (p *LocalKeyProvider) Name() string {
+	return "local"
+}
+
+// WrapKey encrypts the data key with AES-256-GCM under the master key
+func (p *LocalKeyProvider) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	return EncryptAESGCM(p.masterKey, dataKey, nil)
+}
+
+// UnwrapKey decrypts a data key wrapped by WrapKey
+func (p *LocalKeyProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	return DecryptAESGCM(p.masterKey, wrapped, nil)
+}
+
+// SetKeyProvider sets the provider used by EncryptWithDataKey and DecryptWithDataKey
+func (c *CryptoManager) SetKeyProvider(provider KeyProvider) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.keyProvider = provider
+}
+
+// getKeyProvider returns the configured key provider
+func (c *CryptoManager) getKeyProvider() (KeyProvider, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if c.keyProvider == nil {
+		return nil, ErrNoKeyProvider
+	}
+	return c.keyProvider, nil
+}
+
+// EncryptWithDataKey encrypts plaintext under a fresh data key and stores the
+// data key wrapped by the key provider alongside the ciphertext. The result is
+// version || wrapped key length (uint16) || wrapped key || AES-256-GCM ciphertext.
+func (c *CryptoManager) EncryptWithDataKey(ctx context.Context, plaintext, aad []byte) ([]byte, error) {
+	provider, err := c.getKeyProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey := make([]byte, EncryptionKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrapped, err := provider.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to wrap data key: %w", provider.Name(), err)
+	}
+	if len(wrapped) > 0xffff {
+		return nil, fmt.Errorf("%s: wrapped data key is too large", provider.Name())
+	}
+
+	ciphertext, err := EncryptAESGCM(dataKey, plaintext, aad)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, 3+len(wrapped)+len(ciphertext))
+	out = append(out, envelopeVersion)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(wrapped)))
+	out = append(out, wrapped...)
+	return append(out, ciphertext...), nil
+}
+
+// DecryptWithDataKey unwraps the data key with the key provider and decrypts
+// a ciphertext produced by EncryptWithDataKey with the same additional data
+func (c *CryptoManager) DecryptWithDataKey(ctx context.Context, ciphertext, aad []byte) ([]byte, error) {
+	provider, err := c.getKeyProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < 3 || ciphertext[0] != envelopeVersion {
+		return nil, ErrInvalidCiphertext
+	}
+	size := int(binary.BigEndian.Uint16(ciphertext[1:3]))
+	if len(ciphertext) < 3+size {
+		return nil, ErrInvalidCiphertext
+	}
+
+	dataKey, err := provider.UnwrapKey(ctx, ciphertext[3:3+size])
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to unwrap data key: %w", provider.Name(), err)
+	}
+	return DecryptAESGCM(dataKey, ciphertext[3+size:], aad)
+}
+
+// doKMSRequest sends a JSON request to a key management service and decodes
+// the JSON response into out
+func doKMSRequest(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("responded with status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
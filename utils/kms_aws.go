@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/internal/awsv4"
+)
+
+// AWSKMSConfig holds the configuration for an AWS KMS key provider
+type AWSKMSConfig struct {
+	Region          string        `json:"region"`
+	KeyID           string        `json:"key_id"`   // Key ID, ARN or alias
+	Endpoint        string        `json:"endpoint"` // Defaults to https://kms.<region>.amazonaws.com
+	AccessKeyID     string        `json:"access_key_id"`
+	SecretAccessKey string        `json:"-"`
+	SessionToken    string        `json:"-"`
+	Timeout         time.Duration `json:"timeout"`
+}
+
+// DefaultAWSKMSConfig returns an AWS KMS configuration with credentials and
+// region read from the standard AWS environment variables
+func DefaultAWSKMSConfig() *AWSKMSConfig {
+	credentials := awsv4.CredentialsFromEnv()
+	return &AWSKMSConfig{
+		Region:          awsv4.RegionFromEnv(),
+		AccessKeyID:     credentials.AccessKeyID,
+		SecretAccessKey: credentials.SecretAccessKey,
+		SessionToken:    credentials.SessionToken,
+		Timeout:         10 * time.Second,
+	}
+}
+
+// AWSKMSProvider wraps data keys with an AWS KMS key
+type AWSKMSProvider struct {
+	config     *AWSKMSConfig
+	signer     awsv4.Signer
+	endpoint   string
+	httpClient *http.Client
+}
+
+// NewAWSKMSProvider creates a key provider for an AWS KMS key
+func NewAWSKMSProvider(config *AWSKMSConfig) (*AWSKMSProvider, error) {
+	if config == nil {
+		config = DefaultAWSKMSConfig()
+	}
+	if config.Region == "" || config.KeyID == "" {
+		return nil, errors.New("AWS KMS region and key ID are required")
+	}
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com", config.Region)
+	}
+
+	return &AWSKMSProvider{
+		config: config,
+		signer: awsv4.Signer{
+			Credentials: awsv4.Credentials{
+				AccessKeyID:     config.AccessKeyID,
+				SecretAccessKey: config.SecretAccessKey,
+				SessionToken:    config.SessionToken,
+			},
+			Region:  config.Region,
+			Service: "kms",
+		},
+		endpoint:   endpoint,
+		httpClient: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Name returns "aws-kms"
+func (p *AWSKMSProvider) Name() string {
+	return "aws-kms"
+}
+
+// WrapKey encrypts the data key with the KMS Encrypt API
+func (p *AWSKMSProvider) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	var resp struct {
+		CiphertextBlob []byte `json:"CiphertextBlob"`
+	}
+	err := p.call(ctx, "Encrypt", map[string]interface{}{
+		"KeyId":     p.config.KeyID,
+		"Plaintext": dataKey,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.CiphertextBlob, nil
+}
+
+// UnwrapKey decrypts the data key with the KMS Decrypt API
+func (p *AWSKMSProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Plaintext []byte `json:"Plaintext"`
+	}
+	err := p.call(ctx, "Decrypt", map[string]interface{}{
+		"KeyId":          p.config.KeyID,
+		"CiphertextBlob": wrapped,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Plaintext, nil
+}
+
+// call invokes a KMS JSON API action. Byte slices are base64 encoded by
+// encoding/json, which is what KMS expects for blobs.
+func (p *AWSKMSProvider) call(ctx context.Context, action string, input, output interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	if err := p.signer.Sign(req, body, time.Now()); err != nil {
+		return err
+	}
+
+	if err := doKMSRequest(p.httpClient, req, output); err != nil {
+		return fmt.Errorf("KMS %s: %w", action, err)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gcpMetadataTokenURL serves access tokens for the instance service account
+const gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// GCPKMSConfig holds the configuration for a Google Cloud KMS key provider
+type GCPKMSConfig struct {
+	// KeyName is the full resource name:
+	// projects/<p>/locations/<l>/keyRings/<r>/cryptoKeys/<k>
+	KeyName  string        `json:"key_name"`
+	Endpoint string        `json:"endpoint"` // Defaults to https://cloudkms.googleapis.com
+	Timeout  time.Duration `json:"timeout"`
+
+	// TokenSource returns an OAuth2 access token. Defaults to the service
+	// account of the GCE/GKE instance via the metadata server.
+	TokenSource func(ctx context.Context) (string, error) `json:"-"`
+}
+
+// DefaultGCPKMSConfig returns a default Google Cloud KMS configuration
+func DefaultGCPKMSConfig() *GCPKMSConfig {
+	return &GCPKMSConfig{
+		Endpoint: "https://cloudkms.googleapis.com",
+		Timeout:  10 * time.Second,
+	}
+}
+
+// GCPKMSProvider wraps data keys with a Google Cloud KMS symmetric key
+type GCPKMSProvider struct {
+	config      *GCPKMSConfig
+	tokenSource func(ctx context.Context) (string, error)
+	httpClient  *http.Client
+}
+
+// NewGCPKMSProvider creates a key provider for a Google Cloud KMS key
+func NewGCPKMSProvider(config *GCPKMSConfig) (*GCPKMSProvider, error) {
+	if config == nil {
+		config = DefaultGCPKMSConfig()
+	}
+	if config.KeyName == "" {
+		return nil, errors.New("GCP KMS key name is required")
+	}
+
+	httpClient := &http.Client{Timeout: config.Timeout}
+	tokenSource := config.TokenSource
+	if tokenSource == nil {
+		tokenSource = newMetadataTokenSource(httpClient)
+	}
+
+	return &GCPKMSProvider{
+		config:      config,
+		tokenSource: tokenSource,
+		httpClient:  httpClient,
+	}, nil
+}
+
+// Name returns "gcp-kms"
+func (p *GCPKMSProvider) Name() string {
+	return "gcp-kms"
+}
+
+// WrapKey encrypts the data key with the cryptoKeys.encrypt API
+func (p *GCPKMSProvider) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	var resp struct {
+		Ciphertext []byte `json:"ciphertext"`
+	}
+	if err := p.call(ctx, "encrypt", map[string][]byte{"plaintext": dataKey}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Ciphertext, nil
+}
+
+// UnwrapKey decrypts the data key with the cryptoKeys.decrypt API
+func (p *GCPKMSProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Plaintext []byte `json:"plaintext"`
+	}
+	if err := p.call(ctx, "decrypt", map[string][]byte{"ciphertext": wrapped}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Plaintext, nil
+}
+
+// call invokes a cryptoKeys method on the configured key
+func (p *GCPKMSProvider) call(ctx context.Context, method string, input, output interface{}) error {
+	token, err := p.tokenSource(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get access token: %w", err)
+	}
+
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimSuffix(p.config.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = DefaultGCPKMSConfig().Endpoint
+	}
+	url := fmt.Sprintf("%s/v1/%s:%s", endpoint, p.config.KeyName, method)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	if err := doKMSRequest(p.httpClient, req, output); err != nil {
+		return fmt.Errorf("cloudkms %s: %w", method, err)
+	}
+	return nil
+}
+
+// newMetadataTokenSource returns a token source backed by the metadata
+// server that caches tokens until shortly before they expire
+func newMetadataTokenSource(httpClient *http.Client) func(ctx context.Context) (string, error) {
+	var (
+		mutex     sync.Mutex
+		token     string
+		expiresAt time.Time
+	)
+
+	return func(ctx context.Context) (string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if token != "" && time.Now().Before(expiresAt) {
+			return token, nil
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpMetadataTokenURL, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+
+		var resp struct {
+			AccessToken string `json:"access_token"`
+			ExpiresIn   int    `json:"expires_in"`
+		}
+		if err := doKMSRequest(httpClient, req, &resp); err != nil {
+			return "", fmt.Errorf("metadata server: %w", err)
+		}
+
+		token = resp.AccessToken
+		expiresAt = time.Now().Add(time.Duration(resp.ExpiresIn)*time.Second - time.Minute)
+		return token, nil
+	}
+}
@@ -0,0 +1,218 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWrapPrefix marks data keys "wrapped" by the fake KMS servers
+var fakeWrapPrefix = []byte("wrapped:")
+
+func testKeyProvider(t *testing.T) KeyProvider {
+	provider, err := NewLocalKeyProvider(bytes.Repeat([]byte{7}, EncryptionKeySize))
+	require.NoError(t, err)
+	return provider
+}
+
+func TestEncryptWithDataKey(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	ctx := context.Background()
+
+	_, err := crypto.EncryptWithDataKey(ctx, []byte("secret"), nil)
+	assert.ErrorIs(t, err, ErrNoKeyProvider)
+
+	crypto.SetKeyProvider(testKeyProvider(t))
+
+	ciphertext, err := crypto.EncryptWithDataKey(ctx, []byte("webhook-signing-secret"), []byte("org-456"))
+	require.NoError(t, err)
+
+	plaintext, err := crypto.DecryptWithDataKey(ctx, ciphertext, []byte("org-456"))
+	require.NoError(t, err)
+	assert.Equal(t, "webhook-signing-secret", string(plaintext))
+
+	// Each encryption uses a fresh data key
+	other, err := crypto.EncryptWithDataKey(ctx, []byte("webhook-signing-secret"), []byte("org-456"))
+	require.NoError(t, err)
+	assert.NotEqual(t, ciphertext, other)
+
+	_, err = crypto.DecryptWithDataKey(ctx, ciphertext, []byte("org-999"))
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	for _, malformed := range [][]byte{nil, {envelopeVersion}, {envelopeVersion, 0xff, 0xff, 1}, {1, 0, 0}} {
+		_, err = crypto.DecryptWithDataKey(ctx, malformed, nil)
+		assert.ErrorIs(t, err, ErrInvalidCiphertext)
+	}
+
+	// A different master key cannot unwrap the data key
+	otherProvider, err := NewLocalKeyProvider(bytes.Repeat([]byte{8}, EncryptionKeySize))
+	require.NoError(t, err)
+	crypto.SetKeyProvider(otherProvider)
+	_, err = crypto.DecryptWithDataKey(ctx, ciphertext, []byte("org-456"))
+	assert.Error(t, err)
+
+	_, err = NewLocalKeyProvider([]byte("short"))
+	assert.Error(t, err)
+}
+
+func TestAWSKMSProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-amz-json-1.1", r.Header.Get("Content-Type"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/eu-west-1/kms/aws4_request")
+
+		var keyID struct{ KeyId string }
+		body := new(bytes.Buffer)
+		_, err := body.ReadFrom(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body.Bytes(), &keyID))
+		assert.Equal(t, "alias/jarakey", keyID.KeyId)
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.Encrypt":
+			var req struct{ Plaintext []byte }
+			json.Unmarshal(body.Bytes(), &req)
+			json.NewEncoder(w).Encode(map[string][]byte{"CiphertextBlob": append(fakeWrapPrefix, req.Plaintext...)})
+		case "TrentService.Decrypt":
+			var req struct{ CiphertextBlob []byte }
+			json.Unmarshal(body.Bytes(), &req)
+			if !bytes.HasPrefix(req.CiphertextBlob, fakeWrapPrefix) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"InvalidCiphertextException"}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string][]byte{"Plaintext": bytes.TrimPrefix(req.CiphertextBlob, fakeWrapPrefix)})
+		default:
+			t.Errorf("unexpected target %q", r.Header.Get("X-Amz-Target"))
+		}
+	}))
+	defer server.Close()
+
+	config := DefaultAWSKMSConfig()
+	config.Region = "eu-west-1"
+	config.KeyID = "alias/jarakey"
+	config.Endpoint = server.URL
+	config.AccessKeyID = "AKIDEXAMPLE"
+	config.SecretAccessKey = "secret"
+	provider, err := NewAWSKMSProvider(config)
+	require.NoError(t, err)
+
+	testProviderRoundTrip(t, provider)
+
+	_, err = provider.UnwrapKey(context.Background(), []byte("garbage"))
+	assert.ErrorContains(t, err, "InvalidCiphertextException")
+
+	_, err = NewAWSKMSProvider(&AWSKMSConfig{Region: "eu-west-1"})
+	assert.Error(t, err)
+}
+
+func TestGCPKMSProvider(t *testing.T) {
+	const keyName = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+
+		var req map[string][]byte
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		switch r.URL.Path {
+		case "/v1/" + keyName + ":encrypt":
+			json.NewEncoder(w).Encode(map[string][]byte{"ciphertext": append(fakeWrapPrefix, req["plaintext"]...)})
+		case "/v1/" + keyName + ":decrypt":
+			json.NewEncoder(w).Encode(map[string][]byte{"plaintext": bytes.TrimPrefix(req["ciphertext"], fakeWrapPrefix)})
+		default:
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	config := DefaultGCPKMSConfig()
+	config.KeyName = keyName
+	config.Endpoint = server.URL
+	config.TokenSource = func(ctx context.Context) (string, error) { return "test-token", nil }
+	provider, err := NewGCPKMSProvider(config)
+	require.NoError(t, err)
+
+	testProviderRoundTrip(t, provider)
+
+	config.TokenSource = func(ctx context.Context) (string, error) { return "", errors.New("no credentials") }
+	provider, err = NewGCPKMSProvider(config)
+	require.NoError(t, err)
+	_, err = provider.WrapKey(context.Background(), []byte("key"))
+	assert.ErrorContains(t, err, "no credentials")
+}
+
+func TestVaultTransitProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "vault-token", r.Header.Get("X-Vault-Token"))
+		assert.Equal(t, "jarakey", r.Header.Get("X-Vault-Namespace"))
+
+		var req map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/secrets":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]string{"ciphertext": "vault:v1:" + req["plaintext"]},
+			})
+		case "/v1/transit/decrypt/secrets":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]string{"plaintext": strings.TrimPrefix(req["ciphertext"], "vault:v1:")},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":["no handler for route"]}`))
+		}
+	}))
+	defer server.Close()
+
+	config := DefaultVaultTransitConfig()
+	config.Address = server.URL + "/"
+	config.Token = "vault-token"
+	config.Namespace = "jarakey"
+	config.KeyName = "secrets"
+	provider, err := NewVaultTransitProvider(config)
+	require.NoError(t, err)
+
+	wrapped := testProviderRoundTrip(t, provider)
+	assert.True(t, strings.HasPrefix(string(wrapped), "vault:v1:"))
+
+	config.Mount = "other"
+	_, err = provider.WrapKey(context.Background(), []byte("key"))
+	assert.ErrorContains(t, err, "status 404")
+
+	_, err = NewVaultTransitProvider(&VaultTransitConfig{Address: server.URL})
+	assert.Error(t, err)
+}
+
+// testProviderRoundTrip wraps and unwraps a data key and encrypts through the provider
+func testProviderRoundTrip(t *testing.T, provider KeyProvider) []byte {
+	ctx := context.Background()
+	dataKey := bytes.Repeat([]byte{42}, EncryptionKeySize)
+
+	wrapped, err := provider.WrapKey(ctx, dataKey)
+	require.NoError(t, err)
+	assert.NotEqual(t, dataKey, wrapped)
+
+	unwrapped, err := provider.UnwrapKey(ctx, wrapped)
+	require.NoError(t, err)
+	assert.Equal(t, dataKey, unwrapped)
+
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	crypto.SetKeyProvider(provider)
+	ciphertext, err := crypto.EncryptWithDataKey(ctx, []byte("api-secret"), nil)
+	require.NoError(t, err)
+	plaintext, err := crypto.DecryptWithDataKey(ctx, ciphertext, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "api-secret", string(plaintext))
+
+	return wrapped
+}
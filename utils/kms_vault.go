@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// VaultTransitConfig holds the configuration for a HashiCorp Vault transit key provider
+type VaultTransitConfig struct {
+	Address   string        `json:"address"`
+	Token     string        `json:"-"`
+	Namespace string        `json:"namespace"`
+	Mount     string        `json:"mount"`
+	KeyName   string        `json:"key_name"`
+	Timeout   time.Duration `json:"timeout"`
+}
+
+// DefaultVaultTransitConfig returns a Vault transit configuration with the
+// address, token and namespace read from VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE
+func DefaultVaultTransitConfig() *VaultTransitConfig {
+	return &VaultTransitConfig{
+		Address:   os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+		Mount:     "transit",
+		Timeout:   10 * time.Second,
+	}
+}
+
+// VaultTransitProvider wraps data keys with a Vault transit secrets engine key
+type VaultTransitProvider struct {
+	config     *VaultTransitConfig
+	httpClient *http.Client
+}
+
+// NewVaultTransitProvider creates a key provider for a Vault transit key
+func NewVaultTransitProvider(config *VaultTransitConfig) (*VaultTransitProvider, error) {
+	if config == nil {
+		config = DefaultVaultTransitConfig()
+	}
+	if config.Address == "" || config.Token == "" || config.KeyName == "" {
+		return nil, errors.New("Vault address, token and key name are required")
+	}
+
+	return &VaultTransitProvider{
+		config:     config,
+		httpClient: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Name returns "vault-transit"
+func (p *VaultTransitProvider) Name() string {
+	return "vault-transit"
+}
+
+// WrapKey encrypts the data key with the transit encrypt endpoint. The
+// wrapped key is Vault's "vault:v<n>:..." ciphertext, which records the key version.
+func (p *VaultTransitProvider) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	input := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dataKey)}
+	if err := p.call(ctx, "encrypt", input, &resp); err != nil {
+		return nil, err
+	}
+	return []byte(resp.Data.Ciphertext), nil
+}
+
+// UnwrapKey decrypts the data key with the transit decrypt endpoint
+func (p *VaultTransitProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := p.call(ctx, "decrypt", map[string]string{"ciphertext": string(wrapped)}, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+}
+
+// call invokes a transit endpoint for the configured key
+func (p *VaultTransitProvider) call(ctx context.Context, operation string, input, output interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	mount := strings.Trim(p.config.Mount, "/")
+	if mount == "" {
+		mount = "transit"
+	}
+	url := fmt.Sprintf("%s/v1/%s/%s/%s", strings.TrimSuffix(p.config.Address, "/"), mount, operation, p.config.KeyName)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", p.config.Token)
+	if p.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.config.Namespace)
+	}
+
+	if err := doKMSRequest(p.httpClient, req, output); err != nil {
+		return fmt.Errorf("vault transit %s: %w", operation, err)
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms
+const (
+	PasswordAlgorithmArgon2id = "argon2id"
+	PasswordAlgorithmBcrypt   = "bcrypt"
+)
+
+// ErrUnknownPasswordHash is returned when a stored hash is in no recognised format
+var ErrUnknownPasswordHash = errors.New("unknown password hash format")
+
+// Bounds on the Argon2id parameters accepted from stored hashes, so a corrupt
+// or planted row can't panic the process or exhaust its memory. New hashes
+// are held to the same bounds so they always verify.
+const (
+	maxArgon2Memory = 1 << 20 // KiB
+	maxArgon2Time   = 16
+	minArgon2KeyLen = 16
+	maxArgon2KeyLen = 128
+)
+
+// PasswordHashConfig holds the parameters for new password hashes
+type PasswordHashConfig struct {
+	Algorithm     string `json:"algorithm"`
+	Argon2Time    uint32 `json:"argon2_time"`
+	Argon2Memory  uint32 `json:"argon2_memory"` // KiB
+	Argon2Threads uint8  `json:"argon2_threads"`
+	Argon2KeyLen  uint32 `json:"argon2_key_len"`
+	SaltLen       int    `json:"salt_len"`
+	BcryptCost    int    `json:"bcrypt_cost"`
+}
+
+// DefaultPasswordHashConfig returns the default password hashing parameters
+// (Argon2id with the OWASP recommended baseline)
+func DefaultPasswordHashConfig() *PasswordHashConfig {
+	return &PasswordHashConfig{
+		Algorithm:     PasswordAlgorithmArgon2id,
+		Argon2Time:    3,
+		Argon2Memory:  64 * 1024,
+		Argon2Threads: 2,
+		Argon2KeyLen:  32,
+		SaltLen:       16,
+		BcryptCost:    12,
+	}
+}
+
+// Validate checks the parameters of the configured algorithm
+func (c *PasswordHashConfig) Validate() error {
+	switch c.Algorithm {
+	case PasswordAlgorithmArgon2id:
+		if c.Argon2Time < 1 || c.Argon2Time > maxArgon2Time {
+			return fmt.Errorf("argon2 time must be between 1 and %d, got %d", maxArgon2Time, c.Argon2Time)
+		}
+		if c.Argon2Threads < 1 {
+			return errors.New("argon2 threads must be at least 1")
+		}
+		if c.Argon2Memory < 8*uint32(c.Argon2Threads) || c.Argon2Memory > maxArgon2Memory {
+			return fmt.Errorf("argon2 memory must be between %d and %d KiB, got %d", 8*uint32(c.Argon2Threads), maxArgon2Memory, c.Argon2Memory)
+		}
+		if c.Argon2KeyLen < minArgon2KeyLen || c.Argon2KeyLen > maxArgon2KeyLen {
+			return fmt.Errorf("argon2 key length must be between %d and %d, got %d", minArgon2KeyLen, maxArgon2KeyLen, c.Argon2KeyLen)
+		}
+		if c.SaltLen <= 0 {
+			return fmt.Errorf("salt length must be positive, got %d", c.SaltLen)
+		}
+	case PasswordAlgorithmBcrypt:
+		if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, c.BcryptCost)
+		}
+	default:
+		return fmt.Errorf("unsupported password algorithm %q", c.Algorithm)
+	}
+	return nil
+}
+
+// SetPasswordHashConfig sets the parameters used for new password hashes.
+// Existing hashes keep verifying; PasswordNeedsRehash reports those created
+// with different parameters.
+func (c *CryptoManager) SetPasswordHashConfig(config *PasswordHashConfig) error {
+	if config == nil {
+		config = DefaultPasswordHashConfig()
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.passwordConfig = config
+	return nil
+}
+
+// PasswordHashConfig returns the parameters used for new password hashes
+func (c *CryptoManager) PasswordHashConfig() *PasswordHashConfig {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.passwordConfig == nil {
+		return DefaultPasswordHashConfig()
+	}
+	return c.passwordConfig
+}
+
+// HashPassword creates a salted hash of a password. The algorithm and its
+// parameters are encoded in the returned string, e.g.
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>.
+func (c *CryptoManager) HashPassword(password string) (string, error) {
+	config := c.PasswordHashConfig()
+	if err := config.Validate(); err != nil {
+		return "", err
+	}
+
+	switch config.Algorithm {
+	case PasswordAlgorithmArgon2id:
+		salt := make([]byte, config.SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", fmt.Errorf("failed to generate salt: %w", err)
+		}
+		key := argon2.IDKey([]byte(password), salt, config.Argon2Time, config.Argon2Memory, config.Argon2Threads, config.Argon2KeyLen)
+		return encodeArgon2id(argon2Params{
+			memory:  config.Argon2Memory,
+			time:    config.Argon2Time,
+			threads: config.Argon2Threads,
+		}, salt, key), nil
+	case PasswordAlgorithmBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), config.BcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash password: %w", err)
+		}
+		return string(hash), nil
+	default:
+		return "", fmt.Errorf("unsupported password algorithm %q", config.Algorithm)
+	}
+}
+
+// VerifyPasswordHash verifies a password against an Argon2id, bcrypt or
+// legacy SHA-256 hash
+func (c *CryptoManager) VerifyPasswordHash(password, hash string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false
+		}
+		computed := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(computed, key) == 1
+	case isBcryptHash(hash):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case isLegacyPasswordHash(hash):
+		return subtle.ConstantTimeCompare([]byte(c.legacyPasswordHash(password)), []byte(hash)) == 1
+	default:
+		return false
+	}
+}
+
+// PasswordNeedsRehash reports whether a stored hash should be replaced after
+// the next successful login: legacy SHA-256 hashes, hashes made with another
+// algorithm, and hashes with weaker parameters than the current configuration.
+func (c *CryptoManager) PasswordNeedsRehash(hash string) bool {
+	config := c.PasswordHashConfig()
+
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		if config.Algorithm != PasswordAlgorithmArgon2id {
+			return true
+		}
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return true
+		}
+		return params.memory != config.Argon2Memory || params.time != config.Argon2Time ||
+			params.threads != config.Argon2Threads || uint32(len(key)) != config.Argon2KeyLen ||
+			len(salt) != config.SaltLen
+	case isBcryptHash(hash):
+		if config.Algorithm != PasswordAlgorithmBcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != config.BcryptCost
+	default:
+		return true
+	}
+}
+
+// VerifyPassword verifies a password and reports whether its hash should be
+// upgraded with HashPassword
+func (c *CryptoManager) VerifyPassword(password, hash string) (valid bool, needsRehash bool) {
+	if !c.VerifyPasswordHash(password, hash) {
+		return false, false
+	}
+	return true, c.PasswordNeedsRehash(hash)
+}
+
+// SimulatePasswordVerification does the work of a password check without a
+// stored hash. Login handlers call it when the account doesn't exist so the
+// response time doesn't reveal which usernames are registered.
+func (c *CryptoManager) SimulatePasswordVerification(password string) {
+	// Hashing with the current parameters costs the same as verifying
+	// against a hash made with them
+	_, _ = c.HashPassword(password)
+}
+
+// legacyPasswordHash computes the unsalted SHA-256 hash used before Argon2id.
+// It is kept only to verify existing hashes.
+func (c *CryptoManager) legacyPasswordHash(password string) string {
+	h := sha256.New()
+	h.Write([]byte(password + c.secretKey))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// isLegacyPasswordHash reports whether the hash is a hex encoded SHA-256 digest
+func isLegacyPasswordHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// isBcryptHash reports whether the hash is in modular crypt format for bcrypt
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// argon2Params are the cost parameters encoded in an Argon2id hash
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+// encodeArgon2id encodes an Argon2id hash in PHC string format
+func encodeArgon2id(params argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.memory, params.time, params.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+}
+
+// decodeArgon2id parses an Argon2id hash in PHC string format
+func decodeArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != PasswordAlgorithmArgon2id {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+	if params.time < 1 || params.time > maxArgon2Time || params.threads < 1 ||
+		params.memory < 8*uint32(params.threads) || params.memory > maxArgon2Memory {
+		return params, nil, nil, fmt.Errorf("argon2 parameters out of range %q", parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) < minArgon2KeyLen || len(key) > maxArgon2KeyLen {
+		return params, nil, nil, errors.New("invalid argon2 hash")
+	}
+	return params, salt, key, nil
+}
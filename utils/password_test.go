@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fastPasswordConfig keeps Argon2id cheap in tests
+func fastPasswordConfig() *PasswordHashConfig {
+	config := DefaultPasswordHashConfig()
+	config.Argon2Time = 1
+	config.Argon2Memory = 1024
+	config.BcryptCost = 4
+	return config
+}
+
+func TestLegacyPasswordHash(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+
+	// Hash as produced by the previous SHA-256 implementation
+	legacy := crypto.legacyPasswordHash("my-secure-password")
+	assert.Len(t, legacy, 64)
+
+	assert.True(t, crypto.VerifyPasswordHash("my-secure-password", legacy))
+	assert.False(t, crypto.VerifyPasswordHash("wrong-password", legacy))
+
+	valid, needsRehash := crypto.VerifyPassword("my-secure-password", legacy)
+	assert.True(t, valid)
+	assert.True(t, needsRehash)
+}
+
+func TestBcryptPasswordHash(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	config := fastPasswordConfig()
+	config.Algorithm = PasswordAlgorithmBcrypt
+	require.NoError(t, crypto.SetPasswordHashConfig(config))
+
+	hash, err := crypto.HashPassword("my-secure-password")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$2a$04$"))
+
+	assert.True(t, crypto.VerifyPasswordHash("my-secure-password", hash))
+	assert.False(t, crypto.VerifyPasswordHash("wrong-password", hash))
+	assert.False(t, crypto.PasswordNeedsRehash(hash))
+
+	// Switching to Argon2id flags bcrypt hashes for upgrade but keeps them valid
+	require.NoError(t, crypto.SetPasswordHashConfig(fastPasswordConfig()))
+	valid, needsRehash := crypto.VerifyPassword("my-secure-password", hash)
+	assert.True(t, valid)
+	assert.True(t, needsRehash)
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	require.NoError(t, crypto.SetPasswordHashConfig(fastPasswordConfig()))
+
+	hash, err := crypto.HashPassword("my-secure-password")
+	require.NoError(t, err)
+	assert.False(t, crypto.PasswordNeedsRehash(hash))
+
+	stronger := fastPasswordConfig()
+	stronger.Argon2Time = 2
+	require.NoError(t, crypto.SetPasswordHashConfig(stronger))
+	assert.True(t, crypto.PasswordNeedsRehash(hash))
+	assert.True(t, crypto.VerifyPasswordHash("my-secure-password", hash))
+
+	// Wrong passwords never ask for a rehash
+	valid, needsRehash := crypto.VerifyPassword("wrong-password", hash)
+	assert.False(t, valid)
+	assert.False(t, needsRehash)
+}
+
+func TestMalformedPasswordHashes(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+
+	for _, hash := range []string{
+		"$argon2id$v=19$m=1024,t=1,p=2$c2FsdA",
+		"$argon2id$v=18$m=1024,t=1,p=2$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=x,t=1,p=2$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=1024,t=1,p=2$c2FsdA$",
+		"$2a$invalid",
+		"plaintext-password",
+	} {
+		assert.False(t, crypto.VerifyPasswordHash("plaintext-password", hash), hash)
+		assert.True(t, crypto.PasswordNeedsRehash(hash), hash)
+	}
+
+	assert.Error(t, crypto.SetPasswordHashConfig(&PasswordHashConfig{Algorithm: "md5"}))
+}
+
+func TestPasswordHashConfigValidate(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+
+	// Hashes made at the bounds verify
+	lowest := &PasswordHashConfig{Algorithm: PasswordAlgorithmArgon2id, Argon2Time: 1, Argon2Memory: 8, Argon2Threads: 1, Argon2KeyLen: minArgon2KeyLen, SaltLen: 1}
+	highest := &PasswordHashConfig{Algorithm: PasswordAlgorithmArgon2id, Argon2Time: maxArgon2Time, Argon2Memory: 1024, Argon2Threads: 1, Argon2KeyLen: maxArgon2KeyLen, SaltLen: 16}
+	bcryptLowest := &PasswordHashConfig{Algorithm: PasswordAlgorithmBcrypt, BcryptCost: 4}
+	for _, config := range []*PasswordHashConfig{lowest, highest, bcryptLowest} {
+		require.NoError(t, crypto.SetPasswordHashConfig(config))
+		hash, err := crypto.HashPassword("my-secure-password")
+		require.NoError(t, err)
+		assert.True(t, crypto.VerifyPasswordHash("my-secure-password", hash), hash)
+		assert.False(t, crypto.PasswordNeedsRehash(hash), hash)
+	}
+
+	// Parameters the decoder would reject are refused up front
+	for name, mutate := range map[string]func(*PasswordHashConfig){
+		"time":       func(c *PasswordHashConfig) { c.Argon2Time = maxArgon2Time + 1 },
+		"no time":    func(c *PasswordHashConfig) { c.Argon2Time = 0 },
+		"threads":    func(c *PasswordHashConfig) { c.Argon2Threads = 0 },
+		"memory":     func(c *PasswordHashConfig) { c.Argon2Memory = maxArgon2Memory + 1 },
+		"low memory": func(c *PasswordHashConfig) { c.Argon2Memory = 8 },
+		"key":        func(c *PasswordHashConfig) { c.Argon2KeyLen = maxArgon2KeyLen + 1 },
+		"short key":  func(c *PasswordHashConfig) { c.Argon2KeyLen = minArgon2KeyLen - 1 },
+		"salt":       func(c *PasswordHashConfig) { c.SaltLen = 0 },
+		"bcrypt":     func(c *PasswordHashConfig) { c.Algorithm = PasswordAlgorithmBcrypt; c.BcryptCost = 32 },
+	} {
+		config := fastPasswordConfig()
+		mutate(config)
+		assert.Error(t, config.Validate(), name)
+		assert.Error(t, crypto.SetPasswordHashConfig(config), name)
+	}
+
+	// A zero config is refused rather than panicking in argon2
+	assert.Error(t, crypto.SetPasswordHashConfig(&PasswordHashConfig{}))
+	assert.Error(t, crypto.SetPasswordHashConfig(&PasswordHashConfig{Algorithm: PasswordAlgorithmArgon2id}))
+	assert.Equal(t, bcryptLowest, crypto.PasswordHashConfig())
+}
+
+func TestArgon2ParametersOutOfRange(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	key := strings.Repeat("A", 43) // 32 bytes
+
+	// Each of these would panic argon2.IDKey or allocate gigabytes
+	for _, hash := range []string{
+		"$argon2id$v=19$m=65536,t=0,p=2$c2FsdA$" + key,
+		"$argon2id$v=19$m=65536,t=3,p=0$c2FsdA$" + key,
+		"$argon2id$v=19$m=65536,t=1000,p=2$c2FsdA$" + key,
+		"$argon2id$v=19$m=0,t=3,p=2$c2FsdA$" + key,
+		"$argon2id$v=19$m=4294967295,t=3,p=2$c2FsdA$" + key,
+		"$argon2id$v=19$m=65536,t=3,p=2$c2FsdA$" + strings.Repeat("A", 2000),
+	} {
+		assert.NotPanics(t, func() {
+			assert.False(t, crypto.VerifyPasswordHash("my-secure-password", hash), hash)
+		})
+		assert.True(t, crypto.PasswordNeedsRehash(hash), hash)
+	}
+}
+
+func TestSetPasswordHashConfigConcurrently(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, crypto.SetPasswordHashConfig(fastPasswordConfig()))
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		_ = crypto.PasswordHashConfig()
+	}
+	<-done
+}
+
+func TestSimulatePasswordVerification(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	config := fastPasswordConfig()
+	config.Algorithm = PasswordAlgorithmBcrypt
+	config.BcryptCost = 10
+	require.NoError(t, crypto.SetPasswordHashConfig(config))
+
+	hash, err := crypto.HashPassword("my-secure-password")
+	require.NoError(t, err)
+
+	// An unknown account must cost about as much as a wrong password
+	fastest := func(fn func()) time.Duration {
+		best := time.Duration(math.MaxInt64)
+		for i := 0; i < 3; i++ {
+			start := time.Now()
+			fn()
+			if elapsed := time.Since(start); elapsed < best {
+				best = elapsed
+			}
+		}
+		return best
+	}
+	verify := fastest(func() { crypto.VerifyPasswordHash("wrong-password", hash) })
+	simulated := fastest(func() { crypto.SimulatePasswordVerification("wrong-password") })
+	assert.Greater(t, simulated, verify/2)
+}
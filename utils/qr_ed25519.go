@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ed25519SigningKey is the private key QR codes are signed with in asymmetric mode
+type ed25519SigningKey struct {
+	id  string
+	key ed25519.PrivateKey
+}
+
+// SetQRSigningKeyEd25519 switches QR code signing to Ed25519 so validator
+// devices only need the public key. An empty kid defaults to the key's JWK
+// thumbprint. HMAC keys stay available to validate codes signed earlier.
+func (c *CryptoManager) SetQRSigningKeyEd25519(kid string, key ed25519.PrivateKey) error {
+	if len(key) != ed25519.PrivateKeySize {
+		return errors.New("invalid Ed25519 private key")
+	}
+
+	publicKey := key.Public().(ed25519.PublicKey)
+	if kid == "" {
+		thumbprint, err := JWKThumbprint(publicKey)
+		if err != nil {
+			return err
+		}
+		kid = thumbprint
+	}
+
+	if err := c.AddQRVerificationKey(kid, publicKey); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.qrEd25519Key = &ed25519SigningKey{id: kid, key: key}
+	return nil
+}
+
+// AddQRVerificationKey adds an Ed25519 public key that QR code signatures
+// with the given key ID are verified against
+func (c *CryptoManager) AddQRVerificationKey(kid string, key ed25519.PublicKey) error {
+	if kid == "" {
+		return errors.New("verification key id is required")
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return errors.New("invalid Ed25519 public key")
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, existing := range c.signingKeys {
+		if existing.id == kid {
+			return fmt.Errorf("key id %q is already used by an HMAC signing key", kid)
+		}
+	}
+	if c.qrPublicKeys == nil {
+		c.qrPublicKeys = make(map[string]ed25519.PublicKey)
+	}
+	c.qrPublicKeys[kid] = key
+	return nil
+}
+
+// SetQRJWKSClient makes the manager resolve unknown QR key IDs from a remote
+// JWKS, so validator devices pick up rotated keys without an app update
+func (c *CryptoManager) SetQRJWKSClient(client *JWKSClient) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.qrJWKS = client
+}
+
+// QRJWKS returns the Ed25519 public keys QR codes are verified with
+func (c *CryptoManager) QRJWKS() (*JWKSet, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	set := &JWKSet{Keys: []JWK{}}
+	for kid, key := range c.qrPublicKeys {
+		jwk, err := NewJWK(key, AlgorithmEdDSA, kid)
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	if len(set.Keys) == 0 {
+		return nil, errors.New("crypto manager has no QR public keys to publish")
+	}
+	return set, nil
+}
+
+// QRJWKSHandler returns an HTTP handler serving the QR public keys for
+// validator apps
+func (c *CryptoManager) QRJWKSHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		set, err := c.QRJWKS()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(set)
+	}
+}
+
+// qrSigningKeyEd25519 returns the Ed25519 signing key, if one is configured
+func (c *CryptoManager) qrSigningKeyEd25519() *ed25519SigningKey {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.qrEd25519Key
+}
+
+// findQRPublicKey returns the Ed25519 public key with the given ID, looking
+// it up in the remote JWKS when it isn't configured locally
+func (c *CryptoManager) findQRPublicKey(kid string) (ed25519.PublicKey, bool) {
+	if kid == "" {
+		return nil, false
+	}
+
+	c.mutex.RLock()
+	key, found := c.qrPublicKeys[kid]
+	client := c.qrJWKS
+	c.mutex.RUnlock()
+
+	if found || client == nil {
+		return key, found
+	}
+
+	jwk, err := client.Key(context.Background(), kid)
+	if err != nil || (jwk.Alg != "" && jwk.Alg != AlgorithmEdDSA) {
+		return nil, false
+	}
+	publicKey, err := jwk.PublicKey()
+	if err != nil {
+		return nil, false
+	}
+	key, ok := publicKey.(ed25519.PublicKey)
+	return key, ok
+}
+
+// verifyQRSignatureEd25519 returns 1 if the hex signature is valid for the data
+func verifyQRSignatureEd25519(key ed25519.PublicKey, data, signature string) int {
+	raw, err := hex.DecodeString(signature)
+	if err != nil || len(raw) != ed25519.SignatureSize {
+		return 0
+	}
+	if ed25519.Verify(key, []byte(data), raw) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newQRSigningKey(t *testing.T) ed25519.PrivateKey {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+func TestEd25519QRSignatures(t *testing.T) {
+	issuer := NewCryptoManager("test-secret-key-32-chars-long")
+	legacy, err := issuer.CreateQRCodeData(testAccessCode(), "org-456")
+	require.NoError(t, err)
+
+	key := newQRSigningKey(t)
+	require.NoError(t, issuer.SetQRSigningKeyEd25519("qr-1", key))
+
+	qrData, err := issuer.CreateQRCodeData(testAccessCode(), "org-456")
+	require.NoError(t, err)
+	assert.Equal(t, "qr-1", qrData.KeyID)
+	assert.Len(t, qrData.Signature, 2*ed25519.SignatureSize)
+	assert.True(t, issuer.ValidateQRCodeData(qrData))
+
+	// Codes signed with the HMAC key before the switch still validate
+	assert.True(t, issuer.ValidateQRCodeData(legacy))
+
+	// A validator device holds only the public key
+	validator := NewCryptoManager("")
+	require.NoError(t, validator.AddQRVerificationKey("qr-1", key.Public().(ed25519.PublicKey)))
+	assert.True(t, validator.ValidateQRCodeData(qrData))
+	assert.False(t, validator.ValidateQRCodeData(legacy))
+
+	tampered := *qrData
+	tampered.Purpose = "delivery"
+	assert.False(t, validator.ValidateQRCodeData(&tampered))
+
+	// The payload round trip keeps the signature intact
+	payload, err := EncodeQRPayload(qrData)
+	require.NoError(t, err)
+	decoded, err := DecodeQRPayload(payload)
+	require.NoError(t, err)
+	assert.True(t, validator.ValidateQRCodeData(decoded))
+}
+
+func TestEmptySecretRejectsHMAC(t *testing.T) {
+	validator := NewCryptoManager("")
+
+	// Anyone can compute an HMAC with an empty key, so it must never validate
+	qrData, err := validator.CreateQRCodeData(testAccessCode(), "org-456")
+	require.NoError(t, err)
+	assert.False(t, validator.ValidateQRCodeData(qrData))
+}
+
+func TestQRVerificationKeyIDs(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	require.NoError(t, crypto.AddSigningKey("v2", "rotated-secret-key-32-chars-long"))
+
+	publicKey := newQRSigningKey(t).Public().(ed25519.PublicKey)
+	assert.Error(t, crypto.AddQRVerificationKey("v2", publicKey))
+	assert.Error(t, crypto.AddQRVerificationKey("", publicKey))
+	assert.Error(t, crypto.AddQRVerificationKey("qr-1", publicKey[:10]))
+
+	require.NoError(t, crypto.AddQRVerificationKey("qr-1", publicKey))
+	assert.Error(t, crypto.AddSigningKey("qr-1", "another-secret"))
+
+	// The key ID defaults to the JWK thumbprint
+	key := newQRSigningKey(t)
+	require.NoError(t, crypto.SetQRSigningKeyEd25519("", key))
+	thumbprint, err := JWKThumbprint(key.Public())
+	require.NoError(t, err)
+	qrData, err := crypto.CreateQRCodeData(testAccessCode(), "org-456")
+	require.NoError(t, err)
+	assert.Equal(t, thumbprint, qrData.KeyID)
+}
+
+func TestQRJWKSDistribution(t *testing.T) {
+	issuer := NewCryptoManager("test-secret-key-32-chars-long")
+	_, err := issuer.QRJWKS()
+	assert.Error(t, err)
+
+	require.NoError(t, issuer.SetQRSigningKeyEd25519("qr-1", newQRSigningKey(t)))
+
+	server := httptest.NewServer(issuer.QRJWKSHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var set JWKSet
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&set))
+	require.Len(t, set.Keys, 1)
+	assert.Equal(t, "OKP", set.Keys[0].Kty)
+	assert.Equal(t, "Ed25519", set.Keys[0].Crv)
+	assert.Equal(t, AlgorithmEdDSA, set.Keys[0].Alg)
+	assert.Equal(t, "qr-1", set.Keys[0].Kid)
+
+	validator := NewCryptoManager("")
+	validator.SetQRJWKSClient(NewJWKSClient(server.URL, &JWKSClientConfig{RefreshInterval: time.Hour, Timeout: time.Second}))
+
+	qrData, err := issuer.CreateQRCodeData(testAccessCode(), "org-456")
+	require.NoError(t, err)
+	assert.True(t, validator.ValidateQRCodeData(qrData))
+
+	// A rotated key is fetched on first use
+	require.NoError(t, issuer.SetQRSigningKeyEd25519("qr-2", newQRSigningKey(t)))
+	rotated, err := issuer.CreateQRCodeData(testAccessCode(), "org-456")
+	require.NoError(t, err)
+	assert.True(t, validator.ValidateQRCodeData(rotated))
+
+	unknown := *rotated
+	unknown.KeyID = "qr-3"
+	assert.False(t, validator.ValidateQRCodeData(&unknown))
+}
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/redis/go-redis/v9"
+)
+
+// qrNonceSize is the number of random bytes in a QR code nonce
+const qrNonceSize = 12
+
+var (
+	// ErrInvalidQRCode is returned when QR code data is expired, badly signed
+	// or bound to another validator
+	ErrInvalidQRCode = errors.New("invalid QR code")
+
+	// ErrQRCodeReplayed is returned when a QR code has already been accepted
+	ErrQRCodeReplayed = errors.New("QR code has already been used")
+
+	// ErrReplayCacheRequired is returned when single-use validation is
+	// attempted without a replay cache
+	ErrReplayCacheRequired = errors.New("a replay cache is required for single-use QR codes")
+)
+
+// ReplayCache records accepted QR code nonces so each code is accepted once
+type ReplayCache interface {
+	// MarkUsed atomically records the nonce as used until expiresAt, or for
+	// good when expiresAt is zero. It returns false if the nonce had already
+	// been marked.
+	MarkUsed(ctx context.Context, nonce string, expiresAt time.Time) (bool, error)
+}
+
+// SetReplayCache sets the cache used by ValidateQRCodeDataOnce
+func (c *CryptoManager) SetReplayCache(cache ReplayCache) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.replayCache = cache
+}
+
+// ValidateQRCodeDataOnce validates QR code data for the given validator and
+// records its nonce, so presenting the same code again fails with
+// ErrQRCodeReplayed. Codes bound to another validator and codes without a
+// nonce are rejected with ErrInvalidQRCode.
+func (c *CryptoManager) ValidateQRCodeDataOnce(ctx context.Context, qrData *types.QRCodeData, validatorID string) error {
+	c.mutex.RLock()
+	cache := c.replayCache
+	c.mutex.RUnlock()
+
+	if cache == nil {
+		return ErrReplayCacheRequired
+	}
+
+	unexpired, signed := c.checkQRCodeData(qrData, c.now())
+	bound := qrData.ValidatorID == "" || qrData.ValidatorID == validatorID
+	if unexpired&signed != 1 || !bound || qrData.Nonce == "" {
+		return ErrInvalidQRCode
+	}
+
+	fresh, err := cache.MarkUsed(ctx, qrData.OrgID+":"+qrData.Nonce, qrData.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrQRCodeReplayed
+	}
+	return nil
+}
+
+// MemoryReplayCache is an in-process ReplayCache for a single validator
+// device or service instance
+type MemoryReplayCache struct {
+	used      map[string]time.Time
+	lastSweep time.Time
+	clock     clock.Clock
+	mutex     sync.Mutex
+}
+
+// NewMemoryReplayCache creates a new in-memory replay cache
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{
+		used: make(map[string]time.Time),
+	}
+}
+
+// SetClock sets the clock nonces expire against; pass the CryptoManager's
+// clock in tests
+func (r *MemoryReplayCache) SetClock(c clock.Clock) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.clock = c
+}
+
+// MarkUsed records the nonce as used until the QR code expires
+func (r *MemoryReplayCache) MarkUsed(ctx context.Context, nonce string, expiresAt time.Time) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := clock.OrReal(r.clock).Now()
+	r.sweep(now)
+
+	if exp, exists := r.used[nonce]; exists && !nonceExpired(exp, now) {
+		return false, nil
+	}
+	r.used[nonce] = expiresAt
+	return true, nil
+}
+
+// nonceExpired reports whether a nonce used until exp may be forgotten;
+// nonces of codes without an expiry are kept
+func nonceExpired(exp, now time.Time) bool {
+	return !exp.IsZero() && now.After(exp)
+}
+
+// sweep drops expired nonces, at most once a minute
+func (r *MemoryReplayCache) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < time.Minute {
+		return
+	}
+	r.lastSweep = now
+
+	for id, exp := range r.used {
+		if nonceExpired(exp, now) {
+			delete(r.used, id)
+		}
+	}
+}
+
+// RedisReplayCache is a ReplayCache backed by Redis, shared by every
+// validator that syncs with it
+type RedisReplayCache struct {
+	client    redis.UniversalClient
+	keyPrefix string
+}
+
+// NewRedisReplayCache creates a Redis backed replay cache
+func NewRedisReplayCache(client redis.UniversalClient, keyPrefix string) *RedisReplayCache {
+	if keyPrefix == "" {
+		keyPrefix = "qr:used"
+	}
+
+	return &RedisReplayCache{
+		client:    client,
+		keyPrefix: keyPrefix,
+	}
+}
+
+// MarkUsed records the nonce as used with SETNX until the QR code expires,
+// without a TTL for codes that never expire
+func (r *RedisReplayCache) MarkUsed(ctx context.Context, nonce string, expiresAt time.Time) (bool, error) {
+	var ttl time.Duration
+	if !expiresAt.IsZero() {
+		ttl = time.Until(expiresAt)
+		if ttl <= 0 {
+			ttl = time.Second
+		}
+	}
+	return r.client.SetNX(ctx, r.keyPrefix+":"+nonce, 1, ttl).Result()
+}
@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayCaches(t *testing.T) {
+	caches := map[string]ReplayCache{
+		"memory": NewMemoryReplayCache(),
+		"redis":  NewRedisReplayCache(newTestRedis(t), ""),
+	}
+
+	for name, cache := range caches {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			expiresAt := time.Now().Add(time.Hour)
+
+			fresh, err := cache.MarkUsed(ctx, "nonce-1", expiresAt)
+			require.NoError(t, err)
+			assert.True(t, fresh)
+
+			fresh, err = cache.MarkUsed(ctx, "nonce-1", expiresAt)
+			require.NoError(t, err)
+			assert.False(t, fresh)
+
+			fresh, err = cache.MarkUsed(ctx, "nonce-2", expiresAt)
+			require.NoError(t, err)
+			assert.True(t, fresh)
+
+			// Nonces of codes without an expiry are kept
+			fresh, err = cache.MarkUsed(ctx, "nonce-3", time.Time{})
+			require.NoError(t, err)
+			assert.True(t, fresh)
+			fresh, err = cache.MarkUsed(ctx, "nonce-3", time.Time{})
+			require.NoError(t, err)
+			assert.False(t, fresh)
+		})
+	}
+}
+
+func TestMemoryReplayCacheExpires(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 3, 15, 13, 45, 0, 0, time.UTC))
+	cache := NewMemoryReplayCache()
+	cache.SetClock(fake)
+	ctx := context.Background()
+
+	fresh, err := cache.MarkUsed(ctx, "expiring", fake.Now().Add(30*time.Second))
+	require.NoError(t, err)
+	assert.True(t, fresh)
+	fresh, err = cache.MarkUsed(ctx, "active", fake.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, fresh)
+
+	// Expired nonces read as unused before they are swept
+	fake.Advance(45 * time.Second)
+	fresh, err = cache.MarkUsed(ctx, "expiring", fake.Now().Add(30*time.Second))
+	require.NoError(t, err)
+	assert.True(t, fresh)
+	assert.Len(t, cache.used, 2)
+
+	// and are swept once a minute
+	fake.Advance(time.Minute)
+	fresh, err = cache.MarkUsed(ctx, "active", fake.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, fresh)
+	assert.NotContains(t, cache.used, "expiring")
+	assert.Contains(t, cache.used, "active")
+}
+
+func TestValidateQRCodeDataOnce(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	ctx := context.Background()
+
+	qrData, err := crypto.CreateQRCodeData(testAccessCode(), "org-456")
+	require.NoError(t, err)
+	assert.NotEmpty(t, qrData.Nonce)
+
+	assert.ErrorIs(t, crypto.ValidateQRCodeDataOnce(ctx, qrData, "gate-1"), ErrReplayCacheRequired)
+
+	crypto.SetReplayCache(NewMemoryReplayCache())
+	assert.NoError(t, crypto.ValidateQRCodeDataOnce(ctx, qrData, "gate-1"))
+	assert.ErrorIs(t, crypto.ValidateQRCodeDataOnce(ctx, qrData, "gate-2"), ErrQRCodeReplayed)
+
+	// Stateless validation is unaffected
+	assert.True(t, crypto.ValidateQRCodeData(qrData))
+
+	// Every QR code gets its own nonce
+	other, err := crypto.CreateQRCodeData(testAccessCode(), "org-456")
+	require.NoError(t, err)
+	assert.NotEqual(t, qrData.Nonce, other.Nonce)
+	assert.NoError(t, crypto.ValidateQRCodeDataOnce(ctx, other, "gate-1"))
+
+	// The nonce is covered by the signature
+	forged := *qrData
+	forged.Nonce = "fresh-nonce"
+	assert.ErrorIs(t, crypto.ValidateQRCodeDataOnce(ctx, &forged, "gate-1"), ErrInvalidQRCode)
+
+	expired := testAccessCode()
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	expiredData, err := crypto.CreateQRCodeData(expired, "org-456")
+	require.NoError(t, err)
+	assert.ErrorIs(t, crypto.ValidateQRCodeDataOnce(ctx, expiredData, "gate-1"), ErrInvalidQRCode)
+}
+
+func TestValidateQRCodeDataOnceBinding(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	crypto.SetReplayCache(NewMemoryReplayCache())
+	ctx := context.Background()
+
+	qrData, err := crypto.CreateBoundQRCodeData(testAccessCode(), "org-456", "gate-1")
+	require.NoError(t, err)
+	assert.Equal(t, "gate-1", qrData.ValidatorID)
+
+	assert.ErrorIs(t, crypto.ValidateQRCodeDataOnce(ctx, qrData, "gate-2"), ErrInvalidQRCode)
+
+	// Removing the binding breaks the signature
+	unbound := *qrData
+	unbound.ValidatorID = ""
+	assert.ErrorIs(t, crypto.ValidateQRCodeDataOnce(ctx, &unbound, "gate-2"), ErrInvalidQRCode)
+
+	assert.NoError(t, crypto.ValidateQRCodeDataOnce(ctx, qrData, "gate-1"))
+}
+
+func TestValidateQRCodeDataOnceRequiresNonce(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	crypto.SetReplayCache(NewMemoryReplayCache())
+
+	// Codes signed before nonces existed still validate statelessly but
+	// cannot be accepted as single-use
+	legacy, err := crypto.CreateQRCodeData(testAccessCode(), "org-456")
+	require.NoError(t, err)
+	legacy.Nonce = ""
+	legacy.Signature = crypto.GenerateSignature(qrSigningData(legacy))
+
+	assert.True(t, crypto.ValidateQRCodeData(legacy))
+	assert.ErrorIs(t, crypto.ValidateQRCodeDataOnce(context.Background(), legacy, "gate-1"), ErrInvalidQRCode)
+}
@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// QRPayloadPrefix identifies version 1 of the compact QR payload encoding
+const QRPayloadPrefix = "JK1."
+
+// ErrInvalidQRPayload is returned when a scanned payload cannot be decoded
+var ErrInvalidQRPayload = errors.New("invalid QR payload")
+
+// EncodeQRPayload encodes signed QR code data in the compact, versioned form
+// rendered into QR images: JK1.<base64url fields>.<base64url signature>.
+// The fields are a JSON array [code, purpose, org_id, expires_at, kid, nonce,
+// validator_id] with trailing empty fields omitted.
+func EncodeQRPayload(qrData *types.QRCodeData) (string, error) {
+	signature, err := hex.DecodeString(qrData.Signature)
+	if err != nil || len(signature) == 0 {
+		return "", errors.New("QR code data is not signed")
+	}
+
+	fields := []interface{}{qrData.Code, qrData.Purpose, qrData.OrgID, qrData.ExpiresAt.Unix()}
+	optional := []string{qrData.KeyID, qrData.Nonce, qrData.ValidatorID}
+	for len(optional) > 0 && optional[len(optional)-1] == "" {
+		optional = optional[:len(optional)-1]
+	}
+	for _, field := range optional {
+		fields = append(fields, field)
+	}
+
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+
+	return QRPayloadPrefix +
+		base64.RawURLEncoding.EncodeToString(encoded) + "." +
+		base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// DecodeQRPayload decodes a payload produced by EncodeQRPayload. The result
+// still has to be checked with ValidateQRCodeData.
+func DecodeQRPayload(payload string) (*types.QRCodeData, error) {
+	if !strings.HasPrefix(payload, QRPayloadPrefix) {
+		return nil, ErrInvalidQRPayload
+	}
+
+	encodedFields, encodedSignature, found := strings.Cut(strings.TrimPrefix(payload, QRPayloadPrefix), ".")
+	if !found {
+		return nil, ErrInvalidQRPayload
+	}
+
+	rawFields, err := base64.RawURLEncoding.DecodeString(encodedFields)
+	if err != nil {
+		return nil, ErrInvalidQRPayload
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || len(signature) == 0 {
+		return nil, ErrInvalidQRPayload
+	}
+
+	var fields []json.RawMessage
+	if err := json.Unmarshal(rawFields, &fields); err != nil || len(fields) < 4 {
+		return nil, ErrInvalidQRPayload
+	}
+
+	qrData := &types.QRCodeData{Signature: hex.EncodeToString(signature)}
+	var expiresAt int64
+	targets := []interface{}{&qrData.Code, &qrData.Purpose, &qrData.OrgID, &expiresAt, &qrData.KeyID, &qrData.Nonce, &qrData.ValidatorID}
+	for i, field := range fields {
+		if i >= len(targets) {
+			break
+		}
+		if err := json.Unmarshal(field, targets[i]); err != nil {
+			return nil, ErrInvalidQRPayload
+		}
+	}
+	qrData.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return qrData, nil
+}
+
+// newQRCode encodes the QR code data payload as a QR symbol
+func newQRCode(qrData *types.QRCodeData) (*qrcode.QRCode, error) {
+	payload, err := EncodeQRPayload(qrData)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := qrcode.New(payload, qrcode.Medium)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	return code, nil
+}
+
+// GenerateQRCodePNG renders the QR code data as a PNG image of size x size pixels
+func GenerateQRCodePNG(qrData *types.QRCodeData, size int) ([]byte, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("size must be positive, got %d", size)
+	}
+
+	code, err := newQRCode(qrData)
+	if err != nil {
+		return nil, err
+	}
+	return code.PNG(size)
+}
+
+// GenerateQRCodeSVG renders the QR code data as an SVG image of size x size units
+func GenerateQRCodeSVG(qrData *types.QRCodeData, size int) (string, error) {
+	if size <= 0 {
+		return "", fmt.Errorf("size must be positive, got %d", size)
+	}
+
+	code, err := newQRCode(qrData)
+	if err != nil {
+		return "", err
+	}
+
+	bitmap := code.Bitmap()
+	modules := len(bitmap)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, modules, modules)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#ffffff"/><path fill="#000000" d="`, modules, modules)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return b.String(), nil
+}
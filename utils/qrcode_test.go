@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQRPayloadRoundTrip(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	require.NoError(t, crypto.AddSigningKey("v2", "rotated-secret-key-32-chars-long"))
+
+	qrData, err := crypto.CreateQRCodeData(testAccessCode(), "org-456")
+	require.NoError(t, err)
+
+	payload, err := EncodeQRPayload(qrData)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(payload, QRPayloadPrefix))
+
+	decoded, err := DecodeQRPayload(payload)
+	require.NoError(t, err)
+	assert.Equal(t, qrData.Code, decoded.Code)
+	assert.Equal(t, qrData.Purpose, decoded.Purpose)
+	assert.Equal(t, qrData.OrgID, decoded.OrgID)
+	assert.Equal(t, qrData.KeyID, decoded.KeyID)
+	assert.Equal(t, qrData.Nonce, decoded.Nonce)
+	assert.Equal(t, qrData.Signature, decoded.Signature)
+	assert.Equal(t, qrData.ExpiresAt.Unix(), decoded.ExpiresAt.Unix())
+	assert.True(t, crypto.ValidateQRCodeData(decoded))
+
+	// Shorter than the JSON encoding clients used before
+	assert.Less(t, len(payload), 160)
+}
+
+func TestQRPayloadValidatorBinding(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	qrData, err := crypto.CreateBoundQRCodeData(testAccessCode(), "org-456", "gate-1")
+	require.NoError(t, err)
+
+	payload, err := EncodeQRPayload(qrData)
+	require.NoError(t, err)
+
+	decoded, err := DecodeQRPayload(payload)
+	require.NoError(t, err)
+	assert.Equal(t, "gate-1", decoded.ValidatorID)
+	assert.Equal(t, qrData.Nonce, decoded.Nonce)
+	assert.True(t, crypto.ValidateQRCodeData(decoded))
+}
+
+func TestDecodeQRPayloadRejectsMalformed(t *testing.T) {
+	for _, payload := range []string{
+		"",
+		`{"code":"123456"}`,
+		"JK1.",
+		"JK1.bm90LWpzb24.c2ln",
+		"JK1.WyIxMjM0NTYiXQ.c2ln",
+		"JK1.WyIxMjM0NTYiLCJ2aXNpdG9yIiwib3JnIiwieCJd.c2ln",
+		"JK1.WyIxMjM0NTYiLCJ2aXNpdG9yIiwib3JnIiwxXQ.",
+	} {
+		_, err := DecodeQRPayload(payload)
+		assert.ErrorIs(t, err, ErrInvalidQRPayload, payload)
+	}
+}
+
+func TestDecodeQRPayloadTamperedFails(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	qrData, err := crypto.CreateQRCodeData(testAccessCode(), "org-456")
+	require.NoError(t, err)
+
+	qrData.OrgID = "org-999"
+	payload, err := EncodeQRPayload(qrData)
+	require.NoError(t, err)
+
+	decoded, err := DecodeQRPayload(payload)
+	require.NoError(t, err)
+	assert.False(t, crypto.ValidateQRCodeData(decoded))
+}
+
+func TestGenerateQRCodePNG(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	qrData, err := crypto.CreateQRCodeData(testAccessCode(), "org-456")
+	require.NoError(t, err)
+
+	data, err := GenerateQRCodePNG(qrData, 256)
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 256, img.Bounds().Dx())
+	assert.Equal(t, 256, img.Bounds().Dy())
+
+	_, err = GenerateQRCodePNG(qrData, 0)
+	assert.Error(t, err)
+
+	qrData.Signature = ""
+	_, err = GenerateQRCodePNG(qrData, 256)
+	assert.Error(t, err)
+}
+
+func TestGenerateQRCodeSVG(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	qrData, err := crypto.CreateQRCodeData(testAccessCode(), "org-456")
+	require.NoError(t, err)
+
+	svg, err := GenerateQRCodeSVG(qrData, 200)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="200" height="200"`))
+	assert.True(t, strings.HasSuffix(svg, "</svg>"))
+	assert.Contains(t, svg, "h1v1h-1z")
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignedURL(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	fake := clock.NewFake(time.Date(2026, 3, 15, 13, 45, 0, 0, time.UTC))
+	crypto.SetClock(fake)
+
+	signed, err := crypto.NewSignedURL("https://api.jarakey.com/reports/42/download?format=pdf", time.Hour, map[string]string{"org_id": "org-1"})
+	require.NoError(t, err)
+	u, err := url.Parse(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "/reports/42/download", u.Path)
+	assert.Equal(t, "1773585900", u.Query().Get("exp"))
+
+	claims, err := crypto.VerifySignedURL(u)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"format": "pdf", "org_id": "org-1"}, claims)
+
+	// Behind another hostname the link still works
+	u.Host = "downloads.jarakey.com"
+	_, err = crypto.VerifySignedURL(u)
+	assert.NoError(t, err)
+
+	fake.Advance(time.Hour + time.Second)
+	_, err = crypto.VerifySignedURL(u)
+	assert.ErrorIs(t, err, ErrSignedURLExpired)
+}
+
+func TestSignedURLTampering(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	signed, err := crypto.NewSignedURL("/guest/visits/7", time.Hour, map[string]string{"guest": "visitor-1"})
+	require.NoError(t, err)
+
+	tamper := map[string]func(u *url.URL){
+		"path":      func(u *url.URL) { u.Path = "/guest/visits/8" },
+		"claim":     func(u *url.URL) { q := u.Query(); q.Set("guest", "visitor-2"); u.RawQuery = q.Encode() },
+		"extra":     func(u *url.URL) { q := u.Query(); q.Set("admin", "true"); u.RawQuery = q.Encode() },
+		"expiry":    func(u *url.URL) { q := u.Query(); q.Set("exp", "9999999999"); u.RawQuery = q.Encode() },
+		"no sig":    func(u *url.URL) { q := u.Query(); q.Del("sig"); u.RawQuery = q.Encode() },
+		"key id":    func(u *url.URL) { q := u.Query(); q.Set("kid", "unknown"); u.RawQuery = q.Encode() },
+		"no expiry": func(u *url.URL) { q := u.Query(); q.Del("exp"); u.RawQuery = q.Encode() },
+	}
+	for name, change := range tamper {
+		t.Run(name, func(t *testing.T) {
+			u, _ := url.Parse(signed)
+			change(u)
+			_, err := crypto.VerifySignedURL(u)
+			assert.ErrorIs(t, err, ErrInvalidSignedURL)
+		})
+	}
+
+	_, err = NewCryptoManager("another-secret-key-32-chars-long").VerifySignedURL(mustParseURL(t, signed))
+	assert.ErrorIs(t, err, ErrInvalidSignedURL)
+}
+
+func TestSignedURLKeyRotation(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	legacy, err := crypto.NewSignedURL("/reports/1", time.Hour, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, crypto.AddSigningKey("2026-03", "rotated-secret-key-32-chars-long"))
+	rotated, err := crypto.NewSignedURL("/reports/1", time.Hour, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-03", mustParseURL(t, rotated).Query().Get("kid"))
+
+	// Outstanding links keep working until their key is removed
+	_, err = crypto.VerifySignedURL(mustParseURL(t, legacy))
+	assert.NoError(t, err)
+	_, err = crypto.VerifySignedURL(mustParseURL(t, rotated))
+	assert.NoError(t, err)
+
+	require.NoError(t, crypto.RemoveSigningKey(""))
+	_, err = crypto.VerifySignedURL(mustParseURL(t, legacy))
+	assert.ErrorIs(t, err, ErrInvalidSignedURL)
+}
+
+func TestNewSignedURLErrors(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	_, err := crypto.NewSignedURL("/reports/1", 0, nil)
+	assert.Error(t, err)
+	_, err = crypto.NewSignedURL("/reports/1", time.Hour, map[string]string{"sig": "x"})
+	assert.Error(t, err)
+	_, err = crypto.NewSignedURL("://bad", time.Hour, nil)
+	assert.Error(t, err)
+}
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	return u
+}
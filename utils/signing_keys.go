@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+)
+
+// signingKey is a versioned HMAC key used for QR code signatures. The key
+// created from the manager's secret has an empty ID.
+type signingKey struct {
+	id     string
+	secret []byte
+}
+
+// AddSigningKey adds a versioned signing key and makes it current. Codes
+// signed with earlier keys keep validating until those keys are removed.
+func (c *CryptoManager) AddSigningKey(kid, secret string) error {
+	if kid == "" {
+		return errors.New("signing key id is required")
+	}
+	if secret == "" {
+		return errors.New("signing key secret is required")
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, key := range c.signingKeys {
+		if key.id == kid {
+			return fmt.Errorf("signing key %q already exists", kid)
+		}
+	}
+	if _, exists := c.qrPublicKeys[kid]; exists {
+		return fmt.Errorf("key id %q is already used by an Ed25519 verification key", kid)
+	}
+	c.signingKeys = append(c.signingKeys, signingKey{id: kid, secret: []byte(secret)})
+	return nil
+}
+
+// RemoveSigningKey removes a signing key once nothing it signed is still valid.
+// The last remaining key cannot be removed.
+func (c *CryptoManager) RemoveSigningKey(kid string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i, key := range c.signingKeys {
+		if key.id != kid {
+			continue
+		}
+		if len(c.signingKeys) == 1 {
+			return errors.New("cannot remove the last signing key")
+		}
+		c.signingKeys = append(c.signingKeys[:i:i], c.signingKeys[i+1:]...)
+		return nil
+	}
+	return fmt.Errorf("signing key %q not found", kid)
+}
+
+// SigningKeyIDs returns the configured signing key IDs, oldest first
+func (c *CryptoManager) SigningKeyIDs() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	ids := make([]string, len(c.signingKeys))
+	for i, key := range c.signingKeys {
+		ids[i] = key.id
+	}
+	return ids
+}
+
+// CurrentSigningKeyID returns the ID of the key new signatures are made with
+func (c *CryptoManager) CurrentSigningKeyID() string {
+	return c.currentSigningKey().id
+}
+
+// currentSigningKey returns the newest signing key
+func (c *CryptoManager) currentSigningKey() signingKey {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if len(c.signingKeys) == 0 {
+		return signingKey{secret: []byte(c.secretKey)}
+	}
+	return c.signingKeys[len(c.signingKeys)-1]
+}
+
+// findSigningKey returns the signing key with the given ID
+func (c *CryptoManager) findSigningKey(kid string) (signingKey, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	// A manager created without a secret, e.g. on a validator device that
+	// only holds public keys, must not accept HMACs made with an empty key
+	for _, key := range c.signingKeys {
+		if key.id == kid && len(key.secret) > 0 {
+			return key, true
+		}
+	}
+	return signingKey{}, false
+}
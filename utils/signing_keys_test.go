@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jarakey/jarakey-shared-middleware/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAccessCode() *types.AccessCode {
+	return &types.AccessCode{
+		Code:      "123456",
+		Purpose:   "visitor",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+}
+
+func TestQRCodeSigningKeyRotation(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+
+	// Codes signed before rotation carry no key ID
+	legacy, err := crypto.CreateQRCodeData(testAccessCode(), "org-456")
+	require.NoError(t, err)
+	assert.Empty(t, legacy.KeyID)
+
+	require.NoError(t, crypto.AddSigningKey("2024-06", "rotated-secret-key-32-chars-long"))
+	assert.Equal(t, "2024-06", crypto.CurrentSigningKeyID())
+	assert.Equal(t, []string{"", "2024-06"}, crypto.SigningKeyIDs())
+
+	rotated, err := crypto.CreateQRCodeData(testAccessCode(), "org-456")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-06", rotated.KeyID)
+	assert.NotEqual(t, legacy.Signature, rotated.Signature)
+
+	// Outstanding codes keep validating alongside new ones
+	assert.True(t, crypto.ValidateQRCodeData(legacy))
+	assert.True(t, crypto.ValidateQRCodeData(rotated))
+
+	// The key ID is covered by the signature
+	forged := *rotated
+	forged.KeyID = ""
+	assert.False(t, crypto.ValidateQRCodeData(&forged))
+
+	unknown := *rotated
+	unknown.KeyID = "2099-01"
+	assert.False(t, crypto.ValidateQRCodeData(&unknown))
+
+	// Retiring the original secret invalidates only its codes
+	require.NoError(t, crypto.RemoveSigningKey(""))
+	assert.False(t, crypto.ValidateQRCodeData(legacy))
+	assert.True(t, crypto.ValidateQRCodeData(rotated))
+}
+
+func TestVerifySignatureAcrossKeys(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	signature := crypto.GenerateSignature("payload")
+
+	require.NoError(t, crypto.AddSigningKey("v2", "rotated-secret-key-32-chars-long"))
+	assert.NotEqual(t, signature, crypto.GenerateSignature("payload"))
+	assert.True(t, crypto.VerifySignature("payload", signature))
+	assert.True(t, crypto.VerifySignature("payload", crypto.GenerateSignature("payload")))
+}
+
+func TestSigningKeyManagement(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+
+	assert.Error(t, crypto.AddSigningKey("", "secret"))
+	assert.Error(t, crypto.AddSigningKey("v2", ""))
+	require.NoError(t, crypto.AddSigningKey("v2", "secret"))
+	assert.Error(t, crypto.AddSigningKey("v2", "other-secret"))
+
+	assert.Error(t, crypto.RemoveSigningKey("missing"))
+	require.NoError(t, crypto.RemoveSigningKey("v2"))
+	assert.Error(t, crypto.RemoveSigningKey(""))
+}
@@ -0,0 +1,215 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// totpEncoding is the unpadded base32 alphabet authenticator apps expect
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPConfig holds the parameters for time-based one-time passwords (RFC 6238)
+type TOTPConfig struct {
+	Digits     int           `json:"digits"`
+	Period     time.Duration `json:"period"`
+	Skew       int           `json:"skew"`        // Accepted steps before and after the current one
+	SecretSize int           `json:"secret_size"` // Bytes of entropy in provisioned secrets
+}
+
+// DefaultTOTPConfig returns the parameters supported by all common authenticator apps
+func DefaultTOTPConfig() *TOTPConfig {
+	return &TOTPConfig{
+		Digits:     6,
+		Period:     30 * time.Second,
+		Skew:       1,
+		SecretSize: 20,
+	}
+}
+
+// SetTOTPConfig sets the TOTP parameters
+func (c *CryptoManager) SetTOTPConfig(config *TOTPConfig) {
+	if config == nil {
+		config = DefaultTOTPConfig()
+	}
+	c.totpConfig = config
+}
+
+// TOTPConfig returns the TOTP parameters
+func (c *CryptoManager) TOTPConfig() *TOTPConfig {
+	if c.totpConfig == nil {
+		return DefaultTOTPConfig()
+	}
+	return c.totpConfig
+}
+
+// GenerateTOTPSecret provisions a new base32 encoded TOTP secret. Store it
+// encrypted, e.g. with EncryptString.
+func (c *CryptoManager) GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, c.TOTPConfig().SecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI returns the otpauth:// provisioning URI rendered as a QR code by
+// authenticator apps
+func (c *CryptoManager) TOTPURI(secret, issuer, account string) string {
+	config := c.TOTPConfig()
+
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(config.Digits))
+	query.Set("period", fmt.Sprint(int(config.Period.Seconds())))
+
+	uri := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+	return uri.String()
+}
+
+// GenerateTOTPCode returns the TOTP code for the secret at the given time
+func (c *CryptoManager) GenerateTOTPCode(secret string, at time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	config := c.TOTPConfig()
+	return hotp(key, totpStep(at, config.Period), config.Digits), nil
+}
+
+// ValidateTOTPCode reports whether the code is valid for the secret now,
+// allowing for the configured clock drift
+func (c *CryptoManager) ValidateTOTPCode(secret, code string) bool {
+	_, ok := c.ValidateTOTPCodeAt(secret, code, c.now())
+	return ok
+}
+
+// ValidateTOTPCodeAt validates the code at the given time and returns the
+// matching time step. Callers that persist the last accepted step can reject
+// a step that is not newer to prevent code reuse.
+func (c *CryptoManager) ValidateTOTPCodeAt(secret, code string, at time.Time) (int64, bool) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+
+	config := c.TOTPConfig()
+	if len(code) != config.Digits {
+		return 0, false
+	}
+
+	current := totpStep(at, config.Period)
+	matched, found := int64(0), false
+	for offset := -config.Skew; offset <= config.Skew; offset++ {
+		step := current + int64(offset)
+		if subtle.ConstantTimeCompare([]byte(hotp(key, step, config.Digits)), []byte(code)) == 1 {
+			matched, found = step, true
+		}
+	}
+	return matched, found
+}
+
+// decodeTOTPSecret decodes a base32 secret, tolerating spaces, lower case and padding
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	normalized := strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	key, err := totpEncoding.DecodeString(strings.TrimRight(normalized, "="))
+	if err != nil || len(key) == 0 {
+		return nil, errors.New("invalid TOTP secret")
+	}
+	return key, nil
+}
+
+// totpStep returns the RFC 6238 time step counter for t
+func totpStep(t time.Time, period time.Duration) int64 {
+	return t.Unix() / int64(period/time.Second)
+}
+
+// hotp computes an RFC 4226 HMAC-SHA1 one-time password
+func hotp(key []byte, counter int64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+	h := hmac.New(sha1.New, key)
+	h.Write(msg[:])
+	sum := h.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+// recoveryCodeAlphabet omits characters that are easily confused when read aloud or typed
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// GenerateRecoveryCodes returns count single-use recovery codes formatted as
+// xxxxx-xxxxx. Show them to the user once and store only HashRecoveryCode values.
+func (c *CryptoManager) GenerateRecoveryCodes(count int) ([]string, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("count must be positive, got %d", count)
+	}
+
+	codes := make([]string, count)
+	buf := make([]byte, 10)
+	for i := range codes {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		// 256 is not a multiple of the alphabet size; the slight bias is
+		// irrelevant at 10 characters of ~4.95 bits each
+		code := make([]byte, len(buf))
+		for j, b := range buf {
+			code[j] = recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)]
+		}
+		codes[i] = string(code[:5]) + "-" + string(code[5:])
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode returns the value to store for a recovery code. Recovery
+// codes are high-entropy, so a fast hash is sufficient.
+func HashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyRecoveryCode checks a recovery code against the stored hashes and
+// returns the index of the matching hash, which the caller must then discard
+func VerifyRecoveryCode(code string, hashes []string) (int, bool) {
+	candidate := []byte(HashRecoveryCode(code))
+
+	index, found := -1, false
+	for i, hash := range hashes {
+		if subtle.ConstantTimeCompare(candidate, []byte(hash)) == 1 && !found {
+			index, found = i, true
+		}
+	}
+	return index, found
+}
+
+// normalizeRecoveryCode strips separators and case so typed codes match
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfc6238Secret is the base32 encoding of the RFC 6238 SHA-1 test key "12345678901234567890"
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGenerateTOTPCodeRFC6238(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+	config := DefaultTOTPConfig()
+	config.Digits = 8
+	crypto.SetTOTPConfig(config)
+
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+
+	for unix, expected := range vectors {
+		code, err := crypto.GenerateTOTPCode(rfc6238Secret, time.Unix(unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, expected, code, "time %d", unix)
+	}
+}
+
+func TestValidateTOTPCode(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+
+	secret, err := crypto.GenerateTOTPSecret()
+	require.NoError(t, err)
+	assert.Len(t, secret, 32) // 20 bytes in unpadded base32
+
+	now := time.Now()
+	code, err := crypto.GenerateTOTPCode(secret, now)
+	require.NoError(t, err)
+	assert.Len(t, code, 6)
+	assert.True(t, crypto.ValidateTOTPCode(secret, code))
+
+	// One step of drift either way is accepted, two are not
+	step, ok := crypto.ValidateTOTPCodeAt(secret, code, now.Add(30*time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, totpStep(now, 30*time.Second), step)
+	_, ok = crypto.ValidateTOTPCodeAt(secret, code, now.Add(-30*time.Second))
+	assert.True(t, ok)
+	_, ok = crypto.ValidateTOTPCodeAt(secret, code, now.Add(90*time.Second))
+	assert.False(t, ok)
+
+	// Secrets are accepted as typed by users
+	assert.True(t, crypto.ValidateTOTPCode(strings.ToLower(secret[:4])+" "+secret[4:], code))
+
+	assert.False(t, crypto.ValidateTOTPCode(secret, "12345"))
+	assert.False(t, crypto.ValidateTOTPCode("not base32!", code))
+}
+
+func TestTOTPURI(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+
+	uri, err := url.Parse(crypto.TOTPURI(rfc6238Secret, "Jarakey", "guard@example.com"))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Jarakey:guard@example.com", uri.Path)
+
+	query := uri.Query()
+	assert.Equal(t, rfc6238Secret, query.Get("secret"))
+	assert.Equal(t, "Jarakey", query.Get("issuer"))
+	assert.Equal(t, "6", query.Get("digits"))
+	assert.Equal(t, "30", query.Get("period"))
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	crypto := NewCryptoManager("test-secret-key-32-chars-long")
+
+	codes, err := crypto.GenerateRecoveryCodes(10)
+	require.NoError(t, err)
+	assert.Len(t, codes, 10)
+
+	hashes := make([]string, len(codes))
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		assert.Regexp(t, `^[a-z2-9]{5}-[a-z2-9]{5}$`, code)
+		assert.False(t, seen[code], "duplicate recovery code")
+		seen[code] = true
+		hashes[i] = HashRecoveryCode(code)
+	}
+
+	index, ok := VerifyRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[3], "-", "")), hashes)
+	assert.True(t, ok)
+	assert.Equal(t, 3, index)
+
+	_, ok = VerifyRecoveryCode("aaaaa-aaaaa", hashes)
+	assert.False(t, ok)
+
+	_, err = crypto.GenerateRecoveryCodes(0)
+	assert.Error(t, err)
+}